@@ -26,7 +26,6 @@ limitations under the License.
 package ghcache
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -48,7 +47,6 @@ import (
 	"github.com/peterbourgon/diskv"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/semaphore"
 	"k8s.io/test-infra/ghproxy/ghmetrics"
 )
 
@@ -66,6 +64,7 @@ const (
 	// free (no API tokens used).
 	ModeCoalesced   CacheResponseMode = "COALESCED"   // coalesced request, this is a copied response
 	ModeRevalidated CacheResponseMode = "REVALIDATED" // cached value revalidated and returned
+	ModeHit         CacheResponseMode = "HIT"         // cached GraphQL response returned without revalidation
 
 	// cacheEntryCreationDateHeader contains the creation date of the cache entry
 	cacheEntryCreationDateHeader = "X-PROW-REQUEST-DATE"
@@ -86,6 +85,8 @@ func CacheModeIsFree(mode CacheResponseMode) bool {
 		return true
 	case ModeRevalidated:
 		return true
+	case ModeHit:
+		return true
 	case ModeError:
 		// In this case we did not successfully communicate with the GH API, so no
 		// token is used, but we also don't return a response, so ModeError won't
@@ -137,23 +138,26 @@ func cacheResponseMode(headers http.Header) CacheResponseMode {
 	return ModeMiss
 }
 
-func newThrottlingTransport(maxConcurrency int, delegate http.RoundTripper) http.RoundTripper {
-	return &throttlingTransport{sem: semaphore.NewWeighted(int64(maxConcurrency)), delegate: delegate}
+func newThrottlingTransport(maxConcurrency int, priorities *PriorityClasses, delegate http.RoundTripper) http.RoundTripper {
+	return &throttlingTransport{sem: newPrioritySemaphore(maxConcurrency, priorities.levels()), priorities: priorities, delegate: delegate}
 }
 
-// throttlingTransport throttles outbound concurrency from the proxy
+// throttlingTransport throttles outbound concurrency from the proxy, letting
+// callers with a higher priority go first.
 type throttlingTransport struct {
-	sem      *semaphore.Weighted
-	delegate http.RoundTripper
+	sem        *prioritySemaphore
+	priorities *PriorityClasses
+	delegate   http.RoundTripper
 }
 
 func (c *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	pendingOutboundConnectionsGauge.Inc()
-	if err := c.sem.Acquire(context.Background(), 1); err != nil {
-		logrus.WithField("cache-key", req.URL.String()).WithError(err).Error("Internal error acquiring semaphore.")
+	if err := c.sem.acquire(req.Context(), c.priorities.classify(req)); err != nil {
+		pendingOutboundConnectionsGauge.Dec()
+		logrus.WithField("cache-key", req.URL.String()).WithError(err).Warn("Gave up waiting to send request.")
 		return nil, err
 	}
-	defer c.sem.Release(1)
+	defer c.sem.release()
 	pendingOutboundConnectionsGauge.Dec()
 	outboundConcurrencyGauge.Inc()
 	defer outboundConcurrencyGauge.Dec()
@@ -226,7 +230,7 @@ const LogMessageWithDiskPartitionFields = "Not using a partitioned cache because
 // NewDiskCache creates a GitHub cache RoundTripper that is backed by a disk
 // cache.
 // It supports a partitioned cache.
-func NewDiskCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxConcurrency int, legacyDisablePartitioningByAuthHeader bool, cachePruneInterval time.Duration) http.RoundTripper {
+func NewDiskCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxConcurrency int, legacyDisablePartitioningByAuthHeader bool, cachePruneInterval time.Duration, priorities *PriorityClasses, warmer *CacheWarmer, graphqlTTL time.Duration) http.RoundTripper {
 	if legacyDisablePartitioningByAuthHeader {
 		diskCache := diskcache.NewWithDiskv(
 			diskv.New(diskv.Options{
@@ -242,6 +246,9 @@ func NewDiskCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxC
 				return diskCache
 			},
 			maxConcurrency,
+			priorities,
+			warmer,
+			graphqlTTL,
 		)
 	}
 
@@ -265,6 +272,9 @@ func NewDiskCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxC
 				}))
 		},
 		maxConcurrency,
+		priorities,
+		warmer,
+		graphqlTTL,
 	)
 }
 
@@ -340,10 +350,10 @@ type cachePartitionMetadata struct {
 // NewMemCache creates a GitHub cache RoundTripper that is backed by a memory
 // cache.
 // It supports a partitioned cache.
-func NewMemCache(delegate http.RoundTripper, maxConcurrency int) http.RoundTripper {
+func NewMemCache(delegate http.RoundTripper, maxConcurrency int, priorities *PriorityClasses, warmer *CacheWarmer, graphqlTTL time.Duration) http.RoundTripper {
 	return NewFromCache(delegate,
 		func(_ string, _ *time.Time) httpcache.Cache { return httpcache.NewMemoryCache() },
-		maxConcurrency)
+		maxConcurrency, priorities, warmer, graphqlTTL)
 }
 
 // CachePartitionCreator creates a new cache partition using the given key
@@ -351,16 +361,25 @@ type CachePartitionCreator func(partitionKey string, expiresAt *time.Time) httpc
 
 // NewFromCache creates a GitHub cache RoundTripper that is backed by the
 // specified httpcache.Cache implementation.
-func NewFromCache(delegate http.RoundTripper, cache CachePartitionCreator, maxConcurrency int) http.RoundTripper {
+// If priorities are given, callers with a lower priority are throttled to
+// keep API tokens and outbound concurrency for callers with a higher one.
+// If a warmer is given, it keeps the most frequent responses warm.
+// If graphqlTTL is positive, GraphQL query responses are cached for that long.
+func NewFromCache(delegate http.RoundTripper, cache CachePartitionCreator, maxConcurrency int, priorities *PriorityClasses, warmer *CacheWarmer, graphqlTTL time.Duration) http.RoundTripper {
 	hasher := ghmetrics.NewCachingHasher()
 	return newPartitioningRoundTripper(func(partitionKey string, expiresAt *time.Time) http.RoundTripper {
-		cacheTransport := httpcache.NewTransport(cache(partitionKey, expiresAt))
-		cacheTransport.Transport = newThrottlingTransport(maxConcurrency, upstreamTransport{delegate: delegate, hasher: hasher})
-		return &requestCoalescer{
+		partitionCache := cache(partitionKey, expiresAt)
+		cacheTransport := httpcache.NewTransport(partitionCache)
+		cacheTransport.Transport = newPriorityTransport(priorities, hasher, newThrottlingTransport(maxConcurrency, priorities, upstreamTransport{delegate: delegate, hasher: hasher}))
+		var partition http.RoundTripper = &requestCoalescer{
 			keys:     make(map[string]*responseWaiter),
 			delegate: cacheTransport,
 			hasher:   hasher,
 		}
+		if graphqlTTL > 0 {
+			partition = newGraphQLCache(graphqlTTL, hasher, partition, cacheTransport)
+		}
+		return warmer.wrap(partitionKey, expiresAt, partitionCache, partition)
 	})
 }
 
@@ -369,7 +388,7 @@ func NewFromCache(delegate http.RoundTripper, cache CachePartitionCreator, maxCo
 // Important note: The redis implementation does not support partitioning the cache
 // which means that requests to the same path from different tokens will invalidate
 // each other.
-func NewRedisCache(delegate http.RoundTripper, redisAddress string, maxConcurrency int) http.RoundTripper {
+func NewRedisCache(delegate http.RoundTripper, redisAddress string, maxConcurrency int, priorities *PriorityClasses, warmer *CacheWarmer, graphqlTTL time.Duration) http.RoundTripper {
 	conn, err := redis.Dial("tcp", redisAddress)
 	if err != nil {
 		logrus.WithError(err).Fatal("Error connecting to Redis")
@@ -377,5 +396,5 @@ func NewRedisCache(delegate http.RoundTripper, redisAddress string, maxConcurren
 	redisCache := rediscache.NewWithClient(conn)
 	return NewFromCache(delegate,
 		func(_ string, _ *time.Time) httpcache.Cache { return redisCache },
-		maxConcurrency)
+		maxConcurrency, priorities, warmer, graphqlTTL)
 }
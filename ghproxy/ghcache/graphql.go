@@ -0,0 +1,401 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/ghproxy/ghmetrics"
+)
+
+// graphqlResponse is a GraphQL response that is cached or in flight.
+type graphqlResponse struct {
+	// done is closed once the response is received.
+	done     chan struct{}
+	resp     []byte
+	err      error
+	storedAt time.Time
+}
+
+// graphqlCache caches GraphQL query responses for a short time and coalesces
+// identical queries that are in flight, as conditional requests don't work
+// for GraphQL. It is used per cache partition, so that responses are only
+// shared between callers with the same credentials.
+//
+// Callers opt out with a 'Cache-Control: no-cache' request header.
+type graphqlCache struct {
+	ttl time.Duration
+	// delegate handles everything but GraphQL queries, while upstream is
+	// where queries go on a cache miss.
+	delegate http.RoundTripper
+	upstream http.RoundTripper
+	hasher   ghmetrics.Hasher
+	now      func() time.Time
+
+	lock      sync.Mutex
+	responses map[[sha256.Size]byte]*graphqlResponse
+	sweptAt   time.Time
+}
+
+func newGraphQLCache(ttl time.Duration, hasher ghmetrics.Hasher, delegate, upstream http.RoundTripper) *graphqlCache {
+	return &graphqlCache{
+		ttl:       ttl,
+		delegate:  delegate,
+		upstream:  upstream,
+		hasher:    hasher,
+		now:       time.Now,
+		responses: map[[sha256.Size]byte]*graphqlResponse{},
+	}
+}
+
+func isGraphQL(req *http.Request) bool {
+	return req.Method == http.MethodPost && (strings.HasPrefix(req.URL.Path, "graphql") || strings.HasPrefix(req.URL.Path, "/graphql"))
+}
+
+// cacheableQuery returns the body of a GraphQL query that may be cached.
+// Only requests whose selected operation is a query are, unless they opt out.
+func cacheableQuery(req *http.Request) ([]byte, bool, error) {
+	if !isGraphQL(req) || req.Body == nil {
+		return nil, false, nil
+	}
+	cacheControl := req.Header.Get("Cache-Control")
+	if strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") {
+		return nil, false, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var query struct {
+		Query         string `json:"query"`
+		OperationName string `json:"operationName"`
+	}
+	if err := json.Unmarshal(body, &query); err != nil {
+		return body, false, nil
+	}
+	// Documents that can't be parsed are passed on for GitHub to reject.
+	operationType, err := selectedOperationType(query.Query, query.OperationName)
+	if err != nil {
+		logrus.WithError(err).Debug("Not caching a GraphQL request whose operation can't be determined.")
+		return body, false, nil
+	}
+	return body, operationType == "query", nil
+}
+
+// graphqlOperation is an operation defined by a GraphQL document.
+type graphqlOperation struct {
+	operationType string
+	name          string
+}
+
+// selectedOperationType returns the type of the operation that a request
+// executes: the one named operationName, or the only one of the document.
+func selectedOperationType(document, operationName string) (string, error) {
+	operations, err := parseOperations(document)
+	if err != nil {
+		return "", err
+	}
+	if operationName == "" {
+		if len(operations) != 1 {
+			return "", fmt.Errorf("the document defines %d operations, but no operation name is given", len(operations))
+		}
+		return operations[0].operationType, nil
+	}
+	for _, operation := range operations {
+		if operation.name == operationName {
+			return operation.operationType, nil
+		}
+	}
+	return "", fmt.Errorf("the document doesn't define the operation %q", operationName)
+}
+
+// parseOperations returns the operations that a GraphQL document defines,
+// skipping fragments. It only looks at the top level of the document, which
+// is made of definitions like 'query Name($var: Type) @directive { ... }',
+// 'fragment Name on Type { ... }' or a bare selection set for a query.
+func parseOperations(document string) ([]graphqlOperation, error) {
+	var operations []graphqlOperation
+	// header holds the names of the definition before its selection set.
+	var header []string
+	depth := 0
+	for i := 0; i < len(document); {
+		c := document[i]
+		switch {
+		case c == '#':
+			for i < len(document) && document[i] != '\n' && document[i] != '\r' {
+				i++
+			}
+		case c == '"':
+			end, err := skipString(document, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case c == '{' || c == '(' || c == '[':
+			if c == '{' && depth == 0 {
+				operation, isOperation, err := definition(header)
+				if err != nil {
+					return nil, err
+				}
+				if isOperation {
+					operations = append(operations, operation)
+				}
+				header = nil
+			}
+			depth++
+			i++
+		case c == '}' || c == ')' || c == ']':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("unbalanced %q at offset %d", c, i)
+			}
+			i++
+		case c == '@':
+			// Directives aren't part of the header.
+			i++
+			for i < len(document) && isNameChar(document[i]) {
+				i++
+			}
+		case isNameChar(c):
+			start := i
+			for i < len(document) && isNameChar(document[i]) {
+				i++
+			}
+			if depth == 0 {
+				header = append(header, document[start:i])
+			}
+		default:
+			i++
+		}
+	}
+	if depth != 0 || len(header) != 0 {
+		return nil, errors.New("the document ends in the middle of a definition")
+	}
+	return operations, nil
+}
+
+// definition interprets the header of a definition.
+func definition(header []string) (graphqlOperation, bool, error) {
+	if len(header) == 0 {
+		return graphqlOperation{operationType: "query"}, true, nil
+	}
+	switch header[0] {
+	case "query", "mutation", "subscription":
+		operation := graphqlOperation{operationType: header[0]}
+		if len(header) > 1 {
+			operation.name = header[1]
+		}
+		return operation, true, nil
+	case "fragment":
+		return graphqlOperation{}, false, nil
+	default:
+		return graphqlOperation{}, false, fmt.Errorf("unknown definition %q", header[0])
+	}
+}
+
+// skipString returns the offset after the string or block string that starts
+// at the offset.
+func skipString(document string, start int) (int, error) {
+	if strings.HasPrefix(document[start:], `"""`) {
+		for i := start + 3; i < len(document); i++ {
+			switch {
+			case strings.HasPrefix(document[i:], `\"""`):
+				i += 3
+			case strings.HasPrefix(document[i:], `"""`):
+				return i + 3, nil
+			}
+		}
+		return 0, errors.New("unterminated block string")
+	}
+	for i := start + 1; i < len(document); i++ {
+		switch document[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		case '\n', '\r':
+			return 0, errors.New("unterminated string")
+		}
+	}
+	return 0, errors.New("unterminated string")
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (g *graphqlCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, cacheable, err := cacheableQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	if !cacheable {
+		return g.delegate.RoundTrip(req)
+	}
+
+	tokenBudgetName := req.Header.Get(TokenBudgetIdentifierHeader)
+	if tokenBudgetName == "" {
+		tokenBudgetName = g.hasher.Hash(req)
+	}
+	key := sha256.Sum256(body)
+
+	g.lock.Lock()
+	g.sweep()
+	cached, ok := g.responses[key]
+	if ok && g.expired(cached) {
+		delete(g.responses, key)
+		ok = false
+	}
+	if !ok {
+		// No response cached or in flight, so send the query ourselves.
+		call := &graphqlResponse{done: make(chan struct{})}
+		g.responses[key] = call
+		g.lock.Unlock()
+		resp, stored, err := g.query(req, key, call)
+		if err != nil {
+			collectMetrics(ModeError, req, nil, tokenBudgetName)
+			return nil, err
+		}
+		mode := ModeMiss
+		if !stored {
+			mode = ModeNoStore
+		}
+		collectMetrics(mode, req, resp, tokenBudgetName)
+		return resp, nil
+	}
+	g.lock.Unlock()
+
+	mode := ModeHit
+	select {
+	case <-cached.done:
+	default:
+		mode = ModeCoalesced
+		select {
+		case <-cached.done:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	if cached.err != nil {
+		// Don't log the error, it will be logged by requester.
+		return nil, cached.err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(cached.resp)), req)
+	if err != nil {
+		logrus.WithError(err).Error("Error loading cached GraphQL response.")
+		return nil, err
+	}
+	if mode == ModeHit {
+		resp.Header.Set("Age", strconv.Itoa(int(g.now().Sub(cached.storedAt).Seconds())))
+	}
+	collectMetrics(mode, req, resp, tokenBudgetName)
+	return resp, nil
+}
+
+// query sends the query upstream and shares the response with the callers
+// waiting for it. Responses with errors are only shared with the callers that
+// are already waiting. It returns whether the response was cached.
+func (g *graphqlCache) query(req *http.Request, key [sha256.Size]byte, call *graphqlResponse) (*http.Response, bool, error) {
+	resp, err := g.upstream.RoundTrip(req)
+	if err == nil {
+		if call.resp, err = httputil.DumpResponse(resp, true); err != nil {
+			resp.Body.Close()
+			resp = nil
+		}
+	}
+	cacheable := err == nil && resp.StatusCode == http.StatusOK && !hasGraphQLErrors(resp)
+
+	g.lock.Lock()
+	call.err = err
+	call.storedAt = g.now()
+	if !cacheable {
+		delete(g.responses, key)
+	}
+	close(call.done)
+	g.lock.Unlock()
+	return resp, cacheable, err
+}
+
+// hasGraphQLErrors returns whether the response reports errors, e.g. for a
+// part of the query, in which case it should not be reused.
+func hasGraphQLErrors(resp *http.Response) bool {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return true
+	}
+	// Callers may accept compressed responses, which are passed on as is.
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return true
+		}
+		if body, err = ioutil.ReadAll(reader); err != nil {
+			return true
+		}
+	}
+	var response struct {
+		Errors json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return true
+	}
+	return len(response.Errors) > 0 && string(response.Errors) != "null"
+}
+
+// expired returns whether a received response is older than the TTL. The
+// caller must hold the lock.
+func (g *graphqlCache) expired(cached *graphqlResponse) bool {
+	select {
+	case <-cached.done:
+		return g.now().Sub(cached.storedAt) >= g.ttl
+	default:
+		return false
+	}
+}
+
+// sweep drops the responses that are older than the TTL, so that queries
+// that are not repeated don't pile up. The caller must hold the lock.
+func (g *graphqlCache) sweep() {
+	now := g.now()
+	if now.Sub(g.sweptAt) < g.ttl {
+		return
+	}
+	g.sweptAt = now
+	for key, cached := range g.responses {
+		if g.expired(cached) {
+			delete(g.responses, key)
+		}
+	}
+}
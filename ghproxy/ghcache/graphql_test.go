@@ -0,0 +1,287 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/ghproxy/ghmetrics"
+)
+
+// graphqlUpstream answers every query with the configured body, optionally
+// blocking until released.
+type graphqlUpstream struct {
+	lock    sync.Mutex
+	queries int
+	body    string
+	status  int
+	release chan struct{}
+}
+
+func (g *graphqlUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	g.lock.Lock()
+	g.queries++
+	body, status, release := g.body, g.status, g.release
+	g.lock.Unlock()
+	if release != nil {
+		<-release
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: ioutil.NopCloser(bytes.NewBufferString(body)), Request: req}, nil
+}
+
+func (g *graphqlUpstream) sent() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.queries
+}
+
+func graphqlRequest(query string, header ...string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.github.com/graphql", bytes.NewBufferString(`{"query":"`+query+`"}`))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("User-Agent", "tide/v20210101-abcdef")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	return req
+}
+
+func TestGraphQLCache(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	upstream := &graphqlUpstream{body: `{"data":{"viewer":{"login":"bot"}}}`}
+	cache := newGraphQLCache(time.Minute, ghmetrics.NewCachingHasher(), upstream, upstream)
+	cache.now = func() time.Time { return now }
+
+	send := func(req *http.Request) *http.Response {
+		t.Helper()
+		resp, err := cache.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		resp.Body.Close()
+		if string(body) != upstream.body {
+			t.Errorf("expected body %q, got %q", upstream.body, string(body))
+		}
+		return resp
+	}
+
+	if mode := send(graphqlRequest("query { viewer { login } }")).Header.Get(CacheModeHeader); mode != string(ModeMiss) {
+		t.Errorf("expected the first query to miss, got %q", mode)
+	}
+	now = now.Add(10 * time.Second)
+	resp := send(graphqlRequest("query { viewer { login } }"))
+	if mode := resp.Header.Get(CacheModeHeader); mode != string(ModeHit) {
+		t.Errorf("expected the repeated query to hit, got %q", mode)
+	}
+	if age := resp.Header.Get("Age"); age != "10" {
+		t.Errorf("expected an age of 10 seconds, got %q", age)
+	}
+	if sent := upstream.sent(); sent != 1 {
+		t.Errorf("expected one query upstream, got %d", sent)
+	}
+
+	// Other queries, mutations and callers that opt out aren't answered from
+	// the cache.
+	send(graphqlRequest("query { viewer { name } }"))
+	send(graphqlRequest("mutation { addComment }"))
+	send(graphqlRequest("mutation { addComment }"))
+	send(graphqlRequest("query { viewer { login } }", "Cache-Control", "no-cache"))
+	if sent := upstream.sent(); sent != 5 {
+		t.Errorf("expected five queries upstream, got %d", sent)
+	}
+
+	// Responses expire after the TTL.
+	now = now.Add(time.Minute)
+	if mode := send(graphqlRequest("query { viewer { login } }")).Header.Get(CacheModeHeader); mode != string(ModeMiss) {
+		t.Errorf("expected the expired query to miss, got %q", mode)
+	}
+	if sent := upstream.sent(); sent != 6 {
+		t.Errorf("expected six queries upstream, got %d", sent)
+	}
+}
+
+func TestGraphQLCacheSkipsErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{
+			name: "partial errors",
+			body: `{"data":null,"errors":[{"message":"Something went wrong"}]}`,
+		},
+		{
+			name:   "server error",
+			body:   `{"message":"Server Error"}`,
+			status: http.StatusBadGateway,
+		},
+		{
+			name: "not JSON",
+			body: `<html>Unicorn!</html>`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := &graphqlUpstream{body: tc.body, status: tc.status}
+			cache := newGraphQLCache(time.Minute, ghmetrics.NewCachingHasher(), upstream, upstream)
+			for i := 0; i < 2; i++ {
+				resp, err := cache.RoundTrip(graphqlRequest("query { viewer { login } }"))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if mode := resp.Header.Get(CacheModeHeader); mode != string(ModeNoStore) {
+					t.Errorf("expected the response not to be stored, got %q", mode)
+				}
+				resp.Body.Close()
+			}
+			if sent := upstream.sent(); sent != 2 {
+				t.Errorf("expected both queries to go upstream, got %d", sent)
+			}
+		})
+	}
+}
+
+func TestGraphQLCacheCoalesces(t *testing.T) {
+	upstream := &graphqlUpstream{body: `{"data":{"viewer":{"login":"bot"}}}`, release: make(chan struct{})}
+	cache := newGraphQLCache(time.Minute, ghmetrics.NewCachingHasher(), upstream, upstream)
+
+	modes := make(chan string, 3)
+	var wg sync.WaitGroup
+	send := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := cache.RoundTrip(graphqlRequest("query { viewer { login } }"))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			resp.Body.Close()
+			modes <- resp.Header.Get(CacheModeHeader)
+		}()
+	}
+	send()
+	// Wait for the first query to be in flight.
+	for upstream.sent() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	send()
+	send()
+	// Give the other queries a chance to queue up behind it. Those that
+	// don't are answered from the cache instead, which is just as good.
+	time.Sleep(10 * time.Millisecond)
+	close(upstream.release)
+	wg.Wait()
+	close(modes)
+
+	counts := map[string]int{}
+	for mode := range modes {
+		counts[mode]++
+	}
+	if counts[string(ModeMiss)] != 1 || counts[string(ModeMiss)]+counts[string(ModeCoalesced)]+counts[string(ModeHit)] != 3 {
+		t.Errorf("expected one miss and the rest to share it, got %v", counts)
+	}
+	if sent := upstream.sent(); sent != 1 {
+		t.Errorf("expected one query upstream, got %d", sent)
+	}
+}
+
+func TestSelectedOperationType(t *testing.T) {
+	testCases := []struct {
+		name          string
+		document      string
+		operationName string
+		expected      string
+		expectErr     bool
+	}{
+		{
+			name:     "shorthand query",
+			document: "{ viewer { login } }",
+			expected: "query",
+		},
+		{
+			name:     "named query with variables and directives",
+			document: `query Search($q: String! = "mutation {") @cached { search(query: $q) { issueCount } }`,
+			expected: "query",
+		},
+		{
+			name:     "mutation after a comment",
+			document: "# Comment on the PR\nmutation { addComment(input: {body: \"lgtm\"}) { clientMutationId } }",
+			expected: "mutation",
+		},
+		{
+			name:     "mutation with a fragment defined first",
+			document: "fragment F on Comment { id }\nmutation M { addComment { commentEdge { node { ...F } } } }",
+			expected: "mutation",
+		},
+		{
+			name:          "mutation selected by name",
+			document:      "query Q { viewer { login } } mutation M { addComment { clientMutationId } }",
+			operationName: "M",
+			expected:      "mutation",
+		},
+		{
+			name:          "query selected by name",
+			document:      "query Q { viewer { login } } mutation M { addComment { clientMutationId } }",
+			operationName: "Q",
+			expected:      "query",
+		},
+		{
+			name:      "several operations without a name",
+			document:  "query Q { viewer { login } } mutation M { addComment { clientMutationId } }",
+			expectErr: true,
+		},
+		{
+			name:          "unknown operation name",
+			document:      "query Q { viewer { login } }",
+			operationName: "M",
+			expectErr:     true,
+		},
+		{
+			name:     "block string",
+			document: `mutation { addComment(body: """a "quoted" \""" }""") { clientMutationId } }`,
+			expected: "mutation",
+		},
+		{
+			name:      "unbalanced document",
+			document:  "query { viewer { login }",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			operationType, err := selectedOperationType(tc.document, tc.operationName)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected an error: %t, got %v", tc.expectErr, err)
+			}
+			if operationType != tc.expected {
+				t.Errorf("expected the operation type %q, got %q", tc.expected, operationType)
+			}
+		})
+	}
+}
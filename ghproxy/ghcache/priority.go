@@ -0,0 +1,385 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/ghproxy/ghmetrics"
+)
+
+// PriorityClasses configures how callers share the API rate limit of a token
+// and the outbound concurrency of the proxy.
+type PriorityClasses struct {
+	// Classes are ordered from the highest to the lowest priority. Callers
+	// that don't match any class belong to the last one.
+	Classes []PriorityClass `json:"classes"`
+}
+
+// PriorityClass is a group of callers that share a priority.
+type PriorityClass struct {
+	// Name identifies the class in logs and metrics.
+	Name string `json:"name"`
+	// UserAgents are the callers in this class, by user agent without the
+	// version. A component also matches the user agents of its plugins, e.g.
+	// "hook" matches "hook.lgtm".
+	UserAgents []string `json:"user_agents,omitempty"`
+	// ReservedTokens is how many of the hourly core API tokens of each token
+	// are reserved for this class. Classes with a lower priority are
+	// throttled once the remaining budget falls under the tokens reserved
+	// above them. The search and GraphQL rate limits are counted differently
+	// and never throttled.
+	ReservedTokens int `json:"reserved_tokens,omitempty"`
+	// MaxDelay is how long a throttled request may wait for the budget to
+	// reset. Throttled requests are rejected when the reset is further away.
+	MaxDelay metav1.Duration `json:"max_delay,omitempty"`
+}
+
+// Validate checks that the classes are usable.
+func (p *PriorityClasses) Validate() error {
+	if len(p.Classes) == 0 {
+		return errors.New("at least one priority class is required")
+	}
+	names, userAgents := sets.NewString(), sets.NewString()
+	for _, class := range p.Classes {
+		if class.Name == "" {
+			return errors.New("priority classes must have a name")
+		}
+		if names.Has(class.Name) {
+			return fmt.Errorf("priority class %q is defined more than once", class.Name)
+		}
+		names.Insert(class.Name)
+		if class.ReservedTokens < 0 {
+			return fmt.Errorf("priority class %q: reserved_tokens must not be negative", class.Name)
+		}
+		if class.MaxDelay.Duration < 0 {
+			return fmt.Errorf("priority class %q: max_delay must not be negative", class.Name)
+		}
+		for _, userAgent := range class.UserAgents {
+			if userAgents.Has(userAgent) {
+				return fmt.Errorf("priority class %q: user agent %q already belongs to another class", class.Name, userAgent)
+			}
+			userAgents.Insert(userAgent)
+		}
+	}
+	return nil
+}
+
+// watermark is how many tokens are reserved for the classes above the given
+// one.
+func (p *PriorityClasses) watermark(class int) int {
+	var reserved int
+	for _, above := range p.Classes[:class] {
+		reserved += above.ReservedTokens
+	}
+	return reserved
+}
+
+// classify returns the index of the class of the caller, the higher the index
+// the lower the priority. Without classes, everything has the same priority.
+func (p *PriorityClasses) classify(req *http.Request) int {
+	if p == nil {
+		return 0
+	}
+	userAgent := ghmetrics.UserAgentWithoutVersion(req.Header.Get("User-Agent"))
+	component := strings.SplitN(userAgent, ".", 2)[0]
+	for i, class := range p.Classes {
+		for _, candidate := range class.UserAgents {
+			if candidate == userAgent || candidate == component {
+				return i
+			}
+		}
+	}
+	return len(p.Classes) - 1
+}
+
+func (p *PriorityClasses) levels() int {
+	if p == nil {
+		return 1
+	}
+	return len(p.Classes)
+}
+
+// throttledRequestsCounter provides the 'ghcache_throttled_requests' counter
+// that is indexed by priority class and outcome.
+var throttledRequestsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ghcache_throttled_requests",
+		Help: "How many requests were delayed or rejected to keep API tokens for callers with a higher priority.",
+	},
+	[]string{"priority_class", "outcome"},
+)
+
+func init() {
+	prometheus.MustRegister(throttledRequestsCounter)
+}
+
+// budget is the remaining rate limit of a token as last reported by GitHub.
+type budget struct {
+	remaining int
+	limit     string
+	reset     time.Time
+}
+
+// budgetTracker follows the core rate limits of the tokens that use the proxy.
+type budgetTracker struct {
+	lock    sync.Mutex
+	budgets map[string]budget
+}
+
+// rateLimitResource is the GitHub rate limit the request counts against, as
+// REST, search and GraphQL requests are limited separately.
+func rateLimitResource(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	switch {
+	case strings.HasPrefix(path, "graphql"):
+		return "graphql"
+	case strings.HasPrefix(path, "search/"):
+		return "search"
+	default:
+		return "core"
+	}
+}
+
+func (b *budgetTracker) update(key string, headers http.Header) {
+	remaining, err := strconv.Atoi(headers.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(headers.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	latest := budget{remaining: remaining, limit: headers.Get("X-RateLimit-Limit"), reset: time.Unix(reset, 0)}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	current, ok := b.budgets[key]
+	// Responses may arrive out of order: within a rate limit window, the
+	// lowest remaining budget is the most recent one.
+	if ok && current.reset.Equal(latest.reset) && current.remaining < latest.remaining {
+		return
+	}
+	if ok && current.reset.After(latest.reset) {
+		return
+	}
+	b.budgets[key] = latest
+}
+
+func (b *budgetTracker) get(key string) (budget, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	current, ok := b.budgets[key]
+	return current, ok
+}
+
+// priorityTransport throttles callers with a lower priority once the
+// remaining rate limit of their token is reserved for callers with a higher
+// priority.
+type priorityTransport struct {
+	classes  *PriorityClasses
+	budgets  *budgetTracker
+	hasher   ghmetrics.Hasher
+	delegate http.RoundTripper
+	now      func() time.Time
+	sleep    func(context.Context, time.Duration) error
+}
+
+func newPriorityTransport(classes *PriorityClasses, hasher ghmetrics.Hasher, delegate http.RoundTripper) http.RoundTripper {
+	if classes == nil {
+		return delegate
+	}
+	return &priorityTransport{
+		classes:  classes,
+		budgets:  &budgetTracker{budgets: map[string]budget{}},
+		hasher:   hasher,
+		delegate: delegate,
+		now:      time.Now,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d):
+				return nil
+			}
+		},
+	}
+}
+
+func (p *priorityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tokenBudgetName := req.Header.Get(TokenBudgetIdentifierHeader)
+	if tokenBudgetName == "" {
+		tokenBudgetName = p.hasher.Hash(req)
+	}
+	// The watermarks are in tokens of the hourly core budget, which is all
+	// they can be compared to.
+	if rateLimitResource(req) != "core" {
+		return p.delegate.RoundTrip(req)
+	}
+	key := tokenBudgetName
+
+	// Revalidating a cache entry is free unless the resource changed, so
+	// there is no point in holding it back.
+	if req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		class := p.classes.classify(req)
+		if current, throttled := p.throttled(class, key); throttled {
+			name := p.classes.Classes[class].Name
+			log := logrus.WithFields(logrus.Fields{
+				"priority-class": name,
+				"path":           req.URL.Path,
+				"user-agent":     req.Header.Get("User-Agent"),
+				"remaining":      current.remaining,
+			})
+			wait := current.reset.Sub(p.now())
+			if wait > p.classes.Classes[class].MaxDelay.Duration {
+				log.Debug("Rejecting request to keep the remaining API tokens for callers with a higher priority.")
+				throttledRequestsCounter.WithLabelValues(name, "rejected").Inc()
+				return rejectedResponse(req, current), nil
+			}
+			log.WithField("delay", wait.String()).Debug("Delaying request until the API token budget resets.")
+			throttledRequestsCounter.WithLabelValues(name, "delayed").Inc()
+			if err := p.sleep(req.Context(), wait); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp, err := p.delegate.RoundTrip(req)
+	if err == nil {
+		p.budgets.update(key, resp.Header)
+	}
+	return resp, err
+}
+
+// throttled returns whether the class has to wait for the budget to reset.
+func (p *priorityTransport) throttled(class int, key string) (budget, bool) {
+	current, ok := p.budgets.get(key)
+	if !ok || !p.now().Before(current.reset) {
+		return current, false
+	}
+	return current, current.remaining < p.classes.watermark(class)
+}
+
+// rejectedResponse looks like GitHub running out of API tokens, so that
+// clients wait for the reset before retrying.
+func rejectedResponse(req *http.Request, current budget) *http.Response {
+	body := []byte(`{"message":"API rate limit reserved for callers with a higher priority by ghproxy"}`)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(current.reset.Unix(), 10))
+	if current.limit != "" {
+		header.Set("X-RateLimit-Limit", current.limit)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusForbidden, http.StatusText(http.StatusForbidden)),
+		StatusCode:    http.StatusForbidden,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// prioritySemaphore limits concurrency like a semaphore, but hands free slots
+// to waiters with the highest priority first.
+type prioritySemaphore struct {
+	lock     sync.Mutex
+	size     int
+	inFlight int
+	// waiters are queued by priority, the lowest index being the highest
+	// priority.
+	waiters [][]chan struct{}
+}
+
+func newPrioritySemaphore(size, levels int) *prioritySemaphore {
+	return &prioritySemaphore{size: size, waiters: make([][]chan struct{}, levels)}
+}
+
+func (s *prioritySemaphore) acquire(ctx context.Context, priority int) error {
+	s.lock.Lock()
+	if s.inFlight < s.size && s.pending() == 0 {
+		s.inFlight++
+		s.lock.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	s.waiters[priority] = append(s.waiters[priority], ready)
+	s.lock.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.lock.Lock()
+		select {
+		case <-ready:
+			// The slot was handed over while giving up, pass it on.
+			s.lock.Unlock()
+			s.release()
+		default:
+			queue := s.waiters[priority]
+			for i, waiter := range queue {
+				if waiter == ready {
+					s.waiters[priority] = append(queue[:i], queue[i+1:]...)
+					break
+				}
+			}
+			s.lock.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+func (s *prioritySemaphore) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for priority, queue := range s.waiters {
+		if len(queue) > 0 {
+			close(queue[0])
+			s.waiters[priority] = queue[1:]
+			return
+		}
+	}
+	s.inFlight--
+}
+
+func (s *prioritySemaphore) pending() int {
+	var pending int
+	for _, queue := range s.waiters {
+		pending += len(queue)
+	}
+	return pending
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/test-infra/ghproxy/ghmetrics"
+)
+
+func testPriorityClasses() *PriorityClasses {
+	return &PriorityClasses{Classes: []PriorityClass{
+		{Name: "critical", UserAgents: []string{"hook", "tide"}, ReservedTokens: 1000},
+		{Name: "normal", UserAgents: []string{"crier", "peribolos.dry-run"}, ReservedTokens: 500, MaxDelay: metav1.Duration{Duration: time.Minute}},
+		{Name: "batch", UserAgents: []string{"peribolos", "label_sync"}},
+	}}
+}
+
+func TestPriorityClassesValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		classes   []PriorityClass
+		expectErr bool
+	}{
+		{
+			name:    "valid",
+			classes: testPriorityClasses().Classes,
+		},
+		{
+			name:      "no classes",
+			expectErr: true,
+		},
+		{
+			name:      "duplicate name",
+			classes:   []PriorityClass{{Name: "a"}, {Name: "a"}},
+			expectErr: true,
+		},
+		{
+			name:      "user agent in two classes",
+			classes:   []PriorityClass{{Name: "a", UserAgents: []string{"hook"}}, {Name: "b", UserAgents: []string{"hook"}}},
+			expectErr: true,
+		},
+		{
+			name:      "negative reservation",
+			classes:   []PriorityClass{{Name: "a", ReservedTokens: -1}},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := (&PriorityClasses{Classes: tc.classes}).Validate()
+			if (err != nil) != tc.expectErr {
+				t.Errorf("expected error %t, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	classes := testPriorityClasses()
+	testCases := []struct {
+		userAgent string
+		expected  int
+	}{
+		{userAgent: "hook/v20210101-abcdef", expected: 0},
+		{userAgent: "hook.lgtm/v20210101-abcdef", expected: 0},
+		{userAgent: "crier/v20210101-abcdef", expected: 1},
+		{userAgent: "peribolos.dry-run/v20210101-abcdef", expected: 1},
+		{userAgent: "peribolos/v20210101-abcdef", expected: 2},
+		{userAgent: "curl/7.64.1", expected: 2},
+		{userAgent: "", expected: 2},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest(http.MethodGet, "http://api.github.com/repos/org/repo", nil)
+		req.Header.Set("User-Agent", tc.userAgent)
+		if actual := classes.classify(req); actual != tc.expected {
+			t.Errorf("%q: expected class %d, got %d", tc.userAgent, tc.expected, actual)
+		}
+	}
+	if actual := (*PriorityClasses)(nil).classify(&http.Request{Header: http.Header{}}); actual != 0 {
+		t.Errorf("expected everything to have the same priority without classes, got %d", actual)
+	}
+}
+
+// budgetDelegate responds with the configured rate limit headers.
+type budgetDelegate struct {
+	remaining int
+	reset     time.Time
+	hits      int
+}
+
+func (b *budgetDelegate) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.hits++
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "5000")
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(b.remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(b.reset.Unix(), 10))
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewBufferString("{}"))}, nil
+}
+
+func TestPriorityTransport(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	delegate := &budgetDelegate{remaining: 4000, reset: now.Add(time.Hour)}
+	transport := newPriorityTransport(testPriorityClasses(), ghmetrics.NewCachingHasher(), delegate).(*priorityTransport)
+	transport.now = func() time.Time { return now }
+	var slept time.Duration
+	transport.sleep = func(_ context.Context, d time.Duration) error {
+		slept += d
+		now = now.Add(d)
+		return nil
+	}
+
+	send := func(userAgent, path string, conditional bool) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "http://api.github.com"+path, nil)
+		req.Header.Set("User-Agent", userAgent+"/v20210101-abcdef")
+		req.Header.Set("Authorization", "Bearer token")
+		if conditional {
+			req.Header.Set("If-None-Match", `"etag"`)
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	// Plenty of tokens left: everyone goes.
+	if code := send("label_sync", "/repos/org/repo/labels", false); code != http.StatusOK {
+		t.Errorf("expected the first request to go through, got %d", code)
+	}
+	// Into the tokens reserved for the normal and critical classes.
+	delegate.remaining = 1200
+	send("hook", "/repos/org/repo/issues", false)
+	hits := delegate.hits
+	if code := send("label_sync", "/repos/org/repo/labels", false); code != http.StatusForbidden {
+		t.Errorf("expected batch callers to be rejected, got %d", code)
+	}
+	if delegate.hits != hits {
+		t.Error("expected the rejected request not to reach GitHub")
+	}
+	if code := send("label_sync", "/repos/org/repo/labels", true); code != http.StatusOK {
+		t.Errorf("expected revalidations to go through, got %d", code)
+	}
+	for i := 0; i < 2; i++ {
+		if code := send("label_sync", "/graphql", false); code != http.StatusOK {
+			t.Errorf("expected GraphQL not to be throttled, got %d", code)
+		}
+		if code := send("label_sync", "/search/issues", false); code != http.StatusOK {
+			t.Errorf("expected search not to be throttled, got %d", code)
+		}
+	}
+	if code := send("crier", "/repos/org/repo/statuses/abc", false); code != http.StatusOK {
+		t.Errorf("expected normal callers to go through, got %d", code)
+	}
+	if slept != 0 {
+		t.Errorf("expected no delay, slept %s", slept)
+	}
+
+	// Into the tokens reserved for the critical class, with a reset close
+	// enough to wait for.
+	now = delegate.reset.Add(-30 * time.Second)
+	delegate.remaining = 900
+	send("tide", "/repos/org/repo/pulls", false)
+	delegate.remaining, delegate.reset = 5000, delegate.reset.Add(time.Hour)
+	if code := send("crier", "/repos/org/repo/statuses/abc", false); code != http.StatusOK {
+		t.Errorf("expected normal callers to be delayed until the reset, got %d", code)
+	}
+	if slept != 30*time.Second {
+		t.Errorf("expected to wait 30s for the reset, slept %s", slept)
+	}
+	if code := send("label_sync", "/repos/org/repo/labels", false); code != http.StatusOK {
+		t.Errorf("expected batch callers to go through after the reset, got %d", code)
+	}
+}
+
+func TestRejectedResponse(t *testing.T) {
+	reset := time.Unix(1600003600, 0)
+	req, _ := http.NewRequest(http.MethodGet, "http://api.github.com/repos/org/repo", nil)
+	resp := rejectedResponse(req, budget{remaining: 42, limit: "5000", reset: reset})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+	for header, expected := range map[string]string{
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "1600003600",
+		"X-RateLimit-Limit":     "5000",
+		"Cache-Control":         "no-store",
+	} {
+		if actual := resp.Header.Get(header); actual != expected {
+			t.Errorf("expected %s to be %q, got %q", header, expected, actual)
+		}
+	}
+}
+
+func TestBudgetTrackerUpdate(t *testing.T) {
+	headers := func(remaining int, reset int64) http.Header {
+		h := http.Header{}
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		return h
+	}
+	tracker := &budgetTracker{budgets: map[string]budget{}}
+	tracker.update("key", headers(100, 1000))
+	// An older response arriving late doesn't raise the budget.
+	tracker.update("key", headers(150, 1000))
+	tracker.update("key", headers(10, 500))
+	if current, _ := tracker.get("key"); current.remaining != 100 {
+		t.Errorf("expected 100 remaining, got %d", current.remaining)
+	}
+	// A new window starts over.
+	tracker.update("key", headers(4999, 4600))
+	if current, _ := tracker.get("key"); current.remaining != 4999 {
+		t.Errorf("expected 4999 remaining, got %d", current.remaining)
+	}
+	tracker.update("key", http.Header{})
+	if _, ok := tracker.get("other"); ok {
+		t.Error("expected no budget for an unknown key")
+	}
+}
+
+func TestPrioritySemaphore(t *testing.T) {
+	sem := newPrioritySemaphore(1, 3)
+	if err := sem.acquire(context.Background(), 2); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	order := make(chan int, 3)
+	var wg sync.WaitGroup
+	enqueue := func(priority int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sem.acquire(context.Background(), priority); err != nil {
+				t.Errorf("failed to acquire: %v", err)
+				return
+			}
+			order <- priority
+			sem.release()
+		}()
+		// Wait for the waiter to be queued.
+		for {
+			sem.lock.Lock()
+			queued := len(sem.waiters[priority]) > 0
+			sem.lock.Unlock()
+			if queued {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	enqueue(2)
+	enqueue(1)
+	enqueue(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sem.acquire(ctx, 0); err == nil {
+		t.Error("expected a cancelled acquisition to fail")
+	}
+
+	sem.release()
+	for _, expected := range []int{0, 1, 2} {
+		if actual := <-order; actual != expected {
+			t.Errorf("expected priority %d to go next, got %d", expected, actual)
+		}
+	}
+	wg.Wait()
+	if sem.inFlight != 0 {
+		t.Errorf("expected all slots to be released, %d are in flight", sem.inFlight)
+	}
+}
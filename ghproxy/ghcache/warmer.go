@@ -0,0 +1,386 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gregjones/httpcache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// warmupUserAgent identifies the requests of the cache warmer in metrics and
+// priority classes.
+const warmupUserAgent = "ghproxy-warmer"
+
+// warmupRequestsCounter provides the 'ghcache_warmup_requests' counter that
+// is indexed by the reason of the request and the cache response mode.
+var warmupRequestsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ghcache_warmup_requests",
+		Help: "How many requests the cache warmer made, by reason and cache response mode.",
+	},
+	[]string{"reason", "mode"},
+)
+
+func init() {
+	prometheus.MustRegister(warmupRequestsCounter)
+}
+
+// accessLogEntry counts the requests for a response.
+type accessLogEntry struct {
+	URL string `json:"url"`
+	// Accept is part of the entry as responses vary by media type.
+	Accept string `json:"accept,omitempty"`
+	Count  int    `json:"count"`
+}
+
+type accessLogKey struct {
+	url, accept string
+}
+
+// warmPartition is a cache partition the warmer can replay requests with.
+type warmPartition struct {
+	expiresAt *time.Time
+	cache     httpcache.Cache
+	transport http.RoundTripper
+
+	// budget, header and lastUsed come from the most recent request, as the
+	// warmer needs the credentials of the caller to replay requests.
+	budget   string
+	header   http.Header
+	lastUsed time.Time
+	warmedUp bool
+}
+
+// CacheWarmer keeps the responses requested most often warm. It records the
+// requests of each token budget in an access log that survives restarts, and
+//   - replays the most frequent requests when the cache partition of a token
+//     is created, e.g. after a restart or when a GitHub App installation token
+//     is rotated;
+//   - periodically revalidates the most frequent cached responses, which is
+//     free unless they changed.
+type CacheWarmer struct {
+	path     string
+	requests int
+	interval time.Duration
+	now      func() time.Time
+
+	lock       sync.Mutex
+	ctx        context.Context
+	counts     map[string]map[accessLogKey]int
+	partitions map[string]*warmPartition
+	decayedAt  time.Time
+}
+
+// NewCacheWarmer creates a CacheWarmer that persists its access log at path
+// and keeps the given number of requests per token budget warm, revalidating
+// them at the given interval.
+func NewCacheWarmer(path string, requests int, interval time.Duration) (*CacheWarmer, error) {
+	c := &CacheWarmer{
+		path:       path,
+		requests:   requests,
+		interval:   interval,
+		now:        time.Now,
+		ctx:        context.Background(),
+		counts:     map[string]map[accessLogKey]int{},
+		partitions: map[string]*warmPartition{},
+	}
+	c.decayedAt = c.now()
+	raw, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access log: %w", err)
+	}
+	var entries map[string][]accessLogEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse access log %s: %w", path, err)
+	}
+	for budget, budgetEntries := range entries {
+		c.counts[budget] = map[accessLogKey]int{}
+		for _, entry := range budgetEntries {
+			c.counts[budget][accessLogKey{url: entry.URL, accept: entry.Accept}] = entry.Count
+		}
+	}
+	return c, nil
+}
+
+// Run periodically revalidates the most frequent responses and persists the
+// access log until ctx is done.
+func (c *CacheWarmer) Run(ctx context.Context) {
+	c.lock.Lock()
+	c.ctx = ctx
+	c.lock.Unlock()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.persist(); err != nil {
+				logrus.WithError(err).Error("Failed to persist the access log.")
+			}
+			return
+		case <-ticker.C:
+			c.revalidate(ctx)
+			if err := c.persist(); err != nil {
+				logrus.WithError(err).Error("Failed to persist the access log.")
+			}
+		}
+	}
+}
+
+// wrap records the requests of a cache partition, or returns the transport
+// as is if there is no warmer.
+func (c *CacheWarmer) wrap(partitionKey string, expiresAt *time.Time, cache httpcache.Cache, transport http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return transport
+	}
+	partition := &warmPartition{expiresAt: expiresAt, cache: cache, transport: transport, budget: partitionKey}
+	c.lock.Lock()
+	c.partitions[partitionKey] = partition
+	c.lock.Unlock()
+	return &warmingTransport{warmer: c, partition: partition}
+}
+
+type warmupContextKey struct{}
+
+// warmingTransport records the requests of a cache partition.
+type warmingTransport struct {
+	warmer    *CacheWarmer
+	partition *warmPartition
+}
+
+func (w *warmingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Value(warmupContextKey{}) != nil {
+		return w.partition.transport.RoundTrip(req)
+	}
+	budget := req.Header.Get(TokenBudgetIdentifierHeader)
+	if budget == "" {
+		budget = getCachePartition(req)
+	}
+	w.warmer.observe(w.partition, budget, req.Header)
+
+	resp, err := w.partition.transport.RoundTrip(req)
+	if err == nil && req.Method == http.MethodGet && resp.StatusCode == http.StatusOK && resp.Header.Get(CacheModeHeader) != string(ModeNoStore) {
+		w.warmer.record(budget, accessLogKey{url: req.URL.String(), accept: req.Header.Get("Accept")})
+	}
+	return resp, err
+}
+
+// observe remembers how to replay requests for the partition and warms it up
+// on its first request.
+func (c *CacheWarmer) observe(partition *warmPartition, budget string, header http.Header) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	partition.budget = budget
+	partition.header = header.Clone()
+	partition.lastUsed = c.now()
+	if partition.warmedUp {
+		return
+	}
+	partition.warmedUp = true
+	entries := c.top(budget, c.requests)
+	if len(entries) == 0 {
+		return
+	}
+	ctx, header := c.ctx, partition.header.Clone()
+	go func() {
+		logrus.WithField("token-budget", budget).WithField("requests", len(entries)).Info("Warming up cache partition.")
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			c.replay(ctx, partition, header, entry, "warmup")
+		}
+	}()
+}
+
+func (c *CacheWarmer) record(budget string, key accessLogKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.counts[budget] == nil {
+		c.counts[budget] = map[accessLogKey]int{}
+	}
+	c.counts[budget][key]++
+}
+
+// accessLogHeadroom is how many more requests than it keeps warm the warmer
+// counts, so that new requests have a chance to become frequent.
+const accessLogHeadroom = 10
+
+// top returns the most frequent requests of the budget. The caller must hold
+// the lock.
+func (c *CacheWarmer) top(budget string, limit int) []accessLogEntry {
+	entries := make([]accessLogEntry, 0, len(c.counts[budget]))
+	for key, count := range c.counts[budget] {
+		entries = append(entries, accessLogEntry{URL: key.url, Accept: key.accept, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		if entries[i].URL != entries[j].URL {
+			return entries[i].URL < entries[j].URL
+		}
+		return entries[i].Accept < entries[j].Accept
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// revalidate sends a conditional request for the most frequent cached
+// responses of each budget, using the partition of its most recent token.
+func (c *CacheWarmer) revalidate(ctx context.Context) {
+	type pass struct {
+		partition *warmPartition
+		header    http.Header
+		entries   []accessLogEntry
+	}
+	c.lock.Lock()
+	now := c.now()
+	latest := map[string]*warmPartition{}
+	for key, partition := range c.partitions {
+		if partition.expiresAt != nil && !partition.expiresAt.After(now) {
+			delete(c.partitions, key)
+			continue
+		}
+		if partition.header == nil {
+			continue
+		}
+		if current, ok := latest[partition.budget]; !ok || partition.lastUsed.After(current.lastUsed) {
+			latest[partition.budget] = partition
+		}
+	}
+	var passes []pass
+	for budget, partition := range latest {
+		passes = append(passes, pass{partition: partition, header: partition.header.Clone(), entries: c.top(budget, c.requests)})
+	}
+	c.lock.Unlock()
+
+	for _, p := range passes {
+		for _, entry := range p.entries {
+			if ctx.Err() != nil {
+				return
+			}
+			// Only cached responses can be revalidated for free.
+			if _, cached := p.partition.cache.Get(entry.URL); !cached {
+				continue
+			}
+			c.replay(ctx, p.partition, p.header, entry, "revalidate")
+		}
+	}
+}
+
+func (c *CacheWarmer) replay(ctx context.Context, partition *warmPartition, header http.Header, entry accessLogEntry, reason string) {
+	log := logrus.WithFields(logrus.Fields{"url": entry.URL, "reason": reason})
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, warmupContextKey{}, true), http.MethodGet, entry.URL, nil)
+	if err != nil {
+		log.WithError(err).Warn("Failed to create request to warm the cache with.")
+		return
+	}
+	req.Header = header.Clone()
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	req.Header.Set("User-Agent", warmupUserAgent)
+	if entry.Accept != "" {
+		req.Header.Set("Accept", entry.Accept)
+	} else {
+		req.Header.Del("Accept")
+	}
+	resp, err := partition.transport.RoundTrip(req)
+	if err != nil {
+		warmupRequestsCounter.WithLabelValues(reason, string(ModeError)).Inc()
+		log.WithError(err).Debug("Failed to warm the cache.")
+		return
+	}
+	// The response is only cached once its body is read.
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		log.WithError(err).Debug("Failed to read response to warm the cache with.")
+	}
+	resp.Body.Close()
+	warmupRequestsCounter.WithLabelValues(reason, resp.Header.Get(CacheModeHeader)).Inc()
+}
+
+// persist writes the most frequent requests of each budget to the access log,
+// forgetting about the others. Counts are halved daily, so that requests that
+// aren't made anymore fall out of the log.
+func (c *CacheWarmer) persist() error {
+	c.lock.Lock()
+	if now := c.now(); now.Sub(c.decayedAt) >= 24*time.Hour {
+		c.decayedAt = now
+		for budget, counts := range c.counts {
+			for key, count := range counts {
+				if count/2 == 0 {
+					delete(counts, key)
+				} else {
+					counts[key] = count / 2
+				}
+			}
+			if len(counts) == 0 {
+				delete(c.counts, budget)
+			}
+		}
+	}
+	entries := map[string][]accessLogEntry{}
+	for budget := range c.counts {
+		entries[budget] = c.top(budget, accessLogHeadroom*c.requests)
+		counts := map[accessLogKey]int{}
+		for _, entry := range entries[budget] {
+			counts[accessLogKey{url: entry.URL, accept: entry.Accept}] = entry.Count
+		}
+		c.counts[budget] = counts
+	}
+	c.lock.Unlock()
+
+	raw, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to serialize access log: %w", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to replace access log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type upstreamRequest struct {
+	path, userAgent string
+	conditional     bool
+}
+
+// etagUpstream serves a fixed body per path and honors If-None-Match.
+type etagUpstream struct {
+	lock     sync.Mutex
+	requests []upstreamRequest
+}
+
+func (e *etagUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	e.lock.Lock()
+	e.requests = append(e.requests, upstreamRequest{path: req.URL.Path, userAgent: req.Header.Get("User-Agent"), conditional: req.Header.Get("If-None-Match") != ""})
+	e.lock.Unlock()
+	etag := `"` + req.URL.Path + `"`
+	header := http.Header{}
+	header.Set("ETag", etag)
+	header.Set("Vary", "Accept, Authorization")
+	if req.Header.Get("If-None-Match") == etag {
+		return &http.Response{StatusCode: http.StatusNotModified, Header: header, Body: ioutil.NopCloser(&bytes.Buffer{}), Request: req}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewBufferString(req.URL.Path)), Request: req}, nil
+}
+
+func (e *etagUpstream) seen() []upstreamRequest {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	seen := e.requests
+	e.requests = nil
+	return seen
+}
+
+func get(t *testing.T, transport http.RoundTripper, path string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com"+path, nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "tide/v20210101-abcdef")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request for %s failed: %v", path, err)
+	}
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		t.Fatalf("failed to read response for %s: %v", path, err)
+	}
+	resp.Body.Close()
+}
+
+func TestCacheWarmer(t *testing.T) {
+	accessLog := filepath.Join(t.TempDir(), "access-log.json")
+	warmer, err := NewCacheWarmer(accessLog, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create warmer: %v", err)
+	}
+	upstream := &etagUpstream{}
+	cache := NewMemCache(upstream, 25, nil, warmer, 0)
+
+	for _, path := range []string{"/repos/org/repo/pulls", "/repos/org/repo/pulls", "/repos/org/repo/pulls", "/repos/org/repo/labels", "/repos/org/repo/labels", "/repos/org/repo/branches"} {
+		get(t, cache, path)
+	}
+	upstream.seen()
+
+	// Only the most frequent responses are revalidated, and for free.
+	warmer.revalidate(context.Background())
+	expected := []upstreamRequest{
+		{path: "/repos/org/repo/pulls", userAgent: warmupUserAgent, conditional: true},
+		{path: "/repos/org/repo/labels", userAgent: warmupUserAgent, conditional: true},
+	}
+	if actual := upstream.seen(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected revalidations %+v, got %+v", expected, actual)
+	}
+
+	// After a restart, the first request of the token warms the cache up.
+	if err := warmer.persist(); err != nil {
+		t.Fatalf("failed to persist access log: %v", err)
+	}
+	restarted, err := NewCacheWarmer(accessLog, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to load access log: %v", err)
+	}
+	cache = NewMemCache(upstream, 25, nil, restarted, 0)
+	get(t, cache, "/repos/org/repo/issues")
+	var warmedUp []upstreamRequest
+	for start := time.Now(); len(warmedUp) < 2 && time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		for _, request := range upstream.seen() {
+			if request.userAgent == warmupUserAgent {
+				warmedUp = append(warmedUp, request)
+			}
+		}
+	}
+	expected = []upstreamRequest{
+		{path: "/repos/org/repo/pulls", userAgent: warmupUserAgent},
+		{path: "/repos/org/repo/labels", userAgent: warmupUserAgent},
+	}
+	if !reflect.DeepEqual(expected, warmedUp) {
+		t.Errorf("expected warm-up requests %+v, got %+v", expected, warmedUp)
+	}
+
+	// Replayed requests don't count as requests.
+	restarted.lock.Lock()
+	defer restarted.lock.Unlock()
+	for key, count := range restarted.counts[getCachePartition(&http.Request{Header: http.Header{"Authorization": []string{"Bearer token"}}})] {
+		if key.url == "https://api.github.com/repos/org/repo/pulls" && count != 3 {
+			t.Errorf("expected pulls to still have been requested three times, got %d", count)
+		}
+	}
+}
+
+func TestCacheWarmerPersistDecays(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	warmer, err := NewCacheWarmer(filepath.Join(t.TempDir(), "access-log.json"), 1, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create warmer: %v", err)
+	}
+	warmer.now = func() time.Time { return now }
+	warmer.decayedAt = now
+	for i := 0; i < 4; i++ {
+		warmer.record("budget", accessLogKey{url: "hot"})
+	}
+	warmer.record("budget", accessLogKey{url: "cold"})
+	warmer.record("other", accessLogKey{url: "cold"})
+
+	if err := warmer.persist(); err != nil {
+		t.Fatalf("failed to persist: %v", err)
+	}
+	if expected := map[accessLogKey]int{{url: "hot"}: 4, {url: "cold"}: 1}; !reflect.DeepEqual(expected, warmer.counts["budget"]) {
+		t.Errorf("expected counts %v before a day passed, got %v", expected, warmer.counts["budget"])
+	}
+
+	now = now.Add(25 * time.Hour)
+	if err := warmer.persist(); err != nil {
+		t.Fatalf("failed to persist: %v", err)
+	}
+	expected := map[string]map[accessLogKey]int{"budget": {{url: "hot"}: 2}}
+	if !reflect.DeepEqual(expected, warmer.counts) {
+		t.Errorf("expected counts %v after a day, got %v", expected, warmer.counts)
+	}
+}
@@ -140,7 +140,7 @@ func CollectGitHubTokenMetrics(tokenHash, apiVersion string, headers http.Header
 // CollectGitHubRequestMetrics publishes the number of requests by API path to
 // `github_requests` on prometheus.
 func CollectGitHubRequestMetrics(tokenHash, path, statusCode, userAgent string, roundTripTime float64) {
-	ghRequestDurationHistVec.With(prometheus.Labels{"token_hash": tokenHash, "path": simplifier.Simplify(path), "status": statusCode, "user_agent": userAgentWithoutVersion(userAgent)}).Observe(roundTripTime)
+	ghRequestDurationHistVec.With(prometheus.Labels{"token_hash": tokenHash, "path": simplifier.Simplify(path), "status": statusCode, "user_agent": UserAgentWithoutVersion(userAgent)}).Observe(roundTripTime)
 }
 
 // timestampStringToTime takes a unix timestamp and returns a `time.Time`
@@ -153,8 +153,8 @@ func timestampStringToTime(tstamp string) time.Time {
 	return time.Unix(timestamp, 0)
 }
 
-// userAgentWithouVersion formats a user agent without the version to reduce label cardinality
-func userAgentWithoutVersion(userAgent string) string {
+// UserAgentWithoutVersion formats a user agent without the version to reduce label cardinality
+func UserAgentWithoutVersion(userAgent string) string {
 	if !strings.Contains(userAgent, "/") {
 		return userAgent
 	}
@@ -163,15 +163,15 @@ func userAgentWithoutVersion(userAgent string) string {
 
 // CollectCacheRequestMetrics records a cache outcome for a specific path
 func CollectCacheRequestMetrics(mode, path, userAgent, tokenHash string) {
-	cacheCounter.With(prometheus.Labels{"mode": mode, "path": simplifier.Simplify(path), "user_agent": userAgentWithoutVersion(userAgent), "token_hash": tokenHash}).Inc()
+	cacheCounter.With(prometheus.Labels{"mode": mode, "path": simplifier.Simplify(path), "user_agent": UserAgentWithoutVersion(userAgent), "token_hash": tokenHash}).Inc()
 }
 
 func CollectCacheEntryAgeMetrics(age float64, path, userAgent, tokenHash string) {
-	cacheEntryAge.With(prometheus.Labels{"path": simplifier.Simplify(path), "user_agent": userAgentWithoutVersion(userAgent), "token_hash": tokenHash}).Observe(age)
+	cacheEntryAge.With(prometheus.Labels{"path": simplifier.Simplify(path), "user_agent": UserAgentWithoutVersion(userAgent), "token_hash": tokenHash}).Observe(age)
 }
 
 // CollectRequestTimeoutMetrics publishes the duration of timed-out requests by
 // API path to 'github_request_timeouts' on prometheus.
 func CollectRequestTimeoutMetrics(tokenHash, path, userAgent string, reqStartTime, responseTime time.Time) {
-	timeoutDuration.With(prometheus.Labels{"token_hash": tokenHash, "path": simplifier.Simplify(path), "user_agent": userAgentWithoutVersion(userAgent)}).Observe(float64(responseTime.Sub(reqStartTime).Seconds()))
+	timeoutDuration.With(prometheus.Labels{"token_hash": tokenHash, "path": simplifier.Simplify(path), "user_agent": UserAgentWithoutVersion(userAgent)}).Observe(float64(responseTime.Sub(reqStartTime).Seconds()))
 }
@@ -558,7 +558,7 @@ func TestUserAgentWithoutVersion(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			if actual, expected := userAgentWithoutVersion(test.in), test.out; actual != expected {
+			if actual, expected := UserAgentWithoutVersion(test.in), test.out; actual != expected {
 				t.Errorf("%s: expected %s, got %s", test.name, expected, actual)
 			}
 		})
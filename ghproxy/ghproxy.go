@@ -20,6 +20,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -30,6 +31,7 @@ import (
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/test-infra/prow/pjutil/pprof"
+	"sigs.k8s.io/yaml"
 
 	"k8s.io/test-infra/ghproxy/apptokenequalizer"
 	"k8s.io/test-infra/ghproxy/ghcache"
@@ -101,6 +103,15 @@ type options struct {
 
 	maxConcurrency int
 
+	priorityClassesPath string
+	priorityClasses     *ghcache.PriorityClasses
+
+	accessLogPath      string
+	warmupRequests     int
+	revalidateInterval time.Duration
+
+	graphqlCacheTTL time.Duration
+
 	// pushGateway fields are used to configure pushing prometheus metrics.
 	pushGateway         string
 	pushGatewayInterval time.Duration
@@ -127,6 +138,27 @@ func (o *options) validate() error {
 		return fmt.Errorf("failed to parse upstream URL: %w", err)
 	}
 	o.upstreamParsed = upstreamURL
+
+	if o.accessLogPath != "" && (o.warmupRequests <= 0 || o.revalidateInterval <= 0) {
+		return errors.New("--warmup-requests and --revalidate-interval must be positive to warm the cache")
+	}
+	if o.graphqlCacheTTL < 0 {
+		return errors.New("--graphql-cache-ttl must not be negative")
+	}
+
+	if o.priorityClassesPath != "" {
+		raw, err := ioutil.ReadFile(o.priorityClassesPath)
+		if err != nil {
+			return fmt.Errorf("failed to read priority classes: %w", err)
+		}
+		o.priorityClasses = &ghcache.PriorityClasses{}
+		if err := yaml.UnmarshalStrict(raw, o.priorityClasses); err != nil {
+			return fmt.Errorf("failed to parse priority classes: %w", err)
+		}
+		if err := o.priorityClasses.Validate(); err != nil {
+			return fmt.Errorf("invalid priority classes: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -139,6 +171,11 @@ func flagOptions() *options {
 	flag.IntVar(&o.port, "port", 8888, "Port to listen on.")
 	flag.StringVar(&o.upstream, "upstream", "https://api.github.com", "Scheme, host, and base path of reverse proxy upstream.")
 	flag.IntVar(&o.maxConcurrency, "concurrency", 25, "Maximum number of concurrent in-flight requests to GitHub.")
+	flag.StringVar(&o.priorityClassesPath, "priority-classes", "", "Path to a YAML file with the priority classes of callers. If specified, callers with a higher priority are sent first and API tokens are reserved for them.")
+	flag.StringVar(&o.accessLogPath, "access-log-path", "", "If specified, the most frequent requests are recorded at this path and the cache is kept warm with them, also across restarts.")
+	flag.IntVar(&o.warmupRequests, "warmup-requests", 500, "How many of the most frequent requests of each token are replayed when its cache is created and revalidated periodically.")
+	flag.DurationVar(&o.revalidateInterval, "revalidate-interval", 5*time.Minute, "Interval at which the most frequent cached responses are revalidated, which is free unless they changed.")
+	flag.DurationVar(&o.graphqlCacheTTL, "graphql-cache-ttl", 0, "If positive, identical GraphQL queries are answered from a cache for this long and coalesced while in flight. Callers can opt out with a 'Cache-Control: no-cache' header.")
 	flag.StringVar(&o.pushGateway, "push-gateway", "", "If specified, push prometheus metrics to this endpoint.")
 	flag.DurationVar(&o.pushGatewayInterval, "push-gateway-interval", time.Minute, "Interval at which prometheus metrics are pushed.")
 	flag.StringVar(&o.logLevel, "log-level", "debug", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
@@ -170,7 +207,16 @@ func main() {
 		ServeMetrics: o.serveMetrics,
 	}, o.instrumentationOptions.MetricsPort)
 
-	proxy := proxy(o, http.DefaultTransport, time.Hour)
+	var warmer *ghcache.CacheWarmer
+	if o.accessLogPath != "" {
+		var err error
+		if warmer, err = ghcache.NewCacheWarmer(o.accessLogPath, o.warmupRequests, o.revalidateInterval); err != nil {
+			logrus.WithError(err).Fatal("Failed to create cache warmer.")
+		}
+		interrupts.Run(warmer.Run)
+	}
+
+	proxy := proxy(o, http.DefaultTransport, time.Hour, warmer)
 	server := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: proxy}
 
 	health := pjutil.NewHealthOnPort(o.instrumentationOptions.HealthPort)
@@ -179,14 +225,14 @@ func main() {
 	interrupts.ListenAndServe(server, 30*time.Second)
 }
 
-func proxy(o *options, upstreamTransport http.RoundTripper, diskCachePruneInterval time.Duration) http.Handler {
+func proxy(o *options, upstreamTransport http.RoundTripper, diskCachePruneInterval time.Duration, warmer *ghcache.CacheWarmer) http.Handler {
 	var cache http.RoundTripper
 	if o.redisAddress != "" {
-		cache = ghcache.NewRedisCache(apptokenequalizer.New(upstreamTransport), o.redisAddress, o.maxConcurrency)
+		cache = ghcache.NewRedisCache(apptokenequalizer.New(upstreamTransport), o.redisAddress, o.maxConcurrency, o.priorityClasses, warmer, o.graphqlCacheTTL)
 	} else if o.dir == "" {
-		cache = ghcache.NewMemCache(apptokenequalizer.New(upstreamTransport), o.maxConcurrency)
+		cache = ghcache.NewMemCache(apptokenequalizer.New(upstreamTransport), o.maxConcurrency, o.priorityClasses, warmer, o.graphqlCacheTTL)
 	} else {
-		cache = ghcache.NewDiskCache(apptokenequalizer.New(upstreamTransport), o.dir, o.sizeGB, o.maxConcurrency, o.diskCacheDisableAuthHeaderPartitioning, diskCachePruneInterval)
+		cache = ghcache.NewDiskCache(apptokenequalizer.New(upstreamTransport), o.dir, o.sizeGB, o.maxConcurrency, o.diskCacheDisableAuthHeaderPartitioning, diskCachePruneInterval, o.priorityClasses, warmer, o.graphqlCacheTTL)
 		go diskMonitor(o.pushGatewayInterval, o.dir)
 	}
 
@@ -74,7 +74,7 @@ func TestDiskCachePruning(t *testing.T) {
 		t.Fatalf("Failed to generate RSA key: %v", err)
 	}
 
-	server := httptest.NewServer(proxy(o, httpRoundTripper(roundTripper), time.Hour))
+	server := httptest.NewServer(proxy(o, httpRoundTripper(roundTripper), time.Hour, nil))
 	t.Cleanup(server.Close)
 	_, _, client := github.NewClientFromOptions(logrus.Fields{}, github.ClientOptions{
 		MaxRetries:      1,
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
@@ -144,7 +145,7 @@ func gatherOptions() options {
 	fs.StringVar(&o.orgs, "orgs", "", "Comma separated list of orgs to sync")
 	fs.StringVar(&o.skipRepos, "skip", "", "Comma separated list of org/repos to skip syncing")
 	fs.StringVar(&o.token, "token", "", "Path to github oauth secret")
-	fs.StringVar(&o.action, "action", "sync", "One of: sync, docs")
+	fs.StringVar(&o.action, "action", "sync", "One of: sync, migrate, drift, docs, css")
 	fs.StringVar(&o.cssTemplate, "css-template", "", "Path to template file for label css")
 	fs.StringVar(&o.cssOutput, "css-output", "", "Path to output file for css")
 	fs.StringVar(&o.docsTemplate, "docs-template", "", "Path to template file for label docs")
@@ -630,24 +631,10 @@ func (ru RepoUpdates) DoUpdates(org string, gc client) error {
 						errChan <- err
 					}
 				case "migrate":
-					issues, err := gc.FindIssues(fmt.Sprintf("is:open repo:%s/%s label:\"%s\" -label:\"%s\"", org, repo, update.Current.Name, update.Wanted.Name), "", false)
-					if err != nil {
+					query := fmt.Sprintf("is:open repo:%s/%s label:\"%s\" -label:\"%s\"", org, repo, update.Current.Name, update.Wanted.Name)
+					for _, err := range migrateIssues(gc, org, repo, query, update.Current.Name, update.Wanted.Name) {
 						errChan <- err
 					}
-					if len(issues) == 0 {
-						if err = gc.DeleteRepoLabel(org, repo, update.Current.Name); err != nil {
-							errChan <- err
-						}
-					}
-					for _, i := range issues {
-						if err = gc.AddLabel(org, repo, i.Number, update.Wanted.Name); err != nil {
-							errChan <- err
-							continue
-						}
-						if err = gc.RemoveLabel(org, repo, i.Number, update.Current.Name); err != nil {
-							errChan <- err
-						}
-					}
 				default:
 					errChan <- errors.New("unknown label operation: " + update.Why)
 				}
@@ -741,51 +728,42 @@ func main() {
 		if err := writeCSS(o.cssTemplate, o.cssOutput, *config); err != nil {
 			logrus.WithError(err).Fatalf("failed to write css file using css-template %s to css-output %s", o.cssTemplate, o.cssOutput)
 		}
-	case o.action == "sync":
-		githubClient, err := newClient(o.token, o.tokens, o.tokenBurst, !o.confirm, o.graphqlEndpoint, o.endpoint.Strings()...)
+	case o.action == "sync" || o.action == "migrate" || o.action == "drift":
+		// The drift report never mutates the labels.
+		githubClient, err := newClient(o.token, o.tokens, o.tokenBurst, !o.confirm || o.action == "drift", o.graphqlEndpoint, o.endpoint.Strings()...)
 		if err != nil {
 			logrus.WithError(err).Fatal("failed to create client")
 		}
 
-		// there are three ways to configure which repos to sync:
-		//  - a list of org/repo values
-		//  - a list of orgs for which we sync all repos
-		//  - a list of orgs to sync with a list of org/repo values to skip
-		if o.onlyRepos != "" {
-			reposToSync, parseError := parseCommaDelimitedList(o.onlyRepos)
-			if parseError != nil {
-				logrus.WithError(err).Fatal("invalid value for --only")
-			}
-			for org := range reposToSync {
-				if err = syncOrg(org, githubClient, *config, reposToSync[org], o.confirm); err != nil {
-					logrus.WithError(err).Fatalf("failed to update %s", org)
-				}
-			}
-			return
+		repos, err := reposToSync(o, githubClient)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to determine the repos to sync")
 		}
 
-		skippedRepos := map[string][]string{}
-		if o.skipRepos != "" {
-			reposToSkip, parseError := parseCommaDelimitedList(o.skipRepos)
-			if parseError != nil {
-				logrus.WithError(err).Fatal("invalid value for --skip")
+		var drifts []Drift
+		for org, orgRepos := range repos {
+			switch o.action {
+			case "sync":
+				err = syncOrg(org, githubClient, *config, orgRepos, o.confirm)
+			case "migrate":
+				err = migrateOrg(org, githubClient, *config, orgRepos, o.confirm)
+			case "drift":
+				var orgDrifts []Drift
+				orgDrifts, err = driftOrg(org, githubClient, *config, orgRepos)
+				drifts = append(drifts, orgDrifts...)
 			}
-			skippedRepos = reposToSkip
-		}
-
-		for _, org := range strings.Split(o.orgs, ",") {
-			org = strings.TrimSpace(org)
-			logger := logrus.WithField("org", org)
-			logger.Info("Reading repos")
-			repos, err := loadRepos(org, githubClient)
 			if err != nil {
-				logger.WithError(err).Fatalf("failed to read repos")
+				logrus.WithError(err).Fatalf("failed to update %s", org)
 			}
-			if skipped, exist := skippedRepos[org]; exist {
-				repos = sets.NewString(repos...).Difference(sets.NewString(skipped...)).UnsortedList()
+		}
+
+		if o.action == "drift" {
+			sort.Slice(drifts, func(i, j int) bool { return drifts[i].Repo < drifts[j].Repo })
+			if err := writeDrift(os.Stdout, drifts); err != nil {
+				logrus.WithError(err).Fatal("failed to write the drift report")
 			}
-			if err = syncOrg(org, githubClient, *config, repos, o.confirm); err != nil {
-				logrus.WithError(err).Fatalf("failed to update %s", org)
+			if len(drifts) > 0 {
+				logrus.Fatalf("labels of %d repos differ from --config=%s", len(drifts), o.labelsPath)
 			}
 		}
 	default:
@@ -793,6 +771,43 @@ func main() {
 	}
 }
 
+// reposToSync determines which repos of which orgs to sync: either a list of
+// org/repo values, or all repos of a list of orgs, except for a list of
+// org/repo values to skip.
+func reposToSync(o options, gc client) (map[string][]string, error) {
+	if o.onlyRepos != "" {
+		only, err := parseCommaDelimitedList(o.onlyRepos)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --only: %w", err)
+		}
+		return only, nil
+	}
+
+	skippedRepos := map[string][]string{}
+	if o.skipRepos != "" {
+		reposToSkip, err := parseCommaDelimitedList(o.skipRepos)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --skip: %w", err)
+		}
+		skippedRepos = reposToSkip
+	}
+
+	orgRepos := map[string][]string{}
+	for _, org := range strings.Split(o.orgs, ",") {
+		org = strings.TrimSpace(org)
+		logrus.WithField("org", org).Info("Reading repos")
+		repos, err := loadRepos(org, gc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read repos of %s: %w", org, err)
+		}
+		if skipped, exist := skippedRepos[org]; exist {
+			repos = sets.NewString(repos...).Difference(sets.NewString(skipped...)).UnsortedList()
+		}
+		orgRepos[org] = repos
+	}
+	return orgRepos, nil
+}
+
 // parseCommaDelimitedList parses values in the format:
 //   org/repo,org2/repo2,org/repo3
 // into a mapping of org to repos, i.e.:
@@ -918,6 +933,185 @@ func syncOrg(org string, githubClient client, config Configuration, repos []stri
 	return nil
 }
 
+// migrateOrg moves every open and closed issue and PR of the repos from their
+// deprecated labels to the labels replacing them, then deletes the deprecated
+// labels.
+func migrateOrg(org string, githubClient client, config Configuration, repos []string, confirm bool) error {
+	logger := logrus.WithField("org", org)
+	currLabels, err := loadLabels(githubClient, org, repos)
+	if err != nil {
+		return err
+	}
+
+	updates, err := syncLabels(config, org, *currLabels)
+	if err != nil {
+		return err
+	}
+
+	var migrateErrs []error
+	for repo, repoUpdates := range updates {
+		for _, update := range repoUpdates {
+			if update.Why != "migrate" {
+				continue
+			}
+			repoLogger := logger.WithField("repo", repo).WithField("from", update.Current.Name).WithField("to", update.Wanted.Name)
+			if !confirm {
+				repoLogger.Info("Running without --confirm, not migrating")
+				continue
+			}
+			repoLogger.Info("Migrating")
+			if err := migrateLabel(githubClient, org, repo, update.Current.Name, update.Wanted.Name); err != nil {
+				migrateErrs = append(migrateErrs, err)
+			}
+		}
+	}
+
+	if len(migrateErrs) > 0 {
+		return fmt.Errorf("failed to migrate labels: %v", migrateErrs)
+	}
+	return nil
+}
+
+// searchLag is how long to wait for the search to stop finding the issues and
+// PRs that were relabelled, and searchRetries how many times to wait.
+var (
+	searchLag     = 10 * time.Second
+	searchRetries = 6
+)
+
+// migrateIssues relabels the issues and PRs found by the query from one label
+// to the other, searching again until nothing is left to relabel, and then
+// deletes the deprecated label. The search is eventually consistent, so the
+// label is kept if it still finds relabelled issues after searchRetries.
+func migrateIssues(gc client, org, repo, query, from, to string) []error {
+	migrated := sets.NewInt()
+	for retries := 0; ; {
+		issues, err := gc.FindIssues(query, "", false)
+		if err != nil {
+			return []error{err}
+		}
+		if len(issues) == 0 {
+			if err := gc.DeleteRepoLabel(org, repo, from); err != nil {
+				return []error{err}
+			}
+			return nil
+		}
+		var errs []error
+		var relabelled bool
+		for _, i := range issues {
+			if migrated.Has(i.Number) {
+				continue
+			}
+			relabelled = true
+			if err := gc.AddLabel(org, repo, i.Number, to); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := gc.RemoveLabel(org, repo, i.Number, from); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			migrated.Insert(i.Number)
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		if relabelled {
+			retries = 0
+			continue
+		}
+		if retries == searchRetries {
+			return []error{fmt.Errorf("the search still finds %d relabelled issues and PRs, keeping label %s", len(issues), from)}
+		}
+		retries++
+		time.Sleep(searchLag)
+	}
+}
+
+// migrateLabel relabels every issue and PR of the repo, open or closed,
+// labelled with the deprecated label, and then deletes the deprecated label.
+func migrateLabel(gc client, org, repo, from, to string) error {
+	query := fmt.Sprintf("repo:%s/%s label:\"%s\" -label:\"%s\"", org, repo, from, to)
+	if errs := migrateIssues(gc, org, repo, query, from, to); len(errs) > 0 {
+		return fmt.Errorf("failed to migrate the issues of %s/%s from %s to %s: %v", org, repo, from, to, errs)
+	}
+	return nil
+}
+
+// Drift lists how the labels of a repo differ from the configuration.
+type Drift struct {
+	// Repo is the org/repo whose labels differ
+	Repo string `json:"repo"`
+	// Missing lists the labels to create
+	Missing []string `json:"missing,omitempty"`
+	// Changed lists the labels with another color or description
+	Changed []string `json:"changed,omitempty"`
+	// Renamed lists the labels to rename, as "previous -> wanted"
+	Renamed []string `json:"renamed,omitempty"`
+	// Migrated lists the labels to migrate, as "previous -> wanted"
+	Migrated []string `json:"migrated,omitempty"`
+	// Dead lists the labels to delete
+	Dead []string `json:"dead,omitempty"`
+}
+
+// driftOrg reports the repos whose labels differ from the configuration.
+func driftOrg(org string, githubClient client, config Configuration, repos []string) ([]Drift, error) {
+	currLabels, err := loadLabels(githubClient, org, repos)
+	if err != nil {
+		return nil, err
+	}
+
+	updates, err := syncLabels(config, org, *currLabels)
+	if err != nil {
+		return nil, err
+	}
+	return updates.drift(org), nil
+}
+
+// drift summarizes the updates of each repo, sorted by repo.
+func (ru RepoUpdates) drift(org string) []Drift {
+	var drifts []Drift
+	for repo, updates := range ru {
+		if len(updates) == 0 {
+			continue
+		}
+		d := Drift{Repo: org + "/" + repo}
+		for _, update := range updates {
+			switch update.Why {
+			case "missing":
+				d.Missing = append(d.Missing, update.Wanted.Name)
+			case "change":
+				d.Changed = append(d.Changed, update.Wanted.Name)
+			case "rename":
+				d.Renamed = append(d.Renamed, update.Current.Name+" -> "+update.Wanted.Name)
+			case "migrate":
+				d.Migrated = append(d.Migrated, update.Current.Name+" -> "+update.Wanted.Name)
+			case "dead":
+				d.Dead = append(d.Dead, update.Current.Name)
+			}
+		}
+		for _, names := range [][]string{d.Missing, d.Changed, d.Renamed, d.Migrated, d.Dead} {
+			sort.Strings(names)
+		}
+		drifts = append(drifts, d)
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Repo < drifts[j].Repo })
+	return drifts
+}
+
+// writeDrift writes the drift report as YAML.
+func writeDrift(w io.Writer, drifts []Drift) error {
+	if drifts == nil {
+		drifts = []Drift{}
+	}
+	y, err := yaml.Marshal(drifts)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(y)
+	return err
+}
+
 type labelCSSData struct {
 	BackgroundColor, Color, Name string
 }
@@ -17,13 +17,17 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"k8s.io/test-infra/prow/github"
 )
 
 // Tests for getting data from GitHub are not needed:
@@ -519,3 +523,172 @@ func TestLoadYAML(t *testing.T) {
 		}
 	}
 }
+
+type fakeClient struct {
+	client
+	issues  []github.Issue
+	failAdd int
+	// lag is the number of searches that still find the issues once they
+	// have been relabelled.
+	lag     int
+	stale   []github.Issue
+	queries []string
+	added   []int
+	removed []int
+	deleted []string
+}
+
+func (f *fakeClient) FindIssues(query, order string, ascending bool) ([]github.Issue, error) {
+	f.queries = append(f.queries, query)
+	if len(f.queries) > 1 && f.lag > 0 {
+		f.lag--
+		return f.stale, nil
+	}
+	return f.issues, nil
+}
+
+func (f *fakeClient) AddLabel(org, repo string, number int, label string) error {
+	if number == f.failAdd {
+		return errors.New("injected failure")
+	}
+	f.added = append(f.added, number)
+	return nil
+}
+
+func (f *fakeClient) RemoveLabel(org, repo string, number int, label string) error {
+	f.removed = append(f.removed, number)
+	var left []github.Issue
+	for _, issue := range f.issues {
+		if issue.Number != number {
+			left = append(left, issue)
+		}
+	}
+	f.issues = left
+	return nil
+}
+
+func (f *fakeClient) DeleteRepoLabel(org, repo, label string) error {
+	f.deleted = append(f.deleted, label)
+	return nil
+}
+
+func TestMigrateLabel(t *testing.T) {
+	searchLag = 0
+	var testcases = []struct {
+		name            string
+		issues          []github.Issue
+		failAdd         int
+		lag             int
+		expectedAdded   []int
+		expectedRemoved []int
+		expectedDeleted []string
+		expectedError   bool
+	}{
+		{
+			name:            "no issue to relabel, the label is deleted",
+			expectedDeleted: []string{"P0"},
+		},
+		{
+			name:            "open and closed issues are relabelled, and the label is deleted",
+			issues:          []github.Issue{{Number: 1, State: "open"}, {Number: 2, State: "closed"}},
+			expectedAdded:   []int{1, 2},
+			expectedRemoved: []int{1, 2},
+			expectedDeleted: []string{"P0"},
+		},
+		{
+			name:            "the search is waited for until it stops finding relabelled issues",
+			issues:          []github.Issue{{Number: 1}, {Number: 2}},
+			lag:             2,
+			expectedAdded:   []int{1, 2},
+			expectedRemoved: []int{1, 2},
+			expectedDeleted: []string{"P0"},
+		},
+		{
+			name:            "the label is kept when the search keeps finding relabelled issues",
+			issues:          []github.Issue{{Number: 1}, {Number: 2}},
+			lag:             10,
+			expectedAdded:   []int{1, 2},
+			expectedRemoved: []int{1, 2},
+			expectedError:   true,
+		},
+		{
+			name:            "the label is kept when an issue fails to be relabelled",
+			issues:          []github.Issue{{Number: 1}, {Number: 2}},
+			failAdd:         1,
+			expectedAdded:   []int{2},
+			expectedRemoved: []int{2},
+			expectedError:   true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			gc := &fakeClient{issues: tc.issues, failAdd: tc.failAdd, lag: tc.lag, stale: tc.issues}
+			err := migrateLabel(gc, "org", "repo", "P0", "priority/P0")
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("expected error %t, got %v", tc.expectedError, err)
+			}
+			for _, query := range gc.queries {
+				if expected := `repo:org/repo label:"P0" -label:"priority/P0"`; query != expected {
+					t.Errorf("expected query %q, got %q", expected, query)
+				}
+			}
+			if diff := cmp.Diff(tc.expectedAdded, gc.added); diff != "" {
+				t.Errorf("unexpected relabelled issues (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedRemoved, gc.removed); diff != "" {
+				t.Errorf("unexpected unlabelled issues (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedDeleted, gc.deleted); diff != "" {
+				t.Errorf("unexpected deleted labels (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDrift(t *testing.T) {
+	updates := RepoUpdates{
+		"synced": nil,
+		"repo2": {
+			{Why: "dead", Current: &Label{Name: "old"}},
+		},
+		"repo1": {
+			{Why: "missing", Wanted: &Label{Name: "lgtm"}},
+			{Why: "missing", Wanted: &Label{Name: "approved"}},
+			{Why: "change", Current: &Label{Name: "bug"}, Wanted: &Label{Name: "bug"}},
+			{Why: "rename", Current: &Label{Name: "P1"}, Wanted: &Label{Name: "priority/P1"}},
+			{Why: "migrate", Current: &Label{Name: "P0"}, Wanted: &Label{Name: "priority/P0"}},
+		},
+	}
+	expected := []Drift{
+		{
+			Repo:     "org/repo1",
+			Missing:  []string{"approved", "lgtm"},
+			Changed:  []string{"bug"},
+			Renamed:  []string{"P1 -> priority/P1"},
+			Migrated: []string{"P0 -> priority/P0"},
+		},
+		{
+			Repo: "org/repo2",
+			Dead: []string{"old"},
+		},
+	}
+	drifts := updates.drift("org")
+	if diff := cmp.Diff(expected, drifts); diff != "" {
+		t.Errorf("unexpected drift (-want +got):\n%s", diff)
+	}
+
+	var report bytes.Buffer
+	if err := writeDrift(&report, drifts[1:]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "- dead:\n  - old\n  repo: org/repo2\n"; report.String() != expected {
+		t.Errorf("expected report %q, got %q", expected, report.String())
+	}
+	report.Reset()
+	if err := writeDrift(&report, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "[]\n"; report.String() != expected {
+		t.Errorf("expected report %q, got %q", expected, report.String())
+	}
+}
@@ -32,6 +32,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	prowjobv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
 
 	prowjobscheme "k8s.io/test-infra/prow/client/clientset/versioned/scheme"
 )
@@ -79,21 +80,26 @@ func readRequest(r io.Reader, contentType string) (*admissionapi.AdmissionReques
 	return ar.Request, nil
 }
 
-// handle reads the request and writes the response
-func handle(w http.ResponseWriter, r *http.Request) {
-	req, err := readRequest(r.Body, r.Header.Get("Content-Type"))
-	if err != nil {
-		logrus.WithError(err).Error("read")
-	}
+// handle returns a handler that reads the request and writes the response
+// decided by decide.
+func handle(decide decider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := readRequest(r.Body, r.Header.Get("Content-Type"))
+		if err != nil {
+			logrus.WithError(err).Error("read")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	if err := writeResponse(*req, w, onlyUpdateStatus); err != nil {
-		logrus.WithError(err).Error("write")
+		if err := writeResponse(*req, w, decide); err != nil {
+			logrus.WithError(err).Error("write")
+		}
 	}
 }
 
 type decider func(admissionapi.AdmissionRequest) (*admissionapi.AdmissionResponse, error)
 
-// writeResponse gets the response from onlyUpdateStatus and writes it to w.
+// writeResponse gets the response from decide and writes it to w.
 func writeResponse(ar admissionapi.AdmissionRequest, w io.Writer, decide decider) error {
 	response, err := decide(ar)
 	if err != nil {
@@ -127,8 +133,53 @@ var (
 			Message: "ProwJobs may only update status",
 		},
 	}
+	rejectWithoutConfig = admissionapi.AdmissionResponse{
+		Result: &meta.Status{
+			Reason:  meta.StatusReasonForbidden,
+			Message: "ProwJobs can't be created: the pod security policy can't be enforced without --config-path",
+		},
+	}
 )
 
+// validateProwJob decides on creations with validatePodSecurity and on all
+// other operations with onlyUpdateStatus.
+func validateProwJob(cfg config.Getter) decider {
+	return func(req admissionapi.AdmissionRequest) (*admissionapi.AdmissionResponse, error) {
+		if req.Operation == admissionapi.Create {
+			return validatePodSecurity(cfg, req)
+		}
+		return onlyUpdateStatus(req)
+	}
+}
+
+// validatePodSecurity rejects new ProwJobs whose pod spec violates the pod
+// security policy, so that jobs can't request more privileges than their
+// config would be allowed to, e.g. through in-repo config. The policy is
+// looked up by the refs of the ProwJob, which are chosen by whoever creates
+// it, so this doesn't restrict those allowed to create ProwJobs directly.
+// Without config, all creations are rejected rather than let through
+// unchecked.
+func validatePodSecurity(cfg config.Getter, req admissionapi.AdmissionRequest) (*admissionapi.AdmissionResponse, error) {
+	if cfg == nil {
+		logrus.WithField("user", req.UserInfo.Username).Info("reject creation without config")
+		return &rejectWithoutConfig, nil
+	}
+	var pj prowjobv1.ProwJob
+	if _, _, err := codecs.UniversalDeserializer().Decode(req.Object.Raw, nil, &pj); err != nil {
+		return nil, fmt.Errorf("decode new: %w", err)
+	}
+	if err := cfg().PodSecurity.ValidateProwJob(pj.Spec); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"job": pj.Spec.Job, "user": req.UserInfo.Username}).Info("reject creation")
+		return &admissionapi.AdmissionResponse{
+			Result: &meta.Status{
+				Reason:  meta.StatusReasonForbidden,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+	return &allow, nil
+}
+
 // onlyUpdateStatus returns the response to the request
 func onlyUpdateStatus(req admissionapi.AdmissionRequest) (*admissionapi.AdmissionResponse, error) {
 	logger := logrus.WithFields(logrus.Fields{
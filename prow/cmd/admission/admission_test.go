@@ -25,9 +25,11 @@ import (
 	"testing"
 
 	admissionapi "k8s.io/api/admission/v1beta1"
+	coreapi "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	prowjobv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
 )
 
 func TestOnlyUpdateStatus(t *testing.T) {
@@ -117,6 +119,81 @@ func TestOnlyUpdateStatus(t *testing.T) {
 	}
 }
 
+func TestValidateProwJob(t *testing.T) {
+	privileged := true
+	privilegedJob := prowjobv1.ProwJob{
+		Spec: prowjobv1.ProwJobSpec{
+			Refs: &prowjobv1.Refs{Org: "org", Repo: "repo"},
+			PodSpec: &coreapi.PodSpec{Containers: []coreapi.Container{{
+				Name:            "test",
+				SecurityContext: &coreapi.SecurityContext{Privileged: &privileged},
+			}}},
+		},
+	}
+	otherJob := *privilegedJob.DeepCopy()
+	otherJob.Spec.Refs.Org = "other"
+	cfg := func() *config.Config {
+		return &config.Config{ProwConfig: config.ProwConfig{PodSecurity: &config.PodSecurity{
+			Repos: map[string]config.PodSecurityAllowlist{"org/repo": {Privileged: true}},
+		}}}
+	}
+
+	cases := []struct {
+		name      string
+		cfg       config.Getter
+		operation admissionapi.Operation
+		new       prowjobv1.ProwJob
+		old       prowjobv1.ProwJob
+		allowed   bool
+	}{
+		{
+			name:      "allow creation of job allowed by the policy",
+			cfg:       cfg,
+			operation: admissionapi.Create,
+			new:       privilegedJob,
+			allowed:   true,
+		},
+		{
+			name:      "reject creation of job violating the policy",
+			cfg:       cfg,
+			operation: admissionapi.Create,
+			new:       otherJob,
+		},
+		{
+			name:      "reject creation of any job without config",
+			operation: admissionapi.Create,
+			new:       privilegedJob,
+		},
+		{
+			name:      "updates are still restricted to the status",
+			cfg:       cfg,
+			operation: admissionapi.Update,
+			old:       privilegedJob,
+			new:       otherJob,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := admissionapi.AdmissionRequest{Operation: tc.operation}
+			var err error
+			if req.Object.Raw, err = json.Marshal(tc.new); err != nil {
+				t.Fatalf("encode new: %v", err)
+			}
+			if req.OldObject.Raw, err = json.Marshal(tc.old); err != nil {
+				t.Fatalf("encode old: %v", err)
+			}
+			actual, err := validateProwJob(tc.cfg)(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual.Allowed != tc.allowed {
+				t.Errorf("expected allowed to be %t, got %#v", tc.allowed, actual)
+			}
+		})
+	}
+}
+
 func TestWriteResponse(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -28,7 +28,9 @@ import (
 	"github.com/sirupsen/logrus"
 	"k8s.io/test-infra/prow/pjutil/pprof"
 
+	"k8s.io/test-infra/prow/config"
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	configflagutil "k8s.io/test-infra/prow/flagutil/config"
 	"k8s.io/test-infra/prow/interrupts"
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/pjutil"
@@ -38,6 +40,7 @@ type options struct {
 	cert                   string
 	privateKey             string
 	instrumentationOptions prowflagutil.InstrumentationOptions
+	config                 configflagutil.ConfigOptions
 }
 
 func parseOptions() options {
@@ -52,13 +55,14 @@ func (o *options) parse(flags *flag.FlagSet, args []string) error {
 	flags.StringVar(&o.cert, "tls-cert-file", "", "Path to x509 certificate for HTTPS")
 	flags.StringVar(&o.privateKey, "tls-private-key-file", "", "Path to matching x509 private key.")
 	o.instrumentationOptions.AddFlags(flags)
+	o.config.AddFlags(flags)
 	if err := flags.Parse(args); err != nil {
 		return fmt.Errorf("parse flags: %w", err)
 	}
 	if len(o.cert) == 0 || len(o.privateKey) == 0 {
 		return errors.New("Both --tls-cert-file and --tls-private-key-file are required for HTTPS")
 	}
-	return nil
+	return o.config.ValidateConfigOptional()
 }
 
 func main() {
@@ -71,7 +75,18 @@ func main() {
 	pprof.Instrument(o.instrumentationOptions)
 	health := pjutil.NewHealthOnPort(o.instrumentationOptions.HealthPort)
 
-	http.HandleFunc("/validate", handle)
+	// Without the config, the pod security policy can't be enforced and new
+	// ProwJobs are rejected if the webhook is registered for creations.
+	var cfg config.Getter
+	if o.config.ConfigPath != "" {
+		configAgent, err := o.config.ConfigAgent()
+		if err != nil {
+			logrus.WithError(err).Fatal("Error starting config agent.")
+		}
+		cfg = configAgent.Config
+	}
+
+	http.HandleFunc("/validate", handle(validateProwJob(cfg)))
 	s := http.Server{
 		Addr: ":8443",
 		TLSConfig: &tls.Config{
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	configflagutil "k8s.io/test-infra/prow/flagutil/config"
 )
 
 func TestOptions(t *testing.T) {
@@ -44,8 +45,32 @@ func TestOptions(t *testing.T) {
 				cert:                   "c",
 				privateKey:             "k",
 				instrumentationOptions: prowflagutil.DefaultInstrumentationOptions(),
+				config: configflagutil.ConfigOptions{
+					ConfigPathFlagName:                    "config-path",
+					JobConfigPathFlagName:                 "job-config-path",
+					SupplementalProwConfigsFileNameSuffix: "_prowconfig.yaml",
+				},
 			},
 		},
+		{
+			name: "accepts config",
+			args: []string{"--tls-cert-file=c", "--tls-private-key-file=k", "--config-path=prow/config.yaml"},
+			expected: &options{
+				cert:                   "c",
+				privateKey:             "k",
+				instrumentationOptions: prowflagutil.DefaultInstrumentationOptions(),
+				config: configflagutil.ConfigOptions{
+					ConfigPathFlagName:                    "config-path",
+					JobConfigPathFlagName:                 "job-config-path",
+					ConfigPath:                            "prow/config.yaml",
+					SupplementalProwConfigsFileNameSuffix: "_prowconfig.yaml",
+				},
+			},
+		},
+		{
+			name: "job config requires config",
+			args: []string{"--tls-cert-file=c", "--tls-private-key-file=k", "--job-config-path=config/jobs"},
+		},
 		{
 			name: "defaults error",
 		}}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"reflect"
 	"regexp"
 	"sort"
 	"strings"
@@ -105,6 +106,10 @@ type requirements struct {
 	Repo    string
 	Branch  string
 	Request *github.BranchProtectionRequest
+	// Ruleset is set instead of Branch and Request to create the ruleset,
+	// or to update it when RulesetID is set. RulesetID alone deletes it.
+	Ruleset   *github.Ruleset
+	RulesetID int
 }
 
 // Errors holds a list of errors, including a method to concurrently append.
@@ -146,6 +151,7 @@ func main() {
 		updates:            make(chan requirements),
 		errors:             Errors{},
 		completedRepos:     make(map[string]bool),
+		completedRulesets:  make(map[string]bool),
 		done:               make(chan []error),
 		verifyRestrictions: o.verifyRestrictions,
 		enabled:            o.githubEnablement.EnablementChecker(),
@@ -172,14 +178,23 @@ type client interface {
 	GetRepos(org string, user bool) ([]github.Repo, error)
 	ListCollaborators(org, repo string) ([]github.User, error)
 	ListRepoTeams(org, repo string) ([]github.Team, error)
+	ListRepoRulesets(org, repo string) ([]github.Ruleset, error)
+	GetRepoRuleset(org, repo string, id int) (*github.Ruleset, error)
+	CreateRepoRuleset(org, repo string, ruleset github.Ruleset) (*github.Ruleset, error)
+	UpdateRepoRuleset(org, repo string, id int, ruleset github.Ruleset) (*github.Ruleset, error)
+	DeleteRepoRuleset(org, repo string, id int) error
+	GetTeamBySlug(slug string, org string) (*github.Team, error)
 }
 
 type protector struct {
-	client             client
-	cfg                *config.Config
-	updates            chan requirements
-	errors             Errors
-	completedRepos     map[string]bool
+	client         client
+	cfg            *config.Config
+	updates        chan requirements
+	errors         Errors
+	completedRepos map[string]bool
+	// completedRulesets holds the repos whose rulesets were updated on their
+	// own, without updating their branches.
+	completedRulesets  map[string]bool
 	done               chan []error
 	verifyRestrictions bool
 	enabled            func(org, repo string) bool
@@ -187,6 +202,23 @@ type protector struct {
 
 func (p *protector) configureBranches() {
 	for u := range p.updates {
+		if u.Ruleset != nil {
+			if u.RulesetID == 0 {
+				if _, err := p.client.CreateRepoRuleset(u.Org, u.Repo, *u.Ruleset); err != nil {
+					p.errors.add(fmt.Errorf("create %s/%s ruleset %s failed: %w", u.Org, u.Repo, u.Ruleset.Name, err))
+				}
+			} else if _, err := p.client.UpdateRepoRuleset(u.Org, u.Repo, u.RulesetID, *u.Ruleset); err != nil {
+				p.errors.add(fmt.Errorf("update %s/%s ruleset %s failed: %w", u.Org, u.Repo, u.Ruleset.Name, err))
+			}
+			continue
+		}
+		if u.RulesetID != 0 {
+			if err := p.client.DeleteRepoRuleset(u.Org, u.Repo, u.RulesetID); err != nil {
+				p.errors.add(fmt.Errorf("delete %s/%s ruleset %d failed: %w", u.Org, u.Repo, u.RulesetID, err))
+			}
+			continue
+		}
+
 		if u.Request == nil {
 			if err := p.client.RemoveBranchProtection(u.Org, u.Repo, u.Branch); err != nil {
 				p.errors.add(fmt.Errorf("remove %s/%s=%s protection failed: %w", u.Org, u.Repo, u.Branch, err))
@@ -257,8 +289,10 @@ func (p *protector) UpdateOrg(orgName string, org config.Org) error {
 	}
 
 	var repos []string
-	if org.Protect != nil {
+	if org.Protect != nil || org.Rulesets != nil {
 		// Strongly opinionated org, configure every repo in the org.
+		// Orgs with rulesets but no protect policy only get the rulesets
+		// of their repos not listed in the config updated.
 		rs, err := p.client.GetRepos(orgName, false)
 		if err != nil {
 			return fmt.Errorf("list repos: %w", err)
@@ -287,6 +321,16 @@ func (p *protector) UpdateOrg(orgName string, org config.Org) error {
 			continue
 		}
 		repo := org.GetRepo(repoName)
+		if _, listed := org.Repos[repoName]; org.Protect == nil && !listed {
+			if repo.Policy.Unmanaged != nil && *repo.Policy.Unmanaged {
+				continue
+			}
+			p.completedRulesets[orgName+"/"+repoName] = true
+			if err := p.UpdateRulesets(orgName, repoName, repo.Rulesets); err != nil {
+				errs = append(errs, fmt.Errorf("update %s rulesets: %w", repoName, err))
+			}
+			continue
+		}
 		if err := p.UpdateRepo(orgName, repoName, *repo); err != nil {
 			errs = append(errs, fmt.Errorf("update %s: %w", repoName, err))
 		}
@@ -376,6 +420,85 @@ func (p *protector) UpdateRepo(orgName string, repoName string, repo config.Repo
 		}
 	}
 
+	if !p.completedRulesets[orgName+"/"+repoName] {
+		if err := p.UpdateRulesets(orgName, repoName, repo.Rulesets); err != nil {
+			errs = append(errs, fmt.Errorf("update rulesets: %w", err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// UpdateRulesets creates, updates and deletes the rulesets of the repo to
+// match the configured rulesets. Repos without any configured rulesets, not
+// even an empty map, keep their rulesets untouched.
+func (p *protector) UpdateRulesets(orgName, repoName string, rulesets map[string]config.Ruleset) error {
+	if rulesets == nil {
+		return nil
+	}
+
+	current, err := p.client.ListRepoRulesets(orgName, repoName)
+	if err != nil {
+		return fmt.Errorf("list rulesets: %w", err)
+	}
+	ids := map[string]int{}
+	for _, r := range current {
+		ids[r.Name] = r.ID
+		if _, ok := rulesets[r.Name]; !ok {
+			p.updates <- requirements{
+				Org:       orgName,
+				Repo:      repoName,
+				RulesetID: r.ID,
+			}
+		}
+	}
+
+	teamIDs := map[string]int{}
+	teamID := func(slug string) (int, error) {
+		if id, ok := teamIDs[slug]; ok {
+			return id, nil
+		}
+		team, err := p.client.GetTeamBySlug(slug, orgName)
+		if err != nil {
+			return 0, err
+		}
+		teamIDs[slug] = team.ID
+		return team.ID, nil
+	}
+
+	var names []string
+	for name := range rulesets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		request, err := makeRuleset(name, rulesets[name], teamID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ruleset %s: %w", name, err))
+			continue
+		}
+		id, exists := ids[name]
+		if exists {
+			// Listed rulesets lack their conditions and rules.
+			state, err := p.client.GetRepoRuleset(orgName, repoName, id)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("get ruleset %s: %w", name, err))
+				continue
+			}
+			if equalRulesets(state, &request) {
+				logrus.Debugf("%s/%s: current ruleset %s matches policy, skipping", orgName, repoName, name)
+				continue
+			}
+		}
+		p.updates <- requirements{
+			Org:       orgName,
+			Repo:      repoName,
+			Ruleset:   &request,
+			RulesetID: id,
+		}
+	}
 	return utilerrors.NewAggregate(errs)
 }
 
@@ -600,3 +723,61 @@ func equalRestrictions(state *github.Restrictions, request *github.RestrictionsR
 		return false
 	}
 }
+
+// equalRulesets compares the ruleset state to the request, disregarding the
+// order of the lists and the fields the request does not set.
+func equalRulesets(state, request *github.Ruleset) bool {
+	if state == nil || request == nil {
+		return state == request
+	}
+	return reflect.DeepEqual(normalizeRuleset(*state), normalizeRuleset(*request))
+}
+
+func normalizeRuleset(r github.Ruleset) github.Ruleset {
+	normalized := github.Ruleset{
+		Name:        r.Name,
+		Target:      r.Target,
+		Enforcement: r.Enforcement,
+	}
+	if normalized.Target == "" {
+		normalized.Target = github.RulesetTargetBranch
+	}
+	for _, actor := range r.BypassActors {
+		if actor.ActorType == github.BypassActorOrganizationAdmin {
+			actor.ActorID = 0
+		}
+		normalized.BypassActors = append(normalized.BypassActors, actor)
+	}
+	sort.Slice(normalized.BypassActors, func(i, j int) bool {
+		a, b := normalized.BypassActors[i], normalized.BypassActors[j]
+		if a.ActorType != b.ActorType {
+			return a.ActorType < b.ActorType
+		}
+		return a.ActorID < b.ActorID
+	})
+	if r.Conditions != nil && r.Conditions.RefName != nil && (len(r.Conditions.RefName.Include) > 0 || len(r.Conditions.RefName.Exclude) > 0) {
+		normalized.Conditions = &github.RulesetConditions{RefName: &github.RulesetRefNameCondition{
+			Include: sets.NewString(r.Conditions.RefName.Include...).List(),
+			Exclude: sets.NewString(r.Conditions.RefName.Exclude...).List(),
+		}}
+	}
+	for _, rule := range r.Rules {
+		if rule.Parameters != nil {
+			parameters := github.RulesetRuleParameters{
+				RequiredDeploymentEnvironments: sets.NewString(rule.Parameters.RequiredDeploymentEnvironments...).List(),
+			}
+			if rule.Type == github.RuleRequiredStatusChecks {
+				strict := rule.Parameters.StrictRequiredStatusChecksPolicy != nil && *rule.Parameters.StrictRequiredStatusChecksPolicy
+				parameters.StrictRequiredStatusChecksPolicy = &strict
+			}
+			parameters.RequiredStatusChecks = append(parameters.RequiredStatusChecks, rule.Parameters.RequiredStatusChecks...)
+			sort.Slice(parameters.RequiredStatusChecks, func(i, j int) bool {
+				return parameters.RequiredStatusChecks[i].Context < parameters.RequiredStatusChecks[j].Context
+			})
+			rule.Parameters = &parameters
+		}
+		normalized.Rules = append(normalized.Rules, rule)
+	}
+	sort.Slice(normalized.Rules, func(i, j int) bool { return normalized.Rules[i].Type < normalized.Rules[j].Type })
+	return normalized
+}
@@ -32,6 +32,7 @@ import (
 	"k8s.io/test-infra/prow/flagutil"
 	configflagutil "k8s.io/test-infra/prow/flagutil/config"
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
 )
 
 func TestOptions_Validate(t *testing.T) {
@@ -105,6 +106,7 @@ func TestOptions_Validate(t *testing.T) {
 }
 
 type fakeClient struct {
+	*fakegithub.FakeClient
 	repos             map[string][]github.Repo
 	branches          map[string][]github.Branch
 	deleted           map[string]bool
@@ -296,6 +298,234 @@ func TestConfigureBranches(t *testing.T) {
 	}
 }
 
+func TestUpdateRulesets(t *testing.T) {
+	yes := true
+	fc := fakegithub.NewFakeClient()
+	fc.RulesetID = 3
+	fc.RepoRulesets["org/repo"] = []github.Ruleset{
+		{ID: 1, Name: "signed", Target: "branch", Enforcement: "active", Rules: []github.RulesetRule{{Type: "required_signatures"}}},
+		{ID: 2, Name: "history", Target: "branch", Enforcement: "active", Rules: []github.RulesetRule{{Type: "required_linear_history"}}},
+		{ID: 3, Name: "removed", Target: "tag", Enforcement: "disabled"},
+	}
+	rulesets := map[string]config.Ruleset{
+		"signed": {RequiredSignatures: &yes},
+		"history": {
+			RequiredLinearHistory: &yes,
+			BypassActors:          []config.BypassActor{{Team: "Leads"}, {OrgAdmin: true}},
+		},
+		"deployments": {RequiredDeployments: []string{"production"}},
+	}
+
+	p := protector{
+		client:  &fakeClient{FakeClient: fc},
+		updates: make(chan requirements),
+		done:    make(chan []error),
+	}
+	go p.configureBranches()
+	if err := p.UpdateRulesets("org", "repo", rulesets); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(p.updates)
+	if errs := <-p.done; len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	expected := []github.Ruleset{
+		{ID: 1, Name: "signed", Target: "branch", Enforcement: "active", Rules: []github.RulesetRule{{Type: "required_signatures"}}},
+		{ID: 2, Name: "history", Target: "branch", Enforcement: "active",
+			BypassActors: []github.RulesetBypassActor{
+				{ActorID: 42, ActorType: "Team", BypassMode: "always"},
+				{ActorID: 1, ActorType: "OrganizationAdmin", BypassMode: "always"},
+			},
+			Rules: []github.RulesetRule{{Type: "required_linear_history"}},
+		},
+		{ID: 4, Name: "deployments", Target: "branch", Enforcement: "active", Rules: []github.RulesetRule{
+			{Type: "required_deployments", Parameters: &github.RulesetRuleParameters{RequiredDeploymentEnvironments: []string{"production"}}},
+		}},
+	}
+	if diff := cmp.Diff(expected, fc.RepoRulesets["org/repo"]); diff != "" {
+		t.Errorf("unexpected rulesets (-want +got):\n%s", diff)
+	}
+}
+
+func TestUpdateRulesetsUnconfigured(t *testing.T) {
+	existing := []github.Ruleset{{ID: 1, Name: "signed", Target: "branch", Enforcement: "active"}}
+	testCases := []struct {
+		name     string
+		rulesets map[string]config.Ruleset
+		expected []github.Ruleset
+	}{
+		{
+			name:     "rulesets are untouched without config",
+			expected: existing,
+		},
+		{
+			name:     "empty rulesets delete every ruleset",
+			rulesets: map[string]config.Ruleset{},
+			expected: []github.Ruleset{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := fakegithub.NewFakeClient()
+			fc.RepoRulesets["org/repo"] = append([]github.Ruleset{}, existing...)
+			p := protector{
+				client:  &fakeClient{FakeClient: fc},
+				updates: make(chan requirements),
+				done:    make(chan []error),
+			}
+			go p.configureBranches()
+			if err := p.UpdateRulesets("org", "repo", tc.rulesets); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			close(p.updates)
+			if errs := <-p.done; len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if diff := cmp.Diff(tc.expected, fc.RepoRulesets["org/repo"]); diff != "" {
+				t.Errorf("unexpected rulesets (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateOrgRulesets(t *testing.T) {
+	fc := fakeClient{
+		FakeClient: fakegithub.NewFakeClient(),
+		repos: map[string][]github.Repo{"org": {
+			{Name: "listed", FullName: "org/listed"},
+			{Name: "unlisted", FullName: "org/unlisted"},
+			{Name: "archived", FullName: "org/archived", Archived: true},
+		}},
+		branches: map[string][]github.Branch{
+			"org/listed":   {{Name: "main"}},
+			"org/unlisted": {{Name: "main"}},
+		},
+	}
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(`
+branch-protection:
+  orgs:
+    org:
+      rulesets:
+        signed:
+          required_signatures: true
+      repos:
+        listed:
+          protect: true
+`), &cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	p := protector{
+		client:            &fc,
+		cfg:               &cfg,
+		updates:           make(chan requirements),
+		done:              make(chan []error),
+		completedRepos:    make(map[string]bool),
+		completedRulesets: make(map[string]bool),
+		enabled:           func(org, repo string) bool { return true },
+	}
+	go func() {
+		p.protect()
+		close(p.updates)
+	}()
+
+	var actual []string
+	for r := range p.updates {
+		if r.Ruleset != nil {
+			actual = append(actual, fmt.Sprintf("%s/%s ruleset %s", r.Org, r.Repo, r.Ruleset.Name))
+		} else {
+			actual = append(actual, fmt.Sprintf("%s/%s=%s", r.Org, r.Repo, r.Branch))
+		}
+	}
+	if len(p.errors.errs) != 0 {
+		t.Fatalf("unexpected errors: %v", p.errors.errs)
+	}
+	sort.Strings(actual)
+	expected := []string{
+		"org/listed ruleset signed",
+		"org/listed=main",
+		"org/unlisted ruleset signed",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected updates (-want +got):\n%s", diff)
+	}
+}
+
+func TestEqualRulesets(t *testing.T) {
+	yes := true
+	no := false
+	request := &github.Ruleset{
+		Name:         "main",
+		Target:       "branch",
+		Enforcement:  "active",
+		BypassActors: []github.RulesetBypassActor{{ActorID: 1, ActorType: "OrganizationAdmin", BypassMode: "always"}, {ActorID: 5, ActorType: "Team", BypassMode: "always"}},
+		Conditions:   &github.RulesetConditions{RefName: &github.RulesetRefNameCondition{Include: []string{"a", "b"}, Exclude: []string{}}},
+		Rules: []github.RulesetRule{
+			{Type: "deletion"},
+			{Type: "required_status_checks", Parameters: &github.RulesetRuleParameters{
+				RequiredStatusChecks:             []github.RulesetStatusCheck{{Context: "x"}, {Context: "y"}},
+				StrictRequiredStatusChecksPolicy: &no,
+			}},
+		},
+	}
+	cases := []struct {
+		name     string
+		state    *github.Ruleset
+		expected bool
+	}{
+		{
+			name: "same ruleset in another order",
+			state: &github.Ruleset{
+				ID:           9,
+				Name:         "main",
+				Target:       "branch",
+				Enforcement:  "active",
+				BypassActors: []github.RulesetBypassActor{{ActorID: 5, ActorType: "Team", BypassMode: "always"}, {ActorType: "OrganizationAdmin", BypassMode: "always"}},
+				Conditions:   &github.RulesetConditions{RefName: &github.RulesetRefNameCondition{Include: []string{"b", "a"}}},
+				Rules: []github.RulesetRule{
+					{Type: "required_status_checks", Parameters: &github.RulesetRuleParameters{
+						RequiredStatusChecks: []github.RulesetStatusCheck{{Context: "y"}, {Context: "x"}},
+					}},
+					{Type: "deletion"},
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "strict status checks",
+			state: &github.Ruleset{
+				Name:         "main",
+				Target:       "branch",
+				Enforcement:  "active",
+				BypassActors: request.BypassActors,
+				Conditions:   request.Conditions,
+				Rules: []github.RulesetRule{
+					{Type: "deletion"},
+					{Type: "required_status_checks", Parameters: &github.RulesetRuleParameters{
+						RequiredStatusChecks:             []github.RulesetStatusCheck{{Context: "x"}, {Context: "y"}},
+						StrictRequiredStatusChecksPolicy: &yes,
+					}},
+				},
+			},
+		},
+		{
+			name:  "evaluated ruleset",
+			state: &github.Ruleset{Name: "main", Target: "branch", Enforcement: "evaluate", BypassActors: request.BypassActors, Conditions: request.Conditions, Rules: request.Rules},
+		},
+		{
+			name: "missing ruleset",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := equalRulesets(tc.state, request); actual != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, actual)
+			}
+		})
+	}
+}
+
 func split(branch string) (string, string, string) {
 	parts := strings.Split(branch, "=")
 	b := parts[1]
@@ -17,6 +17,8 @@ limitations under the License.
 package main
 
 import (
+	"fmt"
+
 	branchprotection "k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
 
@@ -108,3 +110,70 @@ func makeReviews(rp *branchprotection.ReviewPolicy) *github.RequiredPullRequestR
 	}
 	return &rprr
 }
+
+// makeRuleset renders a ruleset policy into the corresponding GitHub api object,
+// resolving the bypass teams to their IDs.
+func makeRuleset(name string, r branchprotection.Ruleset, teamID func(slug string) (int, error)) (github.Ruleset, error) {
+	ruleset := github.Ruleset{
+		Name:        name,
+		Target:      r.EffectiveTarget(),
+		Enforcement: r.EffectiveEnforcement(),
+	}
+	for _, actor := range r.BypassActors {
+		bypass := github.RulesetBypassActor{BypassMode: actor.Mode}
+		if bypass.BypassMode == "" {
+			bypass.BypassMode = github.BypassModeAlways
+		}
+		switch {
+		case actor.Team != "":
+			id, err := teamID(actor.Team)
+			if err != nil {
+				return github.Ruleset{}, fmt.Errorf("get team %s: %w", actor.Team, err)
+			}
+			bypass.ActorType, bypass.ActorID = github.BypassActorTeam, id
+		case actor.App != 0:
+			bypass.ActorType, bypass.ActorID = github.BypassActorIntegration, actor.App
+		case actor.RepositoryRole != 0:
+			bypass.ActorType, bypass.ActorID = github.BypassActorRepositoryRole, actor.RepositoryRole
+		case actor.OrgAdmin:
+			// GitHub identifies the org admins by the ID 1.
+			bypass.ActorType, bypass.ActorID = github.BypassActorOrganizationAdmin, 1
+		}
+		ruleset.BypassActors = append(ruleset.BypassActors, bypass)
+	}
+	if len(r.Include) > 0 || len(r.Exclude) > 0 {
+		ruleset.Conditions = &github.RulesetConditions{RefName: &github.RulesetRefNameCondition{
+			Include: append([]string{}, sets.NewString(r.Include...).List()...),
+			Exclude: append([]string{}, sets.NewString(r.Exclude...).List()...),
+		}}
+	}
+	if makeBool(r.BlockDeletions) {
+		ruleset.Rules = append(ruleset.Rules, github.RulesetRule{Type: github.RuleDeletion})
+	}
+	if makeBool(r.BlockForcePushes) {
+		ruleset.Rules = append(ruleset.Rules, github.RulesetRule{Type: github.RuleNonFastForward})
+	}
+	if makeBool(r.RequiredLinearHistory) {
+		ruleset.Rules = append(ruleset.Rules, github.RulesetRule{Type: github.RuleRequiredLinearHistory})
+	}
+	if makeBool(r.RequiredSignatures) {
+		ruleset.Rules = append(ruleset.Rules, github.RulesetRule{Type: github.RuleRequiredSignatures})
+	}
+	if r.RequiredStatusChecks != nil && len(r.RequiredStatusChecks.Contexts) > 0 {
+		var checks []github.RulesetStatusCheck
+		for _, context := range sets.NewString(r.RequiredStatusChecks.Contexts...).List() {
+			checks = append(checks, github.RulesetStatusCheck{Context: context})
+		}
+		strict := makeBool(r.RequiredStatusChecks.Strict)
+		ruleset.Rules = append(ruleset.Rules, github.RulesetRule{Type: github.RuleRequiredStatusChecks, Parameters: &github.RulesetRuleParameters{
+			RequiredStatusChecks:             checks,
+			StrictRequiredStatusChecksPolicy: &strict,
+		}})
+	}
+	if len(r.RequiredDeployments) > 0 {
+		ruleset.Rules = append(ruleset.Rules, github.RulesetRule{Type: github.RuleRequiredDeployments, Parameters: &github.RulesetRuleParameters{
+			RequiredDeploymentEnvironments: sets.NewString(r.RequiredDeployments...).List(),
+		}})
+	}
+	return ruleset, nil
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
 	branchprotection "k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
 )
@@ -186,3 +189,111 @@ func TestMakeRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeRuleset(t *testing.T) {
+	yes := true
+	no := false
+	tag := "tag"
+	evaluate := "evaluate"
+	teamID := func(slug string) (int, error) {
+		if slug == "release" {
+			return 42, nil
+		}
+		return 0, errors.New("no such team")
+	}
+	cases := []struct {
+		name     string
+		input    branchprotection.Ruleset
+		expected github.Ruleset
+		err      bool
+	}{
+		{
+			name:     "defaults to an active branch ruleset",
+			expected: github.Ruleset{Name: "rules", Target: "branch", Enforcement: "active"},
+		},
+		{
+			name: "every rule",
+			input: branchprotection.Ruleset{
+				Enforcement: &evaluate,
+				Include:     []string{"~DEFAULT_BRANCH", "refs/heads/release-*"},
+				BypassActors: []branchprotection.BypassActor{
+					{Team: "release", Mode: "pull_request"},
+					{App: 7},
+					{RepositoryRole: 5},
+					{OrgAdmin: true},
+				},
+				RequiredSignatures:    &yes,
+				RequiredLinearHistory: &yes,
+				RequiredStatusChecks:  &branchprotection.ContextPolicy{Contexts: []string{"unit", "e2e", "unit"}},
+				RequiredDeployments:   []string{"staging"},
+				BlockDeletions:        &yes,
+				BlockForcePushes:      &no,
+			},
+			expected: github.Ruleset{
+				Name:        "rules",
+				Target:      "branch",
+				Enforcement: "evaluate",
+				BypassActors: []github.RulesetBypassActor{
+					{ActorID: 42, ActorType: "Team", BypassMode: "pull_request"},
+					{ActorID: 7, ActorType: "Integration", BypassMode: "always"},
+					{ActorID: 5, ActorType: "RepositoryRole", BypassMode: "always"},
+					{ActorID: 1, ActorType: "OrganizationAdmin", BypassMode: "always"},
+				},
+				Conditions: &github.RulesetConditions{RefName: &github.RulesetRefNameCondition{
+					Include: []string{"refs/heads/release-*", "~DEFAULT_BRANCH"},
+					Exclude: []string{},
+				}},
+				Rules: []github.RulesetRule{
+					{Type: "deletion"},
+					{Type: "required_linear_history"},
+					{Type: "required_signatures"},
+					{Type: "required_status_checks", Parameters: &github.RulesetRuleParameters{
+						RequiredStatusChecks:             []github.RulesetStatusCheck{{Context: "e2e"}, {Context: "unit"}},
+						StrictRequiredStatusChecksPolicy: &no,
+					}},
+					{Type: "required_deployments", Parameters: &github.RulesetRuleParameters{
+						RequiredDeploymentEnvironments: []string{"staging"},
+					}},
+				},
+			},
+		},
+		{
+			name: "tag protection",
+			input: branchprotection.Ruleset{
+				Target:             &tag,
+				Include:            []string{"refs/tags/v*"},
+				RequiredSignatures: &yes,
+				BlockForcePushes:   &yes,
+			},
+			expected: github.Ruleset{
+				Name:        "rules",
+				Target:      "tag",
+				Enforcement: "active",
+				Conditions: &github.RulesetConditions{RefName: &github.RulesetRefNameCondition{
+					Include: []string{"refs/tags/v*"},
+					Exclude: []string{},
+				}},
+				Rules: []github.RulesetRule{{Type: "non_fast_forward"}, {Type: "required_signatures"}},
+			},
+		},
+		{
+			name:  "unknown bypass team",
+			input: branchprotection.Ruleset{BypassActors: []branchprotection.BypassActor{{Team: "missing"}}},
+			err:   true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := makeRuleset("rules", tc.input, teamID)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("unexpected ruleset (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,544 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	v1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/labels"
+	"k8s.io/test-infra/prow/plugins"
+	"k8s.io/test-infra/prow/plugins/lgtm"
+)
+
+// fixableWarnings are the warnings that fix knows how to resolve.
+var fixableWarnings = []string{
+	unknownFieldsWarning,
+	nonDecoratedJobsWarning,
+	tideStrictBranchWarning,
+	needsOkToTestWarning,
+}
+
+// yamlFile is a YAML document that is edited in place. Changes are made on
+// the yaml.v3 node tree rather than by round-tripping through the Go types
+// so that comments and key ordering survive the rewrite.
+type yamlFile struct {
+	path  string
+	root  yaml.Node
+	dirty bool
+}
+
+func loadYAMLFile(path string) (*yamlFile, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	f := &yamlFile{path: path}
+	if err := yaml.Unmarshal(raw, &f.root); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// document returns the top-level mapping of the file, or nil if the file is
+// empty or does not hold a mapping.
+func (f *yamlFile) document() *yaml.Node {
+	if f.root.Kind != yaml.DocumentNode || len(f.root.Content) == 0 {
+		return nil
+	}
+	if doc := f.root.Content[0]; doc.Kind == yaml.MappingNode {
+		return doc
+	}
+	return nil
+}
+
+func (f *yamlFile) write() error {
+	if !f.dirty {
+		return nil
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&f.root); err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", f.path, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", f.path, err)
+	}
+	return ioutil.WriteFile(f.path, buf.Bytes(), info.Mode())
+}
+
+// fix rewrites the Prow config, job config and plugin config files in place
+// to resolve every enabled warning in fixableWarnings. Warnings without an
+// unambiguous mechanical fix are left for validate to report.
+func fix(o options) error {
+	o.setDefaultWarnings()
+
+	configAgent, err := o.config.ConfigAgent()
+	if err != nil {
+		return fmt.Errorf("error loading prow config: %w", err)
+	}
+	cfg := configAgent.Config()
+
+	prowConfig, err := loadYAMLFile(o.config.ConfigPath)
+	if err != nil {
+		return err
+	}
+	files := []*yamlFile{prowConfig}
+	jobFiles := []*yamlFile{prowConfig}
+	if o.config.JobConfigPath != "" {
+		paths, err := jobConfigFiles(o.config.JobConfigPath)
+		if err != nil {
+			return fmt.Errorf("error listing job config files: %w", err)
+		}
+		for _, path := range paths {
+			f, err := loadYAMLFile(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, f)
+			jobFiles = append(jobFiles, f)
+		}
+	}
+	var pluginConfig *yamlFile
+	if o.pluginsConfig.PluginConfigPath != "" {
+		if pluginConfig, err = loadYAMLFile(o.pluginsConfig.PluginConfigPath); err != nil {
+			return err
+		}
+		files = append(files, pluginConfig)
+	}
+
+	if o.warningEnabled(unknownFieldsWarning) {
+		fixUnknownFields(prowConfig, reflect.TypeOf(config.Config{}))
+		if pluginConfig != nil {
+			fixUnknownFields(pluginConfig, reflect.TypeOf(plugins.Configuration{}))
+		}
+	}
+	if o.warningEnabled(nonDecoratedJobsWarning) {
+		names := sets.NewString(nonDecoratedJobs(cfg)...)
+		for _, f := range jobFiles {
+			if doc := f.document(); doc != nil {
+				for _, name := range decorateJobs(doc, names) {
+					logrus.WithField("file", f.path).Infof("Enabled decoration for job %s.", name)
+					f.dirty = true
+				}
+			}
+		}
+	}
+	if o.warningEnabled(tideStrictBranchWarning) {
+		if doc := prowConfig.document(); doc != nil {
+			fixed, err := disableStrictBranchProtection(doc, cfg.ProwConfig)
+			if err != nil {
+				return err
+			}
+			for _, path := range fixed {
+				logrus.WithField("file", prowConfig.path).Infof("Disabled strict required status checks for %s.", path)
+				prowConfig.dirty = true
+			}
+		}
+	}
+	if o.warningEnabled(needsOkToTestWarning) {
+		if doc := prowConfig.document(); doc != nil {
+			for _, path := range dropNeedsOkToTestFromLGTMQueries(doc) {
+				logrus.WithField("file", prowConfig.path).Infof("Removed %q from the missingLabels of %s.", labels.NeedsOkToTest, path)
+				prowConfig.dirty = true
+			}
+		}
+	}
+
+	var errs []error
+	for _, f := range files {
+		if err := f.write(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// jobConfigFiles lists the files config.ReadJobConfig would load from path.
+func jobConfigFiles(path string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), "..") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	return paths, err
+}
+
+func fixUnknownFields(f *yamlFile, t reflect.Type) {
+	doc := f.document()
+	if doc == nil {
+		return
+	}
+	for _, path := range removeUnknownFields(doc, t, "") {
+		logrus.WithField("file", f.path).Infof("Removed unknown field %s.", path)
+		f.dirty = true
+	}
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// removeUnknownFields deletes every mapping key below n that does not
+// correspond to a field of t. Keys are matched case-insensitively against the
+// JSON field names, like the strict unmarshalling in validateUnknownFields
+// does. The dotted paths of the removed keys are returned.
+func removeUnknownFields(n *yaml.Node, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		// Types with custom unmarshalling define their own schema.
+		return nil
+	}
+
+	var removed []string
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		fields := jsonFields(t)
+		kept := make([]*yaml.Node, 0, len(n.Content))
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Value == "<<" {
+				// Merge keys are resolved by the parser, not by the schema.
+				kept = append(kept, key, value)
+				continue
+			}
+			field, known := fields[strings.ToLower(key.Value)]
+			if !known {
+				removed = append(removed, joinYAMLPath(path, key.Value))
+				continue
+			}
+			removed = append(removed, removeUnknownFields(value, field, joinYAMLPath(path, key.Value))...)
+			kept = append(kept, key, value)
+		}
+		n.Content = kept
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			removed = append(removed, removeUnknownFields(n.Content[i+1], t.Elem(), joinYAMLPath(path, n.Content[i].Value))...)
+		}
+	case reflect.Slice, reflect.Array:
+		if n.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for i, item := range n.Content {
+			removed = append(removed, removeUnknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return removed
+}
+
+// jsonFields maps the lower-cased JSON names of the fields of the struct t,
+// including those promoted from embedded structs, to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			for embeddedName, embeddedType := range jsonFields(fieldType) {
+				if _, exists := fields[embeddedName]; !exists {
+					fields[embeddedName] = embeddedType
+				}
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+	return fields
+}
+
+func joinYAMLPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// decorateJobs sets `decorate: true` on the kubernetes jobs in doc whose name
+// is in names and returns the names of the jobs it changed.
+func decorateJobs(doc *yaml.Node, names sets.String) []string {
+	var fixed []string
+	visit := func(jobs *yaml.Node) {
+		if jobs == nil || jobs.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, job := range jobs.Content {
+			if job.Kind != yaml.MappingNode {
+				continue
+			}
+			name := mappingValue(job, "name")
+			if name == nil || !names.Has(name.Value) {
+				continue
+			}
+			if agent := mappingValue(job, "agent"); agent != nil && agent.Value != string(v1.KubernetesAgent) {
+				continue
+			}
+			setMappingValue(job, "decorate", boolNode(true))
+			fixed = append(fixed, name.Value)
+		}
+	}
+	for _, key := range []string{"presubmits", "postsubmits"} {
+		repos := mappingValue(doc, key)
+		if repos == nil || repos.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(repos.Content); i += 2 {
+			visit(repos.Content[i])
+		}
+	}
+	visit(mappingValue(doc, "periodics"))
+	return fixed
+}
+
+// dropNeedsOkToTestFromLGTMQueries removes the needs-ok-to-test label from the
+// missingLabels of every Tide query that requires the lgtm label, which is
+// the combination validateNeedsOkToTestLabel warns about. It returns the
+// paths of the queries it changed.
+func dropNeedsOkToTestFromLGTMQueries(doc *yaml.Node) []string {
+	queries := mappingValue(mappingValue(doc, "tide"), "queries")
+	if queries == nil || queries.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var fixed []string
+	for i, query := range queries.Content {
+		if query.Kind != yaml.MappingNode || !sequenceContains(mappingValue(query, "labels"), lgtm.LGTMLabel) {
+			continue
+		}
+		missing := mappingValue(query, "missingLabels")
+		if !sequenceContains(missing, labels.NeedsOkToTest) {
+			continue
+		}
+		kept := make([]*yaml.Node, 0, len(missing.Content))
+		for _, label := range missing.Content {
+			if label.Value != labels.NeedsOkToTest {
+				kept = append(kept, label)
+			}
+		}
+		if len(kept) == 0 {
+			deleteMappingKey(query, "missingLabels")
+		} else {
+			missing.Content = kept
+		}
+		fixed = append(fixed, fmt.Sprintf("tide.queries[%d]", i))
+	}
+	return fixed
+}
+
+// disableStrictBranchProtection turns off strict required status checks
+// wherever they conflict with Tide, as reported by validateStrictBranches.
+// Repos that are excluded from Tide but inherited strictness from a fixed
+// org are pinned to strict so their effective policy does not change. The
+// paths of the policies it changed are returned.
+func disableStrictBranchProtection(doc *yaml.Node, c config.ProwConfig) ([]string, error) {
+	if len(c.Tide.Queries) == 0 {
+		return nil, nil
+	}
+	strictBranchConfig, err := strictBranchesConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := newOrgRepoConfig(c.Tide.Queries.OrgExceptionsAndRepos()).intersection(strictBranchConfig)
+	global := policyIsStrict(c.BranchProtection.Policy)
+	if !global && len(conflicts.orgExceptions) == 0 && len(conflicts.repos) == 0 {
+		return nil, nil
+	}
+
+	bp := ensureMapping(doc, "branch-protection")
+	var fixed []string
+	if global {
+		setStrict(bp, false)
+		fixed = append(fixed, "branch-protection")
+	}
+	for _, org := range sets.StringKeySet(conflicts.orgExceptions).List() {
+		excepts := conflicts.orgExceptions[org]
+		orgNode := ensureMapping(ensureMapping(bp, "orgs"), org)
+		setStrict(orgNode, false)
+		fixed = append(fixed, joinYAMLPath("branch-protection.orgs", org))
+		repos := mappingValue(orgNode, "repos")
+		for _, fullName := range excepts.List() {
+			repo := strings.TrimPrefix(fullName, org+"/")
+			if explicitStrict(mappingValue(repos, repo)) == nil {
+				repos = ensureMapping(orgNode, "repos")
+				setStrict(ensureMapping(repos, repo), true)
+			}
+		}
+		if repos == nil || repos.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(repos.Content); i += 2 {
+			if !excepts.Has(org + "/" + repos.Content[i].Value) {
+				fixed = append(fixed, disableStrictBranches(repos.Content[i+1], joinYAMLPath("branch-protection.orgs."+org+".repos", repos.Content[i].Value), false)...)
+			}
+		}
+	}
+	for _, fullName := range conflicts.repos.List() {
+		parts := strings.SplitN(fullName, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		repoNode := ensureMapping(ensureMapping(ensureMapping(ensureMapping(bp, "orgs"), parts[0]), "repos"), parts[1])
+		fixed = append(fixed, disableStrictBranches(repoNode, fmt.Sprintf("branch-protection.orgs.%s.repos.%s", parts[0], parts[1]), true)...)
+	}
+	return fixed, nil
+}
+
+// disableStrictBranches unsets strictness on the repo policy and on all of
+// its branches that enable it. If force is set the repo policy is made
+// explicitly non-strict even if it did not configure strictness itself.
+func disableStrictBranches(repo *yaml.Node, path string, force bool) []string {
+	if repo.Kind != yaml.MappingNode {
+		return nil
+	}
+	var fixed []string
+	if strict := explicitStrict(repo); force || (strict != nil && strict.Value == "true") {
+		setStrict(repo, false)
+		fixed = append(fixed, path)
+	}
+	branches := mappingValue(repo, "branches")
+	if branches == nil || branches.Kind != yaml.MappingNode {
+		return fixed
+	}
+	for i := 0; i+1 < len(branches.Content); i += 2 {
+		if strict := explicitStrict(branches.Content[i+1]); strict != nil && strict.Value == "true" {
+			setStrict(branches.Content[i+1], false)
+			fixed = append(fixed, joinYAMLPath(path+".branches", branches.Content[i].Value))
+		}
+	}
+	return fixed
+}
+
+func explicitStrict(policy *yaml.Node) *yaml.Node {
+	return mappingValue(mappingValue(policy, "required_status_checks"), "strict")
+}
+
+func setStrict(policy *yaml.Node, strict bool) {
+	setMappingValue(ensureMapping(policy, "required_status_checks"), "strict", boolNode(strict))
+}
+
+// mappingValue returns the value for key in the mapping m, or nil if m is
+// not a mapping or has no such key.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue replaces the value for key in the mapping m, appending the
+// key if it is not present yet. Comments on a replaced value are kept.
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			old := m.Content[i+1]
+			value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// ensureMapping returns the mapping stored under key in m, creating it if
+// needed. An explicit null value is replaced by an empty mapping.
+func ensureMapping(m *yaml.Node, key string) *yaml.Node {
+	if value := mappingValue(m, key); value != nil && value.Kind == yaml.MappingNode {
+		return value
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setMappingValue(m, key, value)
+	return value
+}
+
+func deleteMappingKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func sequenceContains(s *yaml.Node, value string) bool {
+	if s == nil || s.Kind != yaml.SequenceNode {
+		return false
+	}
+	for _, item := range s.Content {
+		if item.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func boolNode(b bool) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}
+}
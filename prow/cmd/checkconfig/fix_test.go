@@ -0,0 +1,411 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+	sigyaml "sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/config"
+	configflagutil "k8s.io/test-infra/prow/flagutil/config"
+)
+
+func parseYAMLDocument(t *testing.T, raw string) (*yaml.Node, *yaml.Node) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(raw), &root); err != nil {
+		t.Fatalf("failed to parse yaml: %v", err)
+	}
+	return &root, root.Content[0]
+}
+
+func serializeYAML(t *testing.T, root *yaml.Node) string {
+	var out strings.Builder
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		t.Fatalf("failed to serialize yaml: %v", err)
+	}
+	return out.String()
+}
+
+func TestRemoveUnknownFields(t *testing.T) {
+	testCases := []struct {
+		name            string
+		in              string
+		expectedRemoved []string
+		expected        string
+	}{
+		{
+			name: "known fields are kept",
+			in: `# the deck config
+deck:
+  spyglass:
+    size_limit: 100
+`,
+			expected: `# the deck config
+deck:
+  spyglass:
+    size_limit: 100
+`,
+		},
+		{
+			name: "unknown fields are removed at every level",
+			in: `deck:
+  spyglass:
+    size_limit: 100
+    sizeLimit: 100
+  not_a_field: true
+toplevel: {}
+`,
+			expectedRemoved: []string{"deck.spyglass.sizeLimit", "deck.not_a_field", "toplevel"},
+			expected: `deck:
+  spyglass:
+    size_limit: 100
+`,
+		},
+		{
+			name: "fields of jobs and embedded structs are found",
+			in: `periodics:
+- name: my-job
+  interval: 1h
+  decorate: true # inline JobBase field
+  bogus: value
+`,
+			expectedRemoved: []string{"periodics[0].bogus"},
+			expected: `periodics:
+- name: my-job
+  interval: 1h
+  decorate: true # inline JobBase field
+`,
+		},
+		{
+			name: "keys are matched case-insensitively",
+			in: `Deck:
+  Spyglass:
+    Size_Limit: 100
+`,
+			expected: `Deck:
+  Spyglass:
+    Size_Limit: 100
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, doc := parseYAMLDocument(t, tc.in)
+			removed := removeUnknownFields(doc, reflect.TypeOf(config.Config{}), "")
+			if diff := cmp.Diff(tc.expectedRemoved, removed); diff != "" {
+				t.Errorf("removed fields differ from expected: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expected, serializeYAML(t, root)); diff != "" {
+				t.Errorf("fixed config differs from expected: %s", diff)
+			}
+		})
+	}
+}
+
+func TestDecorateJobs(t *testing.T) {
+	in := `presubmits:
+  org/repo:
+  - name: undecorated
+    spec: {}
+  - name: jenkins
+    agent: jenkins
+  - name: decorated
+    decorate: true
+periodics:
+- name: explicitly-undecorated
+  decorate: false # do not touch
+`
+	expected := `presubmits:
+  org/repo:
+  - name: undecorated
+    spec: {}
+    decorate: true
+  - name: jenkins
+    agent: jenkins
+  - name: decorated
+    decorate: true
+periodics:
+- name: explicitly-undecorated
+  decorate: true # do not touch
+`
+	root, doc := parseYAMLDocument(t, in)
+	fixed := decorateJobs(doc, sets.NewString("undecorated", "jenkins", "explicitly-undecorated"))
+	if diff := cmp.Diff([]string{"undecorated", "explicitly-undecorated"}, fixed); diff != "" {
+		t.Errorf("fixed jobs differ from expected: %s", diff)
+	}
+	if diff := cmp.Diff(expected, serializeYAML(t, root)); diff != "" {
+		t.Errorf("fixed config differs from expected: %s", diff)
+	}
+}
+
+func TestDropNeedsOkToTestFromLGTMQueries(t *testing.T) {
+	in := `tide:
+  queries:
+  - repos: [org/repo]
+    labels: [lgtm]
+    missingLabels: [needs-ok-to-test]
+  - repos: [org/other]
+    labels: [lgtm, approved]
+    missingLabels: [do-not-merge/hold, needs-ok-to-test]
+  - repos: [org/third]
+    missingLabels: [needs-ok-to-test]
+`
+	expected := `tide:
+  queries:
+  - repos: [org/repo]
+    labels: [lgtm]
+  - repos: [org/other]
+    labels: [lgtm, approved]
+    missingLabels: [do-not-merge/hold]
+  - repos: [org/third]
+    missingLabels: [needs-ok-to-test]
+`
+	root, doc := parseYAMLDocument(t, in)
+	fixed := dropNeedsOkToTestFromLGTMQueries(doc)
+	if diff := cmp.Diff([]string{"tide.queries[0]", "tide.queries[1]"}, fixed); diff != "" {
+		t.Errorf("fixed queries differ from expected: %s", diff)
+	}
+	if diff := cmp.Diff(expected, serializeYAML(t, root)); diff != "" {
+		t.Errorf("fixed config differs from expected: %s", diff)
+	}
+}
+
+func TestDisableStrictBranchProtection(t *testing.T) {
+	testCases := []struct {
+		name          string
+		in            string
+		expectedFixed []string
+		expected      string
+	}{
+		{
+			name: "no conflicts, nothing to do",
+			in: `tide:
+  queries:
+  - repos: [org/repo]
+branch-protection:
+  protect: true
+  orgs:
+    other:
+      required_status_checks:
+        strict: true
+`,
+			expected: `tide:
+  queries:
+  - repos: [org/repo]
+branch-protection:
+  protect: true
+  orgs:
+    other:
+      required_status_checks:
+        strict: true
+`,
+		},
+		{
+			name: "global strictness is disabled",
+			in: `tide:
+  queries:
+  - repos: [org/repo]
+branch-protection:
+  protect: true
+  required_status_checks:
+    contexts: [ci]
+    strict: true # strict everywhere
+`,
+			expectedFixed: []string{"branch-protection"},
+			expected: `tide:
+  queries:
+  - repos: [org/repo]
+branch-protection:
+  protect: true
+  required_status_checks:
+    contexts: [ci]
+    strict: false # strict everywhere
+`,
+		},
+		{
+			name: "strict org is fixed, excluded repo keeps its strictness",
+			in: `tide:
+  queries:
+  - orgs: [org]
+    excludedRepos: [org/excluded]
+branch-protection:
+  protect: true
+  orgs:
+    org:
+      required_status_checks:
+        strict: true
+      repos:
+        repo:
+          branches:
+            main:
+              required_status_checks:
+                strict: true
+`,
+			expectedFixed: []string{"branch-protection.orgs.org", "branch-protection.orgs.org.repos.repo.branches.main"},
+			expected: `tide:
+  queries:
+  - orgs: [org]
+    excludedRepos: [org/excluded]
+branch-protection:
+  protect: true
+  orgs:
+    org:
+      required_status_checks:
+        strict: false
+      repos:
+        repo:
+          branches:
+            main:
+              required_status_checks:
+                strict: false
+        excluded:
+          required_status_checks:
+            strict: true
+`,
+		},
+		{
+			name: "repo that inherits strictness from its org gets an explicit override",
+			in: `tide:
+  queries:
+  - repos: [org/repo]
+branch-protection:
+  protect: true
+  orgs:
+    org:
+      required_status_checks:
+        strict: true
+`,
+			expectedFixed: []string{"branch-protection.orgs.org.repos.repo"},
+			expected: `tide:
+  queries:
+  - repos: [org/repo]
+branch-protection:
+  protect: true
+  orgs:
+    org:
+      required_status_checks:
+        strict: true
+      repos:
+        repo:
+          required_status_checks:
+            strict: false
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg config.ProwConfig
+			if err := sigyaml.Unmarshal([]byte(tc.in), &cfg); err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			root, doc := parseYAMLDocument(t, tc.in)
+			fixed, err := disableStrictBranchProtection(doc, cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expectedFixed, fixed); diff != "" {
+				t.Errorf("fixed policies differ from expected: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expected, serializeYAML(t, root)); diff != "" {
+				t.Errorf("fixed config differs from expected: %s", diff)
+			}
+			if len(tc.expectedFixed) > 0 {
+				var fixedCfg config.ProwConfig
+				if err := sigyaml.Unmarshal([]byte(serializeYAML(t, root)), &fixedCfg); err != nil {
+					t.Fatalf("failed to load fixed config: %v", err)
+				}
+				if err := validateStrictBranches(fixedCfg); err != nil {
+					t.Errorf("fixed config still fails validation: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestFix(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	jobConfigDir := filepath.Join(dir, "jobs")
+	jobConfigPath := filepath.Join(jobConfigDir, "org", "repo.yaml")
+	prowConfig := `# Prow config
+tide:
+  queries:
+  - repos: [org/repo]
+    labels: [lgtm]
+    missingLabels: [needs-ok-to-test] # this should go
+unknown: field
+`
+	jobConfig := `presubmits:
+  org/repo:
+  - name: unit
+    always_run: true # runs the unit tests
+    spec:
+      containers:
+      - image: golang
+`
+	if err := os.MkdirAll(filepath.Dir(jobConfigPath), 0755); err != nil {
+		t.Fatalf("failed to create job config dir: %v", err)
+	}
+	for path, content := range map[string]string{configPath: prowConfig, jobConfigPath: jobConfig} {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	o := options{config: configflagutil.ConfigOptions{ConfigPath: configPath, JobConfigPath: jobConfigDir}}
+	if err := fix(o); err != nil {
+		t.Fatalf("fix failed: %v", err)
+	}
+
+	expectedProwConfig := `# Prow config
+tide:
+  queries:
+  - repos: [org/repo]
+    labels: [lgtm]
+`
+	expectedJobConfig := `presubmits:
+  org/repo:
+  - name: unit
+    always_run: true # runs the unit tests
+    spec:
+      containers:
+      - image: golang
+    decorate: true
+`
+	for path, expected := range map[string]string{configPath: expectedProwConfig, jobConfigPath: expectedJobConfig} {
+		actual, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		if diff := cmp.Diff(expected, string(actual)); diff != "" {
+			t.Errorf("%s differs from expected: %s", path, diff)
+		}
+	}
+}
@@ -76,6 +76,7 @@ type options struct {
 	excludeWarnings flagutil.Strings
 	strict          bool
 	expensive       bool
+	fix             bool
 
 	github  flagutil.GitHubOptions
 	storage flagutil.StorageClientOptions
@@ -201,6 +202,7 @@ func (o *options) gatherOptions(flag *flag.FlagSet, args []string) error {
 	flag.Var(&o.excludeWarnings, "exclude-warning", "Warnings to exclude. Use repeatedly to provide a list of warnings to exclude")
 	flag.BoolVar(&o.expensive, "expensive-checks", false, "If set, additional expensive warnings will be enabled")
 	flag.BoolVar(&o.strict, "strict", false, "If set, consider all warnings as errors.")
+	flag.BoolVar(&o.fix, "fix", false, fmt.Sprintf("If set, rewrite the config files in place to resolve the enabled warnings that have a mechanical fix (%s) before validating. Comments and key ordering are preserved.", strings.Join(fixableWarnings, ", ")))
 	o.github.AddCustomizedFlags(flag, throttlerDefaults)
 	o.github.AllowAnonymous = true
 	o.config.AddFlags(flag)
@@ -223,6 +225,12 @@ func main() {
 		logrus.Fatalf("Error parsing options - %v", err)
 	}
 
+	if o.fix {
+		if err := fix(o); err != nil {
+			logrus.WithError(err).Fatal("Fixing config failed")
+		}
+	}
+
 	if err := validate(o); err != nil {
 		switch e := err.(type) {
 		case utilerrors.Aggregate:
@@ -237,8 +245,9 @@ func main() {
 
 }
 
-func validate(o options) error {
-	// use all warnings by default
+// setDefaultWarnings enables the default warnings, or all warnings if
+// expensive checks are requested, when none were explicitly selected.
+func (o *options) setDefaultWarnings() {
 	if len(o.warnings.Strings()) == 0 {
 		if o.expensive {
 			o.warnings = flagutil.NewStrings(getAllWarnings()...)
@@ -246,6 +255,11 @@ func validate(o options) error {
 			o.warnings = flagutil.NewStrings(defaultWarnings...)
 		}
 	}
+}
+
+func validate(o options) error {
+	// use all warnings by default
+	o.setDefaultWarnings()
 	if o.github.AppID != "" && o.github.AppPrivateKeyPath != "" {
 		o.warnings.Set(validateGitHubAppInstallationWarning)
 	}
@@ -848,6 +862,13 @@ func ensureValidConfiguration(plugin, label, verb string, tideSubSet, tideSuperS
 }
 
 func validateDecoratedJobs(cfg *config.Config) error {
+	if jobs := nonDecoratedJobs(cfg); len(jobs) > 0 {
+		return fmt.Errorf("the following jobs use the kubernetes provider but do not use the pod utilities: %v", jobs)
+	}
+	return nil
+}
+
+func nonDecoratedJobs(cfg *config.Config) []string {
 	var nonDecoratedJobs []string
 	for _, presubmit := range cfg.AllStaticPresubmits([]string{}) {
 		if presubmit.Agent == string(v1.KubernetesAgent) && !*presubmit.JobBase.UtilityConfig.Decorate {
@@ -867,10 +888,7 @@ func validateDecoratedJobs(cfg *config.Config) error {
 		}
 	}
 
-	if len(nonDecoratedJobs) > 0 {
-		return fmt.Errorf("the following jobs use the kubernetes provider but do not use the pod utilities: %v", nonDecoratedJobs)
-	}
-	return nil
+	return nonDecoratedJobs
 }
 
 func validateDecorationConfig(cfg *config.Config) error {
@@ -34,7 +34,9 @@ import (
 	k8sgcsreporter "k8s.io/test-infra/prow/crier/reporters/gcs/kubernetes"
 	gerritreporter "k8s.io/test-infra/prow/crier/reporters/gerrit"
 	githubreporter "k8s.io/test-infra/prow/crier/reporters/github"
+	gitlabreporter "k8s.io/test-infra/prow/crier/reporters/gitlab"
 	pubsubreporter "k8s.io/test-infra/prow/crier/reporters/pubsub"
+	retestreporter "k8s.io/test-infra/prow/crier/reporters/retest"
 	slackreporter "k8s.io/test-infra/prow/crier/reporters/slack"
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
 	configflagutil "k8s.io/test-infra/prow/flagutil/config"
@@ -58,17 +60,21 @@ type options struct {
 	gerritWorkers         int
 	pubsubWorkers         int
 	githubWorkers         int
+	gitlabWorkers         int
 	slackWorkers          int
 	gcsWorkers            int
 	k8sGCSWorkers         int
 	blobStorageWorkers    int
 	k8sBlobStorageWorkers int
+	autoRetestWorkers     int
 
 	slackTokenFile            string
 	additionalSlackTokenFiles slackclient.HostsFlag
 
 	storage prowflagutil.StorageClientOptions
 
+	gitlab prowflagutil.GitLabOptions
+
 	instrumentationOptions prowflagutil.InstrumentationOptions
 
 	k8sReportFraction float64
@@ -86,7 +92,7 @@ func (o *options) validate() error {
 		o.gerritWorkers = 1
 	}
 
-	if o.gerritWorkers+o.pubsubWorkers+o.githubWorkers+o.slackWorkers+o.gcsWorkers+o.k8sGCSWorkers+o.blobStorageWorkers+o.k8sBlobStorageWorkers <= 0 {
+	if o.gerritWorkers+o.pubsubWorkers+o.githubWorkers+o.slackWorkers+o.gcsWorkers+o.k8sGCSWorkers+o.blobStorageWorkers+o.k8sBlobStorageWorkers+o.autoRetestWorkers+o.gitlabWorkers <= 0 {
 		return errors.New("crier need to have at least one report worker to start")
 	}
 
@@ -104,12 +110,21 @@ func (o *options) validate() error {
 		}
 	}
 
-	if o.githubWorkers > 0 {
+	if o.githubWorkers > 0 || o.autoRetestWorkers > 0 {
 		if err := o.github.Validate(o.dryrun); err != nil {
 			return err
 		}
 	}
 
+	if o.gitlabWorkers > 0 {
+		if !o.gitlab.Enabled() {
+			return errors.New("--gitlab-endpoint must be set with --gitlab-workers")
+		}
+		if err := o.gitlab.Validate(o.dryrun); err != nil {
+			return err
+		}
+	}
+
 	if o.slackWorkers > 0 {
 		if o.slackTokenFile == "" && len(o.additionalSlackTokenFiles) == 0 {
 			return errors.New("one of --slack-token-file or --additional-slack-token-files must be set")
@@ -153,12 +168,14 @@ func (o *options) parseArgs(fs *flag.FlagSet, args []string) error {
 	fs.IntVar(&o.gerritWorkers, "gerrit-workers", 0, "Number of gerrit report workers (0 means disabled)")
 	fs.IntVar(&o.pubsubWorkers, "pubsub-workers", 0, "Number of pubsub report workers (0 means disabled)")
 	fs.IntVar(&o.githubWorkers, "github-workers", 0, "Number of github report workers (0 means disabled)")
+	fs.IntVar(&o.gitlabWorkers, "gitlab-workers", 0, "Number of workers setting GitLab commit statuses for the repos listed in the gitlab section of the Prow config (0 means disabled)")
 	fs.IntVar(&o.slackWorkers, "slack-workers", 0, "Number of Slack report workers (0 means disabled)")
 	fs.Var(&o.additionalSlackTokenFiles, "additional-slack-token-files", "Map of additional slack token files. example: --additional-slack-token-files=foo=/etc/foo-slack-tokens/token, repeat flag for each host")
 	fs.IntVar(&o.gcsWorkers, "gcs-workers", 0, "Number of GCS report workers (0 means disabled)")
 	fs.IntVar(&o.k8sGCSWorkers, "kubernetes-gcs-workers", 0, "Number of Kubernetes-specific GCS report workers (0 means disabled)")
 	fs.IntVar(&o.blobStorageWorkers, "blob-storage-workers", 0, "Number of blob storage report workers (0 means disabled)")
 	fs.IntVar(&o.k8sBlobStorageWorkers, "kubernetes-blob-storage-workers", 0, "Number of Kubernetes-specific blob storage report workers (0 means disabled)")
+	fs.IntVar(&o.autoRetestWorkers, "auto-retest-workers", 0, "Number of workers retesting presubmits that failed because of flaky tests, configured by auto_retest in the Prow config (0 means disabled)")
 	fs.Float64Var(&o.k8sReportFraction, "kubernetes-report-fraction", 1.0, "Approximate portion of jobs to report pod information for, if kubernetes-gcs-workers are enabled (0 - > none, 1.0 -> all)")
 	fs.StringVar(&o.slackTokenFile, "slack-token-file", "", "Path to a Slack token file")
 	fs.StringVar(&o.reportAgent, "report-agent", "", "Only report specified agent - empty means report to all agents (effective for github and Slack only)")
@@ -170,6 +187,7 @@ func (o *options) parseArgs(fs *flag.FlagSet, args []string) error {
 	o.github.AddFlags(fs)
 	o.client.AddFlags(fs)
 	o.storage.AddFlags(fs)
+	o.gitlab.AddFlags(fs)
 	o.instrumentationOptions.AddFlags(fs)
 	o.githubEnablement.AddFlags(fs)
 
@@ -290,6 +308,22 @@ func main() {
 		}
 	}
 
+	if o.gitlabWorkers > 0 {
+		if err := secret.Add(o.gitlab.TokenPath); err != nil {
+			logrus.WithError(err).Fatal("Error reading GitLab credentials")
+		}
+
+		gitlabClient, err := o.gitlab.GitLabClient()
+		if err != nil {
+			logrus.WithError(err).Fatal("Error getting GitLab client.")
+		}
+
+		hasReporter = true
+		if err := crier.New(mgr, gitlabreporter.NewReporter(gitlabClient, cfg), o.gitlabWorkers, o.githubEnablement.EnablementChecker()); err != nil {
+			logrus.WithError(err).Fatal("failed to construct gitlab reporter controller")
+		}
+	}
+
 	if o.blobStorageWorkers > 0 || o.k8sBlobStorageWorkers > 0 {
 		opener, err := io.NewOpener(context.Background(), o.storage.GCSCredentialsFile, o.storage.S3CredentialsFile)
 		if err != nil {
@@ -314,6 +348,29 @@ func main() {
 		}
 	}
 
+	if o.autoRetestWorkers > 0 {
+		if o.github.TokenPath != "" {
+			if err := secret.Add(o.github.TokenPath); err != nil {
+				logrus.WithError(err).Fatal("Error reading GitHub credentials")
+			}
+		}
+
+		githubClient, err := o.github.GitHubClient(o.dryrun)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error getting GitHub client.")
+		}
+
+		opener, err := io.NewOpener(context.Background(), o.storage.GCSCredentialsFile, o.storage.S3CredentialsFile)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error creating opener")
+		}
+
+		hasReporter = true
+		if err := crier.New(mgr, retestreporter.New(cfg, opener, githubClient, mgr.GetClient(), o.dryrun), o.autoRetestWorkers, o.githubEnablement.EnablementChecker()); err != nil {
+			logrus.WithError(err).Fatal("failed to construct auto-retest reporter controller")
+		}
+	}
+
 	if !hasReporter {
 		logrus.Fatalf("should have at least one controller to start crier.")
 	}
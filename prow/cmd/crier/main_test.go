@@ -199,6 +199,15 @@ func TestOptions(t *testing.T) {
 			name: "k8s-gcs with negative report fraction rejects",
 			args: []string{"--kubernetes-gcs-workers=3", "--config-path=foo", "--kubernetes-report-fraction=-1.2"},
 		},
+		//GitLab Reporter
+		{
+			name: "gitlab missing --gitlab-endpoint, rejects",
+			args: []string{"--gitlab-workers=2", "--gitlab-token-path=/etc/gitlab/token", "--config-path=foo"},
+		},
+		{
+			name: "gitlab missing --gitlab-token-path, rejects",
+			args: []string{"--gitlab-workers=2", "--gitlab-endpoint=https://gitlab.example.com", "--config-path=foo"},
+		},
 	}
 
 	for _, tc := range cases {
@@ -24,10 +24,10 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"sort"
 	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -43,8 +43,23 @@ import (
 	"k8s.io/test-infra/prow/ghhook"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/logrusutil"
+	"k8s.io/test-infra/prow/metrics"
 )
 
+// hmacTokens provides the 'hmac_tokens' gauge that counts the tokens in the
+// hmac secret by rotation phase. It is pushed whenever the secret is written,
+// as the tool runs as a job.
+var hmacTokens = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "hmac_tokens",
+	Help: "Number of webhook HMAC tokens in the secret by rotation phase.",
+}, []string{"state"})
+
+var tokenMetrics = prometheus.NewRegistry()
+
+func init() {
+	tokenMetrics.MustRegister(hmacTokens)
+}
+
 type options struct {
 	config configflagutil.ConfigOptions
 
@@ -57,6 +72,9 @@ type options struct {
 	hmacTokenSecretNamespace string
 	hmacTokenSecretName      string
 	hmacTokenKey             string
+
+	propagationDelay time.Duration
+	gracePeriod      time.Duration
 }
 
 func (o *options) validate() error {
@@ -78,6 +96,12 @@ func (o *options) validate() error {
 	if o.hmacTokenKey == "" {
 		return errors.New("required flag --hmac-token-key was unset")
 	}
+	if o.propagationDelay < 0 {
+		return errors.New("--propagation-delay must not be negative")
+	}
+	if o.gracePeriod < 0 {
+		return errors.New("--grace-period must not be negative")
+	}
 
 	return nil
 }
@@ -96,6 +120,8 @@ func gatherOptions(fs *flag.FlagSet, args ...string) options {
 	fs.StringVar(&o.hmacTokenSecretNamespace, "hmac-token-secret-namespace", "default", "Name of the namespace on the cluster where the hmac-token secret is in.")
 	fs.StringVar(&o.hmacTokenSecretName, "hmac-token-secret-name", "", "Name of the secret on the cluster containing the GitHub HMAC secret.")
 	fs.StringVar(&o.hmacTokenKey, "hmac-token-key", "", "Key of the hmac token in the secret.")
+	fs.DurationVar(&o.propagationDelay, "propagation-delay", time.Minute, "How long it takes for an update of the hmac secret to reach hook. Webhooks are only switched to a new token once it is that old.")
+	fs.DurationVar(&o.gracePeriod, "grace-period", 24*time.Hour, "How long a token is still accepted after the webhook was switched to a new one.")
 	fs.Parse(args)
 	return o
 }
@@ -108,9 +134,11 @@ type client struct {
 
 	currentHMACMap map[string]github.HMACsForRepo
 	newHMACConfig  config.ManagedWebhooks
+	// pushGateway is the endpoint the token metrics are pushed to, if set.
+	pushGateway string
 
+	// hmacMapForBatchUpdate has the tokens generated by this run.
 	hmacMapForBatchUpdate map[string]string
-	hmacMapForRecovery    map[string]github.HMACsForRepo
 }
 
 func main() {
@@ -165,8 +193,8 @@ func main() {
 
 		currentHMACMap:        currentHMACMap,
 		newHMACConfig:         newHMACConfig,
+		pushGateway:           configAgent.Config().PushGateway.Endpoint,
 		hmacMapForBatchUpdate: map[string]string{},
-		hmacMapForRecovery:    map[string]github.HMACsForRepo{},
 	}
 
 	if err := c.handleInvitation(); err != nil {
@@ -263,8 +291,13 @@ func (c *client) handleConfigUpdate() error {
 		return fmt.Errorf("error handling hmac update for removed repos: %w", err)
 	}
 
-	// Generate new hmac token for required repos, do batch update for the hmac token secret,
-	// and then iteratively update the webhook for each repo.
+	// Tokens are rotated in phases that are recorded in the secret, so that a
+	// run that fails half way is resumed by the next one:
+	// 1. Generate a new token for the required repos and add it to the secret as
+	//    pending, so that hook accepts both the current and the new token.
+	// 2. Once hook had time to pick up the new token, switch the webhook to it.
+	//    The token becomes active and the previous ones are retiring.
+	// 3. Once the grace period is over, the retiring tokens expire and are removed.
 	if err := c.handleAddedRepo(repoAdded); err != nil {
 		return fmt.Errorf("error handling hmac update for new repos: %w", err)
 	}
@@ -275,13 +308,14 @@ func (c *client) handleConfigUpdate() error {
 	if err := c.updateHMACTokenSecret(); err != nil {
 		return fmt.Errorf("error updating hmac tokens: %w", err)
 	}
-	// HACK: waiting for the hmac k8s secret update to propagate to the pods that are using the secret,
-	// so that components like hook can start respecting the new hmac values.
-	time.Sleep(20 * time.Second)
-	errs := c.batchOnboardNewTokenForRepos()
+	if len(c.hmacMapForBatchUpdate) > 0 && !c.options.dryRun {
+		logrus.WithField("delay", c.options.propagationDelay.String()).Info("Waiting for the new hmac tokens to propagate to hook.")
+		time.Sleep(c.options.propagationDelay)
+	}
+	errs := c.batchOnboardNewTokenForRepos(time.Now())
 
 	// Do necessary cleanups after the token and webhook updates are done.
-	if err := c.cleanup(); err != nil {
+	if err := c.cleanup(time.Now()); err != nil {
 		errs = append(errs, fmt.Errorf("error cleaning up %w", err))
 	}
 
@@ -368,22 +402,29 @@ func (c *client) addRepoToBatchUpdate(repo string) error {
 
 	updatedTokenList := github.HMACsForRepo{}
 	// Copy over all existing tokens for that repo, if it's already been configured.
+	// They stay valid until the webhook is switched to the new token, so nothing
+	// needs to be recovered if that fails.
 	if val, ok := c.currentHMACMap[repo]; ok {
 		updatedTokenList = append(updatedTokenList, val...)
-		// Back up the hmacs for the current repo, which we can use for recovery in case an error happens in updating the webhook.
-		c.hmacMapForRecovery[repo] = c.currentHMACMap[repo]
 		// Current webhook is possibly using global token so we need to promote that token to repo level, if it exists.
 	} else if globalTokens, ok := c.currentHMACMap["*"]; ok {
 		updatedTokenList = append(updatedTokenList, github.HMACToken{
 			Value: globalTokens[0].Value,
-			// Set CreatedAt as a time slightly before the TokenCreatedAfter time, so that the token can be properly pruned in the end.
+			// Set CreatedAt as a time slightly before the TokenCreatedAfter time, so that the token is not mistaken for a rotated one.
 			CreatedAt: c.newHMACConfig.OrgRepoConfig[repo].TokenCreatedAfter.Add(-time.Second),
+			State:     github.HMACTokenActive,
 		})
 	}
 
+	now := time.Now()
 	updatedTokenList = append(updatedTokenList, github.HMACToken{
-		Value: generatedToken, CreatedAt: time.Now()})
+		Value:          generatedToken,
+		CreatedAt:      now,
+		State:          github.HMACTokenPending,
+		StateChangedAt: &now,
+	})
 	c.currentHMACMap[repo] = updatedTokenList
+	logrus.WithField("repo", repo).Info("Added a pending hmac token.")
 	c.hmacMapForBatchUpdate[repo] = generatedToken
 
 	return nil
@@ -409,27 +450,73 @@ func (c *client) onboardNewTokenForRepo(repo, generatedToken string) error {
 	return o.HandleWebhookConfigChange()
 }
 
-func (c *client) batchOnboardNewTokenForRepos() []error {
+// batchOnboardNewTokenForRepos switches the webhooks to the pending tokens that
+// hook had time to pick up, including the ones left pending by a previous run.
+func (c *client) batchOnboardNewTokenForRepos(now time.Time) []error {
 	var errs []error
-	for repo, generatedToken := range c.hmacMapForBatchUpdate {
-		if err := c.onboardNewTokenForRepo(repo, generatedToken); err != nil {
-			errs = append(errs, err)
-			logrus.WithError(err).Errorf("Error updating the webhook, will revert the hmacs for %q", repo)
-			if hmacs, exist := c.hmacMapForRecovery[repo]; exist {
-				c.currentHMACMap[repo] = hmacs
-			} else {
-				delete(c.currentHMACMap, repo)
+	for repo, tokens := range c.currentHMACMap {
+		pending := -1
+		for i, token := range tokens {
+			if token.State == github.HMACTokenPending && (pending == -1 || token.CreatedAt.After(tokens[pending].CreatedAt)) {
+				pending = i
 			}
 		}
+		if pending == -1 {
+			continue
+		}
+		log := logrus.WithField("repo", repo)
+		if changedAt := tokens[pending].StateChangedAt; changedAt != nil && now.Sub(*changedAt) < c.options.propagationDelay {
+			log.Info("The pending hmac token may not have reached hook yet, the webhook will be switched to it by the next run.")
+			continue
+		}
+		if err := c.onboardNewTokenForRepo(repo, tokens[pending].Value); err != nil {
+			errs = append(errs, err)
+			log.WithError(err).Error("Error updating the webhook, the hmac token stays pending and the current ones remain valid.")
+			continue
+		}
+		c.activateToken(repo, pending, now)
 	}
 	return errs
 }
 
+// activateToken records that the webhook uses the token at the given index,
+// and starts the grace period of the tokens it replaces.
+func (c *client) activateToken(repo string, index int, now time.Time) {
+	expiresAt := now.Add(c.options.gracePeriod)
+	tokens := append(github.HMACsForRepo(nil), c.currentHMACMap[repo]...)
+	for i := range tokens {
+		switch {
+		case i == index:
+			tokens[i].State = github.HMACTokenActive
+		case tokens[i].State == github.HMACTokenRetiring:
+			continue
+		default:
+			// Pending tokens may have been used by a switch that didn't get
+			// recorded, so they retire like active ones.
+			tokens[i].State = github.HMACTokenRetiring
+			tokens[i].ExpiresAt = &expiresAt
+		}
+		tokens[i].StateChangedAt = &now
+	}
+	c.currentHMACMap[repo] = tokens
+	logrus.WithFields(logrus.Fields{"repo": repo, "expires-at": expiresAt}).Info("Switched the webhook to the new hmac token, the previous ones are retiring.")
+}
+
 // cleanup will do necessary cleanups after the token and webhook updates are done.
-func (c *client) cleanup() error {
-	// Prune old tokens from current config.
+func (c *client) cleanup(now time.Time) error {
+	// Remove expired tokens from current config.
+	var nextExpiry *time.Time
 	for repoName := range c.currentHMACMap {
-		c.pruneOldTokens(repoName)
+		c.pruneOldTokens(repoName, now)
+		for _, token := range c.currentHMACMap[repoName] {
+			if token.ExpiresAt != nil && (nextExpiry == nil || token.ExpiresAt.Before(*nextExpiry)) {
+				nextExpiry = token.ExpiresAt
+			}
+		}
+	}
+	if nextExpiry != nil {
+		// Hook rejects expired tokens on its own, but only a run removes them.
+		logrus.WithField("expires-at", *nextExpiry).Info("Retiring hmac tokens are left in the secret, a run after they expire removes them.")
 	}
 	// Update the secret.
 	if err := c.updateHMACTokenSecret(); err != nil {
@@ -456,22 +543,51 @@ func (c *client) updateHMACTokenSecret() error {
 	if _, err = c.kubernetesClient.CoreV1().Secrets(c.options.hmacTokenSecretNamespace).Update(context.TODO(), sec, metav1.UpdateOptions{}); err != nil {
 		return fmt.Errorf("error updating the secret: %w", err)
 	}
+	c.reportTokens(time.Now())
 	return nil
 }
 
-// pruneOldTokens removes all but most recent token from token config.
-func (c *client) pruneOldTokens(repo string) {
+// reportTokens pushes the number of tokens in the secret by rotation phase.
+func (c *client) reportTokens(now time.Time) {
+	countTokens(c.currentHMACMap, now)
+	if c.pushGateway == "" {
+		logrus.Debug("No push gateway is configured, the hmac token metrics are not pushed.")
+		return
+	}
+	if err := metrics.PushMetrics("hmac", c.pushGateway, tokenMetrics); err != nil {
+		logrus.WithError(err).Warn("Failed to push the hmac token metrics.")
+	}
+}
+
+// countTokens updates the gauge of tokens by rotation phase.
+func countTokens(hmacMap map[string]github.HMACsForRepo, now time.Time) {
+	counts := map[github.HMACTokenState]float64{github.HMACTokenPending: 0, github.HMACTokenActive: 0, github.HMACTokenRetiring: 0, github.HMACTokenExpired: 0}
+	for _, tokens := range hmacMap {
+		for _, token := range tokens {
+			counts[token.StateAt(now)]++
+		}
+	}
+	for state, count := range counts {
+		hmacTokens.WithLabelValues(string(state)).Set(count)
+	}
+}
+
+// pruneOldTokens removes the tokens whose grace period is over from token config.
+func (c *client) pruneOldTokens(repo string, now time.Time) {
 	tokens := c.currentHMACMap[repo]
-	if len(tokens) <= 1 {
-		logrus.WithField("repo", repo).Debugf("Token size is %d, no need to prune", len(tokens))
+	var kept github.HMACsForRepo
+	for _, token := range tokens {
+		if token.StateAt(now) != github.HMACTokenExpired {
+			kept = append(kept, token)
+		}
+	}
+	if len(kept) == len(tokens) {
+		logrus.WithField("repo", repo).Debugf("None of the %d tokens expired, no need to prune", len(tokens))
 		return
 	}
 
-	logrus.WithField("repo", repo).Debugf("Token size is %d, prune to 1", len(tokens))
-	sort.SliceStable(tokens, func(i, j int) bool {
-		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
-	})
-	c.currentHMACMap[repo] = tokens[:1]
+	logrus.WithField("repo", repo).Infof("Pruning %d expired tokens", len(tokens)-len(kept))
+	c.currentHMACMap[repo] = kept
 }
 
 // generateNewHMACToken generates a hex encoded crypto random string of length 40.
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"k8s.io/test-infra/prow/cmd/hmac/fakeghhook"
@@ -82,6 +83,8 @@ func TestGatherOptions(t *testing.T) {
 				hmacTokenSecretNamespace: "default",
 				hmacTokenSecretName:      "hmac-token",
 				hmacTokenKey:             "hmac",
+				propagationDelay:         time.Minute,
+				gracePeriod:              24 * time.Hour,
 			}
 			if tc.expected != nil {
 				tc.expected(expected)
@@ -126,6 +129,9 @@ func TestPruneOldTokens(t *testing.T) {
 	time1, _ := time.Parse(time.RFC3339, "2020-01-05T19:07:08+00:00")
 	time2, _ := time.Parse(time.RFC3339, "2020-02-05T19:07:08+00:00")
 	time3, _ := time.Parse(time.RFC3339, "2020-03-05T19:07:08+00:00")
+	now := time3.Add(time.Hour)
+	expired := now.Add(-time.Minute)
+	notExpired := now.Add(time.Minute)
 
 	cases := []struct {
 		name     string
@@ -134,35 +140,47 @@ func TestPruneOldTokens(t *testing.T) {
 		expected map[string]github.HMACsForRepo
 	}{
 		{
-			name: "three hmacs, only the latest one is left after pruning",
+			name: "three hmacs, the expired one is pruned",
 			current: map[string]github.HMACsForRepo{
 				"org1/repo1": []github.HMACToken{
 					{
 						Value:     "rand-val1",
 						CreatedAt: time1,
+						State:     github.HMACTokenRetiring,
+						ExpiresAt: &expired,
 					},
 					{
 						Value:     "rand-val2",
 						CreatedAt: time2,
+						State:     github.HMACTokenRetiring,
+						ExpiresAt: &notExpired,
 					},
 					{
 						Value:     "rand-val3",
 						CreatedAt: time3,
+						State:     github.HMACTokenActive,
 					},
 				},
 			},
 			repo: "org1/repo1",
 			expected: map[string]github.HMACsForRepo{
 				"org1/repo1": []github.HMACToken{
+					{
+						Value:     "rand-val2",
+						CreatedAt: time2,
+						State:     github.HMACTokenRetiring,
+						ExpiresAt: &notExpired,
+					},
 					{
 						Value:     "rand-val3",
 						CreatedAt: time3,
+						State:     github.HMACTokenActive,
 					},
 				},
 			},
 		},
 		{
-			name: "two hmacs, only the latest one is left after pruning",
+			name: "tokens without a state are never pruned",
 			current: map[string]github.HMACsForRepo{
 				"org1/repo1": []github.HMACToken{
 					{
@@ -172,15 +190,21 @@ func TestPruneOldTokens(t *testing.T) {
 					{
 						Value:     "rand-val2",
 						CreatedAt: time2,
+						State:     github.HMACTokenPending,
 					},
 				},
 			},
 			repo: "org1/repo1",
 			expected: map[string]github.HMACsForRepo{
 				"org1/repo1": []github.HMACToken{
+					{
+						Value:     "rand-val1",
+						CreatedAt: time1,
+					},
 					{
 						Value:     "rand-val2",
 						CreatedAt: time2,
+						State:     github.HMACTokenPending,
 					},
 				},
 			},
@@ -210,7 +234,7 @@ func TestPruneOldTokens(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			c := &client{currentHMACMap: tc.current}
-			c.pruneOldTokens(tc.repo)
+			c.pruneOldTokens(tc.repo, now)
 			if !reflect.DeepEqual(tc.expected, c.currentHMACMap) {
 				t.Errorf("%#v != expected %#v", c.currentHMACMap, tc.expected)
 			}
@@ -218,6 +242,31 @@ func TestPruneOldTokens(t *testing.T) {
 	}
 }
 
+func TestCountTokens(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	notExpired := now.Add(time.Minute)
+	countTokens(map[string]github.HMACsForRepo{
+		"*": {{Value: "legacy"}},
+		"org1/repo1": {
+			{Value: "rand-val1", State: github.HMACTokenRetiring, ExpiresAt: &expired},
+			{Value: "rand-val2", State: github.HMACTokenRetiring, ExpiresAt: &notExpired},
+			{Value: "rand-val3", State: github.HMACTokenActive},
+			{Value: "rand-val4", State: github.HMACTokenPending},
+		},
+	}, now)
+	for state, expected := range map[github.HMACTokenState]float64{
+		github.HMACTokenPending:  1,
+		github.HMACTokenActive:   2,
+		github.HMACTokenRetiring: 1,
+		github.HMACTokenExpired:  1,
+	} {
+		if got := testutil.ToFloat64(hmacTokens.WithLabelValues(string(state))); got != expected {
+			t.Errorf("expected %v %s tokens, got %v", expected, state, got)
+		}
+	}
+}
+
 func TestGenerateNewHMACToken(t *testing.T) {
 	token1, err := generateNewHMACToken()
 	if err != nil {
@@ -438,7 +487,6 @@ func TestHandleRotatedRepo(t *testing.T) {
 		currentHMACMapForBatchUpdate map[string]string
 		expectedHMACsSize            map[string]int
 		expectedReposForBatchUpdate  []string
-		expectedHMACMapForRecovery   map[string]github.HMACsForRepo
 	}{
 		{
 			name: "test a repo that needs its hmac to be rotated, and global token does not exist",
@@ -453,10 +501,6 @@ func TestHandleRotatedRepo(t *testing.T) {
 			currentHMACMapForBatchUpdate: map[string]string{"whatever-repo": "whatever-token"},
 			expectedHMACsSize:            map[string]int{"repo1": 3, "repo2": 3},
 			expectedReposForBatchUpdate:  []string{"repo1", "repo2"},
-			expectedHMACMapForRecovery: map[string]github.HMACsForRepo{
-				"repo1": commonTokens,
-				"repo2": commonTokens,
-			},
 		},
 		{
 			name: "test a repo that needs its hmac to be rotated, and global token exists",
@@ -472,10 +516,6 @@ func TestHandleRotatedRepo(t *testing.T) {
 			currentHMACMapForBatchUpdate: map[string]string{"whatever-repo": "whatever-token"},
 			expectedHMACsSize:            map[string]int{"repo1": 3, "repo2": 3},
 			expectedReposForBatchUpdate:  []string{"repo1", "repo2"},
-			expectedHMACMapForRecovery: map[string]github.HMACsForRepo{
-				"repo1": commonTokens,
-				"repo2": commonTokens,
-			},
 		},
 		{
 			name: "test a repo that does not need its hmac to be rotated",
@@ -500,14 +540,6 @@ func TestHandleRotatedRepo(t *testing.T) {
 			currentHMACMapForBatchUpdate: map[string]string{"whatever-repo": "whatever-token"},
 			expectedHMACsSize:            map[string]int{"repo1": 2, "repo2": 1},
 			expectedReposForBatchUpdate:  []string{"repo1"},
-			expectedHMACMapForRecovery: map[string]github.HMACsForRepo{
-				"repo1": []github.HMACToken{
-					{
-						Value:     "rand-val1",
-						CreatedAt: pastTime.Add(-1 * time.Hour),
-					},
-				},
-			},
 		},
 	}
 
@@ -516,7 +548,6 @@ func TestHandleRotatedRepo(t *testing.T) {
 			c := &client{
 				currentHMACMap:        tc.currentHMACs,
 				hmacMapForBatchUpdate: tc.currentHMACMapForBatchUpdate,
-				hmacMapForRecovery:    map[string]github.HMACsForRepo{},
 			}
 			if err := c.handledRotatedRepo(tc.toRotate); err != nil {
 				t.Errorf("unexpected error: %v", err)
@@ -532,9 +563,15 @@ func TestHandleRotatedRepo(t *testing.T) {
 				if _, ok := c.hmacMapForBatchUpdate[repo]; !ok {
 					t.Errorf("repo %q is expected to be added to the batch update map, but not", repo)
 				}
-			}
-			if !reflect.DeepEqual(tc.expectedHMACMapForRecovery, c.hmacMapForRecovery) {
-				t.Errorf("The hmacMapForRecovery %#v != expected %#v", c.hmacMapForRecovery, tc.expectedHMACMapForRecovery)
+				tokens := c.currentHMACMap[repo]
+				if newToken := tokens[len(tokens)-1]; newToken.State != github.HMACTokenPending || newToken.Value != c.hmacMapForBatchUpdate[repo] {
+					t.Errorf("repo %q is expected to have the new token pending, got %#v", repo, newToken)
+				}
+				for _, token := range tokens[:len(tokens)-1] {
+					if token.State == github.HMACTokenPending {
+						t.Errorf("repo %q is expected to keep its current tokens as they are, got %#v", repo, token)
+					}
+				}
 			}
 		})
 	}
@@ -569,32 +606,33 @@ func TestBatchOnboardNewTokenForRepos(t *testing.T) {
 	}
 
 	cases := []struct {
-		name                  string
-		hmacMapForBatchUpdate map[string]string
-		currentOrgHooks       map[string][]github.Hook
-		currentRepoHooks      map[string][]github.Hook
-		expectedOrgHooks      map[string][]github.Hook
-		expectedRepoHooks     map[string][]github.Hook
+		name              string
+		pendingTokens     map[string]string
+		propagationDelay  time.Duration
+		currentOrgHooks   map[string][]github.Hook
+		currentRepoHooks  map[string][]github.Hook
+		expectedOrgHooks  map[string][]github.Hook
+		expectedRepoHooks map[string][]github.Hook
 	}{
 		{
-			name:                  "add hook for one repo",
-			hmacMapForBatchUpdate: map[string]string{"org/repo1": secretBeforeUpdate},
-			currentRepoHooks:      map[string][]github.Hook{},
+			name:             "add hook for one repo",
+			pendingTokens:    map[string]string{"org/repo1": secretBeforeUpdate},
+			currentRepoHooks: map[string][]github.Hook{},
 			expectedRepoHooks: map[string][]github.Hook{
 				"org/repo1": {hookBeforeUpdate},
 			},
 		},
 		{
-			name:                  "add hook for one org",
-			hmacMapForBatchUpdate: map[string]string{"org1": secretBeforeUpdate},
-			currentOrgHooks:       map[string][]github.Hook{},
+			name:            "add hook for one org",
+			pendingTokens:   map[string]string{"org1": secretBeforeUpdate},
+			currentOrgHooks: map[string][]github.Hook{},
 			expectedOrgHooks: map[string][]github.Hook{
 				"org1": {hookBeforeUpdate},
 			},
 		},
 		{
-			name:                  "update hook for one org",
-			hmacMapForBatchUpdate: map[string]string{"org1": secretAfterUpdate},
+			name:          "update hook for one org",
+			pendingTokens: map[string]string{"org1": secretAfterUpdate},
 			currentOrgHooks: map[string][]github.Hook{
 				"org1": {hookBeforeUpdate},
 			},
@@ -603,8 +641,8 @@ func TestBatchOnboardNewTokenForRepos(t *testing.T) {
 			},
 		},
 		{
-			name:                  "update hook for one repo",
-			hmacMapForBatchUpdate: map[string]string{"org/repo1": secretAfterUpdate},
+			name:          "update hook for one repo",
+			pendingTokens: map[string]string{"org/repo1": secretAfterUpdate},
 			currentRepoHooks: map[string][]github.Hook{
 				"org/repo1": {hookBeforeUpdate},
 			},
@@ -613,9 +651,9 @@ func TestBatchOnboardNewTokenForRepos(t *testing.T) {
 			},
 		},
 		{
-			name:                  "add hook for one org, and update hook for one repo",
-			hmacMapForBatchUpdate: map[string]string{"org1": secretAfterUpdate, "org2/repo": secretAfterUpdate},
-			currentOrgHooks:       map[string][]github.Hook{},
+			name:            "add hook for one org, and update hook for one repo",
+			pendingTokens:   map[string]string{"org1": secretAfterUpdate, "org2/repo": secretAfterUpdate},
+			currentOrgHooks: map[string][]github.Hook{},
 			expectedOrgHooks: map[string][]github.Hook{
 				"org1": {hookAfterUpdate},
 			},
@@ -626,6 +664,17 @@ func TestBatchOnboardNewTokenForRepos(t *testing.T) {
 				"org2/repo": {hookAfterUpdate},
 			},
 		},
+		{
+			name:             "pending token that may not have reached hook yet is not used",
+			pendingTokens:    map[string]string{"org/repo1": secretAfterUpdate},
+			propagationDelay: 2 * time.Hour,
+			currentRepoHooks: map[string][]github.Hook{
+				"org/repo1": {hookBeforeUpdate},
+			},
+			expectedRepoHooks: map[string][]github.Hook{
+				"org/repo1": {hookBeforeUpdate},
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -634,14 +683,38 @@ func TestBatchOnboardNewTokenForRepos(t *testing.T) {
 				OrgHooks:  tc.currentOrgHooks,
 				RepoHooks: tc.currentRepoHooks,
 			}
+			now := time.Now()
+			addedAt := now.Add(-time.Hour)
+			currentHMACMap := map[string]github.HMACsForRepo{}
+			for repo, token := range tc.pendingTokens {
+				currentHMACMap[repo] = github.HMACsForRepo{
+					{Value: "old", CreatedAt: addedAt.Add(-time.Hour)},
+					{Value: token, CreatedAt: addedAt, State: github.HMACTokenPending, StateChangedAt: &addedAt},
+				}
+			}
 			c := &client{
-				githubHookClient:      fakeclient,
-				hmacMapForBatchUpdate: tc.hmacMapForBatchUpdate,
-				options:               options{hookUrl: "http://whatever-hook-url"},
+				githubHookClient: fakeclient,
+				currentHMACMap:   currentHMACMap,
+				options:          options{hookUrl: "http://whatever-hook-url", propagationDelay: tc.propagationDelay, gracePeriod: time.Hour},
 			}
-			if err := c.batchOnboardNewTokenForRepos(); err != nil {
+			if err := c.batchOnboardNewTokenForRepos(now); err != nil {
 				t.Errorf("unexpected error: %v", err)
 			}
+			for repo := range tc.pendingTokens {
+				tokens := c.currentHMACMap[repo]
+				if tc.propagationDelay > now.Sub(addedAt) {
+					if tokens[0].State != "" || tokens[1].State != github.HMACTokenPending {
+						t.Errorf("repo %q is expected to keep its tokens as they are, got %#v", repo, tokens)
+					}
+					continue
+				}
+				if tokens[0].State != github.HMACTokenRetiring || tokens[0].ExpiresAt == nil || !tokens[0].ExpiresAt.Equal(now.Add(time.Hour)) {
+					t.Errorf("repo %q is expected to have the old token retiring for an hour, got %#v", repo, tokens[0])
+				}
+				if tokens[1].State != github.HMACTokenActive || tokens[1].ExpiresAt != nil {
+					t.Errorf("repo %q is expected to have the new token active, got %#v", repo, tokens[1])
+				}
+			}
 			if !reflect.DeepEqual(fakeclient.OrgHooks, tc.expectedOrgHooks) {
 				t.Errorf("org hooks %#v != expected %#v", fakeclient.OrgHooks, tc.expectedOrgHooks)
 			}
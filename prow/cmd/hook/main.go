@@ -17,10 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -64,18 +67,45 @@ type options struct {
 	bugzilla               prowflagutil.BugzillaOptions
 	instrumentationOptions prowflagutil.InstrumentationOptions
 	jira                   prowflagutil.JiraOptions
-
-	webhookSecretFile string
-	slackTokenFile    string
+	storage                prowflagutil.StorageClientOptions
+	gitlab                 prowflagutil.GitLabOptions
+
+	webhookSecretFile       string
+	gitlabWebhookSecretFile string
+	slackTokenFile          string
+
+	journalPath    string
+	journalLease   time.Duration
+	journalMaxAge  time.Duration
+	adminPort      int
+	handlerRetries int
+	handlerBackoff time.Duration
 }
 
 func (o *options) Validate() error {
-	for _, group := range []flagutil.OptionGroup{&o.kubernetes, &o.github, &o.bugzilla, &o.jira, &o.githubEnablement, &o.config, &o.pluginsConfig} {
+	for _, group := range []flagutil.OptionGroup{&o.kubernetes, &o.github, &o.bugzilla, &o.jira, &o.githubEnablement, &o.config, &o.pluginsConfig, &o.storage, &o.gitlab} {
 		if err := group.Validate(o.dryRun); err != nil {
 			return err
 		}
 	}
 
+	if o.gitlab.Enabled() && o.gitlabWebhookSecretFile == "" {
+		return errors.New("--gitlab-webhook-secret-file is required with --gitlab-endpoint")
+	}
+
+	if o.adminPort != 0 && o.journalPath == "" {
+		return errors.New("--admin-port requires --webhook-journal-path")
+	}
+	if o.journalLease < 0 {
+		return errors.New("--webhook-journal-lease must not be negative")
+	}
+	if o.journalMaxAge < 0 {
+		return errors.New("--webhook-journal-max-age must not be negative")
+	}
+	if o.handlerRetries < 0 {
+		return errors.New("--plugin-retries must not be negative")
+	}
+
 	return nil
 }
 
@@ -86,12 +116,19 @@ func gatherOptions(fs *flag.FlagSet, args ...string) options {
 	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Uses API tokens but does not mutate.")
 	fs.DurationVar(&o.gracePeriod, "grace-period", 180*time.Second, "On shutdown, try to handle remaining events for the specified duration. ")
 	o.pluginsConfig.PluginConfigPathDefault = "/etc/plugins/plugins.yaml"
-	for _, group := range []flagutil.OptionGroup{&o.kubernetes, &o.github, &o.bugzilla, &o.instrumentationOptions, &o.jira, &o.githubEnablement, &o.config, &o.pluginsConfig} {
+	for _, group := range []flagutil.OptionGroup{&o.kubernetes, &o.github, &o.bugzilla, &o.instrumentationOptions, &o.jira, &o.githubEnablement, &o.config, &o.pluginsConfig, &o.storage, &o.gitlab} {
 		group.AddFlags(fs)
 	}
 
 	fs.StringVar(&o.webhookSecretFile, "hmac-secret-file", "/etc/webhook/hmac", "Path to the file containing the GitHub HMAC secret.")
+	fs.StringVar(&o.gitlabWebhookSecretFile, "gitlab-webhook-secret-file", "", "Path to the file containing the secret token of the GitLab webhooks, required with --gitlab-endpoint.")
 	fs.StringVar(&o.slackTokenFile, "slack-token-file", "", "Path to the file containing the Slack token to use.")
+	fs.StringVar(&o.journalPath, "webhook-journal-path", "", "Local directory or blob storage path, like gs://bucket/hook-journal, to journal webhook deliveries to until their handlers succeed. Interrupted deliveries are replayed on startup. Disabled if empty.")
+	fs.DurationVar(&o.journalLease, "webhook-journal-lease", 10*time.Minute, "How long journaled deliveries belong to the replica handling them. Any replica, the same one after a restart included, replays them once it expired, so it must exceed the time plugin handlers take, retries included. Set to 0 with a single replica to replay them on startup.")
+	fs.DurationVar(&o.journalMaxAge, "webhook-journal-max-age", 7*24*time.Hour, "How long to keep failed deliveries in the journal for a replay. Kept until they are replayed if 0.")
+	fs.IntVar(&o.adminPort, "admin-port", 0, "Port to serve the webhook journal admin endpoints on, to list and replay failed deliveries. Must not be exposed publicly. Disabled if 0.")
+	fs.IntVar(&o.handlerRetries, "plugin-retries", 0, "Number of times to retry a failed plugin handler.")
+	fs.DurationVar(&o.handlerBackoff, "plugin-retry-backoff", time.Second, "Time to wait before the first retry of a failed plugin handler, doubled with each retry.")
 	fs.Parse(args)
 	return o
 }
@@ -129,6 +166,10 @@ func main() {
 		tokens = append(tokens, o.bugzilla.ApiKeyPath)
 	}
 
+	if o.gitlab.Enabled() {
+		tokens = append(tokens, o.gitlab.TokenPath, o.gitlabWebhookSecretFile)
+	}
+
 	if err := secret.Add(tokens...); err != nil {
 		logrus.WithError(err).Fatal("Error starting secrets agent.")
 	}
@@ -197,6 +238,9 @@ func main() {
 	mdYAMLEnabled := func(org, repo string) bool {
 		return pluginAgent.Config().MDYAMLEnabled(org, repo)
 	}
+	codeOwnersEnabled := func(org, repo string) bool {
+		return pluginAgent.Config().CodeOwnersEnabled(org, repo)
+	}
 	skipCollaborators := func(org, repo string) bool {
 		return pluginAgent.Config().SkipCollaborators(org, repo)
 	}
@@ -221,7 +265,12 @@ func main() {
 	resolver := func(org, repo string) ownersconfig.Filenames {
 		return pluginAgent.Config().OwnersFilenames(org, repo)
 	}
-	ownersClient := repoowners.NewClient(git.ClientFactoryFrom(gitClient), githubClient, mdYAMLEnabled, skipCollaborators, ownersDirDenylist, resolver)
+	ownersClient := repoowners.NewClient(git.ClientFactoryFrom(gitClient), githubClient, mdYAMLEnabled, codeOwnersEnabled, skipCollaborators, ownersDirDenylist, resolver)
+
+	opener, err := o.storage.StorageClient(context.Background())
+	if err != nil {
+		logrus.WithError(err).Fatal("Error creating opener.")
+	}
 
 	clientAgent := &plugins.ClientAgent{
 		GitHubClient:              githubClient,
@@ -233,6 +282,8 @@ func main() {
 		OwnersClient:              ownersClient,
 		BugzillaClient:            bugzillaClient,
 		JiraClient:                jiraClient,
+		StorageClient:             opener,
+		ReviewTracker:             plugins.NewReviewTracker(),
 	}
 
 	promMetrics := githubeventserver.NewMetrics()
@@ -250,6 +301,63 @@ func main() {
 		Metrics:        promMetrics,
 		RepoEnabled:    o.githubEnablement.EnablementChecker(),
 		TokenGenerator: secret.GetTokenGenerator(o.webhookSecretFile),
+		HandlerRetries: o.handlerRetries,
+		HandlerBackoff: o.handlerBackoff,
+	}
+	if o.journalPath != "" {
+		server.Journal, err = hook.NewJournal(o.journalPath, opener)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error creating webhook journal.")
+		}
+		server.Journal.Lease, server.Journal.MaxAge = o.journalLease, o.journalMaxAge
+		maintainJournal(server, o.journalLease, "Failed to replay interrupted webhook deliveries.")
+	}
+
+	// GitLab webhooks are translated to GitHub events and handled by a
+	// separate server whose clients talk to GitLab.
+	var gitlabServer *hook.GitLabServer
+	if o.gitlab.Enabled() {
+		gitlabClient, err := o.gitlab.GitLabClient()
+		if err != nil {
+			logrus.WithError(err).Fatal("Error getting GitLab client.")
+		}
+		gitlabGitClient, err := o.gitlab.GitClientFactory()
+		if err != nil {
+			logrus.WithError(err).Fatal("Error getting GitLab git client.")
+		}
+		gitlabGitHubClient := hook.NewGitLabGitHubClient(gitlabClient)
+		gitlabClientAgent := *clientAgent
+		gitlabClientAgent.GitHubClient = gitlabGitHubClient
+		gitlabClientAgent.GitClient = gitlabGitClient
+		gitlabClientAgent.OwnersClient = repoowners.NewClient(gitlabGitClient, gitlabGitHubClient, mdYAMLEnabled, codeOwnersEnabled, skipCollaborators, ownersDirDenylist, resolver)
+		gitlabServer = &hook.GitLabServer{
+			Server: &hook.Server{
+				ClientAgent:      &gitlabClientAgent,
+				ConfigAgent:      configAgent,
+				Plugins:          pluginAgent,
+				Metrics:          promMetrics,
+				RepoEnabled:      o.githubEnablement.EnablementChecker(),
+				SupportedPlugins: hook.GitLabPlugins,
+				TokenGenerator:   secret.GetTokenGenerator(o.gitlabWebhookSecretFile),
+				HandlerRetries:   o.handlerRetries,
+				HandlerBackoff:   o.handlerBackoff,
+			},
+			Client: gitlabClient,
+		}
+		if server.Journal != nil {
+			gitlabServer.Journal, err = hook.NewJournal(strings.TrimSuffix(o.journalPath, "/")+"/gitlab", opener)
+			if err != nil {
+				logrus.WithError(err).Fatal("Error creating GitLab webhook journal.")
+			}
+			gitlabServer.Journal.Lease, gitlabServer.Journal.MaxAge = o.journalLease, o.journalMaxAge
+			maintainJournal(gitlabServer.Server, o.journalLease, "Failed to replay interrupted GitLab webhook deliveries.")
+		}
+		interrupts.OnInterrupt(func() {
+			gitlabServer.GracefulShutdown()
+			if err := gitlabGitClient.Clean(); err != nil {
+				logrus.WithError(err).Error("Could not clean up GitLab git client cache.")
+			}
+		})
 	}
 	interrupts.OnInterrupt(func() {
 		server.GracefulShutdown()
@@ -266,12 +374,45 @@ func main() {
 
 	// For /hook, handle a webhook normally.
 	http.Handle("/hook", server)
+	// For /hook/gitlab, handle a GitLab webhook.
+	if gitlabServer != nil {
+		http.Handle("/hook/gitlab", gitlabServer)
+	}
 	// Serve plugin help information from /plugin-help.
 	http.Handle("/plugin-help", pluginhelp.NewHelpAgent(pluginAgent, githubClient))
 
 	httpServer := &http.Server{Addr: ":" + strconv.Itoa(o.port)}
 
+	if o.adminPort != 0 {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/", server.AdminHandler())
+		// The journal of GitLab deliveries is served under /gitlab.
+		if gitlabServer != nil {
+			adminMux.Handle("/gitlab/", http.StripPrefix("/gitlab", gitlabServer.AdminHandler()))
+		}
+		adminServer := &http.Server{Addr: ":" + strconv.Itoa(o.adminPort), Handler: adminMux}
+		interrupts.ListenAndServe(adminServer, o.gracePeriod)
+	}
+
 	health.ServeReady()
 
 	interrupts.ListenAndServe(httpServer, o.gracePeriod)
 }
+
+// maintainJournal replays the interrupted deliveries of the journal on
+// startup and whenever their lease may have expired, and prunes the old
+// failed deliveries.
+func maintainJournal(server *hook.Server, lease time.Duration, message string) {
+	interval := lease
+	if interval == 0 {
+		interval = time.Hour
+	}
+	interrupts.TickLiteral(func() {
+		if err := server.ReplayPending(context.Background()); err != nil {
+			logrus.WithError(err).Error(message)
+		}
+		if err := server.Journal.Prune(context.Background()); err != nil {
+			logrus.WithError(err).Error("Failed to prune the webhook journal.")
+		}
+	}, interval)
+}
@@ -77,6 +77,57 @@ func Test_gatherOptions(t *testing.T) {
 				o.pluginsConfig.PluginConfigPath = "/random/value"
 			},
 		},
+		{
+			name: "webhook journal with admin port",
+			args: map[string]string{
+				"--webhook-journal-path": "/var/lib/hook",
+				"--admin-port":           "8889",
+				"--plugin-retries":       "3",
+			},
+			expected: func(o *options) {
+				o.journalPath = "/var/lib/hook"
+				o.adminPort = 8889
+				o.handlerRetries = 3
+			},
+		},
+		{
+			name: "webhook journal lease must not be negative",
+			args: map[string]string{
+				"--webhook-journal-path":  "/var/lib/hook",
+				"--webhook-journal-lease": "-1m",
+			},
+			err: true,
+		},
+		{
+			name: "admin port requires the webhook journal",
+			args: map[string]string{
+				"--admin-port": "8889",
+			},
+			err: true,
+		},
+		{
+			name: "negative plugin retries are rejected",
+			args: map[string]string{
+				"--plugin-retries": "-1",
+			},
+			err: true,
+		},
+		{
+			name: "gitlab requires the webhook secret",
+			args: map[string]string{
+				"--gitlab-endpoint":   "https://gitlab.example.com",
+				"--gitlab-token-path": "/etc/gitlab/token",
+			},
+			err: true,
+		},
+		{
+			name: "gitlab requires a token",
+			args: map[string]string{
+				"--gitlab-endpoint":            "https://gitlab.example.com",
+				"--gitlab-webhook-secret-file": "/etc/gitlab/webhook",
+			},
+			err: true,
+		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -96,6 +147,9 @@ func Test_gatherOptions(t *testing.T) {
 				dryRun:                 true,
 				gracePeriod:            180 * time.Second,
 				webhookSecretFile:      "/etc/webhook/hmac",
+				journalLease:           10 * time.Minute,
+				journalMaxAge:          7 * 24 * time.Hour,
+				handlerBackoff:         time.Second,
 				instrumentationOptions: flagutil.DefaultInstrumentationOptions(),
 			}
 			expectedfs := flag.NewFlagSet("fake-flags", flag.PanicOnError)
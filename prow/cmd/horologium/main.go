@@ -36,6 +36,8 @@ import (
 	"k8s.io/test-infra/prow/flagutil"
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
 	configflagutil "k8s.io/test-infra/prow/flagutil/config"
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/interrupts"
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/metrics"
@@ -50,6 +52,7 @@ type options struct {
 	config configflagutil.ConfigOptions
 
 	kubernetes             flagutil.KubernetesOptions
+	github                 flagutil.GitHubOptions
 	instrumentationOptions prowflagutil.InstrumentationOptions
 	dryRun                 bool
 }
@@ -60,6 +63,8 @@ func gatherOptions(fs *flag.FlagSet, args ...string) options {
 	fs.BoolVar(&o.dryRun, "dry-run", true, "Whether or not to make mutating API calls to Kubernetes.")
 	o.config.AddFlags(fs)
 	o.kubernetes.AddFlags(fs)
+	o.github.AddFlags(fs)
+	o.github.AllowAnonymous = true
 	o.instrumentationOptions.AddFlags(fs)
 
 	fs.Parse(args)
@@ -75,6 +80,10 @@ func (o *options) Validate() error {
 		return errors.New("--config-path is required")
 	}
 
+	if err := o.github.Validate(o.dryRun); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -121,6 +130,10 @@ func main() {
 		logrus.Fatal("Timed out waiting for cachesync")
 	}
 
+	// In-repo periodics are looked up once a repo is configured, so that
+	// horologium does not need GitHub credentials otherwise.
+	var inRepo *inRepoPeriodics
+
 	// start a cron
 	cr := cron.New()
 	cr.Start()
@@ -133,26 +146,121 @@ func main() {
 	}
 	interrupts.TickLiteral(func() {
 		start := time.Now()
-		if err := sync(cluster.GetClient(), configAgent.Config(), cr, start); err != nil {
+		cfg := configAgent.Config()
+		periodics := cfg.AllPeriodics()
+		if inRepo == nil && len(cfg.InRepoConfig.PeriodicsRepos) > 0 {
+			var err error
+			if inRepo, err = o.inRepoPeriodics(); err != nil {
+				logrus.WithError(err).Error("Error setting up the lookup of in-repo periodics.")
+			}
+		}
+		if inRepo != nil {
+			periodics = append(periodics, inRepo.get(cfg)...)
+		}
+		if err := sync(cluster.GetClient(), cfg, periodics, cr, start); err != nil {
 			logrus.WithError(err).Error("Error syncing periodic jobs.")
 		}
 		logrus.WithField("duration", time.Since(start)).Info("Synced periodic jobs")
 	}, tickInterval)
 }
 
+// inRepoPeriodics sets up the clients that in-repo periodics are looked up with.
+func (o *options) inRepoPeriodics() (*inRepoPeriodics, error) {
+	githubClient, err := o.github.GitHubClient(o.dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("error getting GitHub client: %w", err)
+	}
+	var gitClientFactory git.ClientFactory
+	if o.config.InRepoConfigCacheURL == "" {
+		gitClient, err := o.github.GitClient(o.dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("error getting Git client: %w", err)
+		}
+		interrupts.OnInterrupt(func() {
+			if err := gitClient.Clean(); err != nil {
+				logrus.WithError(err).Error("Could not clean up git client cache.")
+			}
+		})
+		gitClientFactory = config.NewInRepoConfigGitCache(git.ClientFactoryFrom(gitClient))
+	}
+	return newInRepoPeriodics(githubClient, gitClientFactory), nil
+}
+
 type cronClient interface {
-	SyncConfig(cfg *config.Config) error
+	SyncPeriodics(periodics []config.Periodic) error
 	QueuedJobs() []string
 }
 
-func sync(prowJobClient ctrlruntimeclient.Client, cfg *config.Config, cr cronClient, now time.Time) error {
+type githubClient interface {
+	GetRepo(owner, name string) (github.FullRepo, error)
+	GetRef(org, repo, ref string) (string, error)
+}
+
+// inRepoPeriodics loads the periodics declared in the in-repo config of the
+// repositories in in_repo_config.periodics_repos.
+type inRepoPeriodics struct {
+	ghc githubClient
+	gc  git.ClientFactory
+	// lastKnown holds the last periodics successfully loaded per repo, so that
+	// a transient failure does not unschedule them.
+	lastKnown map[string][]config.Periodic
+}
+
+func newInRepoPeriodics(ghc githubClient, gc git.ClientFactory) *inRepoPeriodics {
+	return &inRepoPeriodics{ghc: ghc, gc: gc, lastKnown: map[string][]config.Periodic{}}
+}
+
+// get returns the in-repo periodics from the head of the default branch of
+// every configured repository. Periodics whose name is already taken are
+// skipped, as horologium identifies periodics by name.
+func (i *inRepoPeriodics) get(cfg *config.Config) []config.Periodic {
+	names := sets.NewString()
+	for _, p := range cfg.Periodics {
+		names.Insert(p.Name)
+	}
+
+	var periodics []config.Periodic
+	for _, identifier := range cfg.InRepoConfig.PeriodicsRepos {
+		log := logrus.WithField("repo", identifier)
+		loaded, err := i.load(cfg, identifier)
+		if err != nil {
+			log.WithError(err).Error("Failed to load in-repo periodics, using the last known ones.")
+			loaded = i.lastKnown[identifier]
+		} else {
+			i.lastKnown[identifier] = loaded
+		}
+		for _, p := range loaded {
+			if names.Has(p.Name) {
+				log.WithField("job", p.Name).Warn("Ignoring in-repo periodic with a name that is already in use.")
+				continue
+			}
+			names.Insert(p.Name)
+			periodics = append(periodics, p)
+		}
+	}
+	return periodics
+}
+
+func (i *inRepoPeriodics) load(cfg *config.Config, identifier string) ([]config.Periodic, error) {
+	orgRepo := config.NewOrgRepo(identifier)
+	repo, err := i.ghc.GetRepo(orgRepo.Org, orgRepo.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repo: %w", err)
+	}
+	baseSHAGetter := func() (string, error) {
+		return i.ghc.GetRef(orgRepo.Org, orgRepo.Repo, "heads/"+repo.DefaultBranch)
+	}
+	return cfg.GetPeriodics(i.gc, identifier, repo.DefaultBranch, baseSHAGetter)
+}
+
+func sync(prowJobClient ctrlruntimeclient.Client, cfg *config.Config, periodics []config.Periodic, cr cronClient, now time.Time) error {
 	jobs := &prowapi.ProwJobList{}
 	if err := prowJobClient.List(context.TODO(), jobs, ctrlruntimeclient.InNamespace(cfg.ProwJobNamespace)); err != nil {
 		return fmt.Errorf("error listing prow jobs: %w", err)
 	}
 	latestJobs := pjutil.GetLatestProwJobs(jobs.Items, prowapi.PeriodicJob)
 
-	if err := cr.SyncConfig(cfg); err != nil {
+	if err := cr.SyncPeriodics(periodics); err != nil {
 		logrus.WithError(err).Error("Error syncing cron jobs.")
 	}
 
@@ -162,7 +270,7 @@ func sync(prowJobClient ctrlruntimeclient.Client, cfg *config.Config, cr cronCli
 	}
 
 	var errs []error
-	for _, p := range cfg.Periodics {
+	for _, p := range periodics {
 		j, previousFound := latestJobs[p.Name]
 		logger := logrus.WithFields(logrus.Fields{
 			"job":            p.Name,
@@ -18,11 +18,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -33,14 +36,16 @@ import (
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/flagutil"
 	configflagutil "k8s.io/test-infra/prow/flagutil/config"
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
 )
 
 type fakeCron struct {
 	jobs []string
 }
 
-func (fc *fakeCron) SyncConfig(cfg *config.Config) error {
-	for _, p := range cfg.Periodics {
+func (fc *fakeCron) SyncPeriodics(periodics []config.Periodic) error {
+	for _, p := range periodics {
 		if p.Cron != "" {
 			fc.jobs = append(fc.jobs, p.Name)
 		}
@@ -141,7 +146,7 @@ func TestSync(t *testing.T) {
 		}
 		fakeProwJobClient := &createTrackingClient{Client: fakectrlruntimeclient.NewFakeClient(jobs...)}
 		fc := &fakeCron{}
-		if err := sync(fakeProwJobClient, &cfg, fc, now); err != nil {
+		if err := sync(fakeProwJobClient, &cfg, cfg.Periodics, fc, now); err != nil {
 			t.Fatalf("For case %s, didn't expect error: %v", tc.testName, err)
 		}
 
@@ -217,7 +222,7 @@ func TestSyncCron(t *testing.T) {
 		}
 		fakeProwJobClient := &createTrackingClient{Client: fakectrlruntimeclient.NewFakeClient(jobs...)}
 		fc := &fakeCron{}
-		if err := sync(fakeProwJobClient, &cfg, fc, now); err != nil {
+		if err := sync(fakeProwJobClient, &cfg, cfg.Periodics, fc, now); err != nil {
 			t.Fatalf("For case %s, didn't expect error: %v", tc.testName, err)
 		}
 
@@ -274,6 +279,13 @@ func TestFlags(t *testing.T) {
 		},
 	}
 
+	var defaultGitHubOptions flagutil.GitHubOptions
+	defaultGitHubOptions.AddFlags(flag.NewFlagSet("", flag.ContinueOnError))
+	defaultGitHubOptions.AllowAnonymous = true
+	if err := defaultGitHubOptions.Validate(true); err != nil {
+		t.Fatalf("failed to validate default GitHub options: %v", err)
+	}
+
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			expected := &options{
@@ -284,6 +296,7 @@ func TestFlags(t *testing.T) {
 					SupplementalProwConfigsFileNameSuffix: "_prowconfig.yaml",
 				},
 				dryRun:                 true,
+				github:                 defaultGitHubOptions,
 				instrumentationOptions: flagutil.DefaultInstrumentationOptions(),
 			}
 			if tc.expected != nil {
@@ -329,3 +342,62 @@ func (ct *createTrackingClient) Create(ctx context.Context, obj ctrlruntimeclien
 	ct.sawCreate = true
 	return ct.Client.Create(ctx, obj, opts...)
 }
+
+type fakeGitHubClient struct {
+	failing sets.String
+}
+
+func (f *fakeGitHubClient) GetRepo(owner, name string) (github.FullRepo, error) {
+	if f.failing.Has(owner + "/" + name) {
+		return github.FullRepo{}, errors.New("injected error")
+	}
+	return github.FullRepo{Repo: github.Repo{DefaultBranch: "main"}}, nil
+}
+
+func (f *fakeGitHubClient) GetRef(org, repo, ref string) (string, error) {
+	return org + "/" + repo + "@" + ref, nil
+}
+
+func TestInRepoPeriodics(t *testing.T) {
+	enabled := true
+	cfg := &config.Config{
+		ProwConfig: config.ProwConfig{InRepoConfig: config.InRepoConfig{
+			Enabled:        map[string]*bool{"*": &enabled},
+			PeriodicsRepos: []string{"org/repo", "org/other"},
+		}},
+		JobConfig: config.JobConfig{
+			Periodics: []config.Periodic{{JobBase: config.JobBase{Name: "static"}}},
+			ProwYAMLGetter: func(_ *config.Config, _ git.ClientFactory, identifier, baseSHA string, _ ...string) (*config.ProwYAML, error) {
+				if baseSHA != identifier+"@heads/main" {
+					return nil, fmt.Errorf("unexpected base SHA %q", baseSHA)
+				}
+				return &config.ProwYAML{Periodics: []config.Periodic{
+					{JobBase: config.JobBase{Name: "static"}},
+					{JobBase: config.JobBase{Name: "shared"}},
+					{JobBase: config.JobBase{Name: identifier}},
+				}}, nil
+			},
+		},
+	}
+	ghc := &fakeGitHubClient{failing: sets.NewString()}
+	inRepo := newInRepoPeriodics(ghc, nil)
+
+	names := func(periodics []config.Periodic) []string {
+		var names []string
+		for _, p := range periodics {
+			names = append(names, fmt.Sprintf("%s:%s", p.Name, p.ExtraRefs[0].BaseRef))
+		}
+		return names
+	}
+
+	expected := []string{"shared:main", "org/repo:main", "org/other:main"}
+	if diff := cmp.Diff(expected, names(inRepo.get(cfg))); diff != "" {
+		t.Errorf("in-repo periodics differ from expected: %s", diff)
+	}
+
+	// The last known periodics are kept when loading fails.
+	ghc.failing.Insert("org/other")
+	if diff := cmp.Diff(expected, names(inRepo.get(cfg))); diff != "" {
+		t.Errorf("in-repo periodics differ from expected after failure: %s", diff)
+	}
+}
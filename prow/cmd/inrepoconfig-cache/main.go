@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// inrepoconfig-cache serves the in-repo configs of repositories over HTTP, so
+// that prow components don't each need to keep their own git checkouts.
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/pkg/flagutil"
+	"k8s.io/test-infra/prow/config"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	configflagutil "k8s.io/test-infra/prow/flagutil/config"
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/interrupts"
+	"k8s.io/test-infra/prow/logrusutil"
+	"k8s.io/test-infra/prow/metrics"
+	"k8s.io/test-infra/prow/pjutil"
+	"k8s.io/test-infra/prow/pjutil/pprof"
+)
+
+type options struct {
+	port        int
+	cacheSize   int
+	dryRun      bool
+	gracePeriod time.Duration
+
+	config                 configflagutil.ConfigOptions
+	github                 prowflagutil.GitHubOptions
+	instrumentationOptions prowflagutil.InstrumentationOptions
+}
+
+func gatherOptions(fs *flag.FlagSet, args ...string) options {
+	var o options
+	fs.IntVar(&o.port, "port", 8888, "Port to listen on.")
+	fs.IntVar(&o.cacheSize, "cache-size", 1000, "Maximum number of in-repo configs to keep in memory.")
+	fs.BoolVar(&o.dryRun, "dry-run", true, "Whether or not to make mutating API calls to GitHub.")
+	fs.DurationVar(&o.gracePeriod, "grace-period", 180*time.Second, "On shutdown, try to handle remaining requests for the specified duration.")
+	for _, group := range []flagutil.OptionGroup{&o.config, &o.github, &o.instrumentationOptions} {
+		group.AddFlags(fs)
+	}
+	fs.Parse(args)
+	return o
+}
+
+func (o *options) Validate() error {
+	if o.cacheSize <= 0 {
+		return errors.New("--cache-size must be positive")
+	}
+	for _, group := range []flagutil.OptionGroup{&o.config, &o.github, &o.instrumentationOptions} {
+		if err := group.Validate(o.dryRun); err != nil {
+			return err
+		}
+	}
+	if o.config.InRepoConfigCacheURL != "" {
+		return errors.New("--in-repo-config-cache-url must not be set for the in-repo config cache itself")
+	}
+	return nil
+}
+
+func main() {
+	logrusutil.ComponentInit()
+
+	o := gatherOptions(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:]...)
+	if err := o.Validate(); err != nil {
+		logrus.WithError(err).Fatal("Invalid options")
+	}
+
+	defer interrupts.WaitForGracefulShutdown()
+
+	pprof.Instrument(o.instrumentationOptions)
+	health := pjutil.NewHealthOnPort(o.instrumentationOptions.HealthPort)
+
+	configAgent, err := o.config.ConfigAgent()
+	if err != nil {
+		logrus.WithError(err).Fatal("Error starting config agent.")
+	}
+
+	// The GitHub client is not used directly, but creating it sets up the
+	// credentials for the git client.
+	if _, err := o.github.GitHubClient(o.dryRun); err != nil {
+		logrus.WithError(err).Fatal("Error getting GitHub client.")
+	}
+	gitClient, err := o.github.GitClient(o.dryRun)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting Git client.")
+	}
+	interrupts.OnInterrupt(func() {
+		if err := gitClient.Clean(); err != nil {
+			logrus.WithError(err).Error("Could not clean up git client cache.")
+		}
+	})
+
+	metrics.ExposeMetrics("inrepoconfig-cache", configAgent.Config().PushGateway, o.instrumentationOptions.MetricsPort)
+
+	s := newServer(configAgent.Config, config.NewInRepoConfigGitCache(git.ClientFactoryFrom(gitClient)), o.cacheSize)
+	mux := http.NewServeMux()
+	mux.Handle(config.InRepoConfigCachePath, s)
+	httpServer := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: mux}
+
+	health.ServeReady()
+
+	interrupts.ListenAndServe(httpServer, o.gracePeriod)
+}
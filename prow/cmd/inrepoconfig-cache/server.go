@@ -0,0 +1,175 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git/v2"
+)
+
+var cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "inrepoconfig_cache_lookups",
+	Help: "Number of in-repo config lookups by result (hit, miss, coalesced or error). Coalesced lookups waited for a concurrent miss.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(cacheLookups)
+}
+
+// prowYAMLReader reads the raw in-repo config of a repository.
+type prowYAMLReader func(c *config.Config, gc git.ClientFactory, identifier, baseSHA string, headSHAs ...string) (*config.ProwYAML, error)
+
+// server serves raw in-repo configs. They are cached by repository and SHAs;
+// as these are immutable, entries never go stale and are only evicted to
+// bound the memory used.
+type server struct {
+	config    config.Getter
+	gitClient git.ClientFactory
+	read      prowYAMLReader
+
+	// requests coalesces concurrent lookups of the same in-repo config.
+	requests singleflight.Group
+
+	lock    sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key   string
+	value []byte
+}
+
+func newServer(cfg config.Getter, gitClient git.ClientFactory, size int) *server {
+	return &server{
+		config:    cfg,
+		gitClient: gitClient,
+		read:      config.ReadProwYAML,
+		size:      size,
+		order:     list.New(),
+		entries:   map[string]*list.Element{},
+	}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	identifier := query.Get(config.InRepoConfigCacheRepoParam)
+	baseSHA := query.Get(config.InRepoConfigCacheBaseParam)
+	headSHAs := query[config.InRepoConfigCacheHeadParam]
+	if orgRepo := config.NewOrgRepo(identifier); orgRepo == nil || orgRepo.Repo == "" {
+		http.Error(w, fmt.Sprintf("%q must be of the form org/repo", config.InRepoConfigCacheRepoParam), http.StatusBadRequest)
+		return
+	}
+	if baseSHA == "" {
+		http.Error(w, fmt.Sprintf("%q is required", config.InRepoConfigCacheBaseParam), http.StatusBadRequest)
+		return
+	}
+
+	log := logrus.WithFields(logrus.Fields{"repo": identifier, "base": baseSHA, "heads": headSHAs})
+	body, err := s.prowYAML(identifier, baseSHA, headSHAs)
+	if err != nil {
+		log.WithError(err).Error("Failed to get in-repo config.")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		log.WithError(err).Debug("Failed to write response.")
+	}
+}
+
+// prowYAML returns the serialized raw in-repo config of the given repository
+// at baseSHA with headSHAs merged into it.
+func (s *server) prowYAML(identifier, baseSHA string, headSHAs []string) ([]byte, error) {
+	cfg := s.config()
+	if !cfg.InRepoConfigEnabled(identifier) {
+		return json.Marshal(&config.ProwYAML{})
+	}
+
+	key := strings.Join(append([]string{identifier, baseSHA}, headSHAs...), ",")
+	if body, ok := s.get(key); ok {
+		cacheLookups.WithLabelValues("hit").Inc()
+		return body, nil
+	}
+
+	var read bool
+	body, err, _ := s.requests.Do(key, func() (interface{}, error) {
+		read = true
+		prowYAML, err := s.read(cfg, s.gitClient, identifier, baseSHA, headSHAs...)
+		if err != nil {
+			return nil, err
+		}
+		body, err := json.Marshal(prowYAML)
+		if err != nil {
+			return nil, err
+		}
+		s.add(key, body)
+		return body, nil
+	})
+	if err != nil {
+		cacheLookups.WithLabelValues("error").Inc()
+		return nil, err
+	}
+	if read {
+		cacheLookups.WithLabelValues("miss").Inc()
+	} else {
+		cacheLookups.WithLabelValues("coalesced").Inc()
+	}
+	return body.([]byte), nil
+}
+
+func (s *server) get(key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).value, true
+}
+
+func (s *server) add(key string, value []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if element, ok := s.entries[key]; ok {
+		s.order.MoveToFront(element)
+		return
+	}
+	s.entries[key] = s.order.PushFront(&cacheEntry{key: key, value: value})
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
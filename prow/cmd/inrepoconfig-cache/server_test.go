@@ -0,0 +1,191 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git/v2"
+)
+
+func TestServeHTTP(t *testing.T) {
+	cfg := &config.Config{ProwConfig: config.ProwConfig{InRepoConfig: config.InRepoConfig{
+		Enabled: map[string]*bool{"org/repo": &[]bool{true}[0], "org/broken": &[]bool{true}[0]},
+	}}}
+
+	testCases := []struct {
+		name             string
+		method           string
+		query            string
+		expectedStatus   int
+		expectedProwYAML *config.ProwYAML
+		expectedReads    int
+	}{
+		{
+			name:           "non-GET requests are rejected",
+			method:         http.MethodPost,
+			query:          "repo=org/repo&base=abc",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "repo must be org/repo",
+			query:          "repo=org&base=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "base is required",
+			query:          "repo=org/repo",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:             "repo without in-repo config gets an empty config",
+			query:            "repo=org/disabled&base=abc",
+			expectedStatus:   http.StatusOK,
+			expectedProwYAML: &config.ProwYAML{},
+		},
+		{
+			name:             "in-repo config is read",
+			query:            "repo=org/repo&base=abc&head=def&head=ghi",
+			expectedStatus:   http.StatusOK,
+			expectedProwYAML: &config.ProwYAML{Presubmits: []config.Presubmit{{JobBase: config.JobBase{Name: "org/repo@abc,def,ghi"}}}},
+			expectedReads:    1,
+		},
+		{
+			name:           "read errors are surfaced",
+			query:          "repo=org/broken&base=abc",
+			expectedStatus: http.StatusInternalServerError,
+			expectedReads:  1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reads int
+			s := newServer(func() *config.Config { return cfg }, nil, 10)
+			s.read = func(_ *config.Config, _ git.ClientFactory, identifier, baseSHA string, headSHAs ...string) (*config.ProwYAML, error) {
+				reads++
+				if identifier == "org/broken" {
+					return nil, errors.New("injected error")
+				}
+				name := identifier + "@" + baseSHA
+				for _, head := range headSHAs {
+					name += "," + head
+				}
+				return &config.ProwYAML{Presubmits: []config.Presubmit{{JobBase: config.JobBase{Name: name}}}}, nil
+			}
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			// Every request is made twice to make sure the second one is served from the cache.
+			for i := 0; i < 2; i++ {
+				rr := httptest.NewRecorder()
+				s.ServeHTTP(rr, httptest.NewRequest(method, config.InRepoConfigCachePath+"?"+tc.query, nil))
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if tc.expectedStatus != http.StatusOK {
+					continue
+				}
+				var actual config.ProwYAML
+				if err := json.Unmarshal(rr.Body.Bytes(), &actual); err != nil {
+					t.Fatalf("failed to unmarshal response: %v", err)
+				}
+				if diff := cmp.Diff(tc.expectedProwYAML, &actual, cmp.AllowUnexported(config.Brancher{}, config.RegexpChangeMatcher{}, config.Presubmit{})); diff != "" {
+					t.Errorf("response differs from expected: %s", diff)
+				}
+			}
+			if tc.expectedStatus == http.StatusInternalServerError {
+				// Errors are not cached.
+				tc.expectedReads *= 2
+			}
+			if reads != tc.expectedReads {
+				t.Errorf("expected %d reads, got %d", tc.expectedReads, reads)
+			}
+		})
+	}
+}
+
+func TestCoalescedLookups(t *testing.T) {
+	cfg := &config.Config{ProwConfig: config.ProwConfig{InRepoConfig: config.InRepoConfig{
+		Enabled: map[string]*bool{"org/repo": &[]bool{true}[0]},
+	}}}
+	reading, release := make(chan struct{}), make(chan struct{})
+	var reads int
+	s := newServer(func() *config.Config { return cfg }, nil, 10)
+	s.read = func(_ *config.Config, _ git.ClientFactory, identifier, baseSHA string, headSHAs ...string) (*config.ProwYAML, error) {
+		reads++
+		close(reading)
+		<-release
+		return &config.ProwYAML{}, nil
+	}
+	cacheLookups.Reset()
+
+	var wg sync.WaitGroup
+	lookup := func() {
+		defer wg.Done()
+		if _, err := s.prowYAML("org/repo", "abc", nil); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	wg.Add(2)
+	go lookup()
+	<-reading
+	go lookup()
+	// Give the second lookup time to wait for the first one.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if reads != 1 {
+		t.Errorf("expected 1 read, got %d", reads)
+	}
+	for result, expected := range map[string]float64{"miss": 1, "coalesced": 1, "hit": 0} {
+		if got := testutil.ToFloat64(cacheLookups.WithLabelValues(result)); got != expected {
+			t.Errorf("expected %v lookups with result %s, got %v", expected, result, got)
+		}
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	s := newServer(nil, nil, 2)
+	s.add("a", []byte("a"))
+	s.add("b", []byte("b"))
+	if _, ok := s.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	s.add("c", []byte("c"))
+	if _, ok := s.get("b"); ok {
+		t.Error("expected least recently used entry b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := s.get(key); !ok {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+}
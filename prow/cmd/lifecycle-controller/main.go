@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// lifecycle-controller marks inactive issues and PRs as stale, then as
+// rotten, and eventually closes them according to the lifecycle policies of
+// the plugin config.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/pkg/flagutil"
+	"k8s.io/test-infra/prow/config"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	pluginsflagutil "k8s.io/test-infra/prow/flagutil/plugins"
+	"k8s.io/test-infra/prow/interrupts"
+	"k8s.io/test-infra/prow/lifecycle"
+	"k8s.io/test-infra/prow/logrusutil"
+	"k8s.io/test-infra/prow/metrics"
+	"k8s.io/test-infra/prow/pjutil"
+)
+
+const defaultHourlyTokens = 360
+
+type options struct {
+	pluginsConfig          pluginsflagutil.PluginOptions
+	github                 prowflagutil.GitHubOptions
+	instrumentationOptions prowflagutil.InstrumentationOptions
+
+	dryRun  bool
+	runOnce bool
+	period  time.Duration
+}
+
+func gatherOptions(fs *flag.FlagSet, args ...string) options {
+	var o options
+	fs.BoolVar(&o.dryRun, "dry-run", true, "Only report the lifecycle transitions, without applying them.")
+	fs.BoolVar(&o.runOnce, "run-once", false, "Sync once, print the transitions as JSON and exit, instead of syncing periodically.")
+	fs.DurationVar(&o.period, "period", 6*time.Hour, "Period of the syncs.")
+
+	o.github.AddCustomizedFlags(fs, prowflagutil.ThrottlerDefaults(defaultHourlyTokens, defaultHourlyTokens))
+	o.pluginsConfig.PluginConfigPathDefault = "/etc/plugins/plugins.yaml"
+	for _, group := range []flagutil.OptionGroup{&o.instrumentationOptions, &o.pluginsConfig} {
+		group.AddFlags(fs)
+	}
+	fs.Parse(args)
+	return o
+}
+
+func (o *options) Validate() error {
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.instrumentationOptions, &o.pluginsConfig} {
+		if err := group.Validate(o.dryRun); err != nil {
+			return err
+		}
+	}
+	if o.period <= 0 {
+		return errors.New("--period must be positive")
+	}
+	return nil
+}
+
+func main() {
+	logrusutil.ComponentInit()
+
+	o := gatherOptions(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:]...)
+	if err := o.Validate(); err != nil {
+		logrus.WithError(err).Fatal("Invalid options")
+	}
+
+	pa, err := o.pluginsConfig.PluginAgent()
+	if err != nil {
+		logrus.WithError(err).Fatal("Error loading plugin config.")
+	}
+	githubClient, err := o.github.GitHubClient(o.dryRun)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting GitHub client.")
+	}
+
+	c := lifecycle.NewController(githubClient, pa.Config, o.dryRun)
+
+	if o.runOnce {
+		transitions, err := c.Sync()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to apply some lifecycle transitions.")
+		}
+		if transitions == nil {
+			transitions = []lifecycle.Transition{}
+		}
+		encoded, err := json.MarshalIndent(transitions, "", "  ")
+		if err != nil {
+			logrus.WithError(err).Fatal("Error encoding the transitions.")
+		}
+		fmt.Println(string(encoded))
+		return
+	}
+
+	defer interrupts.WaitForGracefulShutdown()
+
+	metrics.ExposeMetrics("lifecycle-controller", config.PushGateway{}, o.instrumentationOptions.MetricsPort)
+
+	health := pjutil.NewHealthOnPort(o.instrumentationOptions.HealthPort)
+	health.ServeReady()
+
+	interrupts.TickLiteral(func() {
+		start := time.Now()
+		transitions, err := c.Sync()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to apply some lifecycle transitions.")
+		}
+		logrus.WithFields(logrus.Fields{
+			"duration":    time.Since(start).String(),
+			"transitions": len(transitions),
+		}).Info("Sync complete.")
+	}, o.period)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		expectErr bool
+	}{
+		{
+			name: "defaults are valid",
+		},
+		{
+			name: "a sync period is valid",
+			args: []string{"--period=1h", "--dry-run=false"},
+		},
+		{
+			name:      "zero period is invalid",
+			args:      []string{"--period=0s"},
+			expectErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := gatherOptions(flag.NewFlagSet(tc.name, flag.ContinueOnError), tc.args...)
+			if err := o.Validate(); (err != nil) != tc.expectErr {
+				t.Errorf("expected error %t, got %v", tc.expectErr, err)
+			}
+		})
+	}
+
+	o := gatherOptions(flag.NewFlagSet("defaults", flag.ContinueOnError))
+	if !o.dryRun || o.period != 6*time.Hour || o.pluginsConfig.PluginConfigPath != "/etc/plugins/plugins.yaml" {
+		t.Errorf("unexpected defaults: dry-run %t, period %s, plugin config %q", o.dryRun, o.period, o.pluginsConfig.PluginConfigPath)
+	}
+}
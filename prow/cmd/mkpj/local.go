@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+const defaultScratchRefPrefix = "refs/heads/mkpj/"
+
+// localPullNumber identifies the pull request that a presubmit tests a local
+// commit as, so that the artifacts of different runs don't collide.
+var localPullNumber = func() int {
+	return int(time.Now().Unix())
+}
+
+// gitRunner runs a git command in dir and returns its trimmed output.
+type gitRunner func(dir string, args ...string) (string, error)
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// scratchRefFor returns the ref that the local commit is pushed to.
+func (o *options) scratchRefFor(sha string) string {
+	if o.scratchRef != "" {
+		return o.scratchRef
+	}
+	return defaultScratchRefPrefix + sha
+}
+
+// pushLocalCommit resolves the local commit and pushes it to the scratch ref
+// on the scratch remote, so that the job can fetch it. Nothing is pushed for
+// jobs that can't test it.
+func (o *options) pushLocalCommit(pjs prowapi.ProwJobSpec, git gitRunner) (string, error) {
+	if pjs.Refs == nil {
+		return "", fmt.Errorf("local commits can only be tested by jobs with refs, not by %s jobs", pjs.Type)
+	}
+	sha, err := git(o.localRepo, "rev-parse", "--verify", o.localCommit+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %q: %w", o.localCommit, err)
+	}
+	ref := o.scratchRefFor(sha)
+	logrus.WithFields(logrus.Fields{"sha": sha, "remote": o.scratchRemote, "ref": ref}).Info("Pushing local commit.")
+	if _, err := git(o.localRepo, "push", "--force", o.scratchRemote, sha+":"+ref); err != nil {
+		return "", fmt.Errorf("failed to push %s to %s: %w", sha, ref, err)
+	}
+	return sha, nil
+}
+
+// defaultLocalRefs fills in the refs of the job so that it runs against the
+// pushed local commit. Presubmits test the commit as if it was the head of a
+// pull request against the base ref, postsubmits test the scratch ref itself.
+func (o *options) defaultLocalRefs(pjs *prowapi.ProwJobSpec, sha string, git gitRunner) error {
+	if pjs.Refs == nil {
+		return fmt.Errorf("local commits can only be tested by jobs with refs, not by %s jobs", pjs.Type)
+	}
+	ref := o.scratchRefFor(sha)
+	// The job must not report to the code review system, as there is no
+	// actual pull request or branch.
+	pjs.Report = false
+
+	if len(pjs.Refs.Pulls) == 0 {
+		if !strings.HasPrefix(ref, "refs/heads/") {
+			return fmt.Errorf("postsubmits can only test commits pushed to a branch, not to %s", ref)
+		}
+		pjs.Refs.BaseRef = strings.TrimPrefix(ref, "refs/heads/")
+		pjs.Refs.BaseSHA = sha
+		return nil
+	}
+
+	if pjs.Refs.Pulls[0].Number == 0 {
+		pjs.Refs.Pulls[0].Number = localPullNumber()
+	}
+	pjs.Refs.Pulls[0].SHA = sha
+	pjs.Refs.Pulls[0].Ref = ref
+	if pjs.Refs.Pulls[0].Author == "" {
+		author, err := git(o.localRepo, "log", "-1", "--format=%an", sha)
+		if err != nil {
+			return fmt.Errorf("failed to determine author: %w", err)
+		}
+		pjs.Refs.Pulls[0].Author = author
+	}
+	if pjs.Refs.BaseRef == "" {
+		return errors.New("--base-ref is required to test a local commit with a presubmit")
+	}
+	if pjs.Refs.BaseSHA == "" {
+		out, err := git(o.localRepo, "ls-remote", o.scratchRemote, "refs/heads/"+pjs.Refs.BaseRef)
+		if err != nil {
+			return fmt.Errorf("failed to resolve base ref: %w", err)
+		}
+		fields := strings.Fields(out)
+		if len(fields) == 0 {
+			return fmt.Errorf("base ref %q does not exist on %s", pjs.Refs.BaseRef, o.scratchRemote)
+		}
+		pjs.Refs.BaseSHA = fields[0]
+	}
+	return nil
+}
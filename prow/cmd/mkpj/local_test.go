@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+type fakeGit struct {
+	outputs  map[string]string
+	commands []string
+}
+
+func (f *fakeGit) run(dir string, args ...string) (string, error) {
+	command := strings.Join(append([]string{dir}, args...), " ")
+	f.commands = append(f.commands, command)
+	out, ok := f.outputs[command]
+	if !ok {
+		return "", errors.New("injected error")
+	}
+	return out, nil
+}
+
+func TestPushLocalCommit(t *testing.T) {
+	testCases := []struct {
+		name             string
+		scratchRef       string
+		spec             prowapi.ProwJobSpec
+		expectedCommands []string
+		expectedErr      bool
+	}{
+		{
+			name: "default scratch ref",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PostsubmitJob, Refs: &prowapi.Refs{Org: "org", Repo: "repo"}},
+			expectedCommands: []string{
+				"/repo rev-parse --verify HEAD^{commit}",
+				"/repo push --force origin 1234:refs/heads/mkpj/1234",
+			},
+		},
+		{
+			name:       "Gerrit sandbox ref",
+			scratchRef: "refs/heads/sandbox/me/mkpj",
+			spec:       prowapi.ProwJobSpec{Type: prowapi.PostsubmitJob, Refs: &prowapi.Refs{Org: "org", Repo: "repo"}},
+			expectedCommands: []string{
+				"/repo rev-parse --verify HEAD^{commit}",
+				"/repo push --force origin 1234:refs/heads/sandbox/me/mkpj",
+			},
+		},
+		{
+			name:        "nothing is pushed for jobs without refs",
+			spec:        prowapi.ProwJobSpec{Type: prowapi.PeriodicJob},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			git := &fakeGit{outputs: map[string]string{
+				"/repo rev-parse --verify HEAD^{commit}":                    "1234",
+				"/repo push --force origin 1234:refs/heads/mkpj/1234":       "",
+				"/repo push --force origin 1234:refs/heads/sandbox/me/mkpj": "",
+			}}
+			o := &options{localRepo: "/repo", localCommit: "HEAD", scratchRemote: "origin", scratchRef: tc.scratchRef}
+			sha, err := o.pushLocalCommit(tc.spec, git.run)
+			if tc.expectedErr != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", tc.expectedErr, err)
+			}
+			if !tc.expectedErr && sha != "1234" {
+				t.Errorf("expected sha 1234, got %s", sha)
+			}
+			if diff := cmp.Diff(tc.expectedCommands, git.commands); diff != "" {
+				t.Errorf("git commands differ from expected: %s", diff)
+			}
+		})
+	}
+}
+
+func TestDefaultLocalRefs(t *testing.T) {
+	defer func(original func() int) { localPullNumber = original }(localPullNumber)
+	localPullNumber = func() int { return 1600000000 }
+
+	testCases := []struct {
+		name         string
+		scratchRef   string
+		spec         prowapi.ProwJobSpec
+		expectedRefs *prowapi.Refs
+		expectedErr  bool
+	}{
+		{
+			name: "presubmit tests the commit as a pull request",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Report: true, Refs: &prowapi.Refs{
+				Org: "org", Repo: "repo", BaseRef: "main", Pulls: []prowapi.Pull{{}},
+			}},
+			expectedRefs: &prowapi.Refs{
+				Org: "org", Repo: "repo", BaseRef: "main", BaseSHA: "5678",
+				Pulls: []prowapi.Pull{{Number: 1600000000, SHA: "1234", Ref: "refs/heads/mkpj/1234", Author: "Some Author"}},
+			},
+		},
+		{
+			name: "presubmit keeps explicit base SHA, author and pull number",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Refs: &prowapi.Refs{
+				Org: "org", Repo: "repo", BaseRef: "main", BaseSHA: "abcd", Pulls: []prowapi.Pull{{Number: 42, Author: "me"}},
+			}},
+			expectedRefs: &prowapi.Refs{
+				Org: "org", Repo: "repo", BaseRef: "main", BaseSHA: "abcd",
+				Pulls: []prowapi.Pull{{Number: 42, SHA: "1234", Ref: "refs/heads/mkpj/1234", Author: "me"}},
+			},
+		},
+		{
+			name: "presubmit requires a base ref",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Refs: &prowapi.Refs{
+				Org: "org", Repo: "repo", Pulls: []prowapi.Pull{{}},
+			}},
+			expectedErr: true,
+		},
+		{
+			name: "presubmit fails on unknown base ref",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Refs: &prowapi.Refs{
+				Org: "org", Repo: "repo", BaseRef: "missing", Pulls: []prowapi.Pull{{}},
+			}},
+			expectedErr: true,
+		},
+		{
+			name: "postsubmit tests the scratch branch",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PostsubmitJob, Refs: &prowapi.Refs{
+				Org: "org", Repo: "repo", BaseRef: "main",
+			}},
+			expectedRefs: &prowapi.Refs{Org: "org", Repo: "repo", BaseRef: "mkpj/1234", BaseSHA: "1234"},
+		},
+		{
+			name:       "postsubmit can't test a non-branch ref",
+			scratchRef: "refs/for/main",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PostsubmitJob, Refs: &prowapi.Refs{
+				Org: "org", Repo: "repo",
+			}},
+			expectedErr: true,
+		},
+		{
+			name:        "periodic without refs is rejected",
+			spec:        prowapi.ProwJobSpec{Type: prowapi.PeriodicJob},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			git := &fakeGit{outputs: map[string]string{
+				"/repo log -1 --format=%an 1234":            "Some Author",
+				"/repo ls-remote origin refs/heads/main":    "5678\trefs/heads/main",
+				"/repo ls-remote origin refs/heads/missing": "",
+			}}
+			o := &options{localRepo: "/repo", scratchRemote: "origin", scratchRef: tc.scratchRef}
+			err := o.defaultLocalRefs(&tc.spec, "1234", git.run)
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error: %t, got %v", tc.expectedErr, err)
+			}
+			if tc.expectedErr {
+				return
+			}
+			if diff := cmp.Diff(tc.expectedRefs, tc.spec.Refs); diff != "" {
+				t.Errorf("refs differ from expected: %s", diff)
+			}
+			if tc.spec.Report {
+				t.Error("expected reporting to be disabled")
+			}
+		})
+	}
+}
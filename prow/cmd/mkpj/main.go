@@ -50,6 +50,12 @@ type options struct {
 
 	local bool
 
+	localCommit   string
+	localRepo     string
+	scratchRemote string
+	scratchRef    string
+	wait          bool
+
 	github       prowflagutil.GitHubOptions
 	githubClient githubClient
 	pullRequest  *github.PullRequest
@@ -196,6 +202,21 @@ func (o *options) Validate() error {
 		}
 	}
 
+	if o.localCommit != "" {
+		if o.local {
+			return errors.New("--local-commit and --local are mutually exclusive")
+		}
+		if o.pullSha != "" {
+			return errors.New("--local-commit and --pull-sha are mutually exclusive")
+		}
+		if o.scratchRemote == "" {
+			return errors.New("--scratch-remote is required with --local-commit")
+		}
+		if o.scratchRef != "" && !strings.HasPrefix(o.scratchRef, "refs/") {
+			return fmt.Errorf("--scratch-ref must be a full ref starting with refs/, not %q", o.scratchRef)
+		}
+	}
+
 	return nil
 }
 
@@ -210,6 +231,11 @@ func gatherOptions() options {
 	fs.StringVar(&o.pullSha, "pull-sha", "", "Git pull SHA under test")
 	fs.StringVar(&o.pullAuthor, "pull-author", "", "Git pull author under test")
 	fs.BoolVar(&o.triggerJob, "trigger-job", false, "Submit the job to Prow and wait for results")
+	fs.BoolVar(&o.wait, "wait", true, "With --trigger-job, wait for the job to complete. Otherwise only wait until the job started and print its URL")
+	fs.StringVar(&o.localCommit, "local-commit", "", "Local git revision (e.g. HEAD) to run the job against. It is pushed to --scratch-ref on --scratch-remote first. Presubmits use the current Unix time as pull number unless --pull-number is set")
+	fs.StringVar(&o.localRepo, "local-repo", ".", "Path to the local git repository holding --local-commit")
+	fs.StringVar(&o.scratchRemote, "scratch-remote", "origin", "Git remote (name or URL) that --local-commit is pushed to. Must be the repository the job clones")
+	fs.StringVar(&o.scratchRef, "scratch-ref", "", "Ref that --local-commit is pushed to, e.g. refs/heads/sandbox/$USER/mkpj for a Gerrit sandbox branch. Defaults to "+defaultScratchRefPrefix+"<sha>")
 	o.config.AddFlags(fs)
 	o.kubeOptions.AddFlags(fs)
 	o.github.AddFlags(fs)
@@ -239,10 +265,18 @@ func main() {
 	if job.Name == "" {
 		logrus.Fatalf("Job %s not found.", o.jobName)
 	}
-	// local mode runs with phaino, which uses local source code instead of cloing, so
-	// no need to fetch refs from github.
-	// Aside, this also makes mkpj usable for source control system other than github.
-	if pjs.Refs != nil && !o.local {
+	if o.localCommit != "" {
+		sha, err := o.pushLocalCommit(pjs, runGit)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to push local commit")
+		}
+		if err := o.defaultLocalRefs(&pjs, sha, runGit); err != nil {
+			logrus.WithError(err).Fatal("Failed to default refs for local commit")
+		}
+	} else if pjs.Refs != nil && !o.local {
+		// local mode runs with phaino, which uses local source code instead of cloing, so
+		// no need to fetch refs from github.
+		// Aside, this also makes mkpj usable for source control system other than github.
 		o.org = pjs.Refs.Org
 		o.repo = pjs.Refs.Repo
 		if len(pjs.Refs.Pulls) != 0 {
@@ -267,6 +301,14 @@ func main() {
 		return
 	}
 
+	if !o.wait {
+		started, err := pjutil.TriggerProwJob(o.kubeOptions, &pj, conf, false)
+		if err != nil {
+			logrus.WithError(err).Fatalf("failed while submitting job or waiting for it to start")
+		}
+		logrus.WithFields(pjutil.ProwJobFields(started)).WithField("url", started.Status.URL).Info("The prowjob started.")
+		return
+	}
 	if err := pjutil.TriggerAndWatchProwJob(o.kubeOptions, &pj, conf, nil, false); err != nil {
 		logrus.WithError(err).Fatalf("failed while submitting job or watching its result")
 	}
@@ -53,6 +53,48 @@ func TestOptions_Validate(t *testing.T) {
 			},
 			expectedErr: true,
 		},
+		{
+			name: "local commit ok",
+			input: options{
+				jobName:       "job",
+				config:        configflagutil.ConfigOptions{ConfigPath: "somewhere"},
+				localCommit:   "HEAD",
+				scratchRemote: "origin",
+				scratchRef:    "refs/heads/sandbox/me/mkpj",
+			},
+			expectedErr: false,
+		},
+		{
+			name: "local commit and local mode",
+			input: options{
+				jobName:       "job",
+				config:        configflagutil.ConfigOptions{ConfigPath: "somewhere"},
+				localCommit:   "HEAD",
+				scratchRemote: "origin",
+				local:         true,
+			},
+			expectedErr: true,
+		},
+		{
+			name: "local commit without remote",
+			input: options{
+				jobName:     "job",
+				config:      configflagutil.ConfigOptions{ConfigPath: "somewhere"},
+				localCommit: "HEAD",
+			},
+			expectedErr: true,
+		},
+		{
+			name: "local commit with short scratch ref",
+			input: options{
+				jobName:       "job",
+				config:        configflagutil.ConfigOptions{ConfigPath: "somewhere"},
+				localCommit:   "HEAD",
+				scratchRemote: "origin",
+				scratchRef:    "mkpj",
+			},
+			expectedErr: true,
+		},
 	}
 
 	for _, testCase := range testCases {
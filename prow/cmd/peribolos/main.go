@@ -20,8 +20,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -41,6 +44,9 @@ const (
 	defaultDelta     = 0.25
 	defaultTokens    = 300
 	defaultBurst     = 100
+
+	planMarkdown = "markdown"
+	planJSON     = "json"
 )
 
 type options struct {
@@ -61,8 +67,14 @@ type options struct {
 	ignoreSecretTeams bool
 	allowRepoArchival bool
 	allowRepoPublish  bool
+	planFormat        string
+	planOutput        string
+	hmacSecretFile    string
 	github            flagutil.GitHubOptions
 
+	// hmacSecret is the content of --hmac-secret-file.
+	hmacSecret []byte
+
 	// TODO(petr-muller): Remove after August 2021, replaced by github.ThrottleHourlyTokens
 	tokenBurst    int
 	tokensPerHour int
@@ -99,6 +111,9 @@ func (o *options) parseArgs(flags *flag.FlagSet, args []string) error {
 	flags.BoolVar(&o.fixRepos, "fix-repos", false, "Create/update repositories if set")
 	flags.BoolVar(&o.allowRepoArchival, "allow-repo-archival", false, "If set, archiving repos is allowed while updating repos")
 	flags.BoolVar(&o.allowRepoPublish, "allow-repo-publish", false, "If set, making private repos public is allowed while updating repos")
+	flags.StringVar(&o.planFormat, "plan-format", planMarkdown, fmt.Sprintf("Format of the plan of the changes, %q or %q", planMarkdown, planJSON))
+	flags.StringVar(&o.planOutput, "plan-output", "", "Write the plan of the changes to this file instead of stdout")
+	flags.StringVar(&o.hmacSecretFile, "hmac-secret-file", "", "Path to the hmac secret in the same format as for hook. Created webhooks get the active token of their repo as secret")
 	flags.StringVar(&o.logLevel, "log-level", logrus.InfoLevel.String(), fmt.Sprintf("Logging level, one of %v", logrus.AllLevels))
 	o.github.AddCustomizedFlags(flags, flagutil.ThrottlerDefaults(defaultTokens, defaultBurst))
 	if err := flags.Parse(args); err != nil {
@@ -145,6 +160,10 @@ func (o *options) parseArgs(flags *flag.FlagSet, args []string) error {
 		return errors.New("--dump-full can't be used without --dump")
 	}
 
+	if o.planFormat != planMarkdown && o.planFormat != planJSON {
+		return fmt.Errorf("--plan-format must be %q or %q, not %q", planMarkdown, planJSON, o.planFormat)
+	}
+
 	if o.fixTeamMembers && !o.fixTeams {
 		return fmt.Errorf("--fix-team-members requires --fix-teams")
 	}
@@ -204,14 +223,50 @@ func main() {
 		logrus.WithError(err).Fatal("Failed to load configuration")
 	}
 
+	if o.hmacSecretFile != "" {
+		if o.hmacSecret, err = ioutil.ReadFile(o.hmacSecretFile); err != nil {
+			logrus.WithError(err).Fatal("Could not read --hmac-secret-file file")
+		}
+	}
+
+	plan := &Plan{}
+	pc := newPlanClient(githubClient, plan)
+	var orgNames []string
 	for name, orgcfg := range cfg.Orgs {
-		if err := configureOrg(o, githubClient, name, orgcfg); err != nil {
+		orgNames = append(orgNames, name)
+		if err := configureOrg(o, pc, name, orgcfg); err != nil {
 			logrus.Fatalf("Configuration failed: %v", err)
 		}
 	}
+	if err := writePlan(o, plan, orgNames); err != nil {
+		logrus.WithError(err).Fatal("Failed to write the plan")
+	}
+	if !o.confirm {
+		logrus.Info("Not applying the plan without --confirm.")
+		return
+	}
+	if err := plan.Apply(githubClient); err != nil {
+		logrus.Fatalf("Configuration failed: %v", err)
+	}
 	logrus.Info("Finished syncing configuration.")
 }
 
+func writePlan(o options, plan *Plan, orgNames []string) error {
+	out := io.Writer(os.Stdout)
+	if o.planOutput != "" {
+		f, err := os.Create(o.planOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if o.planFormat == planJSON {
+		return plan.WriteJSON(out, orgNames)
+	}
+	return plan.WriteMarkdown(out, orgNames)
+}
+
 type dumpClient interface {
 	GetOrg(name string) (*github.Organization, error)
 	ListOrgMembers(org, role string) ([]github.TeamMember, error)
@@ -220,6 +275,8 @@ type dumpClient interface {
 	ListTeamRepos(org string, id int) ([]github.Repo, error)
 	GetRepo(owner, name string) (github.FullRepo, error)
 	GetRepos(org string, isUser bool) ([]github.Repo, error)
+	ListOutsideCollaborators(org, repo string) ([]github.User, error)
+	ListRepoHooks(org, repo string) ([]github.Hook, error)
 	BotUser() (*github.UserData, error)
 }
 
@@ -371,7 +428,7 @@ func dumpOrgConfig(client dumpClient, orgName string, ignoreSecretTeams bool) (*
 			return nil, fmt.Errorf("failed to get repo: %w", err)
 		}
 		logrus.WithField("repo", full.FullName).Debug("Recording repo.")
-		out.Repos[full.Name] = org.PruneRepoDefaults(org.Repo{
+		dumped := org.PruneRepoDefaults(org.Repo{
 			Description:      &full.Description,
 			HomePage:         &full.Homepage,
 			Private:          &full.Private,
@@ -383,7 +440,37 @@ func dumpOrgConfig(client dumpClient, orgName string, ignoreSecretTeams bool) (*
 			AllowRebaseMerge: &full.AllowRebaseMerge,
 			Archived:         &full.Archived,
 			DefaultBranch:    &full.DefaultBranch,
+			Topics:           full.Topics,
 		})
+
+		collaborators, err := client.ListOutsideCollaborators(orgName, full.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repo %s collaborators: %w", full.Name, err)
+		}
+		for _, user := range collaborators {
+			if dumped.Collaborators == nil {
+				dumped.Collaborators = map[string]github.RepoPermissionLevel{}
+			}
+			dumped.Collaborators[user.Login] = github.LevelFromPermissions(user.Permissions)
+		}
+
+		hooks, err := client.ListRepoHooks(orgName, full.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repo %s webhooks: %w", full.Name, err)
+		}
+		for _, hook := range hooks {
+			webhook := org.Webhook{
+				URL:         hook.Config.URL,
+				Events:      hook.Events,
+				ContentType: hook.Config.ContentType,
+			}
+			if !hook.Active {
+				inactive := false
+				webhook.Active = &inactive
+			}
+			dumped.Webhooks = append(dumped.Webhooks, webhook)
+		}
+		out.Repos[full.Name] = dumped
 	}
 
 	return &out, nil
@@ -877,6 +964,9 @@ type repoClient interface {
 	GetRepos(orgName string, isUser bool) ([]github.Repo, error)
 	CreateRepo(owner string, isUser bool, repo github.RepoCreateRequest) (*github.FullRepo, error)
 	UpdateRepo(owner, name string, repo github.RepoUpdateRequest) (*github.FullRepo, error)
+	ReplaceRepoTopics(org, repo string, topics []string) error
+	collaboratorClient
+	webhookClient
 }
 
 func newRepoCreateRequest(name string, definition org.Repo) github.RepoCreateRequest {
@@ -904,11 +994,36 @@ func newRepoCreateRequest(name string, definition org.Repo) github.RepoCreateReq
 	return repoCreate
 }
 
+// topicPattern matches the topics allowed by GitHub.
+var topicPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
 func validateRepos(repos map[string]org.Repo) error {
 	seen := map[string]string{}
 	var dups []string
+	var errs []error
 
 	for wantName, repo := range repos {
+		for user, permission := range repo.Collaborators {
+			if _, ok := repoPermissions[permission]; !ok {
+				errs = append(errs, fmt.Errorf("repo %s: collaborator %s has invalid permission %q", wantName, user, permission))
+			}
+		}
+		for _, topic := range repo.Topics {
+			if !topicPattern.MatchString(topic) {
+				errs = append(errs, fmt.Errorf("repo %s: topic %q must be lowercase letters, numbers and hyphens, of at most 50 characters", wantName, topic))
+			}
+		}
+		urls := sets.NewString()
+		for _, webhook := range repo.Webhooks {
+			switch {
+			case webhook.URL == "":
+				errs = append(errs, fmt.Errorf("repo %s: webhooks must have a url", wantName))
+			case urls.Has(webhook.URL):
+				errs = append(errs, fmt.Errorf("repo %s: webhook %s is declared more than once", wantName, webhook.URL))
+			}
+			urls.Insert(webhook.URL)
+		}
+
 		toCheck := append([]string{wantName}, repo.Previously...)
 		for _, name := range toCheck {
 			normName := strings.ToLower(name)
@@ -924,10 +1039,10 @@ func validateRepos(repos map[string]org.Repo) error {
 	}
 
 	if len(dups) > 0 {
-		return fmt.Errorf("found duplicate repo names (GitHub repo names are case-insensitive): %s", strings.Join(dups, ", "))
+		errs = append(errs, fmt.Errorf("found duplicate repo names (GitHub repo names are case-insensitive): %s", strings.Join(dups, ", ")))
 	}
 
-	return nil
+	return utilerrors.NewAggregate(errs)
 }
 
 // newRepoUpdateRequest creates a minimal github.RepoUpdateRequest instance
@@ -1057,19 +1172,222 @@ func configureRepos(opt options, client repoClient, orgName string, orgConfig or
 				}
 				allErrors = append(allErrors, deltaErrors...)
 			}
+			name := existing.Name
 			if delta.Defined() {
 				repoLogger.Info("repo exists and differs from desired state, updating")
 				if _, err := client.UpdateRepo(orgName, existing.Name, delta); err != nil {
 					repoLogger.WithError(err).Error("failed to update repository")
 					allErrors = append(allErrors, err)
+				} else if delta.Name != nil {
+					name = *delta.Name
 				}
 			}
+
+			if err := configureRepoTopics(client, orgName, name, existing.Topics, wantRepo.Topics); err != nil {
+				repoLogger.WithError(err).Error("failed to configure repository topics")
+				allErrors = append(allErrors, err)
+			}
+			if err := configureRepoCollaborators(opt, client, orgName, name, wantRepo.Collaborators); err != nil {
+				repoLogger.WithError(err).Error("failed to configure repository collaborators")
+				allErrors = append(allErrors, err)
+			}
+			if err := configureRepoWebhooks(opt, client, orgName, name, wantRepo.Webhooks); err != nil {
+				repoLogger.WithError(err).Error("failed to configure repository webhooks")
+				allErrors = append(allErrors, err)
+			}
 		}
 	}
 
 	return utilerrors.NewAggregate(allErrors)
 }
 
+// configureRepoTopics replaces the topics of the repo when they differ.
+func configureRepoTopics(client repoClient, orgName, repoName string, have, want []string) error {
+	if want == nil || sets.NewString(have...).Equal(sets.NewString(want...)) {
+		return nil
+	}
+	logrus.WithField("repo", repoName).Infof("Replacing topics %v with %v", have, want)
+	if err := client.ReplaceRepoTopics(orgName, repoName, want); err != nil {
+		return fmt.Errorf("failed to replace %s/%s topics: %w", orgName, repoName, err)
+	}
+	return nil
+}
+
+// repoPermissions maps the permission levels of collaborators to the
+// permissions of the API.
+var repoPermissions = map[github.RepoPermissionLevel]github.TeamPermission{
+	github.Read:     github.RepoPull,
+	github.Triage:   github.RepoTriage,
+	github.Write:    github.RepoPush,
+	github.Maintain: github.RepoMaintain,
+	github.Admin:    github.RepoAdmin,
+}
+
+type collaboratorClient interface {
+	ListOutsideCollaborators(org, repo string) ([]github.User, error)
+	ListRepoInvitations(org, repo string) ([]github.RepoInvitation, error)
+	AddCollaborator(org, repo, user string, permission github.TeamPermission) error
+	RemoveCollaborator(org, repo, user string) error
+}
+
+// configureRepoCollaborators invites, updates and removes the outside
+// collaborators of the repo when they differ. Users who were already invited
+// with the wanted permission are not invited again.
+func configureRepoCollaborators(opt options, client collaboratorClient, orgName, repoName string, want map[string]github.RepoPermissionLevel) error {
+	if want == nil {
+		return nil
+	}
+	users, err := client.ListOutsideCollaborators(orgName, repoName)
+	if err != nil {
+		return fmt.Errorf("failed to list %s/%s collaborators: %w", orgName, repoName, err)
+	}
+	have := map[string]github.RepoPermissionLevel{}
+	logins := map[string]string{}
+	for _, user := range users {
+		have[github.NormLogin(user.Login)] = github.LevelFromPermissions(user.Permissions)
+		logins[github.NormLogin(user.Login)] = user.Login
+	}
+	invitations, err := client.ListRepoInvitations(orgName, repoName)
+	if err != nil {
+		return fmt.Errorf("failed to list %s/%s invitations: %w", orgName, repoName, err)
+	}
+	invited := map[string]github.RepoPermissionLevel{}
+	for _, invitation := range invitations {
+		if invitation.Invitee != nil {
+			invited[github.NormLogin(invitation.Invitee.Login)] = invitation.Permission
+		}
+	}
+	wanted := sets.NewString()
+	for user := range want {
+		wanted.Insert(github.NormLogin(user))
+	}
+
+	var remove []string
+	for user := range have {
+		if !wanted.Has(user) {
+			remove = append(remove, logins[user])
+		}
+	}
+	sort.Strings(remove)
+	if len(remove) > 0 {
+		if delta := float64(len(remove)) / float64(len(have)); delta > opt.maximumDelta {
+			return fmt.Errorf("cannot remove %d collaborators or %.3f of %s/%s collaborators (exceeds limit of %.3f)", len(remove), delta, orgName, repoName, opt.maximumDelta)
+		}
+	}
+
+	var errs []error
+	for user, permission := range want {
+		if have[github.NormLogin(user)] == permission {
+			continue
+		}
+		if _, collaborates := have[github.NormLogin(user)]; !collaborates && invited[github.NormLogin(user)] == permission {
+			logrus.WithFields(logrus.Fields{"repo": repoName, "user": user}).Debugf("Already invited with permission %s", permission)
+			continue
+		}
+		logrus.WithFields(logrus.Fields{"repo": repoName, "user": user}).Infof("Setting collaborator permission to %s", permission)
+		if err := client.AddCollaborator(orgName, repoName, user, repoPermissions[permission]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set the permission of %s on %s/%s to %s: %w", user, orgName, repoName, permission, err))
+		}
+	}
+	for _, user := range remove {
+		logrus.WithFields(logrus.Fields{"repo": repoName, "user": user}).Info("Removing collaborator")
+		if err := client.RemoveCollaborator(orgName, repoName, user); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s from %s/%s collaborators: %w", user, orgName, repoName, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+type webhookClient interface {
+	ListRepoHooks(org, repo string) ([]github.Hook, error)
+	CreateRepoHook(org, repo string, req github.HookRequest) (int, error)
+	EditRepoHook(org, repo string, id int, req github.HookRequest) error
+	DeleteRepoHook(org, repo string, id int, req github.HookRequest) error
+}
+
+// configureRepoWebhooks creates, updates and deletes the webhooks of the repo
+// when they differ. Webhooks are identified by their URL.
+func configureRepoWebhooks(opt options, client webhookClient, orgName, repoName string, want []org.Webhook) error {
+	if want == nil {
+		return nil
+	}
+	hooks, err := client.ListRepoHooks(orgName, repoName)
+	if err != nil {
+		return fmt.Errorf("failed to list %s/%s webhooks: %w", orgName, repoName, err)
+	}
+	have := map[string]github.Hook{}
+	for _, hook := range hooks {
+		have[hook.Config.URL] = hook
+	}
+	wanted := sets.NewString()
+	for _, webhook := range want {
+		wanted.Insert(webhook.URL)
+	}
+
+	var remove []github.Hook
+	for _, hook := range hooks {
+		if !wanted.Has(hook.Config.URL) {
+			remove = append(remove, hook)
+		}
+	}
+	if len(remove) > 0 {
+		if delta := float64(len(remove)) / float64(len(hooks)); delta > opt.maximumDelta {
+			return fmt.Errorf("cannot delete %d webhooks or %.3f of %s/%s webhooks (exceeds limit of %.3f)", len(remove), delta, orgName, repoName, opt.maximumDelta)
+		}
+	}
+
+	var errs []error
+	for _, webhook := range want {
+		logger := logrus.WithFields(logrus.Fields{"repo": repoName, "url": webhook.URL})
+		events := webhook.Events
+		if len(events) == 0 {
+			events = []string{"push"}
+		}
+		active := webhook.Active == nil || *webhook.Active
+		hook, exists := have[webhook.URL]
+		if !exists {
+			if opt.hmacSecret == nil {
+				errs = append(errs, fmt.Errorf("cannot create %s/%s webhook %s without a secret, --hmac-secret-file is unset", orgName, repoName, webhook.URL))
+				continue
+			}
+			secret, err := github.ActiveHMACForRepo(orgName+"/"+repoName, func() []byte { return opt.hmacSecret })
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get the secret of %s/%s webhook %s: %w", orgName, repoName, webhook.URL, err))
+				continue
+			}
+			logger.Info("Creating webhook")
+			req := github.HookRequest{
+				Name:   "web",
+				Active: &active,
+				Events: events,
+				Config: &github.HookConfig{URL: webhook.URL, ContentType: webhook.ContentType, Secret: &secret},
+			}
+			if _, err := client.CreateRepoHook(orgName, repoName, req); err != nil {
+				errs = append(errs, fmt.Errorf("failed to create %s/%s webhook %s: %w", orgName, repoName, webhook.URL, err))
+			}
+			continue
+		}
+		if webhook.ContentType != nil && (hook.Config.ContentType == nil || *hook.Config.ContentType != *webhook.ContentType) {
+			logger.Warn("Not changing the content type of the webhook, which would drop its secret")
+		}
+		if hook.Active == active && sets.NewString(hook.Events...).Equal(sets.NewString(events...)) {
+			continue
+		}
+		logger.Info("Updating webhook")
+		// The config is omitted, so that the secret is kept.
+		if err := client.EditRepoHook(orgName, repoName, hook.ID, github.HookRequest{Active: &active, Events: events}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update %s/%s webhook %s: %w", orgName, repoName, webhook.URL, err))
+		}
+	}
+	for _, hook := range remove {
+		logrus.WithFields(logrus.Fields{"repo": repoName, "url": hook.Config.URL}).Info("Deleting webhook")
+		if err := client.DeleteRepoHook(orgName, repoName, hook.ID, github.HookRequest{}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %s/%s webhook %s: %w", orgName, repoName, hook.Config.URL, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
 func configureTeamAndMembers(opt options, client github.Client, githubTeams map[string]github.Team, name, orgName string, team org.Team, parent *int) error {
 	gt, ok := githubTeams[name]
 	if !ok { // configureTeams is buggy if this is the case
@@ -65,6 +65,10 @@ func TestOptions(t *testing.T) {
 			name: "reject --dump-full-config without --dump",
 			args: []string{"--config-path=foo", "--dump-full-config"},
 		},
+		{
+			name: "reject unknown --plan-format",
+			args: []string{"--config-path=foo", "--plan-format=yaml"},
+		},
 		{
 			name: "maximal delta",
 			args: []string{"--config-path=foo", "--maximum-removal-delta=1"},
@@ -76,6 +80,7 @@ func TestOptions(t *testing.T) {
 				tokensPerHour: defaultTokens,
 				tokenBurst:    defaultBurst,
 				logLevel:      "info",
+				planFormat:    planMarkdown,
 			},
 		},
 		{
@@ -89,6 +94,7 @@ func TestOptions(t *testing.T) {
 				tokensPerHour: defaultTokens,
 				tokenBurst:    defaultBurst,
 				logLevel:      "info",
+				planFormat:    planMarkdown,
 			},
 		},
 		{
@@ -102,6 +108,7 @@ func TestOptions(t *testing.T) {
 				tokensPerHour: defaultTokens,
 				tokenBurst:    defaultBurst,
 				logLevel:      "info",
+				planFormat:    planMarkdown,
 			},
 		},
 		{
@@ -130,6 +137,7 @@ func TestOptions(t *testing.T) {
 				maximumDelta: defaultDelta,
 				tokenBurst:   defaultBurst,
 				logLevel:     "info",
+				planFormat:   planMarkdown,
 			},
 		},
 		{
@@ -143,6 +151,7 @@ func TestOptions(t *testing.T) {
 				tokenBurst:    defaultBurst,
 				dump:          "frogger",
 				logLevel:      "info",
+				planFormat:    planMarkdown,
 			},
 		},
 		{
@@ -156,6 +165,7 @@ func TestOptions(t *testing.T) {
 				tokensPerHour: defaultTokens,
 				tokenBurst:    defaultBurst,
 				logLevel:      "info",
+				planFormat:    planMarkdown,
 			},
 		},
 		{
@@ -174,6 +184,7 @@ func TestOptions(t *testing.T) {
 				fixTeams:       true,
 				fixTeamMembers: true,
 				logLevel:       "debug",
+				planFormat:     planMarkdown,
 			},
 		},
 	}
@@ -1735,6 +1746,7 @@ func TestDumpOrgConfig(t *testing.T) {
 	repoDescription := "awesome testing project"
 	repoHomepage := "https://www.somewhe.re/something/"
 	master := "master-branch"
+	jsonType := "json"
 	cases := []struct {
 		name              string
 		orgOverride       string
@@ -1747,6 +1759,8 @@ func TestDumpOrgConfig(t *testing.T) {
 		maintainers       map[int][]string
 		repoPermissions   map[int][]github.Repo
 		repos             []github.FullRepo
+		collaborators     map[string][]github.User
+		hooks             map[string][]github.Hook
 		expected          org.Config
 		err               bool
 	}{
@@ -1852,9 +1866,19 @@ func TestDumpOrgConfig(t *testing.T) {
 						HasWiki:       true,
 						Archived:      true,
 						DefaultBranch: master,
+						Topics:        []string{"testing"},
 					},
 				},
 			},
+			collaborators: map[string][]github.User{
+				repoName: {{Login: "Outsider", Permissions: github.RepoPermissions{Pull: true, Triage: true}}},
+			},
+			hooks: map[string][]github.Hook{
+				repoName: {
+					{ID: 1, Events: []string{"push"}, Active: true, Config: github.HookConfig{URL: "https://hook.example.com", ContentType: &jsonType}},
+					{ID: 2, Events: []string{"*"}, Active: false, Config: github.HookConfig{URL: "https://old.example.com"}},
+				},
+			},
 			expected: org.Config{
 				Metadata: org.Metadata{
 					Name:                         &hello,
@@ -1918,6 +1942,12 @@ func TestDumpOrgConfig(t *testing.T) {
 						AllowSquashMerge: &no,
 						Archived:         &yes,
 						DefaultBranch:    &master,
+						Topics:           []string{"testing"},
+						Collaborators:    map[string]github.RepoPermissionLevel{"Outsider": github.Triage},
+						Webhooks: []org.Webhook{
+							{URL: "https://hook.example.com", Events: []string{"push"}, ContentType: &jsonType},
+							{URL: "https://old.example.com", Events: []string{"*"}, Active: &no},
+						},
 					},
 				},
 			},
@@ -2042,6 +2072,8 @@ func TestDumpOrgConfig(t *testing.T) {
 				maintainers:     tc.maintainers,
 				repoPermissions: tc.repoPermissions,
 				repos:           tc.repos,
+				collaborators:   tc.collaborators,
+				hooks:           tc.hooks,
 			}
 			actual, err := dumpOrgConfig(fc, orgName, tc.ignoreSecretTeams)
 			switch {
@@ -2075,6 +2107,8 @@ type fakeDumpClient struct {
 	maintainers     map[int][]string
 	repoPermissions map[int][]github.Repo
 	repos           []github.FullRepo
+	collaborators   map[string][]github.User
+	hooks           map[string][]github.Hook
 }
 
 func (c fakeDumpClient) GetOrg(name string) (*github.Organization, error) {
@@ -2175,6 +2209,14 @@ func (c fakeDumpClient) GetRepo(owner, repo string) (github.FullRepo, error) {
 	return github.FullRepo{}, fmt.Errorf("not found")
 }
 
+func (c fakeDumpClient) ListOutsideCollaborators(org, repo string) ([]github.User, error) {
+	return c.collaborators[repo], nil
+}
+
+func (c fakeDumpClient) ListRepoHooks(org, repo string) ([]github.Hook, error) {
+	return c.hooks[repo], nil
+}
+
 func (c fakeDumpClient) BotUser() (*github.UserData, error) {
 	return &github.UserData{Login: "admin"}, nil
 }
@@ -2533,8 +2575,11 @@ func TestConfigureTeamRepos(t *testing.T) {
 }
 
 type fakeRepoClient struct {
-	t     *testing.T
-	repos map[string]github.FullRepo
+	t             *testing.T
+	repos         map[string]github.FullRepo
+	collaborators map[string]map[string]github.RepoPermissionLevel
+	invitations   map[string]map[string]github.RepoPermissionLevel
+	hooks         map[string][]github.Hook
 }
 
 func (f fakeRepoClient) GetRepo(owner, name string) (github.FullRepo, error) {
@@ -2627,10 +2672,116 @@ func (f fakeRepoClient) UpdateRepo(owner, name string, want github.RepoUpdateReq
 	return &have, nil
 }
 
+func (f fakeRepoClient) ReplaceRepoTopics(org, repo string, topics []string) error {
+	have, exists := f.repos[repo]
+	if !exists {
+		return fmt.Errorf("repo not found")
+	}
+	have.Topics = topics
+	f.repos[repo] = have
+	return nil
+}
+
+func (f fakeRepoClient) ListOutsideCollaborators(org, repo string) ([]github.User, error) {
+	if repo == "fail" {
+		return nil, fmt.Errorf("injected ListOutsideCollaborators failure")
+	}
+	var users []github.User
+	for login, level := range f.collaborators[repo] {
+		var permissions github.RepoPermissions
+		switch level {
+		case github.Admin:
+			permissions.Admin = true
+		case github.Maintain:
+			permissions.Maintain = true
+		case github.Write:
+			permissions.Push = true
+		case github.Triage:
+			permissions.Triage = true
+		case github.Read:
+			permissions.Pull = true
+		}
+		users = append(users, github.User{Login: login, Permissions: permissions})
+	}
+	return users, nil
+}
+
+func (f fakeRepoClient) ListRepoInvitations(org, repo string) ([]github.RepoInvitation, error) {
+	var invitations []github.RepoInvitation
+	for login, level := range f.invitations[repo] {
+		invitations = append(invitations, github.RepoInvitation{Invitee: &github.User{Login: login}, Permission: level})
+	}
+	return invitations, nil
+}
+
+func (f fakeRepoClient) AddCollaborator(org, repo, user string, permission github.TeamPermission) error {
+	levels := map[github.TeamPermission]github.RepoPermissionLevel{
+		github.RepoPull:     github.Read,
+		github.RepoTriage:   github.Triage,
+		github.RepoPush:     github.Write,
+		github.RepoMaintain: github.Maintain,
+		github.RepoAdmin:    github.Admin,
+	}
+	level, ok := levels[permission]
+	if !ok {
+		return fmt.Errorf("bad permission: %q", permission)
+	}
+	if f.collaborators[repo] == nil {
+		f.collaborators[repo] = map[string]github.RepoPermissionLevel{}
+	}
+	f.collaborators[repo][user] = level
+	return nil
+}
+
+func (f fakeRepoClient) RemoveCollaborator(org, repo, user string) error {
+	if _, ok := f.collaborators[repo][user]; !ok {
+		return fmt.Errorf("%s is not a collaborator", user)
+	}
+	delete(f.collaborators[repo], user)
+	return nil
+}
+
+func (f fakeRepoClient) ListRepoHooks(org, repo string) ([]github.Hook, error) {
+	return f.hooks[repo], nil
+}
+
+func (f fakeRepoClient) CreateRepoHook(org, repo string, req github.HookRequest) (int, error) {
+	id := len(f.hooks[repo]) + 100
+	f.hooks[repo] = append(f.hooks[repo], github.Hook{ID: id, Name: req.Name, Events: req.Events, Active: *req.Active, Config: *req.Config})
+	return id, nil
+}
+
+func (f fakeRepoClient) EditRepoHook(org, repo string, id int, req github.HookRequest) error {
+	if req.Config != nil {
+		f.t.Errorf("EditRepoHook() called with a config, which drops the secret")
+	}
+	for i, hook := range f.hooks[repo] {
+		if hook.ID == id {
+			f.hooks[repo][i].Events = req.Events
+			f.hooks[repo][i].Active = *req.Active
+			return nil
+		}
+	}
+	return fmt.Errorf("hook %d not found", id)
+}
+
+func (f fakeRepoClient) DeleteRepoHook(org, repo string, id int, req github.HookRequest) error {
+	for i, hook := range f.hooks[repo] {
+		if hook.ID == id {
+			f.hooks[repo] = append(f.hooks[repo][:i], f.hooks[repo][i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("hook %d not found", id)
+}
+
 func makeFakeRepoClient(t *testing.T, repos ...github.FullRepo) fakeRepoClient {
 	fc := fakeRepoClient{
-		repos: make(map[string]github.FullRepo, len(repos)),
-		t:     t,
+		repos:         make(map[string]github.FullRepo, len(repos)),
+		collaborators: map[string]map[string]github.RepoPermissionLevel{},
+		invitations:   map[string]map[string]github.RepoPermissionLevel{},
+		hooks:         map[string][]github.Hook{},
+		t:             t,
 	}
 	for _, repo := range repos {
 		fc.repos[repo.Name] = repo
@@ -2977,6 +3128,177 @@ func TestConfigureRepos(t *testing.T) {
 	}
 }
 
+func TestConfigureRepoSettings(t *testing.T) {
+	orgName := "test-org"
+	repoName := "repo"
+	no := false
+	form := "form"
+	json := "json"
+	current := "current"
+	hook := func(id int, url string, active bool, events ...string) github.Hook {
+		return github.Hook{ID: id, Events: events, Active: active, Config: github.HookConfig{URL: url}}
+	}
+
+	testCases := []struct {
+		description   string
+		repo          org.Repo
+		topics        []string
+		collaborators map[string]github.RepoPermissionLevel
+		invitations   map[string]github.RepoPermissionLevel
+		hooks         []github.Hook
+		hmacSecret    string
+
+		expectError           bool
+		expectedTopics        []string
+		expectedCollaborators map[string]github.RepoPermissionLevel
+		expectedHooks         []github.Hook
+	}{
+		{
+			description:           "unset settings are not managed",
+			topics:                []string{"go"},
+			collaborators:         map[string]github.RepoPermissionLevel{"alice": github.Read},
+			hooks:                 []github.Hook{hook(1, "https://a", true, "push")},
+			expectedTopics:        []string{"go"},
+			expectedCollaborators: map[string]github.RepoPermissionLevel{"alice": github.Read},
+			expectedHooks:         []github.Hook{hook(1, "https://a", true, "push")},
+		},
+		{
+			description:    "topics are replaced",
+			repo:           org.Repo{Topics: []string{"ci", "go"}},
+			topics:         []string{"go", "python"},
+			expectedTopics: []string{"ci", "go"},
+		},
+		{
+			description:    "empty topics remove all topics",
+			repo:           org.Repo{Topics: []string{}},
+			topics:         []string{"go"},
+			expectedTopics: []string{},
+		},
+		{
+			description: "collaborators are invited, updated and removed",
+			repo: org.Repo{Collaborators: map[string]github.RepoPermissionLevel{
+				"alice": github.Admin,
+				"Bob":   github.Read,
+				"carol": github.Triage,
+				"dan":   github.Write,
+			}},
+			collaborators: map[string]github.RepoPermissionLevel{
+				"alice": github.Read,
+				"bob":   github.Read,
+				"carol": github.Triage,
+				"dan":   github.Write,
+				"eve":   github.Write,
+			},
+			expectedCollaborators: map[string]github.RepoPermissionLevel{
+				"alice": github.Admin,
+				"bob":   github.Read,
+				"carol": github.Triage,
+				"dan":   github.Write,
+			},
+		},
+		{
+			description: "pending invitations are not sent again",
+			repo: org.Repo{Collaborators: map[string]github.RepoPermissionLevel{
+				"alice": github.Triage,
+				"bob":   github.Write,
+			}},
+			collaborators: map[string]github.RepoPermissionLevel{},
+			invitations: map[string]github.RepoPermissionLevel{
+				"Alice": github.Triage,
+				"bob":   github.Read,
+			},
+			expectedCollaborators: map[string]github.RepoPermissionLevel{
+				"bob": github.Write,
+			},
+		},
+		{
+			description: "removing too many collaborators fails",
+			repo:        org.Repo{Collaborators: map[string]github.RepoPermissionLevel{"alice": github.Read}},
+			collaborators: map[string]github.RepoPermissionLevel{
+				"alice": github.Write,
+				"bob":   github.Read,
+			},
+			expectError: true,
+			expectedCollaborators: map[string]github.RepoPermissionLevel{
+				"alice": github.Write,
+				"bob":   github.Read,
+			},
+		},
+		{
+			description: "webhooks are created, updated and deleted",
+			hmacSecret:  "'*':\n- value: global\n'test-org/repo':\n- value: old\n  state: retiring\n- value: current\n  state: active\n",
+			repo: org.Repo{Webhooks: []org.Webhook{
+				{URL: "https://a", Events: []string{"push", "pull_request"}},
+				{URL: "https://b", Active: &no, ContentType: &form},
+				{URL: "https://c"},
+				{URL: "https://d", Events: []string{"issues"}, ContentType: &json},
+			}},
+			hooks: []github.Hook{
+				hook(1, "https://a", true, "push"),
+				hook(2, "https://b", true, "push"),
+				hook(3, "https://c", true, "push"),
+				hook(4, "https://old", true, "push"),
+			},
+			expectedHooks: []github.Hook{
+				hook(1, "https://a", true, "push", "pull_request"),
+				hook(2, "https://b", false, "push"),
+				hook(3, "https://c", true, "push"),
+				{ID: 104, Name: "web", Events: []string{"issues"}, Active: true, Config: github.HookConfig{URL: "https://d", ContentType: &json, Secret: &current}},
+			},
+		},
+		{
+			description:   "webhooks aren't created without a secret",
+			repo:          org.Repo{Webhooks: []org.Webhook{{URL: "https://a"}}},
+			hooks:         []github.Hook{},
+			expectError:   true,
+			expectedHooks: []github.Hook{},
+		},
+		{
+			description: "deleting too many webhooks fails",
+			repo:        org.Repo{Webhooks: []org.Webhook{}},
+			hooks:       []github.Hook{hook(1, "https://a", true, "push")},
+			expectError: true,
+			expectedHooks: []github.Hook{
+				hook(1, "https://a", true, "push"),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			fc := makeFakeRepoClient(t, github.FullRepo{Repo: github.Repo{Name: repoName, Topics: tc.topics}})
+			if tc.collaborators != nil {
+				fc.collaborators[repoName] = tc.collaborators
+			}
+			if tc.invitations != nil {
+				fc.invitations[repoName] = tc.invitations
+			}
+			if tc.hooks != nil {
+				fc.hooks[repoName] = tc.hooks
+			}
+			opts := options{maximumDelta: 0.25}
+			if tc.hmacSecret != "" {
+				opts.hmacSecret = []byte(tc.hmacSecret)
+			}
+			err := configureRepos(opts, fc, orgName, org.Config{Repos: map[string]org.Repo{repoName: tc.repo}})
+			if err != nil && !tc.expectError {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err == nil && tc.expectError {
+				t.Error("expected error, got none")
+			}
+			if diff := cmp.Diff(tc.expectedTopics, fc.repos[repoName].Topics); diff != "" {
+				t.Errorf("unexpected topics (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedCollaborators, fc.collaborators[repoName]); diff != "" {
+				t.Errorf("unexpected collaborators (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedHooks, fc.hooks[repoName]); diff != "" {
+				t.Errorf("unexpected webhooks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestValidateRepos(t *testing.T) {
 	description := "cool repo"
 	testCases := []struct {
@@ -3027,6 +3349,44 @@ func TestValidateRepos(t *testing.T) {
 				"repo": {Previously: []string{"REPO"}},
 			},
 		},
+		{
+			description: "handles valid collaborators, topics and webhooks",
+			config: map[string]org.Repo{
+				"repo": {
+					Collaborators: map[string]github.RepoPermissionLevel{"alice": github.Maintain},
+					Topics:        []string{"go", "continuous-integration"},
+					Webhooks:      []org.Webhook{{URL: "https://a"}, {URL: "https://b"}},
+				},
+			},
+		},
+		{
+			description: "finds collaborators without permission",
+			config: map[string]org.Repo{
+				"repo": {Collaborators: map[string]github.RepoPermissionLevel{"alice": github.None}},
+			},
+			expectError: true,
+		},
+		{
+			description: "finds invalid topics",
+			config: map[string]org.Repo{
+				"repo": {Topics: []string{"Go"}},
+			},
+			expectError: true,
+		},
+		{
+			description: "finds webhooks without url",
+			config: map[string]org.Repo{
+				"repo": {Webhooks: []org.Webhook{{Events: []string{"push"}}}},
+			},
+			expectError: true,
+		},
+		{
+			description: "finds duplicate webhooks",
+			config: map[string]org.Repo{
+				"repo": {Webhooks: []org.Webhook{{URL: "https://a"}, {URL: "https://a"}}},
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tc := range testCases {
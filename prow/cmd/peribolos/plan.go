@@ -0,0 +1,784 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// changeKind is the kind of the object that a change mutates.
+type changeKind string
+
+const (
+	kindOrg          changeKind = "org"
+	kindMember       changeKind = "member"
+	kindTeam         changeKind = "team"
+	kindTeamMember   changeKind = "team_member"
+	kindTeamRepo     changeKind = "team_repo"
+	kindRepo         changeKind = "repo"
+	kindTopics       changeKind = "topics"
+	kindCollaborator changeKind = "collaborator"
+	kindWebhook      changeKind = "webhook"
+)
+
+// kinds lists the kinds of changes in the order they are rendered, with
+// their singular and plural names.
+var kinds = []struct {
+	kind             changeKind
+	singular, plural string
+}{
+	{kindOrg, "org metadata", "org metadata"},
+	{kindMember, "member", "members"},
+	{kindTeam, "team", "teams"},
+	{kindTeamMember, "team member", "team members"},
+	{kindTeamRepo, "team repo permission", "team repo permissions"},
+	{kindRepo, "repo", "repos"},
+	{kindTopics, "repo topic list", "repo topic lists"},
+	{kindCollaborator, "collaborator", "collaborators"},
+	{kindWebhook, "webhook", "webhooks"},
+}
+
+type changeAction string
+
+const (
+	actionAdd    changeAction = "add"
+	actionUpdate changeAction = "update"
+	actionRemove changeAction = "remove"
+)
+
+var actions = []changeAction{actionAdd, actionUpdate, actionRemove}
+
+// Change is a mutation of an org planned by peribolos.
+type Change struct {
+	Org    string       `json:"org"`
+	Kind   changeKind   `json:"kind"`
+	Action changeAction `json:"action"`
+	// Target names the mutated object, like a login, a team or a repo.
+	Target string `json:"target"`
+	// Details describe the change, like the role of a member.
+	Details string `json:"details,omitempty"`
+
+	// apply makes the change, with the IDs of the teams created by the
+	// previous changes.
+	apply func(client github.Client, teamIDs map[int]int) error
+}
+
+// Plan lists the changes that configure the orgs, in the order they are applied.
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+func (p *Plan) add(c Change) {
+	p.Changes = append(p.Changes, c)
+}
+
+// Apply makes exactly the changes of the plan, in order.
+func (p *Plan) Apply(client github.Client) error {
+	teamIDs := map[int]int{}
+	var errs []error
+	for _, change := range p.Changes {
+		if err := change.apply(client, teamIDs); err != nil {
+			errs = append(errs, fmt.Errorf("failed to %s %s %s in %s: %w", change.Action, change.Kind, change.Target, change.Org, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// sorted returns the changes grouped by org, kind and target, so that the
+// rendered plans are stable.
+func (p *Plan) sorted() []Change {
+	order := map[changeKind]int{}
+	for i, k := range kinds {
+		order[k.kind] = i
+	}
+	changes := append([]Change(nil), p.Changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		switch {
+		case a.Org != b.Org:
+			return a.Org < b.Org
+		case a.Kind != b.Kind:
+			return order[a.Kind] < order[b.Kind]
+		case a.Target != b.Target:
+			return a.Target < b.Target
+		default:
+			return a.Details < b.Details
+		}
+	})
+	return changes
+}
+
+// Summary describes the changes to an org, like "add 3 members and remove 1 team".
+func (p *Plan) Summary(orgName string) string {
+	counts := map[changeKind]map[changeAction]int{}
+	for _, change := range p.Changes {
+		if change.Org != orgName {
+			continue
+		}
+		if counts[change.Kind] == nil {
+			counts[change.Kind] = map[changeAction]int{}
+		}
+		counts[change.Kind][change.Action]++
+	}
+	var parts []string
+	for _, action := range actions {
+		for _, k := range kinds {
+			n := counts[k.kind][action]
+			switch {
+			case n == 0:
+			case k.kind == kindOrg:
+				parts = append(parts, fmt.Sprintf("%s the %s", action, k.singular))
+			case n == 1:
+				parts = append(parts, fmt.Sprintf("%s 1 %s", action, k.singular))
+			default:
+				parts = append(parts, fmt.Sprintf("%s %d %s", action, n, k.plural))
+			}
+		}
+	}
+	switch len(parts) {
+	case 0:
+		return "change nothing"
+	case 1:
+		return parts[0]
+	default:
+		return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+	}
+}
+
+func (p *Plan) orgs() []string {
+	orgs := sets.NewString()
+	for _, change := range p.Changes {
+		orgs.Insert(change.Org)
+	}
+	return orgs.List()
+}
+
+// WriteMarkdown renders the plan as a Markdown table per org.
+func (p *Plan) WriteMarkdown(w io.Writer, orgNames []string) error {
+	var b strings.Builder
+	b.WriteString("# Peribolos plan\n")
+	changes := p.sorted()
+	for _, orgName := range sets.NewString(orgNames...).Insert(p.orgs()...).List() {
+		fmt.Fprintf(&b, "\n## %s\n\nThis change will %s.\n", orgName, p.Summary(orgName))
+		first := true
+		for _, change := range changes {
+			if change.Org != orgName {
+				continue
+			}
+			if first {
+				b.WriteString("\n| Kind | Action | Target | Details |\n| --- | --- | --- | --- |\n")
+				first = false
+			}
+			fmt.Fprintf(&b, "| %s | %s | `%s` | %s |\n", change.Kind, change.Action, change.Target, strings.ReplaceAll(change.Details, "|", `\|`))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON renders the plan as JSON, with the summary of every org.
+func (p *Plan) WriteJSON(w io.Writer, orgNames []string) error {
+	out := struct {
+		Summaries map[string]string `json:"summaries"`
+		Changes   []Change          `json:"changes"`
+	}{
+		Summaries: map[string]string{},
+		Changes:   p.sorted(),
+	}
+	for _, orgName := range sets.NewString(orgNames...).Insert(p.orgs()...).List() {
+		out.Summaries[orgName] = p.Summary(orgName)
+	}
+	if out.Changes == nil {
+		out.Changes = []Change{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// planClient reads the current state of the orgs from GitHub and records the
+// mutations made by peribolos in a plan instead of making them. The objects
+// that the plan creates or renames are handled when they are read again.
+type planClient struct {
+	github.Client
+	plan *Plan
+
+	orgs          map[string]github.Organization
+	orgMembers    map[string]sets.String
+	teams         map[int]github.Team
+	teamMembers   map[int]sets.String
+	teamRepos     map[int]map[string]github.RepoPermissionLevel
+	collaborators map[string]sets.String
+	hooks         map[string]map[int]github.Hook
+	// renamedRepos maps the repos that the plan renames or creates to their
+	// current names, which are empty for the created repos.
+	renamedRepos map[string]string
+	nextTeamID   int
+}
+
+func newPlanClient(client github.Client, plan *Plan) *planClient {
+	return &planClient{
+		Client:        client,
+		plan:          plan,
+		orgs:          map[string]github.Organization{},
+		orgMembers:    map[string]sets.String{},
+		teams:         map[int]github.Team{},
+		teamMembers:   map[int]sets.String{},
+		teamRepos:     map[int]map[string]github.RepoPermissionLevel{},
+		collaborators: map[string]sets.String{},
+		hooks:         map[string]map[int]github.Hook{},
+		renamedRepos:  map[string]string{},
+	}
+}
+
+func repoKey(org, repo string) string {
+	return org + "/" + repo
+}
+
+// currentRepo returns the current name of the repo and whether it exists.
+func (c *planClient) currentRepo(org, repo string) (string, bool) {
+	current, renamed := c.renamedRepos[repoKey(org, repo)]
+	if !renamed {
+		return repo, true
+	}
+	return current, current != ""
+}
+
+func (c *planClient) GetOrg(name string) (*github.Organization, error) {
+	o, err := c.Client.GetOrg(name)
+	if err != nil {
+		return nil, err
+	}
+	c.orgs[name] = *o
+	return o, nil
+}
+
+func (c *planClient) EditOrg(name string, config github.Organization) (*github.Organization, error) {
+	c.plan.add(Change{
+		Org:     name,
+		Kind:    kindOrg,
+		Action:  actionUpdate,
+		Target:  name,
+		Details: strings.Join(changedFields(c.orgs[name], config), ", "),
+		apply: func(client github.Client, _ map[int]int) error {
+			_, err := client.EditOrg(name, config)
+			return err
+		},
+	})
+	return &config, nil
+}
+
+func (c *planClient) ListOrgMembers(org, role string) ([]github.TeamMember, error) {
+	members, err := c.Client.ListOrgMembers(org, role)
+	if err != nil {
+		return nil, err
+	}
+	if c.orgMembers[org] == nil {
+		c.orgMembers[org] = sets.NewString()
+	}
+	for _, m := range members {
+		c.orgMembers[org].Insert(github.NormLogin(m.Login))
+	}
+	return members, nil
+}
+
+func role(super bool, superRole string) string {
+	if super {
+		return superRole
+	}
+	return github.RoleMember
+}
+
+func (c *planClient) UpdateOrgMembership(org, user string, admin bool) (*github.OrgMembership, error) {
+	action := actionAdd
+	if c.orgMembers[org].Has(github.NormLogin(user)) {
+		action = actionUpdate
+	}
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindMember,
+		Action:  action,
+		Target:  user,
+		Details: "role " + role(admin, github.RoleAdmin),
+		apply: func(client github.Client, _ map[int]int) error {
+			_, err := client.UpdateOrgMembership(org, user, admin)
+			return err
+		},
+	})
+	return &github.OrgMembership{Membership: github.Membership{Role: role(admin, github.RoleAdmin), State: github.StatePending}}, nil
+}
+
+func (c *planClient) RemoveOrgMembership(org, user string) error {
+	c.plan.add(Change{
+		Org:    org,
+		Kind:   kindMember,
+		Action: actionRemove,
+		Target: user,
+		apply: func(client github.Client, _ map[int]int) error {
+			return client.RemoveOrgMembership(org, user)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) ListTeams(org string) ([]github.Team, error) {
+	teams, err := c.Client.ListTeams(org)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range teams {
+		c.teams[t.ID] = t
+	}
+	return teams, nil
+}
+
+// resolveTeamID returns the ID of a team, which is negative for the teams
+// created by the plan until they are created.
+func resolveTeamID(teamIDs map[int]int, id int) (int, error) {
+	if id >= 0 {
+		return id, nil
+	}
+	if created, ok := teamIDs[id]; ok {
+		return created, nil
+	}
+	return 0, fmt.Errorf("team %d was not created", id)
+}
+
+func (c *planClient) CreateTeam(org string, team github.Team) (*github.Team, error) {
+	c.nextTeamID--
+	planned := c.nextTeamID
+	details := []string{}
+	if team.Privacy != "" {
+		details = append(details, "privacy "+team.Privacy)
+	}
+	if team.Description != "" {
+		details = append(details, fmt.Sprintf("description %q", team.Description))
+	}
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindTeam,
+		Action:  actionAdd,
+		Target:  team.Name,
+		Details: strings.Join(details, ", "),
+		apply: func(client github.Client, teamIDs map[int]int) error {
+			created, err := client.CreateTeam(org, team)
+			if err != nil {
+				return err
+			}
+			teamIDs[planned] = created.ID
+			return nil
+		},
+	})
+	team.ID = planned
+	c.teams[planned] = team
+	return &team, nil
+}
+
+func (c *planClient) EditTeam(org string, t github.Team) (*github.Team, error) {
+	var details []string
+	if old, ok := c.teams[t.ID]; ok {
+		if old.Name != t.Name {
+			details = append(details, fmt.Sprintf("rename from %s", old.Name))
+		}
+		if t.Description != "" && old.Description != t.Description {
+			details = append(details, fmt.Sprintf("description %q", t.Description))
+		}
+		if t.Privacy != "" && old.Privacy != t.Privacy {
+			details = append(details, "privacy "+t.Privacy)
+		}
+	}
+	switch {
+	case t.ParentTeamID != nil:
+		details = append(details, "parent "+c.teams[*t.ParentTeamID].Name)
+	case t.Parent == nil && c.teams[t.ID].Parent != nil:
+		details = append(details, "no parent")
+	}
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindTeam,
+		Action:  actionUpdate,
+		Target:  t.Name,
+		Details: strings.Join(details, ", "),
+		apply: func(client github.Client, teamIDs map[int]int) error {
+			edited := t
+			var err error
+			if edited.ID, err = resolveTeamID(teamIDs, t.ID); err != nil {
+				return err
+			}
+			if t.ParentTeamID != nil {
+				parent, err := resolveTeamID(teamIDs, *t.ParentTeamID)
+				if err != nil {
+					return err
+				}
+				edited.ParentTeamID = &parent
+			}
+			_, err = client.EditTeam(org, edited)
+			return err
+		},
+	})
+	return &t, nil
+}
+
+func (c *planClient) DeleteTeam(org string, id int) error {
+	c.plan.add(Change{
+		Org:    org,
+		Kind:   kindTeam,
+		Action: actionRemove,
+		Target: c.teams[id].Name,
+		apply: func(client github.Client, _ map[int]int) error {
+			return client.DeleteTeam(org, id)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error) {
+	if id < 0 {
+		return nil, nil
+	}
+	members, err := c.Client.ListTeamMembers(org, id, role)
+	if err != nil {
+		return nil, err
+	}
+	if c.teamMembers[id] == nil {
+		c.teamMembers[id] = sets.NewString()
+	}
+	for _, m := range members {
+		c.teamMembers[id].Insert(github.NormLogin(m.Login))
+	}
+	return members, nil
+}
+
+func (c *planClient) ListTeamInvitations(org string, id int) ([]github.OrgInvitation, error) {
+	if id < 0 {
+		return nil, nil
+	}
+	return c.Client.ListTeamInvitations(org, id)
+}
+
+func (c *planClient) UpdateTeamMembership(org string, id int, user string, maintainer bool) (*github.TeamMembership, error) {
+	action := actionAdd
+	if c.teamMembers[id].Has(github.NormLogin(user)) {
+		action = actionUpdate
+	}
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindTeamMember,
+		Action:  action,
+		Target:  user,
+		Details: fmt.Sprintf("team %s, role %s", c.teams[id].Name, role(maintainer, github.RoleMaintainer)),
+		apply: func(client github.Client, teamIDs map[int]int) error {
+			teamID, err := resolveTeamID(teamIDs, id)
+			if err != nil {
+				return err
+			}
+			_, err = client.UpdateTeamMembership(org, teamID, user, maintainer)
+			return err
+		},
+	})
+	return &github.TeamMembership{Membership: github.Membership{Role: role(maintainer, github.RoleMaintainer), State: github.StatePending}}, nil
+}
+
+func (c *planClient) RemoveTeamMembership(org string, id int, user string) error {
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindTeamMember,
+		Action:  actionRemove,
+		Target:  user,
+		Details: "team " + c.teams[id].Name,
+		apply: func(client github.Client, teamIDs map[int]int) error {
+			teamID, err := resolveTeamID(teamIDs, id)
+			if err != nil {
+				return err
+			}
+			return client.RemoveTeamMembership(org, teamID, user)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) ListTeamRepos(org string, id int) ([]github.Repo, error) {
+	if id < 0 {
+		return nil, nil
+	}
+	repos, err := c.Client.ListTeamRepos(org, id)
+	if err != nil {
+		return nil, err
+	}
+	c.teamRepos[id] = map[string]github.RepoPermissionLevel{}
+	for _, repo := range repos {
+		c.teamRepos[id][repo.Name] = github.LevelFromPermissions(repo.Permissions)
+	}
+	return repos, nil
+}
+
+func (c *planClient) UpdateTeamRepo(id int, org, repo string, permission github.TeamPermission) error {
+	action := actionAdd
+	if _, ok := c.teamRepos[id][repo]; ok {
+		action = actionUpdate
+	}
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindTeamRepo,
+		Action:  action,
+		Target:  repo,
+		Details: fmt.Sprintf("team %s, permission %s", c.teams[id].Name, permission),
+		apply: func(client github.Client, teamIDs map[int]int) error {
+			teamID, err := resolveTeamID(teamIDs, id)
+			if err != nil {
+				return err
+			}
+			return client.UpdateTeamRepo(teamID, org, repo, permission)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) RemoveTeamRepo(id int, org, repo string) error {
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindTeamRepo,
+		Action:  actionRemove,
+		Target:  repo,
+		Details: "team " + c.teams[id].Name,
+		apply: func(client github.Client, teamIDs map[int]int) error {
+			teamID, err := resolveTeamID(teamIDs, id)
+			if err != nil {
+				return err
+			}
+			return client.RemoveTeamRepo(teamID, org, repo)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) CreateRepo(owner string, isUser bool, repo github.RepoCreateRequest) (*github.FullRepo, error) {
+	name := ""
+	if repo.Name != nil {
+		name = *repo.Name
+	}
+	c.plan.add(Change{
+		Org:     owner,
+		Kind:    kindRepo,
+		Action:  actionAdd,
+		Target:  name,
+		Details: strings.Join(changedFields(struct{}{}, repo), ", "),
+		apply: func(client github.Client, _ map[int]int) error {
+			_, err := client.CreateRepo(owner, isUser, repo)
+			return err
+		},
+	})
+	c.renamedRepos[repoKey(owner, name)] = ""
+	return repo.ToRepo(), nil
+}
+
+func (c *planClient) UpdateRepo(owner, name string, repo github.RepoUpdateRequest) (*github.FullRepo, error) {
+	fields := changedFields(struct{}{}, repo)
+	if repo.Name != nil && *repo.Name != name {
+		c.renamedRepos[repoKey(owner, *repo.Name)] = name
+		for i, field := range fields {
+			if strings.HasPrefix(field, "name: ") {
+				fields[i] = "rename from " + name
+			}
+		}
+	}
+	target := name
+	if repo.Name != nil {
+		target = *repo.Name
+	}
+	c.plan.add(Change{
+		Org:     owner,
+		Kind:    kindRepo,
+		Action:  actionUpdate,
+		Target:  target,
+		Details: strings.Join(fields, ", "),
+		apply: func(client github.Client, _ map[int]int) error {
+			_, err := client.UpdateRepo(owner, name, repo)
+			return err
+		},
+	})
+	return repo.ToRepo(), nil
+}
+
+func (c *planClient) ReplaceRepoTopics(org, repo string, topics []string) error {
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindTopics,
+		Action:  actionUpdate,
+		Target:  repo,
+		Details: strings.Join(topics, ", "),
+		apply: func(client github.Client, _ map[int]int) error {
+			return client.ReplaceRepoTopics(org, repo, topics)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) ListOutsideCollaborators(org, repo string) ([]github.User, error) {
+	current, exists := c.currentRepo(org, repo)
+	if !exists {
+		return nil, nil
+	}
+	users, err := c.Client.ListOutsideCollaborators(org, current)
+	if err != nil {
+		return nil, err
+	}
+	c.collaborators[repoKey(org, repo)] = sets.NewString()
+	for _, user := range users {
+		c.collaborators[repoKey(org, repo)].Insert(github.NormLogin(user.Login))
+	}
+	return users, nil
+}
+
+func (c *planClient) ListRepoInvitations(org, repo string) ([]github.RepoInvitation, error) {
+	current, exists := c.currentRepo(org, repo)
+	if !exists {
+		return nil, nil
+	}
+	return c.Client.ListRepoInvitations(org, current)
+}
+
+func (c *planClient) AddCollaborator(org, repo, user string, permission github.TeamPermission) error {
+	action := actionAdd
+	if c.collaborators[repoKey(org, repo)].Has(github.NormLogin(user)) {
+		action = actionUpdate
+	}
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindCollaborator,
+		Action:  action,
+		Target:  user,
+		Details: fmt.Sprintf("repo %s, permission %s", repo, permission),
+		apply: func(client github.Client, _ map[int]int) error {
+			return client.AddCollaborator(org, repo, user, permission)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) RemoveCollaborator(org, repo, user string) error {
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindCollaborator,
+		Action:  actionRemove,
+		Target:  user,
+		Details: "repo " + repo,
+		apply: func(client github.Client, _ map[int]int) error {
+			return client.RemoveCollaborator(org, repo, user)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) ListRepoHooks(org, repo string) ([]github.Hook, error) {
+	current, exists := c.currentRepo(org, repo)
+	if !exists {
+		return nil, nil
+	}
+	hooks, err := c.Client.ListRepoHooks(org, current)
+	if err != nil {
+		return nil, err
+	}
+	c.hooks[repoKey(org, repo)] = map[int]github.Hook{}
+	for _, hook := range hooks {
+		c.hooks[repoKey(org, repo)][hook.ID] = hook
+	}
+	return hooks, nil
+}
+
+func (c *planClient) CreateRepoHook(org, repo string, req github.HookRequest) (int, error) {
+	var url string
+	if req.Config != nil {
+		url = req.Config.URL
+	}
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindWebhook,
+		Action:  actionAdd,
+		Target:  url,
+		Details: fmt.Sprintf("repo %s, events %s", repo, strings.Join(req.Events, ", ")),
+		apply: func(client github.Client, _ map[int]int) error {
+			_, err := client.CreateRepoHook(org, repo, req)
+			return err
+		},
+	})
+	return 0, nil
+}
+
+func (c *planClient) EditRepoHook(org, repo string, id int, req github.HookRequest) error {
+	details := fmt.Sprintf("repo %s, events %s", repo, strings.Join(req.Events, ", "))
+	if req.Active != nil && !*req.Active {
+		details += ", inactive"
+	}
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindWebhook,
+		Action:  actionUpdate,
+		Target:  c.hooks[repoKey(org, repo)][id].Config.URL,
+		Details: details,
+		apply: func(client github.Client, _ map[int]int) error {
+			return client.EditRepoHook(org, repo, id, req)
+		},
+	})
+	return nil
+}
+
+func (c *planClient) DeleteRepoHook(org, repo string, id int, req github.HookRequest) error {
+	c.plan.add(Change{
+		Org:     org,
+		Kind:    kindWebhook,
+		Action:  actionRemove,
+		Target:  c.hooks[repoKey(org, repo)][id].Config.URL,
+		Details: "repo " + repo,
+		apply: func(client github.Client, _ map[int]int) error {
+			return client.DeleteRepoHook(org, repo, id, req)
+		},
+	})
+	return nil
+}
+
+// changedFields lists the JSON fields of the request that differ from the
+// current object with their values, like "has_wiki: false". All the set
+// fields of the request are listed when the current object is empty.
+func changedFields(current, request interface{}) []string {
+	toMap := func(obj interface{}) map[string]interface{} {
+		out := map[string]interface{}{}
+		if raw, err := json.Marshal(obj); err == nil {
+			_ = json.Unmarshal(raw, &out)
+		}
+		return out
+	}
+	have, want := toMap(current), toMap(request)
+	var fields []string
+	for field, value := range want {
+		if haveValue, ok := have[field]; !ok || fmt.Sprint(haveValue) != fmt.Sprint(value) {
+			fields = append(fields, fmt.Sprintf("%s: %v", field, value))
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,314 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"k8s.io/test-infra/prow/config/org"
+	"k8s.io/test-infra/prow/github"
+)
+
+// fakeOrgGitHub serves the state of an org and records the mutations.
+type fakeOrgGitHub struct {
+	github.Client
+	org         github.Organization
+	admins      []string
+	members     []string
+	teams       []github.Team
+	teamMembers map[int][]string
+	repos       []github.FullRepo
+	mutations   []string
+}
+
+func teamMembers(logins []string) []github.TeamMember {
+	var members []github.TeamMember
+	for _, login := range logins {
+		members = append(members, github.TeamMember{Login: login})
+	}
+	return members
+}
+
+func (f *fakeOrgGitHub) GetOrg(name string) (*github.Organization, error) {
+	o := f.org
+	return &o, nil
+}
+
+func (f *fakeOrgGitHub) ListOrgInvitations(org string) ([]github.OrgInvitation, error) {
+	return nil, nil
+}
+
+func (f *fakeOrgGitHub) ListOrgMembers(org, role string) ([]github.TeamMember, error) {
+	if role == github.RoleAdmin {
+		return teamMembers(f.admins), nil
+	}
+	return teamMembers(f.members), nil
+}
+
+func (f *fakeOrgGitHub) ListTeams(org string) ([]github.Team, error) {
+	return f.teams, nil
+}
+
+func (f *fakeOrgGitHub) ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error) {
+	if role == github.RoleMaintainer {
+		return nil, nil
+	}
+	return teamMembers(f.teamMembers[id]), nil
+}
+
+func (f *fakeOrgGitHub) ListTeamInvitations(org string, id int) ([]github.OrgInvitation, error) {
+	return nil, nil
+}
+
+func (f *fakeOrgGitHub) ListTeamRepos(org string, id int) ([]github.Repo, error) {
+	return nil, nil
+}
+
+func (f *fakeOrgGitHub) GetRepos(org string, isUser bool) ([]github.Repo, error) {
+	var repos []github.Repo
+	for _, repo := range f.repos {
+		repos = append(repos, repo.Repo)
+	}
+	return repos, nil
+}
+
+func (f *fakeOrgGitHub) GetRepo(owner, name string) (github.FullRepo, error) {
+	for _, repo := range f.repos {
+		if repo.Name == name {
+			return repo, nil
+		}
+	}
+	return github.FullRepo{}, fmt.Errorf("repo %s not found", name)
+}
+
+func (f *fakeOrgGitHub) EditOrg(name string, config github.Organization) (*github.Organization, error) {
+	f.mutations = append(f.mutations, fmt.Sprintf("EditOrg(%s, company %s)", name, config.Company))
+	return &config, nil
+}
+
+func (f *fakeOrgGitHub) UpdateOrgMembership(org, user string, admin bool) (*github.OrgMembership, error) {
+	f.mutations = append(f.mutations, fmt.Sprintf("UpdateOrgMembership(%s, %t)", user, admin))
+	return &github.OrgMembership{}, nil
+}
+
+func (f *fakeOrgGitHub) RemoveOrgMembership(org, user string) error {
+	f.mutations = append(f.mutations, fmt.Sprintf("RemoveOrgMembership(%s)", user))
+	return nil
+}
+
+func (f *fakeOrgGitHub) CreateTeam(org string, team github.Team) (*github.Team, error) {
+	f.mutations = append(f.mutations, fmt.Sprintf("CreateTeam(%s)", team.Name))
+	team.ID = 100
+	return &team, nil
+}
+
+func (f *fakeOrgGitHub) DeleteTeam(org string, id int) error {
+	f.mutations = append(f.mutations, fmt.Sprintf("DeleteTeam(%d)", id))
+	return nil
+}
+
+func (f *fakeOrgGitHub) UpdateTeamMembership(org string, id int, user string, maintainer bool) (*github.TeamMembership, error) {
+	f.mutations = append(f.mutations, fmt.Sprintf("UpdateTeamMembership(%d, %s, %t)", id, user, maintainer))
+	return &github.TeamMembership{}, nil
+}
+
+func (f *fakeOrgGitHub) UpdateTeamRepo(id int, org, repo string, permission github.TeamPermission) error {
+	f.mutations = append(f.mutations, fmt.Sprintf("UpdateTeamRepo(%d, %s, %s)", id, repo, permission))
+	return nil
+}
+
+func (f *fakeOrgGitHub) UpdateRepo(owner, name string, repo github.RepoUpdateRequest) (*github.FullRepo, error) {
+	f.mutations = append(f.mutations, fmt.Sprintf("UpdateRepo(%s, description %s)", name, *repo.Description))
+	return repo.ToRepo(), nil
+}
+
+func (f *fakeOrgGitHub) ReplaceRepoTopics(org, repo string, topics []string) error {
+	f.mutations = append(f.mutations, fmt.Sprintf("ReplaceRepoTopics(%s, %v)", repo, topics))
+	return nil
+}
+
+func TestPlanAndApply(t *testing.T) {
+	newCompany := "new"
+	newDescription := "new description"
+	opts := options{
+		minAdmins:      2,
+		maximumDelta:   1,
+		fixOrg:         true,
+		fixOrgMembers:  true,
+		fixTeams:       true,
+		fixTeamMembers: true,
+		fixTeamRepos:   true,
+		fixRepos:       true,
+	}
+	orgConfig := org.Config{
+		Metadata: org.Metadata{Company: &newCompany},
+		Admins:   []string{"admin1", "admin2"},
+		Members:  []string{"member1", "member3"},
+		Teams: map[string]org.Team{
+			"new-team": {
+				Members:     []string{"member3"},
+				Maintainers: []string{"admin1"},
+				Repos:       map[string]github.RepoPermissionLevel{"repo": github.Write},
+			},
+		},
+		Repos: map[string]org.Repo{
+			"repo": {Description: &newDescription, Topics: []string{"go"}},
+		},
+	}
+	fake := &fakeOrgGitHub{
+		org:         github.Organization{Company: "old"},
+		admins:      []string{"admin1", "admin2"},
+		members:     []string{"member1", "member2"},
+		teams:       []github.Team{{ID: 1, Name: "old-team"}},
+		teamMembers: map[int][]string{1: {"member1"}},
+		repos:       []github.FullRepo{{Repo: github.Repo{Name: "repo", Description: "old description"}}},
+	}
+
+	plan := &Plan{}
+	if err := configureOrg(opts, newPlanClient(fake, plan), "org", orgConfig); err != nil {
+		t.Fatalf("unexpected error planning: %v", err)
+	}
+	if len(fake.mutations) != 0 {
+		t.Fatalf("planning mutated the org: %v", fake.mutations)
+	}
+
+	expectedChanges := []Change{
+		{Org: "org", Kind: kindOrg, Action: actionUpdate, Target: "org", Details: "company: new"},
+		{Org: "org", Kind: kindMember, Action: actionRemove, Target: "member2"},
+		{Org: "org", Kind: kindMember, Action: actionAdd, Target: "member3", Details: "role member"},
+		{Org: "org", Kind: kindTeam, Action: actionAdd, Target: "new-team"},
+		{Org: "org", Kind: kindTeam, Action: actionRemove, Target: "old-team"},
+		{Org: "org", Kind: kindTeamMember, Action: actionAdd, Target: "admin1", Details: "team new-team, role maintainer"},
+		{Org: "org", Kind: kindTeamMember, Action: actionAdd, Target: "member3", Details: "team new-team, role member"},
+		{Org: "org", Kind: kindTeamRepo, Action: actionAdd, Target: "repo", Details: "team new-team, permission push"},
+		{Org: "org", Kind: kindRepo, Action: actionUpdate, Target: "repo", Details: "description: new description"},
+		{Org: "org", Kind: kindTopics, Action: actionUpdate, Target: "repo", Details: "go"},
+	}
+	if diff := cmp.Diff(expectedChanges, plan.sorted(), cmpopts.IgnoreUnexported(Change{})); diff != "" {
+		t.Errorf("unexpected plan (-want +got):\n%s", diff)
+	}
+	expectedSummary := "add 1 member, add 1 team, add 2 team members, add 1 team repo permission, update the org metadata, update 1 repo, update 1 repo topic list, remove 1 member and remove 1 team"
+	if summary := plan.Summary("org"); summary != expectedSummary {
+		t.Errorf("expected summary %q, got %q", expectedSummary, summary)
+	}
+
+	if err := plan.Apply(fake); err != nil {
+		t.Fatalf("unexpected error applying: %v", err)
+	}
+	// The changes of the created team are applied after it is created, with its ID.
+	if fake.mutations[0] != "EditOrg(org, company new)" {
+		t.Errorf("expected the org metadata to be edited first, got %v", fake.mutations)
+	}
+	created := -1
+	for i, mutation := range fake.mutations {
+		if mutation == "CreateTeam(new-team)" {
+			created = i
+		}
+		if mutation == "UpdateTeamMembership(100, member3, false)" && (created == -1 || i < created) {
+			t.Errorf("team member added before the team was created: %v", fake.mutations)
+		}
+	}
+	mutations := append([]string(nil), fake.mutations...)
+	sort.Strings(mutations)
+	expectedMutations := []string{
+		"CreateTeam(new-team)",
+		"DeleteTeam(1)",
+		"EditOrg(org, company new)",
+		"RemoveOrgMembership(member2)",
+		"ReplaceRepoTopics(repo, [go])",
+		"UpdateOrgMembership(member3, false)",
+		"UpdateRepo(repo, description new description)",
+		"UpdateTeamMembership(100, admin1, true)",
+		"UpdateTeamMembership(100, member3, false)",
+		"UpdateTeamRepo(100, repo, push)",
+	}
+	if diff := cmp.Diff(expectedMutations, mutations); diff != "" {
+		t.Errorf("unexpected mutations (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyWithoutCreatedTeam(t *testing.T) {
+	plan := &Plan{}
+	pc := newPlanClient(&fakeOrgGitHub{}, plan)
+	team, _ := pc.CreateTeam("org", github.Team{Name: "team"})
+	if _, err := pc.UpdateTeamMembership("org", team.ID, "user", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The team is not created, so that its member cannot be added.
+	plan.Changes = plan.Changes[1:]
+	fake := &fakeOrgGitHub{}
+	if err := plan.Apply(fake); err == nil {
+		t.Error("expected an error")
+	}
+	if len(fake.mutations) != 0 {
+		t.Errorf("unexpected mutations: %v", fake.mutations)
+	}
+}
+
+func TestPlanRendering(t *testing.T) {
+	plan := &Plan{Changes: []Change{
+		{Org: "org", Kind: kindTeam, Action: actionRemove, Target: "old"},
+		{Org: "org", Kind: kindMember, Action: actionAdd, Target: "bob", Details: "role member"},
+		{Org: "org", Kind: kindMember, Action: actionAdd, Target: "alice", Details: "role admin"},
+		{Org: "org", Kind: kindWebhook, Action: actionUpdate, Target: "https://hook", Details: "repo a|b"},
+	}}
+
+	var markdown bytes.Buffer
+	if err := plan.WriteMarkdown(&markdown, []string{"org", "quiet"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedMarkdown := "# Peribolos plan\n" +
+		"\n## org\n\nThis change will add 2 members, update 1 webhook and remove 1 team.\n" +
+		"\n| Kind | Action | Target | Details |\n| --- | --- | --- | --- |\n" +
+		"| member | add | `alice` | role admin |\n" +
+		"| member | add | `bob` | role member |\n" +
+		"| team | remove | `old` |  |\n" +
+		"| webhook | update | `https://hook` | repo a\\|b |\n" +
+		"\n## quiet\n\nThis change will change nothing.\n"
+	if diff := cmp.Diff(expectedMarkdown, markdown.String()); diff != "" {
+		t.Errorf("unexpected markdown (-want +got):\n%s", diff)
+	}
+
+	var raw bytes.Buffer
+	if err := plan.WriteJSON(&raw, []string{"org", "quiet"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded struct {
+		Summaries map[string]string `json:"summaries"`
+		Changes   []Change          `json:"changes"`
+	}
+	if err := json.Unmarshal(raw.Bytes(), &decoded); err != nil {
+		t.Fatalf("unexpected error decoding %s: %v", raw.String(), err)
+	}
+	expectedSummaries := map[string]string{
+		"org":   "add 2 members, update 1 webhook and remove 1 team",
+		"quiet": "change nothing",
+	}
+	if diff := cmp.Diff(expectedSummaries, decoded.Summaries); diff != "" {
+		t.Errorf("unexpected summaries (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(plan.sorted(), decoded.Changes, cmpopts.IgnoreUnexported(Change{})); diff != "" {
+		t.Errorf("unexpected changes (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coreapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/kube"
+	"k8s.io/test-infra/prow/pjutil"
+	"k8s.io/test-infra/prow/pod-utils/decorate"
+)
+
+// podPollInterval is how often the pod of a job is checked while waiting for it.
+var podPollInterval = time.Second
+
+// clusterRunner runs jobs as pods in a (local) cluster, e.g. a kind cluster.
+// Unlike the container runtime mode, the pod is decorated the same way as by
+// plank, so init containers, sidecars and pod-level volumes all work.
+type clusterRunner struct {
+	opts *options
+	pods corev1client.PodInterface
+	// out receives the logs of the job.
+	out io.Writer
+}
+
+func newClusterRunner(opts *options) (*clusterRunner, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if opts.kubeconfig != "" {
+		loadingRules.ExplicitPath = opts.kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.kubeContext}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	namespace := opts.namespace
+	if namespace == "" {
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return nil, fmt.Errorf("failed to determine namespace: %w", err)
+		}
+	}
+	client, err := corev1client.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return &clusterRunner{opts: opts, pods: client.Pods(namespace), out: os.Stdout}, nil
+}
+
+// makePod decorates the pod of the job for local mode, so that its artifacts
+// are copied to outDir on the node instead of being uploaded, and applies the
+// volume and env var options.
+func (opts *options) makePod(pj prowapi.ProwJob, name string) (*coreapi.Pod, error) {
+	if pj.Status.BuildID == "" {
+		// No error possible since this won't use tot.
+		pj.Status.BuildID, _ = pjutil.GetBuildID(pj.Spec.Job, "")
+	}
+	outDir := opts.outDir
+	if outDir == "" {
+		outDir = path.Join("/tmp", strings.Join([]string{"prowjob-out", pj.Spec.Job, pj.Status.BuildID}, "-"))
+	}
+	pod, err := decorate.ProwJobToPodLocal(pj, outDir)
+	if err != nil {
+		return nil, fmt.Errorf("decorate: %w", err)
+	}
+	logrus.WithField("out-dir", outDir).Info("Artifacts will be copied to the output dir on the node instead of being uploaded.")
+
+	pod.Name = name
+	// Remove the created-by-prow label, otherwise sinker will promptly clean
+	// the pod up as there is no associated prowjob.
+	delete(pod.Labels, kube.CreatedByProw)
+	pod.Labels["phaino"] = "true"
+
+	skippedVolumes := sets.NewString(opts.skippedVolumesMounts...)
+	var volumes []coreapi.Volume
+	for _, volume := range pod.Spec.Volumes {
+		if skippedVolumes.Has(volume.Name) {
+			logrus.Infof("Volume %q skipped", volume.Name)
+			continue
+		}
+		if volume.HostPath == nil && volume.EmptyDir == nil {
+			logrus.Warnf("Volume %q is neither an emptyDir nor a hostPath, assuming it is available in the cluster", volume.Name)
+		}
+		volumes = append(volumes, volume)
+	}
+	pod.Spec.Volumes = volumes
+
+	container := testContainer(&pod.Spec)
+	skippedEnvVars := sets.NewString(opts.skippedEnvVars...)
+	for _, c := range [][]coreapi.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range c {
+			var mounts []coreapi.VolumeMount
+			for _, mount := range c[i].VolumeMounts {
+				if !skippedVolumes.Has(mount.Name) {
+					mounts = append(mounts, mount)
+				}
+			}
+			c[i].VolumeMounts = mounts
+		}
+	}
+	var envs []coreapi.EnvVar
+	for _, env := range container.Env {
+		if !skippedEnvVars.Has(env.Name) {
+			envs = append(envs, env)
+		}
+	}
+	for _, name := range sets.StringKeySet(opts.extraEnvVars).List() {
+		envs = append(envs, coreapi.EnvVar{Name: name, Value: opts.extraEnvVars[name]})
+	}
+	container.Env = envs
+
+	for i, mountPath := range sets.StringKeySet(opts.extraVolumesMounts).List() {
+		name := fmt.Sprintf("phaino-extra-%d", i)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, coreapi.Volume{
+			Name:         name,
+			VolumeSource: coreapi.VolumeSource{HostPath: &coreapi.HostPathVolumeSource{Path: opts.extraVolumesMounts[mountPath]}},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, coreapi.VolumeMount{Name: name, MountPath: mountPath})
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if _, err := checkPrivilege(c, pj.Spec.Job, opts.priv); err != nil {
+			return nil, err
+		}
+	}
+	return pod, nil
+}
+
+// testContainer returns the container running the test, whose logs are
+// streamed back.
+func testContainer(spec *coreapi.PodSpec) *coreapi.Container {
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == kube.TestContainerName {
+			return &spec.Containers[i]
+		}
+	}
+	return &spec.Containers[0]
+}
+
+func (r *clusterRunner) run(ctx context.Context, log *logrus.Entry, pj prowapi.ProwJob) error {
+	pod, err := r.opts.makePod(pj, containerID())
+	if err != nil {
+		return fmt.Errorf("convert: %w", err)
+	}
+	if r.opts.printCmd {
+		pod.GetObjectKind().SetGroupVersionKind(coreapi.SchemeGroupVersion.WithKind("Pod"))
+		podYAML, err := yaml.Marshal(pod)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+		fmt.Fprintln(r.out, string(podYAML))
+		return nil
+	}
+
+	var jobTimeout, jobGracePeriod time.Duration
+	if dc := pj.Spec.DecorationConfig; dc != nil {
+		jobTimeout, jobGracePeriod = dc.Timeout.Get(), dc.GracePeriod.Get()
+	}
+	timeout := getTimeout(r.opts.timeout, jobTimeout)
+	if timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	log = log.WithField("pod", pod.Name)
+	log.Info("Creating pod...")
+	if _, err := r.pods.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	// The pod is deleted however the job ends, so that none is left behind.
+	defer func() {
+		grace := getMinimumGracePeriod(minimumGracePeriod, r.opts.grace, jobGracePeriod, log)
+		seconds := int64(grace / time.Second)
+		log.WithField("grace", grace).Info("Deleting pod...")
+		if err := r.pods.Delete(context.Background(), pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &seconds}); err != nil {
+			log.WithError(err).Error("Failed to delete pod")
+		}
+	}()
+
+	err = r.follow(ctx, log, pod.Name, testContainer(&pod.Spec).Name)
+	if ctx.Err() != nil {
+		return fmt.Errorf("aborted: %w", ctx.Err())
+	}
+	return err
+}
+
+// follow streams the logs of the container once it started and waits for the
+// pod to complete.
+func (r *clusterRunner) follow(ctx context.Context, log *logrus.Entry, name, container string) error {
+	log.Info("Waiting for job to start...")
+	pod, err := r.waitForPod(ctx, name, func(pod *coreapi.Pod) bool {
+		return podDone(pod) || containerStarted(pod, container)
+	})
+	if err != nil {
+		return err
+	}
+	if containerStarted(pod, container) {
+		stream, err := r.pods.GetLogs(name, &coreapi.PodLogOptions{Container: container, Follow: true}).Stream(ctx)
+		if err != nil {
+			return fmt.Errorf("logs: %w", err)
+		}
+		defer stream.Close()
+		if _, err := io.Copy(r.out, stream); err != nil && ctx.Err() == nil {
+			log.WithError(err).Warn("Failed to stream logs")
+		}
+	}
+
+	log.Info("Waiting for job to finish...")
+	if pod, err = r.waitForPod(ctx, name, podDone); err != nil {
+		return err
+	}
+	if pod.Status.Phase != coreapi.PodSucceeded {
+		return fmt.Errorf("pod %s: %s", strings.ToLower(string(pod.Status.Phase)), podFailure(pod))
+	}
+	return nil
+}
+
+func (r *clusterRunner) waitForPod(ctx context.Context, name string, condition func(*coreapi.Pod) bool) (*coreapi.Pod, error) {
+	ticker := time.NewTicker(podPollInterval)
+	defer ticker.Stop()
+	for {
+		pod, err := r.pods.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("get: %w", err)
+		}
+		if condition(pod) {
+			return pod, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func podDone(pod *coreapi.Pod) bool {
+	return pod.Status.Phase == coreapi.PodSucceeded || pod.Status.Phase == coreapi.PodFailed
+}
+
+func containerStarted(pod *coreapi.Pod, container string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return status.State.Running != nil || status.State.Terminated != nil
+		}
+	}
+	return false
+}
+
+// podFailure describes why the pod failed, preferring the termination
+// messages of its containers.
+func podFailure(pod *coreapi.Pod) string {
+	var messages []string
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			messages = append(messages, fmt.Sprintf("container %q exited with %d: %s", status.Name, terminated.ExitCode, strings.TrimSpace(terminated.Message)))
+		}
+	}
+	if len(messages) == 0 {
+		return pod.Status.Reason + " " + pod.Status.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// validateOutDir makes sure the output dir is an absolute path, as it is used
+// as a hostPath on the node.
+func validateOutDir(outDir string) error {
+	if outDir != "" && !filepath.IsAbs(outDir) {
+		return errors.New("--out-dir must be an absolute path")
+	}
+	return nil
+}
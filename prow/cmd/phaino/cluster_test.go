@@ -0,0 +1,262 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+	coreapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/kube"
+)
+
+func TestMakePod(t *testing.T) {
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-uuid"},
+		Spec: prowapi.ProwJobSpec{
+			Type: prowapi.PeriodicJob,
+			Job:  "my-job",
+			PodSpec: &coreapi.PodSpec{
+				Containers: []coreapi.Container{{
+					Image: "golang",
+					Env:   []coreapi.EnvVar{{Name: "KEEP", Value: "me"}, {Name: "SKIP", Value: "me"}},
+					VolumeMounts: []coreapi.VolumeMount{
+						{Name: "secret", MountPath: "/secret"},
+						{Name: "cache", MountPath: "/cache"},
+					},
+				}},
+				Volumes: []coreapi.Volume{
+					{Name: "secret", VolumeSource: coreapi.VolumeSource{Secret: &coreapi.SecretVolumeSource{SecretName: "secret"}}},
+					{Name: "cache", VolumeSource: coreapi.VolumeSource{EmptyDir: &coreapi.EmptyDirVolumeSource{}}},
+				},
+			},
+		},
+		Status: prowapi.ProwJobStatus{BuildID: "1234"},
+	}
+	opts := &options{
+		skippedVolumesMounts: []string{"secret"},
+		skippedEnvVars:       []string{"SKIP"},
+		extraEnvVars:         map[string]string{"EXTRA": "env"},
+		extraVolumesMounts:   map[string]string{"/extra": "/node/extra"},
+	}
+
+	pod, err := opts.makePod(pj, "phaino-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Name != "phaino-1" {
+		t.Errorf("expected pod to be named phaino-1, got %q", pod.Name)
+	}
+	if _, ok := pod.Labels[kube.CreatedByProw]; ok {
+		t.Errorf("expected %s label to be removed, got %v", kube.CreatedByProw, pod.Labels)
+	}
+	if pod.Labels["phaino"] != "true" {
+		t.Errorf("expected phaino label, got %v", pod.Labels)
+	}
+
+	expectedVolumes := []coreapi.Volume{
+		{Name: "cache", VolumeSource: coreapi.VolumeSource{EmptyDir: &coreapi.EmptyDirVolumeSource{}}},
+		{Name: "phaino-extra-0", VolumeSource: coreapi.VolumeSource{HostPath: &coreapi.HostPathVolumeSource{Path: "/node/extra"}}},
+	}
+	if diff := cmp.Diff(expectedVolumes, pod.Spec.Volumes); diff != "" {
+		t.Errorf("volumes differ from expected: %s", diff)
+	}
+	container := pod.Spec.Containers[0]
+	if container.Name != kube.TestContainerName {
+		t.Errorf("expected the test container, got %q", container.Name)
+	}
+	expectedMounts := []coreapi.VolumeMount{
+		{Name: "cache", MountPath: "/cache"},
+		{Name: "phaino-extra-0", MountPath: "/extra"},
+	}
+	if diff := cmp.Diff(expectedMounts, container.VolumeMounts); diff != "" {
+		t.Errorf("volume mounts differ from expected: %s", diff)
+	}
+	envs := map[string]string{}
+	for _, env := range container.Env {
+		envs[env.Name] = env.Value
+	}
+	if _, ok := envs["SKIP"]; ok {
+		t.Error("expected SKIP env var to be skipped")
+	}
+	for name, value := range map[string]string{"KEEP": "me", "EXTRA": "env", "BUILD_ID": "1234", "JOB_NAME": "my-job"} {
+		if envs[name] != value {
+			t.Errorf("expected env var %s=%s, got %q", name, value, envs[name])
+		}
+	}
+}
+
+func TestMakePodRejectsPrivileged(t *testing.T) {
+	privileged := true
+	pj := prowapi.ProwJob{Spec: prowapi.ProwJobSpec{
+		Type: prowapi.PeriodicJob,
+		Job:  "my-job",
+		PodSpec: &coreapi.PodSpec{Containers: []coreapi.Container{{
+			Image:           "docker",
+			SecurityContext: &coreapi.SecurityContext{Privileged: &privileged},
+		}}},
+	}}
+	if _, err := (&options{}).makePod(pj, "phaino-1"); err == nil {
+		t.Error("expected privileged job to be rejected")
+	}
+	if _, err := (&options{priv: true}).makePod(pj, "phaino-1"); err != nil {
+		t.Errorf("expected privileged job to be allowed with --privileged, got %v", err)
+	}
+}
+
+func TestClusterRunnerRun(t *testing.T) {
+	podPollInterval = time.Millisecond
+	defer func() { podPollInterval = time.Second }()
+
+	testCases := []struct {
+		name         string
+		status       coreapi.PodStatus
+		expectedErr  string
+		expectedLogs string
+	}{
+		{
+			name: "succeeded pod",
+			status: coreapi.PodStatus{
+				Phase: coreapi.PodSucceeded,
+				ContainerStatuses: []coreapi.ContainerStatus{{
+					Name:  kube.TestContainerName,
+					State: coreapi.ContainerState{Terminated: &coreapi.ContainerStateTerminated{}},
+				}},
+			},
+			expectedLogs: "fake logs",
+		},
+		{
+			name: "failed pod",
+			status: coreapi.PodStatus{
+				Phase: coreapi.PodFailed,
+				ContainerStatuses: []coreapi.ContainerStatus{{
+					Name:  kube.TestContainerName,
+					State: coreapi.ContainerState{Terminated: &coreapi.ContainerStateTerminated{ExitCode: 1, Message: "tests failed\n"}},
+				}},
+			},
+			expectedErr:  `pod failed: container "test" exited with 1: tests failed`,
+			expectedLogs: "fake logs",
+		},
+		{
+			name:        "pod that never starts is aborted after the timeout",
+			status:      coreapi.PodStatus{Phase: coreapi.PodPending},
+			expectedErr: "aborted: context deadline exceeded",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			client.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				action.(clienttesting.CreateAction).GetObject().(*coreapi.Pod).Status = tc.status
+				return false, nil, nil
+			})
+			var out bytes.Buffer
+			r := &clusterRunner{
+				opts: &options{timeout: 100 * time.Millisecond, grace: defaultGracePeriod},
+				pods: client.CoreV1().Pods("default"),
+				out:  &out,
+			}
+			pj := prowapi.ProwJob{Spec: prowapi.ProwJobSpec{
+				Type:    prowapi.PeriodicJob,
+				Job:     "my-job",
+				PodSpec: &coreapi.PodSpec{Containers: []coreapi.Container{{Image: "golang"}}},
+			}}
+
+			err := r.run(context.Background(), logrus.WithField("job", "my-job"), pj)
+			var actualErr string
+			if err != nil {
+				actualErr = err.Error()
+			}
+			if actualErr != tc.expectedErr {
+				t.Errorf("expected error %q, got %q", tc.expectedErr, actualErr)
+			}
+			if out.String() != tc.expectedLogs {
+				t.Errorf("expected logs %q, got %q", tc.expectedLogs, out.String())
+			}
+			pods, err := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("failed to list pods: %v", err)
+			}
+			if len(pods.Items) != 0 {
+				t.Errorf("expected the pod to be deleted, got %v", pods.Items)
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		opts        options
+		expectedErr error
+	}{
+		{
+			name: "docker is valid",
+			opts: options{runtime: "docker"},
+		},
+		{
+			name: "podman is valid",
+			opts: options{runtime: "podman"},
+		},
+		{
+			name:        "unknown runtime is invalid",
+			opts:        options{runtime: "rkt"},
+			expectedErr: errors.New(`--runtime must be one of [docker podman], not "rkt"`),
+		},
+		{
+			name: "cluster options are valid with --cluster",
+			opts: options{runtime: "docker", cluster: true, namespace: "test-pods", outDir: "/tmp/out"},
+		},
+		{
+			name:        "cluster options are invalid without --cluster",
+			opts:        options{runtime: "docker", namespace: "test-pods"},
+			expectedErr: errors.New("--kubeconfig, --context, --namespace and --out-dir may only be specified with --cluster"),
+		},
+		{
+			name:        "local credentials can't be used with --cluster",
+			opts:        options{runtime: "docker", cluster: true, useLocalKubeconfig: true},
+			expectedErr: errors.New("--use-local-gcloud-credentials and --use-local-kubeconfig cannot be used with --cluster"),
+		},
+		{
+			name:        "relative out dir is invalid",
+			opts:        options{runtime: "docker", cluster: true, outDir: "out"},
+			expectedErr: errors.New("--out-dir must be an absolute path"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.validate()
+			if (err == nil) != (tc.expectedErr == nil) || (err != nil && !strings.Contains(err.Error(), tc.expectedErr.Error())) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
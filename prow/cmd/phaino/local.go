@@ -50,7 +50,11 @@ const (
 	defaultCodeMountpath = "/home/prow/go/src"
 )
 
-var baseArgs = []string{"docker", "run", "--rm=true"}
+// runArgs returns the base command for running a container with the given
+// container runtime. Podman is command line compatible with docker.
+func runArgs(runtime string) []string {
+	return []string{runtime, "run", "--rm=true"}
+}
 
 func realPath(p string) (string, error) {
 	if p == "" {
@@ -216,9 +220,9 @@ func checkPrivilege(cont coreapi.Container, pjName string, allow bool) (bool, er
 }
 
 func (opts *options) convertToLocal(ctx context.Context, log *logrus.Entry, pj prowapi.ProwJob, name string) ([]string, error) {
-	log.Info("Converting job into docker run command...")
+	log.Infof("Converting job into %s run command...", opts.runtime)
 	var localArgs []string
-	localArgs = append(localArgs, baseArgs...)
+	localArgs = append(localArgs, runArgs(opts.runtime)...)
 	localArgs = append(localArgs, "--name="+name)
 	container := pj.Spec.PodSpec.Containers[0]
 	decoration := pj.Spec.DecorationConfig
@@ -450,7 +454,7 @@ func (opts *options) resolveRefs(ctx context.Context, volumeMounts map[string]st
 }
 
 func printArgs(localArgs []string) {
-	base := len(baseArgs)
+	base := len(runArgs(""))
 	for i, a := range localArgs {
 		if i < base {
 			fmt.Printf("%q ", a)
@@ -469,8 +473,8 @@ func start(args []string) (*exec.Cmd, error) {
 	return cmd, cmd.Start()
 }
 
-func kill(cid, signal string) error {
-	cmd := exec.Command("docker", "kill", "--signal="+signal, cid)
+func kill(runtime, cid, signal string) error {
+	cmd := exec.Command(runtime, "kill", "--signal="+signal, cid)
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
@@ -530,7 +534,7 @@ func (opts *options) convertJob(ctx context.Context, log *logrus.Entry, pj prowa
 	})
 	abort, cancel := context.WithTimeout(context.Background(), grace)
 	defer cancel()
-	if err := kill(cid, "SIGINT"); err != nil {
+	if err := kill(opts.runtime, cid, "SIGINT"); err != nil {
 		log.WithError(err).Error("Interrupt error")
 	} else {
 		log.Warn("Interrupted container...")
@@ -541,7 +545,7 @@ func (opts *options) convertJob(ctx context.Context, log *logrus.Entry, pj prowa
 		return err
 	case <-abort.Done():
 	}
-	if err := kill(cid, "SIGKILL"); err != nil {
+	if err := kill(opts.runtime, cid, "SIGKILL"); err != nil {
 		return fmt.Errorf("kill: %w", err)
 	}
 	return fmt.Errorf("grace period expired, aborted: %w", ctx.Err())
@@ -30,6 +30,7 @@ import (
 	flag "github.com/spf13/pflag"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/yaml"
 
 	"k8s.io/test-infra/prow/interrupts"
@@ -43,6 +44,8 @@ const (
 	minimumGracePeriod = time.Second
 )
 
+var runtimes = []string{"docker", "podman"}
+
 type options struct {
 	keepGoing     bool
 	printCmd      bool
@@ -61,6 +64,14 @@ type options struct {
 	useLocalGcloudCredentials bool
 	useLocalKubeconfig        bool
 
+	runtime string
+
+	cluster     bool
+	kubeconfig  string
+	kubeContext string
+	namespace   string
+	outDir      string
+
 	jobs []string
 }
 
@@ -87,6 +98,16 @@ func gatherOptions() options {
 	fs.BoolVar(&o.useLocalKubeconfig, "use-local-kubeconfig", false, "Use the same kubeconfig as local, which can be set "+
 		"either by setting env var KUBECONFIG or from ~/.kube/config")
 
+	fs.StringVar(&o.runtime, "runtime", "docker", fmt.Sprintf("The container runtime used to run jobs, one of %v", runtimes))
+
+	fs.BoolVar(&o.cluster, "cluster", false, "Run jobs as fully decorated pods in a cluster (e.g. a kind cluster) instead of with the container runtime. "+
+		"Artifacts are copied to a directory on the node instead of being uploaded")
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Only allowed with --cluster. Path to the kubeconfig of the cluster, defaults to $KUBECONFIG or ~/.kube/config")
+	fs.StringVar(&o.kubeContext, "context", "", "Only allowed with --cluster. The kubeconfig context to use, defaults to the current context")
+	fs.StringVar(&o.namespace, "namespace", "", "Only allowed with --cluster. The namespace to create pods in, defaults to the namespace of the context")
+	fs.StringVar(&o.outDir, "out-dir", "", "Only allowed with --cluster. The absolute path of the directory on the node that artifacts are copied to. "+
+		"Defaults to a directory under /tmp")
+
 	fs.Parse(os.Args[1:])
 	o.jobs = fs.Args()
 	if len(o.gopath) > 0 {
@@ -99,9 +120,28 @@ func gatherOptions() options {
 	if len(o.codeMountPath) == 0 {
 		o.codeMountPath = defaultCodeMountpath
 	}
+	if err := o.validate(); err != nil {
+		logrus.WithError(err).Fatal("Invalid options")
+	}
 	return o
 }
 
+func (o *options) validate() error {
+	if !sets.NewString(runtimes...).Has(o.runtime) {
+		return fmt.Errorf("--runtime must be one of %v, not %q", runtimes, o.runtime)
+	}
+	if !o.cluster {
+		if o.kubeconfig != "" || o.kubeContext != "" || o.namespace != "" || o.outDir != "" {
+			return errors.New("--kubeconfig, --context, --namespace and --out-dir may only be specified with --cluster")
+		}
+		return nil
+	}
+	if o.useLocalGcloudCredentials || o.useLocalKubeconfig {
+		return errors.New("--use-local-gcloud-credentials and --use-local-kubeconfig cannot be used with --cluster")
+	}
+	return validateOutDir(o.outDir)
+}
+
 func validate(pj prowapi.ProwJob) error {
 	switch {
 	case pj.Spec.PodSpec == nil && pj.Spec.Agent != prowapi.KubernetesAgent:
@@ -196,6 +236,15 @@ func jobName(pj prowapi.ProwJob) string {
 func main() {
 	opt := gatherOptions()
 
+	run := opt.convertJob
+	if opt.cluster {
+		runner, err := newClusterRunner(&opt)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to set up cluster mode")
+		}
+		run = runner.run
+	}
+
 	pjs, errs := readPJs(opt.jobs)
 
 	defer func() {
@@ -203,13 +252,13 @@ func main() {
 		interrupts.WaitForGracefulShutdown()
 	}()
 
-	if err := processJobs(interrupts.Context(), opt, pjs, errs); err != nil {
+	if err := processJobs(interrupts.Context(), opt, run, pjs, errs); err != nil {
 		logrus.WithError(err).Fatal("FAILED")
 	}
 	logrus.Info("SUCCESS")
 }
 
-func processJobs(ctx context.Context, opt options, pjs <-chan prowapi.ProwJob, errs <-chan error) error {
+func processJobs(ctx context.Context, opt options, run func(context.Context, *logrus.Entry, prowapi.ProwJob) error, pjs <-chan prowapi.ProwJob, errs <-chan error) error {
 	var cancel func()
 	if opt.totalTimeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, opt.totalTimeout)
@@ -224,7 +273,7 @@ func processJobs(ctx context.Context, opt options, pjs <-chan prowapi.ProwJob, e
 			start := time.Now()
 			log := logrus.WithField("job", jobName(pj))
 			// Start job execution.
-			err := opt.convertJob(ctx, log, pj)
+			err := run(ctx, log, pj)
 			log = log.WithField("duration", time.Since(start))
 			if err != nil {
 				log.WithError(err).Error("FAIL")
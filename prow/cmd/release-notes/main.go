@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// release-notes compiles the release notes of the pull requests merged
+// between two refs of a repository from their release-note blocks and labels.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/pkg/flagutil"
+	"k8s.io/test-infra/prow/config/secret"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/logrusutil"
+)
+
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+)
+
+type options struct {
+	github prowflagutil.GitHubOptions
+	git    prowflagutil.GitOptions
+
+	repo   string
+	from   string
+	to     string
+	format string
+	output string
+	strict bool
+}
+
+func gatherOptions(fs *flag.FlagSet, args ...string) options {
+	var o options
+	fs.StringVar(&o.repo, "repo", "", "Repository to compile the release notes of, like kubernetes/test-infra.")
+	fs.StringVar(&o.from, "from", "", "Ref of the previous release, like a tag. The release notes cover the pull requests merged after it.")
+	fs.StringVar(&o.to, "to", "", "Ref of the release, like a tag or a branch. The release notes cover the pull requests merged up to it.")
+	fs.StringVar(&o.format, "format", formatMarkdown, fmt.Sprintf("Format of the release notes, %q or %q.", formatMarkdown, formatJSON))
+	fs.StringVar(&o.output, "output", "", "File to write the release notes to. Defaults to stdout.")
+	fs.BoolVar(&o.strict, "strict", false, "Exit with an error if a merged pull request has no release note.")
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.git} {
+		group.AddFlags(fs)
+	}
+	fs.Parse(args)
+	return o
+}
+
+func (o *options) Validate() error {
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.git} {
+		if err := group.Validate(true); err != nil {
+			return err
+		}
+	}
+	if parts := strings.Split(o.repo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("--repo must be of the form org/repo, not %q", o.repo)
+	}
+	if o.from == "" || o.to == "" {
+		return errors.New("--from and --to are required")
+	}
+	if o.format != formatMarkdown && o.format != formatJSON {
+		return fmt.Errorf("--format must be %q or %q, not %q", formatMarkdown, formatJSON, o.format)
+	}
+	if o.github.TokenPath == "" {
+		return errors.New("--github-token-path is required")
+	}
+	return nil
+}
+
+func main() {
+	logrusutil.ComponentInit()
+
+	o := gatherOptions(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:]...)
+	if err := o.Validate(); err != nil {
+		logrus.WithError(err).Fatal("Invalid options")
+	}
+
+	githubClient, err := o.github.GitHubClient(true)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting GitHub client.")
+	}
+	gitClient, err := o.git.GitClient(githubClient, secret.GetTokenGenerator(o.github.TokenPath), secret.Censor, true)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting Git client.")
+	}
+
+	org, repo := strings.Split(o.repo, "/")[0], strings.Split(o.repo, "/")[1]
+	notes, err := compileFromRefs(githubClient, gitClient, org, repo, o.from, o.to)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error compiling the release notes.")
+	}
+
+	out := io.Writer(os.Stdout)
+	if o.output != "" {
+		f, err := os.Create(o.output)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error creating the output file.")
+		}
+		defer f.Close()
+		out = f
+	}
+	render := renderMarkdown
+	if o.format == formatJSON {
+		render = renderJSON
+	}
+	if err := render(out, notes); err != nil {
+		logrus.WithError(err).Fatal("Error writing the release notes.")
+	}
+
+	if len(notes.Missing) > 0 {
+		log := logrus.WithField("pull-requests", len(notes.Missing))
+		if o.strict {
+			log.Fatal("Merged pull requests have no release note.")
+		}
+		log.Warn("Merged pull requests have no release note.")
+	}
+}
+
+// compileFromRefs clones the repository to find the pull requests merged
+// between the refs and compiles their release notes.
+func compileFromRefs(ghc githubClient, gc git.ClientFactory, org, repo, from, to string) (*releaseNotes, error) {
+	r, err := gc.ClientFor(org, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone %s/%s: %w", org, repo, err)
+	}
+	defer func() {
+		if err := r.Clean(); err != nil {
+			logrus.WithError(err).Error("Failed to clean up the clone.")
+		}
+	}()
+	base, err := resolveRef(r, from)
+	if err != nil {
+		return nil, err
+	}
+	head, err := resolveRef(r, to)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := r.CommitsBetween(base, head)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := compile(ghc, org, repo, pullRequestNumbers(commits))
+	if err != nil {
+		return nil, err
+	}
+	notes.From, notes.To = from, to
+	return notes, nil
+}
+
+// resolveRef resolves tags and commits, and branches of the remote.
+func resolveRef(r git.RepoClient, ref string) (string, error) {
+	for _, candidate := range []string{ref, "origin/" + ref} {
+		if sha, err := r.RevParse(candidate); err == nil {
+			return strings.TrimSpace(sha), nil
+		}
+	}
+	return "", fmt.Errorf("failed to resolve %q", ref)
+}
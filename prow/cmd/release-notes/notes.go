@@ -0,0 +1,217 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/labels"
+	"k8s.io/test-infra/prow/plugins/releasenote"
+)
+
+const (
+	kindPrefix = "kind/"
+	sigPrefix  = "sig/"
+	otherKind  = "other"
+)
+
+var (
+	// mergeCommitRE matches the subjects of the commits that GitHub creates
+	// when merging a pull request.
+	mergeCommitRE = regexp.MustCompile(`^Merge pull request #(\d+) from `)
+	// squashCommitRE matches the subjects of the commits that GitHub creates
+	// when squashing a pull request.
+	squashCommitRE = regexp.MustCompile(`\(#(\d+)\)$`)
+)
+
+type githubClient interface {
+	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
+}
+
+// note is the release note of a merged pull request.
+type note struct {
+	Number         int      `json:"number"`
+	Title          string   `json:"title"`
+	Author         string   `json:"author"`
+	URL            string   `json:"url"`
+	Note           string   `json:"note,omitempty"`
+	ActionRequired bool     `json:"action_required"`
+	Kinds          []string `json:"kinds,omitempty"`
+	SIGs           []string `json:"sigs,omitempty"`
+}
+
+// releaseNotes are the release notes of the pull requests merged between two refs.
+type releaseNotes struct {
+	Repo  string `json:"repo"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Notes []note `json:"notes"`
+	// Missing are the merged pull requests that have no release note and
+	// were not marked as not needing one.
+	Missing []note `json:"missing,omitempty"`
+}
+
+// pullRequestNumbers returns the numbers of the pull requests that the
+// commits merged, oldest first. Pull requests that were rebased cannot be
+// told apart from direct pushes and are not included.
+func pullRequestNumbers(commits []git.Commit) []int {
+	var numbers []int
+	seen := sets.NewInt()
+	for i := len(commits) - 1; i >= 0; i-- {
+		match := mergeCommitRE.FindStringSubmatch(commits[i].Subject)
+		if match == nil {
+			match = squashCommitRE.FindStringSubmatch(commits[i].Subject)
+		}
+		if match == nil {
+			continue
+		}
+		number, err := strconv.Atoi(match[1])
+		if err != nil || seen.Has(number) {
+			continue
+		}
+		seen.Insert(number)
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// compile classifies the merged pull requests with the rules of the
+// releasenote plugin and collects their release notes.
+func compile(ghc githubClient, org, repo string, numbers []int) (*releaseNotes, error) {
+	notes := &releaseNotes{Repo: fmt.Sprintf("%s/%s", org, repo), Notes: []note{}}
+	for _, number := range numbers {
+		pr, err := ghc.GetPullRequest(org, repo, number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pull request %s/%s#%d: %w", org, repo, number, err)
+		}
+		if !pr.Merged {
+			continue
+		}
+		prLabels := sets.NewString()
+		n := note{Number: pr.Number, Title: pr.Title, Author: pr.User.Login, URL: pr.HTMLURL}
+		for _, label := range pr.Labels {
+			prLabels.Insert(label.Name)
+			switch {
+			case strings.HasPrefix(label.Name, kindPrefix):
+				n.Kinds = append(n.Kinds, strings.TrimPrefix(label.Name, kindPrefix))
+			case strings.HasPrefix(label.Name, sigPrefix):
+				n.SIGs = append(n.SIGs, strings.TrimPrefix(label.Name, sigPrefix))
+			}
+		}
+		sort.Strings(n.Kinds)
+		sort.Strings(n.SIGs)
+		switch releasenote.DetermineReleaseNoteLabel(pr.Body, prLabels) {
+		case labels.ReleaseNoteNone:
+		case labels.ReleaseNoteLabelNeeded:
+			notes.Missing = append(notes.Missing, n)
+		case labels.ReleaseNoteActionRequired:
+			n.ActionRequired = true
+			fallthrough
+		default:
+			n.Note = releasenote.GetReleaseNote(pr.Body)
+			notes.Notes = append(notes.Notes, n)
+		}
+	}
+	return notes, nil
+}
+
+func renderJSON(w io.Writer, notes *releaseNotes) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(notes)
+}
+
+// renderMarkdown writes the notes that require action first, followed by the
+// other notes grouped by the kind of the pull request and the pull requests
+// that are missing a release note.
+func renderMarkdown(w io.Writer, notes *releaseNotes) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Release notes of %s from %s to %s\n", notes.Repo, notes.From, notes.To)
+
+	var actionRequired []note
+	byKind := map[string][]note{}
+	for _, n := range notes.Notes {
+		if n.ActionRequired {
+			actionRequired = append(actionRequired, n)
+			continue
+		}
+		kind := otherKind
+		if len(n.Kinds) > 0 {
+			kind = n.Kinds[0]
+		}
+		byKind[kind] = append(byKind[kind], n)
+	}
+
+	if len(actionRequired) > 0 {
+		b.WriteString("\n## Action required\n\n")
+		writeNotes(&b, actionRequired)
+	}
+	var kinds []string
+	for kind := range byKind {
+		if kind != otherKind {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	if _, ok := byKind[otherKind]; ok {
+		kinds = append(kinds, otherKind)
+	}
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "\n## %s\n\n", strings.Title(strings.ReplaceAll(kind, "-", " ")))
+		writeNotes(&b, byKind[kind])
+	}
+	if len(notes.Notes) == 0 {
+		b.WriteString("\nNo pull request with a release note was merged.\n")
+	}
+	if len(notes.Missing) > 0 {
+		b.WriteString("\n## Missing release notes\n\n")
+		for _, n := range notes.Missing {
+			fmt.Fprintf(&b, "- %s ([#%d](%s), @%s)\n", n.Title, n.Number, n.URL, n.Author)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeNotes(b *strings.Builder, notes []note) {
+	for _, n := range notes {
+		lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(n.Note, "\r\n", "\n")), "\n")
+		fmt.Fprintf(b, "- %s ([#%d](%s), @%s", lines[0], n.Number, n.URL, n.Author)
+		if len(n.SIGs) > 0 {
+			fmt.Fprintf(b, ", SIG %s", strings.Join(n.SIGs, ", "))
+		}
+		b.WriteString(")\n")
+		for _, line := range lines[1:] {
+			if line == "" {
+				b.WriteString("\n")
+				continue
+			}
+			fmt.Fprintf(b, "  %s\n", line)
+		}
+	}
+}
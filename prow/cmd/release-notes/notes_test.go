@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+)
+
+func TestPullRequestNumbers(t *testing.T) {
+	commits := []git.Commit{
+		{SHA: "e", Subject: "Merge pull request #12 from user/branch"},
+		{SHA: "d", Subject: "Fix the flaky test (#11)"},
+		{SHA: "c", Subject: "Bump the version"},
+		{SHA: "b", Subject: "Revert \"Merge pull request #10 from user/other\""},
+		{SHA: "a", Subject: "Merge pull request #10 from user/other"},
+	}
+	if diff := cmp.Diff([]int{10, 11, 12}, pullRequestNumbers(commits)); diff != "" {
+		t.Errorf("unexpected pull request numbers (-want +got):\n%s", diff)
+	}
+}
+
+func pullRequest(number int, merged bool, body string, labels ...string) *github.PullRequest {
+	pr := &github.PullRequest{
+		Number:  number,
+		Title:   "Title",
+		Body:    body,
+		Merged:  merged,
+		User:    github.User{Login: "author"},
+		HTMLURL: "https://github.com/org/repo/pull/1",
+	}
+	for _, label := range labels {
+		pr.Labels = append(pr.Labels, github.Label{Name: label})
+	}
+	return pr
+}
+
+func TestCompile(t *testing.T) {
+	ghc := &fakegithub.FakeClient{PullRequests: map[int]*github.PullRequest{
+		1: pullRequest(1, true, "```release-note\nAdds the --foo flag.\n```", "kind/feature", "sig/testing", "sig/apps"),
+		2: pullRequest(2, true, "```release-note\nNONE\n```", "kind/cleanup"),
+		3: pullRequest(3, true, "No release note.", "kind/bug"),
+		4: pullRequest(4, true, "```release-note\nACTION REQUIRED: Removes the --bar flag.\n```"),
+		5: pullRequest(5, false, "```release-note\nNever merged.\n```"),
+		6: pullRequest(6, true, "", "release-note-none"),
+	}}
+	notes, err := compile(ghc, "org", "repo", []int{1, 2, 3, 4, 5, 6})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &releaseNotes{
+		Repo: "org/repo",
+		Notes: []note{
+			{Number: 1, Title: "Title", Author: "author", URL: "https://github.com/org/repo/pull/1", Note: "Adds the --foo flag.", Kinds: []string{"feature"}, SIGs: []string{"apps", "testing"}},
+			{Number: 4, Title: "Title", Author: "author", URL: "https://github.com/org/repo/pull/1", Note: "ACTION REQUIRED: Removes the --bar flag.", ActionRequired: true},
+		},
+		Missing: []note{
+			{Number: 3, Title: "Title", Author: "author", URL: "https://github.com/org/repo/pull/1", Kinds: []string{"bug"}},
+		},
+	}
+	if diff := cmp.Diff(expected, notes); diff != "" {
+		t.Errorf("unexpected release notes (-want +got):\n%s", diff)
+	}
+
+	if _, err := compile(ghc, "org", "repo", []int{7}); err == nil {
+		t.Error("expected an error for a missing pull request")
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	notes := &releaseNotes{
+		Repo: "org/repo",
+		From: "v1.0.0",
+		To:   "v1.1.0",
+		Notes: []note{
+			{Number: 1, Author: "a", URL: "u1", Note: "Adds the --foo flag.", Kinds: []string{"feature"}, SIGs: []string{"apps", "testing"}},
+			{Number: 2, Author: "b", URL: "u2", Note: "Fixes the crash.\r\n\r\nIt happened on startup.", Kinds: []string{"bug"}},
+			{Number: 3, Author: "c", URL: "u3", Note: "Documents the flags."},
+			{Number: 4, Author: "d", URL: "u4", Note: "ACTION REQUIRED: Removes the --bar flag.", ActionRequired: true, Kinds: []string{"api-change"}},
+			{Number: 5, Author: "e", URL: "u5", Note: "Speeds up the sync.", Kinds: []string{"feature"}},
+		},
+		Missing: []note{{Number: 6, Title: "Refactor", Author: "f", URL: "u6"}},
+	}
+	expected := `# Release notes of org/repo from v1.0.0 to v1.1.0
+
+## Action required
+
+- ACTION REQUIRED: Removes the --bar flag. ([#4](u4), @d)
+
+## Bug
+
+- Fixes the crash. ([#2](u2), @b)
+
+  It happened on startup.
+
+## Feature
+
+- Adds the --foo flag. ([#1](u1), @a, SIG apps, testing)
+- Speeds up the sync. ([#5](u5), @e)
+
+## Other
+
+- Documents the flags. ([#3](u3), @c)
+
+## Missing release notes
+
+- Refactor ([#6](u6), @f)
+`
+	var out bytes.Buffer
+	if err := renderMarkdown(&out, notes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(expected, out.String()); diff != "" {
+		t.Errorf("unexpected markdown (-want +got):\n%s", diff)
+	}
+
+	out.Reset()
+	if err := renderMarkdown(&out, &releaseNotes{Repo: "org/repo", From: "a", To: "b"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "# Release notes of org/repo from a to b\n\nNo pull request with a release note was merged.\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
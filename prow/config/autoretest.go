@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// AutoRetest configures crier to retest presubmits automatically when all
+// the tests that failed in them are known to be flaky.
+type AutoRetest struct {
+	// Repos holds the auto-retest policy of the presubmits of a repository.
+	// The key can be one of '*' for "globally", 'org' or 'org/repo'. The
+	// narrowest match takes precedence.
+	Repos map[string]AutoRetestPolicy `json:"repos,omitempty"`
+}
+
+// AutoRetestPolicy configures the automatic retesting of presubmits.
+type AutoRetestPolicy struct {
+	// MaxRetests is the number of times a presubmit is retested automatically
+	// for the same commit. Zero disables auto-retest.
+	MaxRetests int `json:"max_retests,omitempty"`
+	// Flakes lists regular expressions matching the names of the JUnit test
+	// cases that are known to be flaky. They must match the whole name.
+	Flakes []string `json:"flakes,omitempty"`
+	// LearnFlakes considers a test case flaky for a presubmit once it failed
+	// and then passed in runs of the presubmit for the same commit.
+	LearnFlakes bool `json:"learn_flakes,omitempty"`
+
+	// flakes is the compiled Flakes, set by AutoRetest.DefaultAndValidate.
+	flakes []*regexp.Regexp
+}
+
+// PolicyFor returns the auto-retest policy of the presubmits of org/repo, or
+// nil if they are not retested automatically.
+func (a *AutoRetest) PolicyFor(org, repo string) *AutoRetestPolicy {
+	if a == nil {
+		return nil
+	}
+	for _, key := range []string{org + "/" + repo, org, "*"} {
+		if policy, ok := a.Repos[key]; ok {
+			if policy.MaxRetests == 0 {
+				return nil
+			}
+			return &policy
+		}
+	}
+	return nil
+}
+
+// IsKnownFlake returns whether the test case is on the configured flake list.
+func (p *AutoRetestPolicy) IsKnownFlake(test string) bool {
+	for _, flake := range p.flakes {
+		if flake.MatchString(test) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultAndValidate validates the policies and compiles their flake
+// regular expressions, which are anchored to match whole test names.
+func (a *AutoRetest) DefaultAndValidate() error {
+	var errs []error
+	for key, policy := range a.Repos {
+		if policy.MaxRetests < 0 {
+			errs = append(errs, fmt.Errorf("%s: max_retests must not be negative", key))
+		}
+		policy.flakes = nil
+		for _, flake := range policy.Flakes {
+			re, err := regexp.Compile("^(?:" + flake + ")$")
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid flake regexp %q: %w", key, flake, err))
+				continue
+			}
+			policy.flakes = append(policy.flakes, re)
+		}
+		a.Repos[key] = policy
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import "testing"
+
+func TestAutoRetestPolicyFor(t *testing.T) {
+	autoRetest := &AutoRetest{
+		Repos: map[string]AutoRetestPolicy{
+			"*":             {MaxRetests: 1},
+			"kubernetes":    {MaxRetests: 2, Flakes: []string{"TestFlaky"}},
+			"kubernetes/ci": {},
+		},
+	}
+
+	tests := []struct {
+		org, repo string
+		expected  int
+	}{
+		{org: "other", repo: "repo", expected: 1},
+		{org: "kubernetes", repo: "kubernetes", expected: 2},
+		// A policy without retests disables auto-retest for the repo.
+		{org: "kubernetes", repo: "ci", expected: 0},
+	}
+	for _, test := range tests {
+		policy := autoRetest.PolicyFor(test.org, test.repo)
+		if test.expected == 0 {
+			if policy != nil {
+				t.Errorf("%s/%s: expected no policy, got %+v", test.org, test.repo, policy)
+			}
+			continue
+		}
+		if policy == nil || policy.MaxRetests != test.expected {
+			t.Errorf("%s/%s: expected %d retests, got %+v", test.org, test.repo, test.expected, policy)
+		}
+	}
+
+	var unset *AutoRetest
+	if policy := unset.PolicyFor("kubernetes", "kubernetes"); policy != nil {
+		t.Errorf("expected no policy when auto-retest isn't configured, got %+v", policy)
+	}
+}
+
+func TestAutoRetestValidate(t *testing.T) {
+	valid := &AutoRetest{Repos: map[string]AutoRetestPolicy{"*": {MaxRetests: 1, Flakes: []string{"Test.*Flaky"}}}}
+	if err := valid.DefaultAndValidate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	invalid := &AutoRetest{Repos: map[string]AutoRetestPolicy{
+		"org":      {MaxRetests: -1},
+		"org/repo": {MaxRetests: 1, Flakes: []string{"Test["}},
+	}}
+	if err := invalid.DefaultAndValidate(); err == nil {
+		t.Error("expected an error for the negative retests and the invalid regexp")
+	}
+}
+
+func TestIsKnownFlake(t *testing.T) {
+	autoRetest := &AutoRetest{Repos: map[string]AutoRetestPolicy{"*": {MaxRetests: 1, Flakes: []string{"TestFlaky.*", "TestA|TestB"}}}}
+	if err := autoRetest.DefaultAndValidate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policy := autoRetest.PolicyFor("org", "repo")
+	for test, expected := range map[string]bool{
+		"TestFlaky":           true,
+		"TestFlakyNetwork":    true,
+		"TestA":               true,
+		"TestB":               true,
+		"TestAB":              false,
+		"TestStable":          false,
+		"Suite/TestFlaky":     false,
+		"TestNotFlakyAtAll":   false,
+		"TestStableTestFlaky": false,
+	} {
+		if actual := policy.IsKnownFlake(test); actual != expected {
+			t.Errorf("expected IsKnownFlake(%q) to be %t, got %t", test, expected, actual)
+		}
+	}
+}
@@ -25,6 +25,8 @@ import (
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
 )
 
 // Policy for the config/org/repo/branch.
@@ -56,6 +58,11 @@ type Policy struct {
 	// Include specifies a set of regular expressions which identify branches
 	// that should be included from the protection policy, mutually exclusive with Exclude
 	Include []string `json:"include,omitempty"`
+	// Rulesets configures the repository rulesets by name. Rulesets protect the
+	// branches or tags matching their own patterns, so they can only be
+	// configured globally, for an org or for a repo. The rulesets of a repo
+	// not configured here are deleted, unless no rulesets are configured at all.
+	Rulesets map[string]Ruleset `json:"rulesets,omitempty"`
 }
 
 func (p Policy) defined() bool {
@@ -94,6 +101,51 @@ type Restrictions struct {
 	Teams []string `json:"teams,omitempty"`
 }
 
+// Ruleset configures a GitHub repository ruleset.
+// When merging rulesets of the same name, nil values inherit the parent ruleset
+// and lists are appended to the parent lists.
+type Ruleset struct {
+	// Target is either branch or tag, defaults to branch.
+	Target *string `json:"target,omitempty"`
+	// Enforcement is active, evaluate or disabled, defaults to active.
+	Enforcement *string `json:"enforcement,omitempty"`
+	// Include lists the patterns of the refs the ruleset applies to, such as
+	// refs/heads/release-*, refs/tags/v*, ~DEFAULT_BRANCH or ~ALL.
+	Include []string `json:"include,omitempty"`
+	// Exclude lists the patterns of the refs the ruleset does not apply to.
+	Exclude []string `json:"exclude,omitempty"`
+	// BypassActors appends who may bypass the ruleset.
+	BypassActors []BypassActor `json:"bypass_actors,omitempty"`
+	// RequiredSignatures overrides whether commits must be signed if set.
+	RequiredSignatures *bool `json:"required_signatures,omitempty"`
+	// RequiredLinearHistory overrides whether merge commits are forbidden if set.
+	RequiredLinearHistory *bool `json:"required_linear_history,omitempty"`
+	// RequiredStatusChecks configures the contexts that must be green to merge.
+	RequiredStatusChecks *ContextPolicy `json:"required_status_checks,omitempty"`
+	// RequiredDeployments appends the environments that must be deployed to
+	// successfully before merging.
+	RequiredDeployments []string `json:"required_deployments,omitempty"`
+	// BlockDeletions overrides whether the refs can not be deleted if set.
+	BlockDeletions *bool `json:"block_deletions,omitempty"`
+	// BlockForcePushes overrides whether the refs can not be force pushed if set.
+	BlockForcePushes *bool `json:"block_force_pushes,omitempty"`
+}
+
+// BypassActor may bypass a ruleset. Exactly one of Team, App, RepositoryRole
+// and OrgAdmin must be set.
+type BypassActor struct {
+	// Team is the slug of a team.
+	Team string `json:"team,omitempty"`
+	// App is the ID of a GitHub App.
+	App int `json:"app,omitempty"`
+	// RepositoryRole is the ID of a repository role.
+	RepositoryRole int `json:"repository_role,omitempty"`
+	// OrgAdmin makes the org admins bypass the ruleset.
+	OrgAdmin bool `json:"org_admin,omitempty"`
+	// Mode is always or pull_request, defaults to always.
+	Mode string `json:"mode,omitempty"`
+}
+
 // selectInt returns the child if set, else parent
 func selectInt(parent, child *int) *int {
 	if child != nil {
@@ -164,6 +216,73 @@ func mergeRestrictions(parent, child *Restrictions) *Restrictions {
 	}
 }
 
+func unionBypassActors(parent, child []BypassActor) []BypassActor {
+	if child == nil {
+		return parent
+	}
+	if parent == nil {
+		return child
+	}
+	actors := append([]BypassActor{}, parent...)
+	for _, actor := range child {
+		found := false
+		for _, existing := range actors {
+			if existing == actor {
+				found = true
+				break
+			}
+		}
+		if !found {
+			actors = append(actors, actor)
+		}
+	}
+	return actors
+}
+
+func selectString(parent, child *string) *string {
+	if child != nil {
+		return child
+	}
+	return parent
+}
+
+func mergeRuleset(parent, child Ruleset) Ruleset {
+	return Ruleset{
+		Target:                selectString(parent.Target, child.Target),
+		Enforcement:           selectString(parent.Enforcement, child.Enforcement),
+		Include:               unionStrings(parent.Include, child.Include),
+		Exclude:               unionStrings(parent.Exclude, child.Exclude),
+		BypassActors:          unionBypassActors(parent.BypassActors, child.BypassActors),
+		RequiredSignatures:    selectBool(parent.RequiredSignatures, child.RequiredSignatures),
+		RequiredLinearHistory: selectBool(parent.RequiredLinearHistory, child.RequiredLinearHistory),
+		RequiredStatusChecks:  mergeContextPolicy(parent.RequiredStatusChecks, child.RequiredStatusChecks),
+		RequiredDeployments:   unionStrings(parent.RequiredDeployments, child.RequiredDeployments),
+		BlockDeletions:        selectBool(parent.BlockDeletions, child.BlockDeletions),
+		BlockForcePushes:      selectBool(parent.BlockForcePushes, child.BlockForcePushes),
+	}
+}
+
+// mergeRulesets merges the child rulesets into the parent rulesets of the same name
+func mergeRulesets(parent, child map[string]Ruleset) map[string]Ruleset {
+	if child == nil {
+		return parent
+	}
+	if parent == nil {
+		return child
+	}
+	rulesets := make(map[string]Ruleset, len(parent)+len(child))
+	for name, ruleset := range parent {
+		rulesets[name] = ruleset
+	}
+	for name, ruleset := range child {
+		if p, ok := rulesets[name]; ok {
+			ruleset = mergeRuleset(p, ruleset)
+		}
+		rulesets[name] = ruleset
+	}
+	return rulesets
+}
+
 // Apply returns a policy that merges the child into the parent
 func (p Policy) Apply(child Policy) Policy {
 	return Policy{
@@ -178,6 +297,7 @@ func (p Policy) Apply(child Policy) Policy {
 		RequiredPullRequestReviews: mergeReviewPolicy(p.RequiredPullRequestReviews, child.RequiredPullRequestReviews),
 		Exclude:                    unionStrings(p.Exclude, child.Exclude),
 		Include:                    unionStrings(p.Include, child.Include),
+		Rulesets:                   mergeRulesets(p.Rulesets, child.Rulesets),
 	}
 }
 
@@ -279,6 +399,85 @@ func (bp *BranchProtection) merge(additional *BranchProtection) error {
 	return utilerrors.NewAggregate(errs)
 }
 
+func validateRuleset(name string, r Ruleset) error {
+	var errs []error
+	target := r.EffectiveTarget()
+	if target != github.RulesetTargetBranch && target != github.RulesetTargetTag {
+		errs = append(errs, fmt.Errorf("target must be %s or %s, not %s", github.RulesetTargetBranch, github.RulesetTargetTag, target))
+	}
+	switch enforcement := r.EffectiveEnforcement(); enforcement {
+	case github.RulesetEnforcementActive, github.RulesetEnforcementEvaluate, github.RulesetEnforcementDisabled:
+	default:
+		errs = append(errs, fmt.Errorf("enforcement must be %s, %s or %s, not %s", github.RulesetEnforcementActive, github.RulesetEnforcementEvaluate, github.RulesetEnforcementDisabled, enforcement))
+	}
+	if target == github.RulesetTargetTag && (r.RequiredStatusChecks != nil || r.RequiredDeployments != nil || r.RequiredLinearHistory != nil) {
+		errs = append(errs, errors.New("tag rulesets can not require status checks, deployments or a linear history"))
+	}
+	for _, actor := range r.BypassActors {
+		set := 0
+		for _, isSet := range []bool{actor.Team != "", actor.App != 0, actor.RepositoryRole != 0, actor.OrgAdmin} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			errs = append(errs, fmt.Errorf("bypass actor %+v must set exactly one of team, app, repository_role and org_admin", actor))
+		}
+		if actor.Mode != "" && actor.Mode != github.BypassModeAlways && actor.Mode != github.BypassModePullRequest {
+			errs = append(errs, fmt.Errorf("bypass actor mode must be %s or %s, not %s", github.BypassModeAlways, github.BypassModePullRequest, actor.Mode))
+		}
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return fmt.Errorf("invalid ruleset %s: %w", name, err)
+	}
+	return nil
+}
+
+// validateRulesets validates the rulesets as they are merged for every org and
+// repo, and that none are configured for a branch.
+func (bp BranchProtection) validateRulesets() error {
+	var errs []error
+	// validate validates the merged rulesets that are configured at a level,
+	// the others being the same as those of the parent.
+	validate := func(scope string, configured, merged map[string]Ruleset) {
+		for name := range configured {
+			if err := validateRuleset(name, merged[name]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", scope, err))
+			}
+		}
+	}
+	validate("global", bp.Rulesets, bp.Rulesets)
+	for orgName, org := range bp.Orgs {
+		mergedOrg := bp.GetOrg(orgName)
+		validate(orgName, org.Rulesets, mergedOrg.Rulesets)
+		for repoName, repo := range org.Repos {
+			validate(orgName+"/"+repoName, repo.Rulesets, mergedOrg.GetRepo(repoName).Rulesets)
+			for branchName, branch := range repo.Branches {
+				if branch.Rulesets != nil {
+					errs = append(errs, fmt.Errorf("branch %s of %s/%s configures rulesets, configure them for the repo instead", branchName, orgName, repoName))
+				}
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// EffectiveTarget returns the target of the ruleset, defaulting to branch.
+func (r Ruleset) EffectiveTarget() string {
+	if r.Target == nil {
+		return github.RulesetTargetBranch
+	}
+	return *r.Target
+}
+
+// EffectiveEnforcement returns the enforcement of the ruleset, defaulting to active.
+func (r Ruleset) EffectiveEnforcement() string {
+	if r.Enforcement == nil {
+		return github.RulesetEnforcementActive
+	}
+	return *r.Enforcement
+}
+
 // GetOrg returns the org config after merging in any global policies.
 func (bp BranchProtection) GetOrg(name string) *Org {
 	o, ok := bp.Orgs[name]
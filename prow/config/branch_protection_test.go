@@ -302,6 +302,60 @@ func TestApply(test *testing.T) {
 				Include: []string{"bar*", "foo*"},
 			},
 		},
+		{
+			name: "merge rulesets of the same name",
+			parent: Policy{
+				Rulesets: map[string]Ruleset{
+					"main": {
+						Include:            []string{"~DEFAULT_BRANCH"},
+						BypassActors:       []BypassActor{{OrgAdmin: true}},
+						RequiredSignatures: &t,
+						RequiredStatusChecks: &ContextPolicy{
+							Contexts: []string{"test"},
+						},
+					},
+					"tags": {
+						Target:         utilpointer.StringPtr("tag"),
+						Include:        []string{"refs/tags/v*"},
+						BlockDeletions: &t,
+					},
+				},
+			},
+			child: Policy{
+				Rulesets: map[string]Ruleset{
+					"main": {
+						Include:             []string{"refs/heads/release-*"},
+						BypassActors:        []BypassActor{{OrgAdmin: true}, {Team: "release"}},
+						RequiredSignatures:  &f,
+						RequiredDeployments: []string{"staging"},
+					},
+					"history": {
+						RequiredLinearHistory: &t,
+					},
+				},
+			},
+			expected: Policy{
+				Rulesets: map[string]Ruleset{
+					"main": {
+						Include:             []string{"refs/heads/release-*", "~DEFAULT_BRANCH"},
+						BypassActors:        []BypassActor{{OrgAdmin: true}, {Team: "release"}},
+						RequiredSignatures:  &f,
+						RequiredDeployments: []string{"staging"},
+						RequiredStatusChecks: &ContextPolicy{
+							Contexts: []string{"test"},
+						},
+					},
+					"tags": {
+						Target:         utilpointer.StringPtr("tag"),
+						Include:        []string{"refs/tags/v*"},
+						BlockDeletions: &t,
+					},
+					"history": {
+						RequiredLinearHistory: &t,
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -321,6 +375,112 @@ func TestApply(test *testing.T) {
 	}
 }
 
+func TestValidateRulesets(t *testing.T) {
+	cases := []struct {
+		name          string
+		config        BranchProtection
+		expectedError bool
+	}{
+		{
+			name: "valid rulesets at every level",
+			config: BranchProtection{
+				Policy: Policy{Rulesets: map[string]Ruleset{"main": {
+					RequiredStatusChecks: &ContextPolicy{Contexts: []string{"test"}},
+					BypassActors:         []BypassActor{{Team: "admins", Mode: "pull_request"}},
+				}}},
+				Orgs: map[string]Org{"org": {
+					Policy: Policy{Rulesets: map[string]Ruleset{"tags": {
+						Target:         utilpointer.StringPtr("tag"),
+						Enforcement:    utilpointer.StringPtr("evaluate"),
+						BlockDeletions: yes,
+					}}},
+					Repos: map[string]Repo{"repo": {
+						Policy: Policy{Rulesets: map[string]Ruleset{"main": {RequiredDeployments: []string{"staging"}}}},
+					}},
+				}},
+			},
+		},
+		{
+			name: "unknown target",
+			config: BranchProtection{
+				Policy: Policy{Rulesets: map[string]Ruleset{"main": {Target: utilpointer.StringPtr("commit")}}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "unknown enforcement",
+			config: BranchProtection{
+				Policy: Policy{Rulesets: map[string]Ruleset{"main": {Enforcement: utilpointer.StringPtr("enabled")}}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "tag ruleset requiring status checks",
+			config: BranchProtection{
+				Policy: Policy{Rulesets: map[string]Ruleset{"tags": {
+					Target:               utilpointer.StringPtr("tag"),
+					RequiredStatusChecks: &ContextPolicy{Contexts: []string{"test"}},
+				}}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "bypass actor with a team and an app",
+			config: BranchProtection{
+				Policy: Policy{Rulesets: map[string]Ruleset{"main": {BypassActors: []BypassActor{{Team: "admins", App: 1}}}}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "bypass actor with an unknown mode",
+			config: BranchProtection{
+				Policy: Policy{Rulesets: map[string]Ruleset{"main": {BypassActors: []BypassActor{{OrgAdmin: true, Mode: "never"}}}}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "repo ruleset targeting tags merged into a global ruleset requiring status checks",
+			config: BranchProtection{
+				Policy: Policy{Rulesets: map[string]Ruleset{"main": {RequiredStatusChecks: &ContextPolicy{Contexts: []string{"test"}}}}},
+				Orgs: map[string]Org{"org": {Repos: map[string]Repo{"repo": {
+					Policy: Policy{Rulesets: map[string]Ruleset{"main": {Target: utilpointer.StringPtr("tag")}}},
+				}}}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "org ruleset targeting tags merged into a repo ruleset requiring deployments",
+			config: BranchProtection{
+				Orgs: map[string]Org{"org": {
+					Policy: Policy{Rulesets: map[string]Ruleset{"main": {Target: utilpointer.StringPtr("tag")}}},
+					Repos: map[string]Repo{"repo": {
+						Policy: Policy{Rulesets: map[string]Ruleset{"main": {RequiredDeployments: []string{"staging"}}}},
+					}},
+				}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "rulesets of a branch",
+			config: BranchProtection{
+				Orgs: map[string]Org{"org": {Repos: map[string]Repo{"repo": {Branches: map[string]Branch{"main": {
+					Policy: Policy{Rulesets: map[string]Ruleset{"main": {}}},
+				}}}}}},
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.validateRulesets()
+			if (err != nil) != tc.expectedError {
+				t.Errorf("expected error %t, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
 func TestBranchRequirements(t *testing.T) {
 	cases := []struct {
 		name                            string
@@ -189,6 +189,22 @@ type ProwConfig struct {
 	// match a job are used. Later matching entries override the fields of earlier
 	// matching entires.
 	ProwJobDefaultEntries []*ProwJobDefaultEntry `json:"prowjob_default_entries,omitempty"`
+
+	// PodSecurity restricts the privileges that the pod specs of jobs may
+	// request, e.g. privileged containers, hostPath volumes or host networking.
+	// It is enforced for all jobs, including in-repo config jobs, and by the
+	// admission webhook when ProwJobs are created. If unset, jobs may request
+	// any privilege.
+	PodSecurity *PodSecurity `json:"pod_security,omitempty"`
+
+	// AutoRetest configures crier to retest failed presubmits automatically
+	// when all their failed tests are known to be flaky. It requires crier to
+	// run with --auto-retest-workers.
+	AutoRetest *AutoRetest `json:"auto_retest,omitempty"`
+
+	// GitLab lists the repositories hosted on GitLab, whose jobs crier
+	// reports to GitLab rather than GitHub.
+	GitLab *GitLab `json:"gitlab,omitempty"`
 }
 
 type InRepoConfig struct {
@@ -200,6 +216,11 @@ type InRepoConfig struct {
 	// a given repo. All clusters that are allowed for the specific repo, its org or
 	// globally can be used.
 	AllowedClusters map[string][]string `json:"allowed_clusters,omitempty"`
+	// PeriodicsRepos is a list of repositories ('org/repo') whose in-repo config
+	// may declare periodics. These periodics are loaded from the head of the
+	// default branch of the repository and run against it. InRepoConfig must be
+	// enabled for every repository in this list.
+	PeriodicsRepos []string `json:"periodics_repos,omitempty"`
 }
 
 // InRepoConfigEnabled returns whether InRepoConfig is enabled for a given repository.
@@ -217,6 +238,17 @@ func (c *Config) InRepoConfigEnabled(identifier string) bool {
 	return false
 }
 
+// InRepoConfigAllowsPeriodics returns whether the in-repo config of a given
+// repository is consulted for periodics.
+func (c *Config) InRepoConfigAllowsPeriodics(identifier string) bool {
+	for _, repo := range c.InRepoConfig.PeriodicsRepos {
+		if repo == identifier {
+			return c.InRepoConfigEnabled(identifier)
+		}
+	}
+	return false
+}
+
 // InRepoConfigAllowsCluster determines if a given cluster may be used for a given repository
 func (c *Config) InRepoConfigAllowsCluster(clusterName, repoIdentifier string) bool {
 	for _, allowedCluster := range c.InRepoConfig.AllowedClusters[repoIdentifier] {
@@ -377,6 +409,50 @@ func (c *Config) GetPresubmits(gc git.ClientFactory, identifier string, baseSHAG
 	return append(c.GetPresubmitsStatic(identifier), prowYAML.Presubmits...), nil
 }
 
+// GetPeriodics will return the periodics that are versioned inside the given
+// repository at baseSHA, if the repository is allowed to declare periodics in
+// its in-repo config. The periodics run against baseRef, which is expected to
+// be the default branch of the repository that baseSHA was resolved from.
+func (c *Config) GetPeriodics(gc git.ClientFactory, identifier, baseRef string, baseSHAGetter RefGetter) ([]Periodic, error) {
+	if !c.InRepoConfigAllowsPeriodics(identifier) {
+		return nil, nil
+	}
+	prowYAML, err := c.getProwYAML(gc, identifier, baseSHAGetter)
+	if err != nil {
+		return nil, err
+	}
+
+	orgRepo := NewOrgRepo(identifier)
+	periodics := make([]Periodic, 0, len(prowYAML.Periodics))
+	for _, periodic := range prowYAML.Periodics {
+		if !periodicClonesRepo(periodic, *orgRepo) {
+			refs := prowapi.Refs{Org: orgRepo.Org, Repo: orgRepo.Repo, BaseRef: baseRef}
+			refs.WorkDir = !periodicHasWorkDir(periodic)
+			periodic.ExtraRefs = append([]prowapi.Refs{refs}, periodic.ExtraRefs...)
+		}
+		periodics = append(periodics, periodic)
+	}
+	return periodics, nil
+}
+
+func periodicClonesRepo(p Periodic, orgRepo OrgRepo) bool {
+	for _, refs := range p.ExtraRefs {
+		if refs.Org == orgRepo.Org && refs.Repo == orgRepo.Repo {
+			return true
+		}
+	}
+	return false
+}
+
+func periodicHasWorkDir(p Periodic) bool {
+	for _, refs := range p.ExtraRefs {
+		if refs.WorkDir {
+			return true
+		}
+	}
+	return false
+}
+
 // GetPresubmitsStatic will return presubmits for the given identifier that are versioned inside the tested repo
 func (c *Config) GetPresubmitsStatic(identifier string) []Presubmit {
 	return c.PresubmitsStatic[identifier]
@@ -1700,6 +1776,33 @@ func (c *Config) validateComponentConfig() error {
 		}
 	}
 
+	for _, repo := range c.InRepoConfig.PeriodicsRepos {
+		if orgRepo := NewOrgRepo(repo); orgRepo == nil || orgRepo.Repo == "" {
+			return fmt.Errorf("in_repo_config.periodics_repos entry %q is not of the form org/repo", repo)
+		}
+		if !c.InRepoConfigEnabled(repo) {
+			return fmt.Errorf("in_repo_config.periodics_repos contains %q, but in-repo config is not enabled for it", repo)
+		}
+	}
+
+	if c.PodSecurity != nil {
+		if err := c.PodSecurity.validate(); err != nil {
+			return fmt.Errorf("invalid pod_security config: %w", err)
+		}
+	}
+
+	if c.GitLab != nil {
+		if err := c.GitLab.validate(); err != nil {
+			return fmt.Errorf("invalid gitlab config: %w", err)
+		}
+	}
+
+	if c.AutoRetest != nil {
+		if err := c.AutoRetest.DefaultAndValidate(); err != nil {
+			return fmt.Errorf("invalid auto_retest config: %w", err)
+		}
+	}
+
 	var validationErrs []error
 	if c.ManagedWebhooks.OrgRepoConfig != nil {
 		for repoName, repoValue := range c.ManagedWebhooks.OrgRepoConfig {
@@ -1798,6 +1901,9 @@ func validatePresubmits(presubmits []Presubmit, podNamespace string) error {
 		if err := validateReporting(ps.JobBase, ps.Reporter); err != nil {
 			errs = append(errs, fmt.Errorf("invalid presubmit job %s: %w", ps.Name, err))
 		}
+		if err := validateParameters(ps.Parameters); err != nil {
+			errs = append(errs, fmt.Errorf("invalid presubmit job %s: %w", ps.Name, err))
+		}
 		validPresubmits[ps.Name] = append(validPresubmits[ps.Name], ps)
 	}
 
@@ -1889,26 +1995,52 @@ func (c *Config) ValidateJobConfig() error {
 	var errs []error
 
 	// Validate presubmits.
-	for _, jobs := range c.PresubmitsStatic {
+	for repo, jobs := range c.PresubmitsStatic {
 		if err := validatePresubmits(jobs, c.PodNamespace); err != nil {
 			errs = append(errs, err)
 		}
+		for _, job := range jobs {
+			if err := c.validateJobPodSecurity(prowapi.PresubmitJob, job.JobBase, repo); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
 
 	// Validate postsubmits.
-	for _, jobs := range c.PostsubmitsStatic {
+	for repo, jobs := range c.PostsubmitsStatic {
 		if err := validatePostsubmits(jobs, c.PodNamespace); err != nil {
 			errs = append(errs, err)
 		}
+		for _, job := range jobs {
+			if err := c.validateJobPodSecurity(prowapi.PostsubmitJob, job.JobBase, repo); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
 
 	if err := validatePeriodics(c.Periodics, c.PodNamespace); err != nil {
 		errs = append(errs, err)
 	}
+	for _, job := range c.Periodics {
+		if err := c.validateJobPodSecurity(prowapi.PeriodicJob, job.JobBase, periodicRepo(job)); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
 	// Set the interval on the periodic jobs. It doesn't make sense to do this
 	// for child jobs.
-	for j, p := range c.Periodics {
+	errs = append(errs, setPeriodicIntervals(c.Periodics)...)
+
+	c.Deck.AllKnownStorageBuckets = calculateStorageBuckets(c)
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// setPeriodicIntervals validates the schedule of the given periodics and sets
+// the parsed interval on those that use one.
+func setPeriodicIntervals(periodics []Periodic) []error {
+	var errs []error
+	for j, p := range periodics {
 		if p.Cron != "" && p.Interval != "" {
 			errs = append(errs, fmt.Errorf("cron and interval cannot be both set in periodic %s", p.Name))
 		} else if p.Cron == "" && p.Interval == "" {
@@ -1918,17 +2050,14 @@ func (c *Config) ValidateJobConfig() error {
 				errs = append(errs, fmt.Errorf("invalid cron string %s in periodic %s: %w", p.Cron, p.Name, err))
 			}
 		} else {
-			d, err := time.ParseDuration(c.Periodics[j].Interval)
+			d, err := time.ParseDuration(periodics[j].Interval)
 			if err != nil {
-				errs = append(errs, fmt.Errorf("cannot parse duration for %s: %w", c.Periodics[j].Name, err))
+				errs = append(errs, fmt.Errorf("cannot parse duration for %s: %w", periodics[j].Name, err))
 			}
-			c.Periodics[j].interval = d
+			periodics[j].interval = d
 		}
 	}
-
-	c.Deck.AllKnownStorageBuckets = calculateStorageBuckets(c)
-
-	return utilerrors.NewAggregate(errs)
+	return errs
 }
 
 func parseProwConfig(c *Config) error {
@@ -2219,6 +2348,10 @@ func parseProwConfig(c *Config) error {
 		return fmt.Errorf("Forbidden to set both Policy.Include and Policy.Exclude, Please use either Include or Exclude!")
 	}
 
+	if err := c.BranchProtection.validateRulesets(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -2474,6 +2607,21 @@ func validateTriggering(job Presubmit) error {
 	return nil
 }
 
+func validateParameters(parameters []PresubmitParameter) error {
+	var errs []error
+	names := sets.NewString()
+	for _, parameter := range parameters {
+		if names.Has(parameter.Name) {
+			errs = append(errs, fmt.Errorf("parameter %s is declared more than once", parameter.Name))
+		}
+		names.Insert(parameter.Name)
+		if err := parameter.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
 func validateReporting(j JobBase, r Reporter) error {
 	if !r.SkipReport && r.Context == "" {
 		return errors.New("job is set to report but has no context configured")
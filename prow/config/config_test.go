@@ -48,6 +48,7 @@ import (
 	prowjobv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config/secret"
 	gerrit "k8s.io/test-infra/prow/gerrit/client"
+	"k8s.io/test-infra/prow/git/v2"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/github/fakegithub"
 	"k8s.io/test-infra/prow/kube"
@@ -3801,6 +3802,51 @@ func TestValidateTriggering(t *testing.T) {
 	}
 }
 
+func TestValidateParameters(t *testing.T) {
+	testCases := []struct {
+		name        string
+		parameters  []PresubmitParameter
+		errExpected bool
+	}{
+		{
+			name: "valid parameters, no err",
+			parameters: []PresubmitParameter{
+				{Name: "FOCUS", Default: "Conformance"},
+				{Name: "NODES", Default: "3", Pattern: "[0-9]+"},
+			},
+		},
+		{
+			name:        "name is not an environment variable, err",
+			parameters:  []PresubmitParameter{{Name: "focus-area"}},
+			errExpected: true,
+		},
+		{
+			name:        "duplicate name, err",
+			parameters:  []PresubmitParameter{{Name: "FOCUS"}, {Name: "FOCUS"}},
+			errExpected: true,
+		},
+		{
+			name:        "invalid pattern, err",
+			parameters:  []PresubmitParameter{{Name: "NODES", Pattern: "[0-9"}},
+			errExpected: true,
+		},
+		{
+			name:        "default doesn't match pattern, err",
+			parameters:  []PresubmitParameter{{Name: "NODES", Default: "three", Pattern: "[0-9]+"}},
+			errExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateParameters(tc.parameters)
+			if err != nil != tc.errExpected {
+				t.Errorf("Expected err: %t but got err %v", tc.errExpected, err)
+			}
+		})
+	}
+}
+
 func TestValidateAlwaysRunPostsubmit(t *testing.T) {
 	true_ := true
 	testCases := []struct {
@@ -6432,6 +6478,57 @@ func TestGetPostsubmitsReturnsStaticAndInrepoconfigPostsubmits(t *testing.T) {
 	}
 }
 
+func TestGetPeriodics(t *testing.T) {
+	t.Parallel()
+
+	prowYAMLGetter := func(_ *Config, _ git.ClientFactory, _, _ string, _ ...string) (*ProwYAML, error) {
+		return &ProwYAML{Periodics: []Periodic{
+			{JobBase: JobBase{Name: "plain"}},
+			{JobBase: JobBase{Name: "with-workdir", UtilityConfig: UtilityConfig{ExtraRefs: []prowapi.Refs{{Org: "org", Repo: "other", WorkDir: true}}}}},
+			{JobBase: JobBase{Name: "clones-itself", UtilityConfig: UtilityConfig{ExtraRefs: []prowapi.Refs{{Org: "org", Repo: "repo", BaseRef: "release"}}}}},
+		}}, nil
+	}
+	testCases := []struct {
+		name           string
+		periodicsRepos []string
+		expected       []Periodic
+	}{
+		{
+			name: "repo not allowed to declare periodics",
+		},
+		{
+			name:           "periodics run against the repo",
+			periodicsRepos: []string{"org/repo"},
+			expected: []Periodic{
+				{JobBase: JobBase{Name: "plain", UtilityConfig: UtilityConfig{ExtraRefs: []prowapi.Refs{{Org: "org", Repo: "repo", BaseRef: "main", WorkDir: true}}}}},
+				{JobBase: JobBase{Name: "with-workdir", UtilityConfig: UtilityConfig{ExtraRefs: []prowapi.Refs{{Org: "org", Repo: "repo", BaseRef: "main"}, {Org: "org", Repo: "other", WorkDir: true}}}}},
+				{JobBase: JobBase{Name: "clones-itself", UtilityConfig: UtilityConfig{ExtraRefs: []prowapi.Refs{{Org: "org", Repo: "repo", BaseRef: "release"}}}}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{
+				ProwConfig: ProwConfig{
+					InRepoConfig: InRepoConfig{
+						Enabled:        map[string]*bool{"*": utilpointer.BoolPtr(true)},
+						PeriodicsRepos: tc.periodicsRepos,
+					},
+				},
+				JobConfig: JobConfig{ProwYAMLGetter: prowYAMLGetter},
+			}
+			periodics, err := c.GetPeriodics(nil, "org/repo", "main", func() (string, error) { return "", nil })
+			if err != nil {
+				t.Fatalf("Error calling GetPeriodics: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, periodics, cmpopts.IgnoreUnexported(Periodic{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("periodics differ from expected: %s", diff)
+			}
+		})
+	}
+}
+
 func TestInRepoConfigAllowsCluster(t *testing.T) {
 	const clusterName = "that-cluster"
 
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GitLab lists the repositories that are hosted on GitLab rather than GitHub.
+// Hook receives their events on /hook/gitlab and crier reports their jobs to
+// GitLab instead of GitHub.
+type GitLab struct {
+	// Orgs are top-level GitLab groups whose projects are hosted on GitLab.
+	// Projects of nested groups are not supported.
+	Orgs []string `json:"orgs,omitempty"`
+	// Repos are GitLab projects, as group/project, that are hosted on GitLab.
+	Repos []string `json:"repos,omitempty"`
+}
+
+// Manages returns whether org/repo is hosted on GitLab.
+func (g *GitLab) Manages(org, repo string) bool {
+	if g == nil {
+		return false
+	}
+	for _, group := range g.Orgs {
+		if org == group {
+			return true
+		}
+	}
+	for _, project := range g.Repos {
+		if project == org+"/"+repo {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *GitLab) validate() error {
+	for _, org := range g.Orgs {
+		if org == "" || strings.Contains(org, "/") {
+			return fmt.Errorf("orgs entry %q is not a top-level group, nested groups are not supported", org)
+		}
+	}
+	for _, repo := range g.Repos {
+		if parts := strings.Split(repo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("repos entry %q is not of the form group/project, nested groups are not supported", repo)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import "testing"
+
+func TestGitLabManages(t *testing.T) {
+	gitlab := &GitLab{Orgs: []string{"group"}, Repos: []string{"other/project"}}
+	var testCases = []struct {
+		org, repo string
+		expected  bool
+	}{
+		{org: "group", repo: "repo", expected: true},
+		{org: "groupie", repo: "repo", expected: false},
+		{org: "other", repo: "project", expected: true},
+		{org: "other", repo: "repo", expected: false},
+	}
+	for _, tc := range testCases {
+		if actual := gitlab.Manages(tc.org, tc.repo); actual != tc.expected {
+			t.Errorf("expected Manages(%q, %q) to be %t, got %t", tc.org, tc.repo, tc.expected, actual)
+		}
+	}
+	if (*GitLab)(nil).Manages("group", "repo") {
+		t.Error("expected nothing to be hosted on GitLab without configuration")
+	}
+}
+
+func TestGitLabValidate(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		gitlab      GitLab
+		expectedErr bool
+	}{
+		{
+			name:   "top-level groups and their projects",
+			gitlab: GitLab{Orgs: []string{"group"}, Repos: []string{"other/project"}},
+		},
+		{
+			name:        "nested group",
+			gitlab:      GitLab{Orgs: []string{"group/sub"}},
+			expectedErr: true,
+		},
+		{
+			name:        "project of a nested group",
+			gitlab:      GitLab{Repos: []string{"group/sub/project"}},
+			expectedErr: true,
+		},
+		{
+			name:        "project without group",
+			gitlab:      GitLab{Repos: []string{"project"}},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.gitlab.validate(); (err != nil) != tc.expectedErr {
+				t.Errorf("expected error %t, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
@@ -17,17 +17,22 @@ limitations under the License.
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/git/v2"
 	"sigs.k8s.io/yaml"
 )
@@ -35,14 +40,29 @@ import (
 const (
 	inRepoConfigFileName = ".prow.yaml"
 	inRepoConfigDirName  = ".prow"
+
+	// InRepoConfigCachePath is the path under which the in-repo config cache
+	// service serves raw ProwYAMLs.
+	InRepoConfigCachePath = "/prowyaml"
+	// InRepoConfigCacheRepoParam is the query parameter holding the 'org/repo'
+	// identifier in requests to the in-repo config cache service.
+	InRepoConfigCacheRepoParam = "repo"
+	// InRepoConfigCacheBaseParam is the query parameter holding the base SHA
+	// in requests to the in-repo config cache service.
+	InRepoConfigCacheBaseParam = "base"
+	// InRepoConfigCacheHeadParam is the query parameter holding the head SHAs
+	// in requests to the in-repo config cache service. It can be repeated.
+	InRepoConfigCacheHeadParam = "head"
 )
 
 // ProwYAML represents the content of a .prow.yaml file
-// used to version Presubmits and Postsubmits inside the tested repo.
+// used to version Presubmits, Postsubmits and Periodics inside the tested repo.
 type ProwYAML struct {
 	Presets     []Preset     `json:"presets"`
 	Presubmits  []Presubmit  `json:"presubmits"`
 	Postsubmits []Postsubmit `json:"postsubmits"`
+	// Periodics are only honored for repos listed in in_repo_config.periodics_repos.
+	Periodics []Periodic `json:"periodics,omitempty"`
 }
 
 // ProwYAMLGetter is used to retrieve a ProwYAML. Tests should provide
@@ -59,10 +79,33 @@ func defaultProwYAMLGetter(
 	baseSHA string,
 	headSHAs ...string) (*ProwYAML, error) {
 
+	prowYAML, err := ReadProwYAML(c, gc, identifier, baseSHA, headSHAs...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DefaultAndValidateProwYAML(c, prowYAML, identifier); err != nil {
+		return nil, err
+	}
+
+	logrus.WithField("repo", identifier).Debugf("Successfully got %d presubmits, %d postsubmits and %d periodics from %q.", len(prowYAML.Presubmits), len(prowYAML.Postsubmits), len(prowYAML.Periodics), inRepoConfigFileName)
+	return prowYAML, nil
+}
+
+// ReadProwYAML checks out baseSHA of the given repo, merges headSHAs into it
+// and reads the in-repo config from the result. The returned ProwYAML is
+// neither defaulted nor validated.
+func ReadProwYAML(
+	c *Config,
+	gc git.ClientFactory,
+	identifier string,
+	baseSHA string,
+	headSHAs ...string) (*ProwYAML, error) {
+
 	log := logrus.WithField("repo", identifier)
 
 	if gc == nil {
-		log.Error("defaultProwYAMLGetter was called with a nil git client")
+		log.Error("ReadProwYAML was called with a nil git client")
 		return nil, errors.New("gitClient is nil")
 	}
 
@@ -106,6 +149,7 @@ func defaultProwYAMLGetter(
 			c.Presets = append(a.Presets, b.Presets...)
 			c.Presubmits = append(a.Presubmits, b.Presubmits...)
 			c.Postsubmits = append(a.Postsubmits, b.Postsubmits...)
+			c.Periodics = append(a.Periodics, b.Periodics...)
 
 			return c
 		}
@@ -152,14 +196,53 @@ func defaultProwYAMLGetter(
 		}
 	}
 
-	if err := DefaultAndValidateProwYAML(c, prowYAML, identifier); err != nil {
-		return nil, err
-	}
-
-	log.Debugf("Successfully got %d presubmits and %d postsubmits from %q.", len(prowYAML.Presubmits), len(prowYAML.Postsubmits), inRepoConfigFileName)
 	return prowYAML, nil
 }
 
+// InRepoConfigCacheGetter returns a ProwYAMLGetter that retrieves in-repo
+// configs from the in-repo config cache service at address instead of cloning
+// the repository. The service returns raw configs, which are defaulted and
+// validated against the config of the caller.
+func InRepoConfigCacheGetter(address string) ProwYAMLGetter {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	return func(c *Config, _ git.ClientFactory, identifier, baseSHA string, headSHAs ...string) (*ProwYAML, error) {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid in-repo config cache address %q: %w", address, err)
+		}
+		u.Path = path.Join(u.Path, InRepoConfigCachePath)
+		query := url.Values{}
+		query.Set(InRepoConfigCacheRepoParam, identifier)
+		query.Set(InRepoConfigCacheBaseParam, baseSHA)
+		for _, headSHA := range headSHAs {
+			query.Add(InRepoConfigCacheHeadParam, headSHA)
+		}
+		u.RawQuery = query.Encode()
+
+		resp, err := client.Get(u.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to query in-repo config cache: %w", err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read in-repo config cache response: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("in-repo config cache responded with status %d: %s", resp.StatusCode, string(body))
+		}
+
+		prowYAML := &ProwYAML{}
+		if err := json.Unmarshal(body, prowYAML); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal in-repo config cache response: %w", err)
+		}
+		if err := DefaultAndValidateProwYAML(c, prowYAML, identifier); err != nil {
+			return nil, err
+		}
+		return prowYAML, nil
+	}
+}
+
 func DefaultAndValidateProwYAML(c *Config, p *ProwYAML, identifier string) error {
 	if err := defaultPresubmits(p.Presubmits, p.Presets, c, identifier); err != nil {
 		return err
@@ -173,8 +256,14 @@ func DefaultAndValidateProwYAML(c *Config, p *ProwYAML, identifier string) error
 	if err := validatePostsubmits(append(p.Postsubmits, c.PostsubmitsStatic[identifier]...), c.PodNamespace); err != nil {
 		return err
 	}
+	if err := defaultInRepoPeriodics(p.Periodics, p.Presets, c, identifier); err != nil {
+		return err
+	}
+	if err := validatePeriodics(append(p.Periodics, c.Periodics...), c.PodNamespace); err != nil {
+		return err
+	}
 
-	var errs []error
+	errs := setPeriodicIntervals(p.Periodics)
 	for _, pre := range p.Presubmits {
 		if !c.InRepoConfigAllowsCluster(pre.Cluster, identifier) {
 			errs = append(errs, fmt.Errorf("cluster %q is not allowed for repository %q", pre.Cluster, identifier))
@@ -185,10 +274,49 @@ func DefaultAndValidateProwYAML(c *Config, p *ProwYAML, identifier string) error
 			errs = append(errs, fmt.Errorf("cluster %q is not allowed for repository %q", post.Cluster, identifier))
 		}
 	}
+	for _, periodic := range p.Periodics {
+		if !c.InRepoConfigAllowsCluster(periodic.Cluster, identifier) {
+			errs = append(errs, fmt.Errorf("cluster %q is not allowed for repository %q", periodic.Cluster, identifier))
+		}
+	}
+
+	for _, pre := range p.Presubmits {
+		if err := c.validateJobPodSecurity(prowapi.PresubmitJob, pre.JobBase, identifier); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, post := range p.Postsubmits {
+		if err := c.validateJobPodSecurity(prowapi.PostsubmitJob, post.JobBase, identifier); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, periodic := range p.Periodics {
+		if err := c.validateJobPodSecurity(prowapi.PeriodicJob, periodic.JobBase, identifier); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
 	return utilerrors.NewAggregate(errs)
 }
 
+// defaultInRepoPeriodics defaults the periodics from the in-repo config of
+// repo. They always belong to repo, so its repo-specific defaults apply even
+// though it is only added to their extra refs by Config.GetPeriodics.
+func defaultInRepoPeriodics(periodics []Periodic, additionalPresets []Preset, c *Config, repo string) error {
+	c.defaultPeriodicFields(periodics)
+	var errs []error
+	for i := range periodics {
+		if shouldDecorate(&c.JobConfig, &periodics[i].JobBase.UtilityConfig) {
+			periodics[i].DecorationConfig = c.Plank.mergeDefaultDecorationConfig(repo, periodics[i].Cluster, periodics[i].DecorationConfig)
+		}
+		periodics[i].ProwJobDefault = c.mergeProwJobDefault(repo, periodics[i].Cluster, periodics[i].ProwJobDefault)
+		if err := resolvePresets(periodics[i].Name, periodics[i].Labels, periodics[i].Spec, append(c.Presets, additionalPresets...)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
 // InRepoConfigGitCache is a wrapper around a git.ClientFactory that allows for
 // threadsafe reuse of git.RepoClients when one already exists for the specified repo.
 type InRepoConfigGitCache struct {
@@ -23,6 +23,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"k8s.io/test-infra/prow/git/localgit"
 	"k8s.io/test-infra/prow/git/v2"
@@ -527,6 +528,74 @@ postsubmits: [{"name": "oli", "spec": {"containers": [{}]}}]`),
 				return nil
 			},
 		},
+		// periodics
+		{
+			name: "Basic happy path (periodics)",
+			baseContent: map[string][]byte{
+				".prow.yaml": []byte(`periodics: [{"name": "hans", "interval": "1h", "spec": {"containers": [{}]}}]`),
+			},
+			validate: func(p *ProwYAML, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				if n := len(p.Periodics); n != 1 || p.Periodics[0].Name != "hans" {
+					return fmt.Errorf(`expected exactly one periodic with name "hans", got %v`, p.Periodics)
+				}
+				if interval := p.Periodics[0].GetInterval(); interval != time.Hour {
+					return fmt.Errorf("expected interval to be set to 1h, was %v", interval)
+				}
+				return nil
+			},
+		},
+		{
+			name: "Periodics from .prow directory are merged",
+			baseContent: map[string][]byte{
+				".prow/one.yaml": []byte(`periodics: [{"name": "hans", "interval": "1h", "spec": {"containers": [{}]}}]`),
+				".prow/two.yaml": []byte(`periodics: [{"name": "kurt", "cron": "@daily", "spec": {"containers": [{}]}}]`),
+			},
+			validate: func(p *ProwYAML, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				if n := len(p.Periodics); n != 2 ||
+					p.Periodics[0].Name != "hans" ||
+					p.Periodics[1].Name != "kurt" {
+					return fmt.Errorf(`expected exactly two periodics with name "hans" and "kurt", got %v`, p.Periodics)
+				}
+				return nil
+			},
+		},
+		{
+			name: "Periodic validation includes static periodics",
+			baseContent: map[string][]byte{
+				".prow.yaml": []byte(`periodics: [{"name": "hans", "interval": "1h", "spec": {"containers": [{}]}}]`),
+			},
+			config: &Config{JobConfig: JobConfig{
+				Periodics: []Periodic{{JobBase: JobBase{Name: "hans"}}},
+			}},
+			validate: func(_ *ProwYAML, err error) error {
+				if err == nil {
+					return errors.New("error is nil")
+				}
+				expectedErrMsg := "duplicated periodic job : hans"
+				if err.Error() != expectedErrMsg {
+					return fmt.Errorf("expected error message to be %q, was %q", expectedErrMsg, err.Error())
+				}
+				return nil
+			},
+		},
+		{
+			name: "Periodic without schedule is rejected",
+			baseContent: map[string][]byte{
+				".prow.yaml": []byte(`periodics: [{"name": "hans", "spec": {"containers": [{}]}}]`),
+			},
+			validate: func(_ *ProwYAML, err error) error {
+				if err == nil {
+					return errors.New("error is nil")
+				}
+				return nil
+			},
+		},
 	}
 
 	for idx := range testCases {
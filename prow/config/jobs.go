@@ -26,6 +26,7 @@ import (
 	pipelinev1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
 
 	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/github"
@@ -157,10 +158,66 @@ type Presubmit struct {
 
 	JenkinsSpec *JenkinsSpec `json:"jenkins_spec,omitempty"`
 
+	// Parameters are the parameters that may be passed to the job when it is
+	// triggered by a comment, e.g. `/test <job name> FOCUS=Networking`. They
+	// are set as environment variables in all containers of the job.
+	Parameters []PresubmitParameter `json:"parameters,omitempty"`
+
 	// We'll set these when we load it.
 	re *regexp.Regexp // from Trigger.
 }
 
+// PresubmitParameter is a parameter that may be passed to a presubmit.
+type PresubmitParameter struct {
+	// Name is the name of the parameter and of the environment variable it is
+	// set as.
+	Name string `json:"name"`
+	// Default is the value of the parameter when it is not passed.
+	Default string `json:"default,omitempty"`
+	// Description describes the parameter to the users triggering the job.
+	Description string `json:"description,omitempty"`
+	// Pattern is a regular expression that passed values must fully match.
+	// Any value is allowed if it is empty.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+var parameterNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validate makes sure the parameter is a valid environment variable and its
+// default value matches its pattern.
+func (p PresubmitParameter) validate() error {
+	if !parameterNameRe.MatchString(p.Name) {
+		return fmt.Errorf("parameter name %q is not a valid environment variable name", p.Name)
+	}
+	if p.Pattern == "" {
+		return nil
+	}
+	if _, err := regexp.Compile(p.Pattern); err != nil {
+		return fmt.Errorf("parameter %s: invalid pattern: %w", p.Name, err)
+	}
+	if p.Default != "" {
+		if err := p.validateValue(p.Default); err != nil {
+			return fmt.Errorf("parameter %s: invalid default: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateValue makes sure value fully matches the pattern of the parameter.
+func (p PresubmitParameter) validateValue(value string) error {
+	if p.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+	if err != nil {
+		return err
+	}
+	if !re.MatchString(value) {
+		return fmt.Errorf("value %q does not match %q", value, p.Pattern)
+	}
+	return nil
+}
+
 // Postsubmit runs on push events.
 type Postsubmit struct {
 	JobBase
@@ -408,6 +465,34 @@ func (ps Presubmit) TriggerMatches(body string) bool {
 	return ps.Trigger != "" && ps.re.MatchString(body)
 }
 
+// ResolveParameters validates the parameters passed to the presubmit and
+// completes them with the defaults of the parameters that were not passed.
+func (ps Presubmit) ResolveParameters(passed map[string]string) (map[string]string, error) {
+	declared := map[string]PresubmitParameter{}
+	resolved := map[string]string{}
+	for _, parameter := range ps.Parameters {
+		declared[parameter.Name] = parameter
+		resolved[parameter.Name] = parameter.Default
+	}
+	var errs []error
+	for _, name := range sets.StringKeySet(passed).List() {
+		parameter, ok := declared[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("job %s has no parameter %s", ps.Name, name))
+			continue
+		}
+		if err := parameter.validateValue(passed[name]); err != nil {
+			errs = append(errs, fmt.Errorf("parameter %s of job %s: %w", name, ps.Name, err))
+			continue
+		}
+		resolved[name] = passed[name]
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	return resolved, nil
+}
+
 // ContextRequired checks whether a context is required from github points of view (required check).
 func (ps Presubmit) ContextRequired() bool {
 	return !ps.Optional && !ps.SkipReport
@@ -72,6 +72,31 @@ type Repo struct {
 	Previously []string `json:"previously,omitempty"`
 
 	OnCreate *RepoCreateOptions `json:"on_create,omitempty"`
+
+	// Collaborators maps the outside collaborators of the repo to their
+	// permission levels. Collaborators are not managed when unset.
+	// https://developer.github.com/v3/repos/collaborators/
+	Collaborators map[string]github.RepoPermissionLevel `json:"collaborators,omitempty"`
+	// Topics are not managed when unset.
+	// https://developer.github.com/v3/repos/#replace-all-repository-topics
+	Topics []string `json:"topics,omitempty"`
+	// Webhooks are not managed when unset.
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+}
+
+// Webhook declares a repo webhook, which is identified by its URL. Its secret
+// is not managed, see the hmac tool.
+//
+// See https://developer.github.com/v3/repos/hooks/#create-a-hook
+type Webhook struct {
+	URL string `json:"url"`
+	// Events defaults to push.
+	Events []string `json:"events,omitempty"`
+	// ContentType is json or form, defaults to form. It is only set when
+	// the webhook is created, as changing it would drop the secret.
+	ContentType *string `json:"content_type,omitempty"`
+	// Active defaults to true.
+	Active *bool `json:"active,omitempty"`
 }
 
 // Config declares org metadata as well as its people and teams.
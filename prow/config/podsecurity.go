@@ -0,0 +1,229 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+// PodSecurity restricts the privileges that the pod specs of jobs may request.
+// A privilege is allowed for a job if it is allowed for the repository of the
+// job and, if the cluster the job runs in has an allowlist, for the cluster as
+// well. Only the most specific allowlist applies: the one of the repository,
+// else of its org, else the global one, and the one of the cluster, else the
+// global one. If no policy is configured, jobs may request any privilege.
+type PodSecurity struct {
+	// Repos holds the privileges allowed for the jobs of a repository. The key
+	// can be one of '*' for "globally", 'org' or 'org/repo'.
+	Repos map[string]PodSecurityAllowlist `json:"repos,omitempty"`
+	// Clusters limits the privileges allowed for the jobs running in a build
+	// cluster to those listed, whatever their repository is allowed. The key
+	// can be one of '*' for "globally" or a cluster alias.
+	Clusters map[string]PodSecurityAllowlist `json:"clusters,omitempty"`
+}
+
+// PodSecurityAllowlist lists privileges that the pod spec of a job may request.
+type PodSecurityAllowlist struct {
+	// Privileged allows containers to run in privileged mode.
+	Privileged bool `json:"privileged,omitempty"`
+	// HostNetwork allows the pod to use the network namespace of the node.
+	HostNetwork bool `json:"host_network,omitempty"`
+	// HostPID allows the pod to use the PID namespace of the node.
+	HostPID bool `json:"host_pid,omitempty"`
+	// HostIPC allows the pod to use the IPC namespace of the node.
+	HostIPC bool `json:"host_ipc,omitempty"`
+	// HostPaths lists the paths on the node that may be mounted as hostPath
+	// volumes. Everything below a listed path may be mounted as well.
+	HostPaths []string `json:"host_paths,omitempty"`
+	// ServiceAccounts lists the service accounts that the pod may run as. The
+	// default service account may always be used.
+	ServiceAccounts []string `json:"service_accounts,omitempty"`
+	// Capabilities lists the Linux capabilities that may be added to containers.
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// allowlist returns the privileges allowed for jobs of repo running in cluster.
+func (p *PodSecurity) allowlist(repo, cluster string) PodSecurityAllowlist {
+	repoKeys := []string{repo}
+	if identifierSlashSplit := strings.Split(repo, "/"); len(identifierSlashSplit) == 2 {
+		repoKeys = append(repoKeys, identifierSlashSplit[0])
+	}
+	allowed, _ := mostSpecificAllowlist(p.Repos, append(repoKeys, "*")...)
+	// The allowlist of the cluster only restricts the one of the repository,
+	// it doesn't grant anything to all repositories.
+	if clusterList, ok := mostSpecificAllowlist(p.Clusters, cluster, "*"); ok {
+		allowed = allowed.intersect(clusterList)
+	}
+	return allowed
+}
+
+// mostSpecificAllowlist returns the allowlist of the first key that has one.
+func mostSpecificAllowlist(lists map[string]PodSecurityAllowlist, keys ...string) (PodSecurityAllowlist, bool) {
+	for _, key := range keys {
+		if list, ok := lists[key]; ok {
+			return list, true
+		}
+	}
+	return PodSecurityAllowlist{}, false
+}
+
+// intersect returns the privileges allowed by both allowlists.
+func (a PodSecurityAllowlist) intersect(b PodSecurityAllowlist) PodSecurityAllowlist {
+	var hostPaths []string
+	for _, hostPath := range a.HostPaths {
+		if b.allowsHostPath(hostPath) {
+			hostPaths = append(hostPaths, hostPath)
+		}
+	}
+	for _, hostPath := range b.HostPaths {
+		if a.allowsHostPath(hostPath) {
+			hostPaths = append(hostPaths, hostPath)
+		}
+	}
+	return PodSecurityAllowlist{
+		Privileged:      a.Privileged && b.Privileged,
+		HostNetwork:     a.HostNetwork && b.HostNetwork,
+		HostPID:         a.HostPID && b.HostPID,
+		HostIPC:         a.HostIPC && b.HostIPC,
+		HostPaths:       hostPaths,
+		ServiceAccounts: sets.NewString(a.ServiceAccounts...).Intersection(sets.NewString(b.ServiceAccounts...)).List(),
+		Capabilities:    sets.NewString(a.Capabilities...).Intersection(sets.NewString(b.Capabilities...)).List(),
+	}
+}
+
+// allowsHostPath returns whether hostPath is or is below one of the allowed paths.
+func (a PodSecurityAllowlist) allowsHostPath(hostPath string) bool {
+	hostPath = path.Clean(hostPath)
+	for _, allowed := range a.HostPaths {
+		allowed = path.Clean(allowed)
+		if hostPath == allowed || strings.HasPrefix(hostPath, strings.TrimSuffix(allowed, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error for every privilege requested by spec that is not
+// allowed for the jobs of repo running in cluster. repo is of the form
+// 'org/repo' and may be empty for jobs that don't belong to a repository.
+func (p *PodSecurity) Validate(spec *v1.PodSpec, repo, cluster string) error {
+	if p == nil || spec == nil {
+		return nil
+	}
+	allowed := p.allowlist(repo, cluster)
+
+	var errs []error
+	if spec.HostNetwork && !allowed.HostNetwork {
+		errs = append(errs, fmt.Errorf("hostNetwork is not allowed"))
+	}
+	if spec.HostPID && !allowed.HostPID {
+		errs = append(errs, fmt.Errorf("hostPID is not allowed"))
+	}
+	if spec.HostIPC && !allowed.HostIPC {
+		errs = append(errs, fmt.Errorf("hostIPC is not allowed"))
+	}
+	serviceAccounts := sets.NewString(allowed.ServiceAccounts...).Insert("", "default")
+	for _, serviceAccount := range []string{spec.ServiceAccountName, spec.DeprecatedServiceAccount} {
+		if !serviceAccounts.Has(serviceAccount) {
+			errs = append(errs, fmt.Errorf("service account %q is not allowed", serviceAccount))
+		}
+	}
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil && !allowed.allowsHostPath(volume.HostPath.Path) {
+			errs = append(errs, fmt.Errorf("volume %q: hostPath %q is not allowed", volume.Name, volume.HostPath.Path))
+		}
+	}
+
+	capabilities := sets.NewString(allowed.Capabilities...)
+	for _, container := range append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...) {
+		sc := container.SecurityContext
+		if sc == nil {
+			continue
+		}
+		if sc.Privileged != nil && *sc.Privileged && !allowed.Privileged {
+			errs = append(errs, fmt.Errorf("container %q: privileged is not allowed", container.Name))
+		}
+		if sc.Capabilities == nil {
+			continue
+		}
+		for _, capability := range sc.Capabilities.Add {
+			if !capabilities.Has(string(capability)) {
+				errs = append(errs, fmt.Errorf("container %q: capability %q is not allowed", container.Name, capability))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("pod security policy: %w", utilerrors.NewAggregate(errs))
+	}
+	return nil
+}
+
+// ValidateProwJob validates the pod spec of a ProwJob against the policy. The
+// repository of the job is the one of its refs or of its first extra refs.
+func (p *PodSecurity) ValidateProwJob(spec prowapi.ProwJobSpec) error {
+	var repo string
+	refs := spec.Refs
+	if refs == nil && len(spec.ExtraRefs) > 0 {
+		refs = &spec.ExtraRefs[0]
+	}
+	if refs != nil {
+		repo = refs.Org + "/" + refs.Repo
+	}
+	return p.Validate(spec.PodSpec, repo, spec.Cluster)
+}
+
+// validateJobPodSecurity validates the pod spec of a job of repo against the
+// pod security policy.
+func (c *Config) validateJobPodSecurity(jobType prowapi.ProwJobType, job JobBase, repo string) error {
+	if err := c.PodSecurity.Validate(job.Spec, repo, job.Cluster); err != nil {
+		return fmt.Errorf("invalid %s job %s: %w", jobType, job.Name, err)
+	}
+	return nil
+}
+
+// periodicRepo returns the repository a periodic belongs to, i.e. the one of
+// its first extra refs.
+func periodicRepo(p Periodic) string {
+	if len(p.ExtraRefs) == 0 {
+		return ""
+	}
+	return p.ExtraRefs[0].Org + "/" + p.ExtraRefs[0].Repo
+}
+
+// validate makes sure all allowed host paths are absolute.
+func (p *PodSecurity) validate() error {
+	var errs []error
+	for _, lists := range []map[string]PodSecurityAllowlist{p.Repos, p.Clusters} {
+		for key, list := range lists {
+			for _, hostPath := range list.HostPaths {
+				if !path.IsAbs(hostPath) {
+					errs = append(errs, fmt.Errorf("%s: host path %q is not absolute", key, hostPath))
+				}
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+func TestPodSecurityValidate(t *testing.T) {
+	privileged := true
+	policy := &PodSecurity{
+		Repos: map[string]PodSecurityAllowlist{
+			"*":                {HostPaths: []string{"/var/cache"}},
+			"kubernetes":       {ServiceAccounts: []string{"deployer"}},
+			"kubernetes/infra": {Privileged: true, HostNetwork: true, HostPID: true, HostPaths: []string{"/var/run"}, Capabilities: []string{"NET_ADMIN"}},
+		},
+		Clusters: map[string]PodSecurityAllowlist{
+			"trusted": {HostPID: true, HostIPC: true, HostPaths: []string{"/var/run/docker.sock"}, Capabilities: []string{"NET_ADMIN"}},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		policy      *PodSecurity
+		spec        *v1.PodSpec
+		repo        string
+		cluster     string
+		expectedErr []string
+	}{
+		{
+			name:   "no policy allows everything",
+			spec:   &v1.PodSpec{HostNetwork: true, ServiceAccountName: "admin"},
+			repo:   "org/repo",
+			policy: nil,
+		},
+		{
+			name:   "unprivileged pod is allowed",
+			policy: policy,
+			spec: &v1.PodSpec{
+				ServiceAccountName: "default",
+				Containers:         []v1.Container{{Name: "test"}},
+			},
+			repo: "org/repo",
+		},
+		{
+			name:   "everything is rejected by default",
+			policy: policy,
+			spec: &v1.PodSpec{
+				HostNetwork:        true,
+				HostPID:            true,
+				HostIPC:            true,
+				ServiceAccountName: "deployer",
+				Volumes: []v1.Volume{{
+					Name:         "docker",
+					VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker.sock"}},
+				}},
+				InitContainers: []v1.Container{{
+					Name:            "setup",
+					SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+				}},
+				Containers: []v1.Container{{
+					Name: "test",
+					SecurityContext: &v1.SecurityContext{
+						Capabilities: &v1.Capabilities{Add: []v1.Capability{"NET_ADMIN"}},
+					},
+				}},
+			},
+			repo: "org/repo",
+			expectedErr: []string{
+				"hostNetwork is not allowed",
+				"hostPID is not allowed",
+				"hostIPC is not allowed",
+				`service account "deployer" is not allowed`,
+				`volume "docker": hostPath "/var/run/docker.sock" is not allowed`,
+				`container "setup": privileged is not allowed`,
+				`container "test": capability "NET_ADMIN" is not allowed`,
+			},
+		},
+		{
+			name:   "global host paths and subpaths are allowed",
+			policy: policy,
+			spec: &v1.PodSpec{Volumes: []v1.Volume{
+				{Name: "cache", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/cache/go/"}}},
+				{Name: "escape", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/cache/../lib"}}},
+				{Name: "prefix", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/cache-other"}}},
+			}},
+			expectedErr: []string{
+				`volume "escape": hostPath "/var/cache/../lib" is not allowed`,
+				`volume "prefix": hostPath "/var/cache-other" is not allowed`,
+			},
+		},
+		{
+			name:   "repo allowlist takes precedence over the org allowlist",
+			policy: policy,
+			spec: &v1.PodSpec{
+				HostNetwork:        true,
+				ServiceAccountName: "deployer",
+				Containers: []v1.Container{{
+					Name: "test",
+					SecurityContext: &v1.SecurityContext{
+						Privileged:   &privileged,
+						Capabilities: &v1.Capabilities{Add: []v1.Capability{"NET_ADMIN"}},
+					},
+				}},
+			},
+			repo: "kubernetes/infra",
+			expectedErr: []string{
+				`service account "deployer" is not allowed`,
+			},
+		},
+		{
+			name:   "repo allowlist doesn't apply to other repos of the org",
+			policy: policy,
+			spec:   &v1.PodSpec{HostNetwork: true, ServiceAccountName: "deployer"},
+			repo:   "kubernetes/kubernetes",
+			expectedErr: []string{
+				"hostNetwork is not allowed",
+			},
+		},
+		{
+			name:   "cluster allowlist doesn't grant privileges the repo isn't allowed",
+			policy: policy,
+			spec: &v1.PodSpec{
+				HostPID: true,
+				HostIPC: true,
+				Volumes: []v1.Volume{{
+					Name:         "docker",
+					VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker.sock"}},
+				}},
+			},
+			repo:    "org/repo",
+			cluster: "trusted",
+			expectedErr: []string{
+				"hostPID is not allowed",
+				"hostIPC is not allowed",
+				`volume "docker": hostPath "/var/run/docker.sock" is not allowed`,
+			},
+		},
+		{
+			name:   "cluster allowlist limits the privileges the repo is allowed",
+			policy: policy,
+			spec: &v1.PodSpec{
+				HostNetwork: true,
+				HostPID:     true,
+				Volumes: []v1.Volume{
+					{Name: "docker", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker.sock"}}},
+					{Name: "run", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run"}}},
+				},
+				Containers: []v1.Container{{
+					Name: "test",
+					SecurityContext: &v1.SecurityContext{
+						Privileged:   &privileged,
+						Capabilities: &v1.Capabilities{Add: []v1.Capability{"NET_ADMIN"}},
+					},
+				}},
+			},
+			repo:    "kubernetes/infra",
+			cluster: "trusted",
+			expectedErr: []string{
+				"hostNetwork is not allowed",
+				`volume "run": hostPath "/var/run" is not allowed`,
+				`container "test": privileged is not allowed`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Validate(tc.spec, tc.repo, tc.cluster)
+			if len(tc.expectedErr) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %v, got none", tc.expectedErr)
+			}
+			for _, expected := range tc.expectedErr {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error to contain %q, got %v", expected, err)
+				}
+			}
+			if count := strings.Count(err.Error(), "not allowed"); count != len(tc.expectedErr) {
+				t.Errorf("expected %d errors, got %d: %v", len(tc.expectedErr), count, err)
+			}
+		})
+	}
+}
+
+func TestPodSecurityValidateProwJob(t *testing.T) {
+	policy := &PodSecurity{Repos: map[string]PodSecurityAllowlist{
+		"org/repo": {HostNetwork: true},
+	}}
+	spec := &v1.PodSpec{HostNetwork: true}
+
+	testCases := []struct {
+		name        string
+		pjs         prowapi.ProwJobSpec
+		expectedErr bool
+	}{
+		{
+			name: "refs are used",
+			pjs:  prowapi.ProwJobSpec{Refs: &prowapi.Refs{Org: "org", Repo: "repo"}, PodSpec: spec},
+		},
+		{
+			name: "first extra refs are used without refs",
+			pjs:  prowapi.ProwJobSpec{ExtraRefs: []prowapi.Refs{{Org: "org", Repo: "repo"}, {Org: "other", Repo: "repo"}}, PodSpec: spec},
+		},
+		{
+			name:        "job of other repo is rejected",
+			pjs:         prowapi.ProwJobSpec{Refs: &prowapi.Refs{Org: "other", Repo: "repo"}, PodSpec: spec},
+			expectedErr: true,
+		},
+		{
+			name:        "job without refs is rejected",
+			pjs:         prowapi.ProwJobSpec{PodSpec: spec},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := policy.ValidateProwJob(tc.pjs); (err != nil) != tc.expectedErr {
+				t.Errorf("expected error: %t, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateJobConfigPodSecurity(t *testing.T) {
+	privileged := true
+	privilegedBase := func(name string) JobBase {
+		return JobBase{
+			Name:  name,
+			Agent: string(prowapi.KubernetesAgent),
+			Spec: &v1.PodSpec{Containers: []v1.Container{{
+				Image:           "docker",
+				SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+			}}},
+		}
+	}
+	periodic := Periodic{JobBase: privilegedBase("periodic"), Interval: "1h"}
+	periodic.ExtraRefs = []prowapi.Refs{{Org: "org", Repo: "repo"}}
+	c := &Config{
+		JobConfig: JobConfig{
+			PresubmitsStatic: map[string][]Presubmit{
+				"org/repo":   {{JobBase: privilegedBase("allowed-presubmit")}},
+				"other/repo": {{JobBase: privilegedBase("rejected-presubmit")}},
+			},
+			PostsubmitsStatic: map[string][]Postsubmit{
+				"other/repo": {{JobBase: privilegedBase("rejected-postsubmit")}},
+			},
+			Periodics: []Periodic{periodic},
+		},
+		ProwConfig: ProwConfig{PodSecurity: &PodSecurity{Repos: map[string]PodSecurityAllowlist{
+			"org/repo": {Privileged: true},
+		}}},
+	}
+
+	err := c.ValidateJobConfig()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, expected := range []string{
+		`invalid presubmit job rejected-presubmit: pod security policy: container "": privileged is not allowed`,
+		`invalid postsubmit job rejected-postsubmit: pod security policy: container "": privileged is not allowed`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got %v", expected, err)
+		}
+	}
+	for _, allowed := range []string{"presubmit job allowed-presubmit", "periodic job periodic"} {
+		if strings.Contains(err.Error(), allowed+": pod security policy") {
+			t.Errorf("expected %s to be allowed, got %v", allowed, err)
+		}
+	}
+}
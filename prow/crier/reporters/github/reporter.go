@@ -134,6 +134,8 @@ func (c *Client) ShouldReport(_ context.Context, _ *logrus.Entry, pj *v1.ProwJob
 		return false // Report presubmit and postsubmit github jobs for github reporter
 	case c.reportAgent != "" && pj.Spec.Agent != c.reportAgent:
 		return false // Only report for specified agent
+	case pj.Spec.Refs != nil && c.config().GitLab.Manages(pj.Spec.Refs.Org, pj.Spec.Refs.Repo):
+		return false // Reported by the gitlab reporter
 	}
 
 	return true
@@ -93,11 +93,35 @@ func TestShouldReport(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "github should not report gitlab jobs",
+			pj: v1.ProwJob{
+				Spec: v1.ProwJobSpec{
+					Type:   v1.PresubmitJob,
+					Report: true,
+					Refs:   &v1.Refs{Org: "group", Repo: "repo"},
+				},
+			},
+		},
+		{
+			name: "should report jobs of repos not hosted on gitlab",
+			pj: v1.ProwJob{
+				Spec: v1.ProwJobSpec{
+					Type:   v1.PresubmitJob,
+					Report: true,
+					Refs:   &v1.Refs{Org: "org", Repo: "repo"},
+				},
+			},
+			report: true,
+		},
 	}
 
+	cfg := func() *config.Config {
+		return &config.Config{ProwConfig: config.ProwConfig{GitLab: &config.GitLab{Orgs: []string{"group"}}}}
+	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			c := NewReporter(nil, nil, tc.reportAgent)
+			c := NewReporter(nil, cfg, tc.reportAgent)
 			if r := c.ShouldReport(context.Background(), logrus.NewEntry(logrus.StandardLogger()), &tc.pj); r == tc.report {
 				return
 			}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitlab implements a reporter that sets GitLab commit statuses
+package gitlab
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+)
+
+const (
+	// GitLabReporterName is the name for gitlab reporter
+	GitLabReporterName = "gitlab-reporter"
+)
+
+type gitlabClient interface {
+	CreateStatus(org, repo, sha string, status github.Status) error
+}
+
+// Client is a gitlab reporter client
+type Client struct {
+	gc     gitlabClient
+	config config.Getter
+}
+
+// NewReporter returns a reporter client
+func NewReporter(gc gitlabClient, cfg config.Getter) *Client {
+	return &Client{gc: gc, config: cfg}
+}
+
+// GetName returns the name of the reporter
+func (c *Client) GetName() string {
+	return GitLabReporterName
+}
+
+// ShouldReport returns if this prowjob should be reported by the gitlab
+// reporter: presubmits and postsubmits of repos hosted on GitLab.
+func (c *Client) ShouldReport(_ context.Context, _ *logrus.Entry, pj *v1.ProwJob) bool {
+	switch {
+	case !pj.Spec.Report || pj.Spec.Refs == nil:
+		return false
+	case pj.Spec.Type != v1.PresubmitJob && pj.Spec.Type != v1.PostsubmitJob:
+		return false
+	}
+	return c.config().GitLab.Manages(pj.Spec.Refs.Org, pj.Spec.Refs.Repo)
+}
+
+// prowjobStateToStatus maps prowjob states to the GitHub states that the
+// GitLab client translates to commit status states.
+func prowjobStateToStatus(state v1.ProwJobState) (string, error) {
+	switch state {
+	case v1.TriggeredState, v1.PendingState:
+		return github.StatusPending, nil
+	case v1.SuccessState:
+		return github.StatusSuccess, nil
+	case v1.ErrorState:
+		return github.StatusError, nil
+	case v1.FailureState, v1.AbortedState:
+		return github.StatusFailure, nil
+	}
+	return "", fmt.Errorf("unknown prowjob state: %s", state)
+}
+
+// Report sets the status of the job on the commit it tested
+func (c *Client) Report(_ context.Context, log *logrus.Entry, pj *v1.ProwJob) ([]*v1.ProwJob, *reconcile.Result, error) {
+	state, err := prowjobStateToStatus(pj.Status.State)
+	if err != nil {
+		return nil, nil, err
+	}
+	refs := pj.Spec.Refs
+	sha := refs.BaseSHA
+	if len(refs.Pulls) > 0 {
+		sha = refs.Pulls[0].SHA
+	}
+	log.WithFields(logrus.Fields{"sha": sha, "state": state}).Debug("Setting GitLab commit status.")
+	err = c.gc.CreateStatus(refs.Org, refs.Repo, sha, github.Status{
+		State:       state,
+		Description: pj.Status.Description,
+		Context:     pj.Spec.Context,
+		TargetURL:   pj.Status.URL,
+	})
+	return []*v1.ProwJob{pj}, nil, err
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+
+	v1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+)
+
+type fakeGitLabClient struct {
+	statuses map[string]github.Status
+}
+
+func (f *fakeGitLabClient) CreateStatus(org, repo, sha string, status github.Status) error {
+	f.statuses[org+"/"+repo+"@"+sha] = status
+	return nil
+}
+
+func testConfig() *config.Config {
+	return &config.Config{ProwConfig: config.ProwConfig{GitLab: &config.GitLab{Repos: []string{"group/repo"}}}}
+}
+
+func TestShouldReport(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		spec     v1.ProwJobSpec
+		expected bool
+	}{
+		{
+			name:     "presubmit of a gitlab repo",
+			spec:     v1.ProwJobSpec{Type: v1.PresubmitJob, Report: true, Refs: &v1.Refs{Org: "group", Repo: "repo"}},
+			expected: true,
+		},
+		{
+			name:     "postsubmit of a gitlab repo",
+			spec:     v1.ProwJobSpec{Type: v1.PostsubmitJob, Report: true, Refs: &v1.Refs{Org: "group", Repo: "repo"}},
+			expected: true,
+		},
+		{
+			name: "job that skips reporting",
+			spec: v1.ProwJobSpec{Type: v1.PresubmitJob, Refs: &v1.Refs{Org: "group", Repo: "repo"}},
+		},
+		{
+			name: "batch of a gitlab repo",
+			spec: v1.ProwJobSpec{Type: v1.BatchJob, Report: true, Refs: &v1.Refs{Org: "group", Repo: "repo"}},
+		},
+		{
+			name: "presubmit of a github repo",
+			spec: v1.ProwJobSpec{Type: v1.PresubmitJob, Report: true, Refs: &v1.Refs{Org: "org", Repo: "repo"}},
+		},
+		{
+			name: "periodic",
+			spec: v1.ProwJobSpec{Type: v1.PeriodicJob, Report: true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewReporter(nil, testConfig)
+			if actual := c.ShouldReport(context.Background(), logrus.NewEntry(logrus.StandardLogger()), &v1.ProwJob{Spec: tc.spec}); actual != tc.expected {
+				t.Errorf("expected ShouldReport to be %t, got %t", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		pj       v1.ProwJob
+		expected map[string]github.Status
+	}{
+		{
+			name: "presubmit status is set on the head of the merge request",
+			pj: v1.ProwJob{
+				Spec: v1.ProwJobSpec{
+					Type:    v1.PresubmitJob,
+					Context: "unit",
+					Refs:    &v1.Refs{Org: "group", Repo: "repo", BaseSHA: "base", Pulls: []v1.Pull{{Number: 1, SHA: "head"}}},
+				},
+				Status: v1.ProwJobStatus{State: v1.AbortedState, Description: "Job aborted.", URL: "https://prow/view/1"},
+			},
+			expected: map[string]github.Status{
+				"group/repo@head": {State: github.StatusFailure, Description: "Job aborted.", Context: "unit", TargetURL: "https://prow/view/1"},
+			},
+		},
+		{
+			name: "postsubmit status is set on the base",
+			pj: v1.ProwJob{
+				Spec: v1.ProwJobSpec{
+					Type:    v1.PostsubmitJob,
+					Context: "build",
+					Refs:    &v1.Refs{Org: "group", Repo: "repo", BaseSHA: "base"},
+				},
+				Status: v1.ProwJobStatus{State: v1.PendingState, Description: "Job triggered."},
+			},
+			expected: map[string]github.Status{
+				"group/repo@base": {State: github.StatusPending, Description: "Job triggered.", Context: "build"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gc := &fakeGitLabClient{statuses: map[string]github.Status{}}
+			c := NewReporter(gc, testConfig)
+			if _, _, err := c.Report(context.Background(), logrus.NewEntry(logrus.StandardLogger()), &tc.pj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, gc.statuses); diff != "" {
+				t.Errorf("unexpected statuses (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
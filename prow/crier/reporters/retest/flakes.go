@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/metadata/junit"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	pkgio "k8s.io/test-infra/prow/io"
+)
+
+// junitRe matches the names of the JUnit artifacts of a job.
+var junitRe = regexp.MustCompile(`^junit.*\.xml$`)
+
+// testResults holds the names of the test cases that failed and passed in a
+// run of a job.
+type testResults struct {
+	failed sets.String
+	passed sets.String
+}
+
+// readTestResults reads the results of the JUnit artifacts of the job whose
+// artifacts are uploaded to dir in bucket.
+func readTestResults(ctx context.Context, opener pkgio.Opener, bucket, dir string) (testResults, error) {
+	results := testResults{failed: sets.NewString(), passed: sets.NewString()}
+	pp, err := prowv1.ParsePath(bucket)
+	if err != nil {
+		return results, err
+	}
+	prefix := fmt.Sprintf("%s://%s/%s/", pp.StorageProvider(), pp.Bucket(), path.Join(dir, "artifacts"))
+	it, err := opener.Iterator(ctx, prefix, "")
+	if err != nil {
+		return results, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	for {
+		attrs, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, fmt.Errorf("failed to list artifacts: %w", err)
+		}
+		if attrs.IsDir || !junitRe.MatchString(path.Base(attrs.Name)) {
+			continue
+		}
+		artifact := fmt.Sprintf("%s://%s/%s", pp.StorageProvider(), pp.Bucket(), attrs.Name)
+		if err := readJUnit(ctx, opener, artifact, results); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func readJUnit(ctx context.Context, opener pkgio.Opener, artifact string, results testResults) error {
+	r, err := opener.Reader(ctx, artifact)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", artifact, err)
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", artifact, err)
+	}
+	suites, err := junit.Parse(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", artifact, err)
+	}
+	var record func(suite junit.Suite)
+	record = func(suite junit.Suite) {
+		for _, subSuite := range suite.Suites {
+			record(subSuite)
+		}
+		for _, result := range suite.Results {
+			switch {
+			case result.Failure != nil || result.Errored != nil:
+				results.failed.Insert(result.Name)
+			case result.Skipped == nil:
+				results.passed.Insert(result.Name)
+			}
+		}
+	}
+	for _, suite := range suites.Suites {
+		record(suite)
+	}
+	return nil
+}
+
+// failureRetention is how long the failures of a run are remembered to learn
+// flakes from the later runs of the job for the same commit.
+const failureRetention = 24 * time.Hour
+
+type failureRecord struct {
+	tests    sets.String
+	recorded time.Time
+}
+
+// flakeTracker learns the flaky test cases of jobs. A test case is flaky if it
+// failed and then passed in runs of a job for the same commit. It is kept in
+// memory, so the learned flakes are forgotten when crier restarts.
+type flakeTracker struct {
+	lock sync.Mutex
+	// failures maps runs to the test cases that failed in them.
+	failures map[string]failureRecord
+	// learned maps jobs to their flaky test cases.
+	learned map[string]sets.String
+}
+
+func newFlakeTracker() *flakeTracker {
+	return &flakeTracker{failures: map[string]failureRecord{}, learned: map[string]sets.String{}}
+}
+
+// observe records the results of a run of job for the commit identified by
+// run and learns the test cases that failed in a previous run for the commit
+// but passed in this one. If the run succeeded, all the test cases that
+// failed previously are learned.
+func (t *flakeTracker) observe(job, run string, results testResults, succeeded bool, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for key, record := range t.failures {
+		if now.Sub(record.recorded) > failureRetention {
+			delete(t.failures, key)
+		}
+	}
+
+	previous := t.failures[run].tests
+	if previous != nil {
+		learned := previous.Intersection(results.passed)
+		if succeeded {
+			learned = previous
+		}
+		if learned.Len() > 0 {
+			if t.learned[job] == nil {
+				t.learned[job] = sets.NewString()
+			}
+			t.learned[job].Insert(learned.UnsortedList()...)
+		}
+	}
+	if succeeded {
+		delete(t.failures, run)
+		return
+	}
+	t.failures[run] = failureRecord{tests: results.failed.Union(nil), recorded: now}
+}
+
+// isLearned returns whether test was learned to be flaky for job.
+func (t *flakeTracker) isLearned(job, test string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.learned[job].Has(test)
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package retest contains a reporter that automatically retests presubmits
+// that failed only because of flaky tests.
+package retest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/crier/reporters/gcs/util"
+	"k8s.io/test-infra/prow/github"
+	pkgio "k8s.io/test-infra/prow/io"
+	"k8s.io/test-infra/prow/kube"
+	"k8s.io/test-infra/prow/pjutil"
+)
+
+const reporterName = "retest-reporter"
+
+var autoRetests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "prow_auto_retests",
+	Help: "Number of presubmits that were retested automatically because they failed only because of flaky tests.",
+}, []string{"org", "repo", "job_name"})
+
+func init() {
+	prometheus.MustRegister(autoRetests)
+}
+
+type githubClient interface {
+	CreateComment(org, repo string, number int, comment string) error
+	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
+}
+
+// Client is a reporter client fed to crier controller
+type Client struct {
+	config   config.Getter
+	opener   pkgio.Opener
+	ghc      githubClient
+	pjclient ctrlruntimeclient.Client
+	flakes   *flakeTracker
+	dryRun   bool
+}
+
+// New creates a new auto-retest reporter.
+func New(cfg config.Getter, opener pkgio.Opener, ghc githubClient, pjclient ctrlruntimeclient.Client, dryRun bool) *Client {
+	return &Client{
+		config:   cfg,
+		opener:   opener,
+		ghc:      ghc,
+		pjclient: pjclient,
+		flakes:   newFlakeTracker(),
+		dryRun:   dryRun,
+	}
+}
+
+// GetName returns the name of the reporter
+func (c *Client) GetName() string {
+	return reporterName
+}
+
+func (c *Client) policyFor(pj *prowv1.ProwJob) *config.AutoRetestPolicy {
+	if pj.Spec.Type != prowv1.PresubmitJob || pj.Spec.Refs == nil || len(pj.Spec.Refs.Pulls) != 1 {
+		return nil
+	}
+	return c.config().AutoRetest.PolicyFor(pj.Spec.Refs.Org, pj.Spec.Refs.Repo)
+}
+
+// ShouldReport returns whether the ProwJob is a completed presubmit of a repo
+// with an auto-retest policy. Successful runs are only needed to learn flakes.
+func (c *Client) ShouldReport(_ context.Context, _ *logrus.Entry, pj *prowv1.ProwJob) bool {
+	policy := c.policyFor(pj)
+	if policy == nil {
+		return false
+	}
+	return pj.Status.State == prowv1.FailureState || (pj.Status.State == prowv1.SuccessState && policy.LearnFlakes)
+}
+
+// Report learns the flakes of the presubmit from its test results and retests
+// it if all the tests that failed are flaky.
+func (c *Client) Report(ctx context.Context, log *logrus.Entry, pj *prowv1.ProwJob) ([]*prowv1.ProwJob, *reconcile.Result, error) {
+	policy := c.policyFor(pj)
+	if policy == nil {
+		return []*prowv1.ProwJob{pj}, nil, nil
+	}
+	bucket, dir, err := util.GetJobDestination(c.config, pj)
+	if err != nil {
+		// Jobs that never ran, e.g. because their pod couldn't be created, have no artifacts.
+		log.WithError(err).Debug("Failed to get job destination, not retesting.")
+		return []*prowv1.ProwJob{pj}, nil, nil
+	}
+	results, err := readTestResults(ctx, c.opener, bucket, dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read test results: %w", err)
+	}
+
+	refs := pj.Spec.Refs
+	job := fmt.Sprintf("%s/%s/%s", refs.Org, refs.Repo, pj.Spec.Job)
+	run := fmt.Sprintf("%s@%s+%d@%s", job, refs.BaseSHA, refs.Pulls[0].Number, refs.Pulls[0].SHA)
+	if policy.LearnFlakes {
+		c.flakes.observe(job, run, results, pj.Status.State == prowv1.SuccessState, time.Now())
+	}
+	if pj.Status.State != prowv1.FailureState {
+		return []*prowv1.ProwJob{pj}, nil, nil
+	}
+
+	// Failures that aren't caused by tests, e.g. build failures, are never retested.
+	if results.failed.Len() == 0 {
+		log.Debug("No failed tests, not retesting.")
+		return []*prowv1.ProwJob{pj}, nil, nil
+	}
+	for _, test := range results.failed.List() {
+		if !policy.IsKnownFlake(test) && !c.flakes.isLearned(job, test) {
+			log.WithField("test", test).Debug("Test is not known to be flaky, not retesting.")
+			return []*prowv1.ProwJob{pj}, nil, nil
+		}
+	}
+	retests, _ := strconv.Atoi(pj.Labels[kube.AutoRetestLabel])
+	if retests >= policy.MaxRetests {
+		log.WithField("retests", retests).Info("Presubmit was already retested the maximum number of times.")
+		return []*prowv1.ProwJob{pj}, nil, nil
+	}
+	superseded, err := c.superseded(ctx, pj)
+	if err != nil {
+		return nil, nil, err
+	}
+	if superseded {
+		log.Debug("Presubmit was already rerun, not retesting.")
+		return []*prowv1.ProwJob{pj}, nil, nil
+	}
+	pr, err := c.ghc.GetPullRequest(refs.Org, refs.Repo, refs.Pulls[0].Number)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get pull request: %w", err)
+	}
+	if pr.State != github.PullRequestStateOpen || pr.Merged {
+		log.WithField("state", pr.State).Debug("Pull request is not open, not retesting.")
+		return []*prowv1.ProwJob{pj}, nil, nil
+	}
+
+	labels := map[string]string{}
+	for k, v := range pj.Labels {
+		labels[k] = v
+	}
+	labels[kube.RetestLabel] = "true"
+	labels[kube.AutoRetestLabel] = strconv.Itoa(retests + 1)
+	newPJ := pjutil.NewProwJob(pj.Spec, labels, pj.Annotations)
+	newPJ.Namespace = pj.Namespace
+	log = log.WithFields(logrus.Fields{"retest": retests + 1, "flakes": results.failed.List()})
+	if c.dryRun {
+		log.Info("Would retest presubmit.")
+		return []*prowv1.ProwJob{pj}, nil, nil
+	}
+	if err := c.pjclient.Create(ctx, &newPJ); err != nil {
+		return nil, nil, fmt.Errorf("failed to create ProwJob: %w", err)
+	}
+	log.WithField("new-prowjob", newPJ.Name).Info("Retested presubmit.")
+	autoRetests.WithLabelValues(refs.Org, refs.Repo, pj.Spec.Job).Inc()
+	if err := c.ghc.CreateComment(refs.Org, refs.Repo, refs.Pulls[0].Number, retestComment(pj, results.failed, retests+1, policy.MaxRetests)); err != nil {
+		log.WithError(err).Warn("Failed to comment on the auto-retest.")
+	}
+	return []*prowv1.ProwJob{pj}, nil, nil
+}
+
+// superseded returns whether a newer run of the presubmit exists for the pull
+// request, e.g. because of a manual retest or a new commit.
+func (c *Client) superseded(ctx context.Context, pj *prowv1.ProwJob) (bool, error) {
+	selector := map[string]string{}
+	for _, label := range []string{kube.ProwJobTypeLabel, kube.OrgLabel, kube.RepoLabel, kube.PullLabel} {
+		selector[label] = pj.Labels[label]
+	}
+	var pjs prowv1.ProwJobList
+	if err := c.pjclient.List(ctx, &pjs, ctrlruntimeclient.MatchingLabels(selector), ctrlruntimeclient.InNamespace(pj.Namespace)); err != nil {
+		return false, fmt.Errorf("failed to list ProwJobs: %w", err)
+	}
+	for _, other := range pjs.Items {
+		if other.Spec.Job == pj.Spec.Job && other.Name != pj.Name && pj.CreationTimestamp.Before(&other.CreationTimestamp) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func retestComment(pj *prowv1.ProwJob, flakes sets.String, retest, maxRetests int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The `%s` job failed only because of tests that are known to be flaky, so it was retested automatically (%d/%d):\n\n", pj.Spec.Job, retest, maxRetests)
+	for _, test := range flakes.List() {
+		fmt.Fprintf(&b, "- `%s`\n", test)
+	}
+	if pj.Status.URL != "" {
+		fmt.Fprintf(&b, "\nSee the [failed run](%s) for details.\n", pj.Status.URL)
+	}
+	b.WriteString("\nPlease help us fix these flakes.\n")
+	return b.String()
+}
@@ -0,0 +1,349 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/crier/reporters/gcs/util"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+	pkgio "k8s.io/test-infra/prow/io"
+	"k8s.io/test-infra/prow/kube"
+)
+
+// fakeOpener serves the artifacts in files, keyed by their full path.
+type fakeOpener struct {
+	pkgio.Opener
+	files map[string]string
+}
+
+func (o *fakeOpener) Reader(_ context.Context, path string) (pkgio.ReadCloser, error) {
+	content, ok := o.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func (o *fakeOpener) Iterator(_ context.Context, prefix, _ string) (pkgio.ObjectIterator, error) {
+	bucketPrefix := prefix[:strings.Index(prefix, "://")+3]
+	bucketPrefix = bucketPrefix + strings.SplitN(strings.TrimPrefix(prefix, bucketPrefix), "/", 2)[0] + "/"
+	it := &fakeIterator{}
+	for path := range o.files {
+		if strings.HasPrefix(path, prefix) {
+			it.names = append(it.names, strings.TrimPrefix(path, bucketPrefix))
+		}
+	}
+	sort.Strings(it.names)
+	return it, nil
+}
+
+type fakeIterator struct {
+	names []string
+}
+
+func (it *fakeIterator) Next(_ context.Context) (pkgio.ObjectAttributes, error) {
+	if len(it.names) == 0 {
+		return pkgio.ObjectAttributes{}, io.EOF
+	}
+	name := it.names[0]
+	it.names = it.names[1:]
+	return pkgio.ObjectAttributes{Name: name, ObjName: name[strings.LastIndex(name, "/")+1:]}, nil
+}
+
+func junitXML(passed []string, failed []string) string {
+	var b strings.Builder
+	b.WriteString(`<testsuites><testsuite name="suite">`)
+	for _, test := range passed {
+		fmt.Fprintf(&b, `<testcase name="%s"></testcase>`, test)
+	}
+	for _, test := range failed {
+		fmt.Fprintf(&b, `<testcase name="%s"><failure>boom</failure></testcase>`, test)
+	}
+	b.WriteString(`</testsuite></testsuites>`)
+	return b.String()
+}
+
+func testConfig(policy config.AutoRetestPolicy) config.Getter {
+	c := &config.Config{
+		ProwConfig: config.ProwConfig{
+			Plank: config.Plank{
+				DefaultDecorationConfigs: config.DefaultDecorationMapToSliceTesting(
+					map[string]*prowv1.DecorationConfig{"*": {
+						GCSConfiguration: &prowv1.GCSConfiguration{
+							Bucket:       "gs://bucket",
+							PathStrategy: prowv1.PathStrategyExplicit,
+						},
+					}}),
+			},
+			AutoRetest: &config.AutoRetest{Repos: map[string]config.AutoRetestPolicy{"org/repo": policy}},
+		},
+	}
+	if err := c.AutoRetest.DefaultAndValidate(); err != nil {
+		panic(err)
+	}
+	return func() *config.Config { return c }
+}
+
+func testProwJob(name string, state prowv1.ProwJobState, labels map[string]string) *prowv1.ProwJob {
+	pjLabels := map[string]string{
+		kube.ProwJobTypeLabel: string(prowv1.PresubmitJob),
+		kube.OrgLabel:         "org",
+		kube.RepoLabel:        "repo",
+		kube.PullLabel:        "1",
+	}
+	for k, v := range labels {
+		pjLabels[k] = v
+	}
+	return &prowv1.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "prowjobs",
+			Labels:            pjLabels,
+			CreationTimestamp: metav1.NewTime(time.Unix(100, 0)),
+		},
+		Spec: prowv1.ProwJobSpec{
+			Type: prowv1.PresubmitJob,
+			Job:  "pull-unit",
+			Refs: &prowv1.Refs{
+				Org:     "org",
+				Repo:    "repo",
+				BaseSHA: "base",
+				Pulls:   []prowv1.Pull{{Number: 1, SHA: "head"}},
+			},
+		},
+		Status: prowv1.ProwJobStatus{State: state, BuildID: name},
+	}
+}
+
+func TestShouldReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   config.AutoRetestPolicy
+		state    prowv1.ProwJobState
+		jobType  prowv1.ProwJobType
+		expected bool
+	}{
+		{
+			name:     "failed presubmit is reported",
+			policy:   config.AutoRetestPolicy{MaxRetests: 1},
+			state:    prowv1.FailureState,
+			jobType:  prowv1.PresubmitJob,
+			expected: true,
+		},
+		{
+			name:    "successful presubmit is not reported without learning flakes",
+			policy:  config.AutoRetestPolicy{MaxRetests: 1},
+			state:   prowv1.SuccessState,
+			jobType: prowv1.PresubmitJob,
+		},
+		{
+			name:     "successful presubmit is reported when learning flakes",
+			policy:   config.AutoRetestPolicy{MaxRetests: 1, LearnFlakes: true},
+			state:    prowv1.SuccessState,
+			jobType:  prowv1.PresubmitJob,
+			expected: true,
+		},
+		{
+			name:    "failed postsubmit is not reported",
+			policy:  config.AutoRetestPolicy{MaxRetests: 1},
+			state:   prowv1.FailureState,
+			jobType: prowv1.PostsubmitJob,
+		},
+		{
+			name:    "failed presubmit is not reported when auto-retest is disabled",
+			state:   prowv1.FailureState,
+			jobType: prowv1.PresubmitJob,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pj := testProwJob("run", tc.state, nil)
+			pj.Spec.Type = tc.jobType
+			c := New(testConfig(tc.policy), nil, nil, nil, false)
+			if got := c.ShouldReport(context.Background(), logrus.NewEntry(logrus.StandardLogger()), pj); got != tc.expected {
+				t.Errorf("expected ShouldReport to return %t, got %t", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         config.AutoRetestPolicy
+		passed, failed []string
+		labels         map[string]string
+		existing       bool
+		prState        string
+		merged         bool
+		expectRetest   bool
+	}{
+		{
+			name:         "only known flakes failed",
+			policy:       config.AutoRetestPolicy{MaxRetests: 2, Flakes: []string{"TestFlaky.*"}},
+			passed:       []string{"TestOK"},
+			failed:       []string{"TestFlakyA", "TestFlakyB"},
+			expectRetest: true,
+		},
+		{
+			name:   "a test that is not flaky failed",
+			policy: config.AutoRetestPolicy{MaxRetests: 2, Flakes: []string{"TestFlaky.*"}},
+			failed: []string{"TestFlakyA", "TestBroken"},
+		},
+		{
+			name:   "no test failed",
+			policy: config.AutoRetestPolicy{MaxRetests: 2, Flakes: []string{".*"}},
+			passed: []string{"TestOK"},
+		},
+		{
+			name:   "maximum number of retests reached",
+			policy: config.AutoRetestPolicy{MaxRetests: 2, Flakes: []string{"TestFlaky.*"}},
+			failed: []string{"TestFlakyA"},
+			labels: map[string]string{kube.AutoRetestLabel: "2"},
+		},
+		{
+			name:     "presubmit was already rerun",
+			policy:   config.AutoRetestPolicy{MaxRetests: 2, Flakes: []string{"TestFlaky.*"}},
+			failed:   []string{"TestFlakyA"},
+			existing: true,
+		},
+		{
+			name:    "pull request was closed",
+			policy:  config.AutoRetestPolicy{MaxRetests: 2, Flakes: []string{"TestFlaky.*"}},
+			failed:  []string{"TestFlakyA"},
+			prState: github.PullRequestStateClosed,
+		},
+		{
+			name:    "pull request was merged",
+			policy:  config.AutoRetestPolicy{MaxRetests: 2, Flakes: []string{"TestFlaky.*"}},
+			failed:  []string{"TestFlakyA"},
+			prState: github.PullRequestStateClosed,
+			merged:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(tc.policy)
+			pj := testProwJob("run", prowv1.FailureState, tc.labels)
+			bucket, dir, err := util.GetJobDestination(cfg, pj)
+			if err != nil {
+				t.Fatalf("failed to get job destination: %v", err)
+			}
+			opener := &fakeOpener{files: map[string]string{
+				fmt.Sprintf("%s/%s/artifacts/junit_01.xml", bucket, dir):  junitXML(tc.passed, tc.failed),
+				fmt.Sprintf("%s/%s/artifacts/build-log.txt", bucket, dir): "not a junit file",
+				fmt.Sprintf("%s/%s/finished.json", bucket, dir):           "{}",
+				fmt.Sprintf("%s/other/artifacts/junit_01.xml", bucket):    junitXML(nil, []string{"TestBroken"}),
+			}}
+			objs := []runtime.Object{pj}
+			if tc.existing {
+				newer := testProwJob("newer", prowv1.PendingState, nil)
+				newer.CreationTimestamp = metav1.NewTime(time.Unix(200, 0))
+				objs = append(objs, newer)
+			}
+			pjclient := fakectrlruntimeclient.NewFakeClient(objs...)
+			ghc := fakegithub.NewFakeClient()
+			if tc.prState == "" {
+				tc.prState = github.PullRequestStateOpen
+			}
+			ghc.PullRequests = map[int]*github.PullRequest{1: {Number: 1, State: tc.prState, Merged: tc.merged}}
+			c := New(cfg, opener, ghc, pjclient, false)
+
+			if _, _, err := c.Report(context.Background(), logrus.NewEntry(logrus.StandardLogger()), pj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var pjs prowv1.ProwJobList
+			if err := pjclient.List(context.Background(), &pjs); err != nil {
+				t.Fatalf("failed to list ProwJobs: %v", err)
+			}
+			var retests []prowv1.ProwJob
+			for _, other := range pjs.Items {
+				if other.Labels[kube.AutoRetestLabel] != tc.labels[kube.AutoRetestLabel] {
+					retests = append(retests, other)
+				}
+			}
+			if !tc.expectRetest {
+				if len(retests) != 0 || len(ghc.IssueComments[1]) != 0 {
+					t.Errorf("expected no retest, got %d ProwJobs and comments %v", len(retests), ghc.IssueComments[1])
+				}
+				return
+			}
+			if len(retests) != 1 {
+				t.Fatalf("expected one retest, got %d", len(retests))
+			}
+			if retests[0].Labels[kube.AutoRetestLabel] != "1" || retests[0].Labels[kube.RetestLabel] != "true" {
+				t.Errorf("expected the retest to be labelled, got %v", retests[0].Labels)
+			}
+			if retests[0].Spec.Job != pj.Spec.Job {
+				t.Errorf("expected the retest to run %s, got %s", pj.Spec.Job, retests[0].Spec.Job)
+			}
+			if len(ghc.IssueComments[1]) != 1 || !strings.Contains(ghc.IssueComments[1][0].Body, "`TestFlakyA`") {
+				t.Errorf("expected a comment listing the flakes, got %v", ghc.IssueComments[1])
+			}
+		})
+	}
+}
+
+func TestFlakeTracker(t *testing.T) {
+	now := time.Now()
+	results := func(passed, failed []string) testResults {
+		return testResults{passed: sets.NewString(passed...), failed: sets.NewString(failed...)}
+	}
+
+	tracker := newFlakeTracker()
+	tracker.observe("job", "run", results([]string{"TestB"}, []string{"TestA", "TestC"}), false, now)
+	if tracker.isLearned("job", "TestA") {
+		t.Error("expected a test that only failed not to be learned")
+	}
+	tracker.observe("job", "run", results([]string{"TestA", "TestB"}, []string{"TestC"}), false, now)
+	if !tracker.isLearned("job", "TestA") {
+		t.Error("expected a test that failed and then passed for the same commit to be learned")
+	}
+	if tracker.isLearned("job", "TestC") || tracker.isLearned("other-job", "TestA") {
+		t.Error("expected flakes to be learned per job and only for tests that passed")
+	}
+	tracker.observe("job", "run", results(nil, nil), true, now)
+	if !tracker.isLearned("job", "TestC") {
+		t.Error("expected the failed tests to be learned when the job succeeds for the same commit")
+	}
+
+	tracker.observe("job", "other-run", results(nil, []string{"TestD"}), false, now)
+	tracker.observe("job", "other-run", results(nil, nil), true, now.Add(2*failureRetention))
+	if tracker.isLearned("job", "TestD") {
+		t.Error("expected failures older than the retention not to be learned")
+	}
+}
@@ -87,17 +87,24 @@ func (c *Cron) QueuedJobs() []string {
 // SyncConfig syncs current cronAgent with current prow config
 // which add/delete jobs accordingly.
 func (c *Cron) SyncConfig(cfg *config.Config) error {
+	return c.SyncPeriodics(cfg.AllPeriodics())
+}
+
+// SyncPeriodics syncs current cronAgent with the given periodics, which
+// may include periodics that are not part of the prow config, e.g. those
+// from in-repo config. Periodics that are not in the list are removed.
+func (c *Cron) SyncPeriodics(periodics []config.Periodic) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	for _, p := range cfg.Periodics {
+	for _, p := range periodics {
 		if err := c.addPeriodic(p); err != nil {
 			return err
 		}
 	}
 
 	periodicNames := sets.NewString()
-	for _, p := range cfg.AllPeriodics() {
+	for _, p := range periodics {
 		periodicNames.Insert(p.Name)
 	}
 
@@ -16,7 +16,10 @@ limitations under the License.
 
 package cherrypicker
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // CreateCherrypickBody creates the body of a cherrypick PR
 func CreateCherrypickBody(num int, requestor, note string) string {
@@ -29,3 +32,27 @@ func CreateCherrypickBody(num int, requestor, note string) string {
 	}
 	return cherryPickBody
 }
+
+// CreateCherrypickConflictBody creates the body of a draft cherrypick PR
+// whose commits contain the conflict markers of the conflicting files, with a
+// checklist of what needs to be done before it can be merged.
+func CreateCherrypickConflictBody(num int, targetBranch, requestor, note string, conflicts []string) string {
+	var checklist []string
+	for _, file := range conflicts {
+		checklist = append(checklist, fmt.Sprintf("- [ ] Resolve the conflicts in `%s`", file))
+	}
+	checklist = append(checklist,
+		"- [ ] Push the resolution to this branch",
+		"- [ ] Mark this pull request as ready for review",
+	)
+	cherryPickBody := fmt.Sprintf("This is an automated cherry-pick of #%d\n\n"+
+		"It did not apply cleanly on top of `%s`, so the conflicting files were committed with their conflict markers. "+
+		"Before this pull request can be merged:\n\n%s", num, targetBranch, strings.Join(checklist, "\n"))
+	if len(requestor) != 0 {
+		cherryPickBody = fmt.Sprintf("%s\n\n/assign %s", cherryPickBody, requestor)
+	}
+	if len(note) != 0 {
+		cherryPickBody = fmt.Sprintf("%s\n\n%s", cherryPickBody, note)
+	}
+	return cherryPickBody
+}
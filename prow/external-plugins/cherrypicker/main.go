@@ -49,7 +49,7 @@ type options struct {
 	prowAssignments   bool
 	allowAll          bool
 	issueOnConflict   bool
-	labelPrefix       string
+	labelPrefixes     prowflagutil.Strings
 }
 
 func (o *options) Validate() error {
@@ -63,7 +63,7 @@ func (o *options) Validate() error {
 }
 
 func gatherOptions() options {
-	o := options{}
+	o := options{labelPrefixes: prowflagutil.NewStrings(defaultLabelPrefixes...)}
 	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	fs.IntVar(&o.port, "port", 8888, "Port to listen on.")
 	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Uses API tokens but does not mutate.")
@@ -72,8 +72,8 @@ func gatherOptions() options {
 	fs.StringVar(&o.logLevel, "log-level", "debug", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
 	fs.BoolVar(&o.prowAssignments, "use-prow-assignments", true, "Use prow commands to assign cherrypicked PRs.")
 	fs.BoolVar(&o.allowAll, "allow-all", false, "Allow anybody to use automated cherrypicks by skipping GitHub organization membership checks.")
-	fs.BoolVar(&o.issueOnConflict, "create-issue-on-conflict", false, "Create a GitHub issue and assign it to the requestor on cherrypick conflict.")
-	fs.StringVar(&o.labelPrefix, "label-prefix", defaultLabelPrefix, "Set a custom label prefix.")
+	fs.BoolVar(&o.issueOnConflict, "create-issue-on-conflict", false, "Create a GitHub issue and assign it to the requestor when a cherrypick cannot be applied, even with conflicts.")
+	fs.Var(&o.labelPrefixes, "label-prefix", fmt.Sprintf("Prefix of the labels that request a cherrypick to the branch named by the rest of the label. Can be passed multiple times, defaults to %v.", defaultLabelPrefixes))
 	for _, group := range []flagutil.OptionGroup{&o.github, &o.instrumentationOptions} {
 		group.AddFlags(fs)
 	}
@@ -140,7 +140,7 @@ func main() {
 		prowAssignments: o.prowAssignments,
 		allowAll:        o.allowAll,
 		issueOnConflict: o.issueOnConflict,
-		labelPrefix:     o.labelPrefix,
+		labelPrefixes:   o.labelPrefixes.Strings(),
 
 		bare:     &http.Client{},
 		patchURL: "https://patch-diff.githubusercontent.com",
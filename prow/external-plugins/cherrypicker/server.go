@@ -27,10 +27,12 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/sirupsen/logrus"
 
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/config"
 	cherrypicker "k8s.io/test-infra/prow/external-plugins/cherrypicker/lib"
 	"k8s.io/test-infra/prow/git/v2"
@@ -40,7 +42,10 @@ import (
 )
 
 const pluginName = "cherrypick"
-const defaultLabelPrefix = "cherrypick/"
+
+// defaultLabelPrefixes are the prefixes of the labels that request a
+// cherry-pick to the branch named by the rest of the label.
+var defaultLabelPrefixes = []string{"cherrypick/", "cherry-pick/"}
 
 var cherryPickRe = regexp.MustCompile(`(?m)^(?:/cherrypick|/cherry-pick)\s+(.+)$`)
 var releaseNoteRe = regexp.MustCompile(`(?s)(?:Release note\*\*:\s*(?:<!--[^<>]*-->\s*)?` + "```(?:release-note)?|```release-note)(.+?)```")
@@ -51,7 +56,9 @@ type githubClient interface {
 	CreateComment(org, repo string, number int, comment string) error
 	CreateFork(org, repo string) (string, error)
 	CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error)
+	CreateDraftPullRequest(org, repo, title, body, head, base string, canModify bool) (int, error)
 	CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error)
+	EditComment(org, repo string, id int, comment string) error
 	EnsureFork(forkingUser, org, repo string) (string, error)
 	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
 	GetPullRequestPatch(org, repo string, number int) ([]byte, error)
@@ -66,15 +73,15 @@ type githubClient interface {
 // HelpProvider construct the pluginhelp.PluginHelp for this plugin.
 func HelpProvider(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
 	pluginHelp := &pluginhelp.PluginHelp{
-		Description: `The cherrypick plugin is used for cherrypicking PRs across branches. For every successful cherrypick invocation a new PR is opened against the target branch and assigned to the requestor. If the parent PR contains a release note, it is copied to the cherrypick PR.`,
+		Description: `The cherrypick plugin is used for cherrypicking PRs across branches. For every successful cherrypick invocation a new PR is opened against the target branch and assigned to the requestor. If the parent PR contains a release note, it is copied to the cherrypick PR. Cherrypicks can also be requested with labels like 'cherry-pick/release-1.15', which are acted on once the PR merges. When the PR does not apply cleanly, a draft PR is opened with the conflict markers committed and a checklist to resolve them. A status comment tracks the cherrypick to every target branch.`,
 	}
 	pluginHelp.AddCommand(pluginhelp.Command{
-		Usage:       "/cherrypick [branch]",
-		Description: "Cherrypick a PR to a different branch. This command works both in merged PRs (the cherrypick PR is opened immediately) and open PRs (the cherrypick PR opens as soon as the original PR merges).",
+		Usage:       "/cherrypick [branch...]",
+		Description: "Cherrypick a PR to one or more different branches. This command works both in merged PRs (the cherrypick PRs are opened immediately) and open PRs (the cherrypick PRs open as soon as the original PR merges).",
 		Featured:    true,
 		// depends on how the cherrypick server runs; needs auth by default (--allow-all=false)
 		WhoCanUse: "Members of the trusted organization for the repo.",
-		Examples:  []string{"/cherrypick release-3.9", "/cherry-pick release-1.15"},
+		Examples:  []string{"/cherrypick release-3.9", "/cherry-pick release-1.15", "/cherrypick release-1.14 release-1.15"},
 	})
 	return pluginHelp, nil
 }
@@ -98,10 +105,10 @@ type Server struct {
 	prowAssignments bool
 	// Allow anybody to do cherrypicks.
 	allowAll bool
-	// Create an issue on cherrypick conflict.
+	// Create an issue when a cherrypick cannot be applied at all.
 	issueOnConflict bool
-	// Set a custom label prefix.
-	labelPrefix string
+	// Prefixes of the labels that request cherrypicks.
+	labelPrefixes []string
 
 	bare     *http.Client
 	patchURL string
@@ -110,6 +117,8 @@ type Server struct {
 	repos    []github.Repo
 	mapLock  sync.Mutex
 	lockMap  map[cherryPickRequest]*sync.Mutex
+	// statusLock serializes the updates of status comments.
+	statusLock sync.Mutex
 }
 
 type cherryPickRequest struct {
@@ -182,11 +191,19 @@ func (s *Server) handleIssueComment(l *logrus.Entry, ic github.IssueCommentEvent
 		github.PrLogField:   num,
 	})
 
-	cherryPickMatches := cherryPickRe.FindAllStringSubmatch(ic.Comment.Body, -1)
-	if len(cherryPickMatches) == 0 || len(cherryPickMatches[0]) != 2 {
+	var targetBranches []string
+	seenBranches := sets.NewString()
+	for _, match := range cherryPickRe.FindAllStringSubmatch(ic.Comment.Body, -1) {
+		for _, targetBranch := range splitBranches(match[1]) {
+			if !seenBranches.Has(targetBranch) {
+				seenBranches.Insert(targetBranch)
+				targetBranches = append(targetBranches, targetBranch)
+			}
+		}
+	}
+	if len(targetBranches) == 0 {
 		return nil
 	}
-	targetBranch := strings.TrimSpace(cherryPickMatches[0][1])
 
 	if ic.Issue.State != "closed" {
 		if !s.allowAll {
@@ -201,7 +218,13 @@ func (s *Server) handleIssueComment(l *logrus.Entry, ic github.IssueCommentEvent
 				return s.ghc.CreateComment(org, repo, num, plugins.FormatICResponse(ic.Comment, resp))
 			}
 		}
-		resp := fmt.Sprintf("once the present PR merges, I will cherry-pick it on top of %s in a new PR and assign it to you.", targetBranch)
+		for _, targetBranch := range targetBranches {
+			s.updateStatus(l, org, repo, num, targetBranch, branchStatus{State: statePending})
+		}
+		resp := fmt.Sprintf("once the present PR merges, I will cherry-pick it on top of %s in a new PR and assign it to you.", targetBranches[0])
+		if len(targetBranches) > 1 {
+			resp = fmt.Sprintf("once the present PR merges, I will cherry-pick it on top of %s in new PRs and assign them to you.", strings.Join(targetBranches, ", "))
+		}
 		l.Info(resp)
 		return s.ghc.CreateComment(org, repo, num, plugins.FormatICResponse(ic.Comment, resp))
 	}
@@ -221,13 +244,6 @@ func (s *Server) handleIssueComment(l *logrus.Entry, ic github.IssueCommentEvent
 		return s.ghc.CreateComment(org, repo, num, plugins.FormatICResponse(ic.Comment, resp))
 	}
 
-	// TODO: Use an allowlist for allowed base and target branches.
-	if baseBranch == targetBranch {
-		resp := fmt.Sprintf("base branch (%s) needs to differ from target branch (%s)", baseBranch, targetBranch)
-		l.Info(resp)
-		return s.ghc.CreateComment(org, repo, num, plugins.FormatICResponse(ic.Comment, resp))
-	}
-
 	if !s.allowAll {
 		// Only org members should be able to do cherry-picks.
 		ok, err := s.ghc.IsMember(org, commentAuthor)
@@ -241,12 +257,26 @@ func (s *Server) handleIssueComment(l *logrus.Entry, ic github.IssueCommentEvent
 		}
 	}
 
-	*l = *l.WithFields(logrus.Fields{
-		"requestor":     ic.Comment.User.Login,
-		"target_branch": targetBranch,
-	})
-	l.Debug("Cherrypick request.")
-	return s.handle(l, ic.Comment.User.Login, &ic.Comment, org, repo, targetBranch, title, body, num)
+	*l = *l.WithField("requestor", ic.Comment.User.Login)
+	// Handle the target branches serially, like the requests of a merged PR.
+	var errs []error
+	for _, targetBranch := range targetBranches {
+		// TODO: Use an allowlist for allowed base and target branches.
+		if baseBranch == targetBranch {
+			resp := fmt.Sprintf("base branch (%s) needs to differ from target branch (%s)", baseBranch, targetBranch)
+			l.Info(resp)
+			if err := s.ghc.CreateComment(org, repo, num, plugins.FormatICResponse(ic.Comment, resp)); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		l := l.WithField("target_branch", targetBranch)
+		l.Debug("Cherrypick request.")
+		if err := s.handle(l, ic.Comment.User.Login, &ic.Comment, org, repo, targetBranch, title, body, num); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create cherrypick to %s: %w", targetBranch, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
 }
 
 func (s *Server) handlePullRequest(l *logrus.Entry, pre github.PullRequestEvent) error {
@@ -287,11 +317,12 @@ func (s *Server) handlePullRequest(l *logrus.Entry, pre github.PullRequestEvent)
 		c := comments[i]
 		cherryPickMatches := cherryPickRe.FindAllStringSubmatch(c.Body, -1)
 		for _, match := range cherryPickMatches {
-			targetBranch := strings.TrimSpace(match[1])
-			if requestorToComments[c.User.Login] == nil {
-				requestorToComments[c.User.Login] = make(map[string]*github.IssueComment)
+			for _, targetBranch := range splitBranches(match[1]) {
+				if requestorToComments[c.User.Login] == nil {
+					requestorToComments[c.User.Login] = make(map[string]*github.IssueComment)
+				}
+				requestorToComments[c.User.Login][targetBranch] = &c
 			}
-			requestorToComments[c.User.Login][targetBranch] = &c
 		}
 	}
 
@@ -309,9 +340,12 @@ func (s *Server) handlePullRequest(l *logrus.Entry, pre github.PullRequestEvent)
 
 	foundCherryPickLabels := false
 	for _, label := range labels {
-		if strings.HasPrefix(label.Name, s.labelPrefix) {
-			requestorToComments[pr.User.Login][label.Name[len(s.labelPrefix):]] = nil // leave this nil which indicates a label-initiated cherry-pick
-			foundCherryPickLabels = true
+		for _, prefix := range s.labelPrefixes {
+			if strings.HasPrefix(label.Name, prefix) {
+				requestorToComments[pr.User.Login][label.Name[len(prefix):]] = nil // leave this nil which indicates a label-initiated cherry-pick
+				foundCherryPickLabels = true
+				break
+			}
 		}
 	}
 
@@ -345,8 +379,15 @@ func (s *Server) handlePullRequest(l *logrus.Entry, pre github.PullRequestEvent)
 	}
 
 	// Handle multiple comments serially. Make sure to filter out
-	// comments targeting the same branch.
+	// comments targeting the same branch, and branches that already
+	// have a cherrypick PR because the PR was labeled again.
 	handledBranches := make(map[string]bool)
+	_, statuses := s.statusFrom(comments)
+	for targetBranch, status := range statuses {
+		if status.State == stateOpened || status.State == stateConflict {
+			handledBranches[targetBranch] = true
+		}
+	}
 	var errs []error
 	for requestor, branches := range requestorToComments {
 		for targetBranch, ic := range branches {
@@ -399,6 +440,7 @@ func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.
 	if err != nil {
 		logger.WithError(err).Warn("failed to ensure fork exists")
 		resp := fmt.Sprintf("cannot fork %s/%s: %v", org, repo, err)
+		s.updateStatus(logger, org, repo, num, targetBranch, branchStatus{State: stateFailed, Message: resp})
 		return s.createComment(logger, org, repo, num, comment, resp)
 	}
 
@@ -416,6 +458,7 @@ func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.
 	if err := r.Checkout(targetBranch); err != nil {
 		logger.WithError(err).Warn("failed to checkout target branch")
 		resp := fmt.Sprintf("cannot checkout `%s`: %v", targetBranch, err)
+		s.updateStatus(logger, org, repo, num, targetBranch, branchStatus{State: stateFailed, Message: resp})
 		return s.createComment(logger, org, repo, num, comment, resp)
 	}
 	logger.WithField("duration", time.Since(startClone)).Info("Cloned and checked out target branch.")
@@ -451,6 +494,7 @@ func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.
 			if pr.Head.Ref == fmt.Sprintf("%s:%s", s.botUser.Login, newBranch) {
 				logger.WithField("preexisting_cherrypick", pr.HTMLURL).Info("PR already has cherrypick")
 				resp := fmt.Sprintf("Looks like #%d has already been cherry picked in %s", num, pr.HTMLURL)
+				s.updateStatus(logger, org, repo, num, targetBranch, branchStatus{State: stateOpened, PullRequest: pr.Number})
 				return s.createComment(logger, org, repo, num, comment, resp)
 			}
 		}
@@ -464,11 +508,14 @@ func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.
 	// Title for GitHub issue/PR.
 	title = fmt.Sprintf("[%s] %s", targetBranch, title)
 
-	// Apply the patch.
-	if err := r.Am(localPath); err != nil {
+	// Apply the patch. Conflicts are committed with their markers, to be
+	// resolved in a draft PR.
+	conflicts, err := r.AmWithConflicts(localPath)
+	if err != nil {
 		errs := []error{fmt.Errorf("failed to `git am`: %w", err)}
 		logger.WithError(err).Warn("failed to apply PR on top of target branch")
 		resp := fmt.Sprintf("#%d failed to apply on top of branch %q:\n```\n%v\n```", num, targetBranch, err)
+		s.updateStatus(logger, org, repo, num, targetBranch, branchStatus{State: stateFailed, Message: fmt.Sprintf("#%d failed to apply on top of branch %q", num, targetBranch)})
 		if err := s.createComment(logger, org, repo, num, comment, resp); err != nil {
 			errs = append(errs, fmt.Errorf("failed to create comment: %w", err))
 		}
@@ -491,25 +538,37 @@ func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.
 	if err := push(forkName, newBranch, true); err != nil {
 		logger.WithError(err).Warn("failed to push chery-picked changes to GitHub")
 		resp := fmt.Sprintf("failed to push cherry-picked changes in GitHub: %v", err)
+		s.updateStatus(logger, org, repo, num, targetBranch, branchStatus{State: stateFailed, Message: resp})
 		return utilerrors.NewAggregate([]error{err, s.createComment(logger, org, repo, num, comment, resp)})
 	}
 
-	// Open a PR in GitHub.
-	var cherryPickBody string
+	// Open a PR in GitHub, as a draft if the conflicts need to be resolved.
+	assignee := ""
 	if s.prowAssignments {
-		cherryPickBody = cherrypicker.CreateCherrypickBody(num, requestor, releaseNoteFromParentPR(body))
-	} else {
-		cherryPickBody = cherrypicker.CreateCherrypickBody(num, "", releaseNoteFromParentPR(body))
+		assignee = requestor
+	}
+	cherryPickBody := cherrypicker.CreateCherrypickBody(num, assignee, releaseNoteFromParentPR(body))
+	createPullRequest := s.ghc.CreatePullRequest
+	if len(conflicts) > 0 {
+		cherryPickBody = cherrypicker.CreateCherrypickConflictBody(num, targetBranch, assignee, releaseNoteFromParentPR(body), conflicts)
+		createPullRequest = s.ghc.CreateDraftPullRequest
 	}
 	head := fmt.Sprintf("%s:%s", s.botUser.Login, newBranch)
-	createdNum, err := s.ghc.CreatePullRequest(org, repo, title, cherryPickBody, head, targetBranch, true)
+	createdNum, err := createPullRequest(org, repo, title, cherryPickBody, head, targetBranch, true)
 	if err != nil {
 		logger.WithError(err).Warn("failed to create new pull request")
 		resp := fmt.Sprintf("new pull request could not be created: %v", err)
+		s.updateStatus(logger, org, repo, num, targetBranch, branchStatus{State: stateFailed, Message: resp})
 		return utilerrors.NewAggregate([]error{err, s.createComment(logger, org, repo, num, comment, resp)})
 	}
 	*logger = *logger.WithField("new_pull_request_number", createdNum)
 	resp := fmt.Sprintf("new pull request created: #%d", createdNum)
+	status := branchStatus{State: stateOpened, PullRequest: createdNum}
+	if len(conflicts) > 0 {
+		resp = fmt.Sprintf("#%d did not apply cleanly on top of branch %q, new draft pull request created with the conflicts to resolve: #%d", num, targetBranch, createdNum)
+		status = branchStatus{State: stateConflict, PullRequest: createdNum, Conflicts: conflicts}
+	}
+	s.updateStatus(logger, org, repo, num, targetBranch, status)
 	logger.Info("new pull request created")
 	if err := s.createComment(logger, org, repo, num, comment, resp); err != nil {
 		return fmt.Errorf("failed to create comment: %w", err)
@@ -591,6 +650,14 @@ func (s *Server) getPatch(org, repo, targetBranch string, num int) (string, erro
 	return localPath, nil
 }
 
+// splitBranches splits the target branches of a cherrypick command, which
+// are separated by spaces or commas.
+func splitBranches(branches string) []string {
+	return strings.FieldsFunc(branches, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
 func normalize(input string) string {
 	return strings.Replace(input, "/", "-", -1)
 }
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 
@@ -85,9 +86,26 @@ func (f *fghc) CreateComment(org, repo string, number int, comment string) error
 	f.Lock()
 	defer f.Unlock()
 	f.comments = append(f.comments, fmt.Sprintf(commentFormat, org, repo, number, comment))
+	f.prComments = append(f.prComments, github.IssueComment{
+		ID:   len(f.prComments) + 1,
+		Body: comment,
+		User: github.User{Login: "ci-robot"},
+	})
 	return nil
 }
 
+func (f *fghc) EditComment(org, repo string, id int, comment string) error {
+	f.Lock()
+	defer f.Unlock()
+	for i := range f.prComments {
+		if f.prComments[i].ID == id {
+			f.prComments[i].Body = comment
+			return nil
+		}
+	}
+	return fmt.Errorf("no comment with ID %d", id)
+}
+
 func (f *fghc) IsMember(org, user string) (bool, error) {
 	f.Lock()
 	defer f.Unlock()
@@ -149,6 +167,14 @@ func (f *fghc) CreateIssue(org, repo, title, body string, milestone int, labels,
 }
 
 func (f *fghc) CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error) {
+	return f.createPullRequest(title, body, head, base, false)
+}
+
+func (f *fghc) CreateDraftPullRequest(org, repo, title, body, head, base string, canModify bool) (int, error) {
+	return f.createPullRequest(title, body, head, base, true)
+}
+
+func (f *fghc) createPullRequest(title, body, head, base string, draft bool) (int, error) {
 	f.Lock()
 	defer f.Unlock()
 	num := len(f.prs) + 1
@@ -158,6 +184,7 @@ func (f *fghc) CreatePullRequest(org, repo, title, body, head, base string, canM
 		Number: num,
 		Head:   github.PullRequestBranch{Ref: head},
 		Base:   github.PullRequestBranch{Ref: base},
+		Draft:  draft,
 	})
 	return num, nil
 }
@@ -564,20 +591,20 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 	}
 
 	testCases := []struct {
-		name        string
-		labelPrefix string
-		prLabels    []github.Label
+		name          string
+		labelPrefixes []string
+		prLabels      []github.Label
 		prComments  []github.IssueComment
 	}{
 		{
-			name:        "Default label prefix",
-			labelPrefix: defaultLabelPrefix,
+			name:          "Default label prefixes",
+			labelPrefixes: defaultLabelPrefixes,
 			prLabels: []github.Label{
 				{
 					Name: "cherrypick/release-1.5",
 				},
 				{
-					Name: "cherrypick/release-1.6",
+					Name: "cherry-pick/release-1.6",
 				},
 				{
 					Name: "cherrypick/release-1.7",
@@ -585,8 +612,8 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 			},
 		},
 		{
-			name:        "Custom label prefix",
-			labelPrefix: "needs-cherry-pick-",
+			name:          "Custom label prefix",
+			labelPrefixes: []string{"needs-cherry-pick-"},
 			prLabels: []github.Label{
 				{
 					Name: "needs-cherry-pick-release-1.5",
@@ -600,8 +627,8 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 			},
 		},
 		{
-			name:        "No labels, label gets ignored",
-			labelPrefix: "needs-cherry-pick-",
+			name:          "No labels, label gets ignored",
+			labelPrefixes: []string{"needs-cherry-pick-"},
 		},
 	}
 
@@ -651,7 +678,7 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 
 						labels:          []string{"cla: yes"},
 						prowAssignments: false,
-						labelPrefix:     tc.labelPrefix,
+						labelPrefixes:   tc.labelPrefixes,
 					}
 
 					if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()), pr(evt)); err != nil {
@@ -894,3 +921,225 @@ func (tuf *threadUnsafeFGHC) EnsureFork(login, org, repo string) (string, error)
 	tuf.orgRepoCountCalled++
 	return "", errors.New("that is enough")
 }
+
+func TestCherryPickICMultipleBranches(t *testing.T) {
+	t.Parallel()
+	testCherryPickICMultipleBranches(localgit.New, t)
+}
+
+func TestCherryPickICMultipleBranchesV2(t *testing.T) {
+	t.Parallel()
+	testCherryPickICMultipleBranches(localgit.NewV2, t)
+}
+
+func testCherryPickICMultipleBranches(clients localgit.Clients, t *testing.T) {
+	lg, c, err := clients()
+	if err != nil {
+		t.Fatalf("Making localgit: %v", err)
+	}
+	defer func() {
+		if err := lg.Clean(); err != nil {
+			t.Errorf("Cleaning up localgit: %v", err)
+		}
+		if err := c.Clean(); err != nil {
+			t.Errorf("Cleaning up client: %v", err)
+		}
+	}()
+	if err := lg.MakeFakeRepo("foo", "bar"); err != nil {
+		t.Fatalf("Making fake repo: %v", err)
+	}
+	if err := lg.AddCommit("foo", "bar", initialFiles); err != nil {
+		t.Fatalf("Adding initial commit: %v", err)
+	}
+	if err := lg.CheckoutNewBranch("foo", "bar", "release-1.5"); err != nil {
+		t.Fatalf("Checking out pull branch: %v", err)
+	}
+	if err := lg.CheckoutNewBranch("foo", "bar", "release-1.6"); err != nil {
+		t.Fatalf("Checking out pull branch: %v", err)
+	}
+	// The patch conflicts with this change of release-1.6.
+	if err := lg.AddCommit("foo", "bar", map[string][]byte{"bar.go": []byte(`// Package bar does an interesting thing.
+package bar
+
+// Foo does a thing.
+func Foo(wow int) int {
+	return 43 + wow
+}
+`)}); err != nil {
+		t.Fatalf("Adding conflicting commit: %v", err)
+	}
+
+	ghc := &fghc{
+		pr: &github.PullRequest{
+			Base: github.PullRequestBranch{
+				Ref: "master",
+			},
+			Merged: true,
+			Title:  "This is a fix for X",
+			Body:   body,
+		},
+		isMember: true,
+		patch:    patch,
+	}
+	ic := github.IssueCommentEvent{
+		Action: github.IssueCommentActionCreated,
+		Repo: github.Repo{
+			Owner: github.User{
+				Login: "foo",
+			},
+			Name:     "bar",
+			FullName: "foo/bar",
+		},
+		Issue: github.Issue{
+			Number:      2,
+			State:       "closed",
+			PullRequest: &struct{}{},
+		},
+		Comment: github.IssueComment{
+			User: github.User{
+				Login: "wiseguy",
+			},
+			Body: "/cherrypick release-1.5, release-1.6 release-1.7",
+		},
+	}
+
+	botUser := &github.UserData{Login: "ci-robot", Email: "ci-robot@users.noreply.github.com"}
+	s := &Server{
+		botUser:        botUser,
+		gc:             c,
+		push:           func(forkName, newBranch string, force bool) error { return nil },
+		ghc:            ghc,
+		tokenGenerator: func() []byte { return []byte("sha=abcdefg") },
+		log:            logrus.StandardLogger().WithField("client", "cherrypicker"),
+		repos:          []github.Repo{{Fork: true, FullName: "ci-robot/bar"}},
+
+		prowAssignments: true,
+	}
+
+	// release-1.7 does not exist, so the cherry-pick to it fails.
+	if err := s.handleIssueComment(logrus.NewEntry(logrus.StandardLogger()), ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ghc.prs) != 2 {
+		t.Fatalf("Expected 2 PRs, got %d", len(ghc.prs))
+	}
+	releaseNote := "```release-note\nUpdate the magic number from 42 to 49\n```"
+	expected := []string{
+		fmt.Sprintf(expectedFmt, "[release-1.5] This is a fix for X", "This is an automated cherry-pick of #2\n\n/assign wiseguy\n\n"+releaseNote, botUser.Login+":cherry-pick-2-to-release-1.5", "release-1.5", []string{}),
+		fmt.Sprintf(expectedFmt, "[release-1.6] This is a fix for X", "This is an automated cherry-pick of #2\n\n"+
+			"It did not apply cleanly on top of `release-1.6`, so the conflicting files were committed with their conflict markers. Before this pull request can be merged:\n\n"+
+			"- [ ] Resolve the conflicts in `bar.go`\n- [ ] Push the resolution to this branch\n- [ ] Mark this pull request as ready for review\n\n/assign wiseguy\n\n"+releaseNote,
+			botUser.Login+":cherry-pick-2-to-release-1.6", "release-1.6", []string{}),
+	}
+	for i, pr := range ghc.prs {
+		if got := prToString(pr); got != expected[i] {
+			t.Errorf("Expected:\n%s\nGot:\n%s", expected[i], got)
+		}
+	}
+	if ghc.prs[0].Draft || !ghc.prs[1].Draft {
+		t.Errorf("Expected only the conflicting PR to be a draft, got %t and %t", ghc.prs[0].Draft, ghc.prs[1].Draft)
+	}
+
+	_, statuses := s.statusFrom(ghc.prComments)
+	expectedStatuses := map[string]branchStatus{
+		"release-1.5": {State: stateOpened, PullRequest: 1},
+		"release-1.6": {State: stateConflict, PullRequest: 2, Conflicts: []string{"bar.go"}},
+	}
+	if failed := statuses["release-1.7"]; failed.State != stateFailed {
+		t.Errorf("Expected the cherry-pick to release-1.7 to fail, got %+v", failed)
+	}
+	delete(statuses, "release-1.7")
+	if !reflect.DeepEqual(expectedStatuses, statuses) {
+		t.Errorf("Expected statuses %+v, got %+v", expectedStatuses, statuses)
+	}
+	var statusComments int
+	for _, comment := range ghc.prComments {
+		if strings.Contains(comment.Body, statusMarker) {
+			statusComments++
+		}
+	}
+	if statusComments != 1 {
+		t.Errorf("Expected one status comment, got %d", statusComments)
+	}
+}
+
+func TestCherryPickICOpenPR(t *testing.T) {
+	ghc := &fghc{isMember: true}
+	ic := github.IssueCommentEvent{
+		Action: github.IssueCommentActionCreated,
+		Repo: github.Repo{
+			Owner: github.User{Login: "foo"},
+			Name:  "bar",
+		},
+		Issue: github.Issue{
+			Number:      2,
+			State:       "open",
+			PullRequest: &struct{}{},
+		},
+		Comment: github.IssueComment{
+			User: github.User{Login: "wiseguy"},
+			Body: "/cherry-pick release-1.5 release-1.6",
+		},
+	}
+	s := &Server{
+		botUser: &github.UserData{Login: "ci-robot"},
+		ghc:     ghc,
+		log:     logrus.StandardLogger().WithField("client", "cherrypicker"),
+	}
+
+	if err := s.handleIssueComment(logrus.NewEntry(logrus.StandardLogger()), ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, statuses := s.statusFrom(ghc.prComments)
+	expectedStatuses := map[string]branchStatus{
+		"release-1.5": {State: statePending},
+		"release-1.6": {State: statePending},
+	}
+	if !reflect.DeepEqual(expectedStatuses, statuses) {
+		t.Errorf("Expected statuses %+v, got %+v", expectedStatuses, statuses)
+	}
+	if last := ghc.comments[len(ghc.comments)-1]; !strings.Contains(last, "I will cherry-pick it on top of release-1.5, release-1.6 in new PRs and assign them to you.") {
+		t.Errorf("Unexpected response: %s", last)
+	}
+}
+
+func TestSplitBranches(t *testing.T) {
+	for branches, expected := range map[string][]string{
+		"release-1.5":                      {"release-1.5"},
+		"release-1.5 release-1.6\r":        {"release-1.5", "release-1.6"},
+		" release-1.5,release-1.6, stage ": {"release-1.5", "release-1.6", "stage"},
+	} {
+		if actual := splitBranches(branches); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Expected %q to be split into %v, got %v", branches, expected, actual)
+		}
+	}
+}
+
+func TestRenderStatuses(t *testing.T) {
+	statuses := map[string]branchStatus{
+		"release-1.7": {State: stateFailed, Message: "cannot checkout `release-1.7`: error | details\n-->"},
+		"release-1.5": {State: stateOpened, PullRequest: 3},
+		"release-1.6": {State: stateConflict, PullRequest: 4, Conflicts: []string{"a.go", "b.go"}},
+		"release-1.8": {State: statePending},
+	}
+	rendered := renderStatuses(statuses)
+	expectedTable := "Cherry-pick status of this pull request:\n\n" +
+		"| Target branch | Status |\n" +
+		"| --- | --- |\n" +
+		"| `release-1.5` | Opened #3 |\n" +
+		"| `release-1.6` | Opened draft #4, conflicts in `a.go`, `b.go` need to be resolved |\n" +
+		"| `release-1.7` | Failed: cannot checkout `release-1.7`: error \\| details --> |\n" +
+		"| `release-1.8` | Pending, waits for this pull request to merge |\n"
+	if !strings.HasPrefix(rendered, expectedTable) {
+		t.Errorf("Expected the statuses to be rendered as:\n%s\ngot:\n%s", expectedTable, rendered)
+	}
+	parsed, ok := parseStatuses(rendered)
+	if !ok {
+		t.Fatalf("Failed to parse the rendered statuses:\n%s", rendered)
+	}
+	if !reflect.DeepEqual(statuses, parsed) {
+		t.Errorf("Expected to parse %+v, got %+v", statuses, parsed)
+	}
+}
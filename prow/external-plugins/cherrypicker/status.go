@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// statusMarker precedes the JSON encoded statuses in the status comment, so
+// that the comment can be found and updated.
+const statusMarker = "<!-- cherrypicker status: "
+
+type cherryPickState string
+
+const (
+	// statePending means the cherry-pick waits for the PR to merge.
+	statePending cherryPickState = "pending"
+	// stateOpened means the cherry-pick PR was opened.
+	stateOpened cherryPickState = "opened"
+	// stateConflict means the cherry-pick PR was opened as a draft whose
+	// conflicts need to be resolved.
+	stateConflict cherryPickState = "conflict"
+	// stateFailed means no cherry-pick PR could be opened.
+	stateFailed cherryPickState = "failed"
+)
+
+// branchStatus is the status of the cherry-pick of a PR to a target branch.
+type branchStatus struct {
+	State       cherryPickState `json:"state"`
+	PullRequest int             `json:"pull_request,omitempty"`
+	Conflicts   []string        `json:"conflicts,omitempty"`
+	Message     string          `json:"message,omitempty"`
+}
+
+// findStatus returns the status comment of the PR, if any, and the statuses
+// of its target branches.
+func (s *Server) findStatus(org, repo string, num int) (*github.IssueComment, map[string]branchStatus, error) {
+	comments, err := s.ghc.ListIssueComments(org, repo, num)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	comment, statuses := s.statusFrom(comments)
+	return comment, statuses, nil
+}
+
+// statusFrom finds the status comment among the comments of a PR.
+func (s *Server) statusFrom(comments []github.IssueComment) (*github.IssueComment, map[string]branchStatus) {
+	for i := range comments {
+		comment := comments[i]
+		if comment.User.Login != s.botUser.Login {
+			continue
+		}
+		statuses, ok := parseStatuses(comment.Body)
+		if ok {
+			return &comment, statuses
+		}
+	}
+	return nil, map[string]branchStatus{}
+}
+
+// updateStatus records the status of the cherry-pick to the target branch in
+// the status comment of the PR, which is created by the first update. The
+// status comment is only informative, so errors are logged but not returned.
+func (s *Server) updateStatus(l *logrus.Entry, org, repo string, num int, targetBranch string, status branchStatus) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	comment, statuses, err := s.findStatus(org, repo, num)
+	if err != nil {
+		l.WithError(err).Warn("Failed to find the status comment.")
+		return
+	}
+	statuses[targetBranch] = status
+	body := renderStatuses(statuses)
+	if comment == nil {
+		err = s.ghc.CreateComment(org, repo, num, body)
+	} else if comment.Body != body {
+		err = s.ghc.EditComment(org, repo, comment.ID, body)
+	}
+	if err != nil {
+		l.WithError(err).Warn("Failed to update the status comment.")
+	}
+}
+
+func parseStatuses(body string) (map[string]branchStatus, bool) {
+	start := strings.Index(body, statusMarker)
+	if start == -1 {
+		return nil, false
+	}
+	encoded := body[start+len(statusMarker):]
+	end := strings.Index(encoded, " -->")
+	if end == -1 {
+		return nil, false
+	}
+	statuses := map[string]branchStatus{}
+	if err := json.Unmarshal([]byte(encoded[:end]), &statuses); err != nil {
+		return nil, false
+	}
+	return statuses, true
+}
+
+func renderStatuses(statuses map[string]branchStatus) string {
+	var branches []string
+	for branch := range statuses {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+
+	var b strings.Builder
+	b.WriteString("Cherry-pick status of this pull request:\n\n| Target branch | Status |\n| --- | --- |\n")
+	for _, branch := range branches {
+		fmt.Fprintf(&b, "| `%s` | %s |\n", branch, describeStatus(statuses[branch]))
+	}
+	// Marshalling escapes '>', so the statuses cannot end the HTML comment.
+	encoded, _ := json.Marshal(statuses)
+	fmt.Fprintf(&b, "\n%s%s -->", statusMarker, encoded)
+	return b.String()
+}
+
+func describeStatus(status branchStatus) string {
+	switch status.State {
+	case statePending:
+		return "Pending, waits for this pull request to merge"
+	case stateOpened:
+		return fmt.Sprintf("Opened #%d", status.PullRequest)
+	case stateConflict:
+		var files []string
+		for _, file := range status.Conflicts {
+			files = append(files, fmt.Sprintf("`%s`", file))
+		}
+		return fmt.Sprintf("Opened draft #%d, conflicts in %s need to be resolved", status.PullRequest, strings.Join(files, ", "))
+	default:
+		// Messages may contain the output of git, which must not break the table.
+		message := strings.ReplaceAll(strings.Join(strings.Fields(status.Message), " "), "|", `\|`)
+		return fmt.Sprintf("Failed: %s", message)
+	}
+}
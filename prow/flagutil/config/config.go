@@ -19,6 +19,7 @@ package flagutil
 import (
 	"flag"
 	"fmt"
+	"net/url"
 
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/flagutil"
@@ -40,6 +41,9 @@ type ConfigOptions struct {
 	JobConfigPathFlagName                 string
 	SupplementalProwConfigDirs            flagutil.Strings
 	SupplementalProwConfigsFileNameSuffix string
+	// InRepoConfigCacheURL is the address of an in-repo config cache service. If
+	// set, in-repo configs are retrieved from it instead of being cloned locally.
+	InRepoConfigCacheURL string
 }
 
 func (o *ConfigOptions) AddFlags(fs *flag.FlagSet) {
@@ -54,12 +58,18 @@ func (o *ConfigOptions) AddFlags(fs *flag.FlagSet) {
 	fs.Var(&o.SupplementalProwConfigDirs, "supplemental-prow-config-dir", "An additional directory from which to load prow configs. Can be used for config sharding but only supports a subset of the config. The flag can be passed multiple times.")
 	fs.StringVar(&o.SupplementalProwConfigsFileNameSuffix, "supplemental-prow-configs-filename", "_prowconfig.yaml", "Suffix for additional prow configs. Only files with this name will be considered. Deprecated and mutually exclusive with --supplemental-prow-configs-filename-suffix")
 	fs.StringVar(&o.SupplementalProwConfigsFileNameSuffix, "supplemental-prow-configs-filename-suffix", "_prowconfig.yaml", "Suffix for additional prow configs. Only files with this name will be considered")
+	fs.StringVar(&o.InRepoConfigCacheURL, "in-repo-config-cache-url", "", "Address of the in-repo config cache service. If set, in-repo configs are retrieved from it instead of cloning the repositories locally.")
 }
 
 func (o *ConfigOptions) Validate(_ bool) error {
 	if o.ConfigPath == "" {
 		return fmt.Errorf("--%s is mandatory", o.ConfigPathFlagName)
 	}
+	if o.InRepoConfigCacheURL != "" {
+		if _, err := url.ParseRequestURI(o.InRepoConfigCacheURL); err != nil {
+			return fmt.Errorf("--in-repo-config-cache-url is invalid: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -83,5 +93,12 @@ func (o *ConfigOptions) ConfigAgent(reuse ...*config.Agent) (*config.Agent, erro
 }
 
 func (o *ConfigOptions) ConfigAgentWithAdditionals(ca *config.Agent, additionals []func(*config.Config) error) (*config.Agent, error) {
+	if o.InRepoConfigCacheURL != "" {
+		getter := config.InRepoConfigCacheGetter(o.InRepoConfigCacheURL)
+		additionals = append(additionals, func(c *config.Config) error {
+			c.ProwYAMLGetter = getter
+			return nil
+		})
+	}
 	return ca, ca.Start(o.ConfigPath, o.JobConfigPath, o.SupplementalProwConfigDirs.Strings(), o.SupplementalProwConfigsFileNameSuffix, additionals...)
 }
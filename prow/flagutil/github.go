@@ -21,6 +21,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -65,6 +66,11 @@ type GitHubOptions struct {
 	max404Retries  int
 	initialDelay   time.Duration
 	maxSleepTime   time.Duration
+
+	// the following options record or replay the API traffic of the clients
+	cassettePath         string
+	cassetteMode         string
+	cassetteRoundTripper http.RoundTripper
 }
 
 type throttlerSettings struct {
@@ -147,6 +153,8 @@ func (o *GitHubOptions) addFlags(fs *flag.FlagSet, paramFuncs ...FlagParameter)
 	fs.IntVar(&o.max404Retries, "github-client.max-404-retries", github.DefaultMax404Retries, "Maximum number of retries that will be used for a 404-ing request to the GitHub API.")
 	fs.DurationVar(&o.maxSleepTime, "github-client.backoff-timeout", github.DefaultMaxSleepTime, "Largest allowable Retry-After time for requests to the GitHub API.")
 	fs.DurationVar(&o.initialDelay, "github-client.initial-delay", github.DefaultInitialDelay, "Initial delay before retries begin for requests to the GitHub API.")
+	fs.StringVar(&o.cassettePath, "github-cassette-path", "", "Path to a cassette file to record the GitHub API traffic to, or to replay it from. Requires --github-cassette-mode.")
+	fs.StringVar(&o.cassetteMode, "github-cassette-mode", "", fmt.Sprintf("Either %q to record the GitHub API traffic to --github-cassette-path, without credentials, or %q to serve the recorded responses instead of talking to GitHub.", github.CassetteRecord, github.CassetteReplay))
 }
 
 func (o *GitHubOptions) parseOrgThrottlers() error {
@@ -240,7 +248,34 @@ func (o *GitHubOptions) Validate(bool) error {
 		return errors.New("--github-allowed-burst must not be larger than --github-hourly-tokens")
 	}
 
-	return o.parseOrgThrottlers()
+	if err := o.parseOrgThrottlers(); err != nil {
+		return err
+	}
+	return o.parseCassette()
+}
+
+// parseCassette creates the transport that records or replays the API traffic.
+// It is shared by all the clients so that they record to the same cassette.
+func (o *GitHubOptions) parseCassette() error {
+	if (o.cassettePath == "") != (o.cassetteMode == "") {
+		return errors.New("--github-cassette-path and --github-cassette-mode must be set together")
+	}
+	switch github.CassetteMode(o.cassetteMode) {
+	case "":
+	case github.CassetteRecord:
+		logrus.WithField("path", o.cassettePath).Warn("Recording the GitHub API traffic.")
+		o.cassetteRoundTripper = github.NewRecordingRoundTripper(o.cassettePath, nil)
+	case github.CassetteReplay:
+		logrus.WithField("path", o.cassettePath).Warn("Replaying the GitHub API traffic instead of talking to GitHub.")
+		replaying, err := github.NewReplayingRoundTripper(o.cassettePath)
+		if err != nil {
+			return err
+		}
+		o.cassetteRoundTripper = replaying
+	default:
+		return fmt.Errorf("--github-cassette-mode must be %q or %q, not %q", github.CassetteRecord, github.CassetteReplay, o.cassetteMode)
+	}
+	return nil
 }
 
 // GitHubClientWithLogFields returns a GitHub client with extra logging fields
@@ -315,6 +350,8 @@ func (o *GitHubOptions) baseClientOptions() github.ClientOptions {
 		MaxSleepTime:    o.maxSleepTime,
 		MaxRetries:      o.maxRetries,
 		Max404Retries:   o.max404Retries,
+
+		BaseRoundTripper: o.cassetteRoundTripper,
 	}
 }
 
@@ -98,6 +98,40 @@ func TestGitHubOptions_Validate(t *testing.T) {
 			expectedGraphqlEndpoint: github.DefaultGraphQLEndpoint,
 			expectedErr:             false,
 		},
+		{
+			name: "--github-cassette-path without --github-cassette-mode: error",
+			in: &GitHubOptions{
+				cassettePath: "/tmp/cassette.json",
+			},
+			expectedGraphqlEndpoint: github.DefaultGraphQLEndpoint,
+			expectedErr:             true,
+		},
+		{
+			name: "unknown --github-cassette-mode: error",
+			in: &GitHubOptions{
+				cassettePath: "/tmp/cassette.json",
+				cassetteMode: "rewind",
+			},
+			expectedGraphqlEndpoint: github.DefaultGraphQLEndpoint,
+			expectedErr:             true,
+		},
+		{
+			name: "replaying a missing cassette: error",
+			in: &GitHubOptions{
+				cassettePath: "/does/not/exist.json",
+				cassetteMode: "replay",
+			},
+			expectedGraphqlEndpoint: github.DefaultGraphQLEndpoint,
+			expectedErr:             true,
+		},
+		{
+			name: "recording: no error",
+			in: &GitHubOptions{
+				cassettePath: "/tmp/cassette.json",
+				cassetteMode: "record",
+			},
+			expectedGraphqlEndpoint: github.DefaultGraphQLEndpoint,
+		},
 	}
 
 	for _, testCase := range testCases {
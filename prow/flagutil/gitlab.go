@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flagutil
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/config/secret"
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/gitlab"
+)
+
+// GitLabOptions holds options for interacting with GitLab.
+type GitLabOptions struct {
+	endpoint  string
+	TokenPath string
+}
+
+// AddFlags injects GitLab options into the given FlagSet.
+func (o *GitLabOptions) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.endpoint, "gitlab-endpoint", "", "GitLab's endpoint, like https://gitlab.example.com.")
+	fs.StringVar(&o.TokenPath, "gitlab-token-path", "", "Path to the file containing the GitLab personal access token.")
+}
+
+// Validate validates GitLab options.
+func (o *GitLabOptions) Validate(dryRun bool) error {
+	if o.endpoint == "" {
+		logrus.Info("empty -gitlab-endpoint, will not create GitLab client")
+		return nil
+	}
+
+	if _, err := url.ParseRequestURI(o.endpoint); err != nil {
+		return fmt.Errorf("invalid -gitlab-endpoint URI: %q", o.endpoint)
+	}
+
+	if o.TokenPath == "" {
+		return errors.New("-gitlab-token-path is required with -gitlab-endpoint")
+	}
+
+	return nil
+}
+
+// Enabled returns whether a GitLab endpoint was configured.
+func (o *GitLabOptions) Enabled() bool {
+	return o.endpoint != ""
+}
+
+// GitLabClient returns a GitLab client. The token must have been added to
+// the secret agent.
+func (o *GitLabOptions) GitLabClient() (gitlab.Client, error) {
+	if o.endpoint == "" {
+		return nil, errors.New("empty -gitlab-endpoint, cannot create GitLab client")
+	}
+	return gitlab.NewClient(secret.GetTokenGenerator(o.TokenPath), o.endpoint), nil
+}
+
+// GitClientFactory returns a git client factory that clones from GitLab over
+// HTTPS with the GitLab token. The token must have been added to the secret
+// agent.
+func (o *GitLabOptions) GitClientFactory() (git.ClientFactory, error) {
+	if o.endpoint == "" {
+		return nil, errors.New("empty -gitlab-endpoint, cannot create git client factory")
+	}
+	endpoint, err := url.Parse(o.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -gitlab-endpoint URI: %q", o.endpoint)
+	}
+	opts := git.ClientFactoryOpts{
+		Host: endpoint.Host,
+		// GitLab accepts any username with a personal access token.
+		Username: func() (string, error) { return "oauth2", nil },
+		Token:    secret.GetTokenGenerator(o.TokenPath),
+		Censor:   secret.Censor,
+	}
+	return git.NewClientFactory(opts.Apply)
+}
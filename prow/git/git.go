@@ -26,6 +26,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -441,6 +442,47 @@ func (r *Repo) Am(path string) error {
 	return errors.New(msg)
 }
 
+// AmWithConflicts tries to apply the patch in the given path into the current
+// branch like Am. Patches that conflict are committed with the conflict markers
+// in the conflicting files, whose names are returned, so that the conflicts can
+// be resolved later.
+func (r *Repo) AmWithConflicts(path string) ([]string, error) {
+	r.logger.WithField("path", path).Info("Applying, committing conflicts.")
+	conflicts := map[string]bool{}
+	b, err := r.gitCommand("am", "--3way", path).CombinedOutput()
+	for err != nil {
+		output := string(b)
+		r.logger.WithField("out", output).WithError(err).Infof("Patch apply failed.")
+		unmerged, diffErr := r.gitCommand("diff", "--name-only", "--diff-filter=U").CombinedOutput()
+		files := strings.Fields(string(unmerged))
+		if diffErr != nil || len(files) == 0 {
+			if b, abortErr := r.gitCommand("am", "--abort").CombinedOutput(); abortErr != nil {
+				r.logger.WithField("out", string(b)).WithError(abortErr).Warning("Aborting patch apply failed.")
+			}
+			if i := strings.Index(output, "The copy of the patch that failed is found in: .git/rebase-apply/patch"); i != -1 {
+				output = output[:i]
+			}
+			return nil, errors.New(output)
+		}
+		for _, file := range files {
+			conflicts[file] = true
+		}
+		if b, addErr := r.gitCommand("add", "--all").CombinedOutput(); addErr != nil {
+			if b, abortErr := r.gitCommand("am", "--abort").CombinedOutput(); abortErr != nil {
+				r.logger.WithField("out", string(b)).WithError(abortErr).Warning("Aborting patch apply failed.")
+			}
+			return nil, fmt.Errorf("error staging the conflicts: %v: %s", addErr, string(b))
+		}
+		b, err = r.gitCommand("am", "--continue").CombinedOutput()
+	}
+	var files []string
+	for file := range conflicts {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
 // Push pushes over https to the provided owner/repo#branch using a password
 // for basic auth.
 func (r *Repo) Push(branch string, force bool) error {
@@ -105,3 +105,7 @@ func (a *repoClientAdapter) RemoteUpdate() error {
 func (a *repoClientAdapter) FetchRef(refspec string) error {
 	return errors.New("no FetchRef implementation exists in the v1 repo client")
 }
+
+func (a *repoClientAdapter) CommitsBetween(base, head string) ([]Commit, error) {
+	return nil, errors.New("no CommitsBetween implementation exists in the v1 repo client")
+}
@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // Interactor knows how to operate on a git repository cloned from GitHub
@@ -54,6 +55,8 @@ type Interactor interface {
 	MergeAndCheckout(baseSHA string, mergeStrategy string, headSHAs ...string) error
 	// Am calls `git am`
 	Am(path string) error
+	// AmWithConflicts applies the patches like Am, but commits conflicting files with their conflict markers
+	AmWithConflicts(path string) ([]string, error)
 	// Fetch calls `git fetch`
 	Fetch() error
 	// FetchRef fetches the refspec
@@ -70,6 +73,8 @@ type Interactor interface {
 	MergeCommitsExistBetween(target, head string) (bool, error)
 	// ShowRef returns the commit for a commitlike. Unlike rev-parse it does not require a checkout.
 	ShowRef(commitlike string) (string, error)
+	// CommitsBetween returns the commits on the first-parent history of head that are not reachable from base, newest first
+	CommitsBetween(base, head string) ([]Commit, error)
 }
 
 // cacher knows how to cache and update repositories in a central cache
@@ -291,6 +296,36 @@ func (i *interactor) Am(path string) error {
 	return errors.New(string(bytes.TrimPrefix(out, []byte("The copy of the patch that failed is found in: .git/rebase-apply/patch"))))
 }
 
+// AmWithConflicts tries to apply the patch in the given path into the current
+// branch like Am. Patches that conflict are committed with the conflict markers
+// in the conflicting files, whose names are returned, so that the conflicts can
+// be resolved later.
+func (i *interactor) AmWithConflicts(path string) ([]string, error) {
+	i.logger.Infof("Applying patch at %s, committing conflicts", path)
+	conflicts := sets.NewString()
+	out, err := i.executor.Run("am", "--3way", path)
+	for err != nil {
+		i.logger.WithError(err).Infof("Patch apply failed with output: %s", string(out))
+		unmerged, diffErr := i.executor.Run("diff", "--name-only", "--diff-filter=U")
+		files := strings.Fields(string(unmerged))
+		if diffErr != nil || len(files) == 0 {
+			if abortOut, abortErr := i.executor.Run("am", "--abort"); abortErr != nil {
+				i.logger.WithError(abortErr).Warningf("Aborting patch apply failed with output: %s", string(abortOut))
+			}
+			return nil, errors.New(string(bytes.TrimPrefix(out, []byte("The copy of the patch that failed is found in: .git/rebase-apply/patch"))))
+		}
+		conflicts.Insert(files...)
+		if addOut, addErr := i.executor.Run("add", "--all"); addErr != nil {
+			if abortOut, abortErr := i.executor.Run("am", "--abort"); abortErr != nil {
+				i.logger.WithError(abortErr).Warningf("Aborting patch apply failed with output: %s", string(abortOut))
+			}
+			return nil, fmt.Errorf("error staging the conflicts: %w %v", addErr, string(addOut))
+		}
+		out, err = i.executor.Run("am", "--continue")
+	}
+	return conflicts.List(), nil
+}
+
 // RemoteUpdate fetches all updates from the remote.
 func (i *interactor) RemoteUpdate() error {
 	i.logger.Info("Updating from remote")
@@ -393,6 +428,35 @@ func (i *interactor) MergeCommitsExistBetween(target, head string) (bool, error)
 	return len(out) != 0, nil
 }
 
+// Commit is a commit listed by CommitsBetween, identified by its SHA and
+// described by the subject line of its message.
+type Commit struct {
+	SHA     string
+	Subject string
+}
+
+// CommitsBetween runs 'git log <base>..<head> --first-parent' to list the
+// commits that head added to base.
+func (i *interactor) CommitsBetween(base, head string) ([]Commit, error) {
+	i.logger.Infof("Listing the commits between %q and %q", base, head)
+	out, err := i.executor.Run("log", fmt.Sprintf("%s..%s", base, head), "--first-parent", "--format=%H %s")
+	if err != nil {
+		return nil, fmt.Errorf("error listing the commits between %q and %q: %w %v", base, head, err, string(out))
+	}
+	var commits []Commit
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	scan.Split(bufio.ScanLines)
+	for scan.Scan() {
+		parts := strings.SplitN(scan.Text(), " ", 2)
+		commit := Commit{SHA: parts[0]}
+		if len(parts) == 2 {
+			commit.Subject = parts[1]
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
 func (i *interactor) ShowRef(commitlike string) (string, error) {
 	i.logger.Infof("Getting the commit sha for commitlike %s", commitlike)
 	out, err := i.executor.Run("show-ref", "-s", commitlike)
@@ -1027,6 +1027,102 @@ func TestInteractor_Am(t *testing.T) {
 	}
 }
 
+func TestInteractor_AmWithConflicts(t *testing.T) {
+	var testCases = []struct {
+		name              string
+		path              string
+		responses         map[string]execResponse
+		expectedCalls     [][]string
+		expectedConflicts []string
+		expectedErr       bool
+	}{
+		{
+			name: "happy case",
+			path: "my/changes.patch",
+			responses: map[string]execResponse{
+				"am --3way my/changes.patch": {
+					out: []byte(`ok`),
+				},
+			},
+			expectedCalls: [][]string{
+				{"am", "--3way", "my/changes.patch"},
+			},
+		},
+		{
+			name: "conflicts are committed",
+			path: "my/changes.patch",
+			responses: map[string]execResponse{
+				"am --3way my/changes.patch": {
+					err: errors.New("oops"),
+				},
+				"diff --name-only --diff-filter=U": {
+					out: []byte("b.go\na.go\n"),
+				},
+				"add --all": {
+					out: []byte(`ok`),
+				},
+				"am --continue": {
+					out: []byte(`ok`),
+				},
+			},
+			expectedCalls: [][]string{
+				{"am", "--3way", "my/changes.patch"},
+				{"diff", "--name-only", "--diff-filter=U"},
+				{"add", "--all"},
+				{"am", "--continue"},
+			},
+			expectedConflicts: []string{"a.go", "b.go"},
+		},
+		{
+			name: "am fails without conflicts",
+			path: "my/changes.patch",
+			responses: map[string]execResponse{
+				"am --3way my/changes.patch": {
+					err: errors.New("oops"),
+				},
+				"diff --name-only --diff-filter=U": {
+					out: []byte(""),
+				},
+				"am --abort": {
+					out: []byte(`ok`),
+				},
+			},
+			expectedCalls: [][]string{
+				{"am", "--3way", "my/changes.patch"},
+				{"diff", "--name-only", "--diff-filter=U"},
+				{"am", "--abort"},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			e := fakeExecutor{
+				records:   [][]string{},
+				responses: testCase.responses,
+			}
+			i := interactor{
+				executor: &e,
+				logger:   logrus.WithField("test", testCase.name),
+			}
+			actualConflicts, actualErr := i.AmWithConflicts(testCase.path)
+			if testCase.expectedErr && actualErr == nil {
+				t.Errorf("%s: expected an error but got none", testCase.name)
+			}
+			if !testCase.expectedErr && actualErr != nil {
+				t.Errorf("%s: expected no error but got one: %v", testCase.name, actualErr)
+			}
+			if !reflect.DeepEqual(actualConflicts, testCase.expectedConflicts) && (len(actualConflicts) != 0 || len(testCase.expectedConflicts) != 0) {
+				t.Errorf("%s: got incorrect conflicts: %v", testCase.name, diff.ObjectReflectDiff(actualConflicts, testCase.expectedConflicts))
+			}
+			if actual, expected := e.records, testCase.expectedCalls; !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s: got incorrect git calls: %v", testCase.name, diff.ObjectReflectDiff(actual, expected))
+			}
+		})
+	}
+}
+
 func TestInteractor_RemoteUpdate(t *testing.T) {
 	var testCases = []struct {
 		name          string
@@ -1689,6 +1785,79 @@ func TestInteractor_MergeCommitsExistBetween(t *testing.T) {
 	}
 }
 
+func TestInteractor_CommitsBetween(t *testing.T) {
+	var testCases = []struct {
+		name          string
+		responses     map[string]execResponse
+		expectedCalls [][]string
+		expectedOut   []Commit
+		expectedErr   bool
+	}{
+		{
+			name: "happy case",
+			responses: map[string]execResponse{
+				"log base..head --first-parent --format=%H %s": {
+					out: []byte("8df5654e6 Merge pull request #14911 from mborsz/etcd\n96cbeee23 Fix the thing (#14755)\n"),
+				},
+			},
+			expectedCalls: [][]string{
+				{"log", "base..head", "--first-parent", "--format=%H %s"},
+			},
+			expectedOut: []Commit{
+				{SHA: "8df5654e6", Subject: "Merge pull request #14911 from mborsz/etcd"},
+				{SHA: "96cbeee23", Subject: "Fix the thing (#14755)"},
+			},
+		},
+		{
+			name: "no commits",
+			responses: map[string]execResponse{
+				"log base..head --first-parent --format=%H %s": {},
+			},
+			expectedCalls: [][]string{
+				{"log", "base..head", "--first-parent", "--format=%H %s"},
+			},
+		},
+		{
+			name: "log fails",
+			responses: map[string]execResponse{
+				"log base..head --first-parent --format=%H %s": {
+					err: errors.New("oops"),
+				},
+			},
+			expectedCalls: [][]string{
+				{"log", "base..head", "--first-parent", "--format=%H %s"},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			e := fakeExecutor{
+				records:   [][]string{},
+				responses: testCase.responses,
+			}
+			i := interactor{
+				executor: &e,
+				logger:   logrus.WithField("test", testCase.name),
+			}
+			actualOut, actualErr := i.CommitsBetween("base", "head")
+			if !reflect.DeepEqual(testCase.expectedOut, actualOut) {
+				t.Errorf("%s: got incorrect output: %v", testCase.name, diff.ObjectReflectDiff(testCase.expectedOut, actualOut))
+			}
+			if testCase.expectedErr && actualErr == nil {
+				t.Errorf("%s: expected an error but got none", testCase.name)
+			}
+			if !testCase.expectedErr && actualErr != nil {
+				t.Errorf("%s: expected no error but got one: %v", testCase.name, actualErr)
+			}
+			if actual, expected := e.records, testCase.expectedCalls; !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s: got incorrect git calls: %v", testCase.name, diff.ObjectReflectDiff(actual, expected))
+			}
+		})
+	}
+}
+
 func TestInteractor_ShowRef(t *testing.T) {
 	const target = "some-branch"
 	var testCases = []struct {
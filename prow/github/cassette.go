@@ -0,0 +1,322 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CassetteMode is what a cassette is used for.
+type CassetteMode string
+
+const (
+	// CassetteRecord sends requests to GitHub and records them along with
+	// the responses.
+	CassetteRecord CassetteMode = "record"
+	// CassetteReplay serves the recorded responses without talking to GitHub.
+	CassetteReplay CassetteMode = "replay"
+)
+
+// Interaction is a request and the response GitHub sent for it. A cassette
+// is a recording of the API traffic of a client, which can be replayed to
+// reproduce its behavior offline. It is a file with one interaction per
+// line, as JSON.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request without its credentials.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	// URL is the path and query of the request, so that cassettes can be
+	// replayed against any endpoint.
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	RecordedBody
+}
+
+// RecordedResponse is a response without the credentials it may contain.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	RecordedBody
+}
+
+// RecordedBody keeps JSON bodies, which are most of them, as they are so that
+// cassettes are readable and can be edited by hand.
+type RecordedBody struct {
+	Body    json.RawMessage `json:"body,omitempty"`
+	RawBody string          `json:"raw_body,omitempty"`
+}
+
+func newRecordedBody(raw []byte) RecordedBody {
+	if len(raw) == 0 {
+		return RecordedBody{}
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return RecordedBody{RawBody: string(raw)}
+	}
+	return RecordedBody{Body: compact.Bytes()}
+}
+
+// bytes returns the body in its compact form.
+func (b RecordedBody) bytes() []byte {
+	if len(b.Body) == 0 {
+		return []byte(b.RawBody)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, b.Body); err != nil {
+		return b.Body
+	}
+	return compact.Bytes()
+}
+
+// credentialHeaders are never recorded.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+func withoutCredentials(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	header = header.Clone()
+	for _, name := range credentialHeaders {
+		header.Del(name)
+	}
+	return header
+}
+
+// withoutToken redacts the token of GitHub App installation token responses.
+func withoutToken(req *http.Request, body RecordedBody) RecordedBody {
+	if !strings.HasSuffix(req.URL.Path, "/access_tokens") || len(body.Body) == 0 {
+		return body
+	}
+	var token map[string]interface{}
+	if err := json.Unmarshal(body.Body, &token); err != nil {
+		return body
+	}
+	if _, ok := token["token"]; ok {
+		token["token"] = "REDACTED"
+	}
+	redacted, err := json.Marshal(token)
+	if err != nil {
+		return body
+	}
+	body.Body = redacted
+	return body
+}
+
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	raw, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(raw))
+	return raw, err
+}
+
+// recordingRoundTripper sends requests with its delegate and records them in
+// a cassette file.
+type recordingRoundTripper struct {
+	path     string
+	delegate http.RoundTripper
+
+	lock sync.Mutex
+	// file is opened when the first interaction is recorded, replacing any
+	// earlier recording.
+	file *os.File
+}
+
+// NewRecordingRoundTripper returns a RoundTripper for ClientOptions.BaseRoundTripper
+// that records the API traffic in the cassette file at path. Credentials are
+// stripped, and every interaction is appended to the file once its response
+// was read so that nothing is lost if the process is killed.
+func NewRecordingRoundTripper(path string, delegate http.RoundTripper) http.RoundTripper {
+	if delegate == nil {
+		delegate = http.DefaultTransport
+	}
+	return &recordingRoundTripper{path: path, delegate: delegate}
+}
+
+func (r *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	resp, err := r.delegate.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method:       req.Method,
+			URL:          req.URL.RequestURI(),
+			Header:       withoutCredentials(req.Header),
+			RecordedBody: newRecordedBody(reqBody),
+		},
+		Response: RecordedResponse{
+			StatusCode:   resp.StatusCode,
+			Header:       withoutCredentials(resp.Header),
+			RecordedBody: withoutToken(req, newRecordedBody(respBody)),
+		},
+	}
+	if err := r.write(interaction); err != nil {
+		logrus.WithError(err).WithField("path", r.path).Error("Failed to write cassette.")
+	}
+	return resp, nil
+}
+
+// write appends the interaction to the cassette file as a single line.
+func (r *recordingRoundTripper) write(interaction Interaction) error {
+	raw, err := json.Marshal(interaction)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		r.file = file
+	}
+	_, err = r.file.Write(append(raw, '\n'))
+	return err
+}
+
+// ReplayingRoundTripper serves the responses recorded in a cassette.
+type ReplayingRoundTripper struct {
+	lock sync.Mutex
+	// responses are the recorded responses by request, in the order they
+	// were recorded.
+	responses map[string][]RecordedResponse
+	missed    []string
+}
+
+// interactionKey identifies a request. The Accept header is part of it since
+// it selects the media type, and with it the preview features, of the
+// response.
+func interactionKey(method, url, accept string, body []byte) string {
+	return method + " " + url + "\n" + accept + "\n" + string(body)
+}
+
+// NewReplayingRoundTripper returns a RoundTripper for ClientOptions.BaseRoundTripper
+// that serves the responses recorded in the cassette file at path, matching
+// requests by method, path, query, Accept header and body. Identical requests
+// get the responses in the order they were recorded, the last one being
+// repeated.
+func NewReplayingRoundTripper(path string) (*ReplayingRoundTripper, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	defer file.Close()
+	r := &ReplayingRoundTripper{responses: map[string][]RecordedResponse{}}
+	decoder := json.NewDecoder(file)
+	for {
+		var interaction Interaction
+		err := decoder.Decode(&interaction)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// The recording process was killed while writing the last line.
+			logrus.WithField("path", path).Warn("Ignoring the truncated last interaction of the cassette.")
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+		key := interactionKey(interaction.Request.Method, interaction.Request.URL, interaction.Request.Header.Get("Accept"), interaction.Request.bytes())
+		r.responses[key] = append(r.responses[key], interaction.Response)
+	}
+	return r, nil
+}
+
+func (r *ReplayingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	key := interactionKey(req.Method, req.URL.RequestURI(), req.Header.Get("Accept"), newRecordedBody(reqBody).bytes())
+
+	r.lock.Lock()
+	responses := r.responses[key]
+	var recorded RecordedResponse
+	found := len(responses) > 0
+	if found {
+		recorded = responses[0]
+		if len(responses) > 1 {
+			r.responses[key] = responses[1:]
+		}
+	} else {
+		r.missed = append(r.missed, req.Method+" "+req.URL.RequestURI())
+	}
+	r.lock.Unlock()
+
+	if !found {
+		// Neither retried nor mistaken for a missing resource by the client.
+		logrus.WithField("request", req.Method+" "+req.URL.RequestURI()).Error("No response was recorded for the request.")
+		recorded = RecordedResponse{
+			StatusCode:   http.StatusBadRequest,
+			RecordedBody: newRecordedBody([]byte(fmt.Sprintf(`{"message":%q}`, "no response was recorded for "+req.Method+" "+req.URL.RequestURI()))),
+		}
+	}
+	body := recorded.bytes()
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Missed returns the requests there was no recorded response for.
+func (r *ReplayingRoundTripper) Missed() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.missed...)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+)
+
+func cassetteClient(base string, roundTripper http.RoundTripper) Client {
+	_, _, client := NewClientFromOptions(logrus.Fields{}, ClientOptions{
+		GetToken:         func() []byte { return []byte("secret-token") },
+		Censor:           func(content []byte) []byte { return content },
+		Bases:            []string{base},
+		GraphqlEndpoint:  base + "/graphql",
+		BaseRoundTripper: roundTripper,
+		MaxRetries:       1,
+	})
+	client.SetMax404Retries(0)
+	return client
+}
+
+// exercise makes the requests that are recorded and replayed.
+func exercise(t *testing.T, client Client) []string {
+	var seen []string
+	for i := 0; i < 3; i++ {
+		pr, err := client.GetPullRequest("org", "repo", 1)
+		if err != nil {
+			t.Fatalf("failed to get pull request: %v", err)
+		}
+		seen = append(seen, pr.Title)
+	}
+	var query struct {
+		Viewer struct {
+			Login githubql.String
+		}
+	}
+	if err := client.QueryWithGitHubAppsSupport(context.Background(), &query, nil, ""); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	return append(seen, string(query.Viewer.Login))
+}
+
+func TestCassette(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "secret-token") {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Set-Cookie", "session=secret-cookie")
+		switch r.URL.Path {
+		case "/graphql":
+			fmt.Fprint(w, `{"data": {"viewer": {"login": "k8s-ci-robot"}}}`)
+		case "/repos/org/repo/pulls/1":
+			requests++
+			fmt.Fprintf(w, `{"number": 1, "title": "take %d"}`, requests)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recorded := exercise(t, cassetteClient(server.URL, NewRecordingRoundTripper(path, nil)))
+	if expected := []string{"take 1", "take 2", "take 3", "k8s-ci-robot"}; !reflect.DeepEqual(expected, recorded) {
+		t.Fatalf("expected %v while recording, got %v", expected, recorded)
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read cassette: %v", err)
+	}
+	// Every interaction is a line of its own.
+	if lines := strings.Count(string(raw), "\n"); lines != 4 {
+		t.Errorf("expected 4 interactions, got %d lines:\n%s", lines, raw)
+	}
+	for _, secret := range []string{"secret-token", "secret-cookie"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("expected the cassette not to contain %q:\n%s", secret, raw)
+		}
+	}
+
+	// The responses are replayed in order, from any endpoint, without
+	// credentials, and the last one repeats.
+	replaying, err := NewReplayingRoundTripper(path)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+	client := cassetteClient("https://github.invalid", replaying)
+	if replayed := exercise(t, client); !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("expected %v while replaying, got %v", recorded, replayed)
+	}
+	if pr, err := client.GetPullRequest("org", "repo", 1); err != nil || pr.Title != "take 3" {
+		t.Errorf("expected the last response to repeat, got %v, %v", pr, err)
+	}
+	if len(replaying.Missed()) != 0 {
+		t.Errorf("expected no request to be missed, got %v", replaying.Missed())
+	}
+
+	if _, err := client.GetPullRequest("org", "repo", 2); err == nil {
+		t.Error("expected an error for a request that wasn't recorded")
+	}
+	if expected := []string{"GET /repos/org/repo/pulls/2"}; !reflect.DeepEqual(expected, replaying.Missed()) {
+		t.Errorf("expected missed requests %v, got %v", expected, replaying.Missed())
+	}
+}
+
+func TestCassetteRedactsInstallationTokens(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.github.com/app/installations/1/access_tokens", nil)
+	body := withoutToken(req, newRecordedBody([]byte(`{"token": "ghs_secret", "expires_at": "2021-01-01T00:00:00Z"}`)))
+	if strings.Contains(string(body.bytes()), "ghs_secret") {
+		t.Errorf("expected the installation token to be redacted, got %s", body.bytes())
+	}
+	if !strings.Contains(string(body.bytes()), "2021-01-01T00:00:00Z") {
+		t.Errorf("expected the rest of the response to be kept, got %s", body.bytes())
+	}
+}
+
+func TestCassetteMatchesAcceptHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"accept": %q}`, r.Header.Get("Accept"))
+	}))
+	defer server.Close()
+
+	get := func(client *http.Client, base, accept string) string {
+		req, err := http.NewRequest(http.MethodGet, base+"/repos/org/repo", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Accept", accept)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		return string(body)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recording := &http.Client{Transport: NewRecordingRoundTripper(path, nil)}
+	accepts := []string{"application/vnd.github.v3+json", "application/vnd.github.luke-cage-preview+json"}
+	for _, accept := range accepts {
+		get(recording, server.URL, accept)
+	}
+	// A truncated last line, as left by a killed recording, is ignored.
+	if err := appendToFile(path, `{"request": {"method": "GET"`); err != nil {
+		t.Fatalf("failed to truncate cassette: %v", err)
+	}
+
+	replaying, err := NewReplayingRoundTripper(path)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+	client := &http.Client{Transport: replaying}
+	for _, accept := range accepts {
+		if body, expected := get(client, "https://github.invalid", accept), fmt.Sprintf(`{"accept":%q}`, accept); body != expected {
+			t.Errorf("expected %s for Accept %s, got %s", expected, accept, body)
+		}
+	}
+	get(client, "https://github.invalid", "application/vnd.github.squirrel-girl-preview")
+	if expected := []string{"GET /repos/org/repo"}; !reflect.DeepEqual(expected, replaying.Missed()) {
+		t.Errorf("expected the request with another Accept header to be missed, got %v", replaying.Missed())
+	}
+}
+
+func appendToFile(path, content string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
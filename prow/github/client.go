@@ -128,6 +128,7 @@ type PullRequestClient interface {
 	EditPullRequest(org, repo string, number int, pr *PullRequest) (*PullRequest, error)
 	GetPullRequestPatch(org, repo string, number int) ([]byte, error)
 	CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error)
+	CreateDraftPullRequest(org, repo, title, body, head, base string, canModify bool) (int, error)
 	UpdatePullRequest(org, repo string, number int, title, body *string, open *bool, branch *string, canModify *bool) error
 	GetPullRequestChanges(org, repo string, number int) ([]PullRequestChange, error)
 	ListPullRequestComments(org, repo string, number int) ([]ReviewComment, error)
@@ -165,6 +166,11 @@ type RepositoryClient interface {
 	GetBranchProtection(org, repo, branch string) (*BranchProtection, error)
 	RemoveBranchProtection(org, repo, branch string) error
 	UpdateBranchProtection(org, repo, branch string, config BranchProtectionRequest) error
+	ListRepoRulesets(org, repo string) ([]Ruleset, error)
+	GetRepoRuleset(org, repo string, id int) (*Ruleset, error)
+	CreateRepoRuleset(org, repo string, ruleset Ruleset) (*Ruleset, error)
+	UpdateRepoRuleset(org, repo string, id int, ruleset Ruleset) (*Ruleset, error)
+	DeleteRepoRuleset(org, repo string, id int) error
 	AddRepoLabel(org, repo, label, description, color string) error
 	UpdateRepoLabel(org, repo, label, newName, description, color string) error
 	DeleteRepoLabel(org, repo, label string) error
@@ -180,6 +186,11 @@ type RepositoryClient interface {
 	GetDirectory(org, repo, dirpath, commit string) ([]DirectoryContent, error)
 	IsCollaborator(org, repo, user string) (bool, error)
 	ListCollaborators(org, repo string) ([]User, error)
+	ListOutsideCollaborators(org, repo string) ([]User, error)
+	ListRepoInvitations(org, repo string) ([]RepoInvitation, error)
+	AddCollaborator(org, repo, user string, permission TeamPermission) error
+	RemoveCollaborator(org, repo, user string) error
+	ReplaceRepoTopics(org, repo string, topics []string) error
 	CreateFork(owner, repo string) (string, error)
 	EnsureFork(forkingUser, org, repo string) (string, error)
 	ListRepoTeams(org, repo string) ([]Team, error)
@@ -2233,6 +2244,21 @@ func (c *client) CreatePullRequest(org, repo, title, body, head, base string, ca
 	durationLogger := c.log("CreatePullRequest", org, repo, title)
 	defer durationLogger()
 
+	return c.createPullRequest(org, repo, title, body, head, base, canModify, false)
+}
+
+// CreateDraftPullRequest creates a new pull request in the draft state and
+// returns its number.
+//
+// See https://docs.github.com/en/rest/reference/pulls#create-a-pull-request
+func (c *client) CreateDraftPullRequest(org, repo, title, body, head, base string, canModify bool) (int, error) {
+	durationLogger := c.log("CreateDraftPullRequest", org, repo, title)
+	defer durationLogger()
+
+	return c.createPullRequest(org, repo, title, body, head, base, canModify, true)
+}
+
+func (c *client) createPullRequest(org, repo, title, body, head, base string, canModify, draft bool) (int, error) {
 	data := struct {
 		Title string `json:"title"`
 		Body  string `json:"body"`
@@ -2241,6 +2267,7 @@ func (c *client) CreatePullRequest(org, repo, title, body, head, base string, ca
 		// MaintainerCanModify allows maintainers of the repo to modify this
 		// pull request, eg. push changes to it before merging.
 		MaintainerCanModify bool `json:"maintainer_can_modify"`
+		Draft               bool `json:"draft,omitempty"`
 	}{
 		Title: title,
 		Body:  body,
@@ -2248,6 +2275,7 @@ func (c *client) CreatePullRequest(org, repo, title, body, head, base string, ca
 		Base:  base,
 
 		MaintainerCanModify: canModify,
+		Draft:               draft,
 	}
 	var resp struct {
 		Num int `json:"number"`
@@ -2685,6 +2713,132 @@ func (c *client) UpdateBranchProtection(org, repo, branch string, config BranchP
 	return err
 }
 
+// ListRepoRulesets returns the rulesets of the repo, without those of its org.
+// The listed rulesets lack their conditions and rules, see GetRepoRuleset.
+//
+// See https://docs.github.com/en/rest/repos/rules#get-all-repository-rulesets
+func (c *client) ListRepoRulesets(org, repo string) ([]Ruleset, error) {
+	durationLogger := c.log("ListRepoRulesets", org, repo)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	}
+	values := url.Values{
+		"per_page":         []string{"100"},
+		"includes_parents": []string{"false"},
+	}
+	var rulesets []Ruleset
+	err := c.readPaginatedResultsWithValues(
+		fmt.Sprintf("/repos/%s/%s/rulesets", org, repo),
+		values,
+		acceptNone,
+		org,
+		func() interface{} {
+			return &[]Ruleset{}
+		},
+		func(obj interface{}) {
+			rulesets = append(rulesets, *(obj.(*[]Ruleset))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rulesets, nil
+}
+
+// GetRepoRuleset returns a ruleset of the repo, with its conditions and rules.
+//
+// See https://docs.github.com/en/rest/repos/rules#get-a-repository-ruleset
+func (c *client) GetRepoRuleset(org, repo string, id int) (*Ruleset, error) {
+	durationLogger := c.log("GetRepoRuleset", org, repo, id)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	}
+	var ruleset Ruleset
+	_, err := c.request(&request{
+		method:    http.MethodGet,
+		path:      fmt.Sprintf("/repos/%s/%s/rulesets/%d", org, repo, id),
+		org:       org,
+		exitCodes: []int{200},
+	}, &ruleset)
+	if err != nil {
+		return nil, err
+	}
+	return &ruleset, nil
+}
+
+// CreateRepoRuleset creates a ruleset in the repo.
+//
+// See https://docs.github.com/en/rest/repos/rules#create-a-repository-ruleset
+func (c *client) CreateRepoRuleset(org, repo string, ruleset Ruleset) (*Ruleset, error) {
+	durationLogger := c.log("CreateRepoRuleset", org, repo, ruleset)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	} else if c.dry {
+		return &ruleset, nil
+	}
+	var created Ruleset
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        fmt.Sprintf("/repos/%s/%s/rulesets", org, repo),
+		org:         org,
+		requestBody: &ruleset,
+		exitCodes:   []int{201},
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateRepoRuleset replaces a ruleset of the repo.
+//
+// See https://docs.github.com/en/rest/repos/rules#update-a-repository-ruleset
+func (c *client) UpdateRepoRuleset(org, repo string, id int, ruleset Ruleset) (*Ruleset, error) {
+	durationLogger := c.log("UpdateRepoRuleset", org, repo, id, ruleset)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	} else if c.dry {
+		ruleset.ID = id
+		return &ruleset, nil
+	}
+	var updated Ruleset
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		path:        fmt.Sprintf("/repos/%s/%s/rulesets/%d", org, repo, id),
+		org:         org,
+		requestBody: &ruleset,
+		exitCodes:   []int{200},
+	}, &updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteRepoRuleset deletes a ruleset of the repo.
+//
+// See https://docs.github.com/en/rest/repos/rules#delete-a-repository-ruleset
+func (c *client) DeleteRepoRuleset(org, repo string, id int) error {
+	durationLogger := c.log("DeleteRepoRuleset", org, repo, id)
+	defer durationLogger()
+
+	_, err := c.request(&request{
+		method:    http.MethodDelete,
+		path:      fmt.Sprintf("/repos/%s/%s/rulesets/%d", org, repo, id),
+		org:       org,
+		exitCodes: []int{204},
+	}, nil)
+	return err
+}
+
 // AddRepoLabel adds a defined label given org/repo
 //
 // See https://developer.github.com/v3/issues/labels/#create-a-label
@@ -3971,6 +4125,149 @@ func (c *client) ListCollaborators(org, repo string) ([]User, error) {
 	return users, nil
 }
 
+// ListOutsideCollaborators gets a list of the users who have access to a repo
+// without being members of its org, with their permission levels.
+//
+// See https://docs.github.com/en/rest/reference/repos#list-repository-collaborators
+func (c *client) ListOutsideCollaborators(org, repo string) ([]User, error) {
+	durationLogger := c.log("ListOutsideCollaborators", org, repo)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	}
+	path := fmt.Sprintf("/repos/%s/%s/collaborators", org, repo)
+	values := url.Values{
+		"per_page":    []string{"100"},
+		"affiliation": []string{"outside"},
+	}
+	var users []User
+	err := c.readPaginatedResultsWithValues(
+		path,
+		values,
+		acceptNone,
+		org,
+		func() interface{} {
+			return &[]User{}
+		},
+		func(obj interface{}) {
+			users = append(users, *(obj.(*[]User))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListRepoInvitations lists the pending invitations to collaborate on a repo.
+//
+// See https://docs.github.com/en/rest/reference/repos#list-repository-invitations
+func (c *client) ListRepoInvitations(org, repo string) ([]RepoInvitation, error) {
+	durationLogger := c.log("ListRepoInvitations", org, repo)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	}
+	path := fmt.Sprintf("/repos/%s/%s/invitations", org, repo)
+	var invitations []RepoInvitation
+	err := c.readPaginatedResults(
+		path,
+		acceptNone,
+		org,
+		func() interface{} {
+			return &[]RepoInvitation{}
+		},
+		func(obj interface{}) {
+			invitations = append(invitations, *(obj.(*[]RepoInvitation))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// AddCollaborator invites the user to collaborate on the repo with the
+// permission, or updates the permission of an existing collaborator.
+//
+// See https://docs.github.com/en/rest/reference/repos#add-a-repository-collaborator
+func (c *client) AddCollaborator(org, repo, user string, permission TeamPermission) error {
+	durationLogger := c.log("AddCollaborator", org, repo, user, permission)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return nil
+	}
+
+	data := struct {
+		Permission string `json:"permission"`
+	}{
+		Permission: string(permission),
+	}
+
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		path:        fmt.Sprintf("/repos/%s/%s/collaborators/%s", org, repo, user),
+		org:         org,
+		requestBody: &data,
+		// 201 means an invitation was created, 204 that the user already collaborates.
+		exitCodes: []int{201, 204},
+	}, nil)
+	return err
+}
+
+// RemoveCollaborator removes the user from the collaborators of the repo.
+//
+// See https://docs.github.com/en/rest/reference/repos#remove-a-repository-collaborator
+func (c *client) RemoveCollaborator(org, repo, user string) error {
+	durationLogger := c.log("RemoveCollaborator", org, repo, user)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return nil
+	}
+
+	_, err := c.request(&request{
+		method:    http.MethodDelete,
+		path:      fmt.Sprintf("/repos/%s/%s/collaborators/%s", org, repo, user),
+		org:       org,
+		exitCodes: []int{204},
+	}, nil)
+	return err
+}
+
+// ReplaceRepoTopics replaces all the topics of the repo.
+//
+// See https://docs.github.com/en/rest/reference/repos#replace-all-repository-topics
+func (c *client) ReplaceRepoTopics(org, repo string, topics []string) error {
+	durationLogger := c.log("ReplaceRepoTopics", org, repo, topics)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return nil
+	}
+
+	data := struct {
+		Names []string `json:"names"`
+	}{
+		Names: topics,
+	}
+	if data.Names == nil {
+		data.Names = []string{}
+	}
+
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		path:        fmt.Sprintf("/repos/%s/%s/topics", org, repo),
+		org:         org,
+		requestBody: &data,
+		exitCodes:   []int{200},
+	}, nil)
+	return err
+}
+
 // CreateFork creates a fork for the authenticated user. Forking a repository
 // happens asynchronously. Therefore, we may have to wait a short period before
 // accessing the git objects. If this takes longer than 5 minutes, GitHub
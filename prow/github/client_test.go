@@ -1954,6 +1954,118 @@ func TestListCollaborators(t *testing.T) {
 	}
 }
 
+func TestListOutsideCollaborators(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/repo/collaborators" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		if affiliation := r.URL.Query().Get("affiliation"); affiliation != "outside" {
+			t.Errorf("Bad affiliation: %q", affiliation)
+		}
+		fmt.Fprint(w, `[{"login": "foo", "permissions": {"pull": true, "push": true}}]`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	users, err := c.ListOutsideCollaborators("org", "repo")
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	if len(users) != 1 || users[0].Login != "foo" || LevelFromPermissions(users[0].Permissions) != Write {
+		t.Errorf("Wrong users: %v", users)
+	}
+}
+
+func TestListRepoInvitations(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/repo/invitations" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `[{"id": 1, "invitee": {"login": "foo"}, "permissions": "triage"}]`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	invitations, err := c.ListRepoInvitations("org", "repo")
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	if len(invitations) != 1 || invitations[0].Invitee == nil || invitations[0].Invitee.Login != "foo" || invitations[0].Permission != Triage {
+		t.Errorf("Wrong invitations: %v", invitations)
+	}
+}
+
+func TestAddCollaborator(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/org/repo/collaborators/user" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		if string(b) != `{"permission":"triage"}` {
+			t.Errorf("Wrong request: %s", string(b))
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.AddCollaborator("org", "repo", "user", RepoTriage); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestRemoveCollaborator(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/org/repo/collaborators/user" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.RemoveCollaborator("org", "repo", "user"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestReplaceRepoTopics(t *testing.T) {
+	for _, tc := range []struct {
+		topics   []string
+		expected string
+	}{
+		{topics: []string{"go", "ci"}, expected: `{"names":["go","ci"]}`},
+		{expected: `{"names":[]}`},
+	} {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPut {
+				t.Errorf("Bad method: %s", r.Method)
+			}
+			if r.URL.Path != "/repos/org/repo/topics" {
+				t.Errorf("Bad request path: %s", r.URL.Path)
+			}
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("Could not read request body: %v", err)
+			}
+			if string(b) != tc.expected {
+				t.Errorf("Expected request %s, got %s", tc.expected, string(b))
+			}
+			fmt.Fprint(w, string(b))
+		}))
+		c := getClient(ts.URL)
+		if err := c.ReplaceRepoTopics("org", "repo", tc.topics); err != nil {
+			t.Errorf("Didn't expect error: %v", err)
+		}
+		ts.Close()
+	}
+}
+
 func TestListRepoTeams(t *testing.T) {
 	expectedTeams := []Team{
 		{ID: 1, Slug: "foo", Permission: RepoPull},
@@ -2323,6 +2435,143 @@ func TestRemoveBranchProtection(t *testing.T) {
 	}
 }
 
+func TestListRepoRulesets(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/org/repo/rulesets" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		if parents := r.URL.Query().Get("includes_parents"); parents != "false" {
+			t.Errorf("Bad includes_parents: %q", parents)
+		}
+		fmt.Fprint(w, `[{"id": 1, "name": "main", "target": "branch", "enforcement": "active"}]`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	rulesets, err := c.ListRepoRulesets("org", "repo")
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	expected := []Ruleset{{ID: 1, Name: "main", Target: RulesetTargetBranch, Enforcement: RulesetEnforcementActive}}
+	if !reflect.DeepEqual(rulesets, expected) {
+		t.Errorf("Expected rulesets %+v, got %+v", expected, rulesets)
+	}
+}
+
+func TestGetRepoRuleset(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/repo/rulesets/1" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"id": 1, "name": "tags", "target": "tag", "enforcement": "active",
+			"conditions": {"ref_name": {"include": ["refs/tags/v*"], "exclude": []}},
+			"rules": [{"type": "deletion"}, {"type": "required_deployments", "parameters": {"required_deployment_environments": ["staging"]}}]}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	ruleset, err := c.GetRepoRuleset("org", "repo", 1)
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	expected := &Ruleset{
+		ID:          1,
+		Name:        "tags",
+		Target:      RulesetTargetTag,
+		Enforcement: RulesetEnforcementActive,
+		Conditions:  &RulesetConditions{RefName: &RulesetRefNameCondition{Include: []string{"refs/tags/v*"}, Exclude: []string{}}},
+		Rules: []RulesetRule{
+			{Type: RuleDeletion},
+			{Type: RuleRequiredDeployments, Parameters: &RulesetRuleParameters{RequiredDeploymentEnvironments: []string{"staging"}}},
+		},
+	}
+	if !reflect.DeepEqual(ruleset, expected) {
+		t.Errorf("Expected ruleset %+v, got %+v", expected, ruleset)
+	}
+}
+
+func TestCreateAndUpdateRepoRuleset(t *testing.T) {
+	strict := true
+	ruleset := Ruleset{
+		Name:         "main",
+		Target:       RulesetTargetBranch,
+		Enforcement:  RulesetEnforcementEvaluate,
+		BypassActors: []RulesetBypassActor{{ActorID: 5, ActorType: BypassActorTeam, BypassMode: BypassModeAlways}},
+		Rules: []RulesetRule{{Type: RuleRequiredStatusChecks, Parameters: &RulesetRuleParameters{
+			RequiredStatusChecks:             []RulesetStatusCheck{{Context: "test"}},
+			StrictRequiredStatusChecksPolicy: &strict,
+		}}},
+	}
+	expectedBody := `{"name":"main","target":"branch","enforcement":"evaluate","bypass_actors":[{"actor_id":5,"actor_type":"Team","bypass_mode":"always"}],"rules":[{"type":"required_status_checks","parameters":{"required_status_checks":[{"context":"test"}],"strict_required_status_checks_policy":true}}]}`
+	for _, tc := range []struct {
+		method string
+		path   string
+		code   int
+		call   func(c Client) (*Ruleset, error)
+	}{
+		{
+			method: http.MethodPost,
+			path:   "/repos/org/repo/rulesets",
+			code:   http.StatusCreated,
+			call: func(c Client) (*Ruleset, error) {
+				return c.CreateRepoRuleset("org", "repo", ruleset)
+			},
+		},
+		{
+			method: http.MethodPut,
+			path:   "/repos/org/repo/rulesets/7",
+			code:   http.StatusOK,
+			call: func(c Client) (*Ruleset, error) {
+				return c.UpdateRepoRuleset("org", "repo", 7, ruleset)
+			},
+		},
+	} {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != tc.method {
+				t.Errorf("Bad method: %s", r.Method)
+			}
+			if r.URL.Path != tc.path {
+				t.Errorf("Bad request path: %s", r.URL.Path)
+			}
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("Could not read request body: %v", err)
+			}
+			if string(b) != expectedBody {
+				t.Errorf("Wrong request: %s", string(b))
+			}
+			w.WriteHeader(tc.code)
+			fmt.Fprint(w, `{"id": 7, "name": "main"}`)
+		}))
+		c := getClient(ts.URL)
+		got, err := tc.call(c)
+		if err != nil {
+			t.Errorf("%s: didn't expect error: %v", tc.method, err)
+		} else if got.ID != 7 {
+			t.Errorf("%s: expected ruleset 7, got %d", tc.method, got.ID)
+		}
+		ts.Close()
+	}
+}
+
+func TestDeleteRepoRuleset(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/org/repo/rulesets/7" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.DeleteRepoRuleset("org", "repo", 7); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
 func TestUpdateBranchProtection(t *testing.T) {
 	cases := []struct {
 		name string
@@ -2504,6 +2753,38 @@ func TestListPRCommits(t *testing.T) {
 	}
 }
 
+func TestCreateDraftPullRequest(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/k8s/kuber/pulls" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(b, &data); err != nil {
+			t.Errorf("Could not unmarshal request: %v", err)
+		} else if data["draft"] != true || data["head"] != "bot:branch" || data["base"] != "master" {
+			t.Errorf("Wrong request: %s", string(b))
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"number": 6}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	number, err := c.CreateDraftPullRequest("k8s", "kuber", "title", "body", "bot:branch", "master", true)
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	if number != 6 {
+		t.Errorf("Expected pull request 6, got %d", number)
+	}
+}
+
 func TestUpdatePullRequestBranch(t *testing.T) {
 	sha := "74053d555d71a14e3853b97e204d7d6415521375"
 	mismatchedSha := "mismatchedSha"
@@ -125,6 +125,11 @@ type FakeClient struct {
 	// Maps repo name to the list of hooks
 	RepoHooks map[string][]github.Hook
 
+	// Maps org/repo to the list of rulesets
+	RepoRulesets map[string][]github.Ruleset
+	// RulesetID is the ID of the last created ruleset
+	RulesetID int
+
 	// A map of invitation id to user repository invitations
 	UserRepoInvitations map[int]github.UserRepoInvitation
 	// A map of organization invitations by name
@@ -192,6 +197,7 @@ func NewFakeClient() *FakeClient {
 		OrgProjects:         make(map[string][]github.Project),
 		OrgHooks:            make(map[string][]github.Hook),
 		RepoHooks:           make(map[string][]github.Hook),
+		RepoRulesets:        make(map[string][]github.Ruleset),
 		UserRepoInvitations: make(map[int]github.UserRepoInvitation),
 		UserOrgInvitations:  make(map[string]github.UserOrgInvitation),
 	}
@@ -976,6 +982,15 @@ func (f *FakeClient) GetTeamBySlug(slug string, org string) (*github.Team, error
 }
 
 func (f *FakeClient) CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error) {
+	return f.createPullRequest(org, repo, title, body, head, base, false)
+}
+
+// CreateDraftPullRequest creates a pull request in the draft state.
+func (f *FakeClient) CreateDraftPullRequest(org, repo, title, body, head, base string, canModify bool) (int, error) {
+	return f.createPullRequest(org, repo, title, body, head, base, true)
+}
+
+func (f *FakeClient) createPullRequest(org, repo, title, body, head, base string, draft bool) (int, error) {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 	if f.PullRequests == nil {
@@ -994,6 +1009,7 @@ func (f *FakeClient) CreatePullRequest(org, repo, title, body, head, base string
 				Ref:  base,
 				Repo: github.Repo{Owner: github.User{Login: org}, Name: repo},
 			},
+			Draft: draft,
 		}
 		f.Issues[i] = &github.Issue{Number: i}
 		return i, nil
@@ -1102,3 +1118,76 @@ func (f *FakeClient) ListCurrentUserOrgInvitations() ([]github.UserOrgInvitation
 func (f *FakeClient) MutateWithGitHubAppsSupport(ctx context.Context, m interface{}, input githubql.Input, vars map[string]interface{}, org string) error {
 	return nil
 }
+
+// ListRepoRulesets returns the rulesets of the repo without their conditions
+// and rules, as GitHub does.
+func (f *FakeClient) ListRepoRulesets(org, repo string) ([]github.Ruleset, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	var rulesets []github.Ruleset
+	for _, r := range f.RepoRulesets[org+"/"+repo] {
+		r.Conditions, r.Rules, r.BypassActors = nil, nil, nil
+		rulesets = append(rulesets, r)
+	}
+	return rulesets, nil
+}
+
+// GetRepoRuleset returns a ruleset of the repo.
+func (f *FakeClient) GetRepoRuleset(org, repo string, id int) (*github.Ruleset, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for _, r := range f.RepoRulesets[org+"/"+repo] {
+		if r.ID == id {
+			return &r, nil
+		}
+	}
+	return nil, fmt.Errorf("ruleset %d not found in %s/%s", id, org, repo)
+}
+
+// CreateRepoRuleset creates a ruleset in the repo, whose name must be unique.
+func (f *FakeClient) CreateRepoRuleset(org, repo string, ruleset github.Ruleset) (*github.Ruleset, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.RepoRulesets == nil {
+		f.RepoRulesets = map[string][]github.Ruleset{}
+	}
+	orgRepo := org + "/" + repo
+	for _, r := range f.RepoRulesets[orgRepo] {
+		if r.Name == ruleset.Name {
+			return nil, fmt.Errorf("ruleset %s already exists in %s", ruleset.Name, orgRepo)
+		}
+	}
+	f.RulesetID++
+	ruleset.ID = f.RulesetID
+	f.RepoRulesets[orgRepo] = append(f.RepoRulesets[orgRepo], ruleset)
+	return &ruleset, nil
+}
+
+// UpdateRepoRuleset replaces a ruleset of the repo.
+func (f *FakeClient) UpdateRepoRuleset(org, repo string, id int, ruleset github.Ruleset) (*github.Ruleset, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	rulesets := f.RepoRulesets[org+"/"+repo]
+	for i := range rulesets {
+		if rulesets[i].ID == id {
+			ruleset.ID = id
+			rulesets[i] = ruleset
+			return &ruleset, nil
+		}
+	}
+	return nil, fmt.Errorf("ruleset %d not found in %s/%s", id, org, repo)
+}
+
+// DeleteRepoRuleset deletes a ruleset of the repo.
+func (f *FakeClient) DeleteRepoRuleset(org, repo string, id int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	orgRepo := org + "/" + repo
+	for i, r := range f.RepoRulesets[orgRepo] {
+		if r.ID == id {
+			f.RepoRulesets[orgRepo] = append(f.RepoRulesets[orgRepo][:i], f.RepoRulesets[orgRepo][i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("ruleset %d not found in %s/%s", id, org, repo)
+}
@@ -25,19 +25,74 @@ import (
 	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/yaml"
 )
 
+// HMACTokenState is the phase of a token in a rotation. Tokens are rotated
+// without downtime by adding the new token to the secret, accepting both the
+// old and the new token, switching the webhook to the new token and
+// accepting the old one for a grace period before it expires.
+type HMACTokenState string
+
+const (
+	// HMACTokenPending tokens are accepted, but the webhook doesn't use
+	// them yet.
+	HMACTokenPending HMACTokenState = "pending"
+	// HMACTokenActive tokens are used by the webhook. Tokens without a state
+	// predate rotation states and are active.
+	HMACTokenActive HMACTokenState = "active"
+	// HMACTokenRetiring tokens were replaced on the webhook, and are accepted
+	// until they expire for the deliveries signed before the switch.
+	HMACTokenRetiring HMACTokenState = "retiring"
+	// HMACTokenExpired tokens are past their grace period and not accepted
+	// anymore.
+	HMACTokenExpired HMACTokenState = "expired"
+)
+
 // HMACToken contains a hmac token and the time when it's created.
 type HMACToken struct {
 	Value     string    `json:"value"`
 	CreatedAt time.Time `json:"created_at"`
+	// State is the phase of the token in a rotation.
+	State HMACTokenState `json:"state,omitempty"`
+	// StateChangedAt is when the token entered its current state.
+	StateChangedAt *time.Time `json:"state_changed_at,omitempty"`
+	// ExpiresAt is when a retiring token stops being accepted.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// StateAt returns the phase of the token at the given time.
+func (t HMACToken) StateAt(now time.Time) HMACTokenState {
+	switch {
+	case t.State == "":
+		return HMACTokenActive
+	case t.State == HMACTokenRetiring && t.ExpiresAt != nil && !now.Before(*t.ExpiresAt):
+		return HMACTokenExpired
+	default:
+		return t.State
+	}
 }
 
 // HMACsForRepo contains all hmac tokens configured for a repo, org or globally.
 type HMACsForRepo []HMACToken
 
+// hmacValidations provides the 'hmac_validations_total' counter that counts
+// webhook deliveries by the rotation phase of the token they are signed with.
+// Deliveries signed with an expired token are rejected.
+var hmacValidations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "hmac_validations_total",
+		Help: "Number of webhook deliveries by the rotation phase of the HMAC token they are signed with.",
+	},
+	[]string{"state"},
+)
+
+func init() {
+	prometheus.MustRegister(hmacValidations)
+}
+
 // ValidatePayload ensures that the request payload signature matches the key.
 func ValidatePayload(payload []byte, sig string, tokenGenerator func() []byte) bool {
 	var event GenericEvent
@@ -67,11 +122,19 @@ func ValidatePayload(payload []byte, sig string, tokenGenerator func() []byte) b
 	}
 
 	// If we have a match with any valid hmac, we can validate successfully.
-	for _, key := range hmacs {
-		mac := hmac.New(sha1.New, key)
+	// Expired tokens are only checked to tell why a delivery is rejected.
+	now := time.Now()
+	for _, token := range hmacs {
+		mac := hmac.New(sha1.New, []byte(token.Value))
 		mac.Write(payload)
 		expected := mac.Sum(nil)
 		if hmac.Equal(sb, expected) {
+			state := token.StateAt(now)
+			hmacValidations.WithLabelValues(string(state)).Inc()
+			if state == HMACTokenExpired {
+				logrus.WithField("org-repo", orgRepo).Warning("Rejecting a webhook delivery signed with an expired hmac token.")
+				return false
+			}
 			return true
 		}
 	}
@@ -86,12 +149,29 @@ func PayloadSignature(payload []byte, key []byte) string {
 	return "sha1=" + hex.EncodeToString(sum)
 }
 
-// extractHMACs returns all *valid* HMAC tokens for given repository/organization.
+// ActiveHMACForRepo returns the first active token that the hmac secret
+// configures for the org/repo, or for the org of org-level webhooks. That is
+// the token the webhooks of the org/repo are signed with.
+func ActiveHMACForRepo(orgRepo string, tokenGenerator func() []byte) (string, error) {
+	hmacs, err := extractHMACs(orgRepo, tokenGenerator)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	for _, token := range hmacs {
+		if token.StateAt(now) == HMACTokenActive {
+			return token.Value, nil
+		}
+	}
+	return "", fmt.Errorf("no active hmac is configured for the org/repo %q", orgRepo)
+}
+
+// extractHMACs returns all HMAC tokens for given repository/organization.
 // It considers only the tokens at the most specific level configured for the given repo.
 // For example : if a token for repo is present and it doesn't match the repo, we will
 // not try to find a match with org level token. However if no token is present for repo,
 // we will try to match with org level.
-func extractHMACs(orgRepo string, tokenGenerator func() []byte) ([][]byte, error) {
+func extractHMACs(orgRepo string, tokenGenerator func() []byte) (HMACsForRepo, error) {
 	t := tokenGenerator()
 	repoToTokenMap := map[string]HMACsForRepo{}
 
@@ -101,28 +181,19 @@ func extractHMACs(orgRepo string, tokenGenerator func() []byte) ([][]byte, error
 		// TODO: Once this code has been released and file has been moved to new format,
 		// we should delete this code and return error.
 		logrus.WithError(err).Trace("Couldn't unmarshal the hmac secret as hierarchical file. Parsing as single token format")
-		return [][]byte{t}, nil
+		return HMACsForRepo{{Value: string(t)}}, nil
 	}
 
 	orgName := strings.Split(orgRepo, "/")[0]
 
 	if val, ok := repoToTokenMap[orgRepo]; ok {
-		return extractTokens(val), nil
+		return val, nil
 	}
 	if val, ok := repoToTokenMap[orgName]; ok {
-		return extractTokens(val), nil
+		return val, nil
 	}
 	if val, ok := repoToTokenMap["*"]; ok {
-		return extractTokens(val), nil
+		return val, nil
 	}
 	return nil, fmt.Errorf("no hmac is configured for the org/repo %q and no legacy global token is configured", orgRepo)
 }
-
-// extractTokens return tokens for any given level of tree.
-func extractTokens(allTokens HMACsForRepo) [][]byte {
-	validTokens := make([][]byte, len(allTokens))
-	for i := range allTokens {
-		validTokens[i] = []byte(allTokens[i].Value)
-	}
-	return validTokens
-}
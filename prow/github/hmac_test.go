@@ -18,6 +18,7 @@ package github
 
 import (
 	"testing"
+	"time"
 )
 
 var tokens = `
@@ -101,3 +102,74 @@ func TestValidatePayload(t *testing.T) {
 		}
 	}
 }
+
+func TestValidatePayloadDuringRotation(t *testing.T) {
+	payload := []byte(`{"repository": {"full_name": "org/repo"}}`)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	tokens := `
+'org/repo':
+  - value: old
+    created_at: 2020-10-02T15:00:00Z
+    state: retiring
+    expires_at: ` + future + `
+  - value: expired
+    created_at: 2019-10-02T15:00:00Z
+    state: retiring
+    expires_at: ` + past + `
+  - value: current
+    created_at: 2021-10-02T15:00:00Z
+    state: active
+  - value: new
+    created_at: 2021-11-02T15:00:00Z
+    state: pending
+`
+	tokenGenerator := func() []byte { return []byte(tokens) }
+	for key, valid := range map[string]bool{
+		"old":     true,
+		"expired": false,
+		"current": true,
+		"new":     true,
+		"unknown": false,
+	} {
+		if actual := ValidatePayload(payload, PayloadSignature(payload, []byte(key)), tokenGenerator); actual != valid {
+			t.Errorf("expected a delivery signed with the %s token to be valid %t, got %t", key, valid, actual)
+		}
+	}
+}
+
+func TestHMACTokenStateAt(t *testing.T) {
+	now := time.Date(2021, 10, 2, 15, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+	testCases := []struct {
+		name     string
+		token    HMACToken
+		expected HMACTokenState
+	}{
+		{
+			name:     "tokens without a state are active",
+			token:    HMACToken{Value: "abc"},
+			expected: HMACTokenActive,
+		},
+		{
+			name:     "pending",
+			token:    HMACToken{Value: "abc", State: HMACTokenPending},
+			expected: HMACTokenPending,
+		},
+		{
+			name:     "retiring before the expiry",
+			token:    HMACToken{Value: "abc", State: HMACTokenRetiring, ExpiresAt: &later},
+			expected: HMACTokenRetiring,
+		},
+		{
+			name:     "retiring at the expiry",
+			token:    HMACToken{Value: "abc", State: HMACTokenRetiring, ExpiresAt: &now},
+			expected: HMACTokenExpired,
+		},
+	}
+	for _, tc := range testCases {
+		if actual := tc.token.StateAt(now); actual != tc.expected {
+			t.Errorf("%s: expected state %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -349,6 +349,8 @@ type Repo struct {
 	HasProjects   bool   `json:"has_projects"`
 	HasWiki       bool   `json:"has_wiki"`
 	NodeID        string `json:"node_id"`
+	// Topics are only returned when the repo is fetched with GetRepo(s).
+	Topics []string `json:"topics,omitempty"`
 	// Permissions reflect the permission level for the requester, so
 	// on a repository GET call this will be for the user whose token
 	// is being used, if listing a team's repos this will be for the
@@ -623,6 +625,91 @@ type RestrictionsRequest struct {
 	Teams *[]string `json:"teams,omitempty"`
 }
 
+// Ruleset targets.
+const (
+	RulesetTargetBranch = "branch"
+	RulesetTargetTag    = "tag"
+)
+
+// Ruleset enforcements.
+const (
+	RulesetEnforcementActive   = "active"
+	RulesetEnforcementEvaluate = "evaluate"
+	RulesetEnforcementDisabled = "disabled"
+)
+
+// Ruleset bypass actor types and modes.
+const (
+	BypassActorTeam              = "Team"
+	BypassActorIntegration       = "Integration"
+	BypassActorOrganizationAdmin = "OrganizationAdmin"
+	BypassActorRepositoryRole    = "RepositoryRole"
+
+	BypassModeAlways      = "always"
+	BypassModePullRequest = "pull_request"
+)
+
+// Ruleset rule types.
+const (
+	RuleDeletion              = "deletion"
+	RuleNonFastForward        = "non_fast_forward"
+	RuleRequiredLinearHistory = "required_linear_history"
+	RuleRequiredSignatures    = "required_signatures"
+	RuleRequiredStatusChecks  = "required_status_checks"
+	RuleRequiredDeployments   = "required_deployments"
+)
+
+// Ruleset protects the branches or the tags of a repository.
+// See also: https://docs.github.com/en/rest/repos/rules
+type Ruleset struct {
+	ID           int                  `json:"id,omitempty"`
+	Name         string               `json:"name"`
+	Target       string               `json:"target,omitempty"`
+	Enforcement  string               `json:"enforcement"`
+	BypassActors []RulesetBypassActor `json:"bypass_actors,omitempty"`
+	Conditions   *RulesetConditions   `json:"conditions,omitempty"`
+	Rules        []RulesetRule        `json:"rules,omitempty"`
+}
+
+// RulesetBypassActor may bypass a ruleset.
+type RulesetBypassActor struct {
+	ActorID    int    `json:"actor_id"`
+	ActorType  string `json:"actor_type"`
+	BypassMode string `json:"bypass_mode"`
+}
+
+// RulesetConditions select the refs a ruleset applies to.
+type RulesetConditions struct {
+	RefName *RulesetRefNameCondition `json:"ref_name,omitempty"`
+}
+
+// RulesetRefNameCondition includes and excludes refs by patterns, such as
+// refs/heads/release-*, ~DEFAULT_BRANCH or ~ALL.
+type RulesetRefNameCondition struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// RulesetRule is a rule of a ruleset. Only some rule types take parameters.
+type RulesetRule struct {
+	Type       string                 `json:"type"`
+	Parameters *RulesetRuleParameters `json:"parameters,omitempty"`
+}
+
+// RulesetRuleParameters holds the parameters of the required_status_checks
+// and required_deployments rules.
+type RulesetRuleParameters struct {
+	RequiredStatusChecks             []RulesetStatusCheck `json:"required_status_checks,omitempty"`
+	StrictRequiredStatusChecksPolicy *bool                `json:"strict_required_status_checks_policy,omitempty"`
+	RequiredDeploymentEnvironments   []string             `json:"required_deployment_environments,omitempty"`
+}
+
+// RulesetStatusCheck is a context that must be green to merge.
+type RulesetStatusCheck struct {
+	Context       string `json:"context"`
+	IntegrationID *int   `json:"integration_id,omitempty"`
+}
+
 // HookConfig holds the endpoint and its secret.
 type HookConfig struct {
 	URL         string  `json:"url"`
@@ -1099,6 +1186,13 @@ type UserRepoInvitation struct {
 	Permission   RepoPermissionLevel `json:"permissions"`
 }
 
+// RepoInvitation is a pending invitation to collaborate on a repo.
+type RepoInvitation struct {
+	InvitationID int                 `json:"id"`
+	Invitee      *User               `json:"invitee,omitempty"`
+	Permission   RepoPermissionLevel `json:"permissions"`
+}
+
 // OrgPermissionLevel is admin, and member
 //
 // See https://docs.github.com/en/rest/reference/orgs#set-organization-membership-for-a-user
@@ -0,0 +1,918 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/version"
+)
+
+const (
+	methodField = "method"
+
+	perPage = 100
+
+	// noteCacheSize and noteCacheTTL bound the cache of the merge requests
+	// that notes belong to.
+	noteCacheSize = 10000
+	noteCacheTTL  = 24 * time.Hour
+)
+
+// Client is a GitLab client. It implements the subset of github.Client used
+// by the trigger, lgtm, approve, hold and label plugins: groups stand in for
+// organizations, subgroups for teams and merge requests, identified by their
+// IID, for pull requests.
+type Client interface {
+	// BotUserChecker can be used to check if a note was authored by the bot user.
+	BotUserChecker() (func(candidate string) bool, error)
+	// IsMember returns whether the user is a member of the group or of one of
+	// its ancestors.
+	IsMember(org, user string) (bool, error)
+	// IsCollaborator returns whether the user has at least the developer role
+	// in the project.
+	IsCollaborator(org, repo, user string) (bool, error)
+	// ListCollaborators lists the members of the project.
+	ListCollaborators(org, repo string) ([]github.User, error)
+	// ListTeams lists the subgroups of the group.
+	ListTeams(org string) ([]github.Team, error)
+	// ListTeamMembers lists the members of the subgroup with the given ID.
+	// Maintainers are the members with at least the maintainer role.
+	ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error)
+	// TeamBySlugHasMember returns whether the user is a member of the subgroup.
+	TeamBySlugHasMember(org string, teamSlug string, memberLogin string) (bool, error)
+
+	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
+	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
+	// ListReviews returns an approved review for each approval of the merge request.
+	ListReviews(org, repo string, number int) ([]github.Review, error)
+	// ListPullRequestComments lists the notes on the diff of the merge request.
+	ListPullRequestComments(org, repo string, number int) ([]github.ReviewComment, error)
+	AssignIssue(org, repo string, number int, logins []string) error
+
+	CreateComment(org, repo string, number int, comment string) error
+	// ListIssueComments lists the notes of the merge request that are neither
+	// system notes nor notes on the diff.
+	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
+	// DeleteComment deletes a note. The note must have been created or listed
+	// by the client, since GitLab needs the merge request to delete a note.
+	DeleteComment(org, repo string, id int) error
+	DeleteStaleComments(org, repo string, number int, comments []github.IssueComment, isStale func(github.IssueComment) bool) error
+
+	GetRepoLabels(org, repo string) ([]github.Label, error)
+	GetIssueLabels(org, repo string, number int) ([]github.Label, error)
+	AddLabel(org, repo string, number int, label string) error
+	RemoveLabel(org, repo string, number int, label string) error
+	WasLabelAddedByHuman(org, repo string, number int, label string) (bool, error)
+
+	// GetRef returns the SHA of a ref like heads/master or tags/v1.0.0.
+	GetRef(org, repo, ref string) (string, error)
+	GetSingleCommit(org, repo, sha string) (github.RepositoryCommit, error)
+	// CreateStatus sets the status of a job on a commit. Failures and errors
+	// are both reported as failed.
+	CreateStatus(org, repo, sha string, status github.Status) error
+	GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error)
+
+	// ForPlugin and WithFields allow for the logger used in the client
+	// to be created in a more specific manner when spawning parallel workers
+	ForPlugin(plugin string) Client
+	WithFields(fields logrus.Fields) Client
+}
+
+// NewClient returns a GitLab client for the instance at endpoint, like
+// https://gitlab.example.com.
+func NewClient(getToken func() []byte, endpoint string) Client {
+	return &client{
+		logger: logrus.WithField("client", "gitlab"),
+		delegate: &delegate{
+			client:   &http.Client{},
+			endpoint: strings.TrimSuffix(endpoint, "/"),
+			getToken: getToken,
+			noteMRs:  cache.NewLRUExpireCache(noteCacheSize),
+		},
+	}
+}
+
+// client interacts with the GitLab API
+type client struct {
+	// If logger is non-nil, log all method calls with it.
+	logger *logrus.Entry
+	// identifier is used to add more identification to the user-agent header
+	identifier string
+	*delegate
+}
+
+// delegate actually does the work to talk to GitLab
+type delegate struct {
+	client   *http.Client
+	endpoint string
+	getToken func() []byte
+
+	lock    sync.Mutex
+	botUser *User
+	// noteMRs maps the IDs of the notes the client saw to the IIDs of their
+	// merge requests.
+	noteMRs *cache.LRUExpireCache
+}
+
+// the client is a Client impl
+var _ Client = &client{}
+
+// ForPlugin clones the client, keeping the underlying delegate the same but adding
+// a plugin identifier and log field
+func (c *client) ForPlugin(plugin string) Client {
+	return &client{
+		identifier: plugin,
+		logger:     c.logger.WithField("plugin", plugin),
+		delegate:   c.delegate,
+	}
+}
+
+// WithFields clones the client, keeping the underlying delegate the same but adding
+// fields to the logging context
+func (c *client) WithFields(fields logrus.Fields) Client {
+	return &client{
+		identifier: c.identifier,
+		logger:     c.logger.WithFields(fields),
+		delegate:   c.delegate,
+	}
+}
+
+func (c *client) userAgent() string {
+	if c.identifier != "" {
+		return version.UserAgentWithIdentifier(c.identifier)
+	}
+	return version.UserAgent()
+}
+
+func (c *client) log(method string, fields logrus.Fields) *logrus.Entry {
+	return c.logger.WithFields(fields).WithField(methodField, method)
+}
+
+// projectID returns the URL-encoded path of the project, which the API
+// accepts in place of its numeric ID.
+func projectID(org, repo string) string {
+	return url.PathEscape(org + "/" + repo)
+}
+
+func groupID(org string) string {
+	return url.PathEscape(org)
+}
+
+func mergeRequestPath(org, repo string, number int) string {
+	return fmt.Sprintf("/projects/%s/merge_requests/%d", projectID(org, repo), number)
+}
+
+// request sends a request to the API at path and returns the response body and headers.
+func (c *client) request(method, path string, query url.Values, body interface{}, logger *logrus.Entry) ([]byte, http.Header, error) {
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not marshal request body: %w", err)
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+	u := c.endpoint + "/api/v4" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.getToken(); len(token) > 0 {
+		req.Header.Set("PRIVATE-TOKEN", string(token))
+	}
+	if userAgent := c.userAgent(); userAgent != "" {
+		req.Header.Add("User-Agent", userAgent)
+	}
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	promLabels := prometheus.Labels{methodField: logger.Data[methodField].(string), "status": ""}
+	if resp != nil {
+		promLabels["status"] = strconv.Itoa(resp.StatusCode)
+		logger.WithField("response", resp.StatusCode).Debug("Got response from GitLab.")
+	}
+	requestDurations.With(promLabels).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, nil, &requestError{statusCode: -1, message: err.Error()}
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.WithError(err).Warn("could not close response body")
+		}
+	}()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message := fmt.Sprintf("response code %d", resp.StatusCode)
+		var apiError struct {
+			Message json.RawMessage `json:"message"`
+			Error   string          `json:"error"`
+		}
+		if err := json.Unmarshal(raw, &apiError); err == nil {
+			if len(apiError.Message) > 0 {
+				message += ": " + string(apiError.Message)
+			} else if apiError.Error != "" {
+				message += ": " + apiError.Error
+			}
+		}
+		return nil, nil, &requestError{statusCode: resp.StatusCode, message: message}
+	}
+	return raw, resp.Header, nil
+}
+
+// do sends a request and unmarshals the response into target, unless it is nil.
+func (c *client) do(method, path string, query url.Values, body, target interface{}, logger *logrus.Entry) error {
+	raw, _, err := c.request(method, path, query, body, logger)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("could not unmarshal response body: %w", err)
+	}
+	return nil
+}
+
+// readPaginatedResults reads all the pages of the list at path. newObj
+// returns a pointer to a new slice of the listed type, and accumulate is
+// called with each populated slice.
+func (c *client) readPaginatedResults(path string, query url.Values, logger *logrus.Entry, newObj func() interface{}, accumulate func(interface{})) error {
+	values := url.Values{}
+	for key, value := range query {
+		values[key] = value
+	}
+	values.Set("per_page", strconv.Itoa(perPage))
+	for page := "1"; page != ""; {
+		values.Set("page", page)
+		raw, header, err := c.request(http.MethodGet, path, values, nil, logger)
+		if err != nil {
+			return err
+		}
+		obj := newObj()
+		if err := json.Unmarshal(raw, obj); err != nil {
+			return fmt.Errorf("could not unmarshal response body: %w", err)
+		}
+		accumulate(obj)
+		page = header.Get("X-Next-Page")
+	}
+	return nil
+}
+
+type requestError struct {
+	statusCode int
+	message    string
+}
+
+func (e requestError) Error() string {
+	return e.message
+}
+
+// IsNotFound returns whether the error is a 404 from the API.
+func IsNotFound(err error) bool {
+	reqError, ok := err.(*requestError)
+	if !ok {
+		return false
+	}
+	return reqError.statusCode == http.StatusNotFound
+}
+
+func (c *client) BotUserChecker() (func(candidate string) bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.botUser == nil {
+		var user User
+		if err := c.do(http.MethodGet, "/user", nil, nil, &user, c.log("BotUserChecker", nil)); err != nil {
+			return nil, fmt.Errorf("fetching the current user from GitLab: %w", err)
+		}
+		c.botUser = &user
+	}
+	botUser := c.botUser.Username
+	return func(candidate string) bool {
+		return candidate == botUser
+	}, nil
+}
+
+// userID returns the ID of the user with the given username.
+func (c *client) userID(username string, logger *logrus.Entry) (int, error) {
+	var users []User
+	if err := c.do(http.MethodGet, "/users", url.Values{"username": []string{username}}, nil, &users, logger); err != nil {
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, &requestError{statusCode: http.StatusNotFound, message: fmt.Sprintf("user %q not found", username)}
+	}
+	return users[0].ID, nil
+}
+
+// member returns the membership of the user in the group or project at
+// path, including inherited memberships.
+func (c *client) member(path, username string, logger *logrus.Entry) (*Member, error) {
+	id, err := c.userID(username, logger)
+	if err != nil {
+		return nil, err
+	}
+	var member Member
+	if err := c.do(http.MethodGet, fmt.Sprintf("%s/members/all/%d", path, id), nil, nil, &member, logger); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (c *client) IsMember(org, user string) (bool, error) {
+	logger := c.log("IsMember", logrus.Fields{"org": org, "user": user})
+	if _, err := c.member("/groups/"+groupID(org), user, logger); err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *client) IsCollaborator(org, repo, user string) (bool, error) {
+	logger := c.log("IsCollaborator", logrus.Fields{"org": org, "repo": repo, "user": user})
+	member, err := c.member("/projects/"+projectID(org, repo), user, logger)
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return member.AccessLevel >= DeveloperAccess, nil
+}
+
+func (c *client) listMembers(path string, logger *logrus.Entry) ([]Member, error) {
+	var members []Member
+	err := c.readPaginatedResults(path+"/members/all", nil, logger,
+		func() interface{} {
+			return &[]Member{}
+		},
+		func(obj interface{}) {
+			members = append(members, *(obj.(*[]Member))...)
+		},
+	)
+	return members, err
+}
+
+func (c *client) ListCollaborators(org, repo string) ([]github.User, error) {
+	logger := c.log("ListCollaborators", logrus.Fields{"org": org, "repo": repo})
+	members, err := c.listMembers("/projects/"+projectID(org, repo), logger)
+	if err != nil {
+		return nil, err
+	}
+	var users []github.User
+	for _, member := range members {
+		user := toGitHubUser(member.User)
+		user.Permissions = github.RepoPermissions{
+			Pull:     true,
+			Push:     member.AccessLevel >= DeveloperAccess,
+			Maintain: member.AccessLevel >= MaintainerAccess,
+			Admin:    member.AccessLevel >= MaintainerAccess,
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (c *client) ListTeams(org string) ([]github.Team, error) {
+	logger := c.log("ListTeams", logrus.Fields{"org": org})
+	var teams []github.Team
+	err := c.readPaginatedResults("/groups/"+groupID(org)+"/subgroups", nil, logger,
+		func() interface{} {
+			return &[]Group{}
+		},
+		func(obj interface{}) {
+			for _, group := range *(obj.(*[]Group)) {
+				teams = append(teams, github.Team{ID: group.ID, Name: group.Name, Slug: group.Path, Description: group.Description})
+			}
+		},
+	)
+	return teams, err
+}
+
+func (c *client) ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error) {
+	logger := c.log("ListTeamMembers", logrus.Fields{"org": org, "id": id, "role": role})
+	members, err := c.listMembers(fmt.Sprintf("/groups/%d", id), logger)
+	if err != nil {
+		return nil, err
+	}
+	var teamMembers []github.TeamMember
+	for _, member := range members {
+		maintainer := member.AccessLevel >= MaintainerAccess
+		if (role == github.RoleMaintainer && !maintainer) || (role == github.RoleMember && maintainer) {
+			continue
+		}
+		teamMembers = append(teamMembers, github.TeamMember{Login: member.Username})
+	}
+	return teamMembers, nil
+}
+
+func (c *client) TeamBySlugHasMember(org string, teamSlug string, memberLogin string) (bool, error) {
+	logger := c.log("TeamBySlugHasMember", logrus.Fields{"org": org, "team": teamSlug, "user": memberLogin})
+	if _, err := c.member("/groups/"+groupID(org+"/"+teamSlug), memberLogin, logger); err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func toGitHubUser(user User) github.User {
+	return github.User{Login: user.Username, Name: user.Name, ID: user.ID, HTMLURL: user.WebURL}
+}
+
+func toGitHubUsers(users []User) []github.User {
+	var converted []github.User
+	for _, user := range users {
+		converted = append(converted, toGitHubUser(user))
+	}
+	return converted
+}
+
+// toPullRequest converts a merge request to a pull request. The source
+// project of merge requests from forks is not resolved.
+func toPullRequest(org, repo string, mr MergeRequest) *github.PullRequest {
+	ghRepo := github.Repo{
+		Owner:    github.User{Login: org},
+		Name:     repo,
+		FullName: org + "/" + repo,
+	}
+	pr := &github.PullRequest{
+		ID:                 mr.ID,
+		Number:             mr.IID,
+		HTMLURL:            mr.WebURL,
+		User:               toGitHubUser(mr.Author),
+		Base:               github.PullRequestBranch{Ref: mr.TargetBranch, SHA: mr.DiffRefs.BaseSHA, Repo: ghRepo},
+		Head:               github.PullRequestBranch{Ref: mr.SourceBranch, SHA: mr.SHA, Repo: ghRepo},
+		Title:              mr.Title,
+		Body:               mr.Description,
+		RequestedReviewers: toGitHubUsers(mr.Reviewers),
+		Assignees:          toGitHubUsers(mr.Assignees),
+		Draft:              mr.Draft || mr.WorkInProgress,
+		MergeSHA:           mr.MergeCommitSHA,
+		CreatedAt:          mr.CreatedAt,
+		UpdatedAt:          mr.UpdatedAt,
+	}
+	for _, label := range mr.Labels {
+		pr.Labels = append(pr.Labels, github.Label{Name: label})
+	}
+	switch mr.State {
+	case "opened":
+		pr.State = github.PullRequestStateOpen
+	case "merged":
+		pr.State = github.PullRequestStateClosed
+		pr.Merged = true
+	default:
+		pr.State = github.PullRequestStateClosed
+	}
+	switch mr.MergeStatus {
+	case "can_be_merged":
+		mergeable := true
+		pr.Mergable = &mergeable
+	case "cannot_be_merged":
+		mergeable := false
+		pr.Mergable = &mergeable
+	}
+	return pr
+}
+
+func (c *client) getMergeRequest(org, repo string, number int, logger *logrus.Entry) (*MergeRequest, error) {
+	var mr MergeRequest
+	if err := c.do(http.MethodGet, mergeRequestPath(org, repo, number), nil, nil, &mr, logger); err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+func (c *client) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	logger := c.log("GetPullRequest", logrus.Fields{"org": org, "repo": repo, "number": number})
+	mr, err := c.getMergeRequest(org, repo, number, logger)
+	if err != nil {
+		return nil, err
+	}
+	return toPullRequest(org, repo, *mr), nil
+}
+
+// countDiffLines returns the number of lines a unified diff adds and deletes.
+func countDiffLines(diff string) (additions, deletions int) {
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			additions++
+		case strings.HasPrefix(line, "-"):
+			deletions++
+		}
+	}
+	return additions, deletions
+}
+
+func (c *client) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
+	logger := c.log("GetPullRequestChanges", logrus.Fields{"org": org, "repo": repo, "number": number})
+	var mr MergeRequestChanges
+	if err := c.do(http.MethodGet, mergeRequestPath(org, repo, number)+"/changes", nil, nil, &mr, logger); err != nil {
+		return nil, err
+	}
+	var changes []github.PullRequestChange
+	for _, change := range mr.Changes {
+		converted := github.PullRequestChange{
+			SHA:      mr.SHA,
+			Filename: change.NewPath,
+			Status:   string(github.PullRequestFileModified),
+			Patch:    change.Diff,
+		}
+		switch {
+		case change.NewFile:
+			converted.Status = github.PullRequestFileAdded
+		case change.DeletedFile:
+			converted.Status = github.PullRequestFileRemoved
+		case change.RenamedFile:
+			converted.Status = github.PullRequestFileRenamed
+			converted.PreviousFilename = change.OldPath
+		}
+		converted.Additions, converted.Deletions = countDiffLines(change.Diff)
+		converted.Changes = converted.Additions + converted.Deletions
+		changes = append(changes, converted)
+	}
+	return changes, nil
+}
+
+func (c *client) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	logger := c.log("ListReviews", logrus.Fields{"org": org, "repo": repo, "number": number})
+	var approvals Approvals
+	if err := c.do(http.MethodGet, mergeRequestPath(org, repo, number)+"/approvals", nil, nil, &approvals, logger); err != nil {
+		return nil, err
+	}
+	var reviews []github.Review
+	for _, approval := range approvals.ApprovedBy {
+		reviews = append(reviews, github.Review{User: toGitHubUser(approval.User), State: github.ReviewStateApproved})
+	}
+	return reviews, nil
+}
+
+// listNotes lists the notes of the merge request, oldest first, and remembers
+// which merge request they belong to.
+func (c *client) listNotes(org, repo string, number int, logger *logrus.Entry) ([]Note, error) {
+	var notes []Note
+	query := url.Values{"sort": []string{"asc"}, "order_by": []string{"created_at"}}
+	err := c.readPaginatedResults(mergeRequestPath(org, repo, number)+"/notes", query, logger,
+		func() interface{} {
+			return &[]Note{}
+		},
+		func(obj interface{}) {
+			notes = append(notes, *(obj.(*[]Note))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		c.noteMRs.Add(note.ID, number, noteCacheTTL)
+	}
+	return notes, nil
+}
+
+func (c *client) ListPullRequestComments(org, repo string, number int) ([]github.ReviewComment, error) {
+	logger := c.log("ListPullRequestComments", logrus.Fields{"org": org, "repo": repo, "number": number})
+	notes, err := c.listNotes(org, repo, number, logger)
+	if err != nil {
+		return nil, err
+	}
+	var comments []github.ReviewComment
+	for _, note := range notes {
+		if note.System || note.Type != DiffNoteType {
+			continue
+		}
+		comment := github.ReviewComment{
+			ID:        note.ID,
+			User:      toGitHubUser(note.Author),
+			Body:      note.Body,
+			CreatedAt: note.CreatedAt,
+			UpdatedAt: note.UpdatedAt,
+		}
+		if note.Position != nil {
+			comment.Path = note.Position.NewPath
+			if note.Position.NewLine != nil {
+				comment.Line = *note.Position.NewLine
+			}
+		}
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+func (c *client) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
+	logger := c.log("ListIssueComments", logrus.Fields{"org": org, "repo": repo, "number": number})
+	notes, err := c.listNotes(org, repo, number, logger)
+	if err != nil {
+		return nil, err
+	}
+	var comments []github.IssueComment
+	for _, note := range notes {
+		if note.System || note.Type == DiffNoteType {
+			continue
+		}
+		comments = append(comments, github.IssueComment{
+			ID:        note.ID,
+			Body:      note.Body,
+			User:      toGitHubUser(note.Author),
+			CreatedAt: note.CreatedAt,
+			UpdatedAt: note.UpdatedAt,
+		})
+	}
+	return comments, nil
+}
+
+func (c *client) CreateComment(org, repo string, number int, comment string) error {
+	logger := c.log("CreateComment", logrus.Fields{"org": org, "repo": repo, "number": number})
+	var note Note
+	if err := c.do(http.MethodPost, mergeRequestPath(org, repo, number)+"/notes", nil, map[string]string{"body": comment}, &note, logger); err != nil {
+		return err
+	}
+	c.noteMRs.Add(note.ID, number, noteCacheTTL)
+	return nil
+}
+
+func (c *client) DeleteComment(org, repo string, id int) error {
+	logger := c.log("DeleteComment", logrus.Fields{"org": org, "repo": repo, "id": id})
+	number, ok := c.noteMRs.Get(id)
+	if !ok {
+		return fmt.Errorf("cannot delete note %d: its merge request is unknown", id)
+	}
+	if err := c.do(http.MethodDelete, fmt.Sprintf("%s/notes/%d", mergeRequestPath(org, repo, number.(int)), id), nil, nil, nil, logger); err != nil {
+		return err
+	}
+	c.noteMRs.Remove(id)
+	return nil
+}
+
+func (c *client) DeleteStaleComments(org, repo string, number int, comments []github.IssueComment, isStale func(github.IssueComment) bool) error {
+	var err error
+	if comments == nil {
+		comments, err = c.ListIssueComments(org, repo, number)
+		if err != nil {
+			return fmt.Errorf("failed to list comments while deleting stale comments. err: %w", err)
+		}
+	}
+	for _, comment := range comments {
+		if isStale(comment) {
+			if err := c.DeleteComment(org, repo, comment.ID); err != nil {
+				return fmt.Errorf("failed to delete stale comment with ID '%d': %w", comment.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *client) AssignIssue(org, repo string, number int, logins []string) error {
+	logger := c.log("AssignIssue", logrus.Fields{"org": org, "repo": repo, "number": number, "logins": logins})
+	mr, err := c.getMergeRequest(org, repo, number, logger)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for _, assignee := range mr.Assignees {
+		ids = append(ids, assignee.ID)
+	}
+	var missing []string
+	for _, login := range logins {
+		id, err := c.userID(login, logger)
+		if err != nil {
+			if IsNotFound(err) {
+				missing = append(missing, login)
+				continue
+			}
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := c.do(http.MethodPut, mergeRequestPath(org, repo, number), nil, map[string][]int{"assignee_ids": ids}, nil, logger); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return github.MissingUsers{Users: missing}
+	}
+	return nil
+}
+
+func (c *client) GetRepoLabels(org, repo string) ([]github.Label, error) {
+	logger := c.log("GetRepoLabels", logrus.Fields{"org": org, "repo": repo})
+	var labels []github.Label
+	err := c.readPaginatedResults("/projects/"+projectID(org, repo)+"/labels", nil, logger,
+		func() interface{} {
+			return &[]Label{}
+		},
+		func(obj interface{}) {
+			for _, label := range *(obj.(*[]Label)) {
+				labels = append(labels, github.Label{Name: label.Name, Color: strings.TrimPrefix(label.Color, "#"), Description: label.Description})
+			}
+		},
+	)
+	return labels, err
+}
+
+func (c *client) GetIssueLabels(org, repo string, number int) ([]github.Label, error) {
+	logger := c.log("GetIssueLabels", logrus.Fields{"org": org, "repo": repo, "number": number})
+	mr, err := c.getMergeRequest(org, repo, number, logger)
+	if err != nil {
+		return nil, err
+	}
+	var labels []github.Label
+	for _, label := range mr.Labels {
+		labels = append(labels, github.Label{Name: label})
+	}
+	return labels, nil
+}
+
+func (c *client) AddLabel(org, repo string, number int, label string) error {
+	logger := c.log("AddLabel", logrus.Fields{"org": org, "repo": repo, "number": number, "label": label})
+	return c.do(http.MethodPut, mergeRequestPath(org, repo, number), nil, map[string]string{"add_labels": label}, nil, logger)
+}
+
+func (c *client) RemoveLabel(org, repo string, number int, label string) error {
+	logger := c.log("RemoveLabel", logrus.Fields{"org": org, "repo": repo, "number": number, "label": label})
+	return c.do(http.MethodPut, mergeRequestPath(org, repo, number), nil, map[string]string{"remove_labels": label}, nil, logger)
+}
+
+func (c *client) WasLabelAddedByHuman(org, repo string, number int, label string) (bool, error) {
+	logger := c.log("WasLabelAddedByHuman", logrus.Fields{"org": org, "repo": repo, "number": number, "label": label})
+	isBot, err := c.BotUserChecker()
+	if err != nil {
+		return false, fmt.Errorf("failed to construct bot user checker: %w", err)
+	}
+	var lastAdded *LabelEvent
+	err = c.readPaginatedResults(mergeRequestPath(org, repo, number)+"/resource_label_events", nil, logger,
+		func() interface{} {
+			return &[]LabelEvent{}
+		},
+		func(obj interface{}) {
+			for _, event := range *(obj.(*[]LabelEvent)) {
+				if event.Action != "add" || event.Label == nil || event.Label.Name != label {
+					continue
+				}
+				event := event
+				lastAdded = &event
+			}
+		},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to list label events: %w", err)
+	}
+	if lastAdded == nil || lastAdded.User.Username == "" || isBot(lastAdded.User.Username) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c *client) GetRef(org, repo, ref string) (string, error) {
+	logger := c.log("GetRef", logrus.Fields{"org": org, "repo": repo, "ref": ref})
+	var kind string
+	switch {
+	case strings.HasPrefix(ref, "heads/"):
+		kind, ref = "branches", strings.TrimPrefix(ref, "heads/")
+	case strings.HasPrefix(ref, "tags/"):
+		kind, ref = "tags", strings.TrimPrefix(ref, "tags/")
+	default:
+		return "", fmt.Errorf("unsupported ref %q, expected heads/<branch> or tags/<tag>", ref)
+	}
+	var branch Branch
+	if err := c.do(http.MethodGet, fmt.Sprintf("/projects/%s/repository/%s/%s", projectID(org, repo), kind, url.PathEscape(ref)), nil, nil, &branch, logger); err != nil {
+		return "", err
+	}
+	return branch.Commit.ID, nil
+}
+
+func (c *client) GetSingleCommit(org, repo, sha string) (github.RepositoryCommit, error) {
+	logger := c.log("GetSingleCommit", logrus.Fields{"org": org, "repo": repo, "sha": sha})
+	var commit Commit
+	if err := c.do(http.MethodGet, fmt.Sprintf("/projects/%s/repository/commits/%s", projectID(org, repo), url.PathEscape(sha)), nil, nil, &commit, logger); err != nil {
+		return github.RepositoryCommit{}, err
+	}
+	converted := github.RepositoryCommit{
+		SHA: commit.ID,
+		Commit: github.GitCommit{
+			SHA:       commit.ID,
+			Author:    github.CommitAuthor{Name: commit.AuthorName, Email: commit.AuthorEmail, Date: commit.AuthoredDate},
+			Committer: github.CommitAuthor{Name: commit.CommitterName, Email: commit.CommitterEmail, Date: commit.CommittedDate},
+			Message:   commit.Message,
+		},
+		HTMLURL: commit.WebURL,
+	}
+	for _, parent := range commit.ParentIDs {
+		converted.Parents = append(converted.Parents, github.GitCommit{SHA: parent})
+	}
+	return converted, nil
+}
+
+// toStatus converts a GitHub status state to a GitLab commit status state.
+func toStatus(state string) string {
+	switch state {
+	case github.StatusSuccess:
+		return StatusSuccess
+	case github.StatusFailure, github.StatusError:
+		return StatusFailed
+	default:
+		return StatusPending
+	}
+}
+
+// fromStatus converts a GitLab commit status state to a GitHub status state.
+func fromStatus(state string) string {
+	switch state {
+	case StatusSuccess:
+		return github.StatusSuccess
+	case StatusFailed, StatusCanceled:
+		return github.StatusFailure
+	default:
+		return github.StatusPending
+	}
+}
+
+func (c *client) CreateStatus(org, repo, sha string, status github.Status) error {
+	logger := c.log("CreateStatus", logrus.Fields{"org": org, "repo": repo, "sha": sha, "context": status.Context, "state": status.State})
+	body := map[string]string{
+		"state":       toStatus(status.State),
+		"name":        status.Context,
+		"target_url":  status.TargetURL,
+		"description": status.Description,
+	}
+	err := c.do(http.MethodPost, fmt.Sprintf("/projects/%s/statuses/%s", projectID(org, repo), url.PathEscape(sha)), nil, body, nil, logger)
+	// GitLab refuses to set a status to its current state.
+	if reqError, ok := err.(*requestError); ok && reqError.statusCode == http.StatusBadRequest && strings.Contains(reqError.message, "Cannot transition status") {
+		return nil
+	}
+	return err
+}
+
+func (c *client) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error) {
+	logger := c.log("GetCombinedStatus", logrus.Fields{"org": org, "repo": repo, "ref": ref})
+	combined := &github.CombinedStatus{SHA: ref, State: github.StatusSuccess}
+	err := c.readPaginatedResults(fmt.Sprintf("/projects/%s/repository/commits/%s/statuses", projectID(org, repo), url.PathEscape(ref)), nil, logger,
+		func() interface{} {
+			return &[]CommitStatus{}
+		},
+		func(obj interface{}) {
+			for _, status := range *(obj.(*[]CommitStatus)) {
+				combined.Statuses = append(combined.Statuses, github.Status{
+					State:       fromStatus(status.Status),
+					TargetURL:   status.TargetURL,
+					Description: status.Description,
+					Context:     status.Name,
+				})
+			}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range combined.Statuses {
+		if status.State == github.StatusFailure {
+			combined.State = github.StatusFailure
+			break
+		}
+		if status.State == github.StatusPending {
+			combined.State = github.StatusPending
+		}
+	}
+	return combined, nil
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// fakeAPI serves canned responses keyed by method and escaped path, and
+// records the bodies of the requests it receives.
+type fakeAPI struct {
+	t         *testing.T
+	responses map[string]func(w http.ResponseWriter, r *http.Request)
+	bodies    map[string]string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("PRIVATE-TOKEN") != "token" {
+		http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	key := r.Method + " " + r.URL.EscapedPath()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.t.Fatalf("failed to read request body: %v", err)
+	}
+	f.bodies[key] = string(body)
+	respond, ok := f.responses[key]
+	if !ok {
+		http.Error(w, `{"message":"404 Not Found"}`, http.StatusNotFound)
+		return
+	}
+	respond(w, r)
+}
+
+func respondJSON(v interface{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func newTestClient(t *testing.T, responses map[string]func(w http.ResponseWriter, r *http.Request)) (Client, *fakeAPI, func()) {
+	api := &fakeAPI{t: t, responses: responses, bodies: map[string]string{}}
+	server := httptest.NewServer(api)
+	return NewClient(func() []byte { return []byte("token") }, server.URL), api, server.Close
+}
+
+func TestGetPullRequest(t *testing.T) {
+	mergeSHA := "merge"
+	client, _, stop := newTestClient(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v4/projects/group%2Frepo/merge_requests/5": respondJSON(MergeRequest{
+			ID:             100,
+			IID:            5,
+			Title:          "title",
+			Description:    "body",
+			State:          "merged",
+			SourceBranch:   "feature",
+			TargetBranch:   "main",
+			SHA:            "head",
+			MergeCommitSHA: &mergeSHA,
+			MergeStatus:    "can_be_merged",
+			Author:         User{ID: 1, Username: "author"},
+			Labels:         []string{"lgtm"},
+			WebURL:         "https://gitlab.example.com/group/repo/-/merge_requests/5",
+			DiffRefs:       DiffRefs{BaseSHA: "base"},
+		}),
+	})
+	defer stop()
+
+	pr, err := client.GetPullRequest("group", "repo", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repo := github.Repo{Owner: github.User{Login: "group"}, Name: "repo", FullName: "group/repo"}
+	mergeable := true
+	expected := &github.PullRequest{
+		ID:       100,
+		Number:   5,
+		HTMLURL:  "https://gitlab.example.com/group/repo/-/merge_requests/5",
+		User:     github.User{Login: "author", ID: 1},
+		Labels:   []github.Label{{Name: "lgtm"}},
+		Base:     github.PullRequestBranch{Ref: "main", SHA: "base", Repo: repo},
+		Head:     github.PullRequestBranch{Ref: "feature", SHA: "head", Repo: repo},
+		Title:    "title",
+		Body:     "body",
+		State:    github.PullRequestStateClosed,
+		Merged:   true,
+		MergeSHA: &mergeSHA,
+		Mergable: &mergeable,
+	}
+	if diff := cmp.Diff(expected, pr); diff != "" {
+		t.Errorf("unexpected pull request (-want +got):\n%s", diff)
+	}
+
+	if _, err := client.GetPullRequest("group", "repo", 6); !IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestCommentsAreListedAcrossPagesAndDeleted(t *testing.T) {
+	client, api, stop := newTestClient(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v4/projects/org%2Frepo/merge_requests/3/notes": func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("page") {
+			case "1":
+				w.Header().Set("X-Next-Page", "2")
+				respondJSON([]Note{
+					{ID: 10, Body: "/lgtm", Author: User{Username: "alice"}},
+					{ID: 11, Body: "added 1 commit", System: true},
+				})(w, r)
+			case "2":
+				respondJSON([]Note{
+					{ID: 12, Body: "nit", Type: DiffNoteType, Author: User{Username: "bob"}, Position: &Position{NewPath: "main.go"}},
+					{ID: 13, Body: "/hold", Author: User{Username: "bob"}},
+				})(w, r)
+			default:
+				t.Errorf("unexpected page %q", r.URL.Query().Get("page"))
+			}
+		},
+		"DELETE /api/v4/projects/org%2Frepo/merge_requests/3/notes/13": respondJSON(nil),
+	})
+	defer stop()
+
+	comments, err := client.ListIssueComments("org", "repo", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []github.IssueComment{
+		{ID: 10, Body: "/lgtm", User: github.User{Login: "alice"}},
+		{ID: 13, Body: "/hold", User: github.User{Login: "bob"}},
+	}
+	if diff := cmp.Diff(expected, comments); diff != "" {
+		t.Errorf("unexpected comments (-want +got):\n%s", diff)
+	}
+
+	reviewComments, err := client.ListPullRequestComments("org", "repo", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reviewComments) != 1 || reviewComments[0].ID != 12 || reviewComments[0].Path != "main.go" {
+		t.Errorf("expected only the diff note, got %+v", reviewComments)
+	}
+
+	if err := client.DeleteStaleComments("org", "repo", 3, comments, func(c github.IssueComment) bool { return c.Body == "/hold" }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, deleted := api.bodies["DELETE /api/v4/projects/org%2Frepo/merge_requests/3/notes/13"]; !deleted {
+		t.Error("expected the stale note to be deleted")
+	}
+	if err := client.DeleteComment("org", "repo", 99); err == nil {
+		t.Error("expected an error deleting a note of an unknown merge request")
+	}
+}
+
+func TestIsCollaborator(t *testing.T) {
+	client, _, stop := newTestClient(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v4/users": func(w http.ResponseWriter, r *http.Request) {
+			switch username := r.URL.Query().Get("username"); username {
+			case "developer":
+				respondJSON([]User{{ID: 1, Username: username}})(w, r)
+			case "reporter":
+				respondJSON([]User{{ID: 2, Username: username}})(w, r)
+			case "outsider":
+				respondJSON([]User{{ID: 3, Username: username}})(w, r)
+			default:
+				respondJSON([]User{})(w, r)
+			}
+		},
+		"GET /api/v4/projects/org%2Frepo/members/all/1": respondJSON(Member{User: User{ID: 1}, AccessLevel: DeveloperAccess}),
+		"GET /api/v4/projects/org%2Frepo/members/all/2": respondJSON(Member{User: User{ID: 2}, AccessLevel: 20}),
+	})
+	defer stop()
+
+	for user, expected := range map[string]bool{
+		"developer": true,
+		"reporter":  false,
+		"outsider":  false,
+		"ghost":     false,
+	} {
+		t.Run(user, func(t *testing.T) {
+			collaborator, err := client.IsCollaborator("org", "repo", user)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if collaborator != expected {
+				t.Errorf("expected IsCollaborator to be %t, got %t", expected, collaborator)
+			}
+		})
+	}
+}
+
+func TestCreateStatus(t *testing.T) {
+	var testCases = []struct {
+		name          string
+		state         string
+		respond       func(w http.ResponseWriter, r *http.Request)
+		expectedState string
+		expectedErr   bool
+	}{
+		{
+			name:          "success",
+			state:         github.StatusSuccess,
+			respond:       respondJSON(CommitStatus{}),
+			expectedState: StatusSuccess,
+		},
+		{
+			name:          "errors are reported as failures",
+			state:         github.StatusError,
+			respond:       respondJSON(CommitStatus{}),
+			expectedState: StatusFailed,
+		},
+		{
+			name:  "setting the current state again is not an error",
+			state: github.StatusPending,
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"message":"Cannot transition status via :enqueue from :pending"}`, http.StatusBadRequest)
+			},
+			expectedState: StatusPending,
+		},
+		{
+			name:  "other errors are returned",
+			state: github.StatusFailure,
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"message":"500 Internal Server Error"}`, http.StatusInternalServerError)
+			},
+			expectedState: StatusFailed,
+			expectedErr:   true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key := "POST /api/v4/projects/org%2Frepo/statuses/abc"
+			client, api, stop := newTestClient(t, map[string]func(w http.ResponseWriter, r *http.Request){key: tc.respond})
+			defer stop()
+
+			err := client.CreateStatus("org", "repo", "abc", github.Status{State: tc.state, Context: "unit", TargetURL: "https://prow", Description: "Job succeeded."})
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			var body map[string]string
+			if err := json.Unmarshal([]byte(api.bodies[key]), &body); err != nil {
+				t.Fatalf("failed to unmarshal request body: %v", err)
+			}
+			expected := map[string]string{"state": tc.expectedState, "name": "unit", "target_url": "https://prow", "description": "Job succeeded."}
+			if diff := cmp.Diff(expected, body); diff != "" {
+				t.Errorf("unexpected request body (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetCombinedStatus(t *testing.T) {
+	client, _, stop := newTestClient(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v4/projects/org%2Frepo/repository/commits/abc/statuses": respondJSON([]CommitStatus{
+			{Name: "unit", Status: StatusSuccess},
+			{Name: "e2e", Status: StatusRunning},
+		}),
+	})
+	defer stop()
+
+	combined, err := client.GetCombinedStatus("org", "repo", "abc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &github.CombinedStatus{
+		SHA:   "abc",
+		State: github.StatusPending,
+		Statuses: []github.Status{
+			{Context: "unit", State: github.StatusSuccess},
+			{Context: "e2e", State: github.StatusPending},
+		},
+	}
+	if diff := cmp.Diff(expected, combined); diff != "" {
+		t.Errorf("unexpected combined status (-want +got):\n%s", diff)
+	}
+}
+
+func TestCountDiffLines(t *testing.T) {
+	diff := "@@ -1,3 +1,3 @@\n context\n-old\n+new\n+another\n"
+	additions, deletions := countDiffLines(diff)
+	if additions != 2 || deletions != 1 {
+		t.Errorf("expected 2 additions and 1 deletion, got %d and %d", additions, deletions)
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import "time"
+
+// Access levels of the members of GitLab groups and projects.
+// https://docs.gitlab.com/ee/api/members.html#valid-access-levels
+const (
+	DeveloperAccess  = 30
+	MaintainerAccess = 40
+)
+
+// User is a GitLab user.
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	WebURL   string `json:"web_url,omitempty"`
+}
+
+// Member is a member of a GitLab group or project.
+type Member struct {
+	User
+	AccessLevel int `json:"access_level"`
+}
+
+// Group is a GitLab group.
+type Group struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	FullPath    string `json:"full_path"`
+	Description string `json:"description"`
+}
+
+// Label is a label of a GitLab project.
+type Label struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// DiffRefs are the commits a merge request is compared between.
+type DiffRefs struct {
+	BaseSHA  string `json:"base_sha"`
+	HeadSHA  string `json:"head_sha"`
+	StartSHA string `json:"start_sha"`
+}
+
+// MergeRequest is a GitLab merge request.
+type MergeRequest struct {
+	ID             int       `json:"id"`
+	IID            int       `json:"iid"`
+	ProjectID      int       `json:"project_id"`
+	Title          string    `json:"title"`
+	Description    string    `json:"description"`
+	State          string    `json:"state"`
+	Draft          bool      `json:"draft"`
+	WorkInProgress bool      `json:"work_in_progress"`
+	SourceBranch   string    `json:"source_branch"`
+	TargetBranch   string    `json:"target_branch"`
+	SHA            string    `json:"sha"`
+	MergeCommitSHA *string   `json:"merge_commit_sha"`
+	MergeStatus    string    `json:"merge_status"`
+	Author         User      `json:"author"`
+	Assignees      []User    `json:"assignees"`
+	Reviewers      []User    `json:"reviewers"`
+	Labels         []string  `json:"labels"`
+	WebURL         string    `json:"web_url"`
+	DiffRefs       DiffRefs  `json:"diff_refs"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Change is a file changed by a merge request.
+type Change struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
+	Diff        string `json:"diff"`
+}
+
+// MergeRequestChanges is a merge request with the files it changes.
+type MergeRequestChanges struct {
+	MergeRequest
+	Changes []Change `json:"changes"`
+}
+
+// Note is a comment on a GitLab merge request.
+type Note struct {
+	ID          int       `json:"id"`
+	Type        string    `json:"type"`
+	Body        string    `json:"body"`
+	Author      User      `json:"author"`
+	System      bool      `json:"system"`
+	NoteableIID int       `json:"noteable_iid"`
+	Position    *Position `json:"position,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Position is the position of a diff note.
+type Position struct {
+	NewPath string `json:"new_path"`
+	NewLine *int   `json:"new_line"`
+}
+
+// DiffNoteType is the type of the notes on the diff of a merge request.
+const DiffNoteType = "DiffNote"
+
+// Approvals are the approvals of a merge request.
+type Approvals struct {
+	ApprovedBy []struct {
+		User User `json:"user"`
+	} `json:"approved_by"`
+}
+
+// LabelEvent is a change of the labels of a merge request.
+type LabelEvent struct {
+	ID        int       `json:"id"`
+	User      User      `json:"user"`
+	Label     *Label    `json:"label"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Commit is a GitLab commit.
+type Commit struct {
+	ID             string    `json:"id"`
+	Title          string    `json:"title"`
+	Message        string    `json:"message"`
+	AuthorName     string    `json:"author_name"`
+	AuthorEmail    string    `json:"author_email"`
+	AuthoredDate   time.Time `json:"authored_date"`
+	CommitterName  string    `json:"committer_name"`
+	CommitterEmail string    `json:"committer_email"`
+	CommittedDate  time.Time `json:"committed_date"`
+	ParentIDs      []string  `json:"parent_ids"`
+	WebURL         string    `json:"web_url"`
+}
+
+// Branch is a branch or a tag of a GitLab project.
+type Branch struct {
+	Name   string `json:"name"`
+	Commit Commit `json:"commit"`
+}
+
+// CommitStatus is the status of an external job for a commit.
+type CommitStatus struct {
+	ID          int    `json:"id"`
+	SHA         string `json:"sha"`
+	Ref         string `json:"ref"`
+	Status      string `json:"status"`
+	Name        string `json:"name"`
+	TargetURL   string `json:"target_url"`
+	Description string `json:"description"`
+}
+
+// Commit status states.
+// https://docs.gitlab.com/ee/api/commits.html#post-the-build-status-to-a-commit
+const (
+	StatusPending  = "pending"
+	StatusRunning  = "running"
+	StatusSuccess  = "success"
+	StatusFailed   = "failed"
+	StatusCanceled = "canceled"
+)
+
+// Webhook event types, from the X-Gitlab-Event header.
+const (
+	MergeRequestHook = "Merge Request Hook"
+	NoteHook         = "Note Hook"
+	PushHook         = "Push Hook"
+)
+
+// EventProject is the project of a webhook event.
+type EventProject struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+	DefaultBranch     string `json:"default_branch"`
+}
+
+// EventLabel is a label in a webhook event.
+type EventLabel struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+// MergeRequestEvent is the payload of a Merge Request Hook.
+// https://docs.gitlab.com/ee/user/project/integrations/webhook_events.html#merge-request-events
+type MergeRequestEvent struct {
+	User             User         `json:"user"`
+	Project          EventProject `json:"project"`
+	ObjectAttributes struct {
+		IID    int    `json:"iid"`
+		Action string `json:"action"`
+		OldRev string `json:"oldrev"`
+	} `json:"object_attributes"`
+	Changes struct {
+		Labels *struct {
+			Previous []EventLabel `json:"previous"`
+			Current  []EventLabel `json:"current"`
+		} `json:"labels"`
+		Title       *struct{} `json:"title"`
+		Description *struct{} `json:"description"`
+		Draft       *struct {
+			Current bool `json:"current"`
+		} `json:"draft"`
+	} `json:"changes"`
+}
+
+// NoteEvent is the payload of a Note Hook.
+// https://docs.gitlab.com/ee/user/project/integrations/webhook_events.html#comment-events
+type NoteEvent struct {
+	User             User         `json:"user"`
+	Project          EventProject `json:"project"`
+	ObjectAttributes struct {
+		ID           int    `json:"id"`
+		Note         string `json:"note"`
+		NoteableType string `json:"noteable_type"`
+		Action       string `json:"action"`
+		URL          string `json:"url"`
+	} `json:"object_attributes"`
+	MergeRequest *struct {
+		IID int `json:"iid"`
+	} `json:"merge_request"`
+}
+
+// PushEvent is the payload of a Push Hook.
+// https://docs.gitlab.com/ee/user/project/integrations/webhook_events.html#push-events
+type PushEvent struct {
+	Ref          string       `json:"ref"`
+	Before       string       `json:"before"`
+	After        string       `json:"after"`
+	UserUsername string       `json:"user_username"`
+	UserName     string       `json:"user_name"`
+	UserEmail    string       `json:"user_email"`
+	Project      EventProject `json:"project"`
+	Commits      []struct {
+		ID       string   `json:"id"`
+		Message  string   `json:"message"`
+		URL      string   `json:"url"`
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// ValidateWebhook ensures that the provided request conforms to the
+// format of a GitLab webhook and carries the secret token returned by
+// tokenGenerator. It returns the event type, the event guid, the payload
+// of the request, whether the webhook is valid or not, and finally the
+// resultant HTTP status code
+func ValidateWebhook(w http.ResponseWriter, r *http.Request, tokenGenerator func() []byte) (string, string, []byte, bool, int) {
+	defer r.Body.Close()
+
+	if r.Method != http.MethodPost {
+		responseHTTPError(w, http.StatusMethodNotAllowed, "405 Method not allowed")
+		return "", "", nil, false, http.StatusMethodNotAllowed
+	}
+	eventType := r.Header.Get("X-Gitlab-Event")
+	if eventType == "" {
+		responseHTTPError(w, http.StatusBadRequest, "400 Bad Request: Missing X-Gitlab-Event Header")
+		return "", "", nil, false, http.StatusBadRequest
+	}
+	token := r.Header.Get("X-Gitlab-Token")
+	if token == "" {
+		responseHTTPError(w, http.StatusForbidden, "403 Forbidden: Missing X-Gitlab-Token")
+		return "", "", nil, false, http.StatusForbidden
+	}
+	secret := bytes.TrimSpace(tokenGenerator())
+	if len(secret) == 0 || subtle.ConstantTimeCompare(secret, []byte(token)) != 1 {
+		responseHTTPError(w, http.StatusForbidden, "403 Forbidden: Invalid X-Gitlab-Token")
+		return "", "", nil, false, http.StatusForbidden
+	}
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responseHTTPError(w, http.StatusInternalServerError, "500 Internal Server Error: Failed to read request body")
+		return "", "", nil, false, http.StatusInternalServerError
+	}
+	// Older GitLab versions don't identify deliveries.
+	eventGUID := r.Header.Get("X-Gitlab-Event-UUID")
+	if eventGUID == "" {
+		eventGUID = uuid.NewV1().String()
+	}
+	return eventType, eventGUID, payload, true, http.StatusOK
+}
+
+func responseHTTPError(w http.ResponseWriter, statusCode int, response string) {
+	logrus.WithFields(logrus.Fields{
+		"response":    response,
+		"status-code": statusCode,
+	}).Debug(response)
+	http.Error(w, response, statusCode)
+}
+
+// Event is a GitLab webhook event translated to a GitHub webhook event.
+type Event struct {
+	// Type is the GitHub event type, like pull_request.
+	Type string
+	// Payload is the GitHub event.
+	Payload []byte
+}
+
+// ErrNestedGroup is returned for the events of projects in nested groups,
+// whose group paths can't stand in for an organization in org/repo.
+var ErrNestedGroup = errors.New("projects of nested groups are not supported")
+
+// toRepo converts a project to a repo, whose organization is the group of
+// the project.
+func toRepo(project EventProject) (github.Repo, error) {
+	path := project.PathWithNamespace
+	parts := strings.Split(path, "/")
+	if len(parts) > 2 {
+		return github.Repo{}, fmt.Errorf("project %s: %w", path, ErrNestedGroup)
+	}
+	if len(parts) != 2 {
+		return github.Repo{}, fmt.Errorf("project path %q is not of the form group/project", path)
+	}
+	return github.Repo{
+		Owner:         github.User{Login: parts[0]},
+		Name:          parts[1],
+		FullName:      path,
+		HTMLURL:       project.WebURL,
+		DefaultBranch: project.DefaultBranch,
+	}, nil
+}
+
+// NormalizeEvent translates a GitLab webhook event into the GitHub webhook
+// events that plugins handle. Events of projects in nested groups fail with
+// ErrNestedGroup. Merge request events become pull_request or
+// pull_request_review events, notes on merge requests become issue_comment
+// events and pushes become push events. The merge request is fetched with
+// the client since webhooks only carry part of it. Other events are ignored.
+func NormalizeEvent(c Client, eventType string, payload []byte) ([]Event, error) {
+	var events []interface{}
+	var types []string
+	add := func(eventType string, event interface{}) {
+		types = append(types, eventType)
+		events = append(events, event)
+	}
+
+	switch eventType {
+	case MergeRequestHook:
+		var e MergeRequestEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		repo, err := toRepo(e.Project)
+		if err != nil {
+			return nil, err
+		}
+		pr, err := c.GetPullRequest(repo.Owner.Login, repo.Name, e.ObjectAttributes.IID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get merge request %s!%d: %w", repo.FullName, e.ObjectAttributes.IID, err)
+		}
+		pr.Base.Repo, pr.Head.Repo = repo, repo
+		sender := toGitHubUser(e.User)
+		prEvent := func(action github.PullRequestEventAction, label string) github.PullRequestEvent {
+			return github.PullRequestEvent{
+				Action:      action,
+				Number:      pr.Number,
+				PullRequest: *pr,
+				Repo:        repo,
+				Label:       github.Label{Name: label},
+				Sender:      sender,
+			}
+		}
+		switch e.ObjectAttributes.Action {
+		case "open":
+			add("pull_request", prEvent(github.PullRequestActionOpened, ""))
+		case "reopen":
+			add("pull_request", prEvent(github.PullRequestActionReopened, ""))
+		case "close", "merge":
+			add("pull_request", prEvent(github.PullRequestActionClosed, ""))
+		case "update":
+			if e.ObjectAttributes.OldRev != "" {
+				add("pull_request", prEvent(github.PullRequestActionSynchronize, ""))
+			}
+			if e.Changes.Labels != nil {
+				previous, current := sets.NewString(), sets.NewString()
+				for _, label := range e.Changes.Labels.Previous {
+					previous.Insert(label.Title)
+				}
+				for _, label := range e.Changes.Labels.Current {
+					current.Insert(label.Title)
+				}
+				for _, label := range current.Difference(previous).List() {
+					add("pull_request", prEvent(github.PullRequestActionLabeled, label))
+				}
+				for _, label := range previous.Difference(current).List() {
+					add("pull_request", prEvent(github.PullRequestActionUnlabeled, label))
+				}
+			}
+			if e.Changes.Title != nil || e.Changes.Description != nil {
+				add("pull_request", prEvent(github.PullRequestActionEdited, ""))
+			}
+			if e.Changes.Draft != nil {
+				if e.Changes.Draft.Current {
+					add("pull_request", prEvent(github.PullRequestActionConvertedToDraft, ""))
+				} else {
+					add("pull_request", prEvent(github.PullRequestActionReadyForReview, ""))
+				}
+			}
+		case "approved":
+			add("pull_request_review", github.ReviewEvent{
+				Action:      github.ReviewActionSubmitted,
+				PullRequest: *pr,
+				Repo:        repo,
+				Review: github.Review{
+					User:    sender,
+					State:   github.ReviewStateApproved,
+					HTMLURL: pr.HTMLURL,
+				},
+			})
+		}
+
+	case NoteHook:
+		var e NoteEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		if e.ObjectAttributes.NoteableType != "MergeRequest" || e.MergeRequest == nil {
+			return nil, nil
+		}
+		repo, err := toRepo(e.Project)
+		if err != nil {
+			return nil, err
+		}
+		pr, err := c.GetPullRequest(repo.Owner.Login, repo.Name, e.MergeRequest.IID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get merge request %s!%d: %w", repo.FullName, e.MergeRequest.IID, err)
+		}
+		action := github.IssueCommentActionCreated
+		if e.ObjectAttributes.Action == "update" {
+			action = github.IssueCommentActionEdited
+		}
+		add("issue_comment", github.IssueCommentEvent{
+			Action: action,
+			Issue: github.Issue{
+				ID:          pr.ID,
+				User:        pr.User,
+				Number:      pr.Number,
+				Title:       pr.Title,
+				State:       pr.State,
+				HTMLURL:     pr.HTMLURL,
+				Labels:      pr.Labels,
+				Assignees:   pr.Assignees,
+				Body:        pr.Body,
+				CreatedAt:   pr.CreatedAt,
+				UpdatedAt:   pr.UpdatedAt,
+				PullRequest: &struct{}{},
+			},
+			Comment: github.IssueComment{
+				ID:      e.ObjectAttributes.ID,
+				Body:    e.ObjectAttributes.Note,
+				User:    toGitHubUser(e.User),
+				HTMLURL: e.ObjectAttributes.URL,
+			},
+			Repo: repo,
+		})
+
+	case PushHook:
+		var e PushEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		repo, err := toRepo(e.Project)
+		if err != nil {
+			return nil, err
+		}
+		pusher := github.User{Login: e.UserUsername, Name: e.UserName, Email: e.UserEmail}
+		push := github.PushEvent{
+			Ref:     e.Ref,
+			Before:  e.Before,
+			After:   e.After,
+			Created: strings.Trim(e.Before, "0") == "",
+			Deleted: strings.Trim(e.After, "0") == "",
+			Pusher:  pusher,
+			Sender:  pusher,
+			Repo:    repo,
+		}
+		for _, commit := range e.Commits {
+			push.Commits = append(push.Commits, github.Commit{
+				ID:       commit.ID,
+				Message:  commit.Message,
+				Added:    commit.Added,
+				Removed:  commit.Removed,
+				Modified: commit.Modified,
+			})
+		}
+		add("push", push)
+	}
+
+	var normalized []Event
+	for i, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s event: %w", types[i], err)
+		}
+		normalized = append(normalized, Event{Type: types[i], Payload: payload})
+	}
+	return normalized, nil
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	var testCases = []struct {
+		name         string
+		method       string
+		header       map[string]string
+		expectedOK   bool
+		expectedCode int
+		expectedGUID string
+	}{
+		{
+			name:         "valid webhook",
+			method:       http.MethodPost,
+			header:       map[string]string{"X-Gitlab-Event": NoteHook, "X-Gitlab-Token": "secret", "X-Gitlab-Event-UUID": "guid"},
+			expectedOK:   true,
+			expectedCode: http.StatusOK,
+			expectedGUID: "guid",
+		},
+		{
+			name:         "GET is not allowed",
+			method:       http.MethodGet,
+			header:       map[string]string{"X-Gitlab-Event": NoteHook, "X-Gitlab-Token": "secret"},
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:         "missing event type",
+			method:       http.MethodPost,
+			header:       map[string]string{"X-Gitlab-Token": "secret"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "missing token",
+			method:       http.MethodPost,
+			header:       map[string]string{"X-Gitlab-Event": NoteHook},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "invalid token",
+			method:       http.MethodPost,
+			header:       map[string]string{"X-Gitlab-Event": NoteHook, "X-Gitlab-Token": "guess"},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/hook/gitlab", strings.NewReader(`{}`))
+			for key, value := range tc.header {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			eventType, guid, payload, ok, code := ValidateWebhook(w, r, func() []byte { return []byte("secret\n") })
+			if ok != tc.expectedOK || code != tc.expectedCode {
+				t.Fatalf("expected ok %t with code %d, got %t with %d", tc.expectedOK, tc.expectedCode, ok, code)
+			}
+			if !ok {
+				return
+			}
+			if eventType != NoteHook || guid != tc.expectedGUID || string(payload) != `{}` {
+				t.Errorf("unexpected event %q, guid %q or payload %q", eventType, guid, payload)
+			}
+		})
+	}
+}
+
+// fakeClient serves merge requests for NormalizeEvent.
+type fakeClient struct {
+	Client
+	pullRequests map[int]*github.PullRequest
+}
+
+func (f *fakeClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	pr, ok := f.pullRequests[number]
+	if !ok {
+		return nil, &requestError{statusCode: http.StatusNotFound, message: "404 Not Found"}
+	}
+	copied := *pr
+	return &copied, nil
+}
+
+func TestNormalizeEvent(t *testing.T) {
+	repo := github.Repo{
+		Owner:    github.User{Login: "group"},
+		Name:     "repo",
+		FullName: "group/repo",
+		HTMLURL:  "https://gitlab.example.com/group/repo",
+	}
+	pr := github.PullRequest{Number: 1, Title: "title", State: github.PullRequestStateOpen, User: github.User{Login: "author"}, HTMLURL: "https://gitlab.example.com/group/repo/-/merge_requests/1"}
+	prWithRepo := pr
+	prWithRepo.Base.Repo, prWithRepo.Head.Repo = repo, repo
+	project := `"project": {"path_with_namespace": "group/repo", "web_url": "https://gitlab.example.com/group/repo"}`
+	sender := github.User{Login: "alice"}
+	prEvent := func(action github.PullRequestEventAction, label string) interface{} {
+		return github.PullRequestEvent{Action: action, Number: 1, PullRequest: prWithRepo, Repo: repo, Label: github.Label{Name: label}, Sender: sender}
+	}
+
+	var testCases = []struct {
+		name           string
+		eventType      string
+		payload        string
+		expectedTypes  []string
+		expectedEvents []interface{}
+		expectedErr    bool
+	}{
+		{
+			name:           "opened merge request",
+			eventType:      MergeRequestHook,
+			payload:        `{"user": {"username": "alice"}, ` + project + `, "object_attributes": {"iid": 1, "action": "open"}}`,
+			expectedTypes:  []string{"pull_request"},
+			expectedEvents: []interface{}{prEvent(github.PullRequestActionOpened, "")},
+		},
+		{
+			name:      "updated merge request",
+			eventType: MergeRequestHook,
+			payload: `{"user": {"username": "alice"}, ` + project + `, "object_attributes": {"iid": 1, "action": "update", "oldrev": "old"},
+				"changes": {"labels": {"previous": [{"title": "keep"}, {"title": "drop"}], "current": [{"title": "keep"}, {"title": "add"}]}, "title": {"previous": "a", "current": "b"}}}`,
+			expectedTypes: []string{"pull_request", "pull_request", "pull_request", "pull_request"},
+			expectedEvents: []interface{}{
+				prEvent(github.PullRequestActionSynchronize, ""),
+				prEvent(github.PullRequestActionLabeled, "add"),
+				prEvent(github.PullRequestActionUnlabeled, "drop"),
+				prEvent(github.PullRequestActionEdited, ""),
+			},
+		},
+		{
+			name:          "approved merge request",
+			eventType:     MergeRequestHook,
+			payload:       `{"user": {"username": "alice"}, ` + project + `, "object_attributes": {"iid": 1, "action": "approved"}}`,
+			expectedTypes: []string{"pull_request_review"},
+			expectedEvents: []interface{}{github.ReviewEvent{
+				Action:      github.ReviewActionSubmitted,
+				PullRequest: prWithRepo,
+				Repo:        repo,
+				Review:      github.Review{User: sender, State: github.ReviewStateApproved, HTMLURL: pr.HTMLURL},
+			}},
+		},
+		{
+			name:        "missing merge request",
+			eventType:   MergeRequestHook,
+			payload:     `{"user": {"username": "alice"}, ` + project + `, "object_attributes": {"iid": 2, "action": "open"}}`,
+			expectedErr: true,
+		},
+		{
+			name:        "merge request of a nested group",
+			eventType:   MergeRequestHook,
+			payload:     `{"user": {"username": "alice"}, "project": {"path_with_namespace": "group/sub/repo"}, "object_attributes": {"iid": 1, "action": "open"}}`,
+			expectedErr: true,
+		},
+		{
+			name:          "note on a merge request",
+			eventType:     NoteHook,
+			payload:       `{"user": {"username": "alice"}, ` + project + `, "object_attributes": {"id": 7, "note": "/lgtm", "noteable_type": "MergeRequest", "url": "https://note"}, "merge_request": {"iid": 1}}`,
+			expectedTypes: []string{"issue_comment"},
+			expectedEvents: []interface{}{github.IssueCommentEvent{
+				Action: github.IssueCommentActionCreated,
+				Issue: github.Issue{
+					User:        pr.User,
+					Number:      1,
+					Title:       "title",
+					State:       github.PullRequestStateOpen,
+					HTMLURL:     pr.HTMLURL,
+					PullRequest: &struct{}{},
+				},
+				Comment: github.IssueComment{ID: 7, Body: "/lgtm", User: sender, HTMLURL: "https://note"},
+				Repo:    repo,
+			}},
+		},
+		{
+			name:      "note on an issue is ignored",
+			eventType: NoteHook,
+			payload:   `{"user": {"username": "alice"}, ` + project + `, "object_attributes": {"id": 7, "note": "/lgtm", "noteable_type": "Issue"}}`,
+		},
+		{
+			name:          "push",
+			eventType:     PushHook,
+			payload:       `{"ref": "refs/heads/main", "before": "0000000000000000000000000000000000000000", "after": "abc", "user_username": "alice", ` + project + `, "commits": [{"id": "abc", "message": "msg", "added": ["a.go"]}]}`,
+			expectedTypes: []string{"push"},
+			expectedEvents: []interface{}{github.PushEvent{
+				Ref:     "refs/heads/main",
+				Before:  "0000000000000000000000000000000000000000",
+				After:   "abc",
+				Created: true,
+				Commits: []github.Commit{{ID: "abc", Message: "msg", Added: []string{"a.go"}}},
+				Pusher:  sender,
+				Sender:  sender,
+				Repo:    repo,
+			}},
+		},
+		{
+			name:      "other events are ignored",
+			eventType: "Pipeline Hook",
+			payload:   `{}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeClient{pullRequests: map[int]*github.PullRequest{1: &pr}}
+			events, err := NormalizeEvent(client, tc.eventType, []byte(tc.payload))
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			if len(events) != len(tc.expectedEvents) {
+				t.Fatalf("expected %d events, got %d", len(tc.expectedEvents), len(events))
+			}
+			var types []string
+			var expected, actual []string
+			for i, event := range events {
+				types = append(types, event.Type)
+				actual = append(actual, string(event.Payload))
+				raw, err := json.Marshal(tc.expectedEvents[i])
+				if err != nil {
+					t.Fatalf("failed to marshal expected event: %v", err)
+				}
+				expected = append(expected, string(raw))
+			}
+			if diff := cmp.Diff(tc.expectedTypes, types); diff != "" {
+				t.Fatalf("unexpected event types (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(expected, actual); diff != "" {
+				t.Errorf("unexpected events (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -68,8 +68,8 @@ var (
 	}
 )
 
-func (s *Server) handleReviewEvent(l *logrus.Entry, re github.ReviewEvent) {
-	defer s.wg.Done()
+func (s *Server) handleReviewEvent(l *logrus.Entry, d *delivery, re github.ReviewEvent) {
+	defer s.finishHandler(d)
 	l = l.WithFields(logrus.Fields{
 		github.OrgLogField:  re.Repo.Owner.Login,
 		github.RepoLogField: re.Repo.Name,
@@ -80,9 +80,12 @@ func (s *Server) handleReviewEvent(l *logrus.Entry, re github.ReviewEvent) {
 	})
 	l.Infof("Review %s.", re.Action)
 	for p, h := range s.Plugins.ReviewEventHandlers(re.PullRequest.Base.Repo.Owner.Login, re.PullRequest.Base.Repo.Name) {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("ReviewEvent", p)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p string, h plugins.ReviewEventHandler) {
-			defer s.wg.Done()
+			defer s.finishHandler(d)
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, re.Repo.Owner.Login, s.Metrics.Metrics, l, p)
 			agent.InitializeCommentPruner(
 				re.Repo.Owner.Login,
@@ -91,7 +94,7 @@ func (s *Server) handleReviewEvent(l *logrus.Entry, re github.ReviewEvent) {
 			)
 			start := time.Now()
 			labels := prometheus.Labels{"event_type": l.Data[eventTypeField].(string), "action": string(re.Action), "plugin": p}
-			if err := errorOnPanic(func() error { return h(agent, re) }); err != nil {
+			if err := s.runHandler(d, handlerName("ReviewEvent", p), func() error { return h(agent, re) }); err != nil {
 				agent.Logger.WithError(err).Error("Error handling ReviewEvent.")
 				s.Metrics.PluginHandleErrors.With(labels).Inc()
 			}
@@ -105,6 +108,7 @@ func (s *Server) handleReviewEvent(l *logrus.Entry, re github.ReviewEvent) {
 	}
 	s.handleGenericComment(
 		l,
+		d,
 		&github.GenericCommentEvent{
 			GUID:         re.GUID,
 			NodeID:       re.Review.NodeID,
@@ -125,8 +129,8 @@ func (s *Server) handleReviewEvent(l *logrus.Entry, re github.ReviewEvent) {
 	)
 }
 
-func (s *Server) handleReviewCommentEvent(l *logrus.Entry, rce github.ReviewCommentEvent) {
-	defer s.wg.Done()
+func (s *Server) handleReviewCommentEvent(l *logrus.Entry, d *delivery, rce github.ReviewCommentEvent) {
+	defer s.finishHandler(d)
 	l = l.WithFields(logrus.Fields{
 		github.OrgLogField:  rce.Repo.Owner.Login,
 		github.RepoLogField: rce.Repo.Name,
@@ -137,9 +141,12 @@ func (s *Server) handleReviewCommentEvent(l *logrus.Entry, rce github.ReviewComm
 	})
 	l.Infof("Review comment %s.", rce.Action)
 	for p, h := range s.Plugins.ReviewCommentEventHandlers(rce.PullRequest.Base.Repo.Owner.Login, rce.PullRequest.Base.Repo.Name) {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("ReviewCommentEvent", p)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p string, h plugins.ReviewCommentEventHandler) {
-			defer s.wg.Done()
+			defer s.finishHandler(d)
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, rce.Repo.Owner.Login, s.Metrics.Metrics, l, p)
 			agent.InitializeCommentPruner(
 				rce.Repo.Owner.Login,
@@ -148,7 +155,7 @@ func (s *Server) handleReviewCommentEvent(l *logrus.Entry, rce github.ReviewComm
 			)
 			start := time.Now()
 			labels := prometheus.Labels{"event_type": l.Data[eventTypeField].(string), "action": string(rce.Action), "plugin": p}
-			if err := errorOnPanic(func() error { return h(agent, rce) }); err != nil {
+			if err := s.runHandler(d, handlerName("ReviewCommentEvent", p), func() error { return h(agent, rce) }); err != nil {
 				agent.Logger.WithError(err).Error("Error handling ReviewCommentEvent.")
 				s.Metrics.PluginHandleErrors.With(labels).Inc()
 			}
@@ -162,6 +169,7 @@ func (s *Server) handleReviewCommentEvent(l *logrus.Entry, rce github.ReviewComm
 	}
 	s.handleGenericComment(
 		l,
+		d,
 		&github.GenericCommentEvent{
 			GUID:         rce.GUID,
 			NodeID:       rce.Comment.NodeID,
@@ -183,8 +191,8 @@ func (s *Server) handleReviewCommentEvent(l *logrus.Entry, rce github.ReviewComm
 	)
 }
 
-func (s *Server) handlePullRequestEvent(l *logrus.Entry, pr github.PullRequestEvent) {
-	defer s.wg.Done()
+func (s *Server) handlePullRequestEvent(l *logrus.Entry, d *delivery, pr github.PullRequestEvent) {
+	defer s.finishHandler(d)
 	l = l.WithFields(logrus.Fields{
 		github.OrgLogField:  pr.Repo.Owner.Login,
 		github.RepoLogField: pr.Repo.Name,
@@ -194,9 +202,12 @@ func (s *Server) handlePullRequestEvent(l *logrus.Entry, pr github.PullRequestEv
 	})
 	l.Infof("Pull request %s.", pr.Action)
 	for p, h := range s.Plugins.PullRequestHandlers(pr.PullRequest.Base.Repo.Owner.Login, pr.PullRequest.Base.Repo.Name) {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("PullRequestEvent", p)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p string, h plugins.PullRequestHandler) {
-			defer s.wg.Done()
+			defer s.finishHandler(d)
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, pr.Repo.Owner.Login, s.Metrics.Metrics, l, p)
 			agent.InitializeCommentPruner(
 				pr.Repo.Owner.Login,
@@ -205,7 +216,7 @@ func (s *Server) handlePullRequestEvent(l *logrus.Entry, pr github.PullRequestEv
 			)
 			start := time.Now()
 			labels := prometheus.Labels{"event_type": l.Data[eventTypeField].(string), "action": string(pr.Action), "plugin": p}
-			if err := errorOnPanic(func() error { return h(agent, pr) }); err != nil {
+			if err := s.runHandler(d, handlerName("PullRequestEvent", p), func() error { return h(agent, pr) }); err != nil {
 				agent.Logger.WithError(err).Error("Error handling PullRequestEvent.")
 				s.Metrics.PluginHandleErrors.With(labels).Inc()
 			}
@@ -221,6 +232,7 @@ func (s *Server) handlePullRequestEvent(l *logrus.Entry, pr github.PullRequestEv
 	}
 	s.handleGenericComment(
 		l,
+		d,
 		&github.GenericCommentEvent{
 			ID:           pr.PullRequest.ID,
 			NodeID:       pr.PullRequest.NodeID,
@@ -242,8 +254,8 @@ func (s *Server) handlePullRequestEvent(l *logrus.Entry, pr github.PullRequestEv
 	)
 }
 
-func (s *Server) handlePushEvent(l *logrus.Entry, pe github.PushEvent) {
-	defer s.wg.Done()
+func (s *Server) handlePushEvent(l *logrus.Entry, d *delivery, pe github.PushEvent) {
+	defer s.finishHandler(d)
 	l = l.WithFields(logrus.Fields{
 		github.OrgLogField:  pe.Repo.Owner.Name,
 		github.RepoLogField: pe.Repo.Name,
@@ -252,13 +264,16 @@ func (s *Server) handlePushEvent(l *logrus.Entry, pe github.PushEvent) {
 	})
 	l.Info("Push event.")
 	for p, h := range s.Plugins.PushEventHandlers(pe.Repo.Owner.Name, pe.Repo.Name) {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("PushEvent", p)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p string, h plugins.PushEventHandler) {
-			defer s.wg.Done()
+			defer s.finishHandler(d)
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, pe.Repo.Owner.Login, s.Metrics.Metrics, l, p)
 			start := time.Now()
 			labels := prometheus.Labels{"event_type": l.Data[eventTypeField].(string), "action": "none", "plugin": p}
-			if err := errorOnPanic(func() error { return h(agent, pe) }); err != nil {
+			if err := s.runHandler(d, handlerName("PushEvent", p), func() error { return h(agent, pe) }); err != nil {
 				agent.Logger.WithError(err).Error("Error handling PushEvent.")
 				s.Metrics.PluginHandleErrors.With(labels).Inc()
 			}
@@ -267,8 +282,8 @@ func (s *Server) handlePushEvent(l *logrus.Entry, pe github.PushEvent) {
 	}
 }
 
-func (s *Server) handleIssueEvent(l *logrus.Entry, i github.IssueEvent) {
-	defer s.wg.Done()
+func (s *Server) handleIssueEvent(l *logrus.Entry, d *delivery, i github.IssueEvent) {
+	defer s.finishHandler(d)
 	l = l.WithFields(logrus.Fields{
 		github.OrgLogField:  i.Repo.Owner.Login,
 		github.RepoLogField: i.Repo.Name,
@@ -278,9 +293,12 @@ func (s *Server) handleIssueEvent(l *logrus.Entry, i github.IssueEvent) {
 	})
 	l.Infof("Issue %s.", i.Action)
 	for p, h := range s.Plugins.IssueHandlers(i.Repo.Owner.Login, i.Repo.Name) {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("IssueEvent", p)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p string, h plugins.IssueHandler) {
-			defer s.wg.Done()
+			defer s.finishHandler(d)
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, i.Repo.Owner.Login, s.Metrics.Metrics, l, p)
 			agent.InitializeCommentPruner(
 				i.Repo.Owner.Login,
@@ -289,7 +307,7 @@ func (s *Server) handleIssueEvent(l *logrus.Entry, i github.IssueEvent) {
 			)
 			start := time.Now()
 			labels := prometheus.Labels{"event_type": l.Data[eventTypeField].(string), "action": string(i.Action), "plugin": p}
-			if err := errorOnPanic(func() error { return h(agent, i) }); err != nil {
+			if err := s.runHandler(d, handlerName("IssueEvent", p), func() error { return h(agent, i) }); err != nil {
 				agent.Logger.WithError(err).Error("Error handling IssueEvent.")
 				s.Metrics.PluginHandleErrors.With(labels).Inc()
 			}
@@ -305,6 +323,7 @@ func (s *Server) handleIssueEvent(l *logrus.Entry, i github.IssueEvent) {
 	}
 	s.handleGenericComment(
 		l,
+		d,
 		&github.GenericCommentEvent{
 			ID:           i.Issue.ID,
 			NodeID:       i.Issue.NodeID,
@@ -326,8 +345,8 @@ func (s *Server) handleIssueEvent(l *logrus.Entry, i github.IssueEvent) {
 	)
 }
 
-func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic github.IssueCommentEvent) {
-	defer s.wg.Done()
+func (s *Server) handleIssueCommentEvent(l *logrus.Entry, d *delivery, ic github.IssueCommentEvent) {
+	defer s.finishHandler(d)
 	l = l.WithFields(logrus.Fields{
 		github.OrgLogField:  ic.Repo.Owner.Login,
 		github.RepoLogField: ic.Repo.Name,
@@ -337,9 +356,12 @@ func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic github.IssueComment
 	})
 	l.Infof("Issue comment %s.", ic.Action)
 	for p, h := range s.Plugins.IssueCommentHandlers(ic.Repo.Owner.Login, ic.Repo.Name) {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("IssueCommentEvent", p)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p string, h plugins.IssueCommentHandler) {
-			defer s.wg.Done()
+			defer s.finishHandler(d)
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, ic.Repo.Owner.Login, s.Metrics.Metrics, l, p)
 			agent.InitializeCommentPruner(
 				ic.Repo.Owner.Login,
@@ -348,7 +370,7 @@ func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic github.IssueComment
 			)
 			start := time.Now()
 			labels := prometheus.Labels{"event_type": l.Data[eventTypeField].(string), "action": string(ic.Action), "plugin": p}
-			if err := errorOnPanic(func() error { return h(agent, ic) }); err != nil {
+			if err := s.runHandler(d, handlerName("IssueCommentEvent", p), func() error { return h(agent, ic) }); err != nil {
 				agent.Logger.WithError(err).Error("Error handling IssueCommentEvent.")
 				s.Metrics.PluginHandleErrors.With(labels).Inc()
 			}
@@ -362,6 +384,7 @@ func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic github.IssueComment
 	}
 	s.handleGenericComment(
 		l,
+		d,
 		&github.GenericCommentEvent{
 			ID:           ic.Issue.ID,
 			NodeID:       ic.Issue.NodeID,
@@ -384,8 +407,8 @@ func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic github.IssueComment
 	)
 }
 
-func (s *Server) handleStatusEvent(l *logrus.Entry, se github.StatusEvent) {
-	defer s.wg.Done()
+func (s *Server) handleStatusEvent(l *logrus.Entry, d *delivery, se github.StatusEvent) {
+	defer s.finishHandler(d)
 	l = l.WithFields(logrus.Fields{
 		github.OrgLogField:  se.Repo.Owner.Login,
 		github.RepoLogField: se.Repo.Name,
@@ -396,13 +419,16 @@ func (s *Server) handleStatusEvent(l *logrus.Entry, se github.StatusEvent) {
 	})
 	l.Infof("Status description %s.", se.Description)
 	for p, h := range s.Plugins.StatusEventHandlers(se.Repo.Owner.Login, se.Repo.Name) {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("StatusEvent", p)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p string, h plugins.StatusEventHandler) {
-			defer s.wg.Done()
+			defer s.finishHandler(d)
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, se.Repo.Owner.Login, s.Metrics.Metrics, l, p)
 			start := time.Now()
 			labels := prometheus.Labels{"event_type": l.Data[eventTypeField].(string), "action": "none", "plugin": p}
-			if err := errorOnPanic(func() error { return h(agent, se) }); err != nil {
+			if err := s.runHandler(d, handlerName("StatusEvent", p), func() error { return h(agent, se) }); err != nil {
 				agent.Logger.WithError(err).Error("Error handling StatusEvent.")
 				s.Metrics.PluginHandleErrors.With(labels).Inc()
 			}
@@ -426,11 +452,14 @@ func genericCommentAction(action string) github.GenericCommentEventAction {
 	return ""
 }
 
-func (s *Server) handleGenericComment(l *logrus.Entry, ce *github.GenericCommentEvent) {
+func (s *Server) handleGenericComment(l *logrus.Entry, d *delivery, ce *github.GenericCommentEvent) {
 	for p, h := range s.Plugins.GenericCommentHandlers(ce.Repo.Owner.Login, ce.Repo.Name) {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("GenericCommentEvent", p)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p string, h plugins.GenericCommentHandler) {
-			defer s.wg.Done()
+			defer s.finishHandler(d)
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, ce.Repo.Owner.Login, s.Metrics.Metrics, l, p)
 			agent.InitializeCommentPruner(
 				ce.Repo.Owner.Login,
@@ -439,7 +468,7 @@ func (s *Server) handleGenericComment(l *logrus.Entry, ce *github.GenericComment
 			)
 			start := time.Now()
 			labels := prometheus.Labels{"event_type": l.Data[eventTypeField].(string), "action": string(ce.Action), "plugin": p}
-			if err := errorOnPanic(func() error { return h(agent, *ce) }); err != nil {
+			if err := s.runHandler(d, handlerName("GenericCommentEvent", p), func() error { return h(agent, *ce) }); err != nil {
 				agent.Logger.WithError(err).Error("Error handling GenericCommentEvent.")
 				s.Metrics.PluginHandleErrors.With(labels).Inc()
 			}
@@ -0,0 +1,238 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/gitlab"
+)
+
+// GitLabPlugins are the plugins that run for GitLab projects. They only use
+// the APIs that the GitHub client of NewGitLabGitHubClient implements.
+var GitLabPlugins = sets.NewString("trigger", "lgtm", "approve", "hold", "label")
+
+// GitLabServer implements http.Handler. It validates incoming GitLab webhooks,
+// translates them to GitHub events and dispatches those to the plugins with
+// the embedded Server. The clients of the Server must talk to GitLab, its
+// TokenGenerator must return the secret token of the GitLab webhooks and its
+// SupportedPlugins must be GitLabPlugins.
+type GitLabServer struct {
+	*Server
+	// Client fetches the merge requests that the webhooks refer to.
+	Client gitlab.Client
+}
+
+// ServeHTTP validates an incoming GitLab webhook and puts it into the event channel.
+func (s *GitLabServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	eventType, eventGUID, payload, ok, resp := gitlab.ValidateWebhook(w, r, s.TokenGenerator)
+	if !ok {
+		s.countResponse(resp)
+		return
+	}
+	l := logrus.WithFields(logrus.Fields{eventTypeField: eventType, github.EventGUID: eventGUID})
+	events, err := gitlab.NormalizeEvent(s.Client, eventType, payload)
+	if errors.Is(err, gitlab.ErrNestedGroup) {
+		l.WithError(err).Warn("Rejected GitLab webhook.")
+		s.countResponse(http.StatusBadRequest)
+		http.Error(w, "400 Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		l.WithError(err).Error("Failed to translate GitLab webhook.")
+		s.countResponse(http.StatusInternalServerError)
+		http.Error(w, "500 Internal Server Error: Failed to translate event", http.StatusInternalServerError)
+		return
+	}
+	s.countResponse(resp)
+
+	var entries []*Delivery
+	for i, event := range events {
+		guid := eventGUID
+		if len(events) > 1 {
+			guid = fmt.Sprintf("%s-%d", eventGUID, i)
+		}
+		// External plugins receive the translated events without a signature.
+		header := http.Header{}
+		header.Set("Content-Type", "application/json")
+		header.Set("X-GitHub-Event", event.Type)
+		header.Set("X-GitHub-Delivery", guid)
+		header.Set("X-Gitlab-Event", eventType)
+		entry := newDelivery(guid, event.Type, event.Payload, header)
+		// Journal the deliveries before acknowledging them so that they survive a restart.
+		if s.Journal != nil {
+			if err := s.Journal.save(r.Context(), entry); err != nil {
+				l.WithError(err).Error("Failed to journal webhook delivery.")
+			}
+		}
+		entries = append(entries, entry)
+	}
+	fmt.Fprint(w, "Event received. Have a nice day.")
+
+	for _, entry := range entries {
+		if err := s.dispatchDelivery(entry); err != nil {
+			l.WithError(err).Error("Error parsing event.")
+		}
+	}
+}
+
+// gitLabGitHubClient adapts a GitLab client to the github.Client of the
+// plugins. It implements the methods that GitLabPlugins use, calling the
+// other methods of the nil github.Client panics.
+type gitLabGitHubClient struct {
+	github.Client
+	gitlab gitlab.Client
+}
+
+// NewGitLabGitHubClient returns a github.Client backed by the GitLab client,
+// for GitLabPlugins.
+func NewGitLabGitHubClient(c gitlab.Client) github.Client {
+	return &gitLabGitHubClient{gitlab: c}
+}
+
+func (c *gitLabGitHubClient) WithFields(fields logrus.Fields) github.Client {
+	return &gitLabGitHubClient{gitlab: c.gitlab.WithFields(fields)}
+}
+
+func (c *gitLabGitHubClient) ForPlugin(plugin string) github.Client {
+	return &gitLabGitHubClient{gitlab: c.gitlab.ForPlugin(plugin)}
+}
+
+func (c *gitLabGitHubClient) ForSubcomponent(subcomponent string) github.Client {
+	return &gitLabGitHubClient{gitlab: c.gitlab.WithFields(logrus.Fields{"subcomponent": subcomponent})}
+}
+
+func (c *gitLabGitHubClient) BotUserChecker() (func(candidate string) bool, error) {
+	return c.gitlab.BotUserChecker()
+}
+
+func (c *gitLabGitHubClient) IsMember(org, user string) (bool, error) {
+	return c.gitlab.IsMember(org, user)
+}
+
+func (c *gitLabGitHubClient) IsCollaborator(org, repo, user string) (bool, error) {
+	return c.gitlab.IsCollaborator(org, repo, user)
+}
+
+func (c *gitLabGitHubClient) ListCollaborators(org, repo string) ([]github.User, error) {
+	return c.gitlab.ListCollaborators(org, repo)
+}
+
+func (c *gitLabGitHubClient) ListTeams(org string) ([]github.Team, error) {
+	return c.gitlab.ListTeams(org)
+}
+
+// GetTeamBySlug looks the subgroup up among the subgroups of the group, for
+// the teams of OWNERS files.
+func (c *gitLabGitHubClient) GetTeamBySlug(slug string, org string) (*github.Team, error) {
+	teams, err := c.gitlab.ListTeams(org)
+	if err != nil {
+		return nil, err
+	}
+	for _, team := range teams {
+		if team.Slug == slug {
+			return &team, nil
+		}
+	}
+	return nil, fmt.Errorf("subgroup %s not found in %s", slug, org)
+}
+
+func (c *gitLabGitHubClient) ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error) {
+	return c.gitlab.ListTeamMembers(org, id, role)
+}
+
+func (c *gitLabGitHubClient) TeamBySlugHasMember(org string, teamSlug string, memberLogin string) (bool, error) {
+	return c.gitlab.TeamBySlugHasMember(org, teamSlug, memberLogin)
+}
+
+func (c *gitLabGitHubClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	return c.gitlab.GetPullRequest(org, repo, number)
+}
+
+func (c *gitLabGitHubClient) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
+	return c.gitlab.GetPullRequestChanges(org, repo, number)
+}
+
+func (c *gitLabGitHubClient) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	return c.gitlab.ListReviews(org, repo, number)
+}
+
+func (c *gitLabGitHubClient) ListPullRequestComments(org, repo string, number int) ([]github.ReviewComment, error) {
+	return c.gitlab.ListPullRequestComments(org, repo, number)
+}
+
+func (c *gitLabGitHubClient) AssignIssue(org, repo string, number int, logins []string) error {
+	return c.gitlab.AssignIssue(org, repo, number, logins)
+}
+
+func (c *gitLabGitHubClient) CreateComment(org, repo string, number int, comment string) error {
+	return c.gitlab.CreateComment(org, repo, number, comment)
+}
+
+func (c *gitLabGitHubClient) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
+	return c.gitlab.ListIssueComments(org, repo, number)
+}
+
+func (c *gitLabGitHubClient) DeleteComment(org, repo string, id int) error {
+	return c.gitlab.DeleteComment(org, repo, id)
+}
+
+func (c *gitLabGitHubClient) DeleteStaleComments(org, repo string, number int, comments []github.IssueComment, isStale func(github.IssueComment) bool) error {
+	return c.gitlab.DeleteStaleComments(org, repo, number, comments, isStale)
+}
+
+func (c *gitLabGitHubClient) GetRepoLabels(org, repo string) ([]github.Label, error) {
+	return c.gitlab.GetRepoLabels(org, repo)
+}
+
+func (c *gitLabGitHubClient) GetIssueLabels(org, repo string, number int) ([]github.Label, error) {
+	return c.gitlab.GetIssueLabels(org, repo, number)
+}
+
+func (c *gitLabGitHubClient) AddLabel(org, repo string, number int, label string) error {
+	return c.gitlab.AddLabel(org, repo, number, label)
+}
+
+func (c *gitLabGitHubClient) RemoveLabel(org, repo string, number int, label string) error {
+	return c.gitlab.RemoveLabel(org, repo, number, label)
+}
+
+func (c *gitLabGitHubClient) WasLabelAddedByHuman(org, repo string, number int, label string) (bool, error) {
+	return c.gitlab.WasLabelAddedByHuman(org, repo, number, label)
+}
+
+func (c *gitLabGitHubClient) GetRef(org, repo, ref string) (string, error) {
+	return c.gitlab.GetRef(org, repo, ref)
+}
+
+func (c *gitLabGitHubClient) GetSingleCommit(org, repo, sha string) (github.RepositoryCommit, error) {
+	return c.gitlab.GetSingleCommit(org, repo, sha)
+}
+
+func (c *gitLabGitHubClient) CreateStatus(org, repo, sha string, status github.Status) error {
+	return c.gitlab.CreateStatus(org, repo, sha, status)
+}
+
+func (c *gitLabGitHubClient) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error) {
+	return c.gitlab.GetCombinedStatus(org, repo, ref)
+}
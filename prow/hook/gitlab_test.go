@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/bugzilla"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/githubeventserver"
+	"k8s.io/test-infra/prow/gitlab"
+	"k8s.io/test-infra/prow/plugins"
+	"k8s.io/test-infra/prow/plugins/ownersconfig"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+type fakeGitLabClient struct {
+	gitlab.Client
+}
+
+func (f *fakeGitLabClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	return &github.PullRequest{Number: number, State: github.PullRequestStateOpen, User: github.User{Login: "author"}}, nil
+}
+
+func (f *fakeGitLabClient) ForPlugin(plugin string) gitlab.Client {
+	return f
+}
+
+func (f *fakeGitLabClient) WithFields(fields logrus.Fields) gitlab.Client {
+	return f
+}
+
+func TestGitLabHook(t *testing.T) {
+	called := make(chan github.GenericCommentEvent, 1)
+	plugins.RegisterGenericCommentHandler("gitlab-comment", func(_ plugins.Agent, e github.GenericCommentEvent) error {
+		called <- e
+		return nil
+	}, nil)
+	plugins.RegisterGenericCommentHandler("gitlab-unsupported", func(_ plugins.Agent, e github.GenericCommentEvent) error {
+		called <- e
+		return nil
+	}, nil)
+	pa := &plugins.ConfigAgent{}
+	pa.Set(&plugins.Configuration{Plugins: plugins.Plugins{"group/repo": {Plugins: []string{"gitlab-comment", "gitlab-unsupported"}}}})
+	client := &fakeGitLabClient{}
+	s := &GitLabServer{
+		Server: &Server{
+			ClientAgent: &plugins.ClientAgent{
+				GitHubClient:   NewGitLabGitHubClient(client),
+				OwnersClient:   repoowners.NewClient(nil, nil, func(org, repo string) bool { return false }, func(org, repo string) bool { return false }, func(org, repo string) bool { return false }, func() *config.OwnersDirDenylist { return &config.OwnersDirDenylist{} }, ownersconfig.FakeResolver),
+				BugzillaClient: &bugzilla.Fake{},
+			},
+			Plugins:          pa,
+			ConfigAgent:      &config.Agent{},
+			Metrics:          githubeventserver.NewMetrics(),
+			RepoEnabled:      func(org, repo string) bool { return true },
+			SupportedPlugins: sets.NewString("gitlab-comment"),
+			TokenGenerator:   func() []byte { return []byte("secret") },
+		},
+		Client: client,
+	}
+	payload := func(project string) string {
+		return `{"user": {"username": "alice"}, "project": {"path_with_namespace": "` + project + `"},
+		"object_attributes": {"id": 7, "note": "/lgtm", "noteable_type": "MergeRequest"}, "merge_request": {"iid": 3}}`
+	}
+
+	for _, tc := range []struct {
+		token, project string
+		expected       int
+	}{
+		{token: "guess", project: "group/repo", expected: http.StatusForbidden},
+		{token: "secret", project: "group/sub/repo", expected: http.StatusBadRequest},
+		{token: "secret", project: "group/repo", expected: http.StatusOK},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hook/gitlab", strings.NewReader(payload(tc.project)))
+		r.Header.Set("X-Gitlab-Event", gitlab.NoteHook)
+		r.Header.Set("X-Gitlab-Token", tc.token)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != tc.expected {
+			t.Fatalf("expected status %d with token %q for %s, got %d", tc.expected, tc.token, tc.project, w.Code)
+		}
+	}
+
+	select {
+	case e := <-called:
+		if e.Repo.Owner.Login != "group" || e.Repo.Name != "repo" || e.Number != 3 || !e.IsPR || e.Body != "/lgtm" || e.User.Login != "alice" {
+			t.Errorf("unexpected generic comment event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("Plugin not called after one second.")
+	}
+	s.GracefulShutdown()
+	select {
+	case e := <-called:
+		t.Errorf("unsupported plugin called with %+v", e)
+	default:
+	}
+}
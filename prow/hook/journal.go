@@ -0,0 +1,404 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"k8s.io/test-infra/prow/github"
+	pkgio "k8s.io/test-infra/prow/io"
+	"k8s.io/test-infra/prow/io/providers"
+)
+
+// DeliveryState is the state of a journaled webhook delivery.
+type DeliveryState string
+
+const (
+	// DeliveryPending means that the handlers of the delivery are running, or
+	// that hook stopped before they completed.
+	DeliveryPending DeliveryState = "pending"
+	// DeliveryFailed means that some handlers of the delivery failed.
+	DeliveryFailed DeliveryState = "failed"
+)
+
+// Delivery is a webhook delivery recorded in the journal.
+type Delivery struct {
+	GUID      string `json:"guid"`
+	EventType string `json:"event_type"`
+	Payload   []byte `json:"payload"`
+	// Header holds the journaledHeaders of the webhook request, which are
+	// forwarded to external plugins when the delivery is replayed.
+	Header   http.Header `json:"header,omitempty"`
+	Received time.Time   `json:"received"`
+
+	State DeliveryState `json:"state"`
+	// FailedHandlers lists the handlers that failed, as <event>/<plugin> for
+	// plugins and external/<plugin> for external plugins. A replay only runs
+	// these handlers.
+	FailedHandlers []string `json:"failed_handlers,omitempty"`
+	// Replays is the number of times the delivery was replayed.
+	Replays int `json:"replays,omitempty"`
+
+	// Updated is when the delivery was last recorded. A pending delivery is
+	// considered to be handled until the lease of the journal expired.
+	Updated time.Time `json:"updated"`
+
+	// header holds all headers of the webhook request, which are forwarded to
+	// external plugins when the delivery is first handled. It isn't journaled
+	// since it contains the signature and possibly credentials of proxies.
+	header http.Header
+}
+
+// journaledHeaders are the headers of webhook requests that are journaled.
+var journaledHeaders = []string{"Content-Type", "X-GitHub-Event", "X-GitHub-Delivery", "X-Gitlab-Event"}
+
+// newDelivery returns a pending delivery of the webhook request.
+func newDelivery(guid, eventType string, payload []byte, header http.Header) *Delivery {
+	journaled := http.Header{}
+	for _, name := range journaledHeaders {
+		if value := header.Get(name); value != "" {
+			journaled.Set(name, value)
+		}
+	}
+	return &Delivery{
+		GUID:      guid,
+		EventType: eventType,
+		Payload:   payload,
+		Header:    journaled,
+		Received:  time.Now(),
+		State:     DeliveryPending,
+		header:    header,
+	}
+}
+
+// forwardedHeader returns the headers to forward to external plugins.
+func (d *Delivery) forwardedHeader() http.Header {
+	if d.header != nil {
+		return d.header
+	}
+	return d.Header.Clone()
+}
+
+// journalStore persists journal entries by name.
+type journalStore interface {
+	write(ctx context.Context, name string, content []byte) error
+	read(ctx context.Context, name string) ([]byte, error)
+	list(ctx context.Context) ([]string, error)
+	delete(ctx context.Context, name string) error
+}
+
+// Journal records webhook deliveries until all their handlers succeed, so
+// that deliveries interrupted by a restart or failed by a transient error can
+// be replayed.
+type Journal struct {
+	store journalStore
+
+	// Lease is how long a pending delivery is considered to be still handled
+	// by the replica that recorded it, or by this replica before it
+	// restarted. It must exceed the time handlers take, retries included.
+	// Pending deliveries are replayed right away if it is zero, which is only
+	// safe with one replica.
+	Lease time.Duration
+	// MaxAge is how long failed deliveries are kept for a replay. They are
+	// kept until they are replayed if it is zero.
+	MaxAge time.Duration
+}
+
+// NewJournal returns a journal that stores deliveries in a local directory, or
+// under a blob storage path like gs://bucket/hook-journal.
+func NewJournal(location string, opener pkgio.Opener) (*Journal, error) {
+	if !strings.Contains(location, "://") {
+		if err := os.MkdirAll(location, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create journal directory: %w", err)
+		}
+		return &Journal{store: diskStore{dir: location}}, nil
+	}
+	if _, _, _, err := providers.ParseStoragePath(location); err != nil {
+		return nil, err
+	}
+	return &Journal{store: openerStore{opener: opener, prefix: strings.TrimSuffix(location, "/") + "/"}}, nil
+}
+
+func deliveryFile(guid string) string {
+	return guid + ".json"
+}
+
+func (j *Journal) save(ctx context.Context, d *Delivery) error {
+	d.Updated = time.Now()
+	content, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return j.store.write(ctx, deliveryFile(d.GUID), content)
+}
+
+// Get returns the delivery with the given GUID.
+func (j *Journal) Get(ctx context.Context, guid string) (*Delivery, error) {
+	if strings.ContainsAny(guid, `/\`) || guid == "" {
+		return nil, fmt.Errorf("invalid delivery GUID %q", guid)
+	}
+	content, err := j.store.read(ctx, deliveryFile(guid))
+	if err != nil {
+		return nil, err
+	}
+	var d Delivery
+	if err := json.Unmarshal(content, &d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal delivery %s: %w", guid, err)
+	}
+	return &d, nil
+}
+
+// List returns the journaled deliveries, oldest first.
+func (j *Journal) List(ctx context.Context) ([]*Delivery, error) {
+	names, err := j.store.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []*Delivery
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		d, err := j.Get(ctx, strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			if pkgio.IsNotExist(err) {
+				// Completed while we were listing.
+				continue
+			}
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	sort.SliceStable(deliveries, func(i, k int) bool { return deliveries[i].Received.Before(deliveries[k].Received) })
+	return deliveries, nil
+}
+
+// interrupted returns whether the handlers of the pending delivery were
+// interrupted, i.e. whether its lease expired. Replicas get a new identity
+// when they restart, so this is also the case for the deliveries a replica
+// was handling before it restarted.
+func (j *Journal) interrupted(d *Delivery) bool {
+	return d.State == DeliveryPending && time.Since(d.Updated) > j.Lease
+}
+
+// Prune removes the failed deliveries that were received longer than MaxAge
+// ago.
+func (j *Journal) Prune(ctx context.Context) error {
+	if j.MaxAge == 0 {
+		return nil
+	}
+	deliveries, err := j.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list journaled deliveries: %w", err)
+	}
+	var errs []error
+	for _, d := range deliveries {
+		if d.State != DeliveryFailed || time.Since(d.Received) <= j.MaxAge {
+			continue
+		}
+		if err := j.store.delete(ctx, deliveryFile(d.GUID)); err != nil && !pkgio.IsNotExist(err) {
+			errs = append(errs, err)
+			continue
+		}
+		logrus.WithField(github.EventGUID, d.GUID).Info("Pruned failed webhook delivery.")
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// complete records the outcome of the handlers of the delivery. Deliveries
+// whose handlers all succeeded are removed from the journal.
+func (j *Journal) complete(ctx context.Context, d *Delivery, failed []string) error {
+	if len(failed) == 0 {
+		if err := j.store.delete(ctx, deliveryFile(d.GUID)); err != nil && !pkgio.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sort.Strings(failed)
+	d.State = DeliveryFailed
+	d.FailedHandlers = failed
+	return j.save(ctx, d)
+}
+
+// diskStore stores journal entries as files in a local directory.
+type diskStore struct {
+	dir string
+}
+
+func (s diskStore) write(_ context.Context, name string, content []byte) error {
+	// Write to a temporary file first so that a crash never leaves a partial entry.
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s diskStore) read(_ context.Context, name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.dir, name))
+}
+
+func (s diskStore) list(_ context.Context) ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if !info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s diskStore) delete(_ context.Context, name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+// openerStore stores journal entries as objects under a blob storage prefix.
+type openerStore struct {
+	opener pkgio.Opener
+	prefix string
+}
+
+func (s openerStore) write(ctx context.Context, name string, content []byte) error {
+	w, err := s.opener.Writer(ctx, s.prefix+name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s openerStore) read(ctx context.Context, name string) ([]byte, error) {
+	r, err := s.opener.Reader(ctx, s.prefix+name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (s openerStore) list(ctx context.Context) ([]string, error) {
+	it, err := s.opener.Iterator(ctx, s.prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		attrs, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !attrs.IsDir {
+			names = append(names, path.Base(attrs.Name))
+		}
+	}
+	return names, nil
+}
+
+func (s openerStore) delete(ctx context.Context, name string) error {
+	return s.opener.Delete(ctx, s.prefix+name)
+}
+
+// AdminHandler serves the journal: GET /deliveries lists the journaled
+// deliveries, optionally filtered with ?state=failed, and
+// POST /deliveries/replay?guid=<GUID> replays a failed delivery. It must not
+// be exposed publicly since it doesn't authenticate requests.
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deliveries, err := s.Journal.List(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to list deliveries: %v", err), http.StatusInternalServerError)
+			return
+		}
+		state := DeliveryState(r.URL.Query().Get("state"))
+		summaries := []Delivery{}
+		for _, d := range deliveries {
+			if state != "" && d.State != state {
+				continue
+			}
+			summary := *d
+			summary.Payload, summary.Header = nil, nil
+			summaries = append(summaries, summary)
+		}
+		writeJSON(w, http.StatusOK, summaries)
+	})
+	mux.HandleFunc("/deliveries/replay", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		guid := r.URL.Query().Get("guid")
+		entry, err := s.Replay(r.Context(), guid)
+		if err != nil {
+			code := http.StatusBadRequest
+			if pkgio.IsNotExist(err) {
+				code = http.StatusNotFound
+			}
+			http.Error(w, fmt.Sprintf("failed to replay delivery %q: %v", guid, err), code)
+			return
+		}
+		summary := *entry
+		summary.Payload, summary.Header = nil, nil
+		writeJSON(w, http.StatusAccepted, summary)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/bugzilla"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/githubeventserver"
+	"k8s.io/test-infra/prow/phony"
+	"k8s.io/test-infra/prow/plugins"
+	"k8s.io/test-infra/prow/plugins/ownersconfig"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v.", err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := NewJournal(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v.", err)
+	}
+	ctx := context.Background()
+
+	older := &Delivery{GUID: "older", EventType: "push", Payload: []byte(`{}`), Received: time.Unix(100, 0), State: DeliveryPending}
+	newer := &Delivery{GUID: "newer", EventType: "push", Payload: []byte(`{}`), Received: time.Unix(200, 0), State: DeliveryPending}
+	for _, d := range []*Delivery{newer, older} {
+		if err := j.save(ctx, d); err != nil {
+			t.Fatalf("Failed to save delivery: %v.", err)
+		}
+	}
+	if err := j.complete(ctx, newer, []string{"PushEvent/b", "external/a"}); err != nil {
+		t.Fatalf("Failed to complete delivery: %v.", err)
+	}
+	if err := j.complete(ctx, older, nil); err != nil {
+		t.Fatalf("Failed to complete delivery: %v.", err)
+	}
+
+	deliveries, err := j.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list deliveries: %v.", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].GUID != "newer" {
+		t.Fatalf("Expected only the failed delivery to be journaled, got %v.", deliveries)
+	}
+	if deliveries[0].State != DeliveryFailed || !reflect.DeepEqual(deliveries[0].FailedHandlers, []string{"PushEvent/b", "external/a"}) {
+		t.Errorf("Expected the failed handlers to be recorded, got %+v.", deliveries[0])
+	}
+	if _, err := j.Get(ctx, "../newer"); err == nil {
+		t.Error("Expected an error for an invalid GUID.")
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	var okCalls, flakyCalls, flakyFailures int32
+	plugins.RegisterPushEventHandler("journal-ok", func(_ plugins.Agent, _ github.PushEvent) error {
+		atomic.AddInt32(&okCalls, 1)
+		return nil
+	}, nil)
+	plugins.RegisterPushEventHandler("journal-flaky", func(_ plugins.Agent, _ github.PushEvent) error {
+		atomic.AddInt32(&flakyCalls, 1)
+		if atomic.AddInt32(&flakyFailures, -1) >= 0 {
+			return errors.New("transient error")
+		}
+		return nil
+	}, nil)
+
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v.", err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := NewJournal(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v.", err)
+	}
+	pa := &plugins.ConfigAgent{}
+	pa.Set(&plugins.Configuration{Plugins: plugins.Plugins{"foo/bar": {Plugins: []string{"journal-ok", "journal-flaky"}}}})
+	s := &Server{
+		ClientAgent: &plugins.ClientAgent{
+			GitHubClient:   github.NewFakeClient(),
+			OwnersClient:   repoowners.NewClient(nil, nil, func(org, repo string) bool { return false }, func(org, repo string) bool { return false }, func(org, repo string) bool { return false }, func() *config.OwnersDirDenylist { return &config.OwnersDirDenylist{} }, ownersconfig.FakeResolver),
+			BugzillaClient: &bugzilla.Fake{},
+		},
+		Plugins:        pa,
+		ConfigAgent:    &config.Agent{},
+		Metrics:        githubeventserver.NewMetrics(),
+		RepoEnabled:    func(org, repo string) bool { return true },
+		TokenGenerator: func() []byte { return []byte(globalSecret) },
+		Journal:        j,
+		HandlerRetries: 1,
+		HandlerBackoff: time.Millisecond,
+	}
+	payload, err := json.Marshal(github.PushEvent{Repo: github.Repo{Owner: github.User{Name: "foo"}, Name: "bar", FullName: "foo/bar"}})
+	if err != nil {
+		t.Fatalf("Failed to marshal push event: %v.", err)
+	}
+	ctx := context.Background()
+
+	// The flaky handler fails once more than it is retried.
+	atomic.StoreInt32(&flakyFailures, 2)
+	hookServer := httptest.NewServer(s)
+	defer hookServer.Close()
+	if err := phony.SendHook(hookServer.URL, "push", payload, []byte("123abc")); err != nil {
+		t.Fatalf("Error sending hook: %v.", err)
+	}
+	// Wait for the handlers without shutting down, which stops the retries.
+	s.wg.Wait()
+	if okCalls != 1 || flakyCalls != 2 {
+		t.Errorf("Expected the handlers to be called once and twice, got %d and %d.", okCalls, flakyCalls)
+	}
+
+	// Only the headers needed for a replay are journaled, not the signature.
+	journaled, err := j.Get(ctx, "GUID")
+	if err != nil {
+		t.Fatalf("Failed to get the failed delivery: %v.", err)
+	}
+	if journaled.Header.Get("X-GitHub-Event") != "push" || journaled.Header.Get("X-Hub-Signature") != "" {
+		t.Errorf("Expected only the journaled headers to be recorded, got %v.", journaled.Header)
+	}
+
+	admin := s.AdminHandler()
+	rr := httptest.NewRecorder()
+	admin.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/deliveries?state=failed", nil))
+	var listed []Delivery
+	if err := json.Unmarshal(rr.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("Failed to unmarshal the deliveries: %v, body: %s.", err, rr.Body.String())
+	}
+	if len(listed) != 1 || listed[0].GUID != "GUID" || !reflect.DeepEqual(listed[0].FailedHandlers, []string{"PushEvent/journal-flaky"}) || listed[0].Payload != nil {
+		t.Fatalf("Expected the failed delivery to be listed without its payload, got %+v.", listed)
+	}
+
+	// Replaying the delivery only runs the failed handler.
+	rr = httptest.NewRecorder()
+	admin.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/deliveries/replay?guid=GUID", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected the replay to be accepted, got %d: %s.", rr.Code, rr.Body.String())
+	}
+	s.wg.Wait()
+	if okCalls != 1 || flakyCalls != 3 {
+		t.Errorf("Expected only the failed handler to be replayed, got %d and %d calls.", okCalls, flakyCalls)
+	}
+	if deliveries, err := j.List(ctx); err != nil || len(deliveries) != 0 {
+		t.Errorf("Expected the replayed delivery to be removed from the journal, got %v (error: %v).", deliveries, err)
+	}
+	rr = httptest.NewRecorder()
+	admin.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/deliveries/replay?guid=GUID", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected replaying a missing delivery to fail with %d, got %d.", http.StatusNotFound, rr.Code)
+	}
+
+	// Deliveries interrupted by a restart are replayed once their lease
+	// expired.
+	j.Lease = time.Hour
+	record := func(d *Delivery) {
+		content, err := json.Marshal(d)
+		if err != nil {
+			t.Fatalf("Failed to marshal delivery: %v.", err)
+		}
+		if err := j.store.write(ctx, deliveryFile(d.GUID), content); err != nil {
+			t.Fatalf("Failed to save delivery: %v.", err)
+		}
+	}
+	record(&Delivery{GUID: "expired", EventType: "push", Payload: payload, State: DeliveryPending, Updated: time.Now().Add(-2 * time.Hour)})
+	record(&Delivery{GUID: "leased", EventType: "push", Payload: payload, State: DeliveryPending, Updated: time.Now()})
+	if err := s.ReplayPending(ctx); err != nil {
+		t.Fatalf("Failed to replay pending deliveries: %v.", err)
+	}
+	s.wg.Wait()
+	if okCalls != 2 || flakyCalls != 4 {
+		t.Errorf("Expected all the handlers to be replayed, got %d and %d calls.", okCalls, flakyCalls)
+	}
+	if deliveries, err := j.List(ctx); err != nil || len(deliveries) != 1 || deliveries[0].GUID != "leased" {
+		t.Errorf("Expected only the leased delivery to be left in the journal, got %v (error: %v).", deliveries, err)
+	}
+
+	// Failed deliveries are pruned once they are older than the max age.
+	j.MaxAge = 24 * time.Hour
+	record(&Delivery{GUID: "old", EventType: "push", Payload: payload, State: DeliveryFailed, Received: time.Now().Add(-48 * time.Hour)})
+	record(&Delivery{GUID: "recent", EventType: "push", Payload: payload, State: DeliveryFailed, Received: time.Now().Add(-time.Hour)})
+	if err := j.Prune(ctx); err != nil {
+		t.Fatalf("Failed to prune the journal: %v.", err)
+	}
+	deliveries, err := j.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list deliveries: %v.", err)
+	}
+	var guids []string
+	for _, d := range deliveries {
+		guids = append(guids, d.GUID)
+	}
+	if expected := []string{"leased", "recent"}; !reflect.DeepEqual(expected, guids) {
+		t.Errorf("Expected the deliveries %v to be left in the journal, got %v.", expected, guids)
+	}
+}
+
+func TestRunHandlerStopsRetryingOnShutdown(t *testing.T) {
+	s := &Server{HandlerRetries: 1, HandlerBackoff: time.Hour}
+	d := &delivery{}
+	s.startHandler(d)
+	go func() {
+		defer s.finishHandler(d)
+		s.runHandler(d, "PushEvent/flaky", func() error { return errors.New("transient error") })
+	}()
+	done := make(chan struct{})
+	go func() {
+		s.GracefulShutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("Expected the shutdown not to wait for the retry.")
+	}
+	if expected := []string{"PushEvent/flaky"}; !reflect.DeepEqual(expected, d.failed) {
+		t.Errorf("Expected the handler to be recorded as failed, got %v.", d.failed)
+	}
+}
@@ -18,7 +18,9 @@ package hook
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -28,6 +30,8 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
@@ -45,36 +49,249 @@ type Server struct {
 	TokenGenerator func() []byte
 	Metrics        *githubeventserver.Metrics
 	RepoEnabled    func(org, repo string) bool
+	// SupportedPlugins are the only plugins whose handlers run, if set. The
+	// handlers of the other plugins fail with plugins.ErrUnsupported.
+	// External plugins are always supported.
+	SupportedPlugins sets.String
+
+	// Journal records the deliveries until all their handlers succeed, so
+	// that they can be replayed. Deliveries are not recorded if it is nil.
+	Journal *Journal
+	// HandlerRetries is the number of times a failed plugin handler is retried.
+	HandlerRetries int
+	// HandlerBackoff is the time to wait before the first retry of a failed
+	// plugin handler. It doubles with each retry, up to maxHandlerBackoff.
+	HandlerBackoff time.Duration
 
 	// c is an http client used for dispatching events
 	// to external plugin services.
 	c http.Client
 	// Tracks running handlers for graceful shutdown
 	wg sync.WaitGroup
+	// inflight are the GUIDs of the journaled deliveries whose handlers are
+	// running, which must not be replayed.
+	inflightLock sync.Mutex
+	inflight     sets.String
+	// shutdown is closed when the server shuts down, to stop waiting to
+	// retry failed handlers.
+	shutdownOnce sync.Once
+	shutdownDone sync.Once
+	shutdown     chan struct{}
 }
 
+// maxHandlerBackoff caps the time to wait between the retries of a failed
+// plugin handler.
+const maxHandlerBackoff = time.Minute
+
 // ServeHTTP validates an incoming webhook and puts it into the event channel.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	eventType, eventGUID, payload, ok, resp := github.ValidateWebhook(w, r, s.TokenGenerator)
-	if counter, err := s.Metrics.ResponseCounter.GetMetricWithLabelValues(strconv.Itoa(resp)); err != nil {
+	s.countResponse(resp)
+	if !ok {
+		return
+	}
+	entry := newDelivery(eventGUID, eventType, payload, r.Header)
+	// Journal the delivery before acknowledging it so that it survives a restart.
+	if s.Journal != nil {
+		if err := s.Journal.save(r.Context(), entry); err != nil {
+			logrus.WithError(err).WithField(github.EventGUID, eventGUID).Error("Failed to journal webhook delivery.")
+		}
+	}
+	fmt.Fprint(w, "Event received. Have a nice day.")
+
+	if err := s.dispatchDelivery(entry); err != nil {
+		logrus.WithError(err).Error("Error parsing event.")
+	}
+}
+
+func (s *Server) countResponse(code int) {
+	if counter, err := s.Metrics.ResponseCounter.GetMetricWithLabelValues(strconv.Itoa(code)); err != nil {
 		logrus.WithFields(logrus.Fields{
-			"status-code": resp,
+			"status-code": code,
 		}).WithError(err).Error("Failed to get metric for reporting webhook status code")
 	} else {
 		counter.Inc()
 	}
+}
 
-	if !ok {
-		return
+// delivery tracks the handlers that run for a webhook delivery.
+type delivery struct {
+	// only restricts the handlers that run, all handlers run if it is nil.
+	only sets.String
+
+	wg     sync.WaitGroup
+	lock   sync.Mutex
+	failed []string
+}
+
+func handlerName(event, plugin string) string {
+	return event + "/" + plugin
+}
+
+func (d *delivery) shouldRun(handler string) bool {
+	return d.only == nil || d.only.Has(handler)
+}
+
+func (d *delivery) fail(handler string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.failed = append(d.failed, handler)
+}
+
+// startHandler and finishHandler track the handlers of a delivery for the
+// journal and for the graceful shutdown.
+func (s *Server) startHandler(d *delivery) {
+	s.wg.Add(1)
+	d.wg.Add(1)
+}
+
+func (s *Server) finishHandler(d *delivery) {
+	d.wg.Done()
+	s.wg.Done()
+}
+
+// runHandler runs a handler of the delivery, retrying it with exponential
+// backoff while it fails. The handler is recorded as failed if it never
+// succeeds, or if the server shuts down while it waits to retry it.
+func (s *Server) runHandler(d *delivery, handler string, f func() error) error {
+	backoff := wait.Backoff{Duration: s.HandlerBackoff, Factor: 2, Steps: s.HandlerRetries, Cap: maxHandlerBackoff}
+	var err error
+	if s.supports(handler) {
+		err = errorOnPanic(f)
+	} else {
+		err = fmt.Errorf("plugin %s: %w", strings.SplitN(handler, "/", 2)[1], plugins.ErrUnsupported)
 	}
-	fmt.Fprint(w, "Event received. Have a nice day.")
+	// Retrying doesn't help with what the provider doesn't support.
+	for retry := 0; err != nil && !errors.Is(err, plugins.ErrUnsupported) && retry < s.HandlerRetries; retry++ {
+		if !s.waitToRetry(backoff.Step()) {
+			break
+		}
+		err = errorOnPanic(f)
+	}
+	if err != nil {
+		d.fail(handler)
+	}
+	return err
+}
 
-	if err := s.demuxEvent(eventType, eventGUID, payload, r.Header); err != nil {
-		logrus.WithError(err).Error("Error parsing event.")
+// supports returns whether the plugin of the handler runs for the deliveries
+// of the server.
+func (s *Server) supports(handler string) bool {
+	parts := strings.SplitN(handler, "/", 2)
+	return s.SupportedPlugins == nil || parts[0] == "external" || s.SupportedPlugins.Has(parts[1])
+}
+
+// waitToRetry waits for the backoff and returns whether the server is still
+// running. A failed handler is left to the journal rather than holding up
+// the shutdown.
+func (s *Server) waitToRetry(backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.shuttingDown():
+		return false
+	}
+}
+
+func (s *Server) shuttingDown() chan struct{} {
+	s.shutdownOnce.Do(func() { s.shutdown = make(chan struct{}) })
+	return s.shutdown
+}
+
+// dispatchDelivery runs the handlers of the journal entry, or only those that
+// failed previously, and records their outcome in the journal once they all
+// completed.
+func (s *Server) dispatchDelivery(entry *Delivery) error {
+	d := &delivery{}
+	if len(entry.FailedHandlers) > 0 {
+		d.only = sets.NewString(entry.FailedHandlers...)
+	}
+	if s.Journal != nil {
+		s.setInflight(entry.GUID, true)
+	}
+	err := s.demuxEvent(d, entry.EventType, entry.GUID, entry.Payload, entry.forwardedHeader())
+	if s.Journal == nil {
+		return err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		d.wg.Wait()
+		if err := s.Journal.complete(context.Background(), entry, d.failed); err != nil {
+			logrus.WithError(err).WithField(github.EventGUID, entry.GUID).Error("Failed to record webhook delivery in the journal.")
+		}
+		s.setInflight(entry.GUID, false)
+	}()
+	return err
+}
+
+func (s *Server) setInflight(guid string, inflight bool) {
+	s.inflightLock.Lock()
+	defer s.inflightLock.Unlock()
+	if s.inflight == nil {
+		s.inflight = sets.NewString()
+	}
+	if inflight {
+		s.inflight.Insert(guid)
+	} else {
+		s.inflight.Delete(guid)
+	}
+}
+
+func (s *Server) isInflight(guid string) bool {
+	s.inflightLock.Lock()
+	defer s.inflightLock.Unlock()
+	return s.inflight.Has(guid)
+}
+
+// ReplayPending replays the journaled deliveries whose handlers didn't
+// complete because the replica handling them stopped, i.e. those whose lease
+// expired. All their handlers run again.
+func (s *Server) ReplayPending(ctx context.Context) error {
+	deliveries, err := s.Journal.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list journaled deliveries: %w", err)
+	}
+	for _, entry := range deliveries {
+		if !s.Journal.interrupted(entry) || s.isInflight(entry.GUID) {
+			continue
+		}
+		// Claim the delivery so that other replicas leave it alone.
+		if err := s.Journal.save(ctx, entry); err != nil {
+			logrus.WithError(err).WithField(github.EventGUID, entry.GUID).Error("Failed to claim interrupted webhook delivery.")
+			continue
+		}
+		logrus.WithFields(logrus.Fields{github.EventGUID: entry.GUID, eventTypeField: entry.EventType}).Info("Replaying interrupted webhook delivery.")
+		if err := s.dispatchDelivery(entry); err != nil {
+			logrus.WithError(err).Error("Error parsing event.")
+		}
 	}
+	return nil
 }
 
-func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.Header) error {
+// Replay runs the handlers that failed for the journaled delivery again.
+func (s *Server) Replay(ctx context.Context, guid string) (*Delivery, error) {
+	entry, err := s.Journal.Get(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+	if entry.State != DeliveryFailed {
+		return nil, fmt.Errorf("delivery %s is %s, only failed deliveries can be replayed", guid, entry.State)
+	}
+	entry.State = DeliveryPending
+	entry.Replays++
+	if err := s.Journal.save(ctx, entry); err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{github.EventGUID: entry.GUID, eventTypeField: entry.EventType}).Info("Replaying failed webhook delivery.")
+	// The entry is updated once the handlers complete, so return a copy.
+	replayed := *entry
+	return &replayed, s.dispatchDelivery(entry)
+}
+
+func (s *Server) demuxEvent(d *delivery, eventType, eventGUID string, payload []byte, h http.Header) error {
 	l := logrus.WithFields(
 		logrus.Fields{
 			eventTypeField:   eventType,
@@ -97,8 +314,8 @@ func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.
 		i.GUID = eventGUID
 		srcRepo = i.Repo.FullName
 		if s.RepoEnabled(i.Repo.Owner.Login, i.Repo.Name) {
-			s.wg.Add(1)
-			go s.handleIssueEvent(l, i)
+			s.startHandler(d)
+			go s.handleIssueEvent(l, d, i)
 		}
 	case "issue_comment":
 		var ic github.IssueCommentEvent
@@ -108,8 +325,8 @@ func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.
 		ic.GUID = eventGUID
 		srcRepo = ic.Repo.FullName
 		if s.RepoEnabled(ic.Repo.Owner.Login, ic.Repo.Name) {
-			s.wg.Add(1)
-			go s.handleIssueCommentEvent(l, ic)
+			s.startHandler(d)
+			go s.handleIssueCommentEvent(l, d, ic)
 		}
 	case "pull_request":
 		var pr github.PullRequestEvent
@@ -119,8 +336,8 @@ func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.
 		pr.GUID = eventGUID
 		srcRepo = pr.Repo.FullName
 		if s.RepoEnabled(pr.Repo.Owner.Login, pr.Repo.Name) {
-			s.wg.Add(1)
-			go s.handlePullRequestEvent(l, pr)
+			s.startHandler(d)
+			go s.handlePullRequestEvent(l, d, pr)
 		}
 	case "pull_request_review":
 		var re github.ReviewEvent
@@ -130,8 +347,8 @@ func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.
 		re.GUID = eventGUID
 		srcRepo = re.Repo.FullName
 		if s.RepoEnabled(re.Repo.Owner.Login, re.Repo.Name) {
-			s.wg.Add(1)
-			go s.handleReviewEvent(l, re)
+			s.startHandler(d)
+			go s.handleReviewEvent(l, d, re)
 		}
 	case "pull_request_review_comment":
 		var rce github.ReviewCommentEvent
@@ -141,8 +358,8 @@ func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.
 		rce.GUID = eventGUID
 		srcRepo = rce.Repo.FullName
 		if s.RepoEnabled(rce.Repo.Owner.Login, rce.Repo.Name) {
-			s.wg.Add(1)
-			go s.handleReviewCommentEvent(l, rce)
+			s.startHandler(d)
+			go s.handleReviewCommentEvent(l, d, rce)
 		}
 	case "push":
 		var pe github.PushEvent
@@ -152,8 +369,8 @@ func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.
 		pe.GUID = eventGUID
 		srcRepo = pe.Repo.FullName
 		if s.RepoEnabled(pe.Repo.Owner.Login, pe.Repo.Name) {
-			s.wg.Add(1)
-			go s.handlePushEvent(l, pe)
+			s.startHandler(d)
+			go s.handlePushEvent(l, d, pe)
 		}
 	case "status":
 		var se github.StatusEvent
@@ -163,15 +380,15 @@ func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.
 		se.GUID = eventGUID
 		srcRepo = se.Repo.FullName
 		if s.RepoEnabled(se.Repo.Owner.Login, se.Repo.Name) {
-			s.wg.Add(1)
-			go s.handleStatusEvent(l, se)
+			s.startHandler(d)
+			go s.handleStatusEvent(l, d, se)
 		}
 	default:
 		l.Debug("Ignoring unhandled event type. (Might still be handled by external plugins.)")
 	}
 	// Demux events only to external plugins that require this event.
 	if external := s.needDemux(eventType, srcRepo); len(external) > 0 {
-		go s.demuxExternal(l, external, payload, h)
+		s.demuxExternal(l, d, external, payload, h)
 	}
 	return nil
 }
@@ -215,13 +432,16 @@ func (s *Server) needDemux(eventType, orgRepo string) []plugins.ExternalPlugin {
 }
 
 // demuxExternal dispatches the provided payload to the external plugins.
-func (s *Server) demuxExternal(l *logrus.Entry, externalPlugins []plugins.ExternalPlugin, payload []byte, h http.Header) {
+func (s *Server) demuxExternal(l *logrus.Entry, d *delivery, externalPlugins []plugins.ExternalPlugin, payload []byte, h http.Header) {
 	h.Set("User-Agent", "ProwHook")
 	for _, p := range externalPlugins {
-		s.wg.Add(1)
+		if !d.shouldRun(handlerName("external", p.Name)) {
+			continue
+		}
+		s.startHandler(d)
 		go func(p plugins.ExternalPlugin) {
-			defer s.wg.Done()
-			if err := s.dispatch(p.Endpoint, payload, h); err != nil {
+			defer s.finishHandler(d)
+			if err := s.runHandler(d, handlerName("external", p.Name), func() error { return s.dispatch(p.Endpoint, payload, h) }); err != nil {
 				l.WithError(err).WithField("external-plugin", p.Name).Error("Error dispatching event to external plugin.")
 			} else {
 				l.WithField("external-plugin", p.Name).Info("Dispatched event to external plugin")
@@ -256,13 +476,15 @@ func (s *Server) dispatch(endpoint string, payload []byte, h http.Header) error
 // GracefulShutdown implements a graceful shutdown protocol. It handles all requests sent before
 // receiving the shutdown signal.
 func (s *Server) GracefulShutdown() {
+	// Stop waiting to retry failed handlers
+	s.shutdownDone.Do(func() { close(s.shuttingDown()) })
 	s.wg.Wait() // Handle remaining requests
 }
 
 func (s *Server) do(req *http.Request) (*http.Response, error) {
 	var resp *http.Response
 	var err error
-	backoff := 100 * time.Millisecond
+	backoff := wait.Backoff{Duration: 100 * time.Millisecond, Factor: 2, Steps: 5, Cap: maxHandlerBackoff}
 	maxRetries := 5
 
 	for retries := 0; retries < maxRetries; retries++ {
@@ -270,8 +492,7 @@ func (s *Server) do(req *http.Request) (*http.Response, error) {
 		if err == nil {
 			break
 		}
-		time.Sleep(backoff)
-		backoff *= 2
+		time.Sleep(backoff.Step())
 	}
 	return resp, err
 }
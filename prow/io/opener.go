@@ -71,6 +71,7 @@ type Opener interface {
 	Attributes(ctx context.Context, path string) (Attributes, error)
 	SignedURL(ctx context.Context, path string, opts SignedURLOptions) (string, error)
 	Iterator(ctx context.Context, prefix, delimiter string) (ObjectIterator, error)
+	Delete(ctx context.Context, path string) error
 }
 
 type opener struct {
@@ -303,6 +304,26 @@ func (o *opener) Writer(ctx context.Context, p string, opts ...WriterOptions) (i
 	return writer, nil
 }
 
+// Delete removes the path, returning an IsNotExist() error when missing
+func (o *opener) Delete(ctx context.Context, p string) error {
+	if strings.HasPrefix(p, providers.GS+"://") {
+		g, err := o.openGCS(p)
+		if err != nil {
+			return fmt.Errorf("bad gcs path: %w", err)
+		}
+		return g.Delete(ctx)
+	}
+	if strings.HasPrefix(p, "/") {
+		return os.Remove(p)
+	}
+
+	bucket, relativePath, err := o.getBucket(ctx, p)
+	if err != nil {
+		return err
+	}
+	return bucket.Delete(ctx, relativePath)
+}
+
 func (o *opener) Attributes(ctx context.Context, path string) (Attributes, error) {
 	if strings.HasPrefix(path, providers.GS+"://") {
 		g, err := o.openGCS(path)
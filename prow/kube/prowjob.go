@@ -46,6 +46,10 @@ const (
 	// job names can be arbitrarily long, this is added as
 	// an annotation instead of a label.
 	ContextAnnotation = "prow.k8s.io/context"
+	// ParametersAnnotation is added to ProwJobs of presubmits that declare
+	// parameters and carries the JSON object of the parameter values
+	// that the job was triggered with.
+	ParametersAnnotation = "prow.k8s.io/parameters"
 	// PlankVersionLabel is added in resources created by prow and
 	// carries the version of prow that decorated this job.
 	PlankVersionLabel = "prow.k8s.io/plank-version"
@@ -63,6 +67,10 @@ const (
 	PullLabel = "prow.k8s.io/refs.pull"
 	// RetestLabel exposes if the job was created by a re-test request.
 	RetestLabel = "prow.k8s.io/retest"
+	// AutoRetestLabel is added to ProwJobs that were created by an automatic
+	// retest of a flaky presubmit and carries the number of automatic retests
+	// of the presubmit for the same commit, eg 2.
+	AutoRetestLabel = "prow.k8s.io/auto-retest"
 	// IsOptionalLabel is added in resources created by prow and
 	// carries the Optional from a Presubmit job.
 	IsOptionalLabel = "prow.k8s.io/is-optional"
@@ -0,0 +1,369 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lifecycle ages inactive issues and PRs according to the lifecycle
+// policies of the plugin config: they are marked as stale, then as rotten and
+// are eventually closed, with the labels of the lifecycle plugin.
+package lifecycle
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/labels"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// State is the lifecycle state of an issue or PR.
+type State string
+
+const (
+	// Fresh issues and PRs have no lifecycle label.
+	Fresh State = "fresh"
+	// Stale issues and PRs are labeled lifecycle/stale.
+	Stale State = "stale"
+	// Rotten issues and PRs are labeled lifecycle/rotten.
+	Rotten State = "rotten"
+	// Closed issues and PRs were closed because they rotted.
+	Closed State = "closed"
+)
+
+// lifecycleTransitions provides the 'lifecycle_transitions_total' counter of
+// the transitions that were applied, or that would have been in dry-run mode.
+var lifecycleTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "lifecycle_transitions_total",
+	Help: "Number of issues and PRs whose lifecycle state was changed, or would have been changed in dry-run mode.",
+}, []string{"org", "repo", "to", "dry_run"})
+
+func init() {
+	prometheus.MustRegister(lifecycleTransitions)
+}
+
+// alwaysExempt are the lifecycle labels of the issues and PRs that never age.
+var alwaysExempt = []string{labels.LifecycleFrozen, labels.LifecycleActive}
+
+type githubClient interface {
+	FindIssues(query, sort string, asc bool) ([]github.Issue, error)
+	AddLabel(org, repo string, number int, label string) error
+	RemoveLabel(org, repo string, number int, label string) error
+	CreateComment(org, repo string, number int, comment string) error
+	CloseIssue(org, repo string, number int) error
+	ClosePR(org, repo string, number int) error
+}
+
+// Transition is the change of the lifecycle state of an issue or PR.
+type Transition struct {
+	Org         string `json:"org"`
+	Repo        string `json:"repo"`
+	Number      int    `json:"number"`
+	URL         string `json:"url"`
+	PullRequest bool   `json:"pull_request"`
+	From        State  `json:"from"`
+	To          State  `json:"to"`
+}
+
+// Controller applies the lifecycle transitions of the issues and PRs that
+// have been inactive for long enough.
+type Controller struct {
+	ghc    githubClient
+	config func() *plugins.Configuration
+	dryRun bool
+	now    func() time.Time
+	logger *logrus.Entry
+}
+
+// NewController returns a Controller. In dry-run mode, the transitions are
+// only reported.
+func NewController(ghc githubClient, config func() *plugins.Configuration, dryRun bool) *Controller {
+	return &Controller{
+		ghc:    ghc,
+		config: config,
+		dryRun: dryRun,
+		now:    time.Now,
+		logger: logrus.WithField("component", "lifecycle-controller"),
+	}
+}
+
+// Sync applies the transitions of all the configured orgs and repos and
+// returns them. The transitions of an issue or PR that fail are logged and
+// not returned.
+func (c *Controller) Sync() ([]Transition, error) {
+	cfg := c.config()
+	// Repos that have their own policy are excluded from the policy of their org.
+	repos := map[string][]string{}
+	for _, policy := range cfg.Lifecycle {
+		for _, repo := range policy.Repos {
+			if parts := strings.SplitN(repo, "/", 2); len(parts) == 2 {
+				repos[parts[0]] = append(repos[parts[0]], repo)
+			}
+		}
+	}
+
+	var transitions []Transition
+	var errs []error
+	for _, policy := range cfg.Lifecycle {
+		for _, scope := range policy.Repos {
+			var excluded []string
+			if !strings.Contains(scope, "/") {
+				excluded = repos[scope]
+			}
+			applied, err := c.syncScope(policy, scope, excluded)
+			transitions = append(transitions, applied...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to sync %s: %w", scope, err))
+			}
+		}
+	}
+	c.report(transitions)
+	return transitions, utilerrors.NewAggregate(errs)
+}
+
+func (c *Controller) syncScope(policy plugins.Lifecycle, scope string, excluded []string) ([]Transition, error) {
+	exempt := sets.NewString(alwaysExempt...).Insert(policy.ExemptLabels...)
+	now := c.now()
+
+	var transitions []Transition
+	var errs []error
+	for _, step := range []struct {
+		from     State
+		label    string
+		inactive time.Duration
+	}{
+		// Close first, so that the issues and PRs that are marked as rotten
+		// in this sync do not need to be found again.
+		{from: Rotten, label: labels.LifecycleRotten, inactive: policy.CloseAfterDuration},
+		{from: Stale, label: labels.LifecycleStale, inactive: policy.RottenAfterDuration},
+		{from: Fresh, inactive: policy.StaleAfterDuration},
+	} {
+		cutoff := now.Add(-step.inactive)
+		query := searchQuery(policy, scope, excluded, exempt, step.label, cutoff)
+		issues, err := c.ghc.FindIssues(query, "updated", true)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to search %q: %w", query, err))
+			continue
+		}
+		for _, issue := range issues {
+			// The search only has a granularity of days and may be stale, so
+			// the issues and PRs that it returned are checked again.
+			if issue.UpdatedAt.After(cutoff) || stateOf(issue) != step.from || hasAny(issue, exempt) {
+				continue
+			}
+			if (issue.IsPullRequest() && policy.SkipPullRequests) || (!issue.IsPullRequest() && policy.SkipIssues) {
+				continue
+			}
+			org, repo, err := orgRepo(issue.HTMLURL)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			t := Transition{
+				Org:         org,
+				Repo:        repo,
+				Number:      issue.Number,
+				URL:         issue.HTMLURL,
+				PullRequest: issue.IsPullRequest(),
+				From:        step.from,
+				To:          next(step.from),
+			}
+			if err := c.apply(t, policy); err != nil {
+				errs = append(errs, fmt.Errorf("failed to mark %s as %s: %w", t.URL, t.To, err))
+				continue
+			}
+			lifecycleTransitions.WithLabelValues(t.Org, t.Repo, string(t.To), strconv.FormatBool(c.dryRun)).Inc()
+			transitions = append(transitions, t)
+		}
+	}
+	return transitions, utilerrors.NewAggregate(errs)
+}
+
+// searchQuery finds the open issues and PRs of the scope that have the label,
+// or no lifecycle label if it is empty, and were last updated before cutoff.
+func searchQuery(policy plugins.Lifecycle, scope string, excluded []string, exempt sets.String, label string, cutoff time.Time) string {
+	terms := []string{"is:open", "archived:false"}
+	if strings.Contains(scope, "/") {
+		terms = append(terms, "repo:"+scope)
+	} else {
+		terms = append(terms, "org:"+scope)
+		for _, repo := range excluded {
+			terms = append(terms, "-repo:"+repo)
+		}
+	}
+	switch {
+	case policy.SkipIssues:
+		terms = append(terms, "is:pr")
+	case policy.SkipPullRequests:
+		terms = append(terms, "is:issue")
+	}
+	if label != "" {
+		terms = append(terms, fmt.Sprintf("label:%q", label))
+	} else {
+		terms = append(terms, fmt.Sprintf("-label:%q", labels.LifecycleStale), fmt.Sprintf("-label:%q", labels.LifecycleRotten))
+	}
+	for _, l := range exempt.List() {
+		terms = append(terms, fmt.Sprintf("-label:%q", l))
+	}
+	terms = append(terms, "updated:<"+cutoff.UTC().Format(time.RFC3339))
+	return strings.Join(terms, " ")
+}
+
+func (c *Controller) apply(t Transition, policy plugins.Lifecycle) error {
+	log := c.logger.WithFields(logrus.Fields{
+		github.OrgLogField:  t.Org,
+		github.RepoLogField: t.Repo,
+		github.PrLogField:   t.Number,
+		"from":              t.From,
+		"to":                t.To,
+	})
+	if c.dryRun {
+		log.Info("Would apply lifecycle transition.")
+		return nil
+	}
+	log.Info("Applying lifecycle transition.")
+	if err := c.ghc.CreateComment(t.Org, t.Repo, t.Number, comment(t, policy)); err != nil {
+		return err
+	}
+	switch t.To {
+	case Stale:
+		return c.ghc.AddLabel(t.Org, t.Repo, t.Number, labels.LifecycleStale)
+	case Rotten:
+		if err := c.ghc.AddLabel(t.Org, t.Repo, t.Number, labels.LifecycleRotten); err != nil {
+			return err
+		}
+		return c.ghc.RemoveLabel(t.Org, t.Repo, t.Number, labels.LifecycleStale)
+	default:
+		if t.PullRequest {
+			return c.ghc.ClosePR(t.Org, t.Repo, t.Number)
+		}
+		return c.ghc.CloseIssue(t.Org, t.Repo, t.Number)
+	}
+}
+
+// report logs how many issues and PRs of every repo changed state.
+func (c *Controller) report(transitions []Transition) {
+	counts := map[string]map[State]int{}
+	for _, t := range transitions {
+		repo := t.Org + "/" + t.Repo
+		if counts[repo] == nil {
+			counts[repo] = map[State]int{}
+		}
+		counts[repo][t.To]++
+	}
+	var repos []string
+	for repo := range counts {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		c.logger.WithFields(logrus.Fields{
+			"repo":        repo,
+			"dry-run":     c.dryRun,
+			string(Stale): counts[repo][Stale], string(Rotten): counts[repo][Rotten], string(Closed): counts[repo][Closed],
+		}).Info("Lifecycle transitions.")
+	}
+}
+
+func comment(t Transition, policy plugins.Lifecycle) string {
+	kind := "issues"
+	if t.PullRequest {
+		kind = "PRs"
+	}
+	switch t.To {
+	case Stale:
+		return fmt.Sprintf("%s go stale after %s of inactivity.\n"+
+			"Mark this as fresh with `/remove-lifecycle stale`.\n"+
+			"Stale %s rot after an additional %s of inactivity and eventually close.\n\n"+
+			"If this is safe to close now please do so with `/close`.\n\n"+
+			"/lifecycle stale", strings.Title(kind), days(policy.StaleAfterDuration), kind, days(policy.RottenAfterDuration))
+	case Rotten:
+		return fmt.Sprintf("Stale %s rot after %s of inactivity.\n"+
+			"Mark this as fresh with `/remove-lifecycle rotten`.\n"+
+			"Rotten %s close after an additional %s of inactivity.\n\n"+
+			"If this is safe to close now please do so with `/close`.\n\n"+
+			"/lifecycle rotten", kind, days(policy.RottenAfterDuration), kind, days(policy.CloseAfterDuration))
+	default:
+		return fmt.Sprintf("Rotten %s close after %s of inactivity.\n"+
+			"Reopen this with `/reopen`.\n"+
+			"Mark this as fresh with `/remove-lifecycle rotten`.\n\n"+
+			"/close", kind, days(policy.CloseAfterDuration))
+	}
+}
+
+// days formats durations of whole days like 90d, and others like 36h0m0s.
+func days(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+func stateOf(issue github.Issue) State {
+	switch {
+	case issue.HasLabel(labels.LifecycleRotten):
+		return Rotten
+	case issue.HasLabel(labels.LifecycleStale):
+		return Stale
+	default:
+		return Fresh
+	}
+}
+
+func next(state State) State {
+	switch state {
+	case Fresh:
+		return Stale
+	case Stale:
+		return Rotten
+	default:
+		return Closed
+	}
+}
+
+func hasAny(issue github.Issue, names sets.String) bool {
+	for _, label := range issue.Labels {
+		if names.Has(label.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// orgRepo parses the org and repo of an issue or PR from its URL, like
+// https://github.com/org/repo/issues/1, as search results do not contain them.
+func orgRepo(htmlURL string) (string, string, error) {
+	u, err := url.Parse(htmlURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse the URL %q: %w", htmlURL, err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 {
+		return "", "", fmt.Errorf("the URL %q is not the URL of an issue or PR", htmlURL)
+	}
+	parts = parts[len(parts)-4:]
+	if _, err := strconv.Atoi(parts[3]); err != nil {
+		return "", "", fmt.Errorf("the URL %q is not the URL of an issue or PR", htmlURL)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lifecycle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/labels"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+type fakeClient struct {
+	// results are the issues found by the queries that contain the key.
+	results map[string][]github.Issue
+	queries []string
+	actions []string
+}
+
+func (f *fakeClient) FindIssues(query, sort string, asc bool) ([]github.Issue, error) {
+	f.queries = append(f.queries, query)
+	var issues []github.Issue
+	for term, result := range f.results {
+		if strings.Contains(query, term) {
+			issues = append(issues, result...)
+		}
+	}
+	return issues, nil
+}
+
+func (f *fakeClient) AddLabel(org, repo string, number int, label string) error {
+	f.actions = append(f.actions, fmt.Sprintf("label %s/%s#%d %s", org, repo, number, label))
+	return nil
+}
+
+func (f *fakeClient) RemoveLabel(org, repo string, number int, label string) error {
+	f.actions = append(f.actions, fmt.Sprintf("unlabel %s/%s#%d %s", org, repo, number, label))
+	return nil
+}
+
+func (f *fakeClient) CreateComment(org, repo string, number int, comment string) error {
+	f.actions = append(f.actions, fmt.Sprintf("comment %s/%s#%d", org, repo, number))
+	return nil
+}
+
+func (f *fakeClient) CloseIssue(org, repo string, number int) error {
+	f.actions = append(f.actions, fmt.Sprintf("close issue %s/%s#%d", org, repo, number))
+	return nil
+}
+
+func (f *fakeClient) ClosePR(org, repo string, number int) error {
+	f.actions = append(f.actions, fmt.Sprintf("close PR %s/%s#%d", org, repo, number))
+	return nil
+}
+
+var now = time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func issue(repo string, number int, pr bool, inactive time.Duration, labelNames ...string) github.Issue {
+	i := github.Issue{
+		Number:    number,
+		HTMLURL:   fmt.Sprintf("https://github.com/%s/issues/%d", repo, number),
+		UpdatedAt: now.Add(-inactive),
+	}
+	if pr {
+		i.PullRequest = &struct{}{}
+	}
+	for _, name := range labelNames {
+		i.Labels = append(i.Labels, github.Label{Name: name})
+	}
+	return i
+}
+
+func policy(repos []string, exempt ...string) plugins.Lifecycle {
+	return plugins.Lifecycle{
+		Repos:               repos,
+		ExemptLabels:        exempt,
+		StaleAfterDuration:  90 * 24 * time.Hour,
+		RottenAfterDuration: 30 * 24 * time.Hour,
+		CloseAfterDuration:  30 * 24 * time.Hour,
+	}
+}
+
+const day = 24 * time.Hour
+
+func TestSync(t *testing.T) {
+	stale := fmt.Sprintf("-label:%q", labels.LifecycleStale)
+	isStale := fmt.Sprintf(" label:%q", labels.LifecycleStale)
+	isRotten := fmt.Sprintf(" label:%q", labels.LifecycleRotten)
+	results := map[string][]github.Issue{
+		stale: {
+			issue("org/repo", 1, false, 100*day),
+			// Updated since the search index was.
+			issue("org/repo", 2, false, 10*day),
+			issue("org/repo", 3, false, 100*day, "keep"),
+			issue("org/repo", 4, true, 100*day, labels.LifecycleFrozen),
+		},
+		isStale: {
+			issue("org/repo", 5, true, 40*day, labels.LifecycleStale),
+		},
+		isRotten: {
+			issue("org/repo", 6, false, 40*day, labels.LifecycleRotten),
+			issue("org/repo", 7, true, 40*day, labels.LifecycleRotten),
+		},
+	}
+	config := &plugins.Configuration{Lifecycle: []plugins.Lifecycle{policy([]string{"org/repo"}, "keep")}}
+
+	expected := []Transition{
+		{Org: "org", Repo: "repo", Number: 6, URL: "https://github.com/org/repo/issues/6", From: Rotten, To: Closed},
+		{Org: "org", Repo: "repo", Number: 7, URL: "https://github.com/org/repo/issues/7", PullRequest: true, From: Rotten, To: Closed},
+		{Org: "org", Repo: "repo", Number: 5, URL: "https://github.com/org/repo/issues/5", PullRequest: true, From: Stale, To: Rotten},
+		{Org: "org", Repo: "repo", Number: 1, URL: "https://github.com/org/repo/issues/1", From: Fresh, To: Stale},
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry-run=%t", dryRun), func(t *testing.T) {
+			ghc := &fakeClient{results: results}
+			c := &Controller{
+				ghc:    ghc,
+				config: func() *plugins.Configuration { return config },
+				dryRun: dryRun,
+				now:    func() time.Time { return now },
+				logger: logrus.WithField("test", t.Name()),
+			}
+			lifecycleTransitions.Reset()
+			transitions, err := c.Sync()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(expected, transitions); diff != "" {
+				t.Errorf("unexpected transitions (-want +got):\n%s", diff)
+			}
+			for to, count := range map[State]float64{Stale: 1, Rotten: 1, Closed: 2} {
+				if got := testutil.ToFloat64(lifecycleTransitions.WithLabelValues("org", "repo", string(to), strconv.FormatBool(dryRun))); got != count {
+					t.Errorf("expected %v transitions to %s to be counted, got %v", count, to, got)
+				}
+			}
+
+			var expectedActions []string
+			if !dryRun {
+				expectedActions = []string{
+					"comment org/repo#6",
+					"close issue org/repo#6",
+					"comment org/repo#7",
+					"close PR org/repo#7",
+					"comment org/repo#5",
+					"label org/repo#5 lifecycle/rotten",
+					"unlabel org/repo#5 lifecycle/stale",
+					"comment org/repo#1",
+					"label org/repo#1 lifecycle/stale",
+				}
+			}
+			if diff := cmp.Diff(expectedActions, ghc.actions); diff != "" {
+				t.Errorf("unexpected actions (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSyncQueries(t *testing.T) {
+	orgPolicy := policy([]string{"org"})
+	orgPolicy.SkipPullRequests = true
+	config := &plugins.Configuration{Lifecycle: []plugins.Lifecycle{
+		orgPolicy,
+		policy([]string{"org/special", "other/repo"}, "keep"),
+	}}
+	ghc := &fakeClient{}
+	c := &Controller{
+		ghc:    ghc,
+		config: func() *plugins.Configuration { return config },
+		now:    func() time.Time { return now },
+		logger: logrus.WithField("test", t.Name()),
+	}
+	if _, err := c.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		`is:open archived:false org:org -repo:org/special is:issue label:"lifecycle/rotten" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-05-02T00:00:00Z`,
+		`is:open archived:false org:org -repo:org/special is:issue label:"lifecycle/stale" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-05-02T00:00:00Z`,
+		`is:open archived:false org:org -repo:org/special is:issue -label:"lifecycle/stale" -label:"lifecycle/rotten" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-03-03T00:00:00Z`,
+		`is:open archived:false repo:org/special label:"lifecycle/rotten" -label:"keep" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-05-02T00:00:00Z`,
+		`is:open archived:false repo:org/special label:"lifecycle/stale" -label:"keep" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-05-02T00:00:00Z`,
+		`is:open archived:false repo:org/special -label:"lifecycle/stale" -label:"lifecycle/rotten" -label:"keep" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-03-03T00:00:00Z`,
+		`is:open archived:false repo:other/repo label:"lifecycle/rotten" -label:"keep" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-05-02T00:00:00Z`,
+		`is:open archived:false repo:other/repo label:"lifecycle/stale" -label:"keep" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-05-02T00:00:00Z`,
+		`is:open archived:false repo:other/repo -label:"lifecycle/stale" -label:"lifecycle/rotten" -label:"keep" -label:"lifecycle/active" -label:"lifecycle/frozen" updated:<2021-03-03T00:00:00Z`,
+	}
+	if diff := cmp.Diff(expected, ghc.queries); diff != "" {
+		t.Errorf("unexpected queries (-want +got):\n%s", diff)
+	}
+}
+
+func TestOrgRepo(t *testing.T) {
+	for _, tc := range []struct {
+		url       string
+		org, repo string
+		expectErr bool
+	}{
+		{url: "https://github.com/org/repo/issues/1", org: "org", repo: "repo"},
+		{url: "https://github.com/org/repo/pull/2", org: "org", repo: "repo"},
+		{url: "https://ghe.example.com/github/org/repo/pull/2", org: "org", repo: "repo"},
+		{url: "https://github.com/org/repo", expectErr: true},
+		{url: "https://github.com/org/repo/issues/new", expectErr: true},
+	} {
+		org, repo, err := orgRepo(tc.url)
+		if (err != nil) != tc.expectErr {
+			t.Errorf("%s: expected error %t, got %v", tc.url, tc.expectErr, err)
+		}
+		if org != tc.org || repo != tc.repo {
+			t.Errorf("%s: expected %s/%s, got %s/%s", tc.url, tc.org, tc.repo, org, repo)
+		}
+	}
+}
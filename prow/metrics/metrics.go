@@ -78,6 +78,13 @@ func ExposeMetrics(component string, pushGateway config.PushGateway, port int) {
 	ExposeMetricsWithRegistry(component, pushGateway, port, nil, nil)
 }
 
+// PushMetrics pushes the metrics of the gatherer once, for jobs that exit
+// before they would be scraped. The metrics are not grouped by instance, so
+// that every run replaces the metrics of the previous one.
+func PushMetrics(component, endpoint string, g prometheus.Gatherer) error {
+	return fromGatherer(component, nil, endpoint, g)
+}
+
 // pushMetrics is meant to run in a goroutine and continuously push
 // metrics to the provided endpoint.
 func pushMetrics(component, endpoint string, interval time.Duration) {
@@ -19,6 +19,7 @@ package pjutil
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
@@ -73,6 +74,28 @@ func AvailablePresubmits(changes config.ChangedFilesProvider, org, repo, branch
 	return runWithTestAllNames, optionalJobTriggerCommands, requiredJobsTriggerCommands, nil
 }
 
+// parameterRe matches the `NAME=value` arguments of a trigger command.
+var parameterRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(\S*)$`)
+
+// ParametersFromComment returns the parameters of a presubmit passed in a
+// comment, e.g. `/test e2e FOCUS=Networking`, completed with the defaults of
+// the presubmit. Only `NAME=value` arguments on the lines of the comment that
+// trigger the presubmit are considered.
+func ParametersFromComment(body string, ps config.Presubmit) (map[string]string, error) {
+	passed := map[string]string{}
+	for _, line := range strings.Split(body, "\n") {
+		if !ps.TriggerMatches(line) {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if m := parameterRe.FindStringSubmatch(field); m != nil {
+				passed[m[1]] = m[2]
+			}
+		}
+	}
+	return ps.ResolveParameters(passed)
+}
+
 // Filter digests a presubmit config to determine if:
 //  - the presubmit matched the filter
 //  - we know that the presubmit is forced to run
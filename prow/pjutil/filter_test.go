@@ -171,6 +171,72 @@ func TestCommandFilter(t *testing.T) {
 	}
 }
 
+func TestParametersFromComment(t *testing.T) {
+	presubmit := config.Presubmit{
+		JobBase:      config.JobBase{Name: "e2e"},
+		Trigger:      `(?m)^/test (?:.*? )?e2e(?: .*?)?$`,
+		RerunCommand: "/test e2e",
+		Parameters: []config.PresubmitParameter{
+			{Name: "FOCUS", Default: "Conformance"},
+			{Name: "NODES", Default: "3", Pattern: "[0-9]+"},
+		},
+	}
+	presubmits := []config.Presubmit{presubmit}
+	if err := config.SetPresubmitRegexes(presubmits); err != nil {
+		t.Fatalf("could not set presubmit regexes: %v", err)
+	}
+
+	var testCases = []struct {
+		name        string
+		body        string
+		expected    map[string]string
+		expectedErr bool
+	}{
+		{
+			name:     "defaults",
+			body:     "/test e2e",
+			expected: map[string]string{"FOCUS": "Conformance", "NODES": "3"},
+		},
+		{
+			name:     "arguments override defaults",
+			body:     "/test e2e FOCUS=Networking NODES=5",
+			expected: map[string]string{"FOCUS": "Networking", "NODES": "5"},
+		},
+		{
+			name:     "empty value",
+			body:     "/test e2e FOCUS=",
+			expected: map[string]string{"FOCUS": "", "NODES": "3"},
+		},
+		{
+			name:     "arguments on lines that don't trigger the job are ignored",
+			body:     "/test e2e\nREGION=us\n/test other NODES=x",
+			expected: map[string]string{"FOCUS": "Conformance", "NODES": "3"},
+		},
+		{
+			name:        "invalid value",
+			body:        "/test e2e NODES=many",
+			expectedErr: true,
+		},
+		{
+			name:        "undeclared parameter",
+			body:        "/test e2e REGION=us",
+			expectedErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := ParametersFromComment(testCase.body, presubmits[0])
+			if (err != nil) != testCase.expectedErr {
+				t.Fatalf("expected error: %t, got %v", testCase.expectedErr, err)
+			}
+			if !reflect.DeepEqual(testCase.expected, actual) {
+				t.Errorf("expected parameters %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
 func fakeChangedFilesProvider(shouldError bool) config.ChangedFilesProvider {
 	return func() ([]string, error) {
 		if shouldError {
@@ -19,6 +19,7 @@ package pjutil
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"path"
@@ -26,7 +27,9 @@ import (
 
 	uuid "github.com/satori/go.uuid"
 	"github.com/sirupsen/logrus"
+	coreapi "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
@@ -88,6 +91,7 @@ func createRefs(pr github.PullRequest, baseSHA string) prowapi.Refs {
 // NewPresubmit converts a config.Presubmit into a prowapi.ProwJob.
 // The prowapi.Refs are configured correctly per the pr, baseSHA.
 // The eventGUID becomes a github.EventGUID label.
+// The parameters of the presubmit are set to their defaults, see SetParameters.
 func NewPresubmit(pr github.PullRequest, baseSHA string, job config.Presubmit, eventGUID string, additionalLabels map[string]string) prowapi.ProwJob {
 	refs := createRefs(pr, baseSHA)
 	labels := make(map[string]string)
@@ -103,7 +107,52 @@ func NewPresubmit(pr github.PullRequest, baseSHA string, job config.Presubmit, e
 	for k, v := range job.Annotations {
 		annotations[k] = v
 	}
-	return NewProwJob(PresubmitSpec(job, refs), labels, annotations)
+	pj := NewProwJob(PresubmitSpec(job, refs), labels, annotations)
+	defaults := map[string]string{}
+	for _, parameter := range job.Parameters {
+		defaults[parameter.Name] = parameter.Default
+	}
+	SetParameters(&pj, defaults)
+	return pj
+}
+
+// SetParameters sets the parameters of a presubmit as environment variables in
+// all containers of the ProwJob, overriding variables of the same name, and
+// records them in the parameters annotation of the ProwJob.
+func SetParameters(pj *prowapi.ProwJob, parameters map[string]string) {
+	if len(parameters) == 0 {
+		return
+	}
+	// A map of strings always marshals.
+	raw, _ := json.Marshal(parameters)
+	if pj.Annotations == nil {
+		pj.Annotations = map[string]string{}
+	}
+	pj.Annotations[kube.ParametersAnnotation] = string(raw)
+	if pj.Spec.PodSpec == nil {
+		return
+	}
+
+	// The pod spec is shared with the job config, so it must not be modified.
+	pj.Spec.PodSpec = pj.Spec.PodSpec.DeepCopy()
+	setEnv := func(containers []coreapi.Container) {
+		for i := range containers {
+			for _, name := range sets.StringKeySet(parameters).List() {
+				found := false
+				for j := range containers[i].Env {
+					if containers[i].Env[j].Name == name {
+						containers[i].Env[j] = coreapi.EnvVar{Name: name, Value: parameters[name]}
+						found = true
+					}
+				}
+				if !found {
+					containers[i].Env = append(containers[i].Env, coreapi.EnvVar{Name: name, Value: parameters[name]})
+				}
+			}
+		}
+	}
+	setEnv(pj.Spec.PodSpec.InitContainers)
+	setEnv(pj.Spec.PodSpec.Containers)
 }
 
 // PresubmitSpec initializes a ProwJobSpec for a given presubmit job.
@@ -884,6 +884,45 @@ func TestNewProwJobWithAnnotations(t *testing.T) {
 	}
 }
 
+func TestNewPresubmitParameters(t *testing.T) {
+	job := config.Presubmit{
+		JobBase: config.JobBase{
+			Name: "e2e",
+			Spec: &corev1.PodSpec{Containers: []corev1.Container{{
+				Image: "e2e",
+				Env:   []corev1.EnvVar{{Name: "FOCUS", Value: "config"}},
+			}}},
+		},
+		Parameters: []config.PresubmitParameter{
+			{Name: "FOCUS", Default: "Conformance"},
+			{Name: "NODES", Default: "3"},
+		},
+	}
+	pr := github.PullRequest{Base: github.PullRequestBranch{Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}}}
+
+	pj := NewPresubmit(pr, "abcdef", job, "guid", nil)
+	if annotation, expected := pj.Annotations[kube.ParametersAnnotation], `{"FOCUS":"Conformance","NODES":"3"}`; annotation != expected {
+		t.Errorf("expected parameters annotation %q, got %q", expected, annotation)
+	}
+	expectedEnv := []corev1.EnvVar{{Name: "FOCUS", Value: "Conformance"}, {Name: "NODES", Value: "3"}}
+	if diff := cmp.Diff(expectedEnv, pj.Spec.PodSpec.Containers[0].Env); diff != "" {
+		t.Errorf("unexpected env (-want +got):\n%s", diff)
+	}
+	if env := job.Spec.Containers[0].Env; len(env) != 1 || env[0].Value != "config" {
+		t.Errorf("expected the job config not to be modified, got env %v", env)
+	}
+
+	SetParameters(&pj, map[string]string{"FOCUS": "Networking", "NODES": "3"})
+	if annotation, expected := pj.Annotations[kube.ParametersAnnotation], `{"FOCUS":"Networking","NODES":"3"}`; annotation != expected {
+		t.Errorf("expected parameters annotation %q, got %q", expected, annotation)
+	}
+
+	job.Parameters = nil
+	if pj := NewPresubmit(pr, "abcdef", job, "guid", nil); pj.Annotations[kube.ParametersAnnotation] != "" {
+		t.Errorf("expected no parameters annotation for a job without parameters, got %q", pj.Annotations[kube.ParametersAnnotation])
+	}
+}
+
 func TestJobURL(t *testing.T) {
 	var testCases = []struct {
 		name        string
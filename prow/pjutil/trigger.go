@@ -31,55 +31,92 @@ import (
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
 )
 
-func resultForJob(pjclient prowv1.ProwJobInterface, selector string) (*pjapi.ProwJobStatus, bool, error) {
+// jobCompleted is true once the ProwJob reached a final state.
+func jobCompleted(prowJob *pjapi.ProwJob) bool {
+	switch prowJob.Status.State {
+	case pjapi.FailureState, pjapi.AbortedState, pjapi.ErrorState, pjapi.SuccessState:
+		return true
+	}
+	return false
+}
+
+// jobStarted is true once the ProwJob has a URL or, if it never gets one,
+// completed.
+func jobStarted(prowJob *pjapi.ProwJob) bool {
+	return prowJob.Status.URL != "" || jobCompleted(prowJob)
+}
+
+func watchForJob(pjclient prowv1.ProwJobInterface, selector string, done func(*pjapi.ProwJob) bool) (*pjapi.ProwJob, bool, error) {
 	w, err := pjclient.Watch(context.Background(), metav1.ListOptions{FieldSelector: selector})
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to create watch for ProwJobs: %w", err)
 	}
+	defer w.Stop()
 	for event := range w.ResultChan() {
 		prowJob, ok := event.Object.(*pjapi.ProwJob)
 		if !ok {
 			return nil, false, fmt.Errorf("received an unexpected object from Watch: object-type %s", fmt.Sprintf("%T", event.Object))
 		}
 
-		switch prowJob.Status.State {
-		case pjapi.FailureState, pjapi.AbortedState, pjapi.ErrorState, pjapi.SuccessState:
-			return &prowJob.Status, false, nil
+		if done(prowJob) {
+			return prowJob, false, nil
 		}
 	}
 	return nil, true, nil
 }
 
-// TriggerAndWatchProwJob would trigger the job provided by the prowjob parameter
-func TriggerAndWatchProwJob(o prowflagutil.KubernetesOptions, prowjob *pjapi.ProwJob, config *prowconfig.Config, envVars map[string]string, dryRun bool) error {
+func resultForJob(pjclient prowv1.ProwJobInterface, selector string) (*pjapi.ProwJobStatus, bool, error) {
+	prowJob, shouldContinue, err := watchForJob(pjclient, selector, jobCompleted)
+	if prowJob == nil {
+		return nil, shouldContinue, err
+	}
+	return &prowJob.Status, shouldContinue, err
+}
+
+// waitForJob watches the ProwJob until done is true for it.
+func waitForJob(pjclient prowv1.ProwJobInterface, name string, done func(*pjapi.ProwJob) bool) (*pjapi.ProwJob, error) {
+	selector := fields.SelectorFromSet(map[string]string{"metadata.name": name})
+	for {
+		prowJob, shouldContinue, err := watchForJob(pjclient, selector.String(), done)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watch job: %w", err)
+		}
+		if !shouldContinue {
+			return prowJob, nil
+		}
+	}
+}
+
+func submitProwJob(o prowflagutil.KubernetesOptions, prowjob *pjapi.ProwJob, config *prowconfig.Config, dryRun bool) (prowv1.ProwJobInterface, *pjapi.ProwJob, error) {
 	logrus.Info("getting cluster config")
 	pjclient, err := o.ProwJobClient(config.ProwJobNamespace, dryRun)
 	if err != nil {
-		return fmt.Errorf("failed getting prowjob client: %w", err)
+		return nil, nil, fmt.Errorf("failed getting prowjob client: %w", err)
 	}
 
 	logrus.WithFields(ProwJobFields(prowjob)).Info("submitting a new prowjob")
 	created, err := pjclient.Create(context.Background(), prowjob, metav1.CreateOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to submit the prowjob: %w", err)
+		return nil, nil, fmt.Errorf("failed to submit the prowjob: %w", err)
+	}
+	return pjclient, created, nil
+}
+
+// TriggerAndWatchProwJob would trigger the job provided by the prowjob parameter
+func TriggerAndWatchProwJob(o prowflagutil.KubernetesOptions, prowjob *pjapi.ProwJob, config *prowconfig.Config, envVars map[string]string, dryRun bool) error {
+	pjclient, created, err := submitProwJob(o, prowjob, config, dryRun)
+	if err != nil {
+		return err
 	}
 
 	logger := logrus.WithFields(ProwJobFields(created))
 	logger.Info("submitted the prowjob, waiting for its result")
 
-	selector := fields.SelectorFromSet(map[string]string{"metadata.name": created.Name})
-
-	var result *pjapi.ProwJobStatus
-	var shouldContinue bool
-	for {
-		result, shouldContinue, err = resultForJob(pjclient, selector.String())
-		if err != nil {
-			return fmt.Errorf("failed to watch job: %w", err)
-		}
-		if !shouldContinue {
-			break
-		}
+	completed, err := waitForJob(pjclient, created.Name, jobCompleted)
+	if err != nil {
+		return err
 	}
+	result := &completed.Status
 
 	if result.State != pjapi.SuccessState {
 		logrus.Error("job failed")
@@ -93,3 +130,15 @@ func TriggerAndWatchProwJob(o prowflagutil.KubernetesOptions, prowjob *pjapi.Pro
 	fmt.Println(string(b))
 	return nil
 }
+
+// TriggerProwJob triggers the job provided by the prowjob parameter and waits
+// until it started, so that its URL is known, without waiting for its result.
+func TriggerProwJob(o prowflagutil.KubernetesOptions, prowjob *pjapi.ProwJob, config *prowconfig.Config, dryRun bool) (*pjapi.ProwJob, error) {
+	pjclient, created, err := submitProwJob(o, prowjob, config, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(ProwJobFields(created)).Info("submitted the prowjob, waiting for it to start")
+	return waitForJob(pjclient, created.Name, jobStarted)
+}
@@ -182,3 +182,60 @@ func Test_resultForJob(t *testing.T) {
 		})
 	}
 }
+
+func Test_waitForJob(t *testing.T) {
+	testcases := []struct {
+		name          string
+		done          func(*prowapi.ProwJob) bool
+		watchResults  []prowapi.ProwJobStatus
+		expectedState prowapi.ProwJobState
+	}{
+		{
+			name: "started job has a URL",
+			done: jobStarted,
+			watchResults: []prowapi.ProwJobStatus{
+				{State: prowapi.TriggeredState},
+				{State: prowapi.PendingState, URL: "https://prow.example.com/view/winwin"},
+				{State: prowapi.SuccessState, URL: "https://prow.example.com/view/winwin"},
+			},
+			expectedState: prowapi.PendingState,
+		},
+		{
+			name: "job that completes without a URL counts as started",
+			done: jobStarted,
+			watchResults: []prowapi.ProwJobStatus{
+				{State: prowapi.TriggeredState},
+				{State: prowapi.ErrorState},
+			},
+			expectedState: prowapi.ErrorState,
+		},
+		{
+			name: "completed job ignores the URL",
+			done: jobCompleted,
+			watchResults: []prowapi.ProwJobStatus{
+				{State: prowapi.PendingState, URL: "https://prow.example.com/view/winwin"},
+				{State: prowapi.FailureState, URL: "https://prow.example.com/view/winwin"},
+			},
+			expectedState: prowapi.FailureState,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cs := fake.NewSimpleClientset()
+			cs.Fake.PrependWatchReactor("prowjobs", func(action coretesting.Action) (bool, watch.Interface, error) {
+				ret := watch.NewFakeWithChanSize(len(tc.watchResults), true)
+				for _, status := range tc.watchResults {
+					ret.Modify(&prowapi.ProwJob{ObjectMeta: metav1.ObjectMeta{Name: "winwin", Namespace: "prowjobs"}, Status: status})
+				}
+				return true, ret, nil
+			})
+			pj, err := waitForJob(cs.ProwV1().ProwJobs("prowjobs"), "winwin", tc.done)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pj.Status.State != tc.expectedState {
+				t.Errorf("expected state %s, got %s", tc.expectedState, pj.Status.State)
+			}
+		})
+	}
+}
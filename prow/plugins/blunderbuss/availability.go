@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blunderbuss
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+const outOfOfficeDateLayout = "2006-01-02"
+
+// outOfOfficePeriod is a period of whole days, including both from and to.
+type outOfOfficePeriod struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// outOfOfficeCalendar maps normalized logins to the periods during which they
+// are out of office.
+type outOfOfficeCalendar map[string][]outOfOfficePeriod
+
+// loadOutOfOffice reads the out-of-office calendar from path in the repo. As
+// the calendar only refines the selection of reviewers, a missing or invalid
+// file doesn't prevent requesting reviews.
+func loadOutOfOffice(ghc githubClient, log *logrus.Entry, org, repo, path, ref string) outOfOfficeCalendar {
+	log = log.WithField("out-of-office-file", path)
+	content, err := ghc.GetFile(org, repo, path, ref)
+	if err != nil {
+		if _, nf := err.(*github.FileNotFound); !nf {
+			log.WithError(err).Warn("Failed to read the out-of-office calendar.")
+		}
+		return nil
+	}
+	var raw map[string][]outOfOfficePeriod
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		log.WithError(err).Warn("Failed to parse the out-of-office calendar.")
+		return nil
+	}
+	calendar := outOfOfficeCalendar{}
+	for login, periods := range raw {
+		calendar[github.NormLogin(login)] = periods
+	}
+	return calendar
+}
+
+// isOut returns whether login is out of office on the day of now in UTC, so
+// that the result doesn't depend on the time zone hook runs in. Periods with
+// invalid dates are ignored.
+func (c outOfOfficeCalendar) isOut(login string, now time.Time) bool {
+	today := now.UTC().Format(outOfOfficeDateLayout)
+	for _, period := range c[github.NormLogin(login)] {
+		if _, err := time.Parse(outOfOfficeDateLayout, period.From); err != nil {
+			continue
+		}
+		if _, err := time.Parse(outOfOfficeDateLayout, period.To); err != nil {
+			continue
+		}
+		// The dates compare chronologically as strings as they have a fixed length.
+		if period.From <= today && today <= period.To {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blunderbuss
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutOfOfficeCalendarIsOut(t *testing.T) {
+	calendar := outOfOfficeCalendar{
+		"alice": {{From: "2021-06-01", To: "2021-06-14"}, {From: "2021-07-01", To: "2021-07-01"}},
+		"bob":   {{From: "June", To: "July"}},
+	}
+
+	var testcases = []struct {
+		name     string
+		login    string
+		now      string
+		expected bool
+	}{
+		{name: "before the period", login: "alice", now: "2021-05-31T23:59:00Z"},
+		{name: "first day of the period", login: "alice", now: "2021-06-01T00:00:00Z", expected: true},
+		{name: "last day of the period", login: "alice", now: "2021-06-14T23:59:00Z", expected: true},
+		{name: "after the period", login: "alice", now: "2021-06-15T00:00:00Z"},
+		{name: "period starts in UTC", login: "alice", now: "2021-05-31T20:00:00-05:00", expected: true},
+		{name: "period ends in UTC", login: "alice", now: "2021-06-15T08:00:00+09:00", expected: true},
+		{name: "single day period", login: "Alice", now: "2021-07-01T12:00:00Z", expected: true},
+		{name: "invalid period", login: "bob", now: "2021-06-15T00:00:00Z"},
+		{name: "user without periods", login: "carol", now: "2021-06-01T00:00:00Z"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tc.now)
+			if err != nil {
+				t.Fatalf("failed to parse time: %v", err)
+			}
+			if actual := calendar.isOut(tc.login, now); actual != tc.expected {
+				t.Errorf("expected isOut to be %t, got %t", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"time"
 
 	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
@@ -68,6 +69,9 @@ func helpProvider(config *plugins.Configuration, _ []config.OrgRepo) (*pluginhel
 			MaxReviewerCount:      3,
 			ExcludeApprovers:      true,
 			UseStatusAvailability: true,
+			MaxInFlightReviews:    10,
+			OutOfOfficeFile:       "OUT_OF_OFFICE.yaml",
+			RoundRobin:            true,
 		},
 	})
 	if err != nil {
@@ -125,6 +129,7 @@ type githubClient interface {
 	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
 	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
 	Query(context.Context, interface{}, map[string]interface{}) error
+	GetFile(org, repo, filepath, commit string) ([]byte, error)
 }
 
 type repoownersClient interface {
@@ -135,6 +140,7 @@ func handlePullRequestEvent(pc plugins.Agent, pre github.PullRequestEvent) error
 	return handlePullRequest(
 		pc.GitHubClient,
 		pc.OwnersClient,
+		pc.ReviewTracker,
 		pc.Logger,
 		pc.PluginConfig.Blunderbuss,
 		pre.Action,
@@ -143,28 +149,19 @@ func handlePullRequestEvent(pc plugins.Agent, pre github.PullRequestEvent) error
 	)
 }
 
-func handlePullRequest(ghc githubClient, roc repoownersClient, log *logrus.Entry, config plugins.Blunderbuss, action github.PullRequestEventAction, pr *github.PullRequest, repo *github.Repo) error {
+func handlePullRequest(ghc githubClient, roc repoownersClient, tracker *plugins.ReviewTracker, log *logrus.Entry, config plugins.Blunderbuss, action github.PullRequestEventAction, pr *github.PullRequest, repo *github.Repo) error {
 	if action != github.PullRequestActionOpened || assign.CCRegexp.MatchString(pr.Body) {
 		return nil
 	}
 
-	return handle(
-		ghc,
-		roc,
-		log,
-		config.ReviewerCount,
-		config.MaxReviewerCount,
-		config.ExcludeApprovers,
-		config.UseStatusAvailability,
-		repo,
-		pr,
-	)
+	return handle(ghc, roc, tracker, log, config, repo, pr)
 }
 
 func handleGenericCommentEvent(pc plugins.Agent, ce github.GenericCommentEvent) error {
 	return handleGenericComment(
 		pc.GitHubClient,
 		pc.OwnersClient,
+		pc.ReviewTracker,
 		pc.Logger,
 		pc.PluginConfig.Blunderbuss,
 		ce.Action,
@@ -176,7 +173,7 @@ func handleGenericCommentEvent(pc plugins.Agent, ce github.GenericCommentEvent)
 	)
 }
 
-func handleGenericComment(ghc githubClient, roc repoownersClient, log *logrus.Entry, config plugins.Blunderbuss, action github.GenericCommentEventAction, isPR bool, prNumber int, issueState string, repo *github.Repo, body string) error {
+func handleGenericComment(ghc githubClient, roc repoownersClient, tracker *plugins.ReviewTracker, log *logrus.Entry, config plugins.Blunderbuss, action github.GenericCommentEventAction, isPR bool, prNumber int, issueState string, repo *github.Repo, body string) error {
 	if action != github.GenericCommentActionCreated || !isPR || issueState == "closed" {
 		return nil
 	}
@@ -190,20 +187,10 @@ func handleGenericComment(ghc githubClient, roc repoownersClient, log *logrus.En
 		return fmt.Errorf("error loading PullRequest: %w", err)
 	}
 
-	return handle(
-		ghc,
-		roc,
-		log,
-		config.ReviewerCount,
-		config.MaxReviewerCount,
-		config.ExcludeApprovers,
-		config.UseStatusAvailability,
-		repo,
-		pr,
-	)
+	return handle(ghc, roc, tracker, log, config, repo, pr)
 }
 
-func handle(ghc githubClient, roc repoownersClient, log *logrus.Entry, reviewerCount *int, maxReviewers int, excludeApprovers bool, useStatusAvailability bool, repo *github.Repo, pr *github.PullRequest) error {
+func handle(ghc githubClient, roc repoownersClient, tracker *plugins.ReviewTracker, log *logrus.Entry, config plugins.Blunderbuss, repo *github.Repo, pr *github.PullRequest) error {
 	oc, err := roc.LoadRepoOwners(repo.Owner.Login, repo.Name, pr.Base.Ref)
 	if err != nil {
 		return fmt.Errorf("error loading RepoOwners: %w", err)
@@ -214,24 +201,23 @@ func handle(ghc githubClient, roc repoownersClient, log *logrus.Entry, reviewerC
 		return fmt.Errorf("error getting PR changes: %w", err)
 	}
 
+	selector := newReviewerSelector(ghc, tracker, log, config, repo.Owner.Login)
+	if config.OutOfOfficeFile != "" {
+		selector.outOfOffice = loadOutOfOffice(ghc, log, repo.Owner.Login, repo.Name, config.OutOfOfficeFile, pr.Base.Ref)
+	}
+
 	var reviewers []string
 	var requiredReviewers []string
-	if reviewerCount != nil {
-		reviewers, requiredReviewers, err = getReviewers(oc, ghc, log, pr.User.Login, changes, *reviewerCount, useStatusAvailability)
-		if err != nil {
-			return err
-		}
+	if reviewerCount := config.ReviewerCount; reviewerCount != nil {
+		reviewers, requiredReviewers = getReviewers(oc, selector, pr.User.Login, changes, *reviewerCount)
 		if missing := *reviewerCount - len(reviewers); missing > 0 {
-			if !excludeApprovers {
+			if !config.ExcludeApprovers {
 				// Attempt to use approvers as additional reviewers. This must use
 				// reviewerCount instead of missing because owners can be both reviewers
 				// and approvers and the search might stop too early if it finds
 				// duplicates.
 				frc := fallbackReviewersClient{ownersClient: oc}
-				approvers, _, err := getReviewers(frc, ghc, log, pr.User.Login, changes, *reviewerCount, useStatusAvailability)
-				if err != nil {
-					return err
-				}
+				approvers, _ := getReviewers(frc, selector, pr.User.Login, changes, *reviewerCount)
 				var added int
 				combinedReviewers := sets.NewString(reviewers...)
 				for _, approver := range approvers {
@@ -249,7 +235,7 @@ func handle(ghc githubClient, roc repoownersClient, log *logrus.Entry, reviewerC
 		}
 	}
 
-	if maxReviewers > 0 && len(reviewers) > maxReviewers {
+	if maxReviewers := config.MaxReviewerCount; maxReviewers > 0 && len(reviewers) > maxReviewers {
 		log.Infof("Limiting request of %d reviewers to %d maxReviewers.", len(reviewers), maxReviewers)
 		reviewers = reviewers[:maxReviewers]
 	}
@@ -259,20 +245,24 @@ func handle(ghc githubClient, roc repoownersClient, log *logrus.Entry, reviewerC
 
 	if len(reviewers) > 0 {
 		log.Infof("Requesting reviews from users %s.", reviewers)
-		return ghc.RequestReview(repo.Owner.Login, repo.Name, pr.Number, reviewers)
+		if err := ghc.RequestReview(repo.Owner.Login, repo.Name, pr.Number, reviewers); err != nil {
+			return err
+		}
+		if tracker != nil {
+			tracker.Record(repo.Owner.Login, reviewers)
+		}
 	}
 	return nil
 }
 
-func getReviewers(rc reviewersClient, ghc githubClient, log *logrus.Entry, author string, files []github.PullRequestChange, minReviewers int, useStatusAvailability bool) ([]string, []string, error) {
+func getReviewers(rc reviewersClient, selector *reviewerSelector, author string, files []github.PullRequestChange, minReviewers int) ([]string, []string) {
 	authorSet := sets.NewString(github.NormLogin(author))
 	reviewers := layeredsets.NewString()
 	requiredReviewers := sets.NewString()
 	leafReviewers := layeredsets.NewString()
-	busyReviewers := sets.NewString()
 	ownersSeen := sets.NewString()
 	if minReviewers == 0 {
-		return reviewers.List(), requiredReviewers.List(), nil
+		return reviewers.List(), requiredReviewers.List()
 	}
 	// first build 'reviewers' by taking a unique reviewer from each OWNERS file.
 	for _, file := range files {
@@ -290,14 +280,14 @@ func getReviewers(rc reviewersClient, ghc githubClient, log *logrus.Entry, autho
 			continue
 		}
 		leafReviewers = leafReviewers.Union(fileUnusedLeafs)
-		if r := findReviewer(ghc, log, useStatusAvailability, &busyReviewers, &fileUnusedLeafs); r != "" {
+		if r := selector.findReviewer(&fileUnusedLeafs); r != "" {
 			reviewers.Insert(0, r)
 		}
 	}
 	// now ensure that we request review from at least minReviewers reviewers. Favor leaf reviewers.
 	unusedLeafs := leafReviewers.Difference(reviewers.Set())
 	for reviewers.Len() < minReviewers && unusedLeafs.Len() > 0 {
-		if r := findReviewer(ghc, log, useStatusAvailability, &busyReviewers, &unusedLeafs); r != "" {
+		if r := selector.findReviewer(&unusedLeafs); r != "" {
 			reviewers.Insert(1, r)
 		}
 	}
@@ -307,46 +297,104 @@ func getReviewers(rc reviewersClient, ghc githubClient, log *logrus.Entry, autho
 		}
 		fileReviewers := rc.Reviewers(file.Filename).Difference(authorSet)
 		for reviewers.Len() < minReviewers && fileReviewers.Len() > 0 {
-			if r := findReviewer(ghc, log, useStatusAvailability, &busyReviewers, &fileReviewers); r != "" {
+			if r := selector.findReviewer(&fileReviewers); r != "" {
 				reviewers.Insert(2, r)
 			}
 		}
 	}
-	return reviewers.List(), requiredReviewers.List(), nil
+	return reviewers.List(), requiredReviewers.List()
 }
 
-// findReviewer finds a reviewer from a set, potentially using status
-// availability.
-func findReviewer(ghc githubClient, log *logrus.Entry, useStatusAvailability bool, busyReviewers *sets.String, targetSet *layeredsets.String) string {
-	// if we don't care about status availability, just pop a target from the set
-	if !useStatusAvailability {
-		return targetSet.PopRandom()
+// reviewerSelector selects reviewers from sets of candidates, skipping those
+// that are unavailable according to the blunderbuss config.
+type reviewerSelector struct {
+	ghc     githubClient
+	tracker *plugins.ReviewTracker
+	log     *logrus.Entry
+	config  plugins.Blunderbuss
+	org     string
+	now     time.Time
+	// outOfOffice is the out-of-office calendar of the repo, if any.
+	outOfOffice outOfOfficeCalendar
+	// unavailable holds the candidates that were already found to be
+	// unavailable, so that they are only checked once.
+	unavailable sets.String
+}
+
+func newReviewerSelector(ghc githubClient, tracker *plugins.ReviewTracker, log *logrus.Entry, config plugins.Blunderbuss, org string) *reviewerSelector {
+	return &reviewerSelector{
+		ghc:         ghc,
+		tracker:     tracker,
+		log:         log,
+		config:      config,
+		org:         org,
+		now:         time.Now(),
+		unavailable: sets.NewString(),
 	}
+}
 
-	// if we do care, start looping through the candidates
-	for {
-		if targetSet.Len() == 0 {
-			// if there are no candidates left, then break
-			break
-		}
-		candidate := targetSet.PopRandom()
-		if busyReviewers.Has(candidate) {
-			// we've already verified this reviewer is busy
+// findReviewer finds an available reviewer from a set and removes all
+// candidates it considered from it.
+func (s *reviewerSelector) findReviewer(targetSet *layeredsets.String) string {
+	for targetSet.Len() > 0 {
+		candidate := s.pop(*targetSet)
+		if s.unavailable.Has(candidate) {
+			// we've already verified this reviewer is unavailable
 			continue
 		}
-		busy, err := isUserBusy(ghc, candidate)
-		if err != nil {
-			log.Errorf("error checking user availability: %v", err)
+		if s.available(candidate) {
+			return candidate
 		}
-		if !busy {
+		s.unavailable.Insert(candidate)
+	}
+	return ""
+}
+
+// pop selects a candidate from the first non-empty layer of the set and
+// removes it. Candidates are selected randomly unless round robin is enabled
+// and review requests are tracked.
+func (s *reviewerSelector) pop(targetSet layeredsets.String) string {
+	if !s.config.RoundRobin || s.tracker == nil {
+		return targetSet.PopRandom()
+	}
+	for _, layer := range targetSet {
+		if layer.Len() > 0 {
+			candidate := s.tracker.LeastRecent(s.org, layer.List())
+			targetSet.Delete(candidate)
 			return candidate
 		}
-		// if we haven't returned the candidate, then they must be busy.
-		busyReviewers.Insert(candidate)
 	}
 	return ""
 }
 
+// available checks whether the candidate may be requested to review.
+func (s *reviewerSelector) available(candidate string) bool {
+	log := s.log.WithField("candidate", candidate)
+	if s.outOfOffice.isOut(candidate, s.now) {
+		log.Debug("Skipping reviewer who is out of office.")
+		return false
+	}
+	if s.config.UseStatusAvailability {
+		busy, err := isUserBusy(s.ghc, candidate)
+		if err != nil {
+			log.Errorf("error checking user availability: %v", err)
+		}
+		if busy {
+			return false
+		}
+	}
+	if s.config.MaxInFlightReviews > 0 {
+		count, err := inFlightReviews(s.ghc, s.org, candidate)
+		if err != nil {
+			log.Errorf("error checking in-flight reviews: %v", err)
+		} else if count >= s.config.MaxInFlightReviews {
+			log.Debugf("Skipping reviewer with %d in-flight reviews.", count)
+			return false
+		}
+	}
+	return true
+}
+
 type githubAvailabilityQuery struct {
 	User struct {
 		Login  githubql.String
@@ -365,3 +413,20 @@ func isUserBusy(ghc githubClient, user string) (bool, error) {
 	err := ghc.Query(ctx, &query, vars)
 	return bool(query.User.Status.IndicatesLimitedAvailability), err
 }
+
+type githubReviewLoadQuery struct {
+	Search struct {
+		IssueCount githubql.Int
+	} `graphql:"search(type: ISSUE, first: 1, query: $query)"`
+}
+
+// inFlightReviews returns the number of open pull requests in org that user
+// has a pending review request on.
+func inFlightReviews(ghc githubClient, org, user string) (int, error) {
+	var query githubReviewLoadQuery
+	vars := map[string]interface{}{
+		"query": githubql.String(fmt.Sprintf("is:pr is:open archived:false org:%s review-requested:%s", org, user)),
+	}
+	err := ghc.Query(context.Background(), &query, vars)
+	return int(query.Search.IssueCount), err
+}
@@ -44,6 +44,10 @@ type fakeGitHubClient struct {
 	pr        *github.PullRequest
 	changes   []github.PullRequestChange
 	requested []string
+	// inFlightReviews maps users to the number of their pending review requests.
+	inFlightReviews map[string]int
+	// files maps paths to the content of files in the repo.
+	files map[string][]byte
 }
 
 func newFakeGitHubClient(pr *github.PullRequest, filesChanged []string) *fakeGitHubClient {
@@ -85,7 +89,24 @@ func (c *fakeGitHubClient) GetPullRequest(org, repo string, num int) (*github.Pu
 	return c.pr, nil
 }
 
+func (c *fakeGitHubClient) GetFile(org, repo, path, commit string) ([]byte, error) {
+	content, ok := c.files[path]
+	if !ok {
+		return nil, &github.FileNotFound{}
+	}
+	return content, nil
+}
+
 func (c *fakeGitHubClient) Query(ctx context.Context, q interface{}, vars map[string]interface{}) error {
+	if lq, ok := q.(*githubReviewLoadQuery); ok {
+		query := string(vars["query"].(githubql.String))
+		for user, count := range c.inFlightReviews {
+			if strings.HasSuffix(query, "review-requested:"+user) {
+				lq.Search.IssueCount = githubql.Int(count)
+			}
+		}
+		return nil
+	}
 	sq, ok := q.(*githubAvailabilityQuery)
 	if !ok {
 		return errors.New("unexpected query type")
@@ -342,8 +363,8 @@ func TestHandleWithExcludeApproversOnlyReviewers(t *testing.T) {
 		fghc := newFakeGitHubClient(&pr, tc.filesChanged)
 
 		if err := handle(
-			fghc, froc, logrus.WithField("plugin", PluginName),
-			&tc.reviewerCount, tc.maxReviewerCount, true, false, &repo, &pr,
+			fghc, froc, nil, logrus.WithField("plugin", PluginName),
+			plugins.Blunderbuss{ReviewerCount: &tc.reviewerCount, MaxReviewerCount: tc.maxReviewerCount, ExcludeApprovers: true, UseStatusAvailability: false}, &repo, &pr,
 		); err != nil {
 			t.Errorf("[%s] unexpected error from handle: %v", tc.name, err)
 			continue
@@ -384,8 +405,8 @@ func TestHandleWithoutExcludeApproversNoReviewers(t *testing.T) {
 		fghc := newFakeGitHubClient(&pr, tc.filesChanged)
 
 		if err := handle(
-			fghc, froc, logrus.WithField("plugin", PluginName),
-			&tc.reviewerCount, tc.maxReviewerCount, false, false, &repo, &pr,
+			fghc, froc, nil, logrus.WithField("plugin", PluginName),
+			plugins.Blunderbuss{ReviewerCount: &tc.reviewerCount, MaxReviewerCount: tc.maxReviewerCount, ExcludeApprovers: false, UseStatusAvailability: false}, &repo, &pr,
 		); err != nil {
 			t.Errorf("[%s] unexpected error from handle: %v", tc.name, err)
 			continue
@@ -529,8 +550,8 @@ func TestHandleWithoutExcludeApproversMixed(t *testing.T) {
 		repo := github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
 		fghc := newFakeGitHubClient(&pr, tc.filesChanged)
 		if err := handle(
-			fghc, froc, logrus.WithField("plugin", PluginName),
-			&tc.reviewerCount, tc.maxReviewerCount, false, false, &repo, &pr,
+			fghc, froc, nil, logrus.WithField("plugin", PluginName),
+			plugins.Blunderbuss{ReviewerCount: &tc.reviewerCount, MaxReviewerCount: tc.maxReviewerCount, ExcludeApprovers: false, UseStatusAvailability: false}, &repo, &pr,
 		); err != nil {
 			t.Errorf("[%s] unexpected error from handle: %v", tc.name, err)
 			continue
@@ -606,7 +627,7 @@ func TestHandlePullRequest(t *testing.T) {
 			}
 
 			if err := handlePullRequest(
-				fghc, froc, logrus.WithField("plugin", PluginName),
+				fghc, froc, nil, logrus.WithField("plugin", PluginName),
 				config, tc.action, &pr, &repo,
 			); err != nil {
 				t.Fatalf("unexpected error from handle: %v", err)
@@ -701,7 +722,7 @@ func TestHandleGenericComment(t *testing.T) {
 			}
 
 			if err := handleGenericComment(
-				fghc, froc, logrus.WithField("plugin", PluginName), config,
+				fghc, froc, nil, logrus.WithField("plugin", PluginName), config,
 				tc.action, tc.isPR, pr.Number, tc.issueState, &repo, tc.body,
 			); err != nil {
 				t.Fatalf("unexpected error from handle: %v", err)
@@ -830,8 +851,8 @@ func TestPopActiveReviewer(t *testing.T) {
 		repo := github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
 		fghc := newFakeGitHubClient(&pr, tc.filesChanged)
 		if err := handle(
-			fghc, froc, logrus.WithField("plugin", PluginName),
-			&tc.reviewerCount, tc.maxReviewerCount, false, true, &repo, &pr,
+			fghc, froc, nil, logrus.WithField("plugin", PluginName),
+			plugins.Blunderbuss{ReviewerCount: &tc.reviewerCount, MaxReviewerCount: tc.maxReviewerCount, ExcludeApprovers: false, UseStatusAvailability: true}, &repo, &pr,
 		); err != nil {
 			t.Errorf("[%s] unexpected error from handle: %v", tc.name, err)
 			continue
@@ -851,3 +872,112 @@ func TestPopActiveReviewer(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleSkipsUnavailableReviewers(t *testing.T) {
+	froc := &fakeRepoownersClient{
+		foc: &fakeOwnersClient{
+			owners: map[string]string{"a.go": "1"},
+			leafReviewers: map[string]sets.String{
+				"a.go": sets.NewString("alice", "bob", "carol"),
+			},
+		},
+	}
+
+	var testcases = []struct {
+		name              string
+		config            plugins.Blunderbuss
+		inFlightReviews   map[string]int
+		files             map[string][]byte
+		expectedRequested []string
+	}{
+		{
+			name:              "reviewers with too many in-flight reviews are skipped",
+			config:            plugins.Blunderbuss{MaxInFlightReviews: 3},
+			inFlightReviews:   map[string]int{"alice": 3, "bob": 2, "carol": 5},
+			expectedRequested: []string{"bob"},
+		},
+		{
+			name:              "in-flight reviews are ignored without a limit",
+			inFlightReviews:   map[string]int{"alice": 3, "bob": 3, "carol": 3},
+			expectedRequested: []string{"alice", "bob", "carol"},
+		},
+		{
+			name:   "reviewers that are out of office are skipped",
+			config: plugins.Blunderbuss{OutOfOfficeFile: "OUT_OF_OFFICE.yaml"},
+			files: map[string][]byte{"OUT_OF_OFFICE.yaml": []byte(`
+Alice:
+- from: 2000-01-01
+  to: 2999-12-31
+bob:
+- from: 2000-01-01
+  to: 2000-01-02
+carol:
+- from: yesterday
+  to: tomorrow
+`)},
+			expectedRequested: []string{"bob", "carol"},
+		},
+		{
+			name:              "missing out-of-office file is ignored",
+			config:            plugins.Blunderbuss{OutOfOfficeFile: "OUT_OF_OFFICE.yaml"},
+			expectedRequested: []string{"alice", "bob", "carol"},
+		},
+		{
+			name:              "invalid out-of-office file is ignored",
+			config:            plugins.Blunderbuss{OutOfOfficeFile: "OUT_OF_OFFICE.yaml"},
+			files:             map[string][]byte{"OUT_OF_OFFICE.yaml": []byte("alice: yes")},
+			expectedRequested: []string{"alice", "bob", "carol"},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			pr := github.PullRequest{Number: 5, User: github.User{Login: "author"}}
+			repo := github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
+			fghc := newFakeGitHubClient(&pr, []string{"a.go"})
+			fghc.inFlightReviews = tc.inFlightReviews
+			fghc.files = tc.files
+			reviewerCount := 3
+			tc.config.ReviewerCount = &reviewerCount
+			tc.config.ExcludeApprovers = true
+
+			if err := handle(fghc, froc, nil, logrus.WithField("plugin", PluginName), tc.config, &repo, &pr); err != nil {
+				t.Fatalf("unexpected error from handle: %v", err)
+			}
+
+			sort.Strings(fghc.requested)
+			if !reflect.DeepEqual(fghc.requested, tc.expectedRequested) {
+				t.Errorf("expected the requested reviewers to be %q, but got %q.", tc.expectedRequested, fghc.requested)
+			}
+		})
+	}
+}
+
+func TestHandleRoundRobin(t *testing.T) {
+	froc := &fakeRepoownersClient{
+		foc: &fakeOwnersClient{
+			owners: map[string]string{"a.go": "1"},
+			leafReviewers: map[string]sets.String{
+				"a.go": sets.NewString("alice", "bob", "carol"),
+			},
+		},
+	}
+	reviewerCount := 1
+	config := plugins.Blunderbuss{ReviewerCount: &reviewerCount, ExcludeApprovers: true, RoundRobin: true}
+
+	tracker := plugins.NewReviewTracker()
+	var requested []string
+	for i := 0; i < 4; i++ {
+		pr := github.PullRequest{Number: 5, User: github.User{Login: "author"}}
+		repo := github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
+		fghc := newFakeGitHubClient(&pr, []string{"a.go"})
+		if err := handle(fghc, froc, tracker, logrus.WithField("plugin", PluginName), config, &repo, &pr); err != nil {
+			t.Fatalf("unexpected error from handle: %v", err)
+		}
+		requested = append(requested, fghc.requested...)
+	}
+
+	expected := []string{"alice", "bob", "carol", "alice"}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Errorf("expected the requested reviewers to be %q, but got %q.", expected, requested)
+	}
+}
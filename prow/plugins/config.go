@@ -76,6 +76,8 @@ type Configuration struct {
 	Heart                Heart                        `json:"heart,omitempty"`
 	Label                Label                        `json:"label,omitempty"`
 	Lgtm                 []Lgtm                       `json:"lgtm,omitempty"`
+	Lifecycle            []Lifecycle                  `json:"lifecycle,omitempty"`
+	LintAnnotations      []LintAnnotations            `json:"lint_annotations,omitempty"`
 	Jira                 *Jira                        `json:"jira,omitempty"`
 	MilestoneApplier     map[string]BranchToMilestone `json:"milestone_applier,omitempty"`
 	RepoMilestone        map[string]Milestone         `json:"repo_milestone,omitempty"`
@@ -159,6 +161,22 @@ type Blunderbuss struct {
 	// additional token per successful reviewer (and potentially more depending on
 	// how many busy reviewers it had to pass over).
 	UseStatusAvailability bool `json:"use_status_availability,omitempty"`
+	// MaxInFlightReviews is the maximum number of open pull requests across the
+	// org that a user may have a pending review request on. Users that reached
+	// it are not requested to review. This will use one additional token per
+	// candidate. Defaults to 0 meaning no limit.
+	MaxInFlightReviews int `json:"max_in_flight_reviews,omitempty"`
+	// OutOfOfficeFile is the path of a file in the repo that lists the periods
+	// during which users are out of office and must not be requested to review.
+	// The file is read from the base branch of the pull request and maps logins
+	// to lists of periods with inclusive 'from' and 'to' dates in UTC, e.g.
+	// 'alice: [{from: 2021-06-01, to: 2021-06-14}]'.
+	OutOfOfficeFile string `json:"out_of_office_file,omitempty"`
+	// RoundRobin controls whether reviewers are selected in a round-robin
+	// fashion instead of randomly, i.e. the candidate whose review was
+	// requested longest ago by this hook instance is selected. The rotation is
+	// kept in memory and starts anew when hook restarts.
+	RoundRobin bool `json:"round_robin,omitempty"`
 }
 
 // Owners contains configuration related to handling OWNERS files.
@@ -178,6 +196,12 @@ type Owners struct {
 	*/
 	MDYAMLRepos []string `json:"mdyamlrepos,omitempty"`
 
+	// CodeOwnersRepos is a list of org and org/repo strings specifying the repos
+	// whose GitHub CODEOWNERS file is used in addition to their OWNERS files.
+	// The owners of a file in CODEOWNERS are treated as approvers and reviewers
+	// in the root OWNERS file. Teams are expanded to their members.
+	CodeOwnersRepos []string `json:"codeowners_repos,omitempty"`
+
 	// SkipCollaborators disables collaborator cross-checks and forces both
 	// the approve and lgtm plugins to use solely OWNERS files for access
 	// control in the provided repos.
@@ -222,6 +246,18 @@ func (c *Configuration) MDYAMLEnabled(org, repo string) bool {
 	return false
 }
 
+// CodeOwnersEnabled returns a boolean denoting if the CODEOWNERS file of the
+// passed repo is used in addition to its OWNERS files.
+func (c *Configuration) CodeOwnersEnabled(org, repo string) bool {
+	full := fmt.Sprintf("%s/%s", org, repo)
+	for _, elem := range c.Owners.CodeOwnersRepos {
+		if elem == org || elem == full {
+			return true
+		}
+	}
+	return false
+}
+
 // SkipCollaborators returns a boolean denoting if collaborator cross-checks are enabled for
 // the passed repo. If it's true, approve and lgtm plugins rely solely on OWNERS files.
 func (c *Configuration) SkipCollaborators(org, repo string) bool {
@@ -356,6 +392,52 @@ type Lgtm struct {
 	StickyLgtmTeam string `json:"trusted_team_for_sticky_lgtm,omitempty"`
 }
 
+// Lifecycle specifies a configuration for the lifecycle controller, which
+// marks inactive issues and PRs as stale, then as rotten and eventually
+// closes them, with the labels of the lifecycle plugin.
+// The configuration for the lifecycle controller is defined as a list of these structures.
+type Lifecycle struct {
+	// Repos is either of the form org/repos or just org.
+	Repos []string `json:"repos,omitempty"`
+	// StaleAfter is how long an issue or PR must be inactive before it is
+	// marked as stale. Defaults to 2160h (90 days).
+	StaleAfter string `json:"stale_after,omitempty"`
+	// RottenAfter is how long a stale issue or PR must be inactive before it
+	// is marked as rotten. Defaults to 720h (30 days).
+	RottenAfter string `json:"rotten_after,omitempty"`
+	// CloseAfter is how long a rotten issue or PR must be inactive before it
+	// is closed. Defaults to 720h (30 days).
+	CloseAfter string `json:"close_after,omitempty"`
+	// ExemptLabels are the labels of the issues and PRs that never age.
+	// Issues and PRs labeled lifecycle/frozen or lifecycle/active are always exempt.
+	ExemptLabels []string `json:"exempt_labels,omitempty"`
+	// SkipIssues disables the lifecycle of issues.
+	SkipIssues bool `json:"skip_issues,omitempty"`
+	// SkipPullRequests disables the lifecycle of PRs.
+	SkipPullRequests bool `json:"skip_pull_requests,omitempty"`
+
+	StaleAfterDuration  time.Duration `json:"-"`
+	RottenAfterDuration time.Duration `json:"-"`
+	CloseAfterDuration  time.Duration `json:"-"`
+}
+
+// LintAnnotations specifies a configuration for the lint-annotations plugin.
+// The configuration for the lint-annotations plugin is defined as a list of these structures.
+type LintAnnotations struct {
+	// Repos is either of the form org/repos or just org.
+	Repos []string `json:"repos,omitempty"`
+	// Jobs are the names of the presubmits whose artifacts are read for lint
+	// findings. Defaults to all presubmits.
+	Jobs []string `json:"jobs,omitempty"`
+	// Artifacts are the glob patterns, as understood by path.Match, that the
+	// names of the SARIF and checkstyle reports in the artifacts directory of
+	// the jobs match. Defaults to "*.sarif", "*.sarif.json" and "checkstyle*.xml".
+	Artifacts []string `json:"artifacts,omitempty"`
+	// MaxComments is the maximum number of findings commented on in a single
+	// review. Defaults to 20.
+	MaxComments int `json:"max_comments,omitempty"`
+}
+
 // Jira holds the config for the jira plugin.
 type Jira struct {
 	// DisabledJiraProjects are projects for which we will never try to create a link,
@@ -828,6 +910,36 @@ func (c *Configuration) LgtmFor(org, repo string) *Lgtm {
 	return &Lgtm{}
 }
 
+// LintAnnotationsFor finds the LintAnnotations for a repo, if one exists.
+// The LintAnnotations can be listed for the repo itself or for the
+// owning organization. Defaults are applied to the returned configuration.
+func (c *Configuration) LintAnnotationsFor(org, repo string) LintAnnotations {
+	var la LintAnnotations
+	fullName := fmt.Sprintf("%s/%s", org, repo)
+	found := false
+	for _, candidate := range c.LintAnnotations {
+		if sets.NewString(candidate.Repos...).Has(fullName) {
+			la, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		for _, candidate := range c.LintAnnotations {
+			if sets.NewString(candidate.Repos...).Has(org) {
+				la = candidate
+				break
+			}
+		}
+	}
+	if len(la.Artifacts) == 0 {
+		la.Artifacts = []string{"*.sarif", "*.sarif.json", "checkstyle*.xml"}
+	}
+	if la.MaxComments == 0 {
+		la.MaxComments = 20
+	}
+	return la
+}
+
 // TriggerFor finds the Trigger for a repo, if one exists
 // a trigger can be listed for the repo itself or for the
 // owning organization
@@ -988,6 +1100,17 @@ func (c *Configuration) setDefaults() {
 	for i := range c.Triggers {
 		c.Triggers[i].SetDefaults()
 	}
+	for i := range c.Lifecycle {
+		if c.Lifecycle[i].StaleAfter == "" {
+			c.Lifecycle[i].StaleAfter = "2160h"
+		}
+		if c.Lifecycle[i].RottenAfter == "" {
+			c.Lifecycle[i].RottenAfter = "720h"
+		}
+		if c.Lifecycle[i].CloseAfter == "" {
+			c.Lifecycle[i].CloseAfter = "720h"
+		}
+	}
 	if c.SigMention.Regexp == "" {
 		c.SigMention.Regexp = `(?m)@kubernetes/sig-([\w-]*)-(misc|test-failures|bugs|feature-requests|proposals|pr-reviews|api-reviews)`
 	}
@@ -1055,6 +1178,42 @@ func validateSizes(size Size) error {
 	return nil
 }
 
+func validateLifecycle(config []Lifecycle) error {
+	seen := sets.NewString()
+	for _, l := range config {
+		if len(l.Repos) == 0 {
+			return errors.New("lifecycle: every entry must specify repos")
+		}
+		for _, repo := range l.Repos {
+			if seen.Has(repo) {
+				return fmt.Errorf("lifecycle: %s is configured more than once", repo)
+			}
+			seen.Insert(repo)
+		}
+		if l.StaleAfterDuration <= 0 || l.RottenAfterDuration <= 0 || l.CloseAfterDuration <= 0 {
+			return fmt.Errorf("lifecycle for %v: stale_after, rotten_after and close_after must be positive", l.Repos)
+		}
+		if l.SkipIssues && l.SkipPullRequests {
+			return fmt.Errorf("lifecycle for %v: skip_issues and skip_pull_requests cannot both be set", l.Repos)
+		}
+	}
+	return nil
+}
+
+func validateLintAnnotations(config []LintAnnotations) error {
+	for _, la := range config {
+		if la.MaxComments < 0 {
+			return fmt.Errorf("lint_annotations for %v: max_comments must not be negative", la.Repos)
+		}
+		for _, pattern := range la.Artifacts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("lint_annotations for %v: invalid artifact pattern %q: %w", la.Repos, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
 func findDuplicatedPluginConfig(repoConfig, orgConfig []string) []string {
 	var dupes []string
 	for _, repoPlugin := range repoConfig {
@@ -1102,6 +1261,9 @@ func validateBlunderbuss(b *Blunderbuss) error {
 	if b.ReviewerCount != nil && *b.ReviewerCount < 1 {
 		return fmt.Errorf("invalid request_count: %v (needs to be positive)", *b.ReviewerCount)
 	}
+	if b.MaxInFlightReviews < 0 {
+		return fmt.Errorf("invalid max_in_flight_reviews: %v (needs to be non-negative)", b.MaxInFlightReviews)
+	}
 	return nil
 }
 
@@ -1246,6 +1408,25 @@ func compileRegexpsAndDurations(pc *Configuration) error {
 		}
 		rs[i].GracePeriodDuration = dur
 	}
+
+	for i := range pc.Lifecycle {
+		l := &pc.Lifecycle[i]
+		for _, d := range []struct {
+			name     string
+			value    string
+			duration *time.Duration
+		}{
+			{name: "stale_after", value: l.StaleAfter, duration: &l.StaleAfterDuration},
+			{name: "rotten_after", value: l.RottenAfter, duration: &l.RottenAfterDuration},
+			{name: "close_after", value: l.CloseAfter, duration: &l.CloseAfterDuration},
+		} {
+			dur, err := time.ParseDuration(d.value)
+			if err != nil {
+				return fmt.Errorf("failed to compile lifecycle %s duration: %q, error: %w", d.name, d.value, err)
+			}
+			*d.duration = dur
+		}
+	}
 	return nil
 }
 
@@ -1288,6 +1469,12 @@ func (c *Configuration) Validate() error {
 	if err := validateTrigger(c.Triggers); err != nil {
 		return err
 	}
+	if err := validateLifecycle(c.Lifecycle); err != nil {
+		return err
+	}
+	if err := validateLintAnnotations(c.LintAnnotations); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -218,6 +218,134 @@ func TestTriggerFor(t *testing.T) {
 	}
 }
 
+func TestLintAnnotationsFor(t *testing.T) {
+	config := Configuration{
+		LintAnnotations: []LintAnnotations{
+			{
+				Repos:       []string{"org"},
+				MaxComments: 5,
+			},
+			{
+				Repos:     []string{"org/repo"},
+				Jobs:      []string{"pull-repo-lint"},
+				Artifacts: []string{"report.sarif"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		org, repo string
+		expected  LintAnnotations
+	}{
+		{
+			name:     "repo config",
+			org:      "org",
+			repo:     "repo",
+			expected: LintAnnotations{Repos: []string{"org/repo"}, Jobs: []string{"pull-repo-lint"}, Artifacts: []string{"report.sarif"}, MaxComments: 20},
+		},
+		{
+			name:     "org config",
+			org:      "org",
+			repo:     "other",
+			expected: LintAnnotations{Repos: []string{"org"}, Artifacts: []string{"*.sarif", "*.sarif.json", "checkstyle*.xml"}, MaxComments: 5},
+		},
+		{
+			name:     "default config",
+			org:      "other",
+			repo:     "other",
+			expected: LintAnnotations{Artifacts: []string{"*.sarif", "*.sarif.json", "checkstyle*.xml"}, MaxComments: 20},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.expected, config.LintAnnotationsFor(tc.org, tc.repo)); diff != "" {
+				t.Errorf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLifecycleConfig(t *testing.T) {
+	testCases := []struct {
+		name        string
+		lifecycle   []Lifecycle
+		expected    []Lifecycle
+		expectedErr bool
+	}{
+		{
+			name:      "defaults",
+			lifecycle: []Lifecycle{{Repos: []string{"org"}}},
+			expected: []Lifecycle{{
+				Repos:               []string{"org"},
+				StaleAfter:          "2160h",
+				RottenAfter:         "720h",
+				CloseAfter:          "720h",
+				StaleAfterDuration:  90 * 24 * time.Hour,
+				RottenAfterDuration: 30 * 24 * time.Hour,
+				CloseAfterDuration:  30 * 24 * time.Hour,
+			}},
+		},
+		{
+			name:      "custom durations",
+			lifecycle: []Lifecycle{{Repos: []string{"org/repo"}, StaleAfter: "24h", RottenAfter: "1h", CloseAfter: "1m"}},
+			expected: []Lifecycle{{
+				Repos:               []string{"org/repo"},
+				StaleAfter:          "24h",
+				RottenAfter:         "1h",
+				CloseAfter:          "1m",
+				StaleAfterDuration:  24 * time.Hour,
+				RottenAfterDuration: time.Hour,
+				CloseAfterDuration:  time.Minute,
+			}},
+		},
+		{
+			name:        "invalid duration",
+			lifecycle:   []Lifecycle{{Repos: []string{"org"}, StaleAfter: "90d"}},
+			expectedErr: true,
+		},
+		{
+			name:        "negative duration",
+			lifecycle:   []Lifecycle{{Repos: []string{"org"}, CloseAfter: "-1h"}},
+			expectedErr: true,
+		},
+		{
+			name:        "no repos",
+			lifecycle:   []Lifecycle{{}},
+			expectedErr: true,
+		},
+		{
+			name:        "repo configured twice",
+			lifecycle:   []Lifecycle{{Repos: []string{"org/repo"}}, {Repos: []string{"org", "org/repo"}}},
+			expectedErr: true,
+		},
+		{
+			name:        "neither issues nor PRs",
+			lifecycle:   []Lifecycle{{Repos: []string{"org"}, SkipIssues: true, SkipPullRequests: true}},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Configuration{Lifecycle: tc.lifecycle}
+			c.setDefaults()
+			err := compileRegexpsAndDurations(c)
+			if err == nil {
+				err = validateLifecycle(c.Lifecycle)
+			}
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			if tc.expectedErr {
+				return
+			}
+			if diff := cmp.Diff(tc.expected, c.Lifecycle); diff != "" {
+				t.Errorf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestSetApproveDefaults(t *testing.T) {
 	c := &Configuration{
 		Approve: []Approve{
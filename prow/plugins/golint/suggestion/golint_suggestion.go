@@ -51,7 +51,7 @@ func SuggestCodeChange(p lint.Problem) string {
 		matches := regex.FindStringSubmatch(p.Text)
 		suggestion = handler(p, matches)
 		if suggestion != "" && suggestion != p.LineText {
-			return formatSuggestion(suggestion)
+			return FormatSuggestion(suggestion)
 		}
 	}
 	return ""
@@ -142,6 +142,8 @@ func fixVarDecl(p lint.Problem, matches []string) string {
 	return suggestion
 }
 
-func formatSuggestion(s string) string {
+// FormatSuggestion wraps the replacement of the lines of a review comment in
+// a suggestion block.
+func FormatSuggestion(s string) string {
 	return "```suggestion\n" + s + "```\n"
 }
@@ -0,0 +1,354 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lintannotations defines a Prow plugin that comments on the lines of
+// pull requests with the findings of the SARIF and checkstyle reports that
+// presubmits upload as artifacts.
+package lintannotations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	prowv1 "k8s.io/test-infra/prow/client/clientset/versioned/typed/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/crier/reporters/gcs/util"
+	"k8s.io/test-infra/prow/github"
+	pkgio "k8s.io/test-infra/prow/io"
+	"k8s.io/test-infra/prow/kube"
+	"k8s.io/test-infra/prow/pluginhelp"
+	"k8s.io/test-infra/prow/plugins"
+	"k8s.io/test-infra/prow/plugins/golint"
+	"k8s.io/test-infra/prow/plugins/golint/suggestion"
+	"k8s.io/test-infra/prow/pod-utils/clone"
+)
+
+const (
+	pluginName = "lint-annotations"
+	commentTag = "<!-- lint-annotations -->"
+)
+
+func init() {
+	plugins.RegisterStatusEventHandler(pluginName, handleStatusEvent, helpProvider)
+}
+
+func helpProvider(config *plugins.Configuration, enabledRepos []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
+	configInfo := map[string]string{}
+	for _, repo := range enabledRepos {
+		la := config.LintAnnotationsFor(repo.Org, repo.Repo)
+		jobs := "all presubmits"
+		if len(la.Jobs) > 0 {
+			jobs = strings.Join(la.Jobs, ", ")
+		}
+		configInfo[repo.String()] = fmt.Sprintf("Findings of the reports matching %s in the artifacts of %s are commented on, up to %d per review.", strings.Join(la.Artifacts, ", "), jobs, la.MaxComments)
+	}
+	yamlSnippet, err := plugins.CommentMap.GenYaml(&plugins.Configuration{
+		LintAnnotations: []plugins.LintAnnotations{
+			{
+				Repos:       []string{"org/repo"},
+				Jobs:        []string{"pull-repo-lint"},
+				Artifacts:   []string{"*.sarif"},
+				MaxComments: 20,
+			},
+		},
+	})
+	if err != nil {
+		logrus.WithError(err).Warnf("cannot generate comments for %s plugin", pluginName)
+	}
+	return &pluginhelp.PluginHelp{
+		Description: "The lint-annotations plugin reads the SARIF and checkstyle reports that a presubmit uploads to its artifacts directory when it finishes. It then creates a review on the pull request with a comment, and a suggestion if the linter proposed a fix, for each finding on a line changed by the pull request.",
+		Config:      configInfo,
+		Snippet:     yamlSnippet,
+	}, nil
+}
+
+type githubClient interface {
+	GetFile(org, repo, filepath, commit string) ([]byte, error)
+	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
+	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
+	CreateReview(org, repo string, number int, r github.DraftReview) error
+	ListPullRequestComments(org, repo string, number int) ([]github.ReviewComment, error)
+}
+
+func handleStatusEvent(pc plugins.Agent, se github.StatusEvent) error {
+	if pc.StorageClient == nil {
+		return errors.New("no storage client to read the artifacts of jobs with")
+	}
+	la := pc.PluginConfig.LintAnnotationsFor(se.Repo.Owner.Login, se.Repo.Name)
+	return handle(pc.GitHubClient, pc.ProwJobClient, pc.StorageClient, func() *config.Config { return pc.Config }, la, pc.Logger, se)
+}
+
+func handle(ghc githubClient, pjc prowv1.ProwJobInterface, opener pkgio.Opener, cfg config.Getter, la plugins.LintAnnotations, log *logrus.Entry, se github.StatusEvent) error {
+	// Only finished jobs have uploaded their reports.
+	if se.State != github.StatusSuccess && se.State != github.StatusFailure {
+		return nil
+	}
+	org, repo := se.Repo.Owner.Login, se.Repo.Name
+
+	pj, err := finishedPresubmit(pjc, org, repo, se)
+	if err != nil || pj == nil {
+		return err
+	}
+	if len(la.Jobs) > 0 && !sets.NewString(la.Jobs...).Has(pj.Spec.Job) {
+		return nil
+	}
+	log = log.WithFields(logrus.Fields{"job": pj.Spec.Job, "prowjob": pj.Name})
+	number := pj.Spec.Refs.Pulls[0].Number
+
+	// The positions of the comments are only valid for the head of the pull request.
+	pr, err := ghc.GetPullRequest(org, repo, number)
+	if err != nil {
+		return err
+	}
+	if pr.State != github.PullRequestStateOpen || pr.Head.SHA != se.SHA {
+		return nil
+	}
+
+	findings, err := readFindings(opener, cfg, pj, la.Artifacts, log)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	changes, err := ghc.GetPullRequestChanges(org, repo, number)
+	if err != nil {
+		return err
+	}
+	addedLines := map[string]map[int]int{}
+	for _, change := range changes {
+		if change.Status == github.PullRequestFileRemoved {
+			continue
+		}
+		lines, err := golint.AddedLines(change.Patch)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to compute the added lines of %s.", change.Filename)
+			continue
+		}
+		addedLines[change.Filename] = lines
+	}
+
+	oldComments, err := ghc.ListPullRequestComments(org, repo, number)
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]string{}
+	seen := sets.NewString()
+	var comments []github.DraftReviewComment
+	for _, f := range findings {
+		position, ok := addedLines[f.path][f.line]
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d:%s", f.path, position, f.message)
+		if seen.Has(key) || commentedOn(oldComments, f.path, position, f.message) {
+			continue
+		}
+		seen.Insert(key)
+		comments = append(comments, github.DraftReviewComment{
+			Path:     f.path,
+			Position: position,
+			Body:     commentBody(ghc, org, repo, se.SHA, f.path, f, files, log),
+		})
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		if comments[i].Path != comments[j].Path {
+			return comments[i].Path < comments[j].Path
+		}
+		return comments[i].Position < comments[j].Position
+	})
+
+	s := "s"
+	if len(comments) == 1 {
+		s = ""
+	}
+	body := fmt.Sprintf("%d new lint finding%s of [%s](%s) on lines changed by this pull request.", len(comments), s, pj.Spec.Job, pj.Status.URL)
+	if len(comments) > la.MaxComments {
+		comments = comments[:la.MaxComments]
+		body += fmt.Sprintf(" Only the first %d are commented on.", la.MaxComments)
+	}
+	log.Infof("Commenting on %d lint findings.", len(comments))
+	return ghc.CreateReview(org, repo, number, github.DraftReview{
+		Body:     body,
+		Action:   github.Comment,
+		Comments: comments,
+	})
+}
+
+// finishedPresubmit returns the most recently finished presubmit that
+// reported the status, or nil if there is none.
+func finishedPresubmit(pjc prowv1.ProwJobInterface, org, repo string, se github.StatusEvent) (*prowapi.ProwJob, error) {
+	set := labels.Set{
+		kube.ProwJobTypeLabel: string(prowapi.PresubmitJob),
+		kube.OrgLabel:         org,
+		kube.RepoLabel:        repo,
+	}
+	// The context is a label as well unless it had to be truncated or
+	// shortened to be a valid label value, see decorate.LabelsAndAnnotationsForSpec.
+	if errs := validation.IsValidLabelValue(se.Context); len(errs) == 0 {
+		set[kube.ContextAnnotation] = se.Context
+	}
+	pjs, err := pjc.List(context.TODO(), metav1.ListOptions{LabelSelector: labels.SelectorFromSet(set).String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prowjobs: %w", err)
+	}
+	var latest *prowapi.ProwJob
+	for i := range pjs.Items {
+		pj := &pjs.Items[i]
+		if pj.Spec.Context != se.Context || !pj.Complete() || pj.Status.BuildID == "" {
+			continue
+		}
+		if pj.Spec.Refs == nil || len(pj.Spec.Refs.Pulls) != 1 || pj.Spec.Refs.Pulls[0].SHA != se.SHA {
+			continue
+		}
+		if latest == nil || latest.Status.CompletionTime.Before(pj.Status.CompletionTime) {
+			latest = pj
+		}
+	}
+	return latest, nil
+}
+
+// readFindings reads the findings of the reports in the artifacts of the job
+// whose names match one of the patterns. Reports that cannot be parsed are
+// skipped.
+func readFindings(opener pkgio.Opener, cfg config.Getter, pj *prowapi.ProwJob, patterns []string, log *logrus.Entry) ([]finding, error) {
+	bucket, dir, err := util.GetJobDestination(cfg, pj)
+	if err != nil {
+		return nil, err
+	}
+	pp, err := prowapi.ParsePath(bucket)
+	if err != nil {
+		return nil, err
+	}
+	cloneDir := clone.PathForRefs("/", *pj.Spec.Refs)
+	ctx := context.TODO()
+	prefix := fmt.Sprintf("%s://%s/%s/", pp.StorageProvider(), pp.Bucket(), path.Join(dir, "artifacts"))
+	it, err := opener.Iterator(ctx, prefix, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	var findings []finding
+	for {
+		attrs, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list artifacts: %w", err)
+		}
+		if attrs.IsDir || !matchesAny(path.Base(attrs.Name), patterns) {
+			continue
+		}
+		artifact := fmt.Sprintf("%s://%s/%s", pp.StorageProvider(), pp.Bucket(), attrs.Name)
+		content, err := readArtifact(ctx, opener, artifact)
+		if err != nil {
+			return nil, err
+		}
+		reported, err := parseReport(content)
+		if err != nil {
+			log.WithError(err).Warnf("Skipping report %s.", artifact)
+			continue
+		}
+		for i := range reported {
+			reported[i].path = repoPath(reported[i].path, cloneDir)
+		}
+		findings = append(findings, reported...)
+	}
+	return findings, nil
+}
+
+func readArtifact(ctx context.Context, opener pkgio.Opener, artifact string) ([]byte, error) {
+	r, err := opener.Reader(ctx, artifact)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", artifact, err)
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", artifact, err)
+	}
+	return content, nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// commentedOn determines whether there already is a comment of this plugin
+// with the message at the position.
+func commentedOn(comments []github.ReviewComment, file string, position int, message string) bool {
+	for _, c := range comments {
+		if c.Path == file && c.Position != nil && *c.Position == position && strings.Contains(c.Body, commentTag) && strings.Contains(c.Body, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// commentBody describes the finding, with a suggestion if the linter proposed
+// a fix. The contents of the files are cached in files.
+func commentBody(ghc githubClient, org, repo, sha, file string, f finding, files map[string][]string, log *logrus.Entry) string {
+	var suggested string
+	if f.fix != nil {
+		lines, ok := files[file]
+		if !ok {
+			content, err := ghc.GetFile(org, repo, file, sha)
+			if err != nil {
+				log.WithError(err).Warnf("Failed to get %s to suggest a fix.", file)
+			} else {
+				lines = strings.Split(string(content), "\n")
+			}
+			files[file] = lines
+		}
+		if f.line <= len(lines) {
+			if fixed, ok := f.fix.apply(lines[f.line-1]); ok {
+				suggested = suggestion.FormatSuggestion(strings.TrimSuffix(fixed, "\n") + "\n")
+			}
+		}
+	}
+	var source []string
+	if f.tool != "" {
+		source = append(source, f.tool)
+	}
+	if f.rule != "" {
+		source = append(source, "`"+f.rule+"`")
+	}
+	source = append(source, "("+f.level+")")
+	return fmt.Sprintf("%s%s: %s %s", suggested, strings.Join(source, " "), f.message, commentTag)
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lintannotations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/crier/reporters/gcs/util"
+	"k8s.io/test-infra/prow/github"
+	pkgio "k8s.io/test-infra/prow/io"
+	"k8s.io/test-infra/prow/kube"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// fakeOpener serves the artifacts in files, keyed by their full path.
+type fakeOpener struct {
+	pkgio.Opener
+	files map[string]string
+}
+
+func (o *fakeOpener) Reader(_ context.Context, path string) (pkgio.ReadCloser, error) {
+	content, ok := o.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func (o *fakeOpener) Iterator(_ context.Context, prefix, _ string) (pkgio.ObjectIterator, error) {
+	bucketPrefix := prefix[:strings.Index(prefix, "://")+3]
+	bucketPrefix = bucketPrefix + strings.SplitN(strings.TrimPrefix(prefix, bucketPrefix), "/", 2)[0] + "/"
+	it := &fakeIterator{}
+	for path := range o.files {
+		if strings.HasPrefix(path, prefix) {
+			it.names = append(it.names, strings.TrimPrefix(path, bucketPrefix))
+		}
+	}
+	sort.Strings(it.names)
+	return it, nil
+}
+
+type fakeIterator struct {
+	names []string
+}
+
+func (it *fakeIterator) Next(_ context.Context) (pkgio.ObjectAttributes, error) {
+	if len(it.names) == 0 {
+		return pkgio.ObjectAttributes{}, io.EOF
+	}
+	name := it.names[0]
+	it.names = it.names[1:]
+	return pkgio.ObjectAttributes{Name: name, ObjName: name[strings.LastIndex(name, "/")+1:]}, nil
+}
+
+type fakeGitHubClient struct {
+	pr       *github.PullRequest
+	changes  []github.PullRequestChange
+	files    map[string]string
+	comments []github.ReviewComment
+	reviews  []github.DraftReview
+}
+
+func (f *fakeGitHubClient) GetFile(org, repo, file, commit string) ([]byte, error) {
+	content, ok := f.files[file]
+	if !ok || commit != "head" {
+		return nil, fmt.Errorf("could not find file %s at %s", file, commit)
+	}
+	return []byte(content), nil
+}
+
+func (f *fakeGitHubClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	if number != f.pr.Number {
+		return nil, fmt.Errorf("pull request %d does not exist", number)
+	}
+	return f.pr, nil
+}
+
+func (f *fakeGitHubClient) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
+	return f.changes, nil
+}
+
+func (f *fakeGitHubClient) CreateReview(org, repo string, number int, r github.DraftReview) error {
+	f.reviews = append(f.reviews, r)
+	return nil
+}
+
+func (f *fakeGitHubClient) ListPullRequestComments(org, repo string, number int) ([]github.ReviewComment, error) {
+	return f.comments, nil
+}
+
+const sarifReport = `{
+  "runs": [{
+    "tool": {"driver": {"name": "golangci-lint"}},
+    "results": [
+      {
+        "ruleId": "errcheck",
+        "level": "error",
+        "message": {"text": "Error return value is not checked"},
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "file:///home/prow/go/src/github.com/org/repo/pkg/a.go"}, "region": {"startLine": 2}}}]
+      },
+      {
+        "ruleId": "misspell",
+        "message": {"text": "retrun is a misspelling of return"},
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "pkg/a.go"}, "region": {"startLine": 3, "startColumn": 2, "endColumn": 8}}}],
+        "fixes": [{"artifactChanges": [{"artifactLocation": {"uri": "pkg/a.go"}, "replacements": [{"deletedRegion": {"startLine": 3, "startColumn": 2, "endColumn": 8}, "insertedContent": {"text": "return"}}]}]}]
+      },
+      {
+        "ruleId": "ineffassign",
+        "message": {"text": "ineffectual assignment to err"},
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "file:///home/prow/go/src/github.com/org/dependency/pkg/a.go"}, "region": {"startLine": 2}}}]
+      },
+      {
+        "ruleId": "unused",
+        "message": {"text": "func old is unused"},
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "pkg/a.go"}, "region": {"startLine": 1}}}]
+      }
+    ]
+  }]
+}`
+
+const checkstyleXML = `<checkstyle>
+  <file name="hack/verify.sh">
+    <error line="2" severity="warning" message="Double quote to prevent globbing." source="SC2086"/>
+  </file>
+  <file name="pkg/a.go">
+    <error line="2" severity="error" message="Error return value is not checked"/>
+  </file>
+</checkstyle>`
+
+func TestHandle(t *testing.T) {
+	pa := &plugins.ConfigAgent{}
+	pa.Set(&plugins.Configuration{})
+	defaults := pa.Config().LintAnnotationsFor("org", "repo")
+
+	var testCases = []struct {
+		name            string
+		state           string
+		config          plugins.LintAnnotations
+		headSHA         string
+		reports         map[string]string
+		existing        []github.ReviewComment
+		expectedReviews []github.DraftReview
+	}{
+		{
+			name:    "findings on changed lines are commented on",
+			state:   github.StatusFailure,
+			config:  defaults,
+			headSHA: "head",
+			reports: map[string]string{"lint.sarif": sarifReport, "nested/checkstyle-shellcheck.xml": checkstyleXML, "build-log.txt": "not a report"},
+			expectedReviews: []github.DraftReview{{
+				Body:   "3 new lint findings of [pull-repo-lint](https://prow/view/1) on lines changed by this pull request.",
+				Action: github.Comment,
+				Comments: []github.DraftReviewComment{
+					{Path: "hack/verify.sh", Position: 2, Body: "`SC2086` (warning): Double quote to prevent globbing. " + commentTag},
+					{Path: "pkg/a.go", Position: 2, Body: "golangci-lint `errcheck` (error): Error return value is not checked " + commentTag},
+					{Path: "pkg/a.go", Position: 3, Body: "```suggestion\n\treturn err\n```\ngolangci-lint `misspell` (warning): retrun is a misspelling of return " + commentTag},
+				},
+			}},
+		},
+		{
+			name:    "findings that were already commented on are skipped",
+			state:   github.StatusSuccess,
+			config:  defaults,
+			headSHA: "head",
+			reports: map[string]string{"lint.sarif": sarifReport},
+			existing: []github.ReviewComment{
+				{Path: "pkg/a.go", Position: intPtr(2), Body: "golangci-lint `errcheck` (error): Error return value is not checked " + commentTag},
+			},
+			expectedReviews: []github.DraftReview{{
+				Body:   "1 new lint finding of [pull-repo-lint](https://prow/view/1) on lines changed by this pull request.",
+				Action: github.Comment,
+				Comments: []github.DraftReviewComment{
+					{Path: "pkg/a.go", Position: 3, Body: "```suggestion\n\treturn err\n```\ngolangci-lint `misspell` (warning): retrun is a misspelling of return " + commentTag},
+				},
+			}},
+		},
+		{
+			name:    "number of comments is limited",
+			state:   github.StatusFailure,
+			config:  plugins.LintAnnotations{Artifacts: []string{"*.sarif"}, MaxComments: 1},
+			headSHA: "head",
+			reports: map[string]string{"lint.sarif": sarifReport},
+			expectedReviews: []github.DraftReview{{
+				Body:   "2 new lint findings of [pull-repo-lint](https://prow/view/1) on lines changed by this pull request. Only the first 1 are commented on.",
+				Action: github.Comment,
+				Comments: []github.DraftReviewComment{
+					{Path: "pkg/a.go", Position: 2, Body: "golangci-lint `errcheck` (error): Error return value is not checked " + commentTag},
+				},
+			}},
+		},
+		{
+			name:    "pending statuses are ignored",
+			state:   github.StatusPending,
+			config:  defaults,
+			headSHA: "head",
+			reports: map[string]string{"lint.sarif": sarifReport},
+		},
+		{
+			name:    "other jobs are ignored",
+			state:   github.StatusFailure,
+			config:  plugins.LintAnnotations{Jobs: []string{"pull-repo-verify"}, Artifacts: []string{"*.sarif"}, MaxComments: 20},
+			headSHA: "head",
+			reports: map[string]string{"lint.sarif": sarifReport},
+		},
+		{
+			name:    "outdated commits are ignored",
+			state:   github.StatusFailure,
+			config:  defaults,
+			headSHA: "newer",
+			reports: map[string]string{"lint.sarif": sarifReport},
+		},
+		{
+			name:    "jobs without reports are ignored",
+			state:   github.StatusFailure,
+			config:  defaults,
+			headSHA: "head",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			pj := testProwJob()
+			bucket, dir, err := util.GetJobDestination(cfg, pj)
+			if err != nil {
+				t.Fatalf("failed to get job destination: %v", err)
+			}
+			opener := &fakeOpener{files: map[string]string{}}
+			for name, content := range tc.reports {
+				opener.files[fmt.Sprintf("%s/%s/artifacts/%s", bucket, dir, name)] = content
+			}
+			older := testProwJob()
+			older.Name = "older"
+			older.Status.CompletionTime = &metav1.Time{Time: time.Unix(50, 0)}
+			older.Status.BuildID = "0"
+			pjc := fake.NewSimpleClientset([]runtime.Object{pj, older}...).ProwV1().ProwJobs("prowjobs")
+
+			ghc := &fakeGitHubClient{
+				pr: &github.PullRequest{Number: 1, State: github.PullRequestStateOpen, Head: github.PullRequestBranch{SHA: tc.headSHA}},
+				changes: []github.PullRequestChange{
+					{Filename: "pkg/a.go", Status: string(github.PullRequestFileModified), Patch: "@@ -1,1 +1,3 @@\n func old() {}\n+\terr := f()\n+\tretrun err"},
+					{Filename: "hack/verify.sh", Status: string(github.PullRequestFileAdded), Patch: "@@ -0,0 +1,2 @@\n+#!/bin/bash\n+rm $1"},
+				},
+				files:    map[string]string{"pkg/a.go": "func old() {}\n\terr := f()\n\tretrun err\n"},
+				comments: tc.existing,
+			}
+			se := github.StatusEvent{
+				SHA:     "head",
+				State:   tc.state,
+				Context: "pull-repo-lint",
+				Repo:    github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+
+			if err := handle(ghc, pjc, opener, cfg, tc.config, logrus.WithField("plugin", pluginName), se); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expectedReviews, ghc.reviews); diff != "" {
+				t.Errorf("unexpected reviews (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func testConfig() config.Getter {
+	c := &config.Config{
+		ProwConfig: config.ProwConfig{
+			Plank: config.Plank{
+				DefaultDecorationConfigs: config.DefaultDecorationMapToSliceTesting(
+					map[string]*prowapi.DecorationConfig{"*": {
+						GCSConfiguration: &prowapi.GCSConfiguration{
+							Bucket:       "gs://bucket",
+							PathStrategy: prowapi.PathStrategyExplicit,
+						},
+					}}),
+			},
+		},
+	}
+	return func() *config.Config { return c }
+}
+
+func testProwJob() *prowapi.ProwJob {
+	return &prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "run",
+			Namespace: "prowjobs",
+			Labels: map[string]string{
+				kube.ProwJobTypeLabel:  string(prowapi.PresubmitJob),
+				kube.OrgLabel:          "org",
+				kube.RepoLabel:         "repo",
+				kube.PullLabel:         "1",
+				kube.ContextAnnotation: "pull-repo-lint",
+			},
+		},
+		Spec: prowapi.ProwJobSpec{
+			Type:    prowapi.PresubmitJob,
+			Job:     "pull-repo-lint",
+			Context: "pull-repo-lint",
+			Refs: &prowapi.Refs{
+				Org:     "org",
+				Repo:    "repo",
+				BaseRef: "main",
+				BaseSHA: "base",
+				Pulls:   []prowapi.Pull{{Number: 1, SHA: "head"}},
+			},
+		},
+		Status: prowapi.ProwJobStatus{
+			State:          prowapi.FailureState,
+			StartTime:      metav1.NewTime(time.Unix(100, 0)),
+			CompletionTime: &metav1.Time{Time: time.Unix(200, 0)},
+			BuildID:        "1",
+			URL:            "https://prow/view/1",
+		},
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lintannotations
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// finding is a problem that a linter reported at a line of a file.
+type finding struct {
+	path    string
+	line    int
+	tool    string
+	rule    string
+	level   string
+	message string
+	// fix is the change of the line that the linter proposed, if any.
+	fix *lineFix
+}
+
+// lineFix replaces the columns [startColumn, endColumn) of a line with text.
+// The columns are 1-based and 0 means the start or the end of the line.
+type lineFix struct {
+	startColumn int
+	endColumn   int
+	text        string
+}
+
+// apply returns the line with the fix applied, or false if the columns of
+// the fix are out of the bounds of the line.
+func (f lineFix) apply(line string) (string, bool) {
+	start, end := 0, len(line)
+	if f.startColumn > 0 {
+		start = f.startColumn - 1
+	}
+	if f.endColumn > 0 {
+		end = f.endColumn - 1
+	}
+	if start > end || end > len(line) {
+		return "", false
+	}
+	return line[:start] + f.text + line[end:], true
+}
+
+// parseReport parses the findings of a SARIF or checkstyle report.
+func parseReport(content []byte) ([]finding, error) {
+	content = bytes.TrimSpace(content)
+	switch {
+	case bytes.HasPrefix(content, []byte("{")):
+		return parseSARIF(content)
+	case bytes.HasPrefix(content, []byte("<")):
+		return parseCheckstyle(content)
+	default:
+		return nil, errors.New("neither a SARIF nor a checkstyle report")
+	}
+}
+
+// The subset of SARIF 2.1.0 that is needed to comment on findings, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Runs []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name string `json:"name"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifResult struct {
+	RuleID  string `json:"ruleId"`
+	Level   string `json:"level"`
+	Message struct {
+		Text string `json:"text"`
+	} `json:"message"`
+	Locations []struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	} `json:"locations"`
+	Fixes []struct {
+		ArtifactChanges []struct {
+			ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+			Replacements     []struct {
+				DeletedRegion   sarifRegion `json:"deletedRegion"`
+				InsertedContent *struct {
+					Text string `json:"text"`
+				} `json:"insertedContent"`
+			} `json:"replacements"`
+		} `json:"artifactChanges"`
+	} `json:"fixes"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+func parseSARIF(content []byte) ([]finding, error) {
+	var log sarifLog
+	if err := json.Unmarshal(content, &log); err != nil {
+		return nil, fmt.Errorf("failed to parse SARIF report: %w", err)
+	}
+	var findings []finding
+	for _, run := range log.Runs {
+		for _, result := range run.Results {
+			level := result.Level
+			if level == "" {
+				level = "warning"
+			}
+			if level == "none" || len(result.Locations) == 0 {
+				continue
+			}
+			location := result.Locations[0].PhysicalLocation
+			if location.Region.StartLine == 0 {
+				continue
+			}
+			f := finding{
+				path:    normalizePath(location.ArtifactLocation.URI),
+				line:    location.Region.StartLine,
+				tool:    run.Tool.Driver.Name,
+				rule:    result.RuleID,
+				level:   level,
+				message: result.Message.Text,
+			}
+			if f.message == "" {
+				f.message = result.RuleID
+			}
+			// Only fixes that change the line of the finding can be suggested.
+			if len(result.Fixes) == 1 && len(result.Fixes[0].ArtifactChanges) == 1 {
+				change := result.Fixes[0].ArtifactChanges[0]
+				if len(change.Replacements) == 1 && normalizePath(change.ArtifactLocation.URI) == f.path {
+					replacement := change.Replacements[0]
+					region := replacement.DeletedRegion
+					if region.StartLine == f.line && (region.EndLine == 0 || region.EndLine == f.line) {
+						f.fix = &lineFix{startColumn: region.StartColumn, endColumn: region.EndColumn}
+						if replacement.InsertedContent != nil {
+							f.fix.text = replacement.InsertedContent.Text
+						}
+					}
+				}
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+type checkstyleReport struct {
+	Files []struct {
+		Name   string `xml:"name,attr"`
+		Errors []struct {
+			Line     int    `xml:"line,attr"`
+			Severity string `xml:"severity,attr"`
+			Message  string `xml:"message,attr"`
+			Source   string `xml:"source,attr"`
+		} `xml:"error"`
+	} `xml:"file"`
+}
+
+func parseCheckstyle(content []byte) ([]finding, error) {
+	var report checkstyleReport
+	if err := xml.Unmarshal(content, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse checkstyle report: %w", err)
+	}
+	var findings []finding
+	for _, file := range report.Files {
+		for _, e := range file.Errors {
+			if e.Severity == "ignore" || e.Line == 0 {
+				continue
+			}
+			level := e.Severity
+			if level == "" {
+				level = "error"
+			}
+			findings = append(findings, finding{
+				path:    normalizePath(file.Name),
+				line:    e.Line,
+				rule:    e.Source,
+				level:   level,
+				message: e.Message,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// normalizePath turns the URIs and paths of reports into clean, slash
+// separated paths. They may still be absolute or relative to another
+// directory than the root of the repository.
+func normalizePath(p string) string {
+	if strings.HasPrefix(p, "file://") {
+		if u, err := url.Parse(p); err == nil {
+			p = u.Path
+		}
+	} else if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	return strings.TrimPrefix(path.Clean(p), "./")
+}
+
+// repoPath returns the path of a finding relative to the root of the
+// repository, which the job cloned to cloneDir under its base directory.
+// Other paths are returned as they are and don't match any file of the
+// repository.
+func repoPath(findingPath, cloneDir string) string {
+	if !path.IsAbs(findingPath) {
+		return findingPath
+	}
+	if i := strings.Index(findingPath, cloneDir+"/"); i >= 0 {
+		return findingPath[i+len(cloneDir)+1:]
+	}
+	return findingPath
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lintannotations
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseReport(t *testing.T) {
+	var testCases = []struct {
+		name             string
+		content          string
+		expectedFindings []finding
+		expectedErr      bool
+	}{
+		{
+			name: "SARIF report",
+			content: `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "golangci-lint"}},
+    "results": [
+      {
+        "ruleId": "errcheck",
+        "level": "error",
+        "message": {"text": "Error return value is not checked"},
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "file:///home/prow/go/src/github.com/org/repo/pkg/a.go"}, "region": {"startLine": 3, "startColumn": 2}}}]
+      },
+      {
+        "ruleId": "gofmt",
+        "message": {"text": "File is not gofmt-ed"},
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "pkg/b%20c.go"}, "region": {"startLine": 7}}}],
+        "fixes": [{"artifactChanges": [{"artifactLocation": {"uri": "./pkg/b%20c.go"}, "replacements": [{"deletedRegion": {"startLine": 7, "startColumn": 5, "endColumn": 8}, "insertedContent": {"text": "x"}}]}]}]
+      },
+      {
+        "ruleId": "multiline",
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "pkg/b.go"}, "region": {"startLine": 1}}}],
+        "fixes": [{"artifactChanges": [{"artifactLocation": {"uri": "pkg/b.go"}, "replacements": [{"deletedRegion": {"startLine": 1, "endLine": 2}}]}]}]
+      },
+      {
+        "ruleId": "ignored",
+        "level": "none",
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "pkg/b.go"}, "region": {"startLine": 1}}}]
+      },
+      {
+        "ruleId": "no-location",
+        "message": {"text": "Module is deprecated"}
+      }
+    ]
+  }]
+}`,
+			expectedFindings: []finding{
+				{path: "/home/prow/go/src/github.com/org/repo/pkg/a.go", line: 3, tool: "golangci-lint", rule: "errcheck", level: "error", message: "Error return value is not checked"},
+				{path: "pkg/b c.go", line: 7, tool: "golangci-lint", rule: "gofmt", level: "warning", message: "File is not gofmt-ed", fix: &lineFix{startColumn: 5, endColumn: 8, text: "x"}},
+				{path: "pkg/b.go", line: 1, tool: "golangci-lint", rule: "multiline", level: "warning", message: "multiline"},
+			},
+		},
+		{
+			name: "checkstyle report",
+			content: `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="src/Main.java">
+    <error line="12" column="5" severity="warning" message="Missing a Javadoc comment." source="com.puppycrawl.tools.checkstyle.checks.javadoc.MissingJavadocMethodCheck"/>
+    <error line="20" severity="ignore" message="Ignored."/>
+  </file>
+  <file name="./lib/util.sh">
+    <error line="4" message="Double quote to prevent globbing."/>
+  </file>
+</checkstyle>`,
+			expectedFindings: []finding{
+				{path: "src/Main.java", line: 12, rule: "com.puppycrawl.tools.checkstyle.checks.javadoc.MissingJavadocMethodCheck", level: "warning", message: "Missing a Javadoc comment."},
+				{path: "lib/util.sh", line: 4, level: "error", message: "Double quote to prevent globbing."},
+			},
+		},
+		{
+			name:        "unknown format",
+			content:     "a.go:1: something is wrong",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid SARIF",
+			content:     `{"runs": [`,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			findings, err := parseReport([]byte(tc.content))
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			if diff := cmp.Diff(tc.expectedFindings, findings, cmp.AllowUnexported(finding{}, lineFix{})); diff != "" {
+				t.Errorf("unexpected findings (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLineFixApply(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		fix        lineFix
+		expected   string
+		expectedOK bool
+	}{
+		{
+			name:       "whole line",
+			fix:        lineFix{text: "\treturn nil\n"},
+			expected:   "\treturn nil\n",
+			expectedOK: true,
+		},
+		{
+			name:       "columns",
+			fix:        lineFix{startColumn: 2, endColumn: 8, text: "return"},
+			expected:   "\treturn err",
+			expectedOK: true,
+		},
+		{
+			name:       "until the end of the line",
+			fix:        lineFix{startColumn: 9, text: "nil"},
+			expected:   "\tretrun nil",
+			expectedOK: true,
+		},
+		{
+			name: "out of bounds",
+			fix:  lineFix{startColumn: 2, endColumn: 20, text: "return"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fixed, ok := tc.fix.apply("\tretrun err")
+			if ok != tc.expectedOK || fixed != tc.expected {
+				t.Errorf("expected %q and %t, got %q and %t", tc.expected, tc.expectedOK, fixed, ok)
+			}
+		})
+	}
+}
+
+func TestRepoPath(t *testing.T) {
+	for findingPath, expected := range map[string]string{
+		"pkg/a.go": "pkg/a.go",
+		"/home/prow/go/src/github.com/org/repo/pkg/a.go":           "pkg/a.go",
+		"/home/prow/go/src/github.com/org/repo-fork/pkg/a.go":      "/home/prow/go/src/github.com/org/repo-fork/pkg/a.go",
+		"/home/prow/go/src/github.com/org/other/src/repo/pkg/a.go": "/home/prow/go/src/github.com/org/other/src/repo/pkg/a.go",
+		"/workspace/repo/pkg/a.go":                                 "/workspace/repo/pkg/a.go",
+	} {
+		if actual := repoPath(findingPath, "/src/github.com/org/repo"); actual != expected {
+			t.Errorf("expected the path of %s in the repository to be %s, got %s", findingPath, expected, actual)
+		}
+	}
+}
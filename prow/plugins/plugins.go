@@ -44,6 +44,7 @@ import (
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/git/v2"
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/io"
 	"k8s.io/test-infra/prow/jira"
 	"k8s.io/test-infra/prow/pluginhelp"
 	"k8s.io/test-infra/prow/repoowners"
@@ -64,6 +65,10 @@ var (
 	CommentMap, _              = genyaml.NewCommentMap()
 )
 
+// ErrUnsupported is returned for the plugins and APIs that the provider of a
+// repo, like GitLab, doesn't support. Handlers failing with it aren't retried.
+var ErrUnsupported = errors.New("not supported by the provider of the repo")
+
 func init() {
 	// This requires the source code to be present and to be in the right relative
 	// location to the working directory. Don't even bother to try outside of the
@@ -175,6 +180,10 @@ type Agent struct {
 	SlackClient               *slack.Client
 	BugzillaClient            bugzilla.Client
 	JiraClient                jira.Client
+	// StorageClient reads the artifacts of jobs from blob storage.
+	StorageClient io.Opener
+	// ReviewTracker remembers the review requests of plugins.
+	ReviewTracker *ReviewTracker
 
 	OwnersClient repoowners.Interface
 
@@ -209,6 +218,8 @@ func NewAgent(configAgent *config.Agent, pluginConfigAgent *ConfigAgent, clientA
 		OwnersClient:              clientAgent.OwnersClient.WithFields(logger.Data).WithGitHubClient(gitHubClient),
 		BugzillaClient:            clientAgent.BugzillaClient.WithFields(logger.Data).ForPlugin(plugin),
 		JiraClient:                clientAgent.JiraClient,
+		StorageClient:             clientAgent.StorageClient,
+		ReviewTracker:             clientAgent.ReviewTracker,
 		Metrics:                   metrics,
 		Config:                    prowConfig,
 		PluginConfig:              pluginConfig,
@@ -245,6 +256,8 @@ type ClientAgent struct {
 	OwnersClient              repoowners.Interface
 	BugzillaClient            bugzilla.Client
 	JiraClient                jira.Client
+	StorageClient             io.Opener
+	ReviewTracker             *ReviewTracker
 }
 
 // ConfigAgent contains the agent mutex and the Agent configuration.
@@ -162,7 +162,7 @@ func handleComment(gc githubClient, log *logrus.Entry, ic github.IssueCommentEve
 	}
 
 	// Don't allow the /release-note-none command if the release-note block contains a valid release note.
-	blockNL := determineReleaseNoteLabel(ic.Issue.Body, labelsSet(ic.Issue.Labels))
+	blockNL := DetermineReleaseNoteLabel(ic.Issue.Body, labelsSet(ic.Issue.Labels))
 	if blockNL == labels.ReleaseNote || blockNL == labels.ReleaseNoteActionRequired {
 		format := "you can only set the release note label to %s if the release-note block in the PR body text is empty or \"none\"."
 		resp := fmt.Sprintf(format, labels.ReleaseNoteNone)
@@ -253,7 +253,7 @@ func handlePR(gc githubClient, log *logrus.Entry, pr *github.PullRequestEvent) e
 	prLabels := labelsSet(prInitLabels)
 
 	var comments []github.IssueComment
-	labelToAdd := determineReleaseNoteLabel(pr.PullRequest.Body, prLabels)
+	labelToAdd := DetermineReleaseNoteLabel(pr.PullRequest.Body, prLabels)
 
 	if labelToAdd == labels.ReleaseNoteLabelNeeded {
 		if !prMustFollowRelNoteProcess(gc, log, pr, prLabels, true) {
@@ -350,10 +350,10 @@ func ensureNoRelNoteNeededLabel(gc githubClient, log *logrus.Entry, pr *github.P
 	}
 }
 
-// determineReleaseNoteLabel returns the label to be added based on the contents of the 'release-note'
+// DetermineReleaseNoteLabel returns the label to be added based on the contents of the 'release-note'
 // section of a PR's body text, as well as the set of PR's labels.
-func determineReleaseNoteLabel(body string, prLabels sets.String) string {
-	composedReleaseNote := strings.ToLower(strings.TrimSpace(getReleaseNote(body)))
+func DetermineReleaseNoteLabel(body string, prLabels sets.String) string {
+	composedReleaseNote := strings.ToLower(strings.TrimSpace(GetReleaseNote(body)))
 	hasNoneNoteInPRBody := noneRe.MatchString(composedReleaseNote)
 	hasDeprecationLabel := prLabels.Has(labels.DeprecationLabel)
 
@@ -375,9 +375,9 @@ func determineReleaseNoteLabel(body string, prLabels sets.String) string {
 	}
 }
 
-// getReleaseNote returns the release note from a PR body
+// GetReleaseNote returns the release note from a PR body
 // assumes that the PR body followed the PR template
-func getReleaseNote(body string) string {
+func GetReleaseNote(body string) string {
 	potentialMatch := noteMatcherRE.FindStringSubmatch(body)
 	if potentialMatch == nil {
 		return ""
@@ -484,7 +484,7 @@ func editReleaseNote(gc githubClient, log *logrus.Entry, ic github.IssueCommentE
 		)
 	}
 
-	newNote := getReleaseNote(ic.Comment.Body)
+	newNote := GetReleaseNote(ic.Comment.Body)
 	if newNote == "" {
 		return gc.CreateComment(
 			org, repo, ic.Issue.Number,
@@ -576,11 +576,11 @@ func TestGetReleaseNote(t *testing.T) {
 	}
 
 	for testNum, test := range tests {
-		calculatedReleaseNote := getReleaseNote(test.body)
+		calculatedReleaseNote := GetReleaseNote(test.body)
 		if test.expectedReleaseNote != calculatedReleaseNote {
 			t.Errorf("Test %v: Expected %v as the release note, got %v", testNum, test.expectedReleaseNote, calculatedReleaseNote)
 		}
-		calculatedLabel := determineReleaseNoteLabel(test.body, test.labels)
+		calculatedLabel := DetermineReleaseNoteLabel(test.body, test.labels)
 		if test.expectedReleaseNoteVariable != calculatedLabel {
 			t.Errorf("Test %v: Expected %v as the release note label, got %v", testNum, test.expectedReleaseNoteVariable, calculatedLabel)
 		}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"sync"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// ReviewTracker remembers the order in which reviews were requested from
+// users, so that plugins can select reviewers in a round-robin fashion. It is
+// kept in memory, so the rotation starts anew when hook restarts.
+type ReviewTracker struct {
+	lock sync.Mutex
+	// requests counts the recorded review requests.
+	requests int
+	// last maps orgs to the number of the last review request of each login.
+	last map[string]map[string]int
+}
+
+// NewReviewTracker returns a ReviewTracker without recorded review requests.
+func NewReviewTracker() *ReviewTracker {
+	return &ReviewTracker{last: map[string]map[string]int{}}
+}
+
+// Record remembers that reviews were just requested from logins.
+func (t *ReviewTracker) Record(org string, logins []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.last[org] == nil {
+		t.last[org] = map[string]int{}
+	}
+	t.requests++
+	for _, login := range logins {
+		t.last[org][github.NormLogin(login)] = t.requests
+	}
+}
+
+// LeastRecent returns the candidate whose review was requested longest ago,
+// preferring candidates whose review was never requested. Ties are broken by
+// the order of candidates.
+func (t *ReviewTracker) LeastRecent(org string, candidates []string) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var selected string
+	var selectedRequest int
+	for i, candidate := range candidates {
+		request := t.last[org][github.NormLogin(candidate)]
+		if i == 0 || request < selectedRequest {
+			selected, selectedRequest = candidate, request
+		}
+	}
+	return selected
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import "testing"
+
+func TestReviewTrackerLeastRecent(t *testing.T) {
+	tracker := NewReviewTracker()
+	candidates := []string{"alice", "bob", "carol"}
+	if actual := tracker.LeastRecent("org", candidates); actual != "alice" {
+		t.Errorf("expected the first candidate without requests, got %q", actual)
+	}
+
+	tracker.Record("org", []string{"Bob"})
+	tracker.Record("org", []string{"alice", "carol"})
+	tracker.Record("other-org", []string{"bob"})
+	if actual := tracker.LeastRecent("org", candidates); actual != "bob" {
+		t.Errorf("expected the candidate whose review was requested longest ago, got %q", actual)
+	}
+	if actual := tracker.LeastRecent("org", []string{"alice", "carol", "dave"}); actual != "dave" {
+		t.Errorf("expected the candidate without requests, got %q", actual)
+	}
+}
@@ -18,6 +18,7 @@ package trigger
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"k8s.io/test-infra/prow/kube"
@@ -133,12 +134,44 @@ func handleGenericComment(c Client, trigger plugins.Trigger, gc github.GenericCo
 	if needsHelp, note := pjutil.ShouldRespondWithHelp(gc.Body, len(toTest)); needsHelp {
 		return addHelpComment(c.GitHubClient, gc.Body, org, repo, pr.Base.Ref, pr.Number, presubmits, gc.HTMLURL, commentAuthor, note, c.Logger)
 	}
+	toTest, parameters, invalid := presubmitParameters(gc.Body, toTest)
+	if len(invalid) > 0 {
+		resp := fmt.Sprintf("The following jobs were not triggered because of invalid parameters:\n- %s", strings.Join(invalid, "\n- "))
+		c.Logger.Infof("Commenting \"%s\".", resp)
+		if err := c.GitHubClient.CreateComment(org, repo, number, plugins.FormatResponseRaw(gc.Body, gc.HTMLURL, gc.User.Login, resp)); err != nil {
+			return err
+		}
+	}
 	// we want to be able to track re-tests separately from the general body of tests
 	additionalLabels := map[string]string{}
 	if pjutil.RetestRe.MatchString(gc.Body) || pjutil.RetestRequiredRe.MatchString(gc.Body) {
 		additionalLabels[kube.RetestLabel] = "true"
 	}
-	return RunRequestedWithLabels(c, pr, baseSHA, toTest, gc.GUID, additionalLabels)
+	return runRequested(c, pr, baseSHA, toTest, gc.GUID, additionalLabels, parameters)
+}
+
+// presubmitParameters returns the presubmits whose parameters passed in the
+// comment are valid along with their parameters, and a description of the
+// presubmits whose parameters are invalid. Presubmits that don't declare
+// parameters ignore arguments.
+func presubmitParameters(body string, presubmits []config.Presubmit) ([]config.Presubmit, map[string]map[string]string, []string) {
+	var valid []config.Presubmit
+	parameters := map[string]map[string]string{}
+	var invalid []string
+	for _, presubmit := range presubmits {
+		if len(presubmit.Parameters) == 0 {
+			valid = append(valid, presubmit)
+			continue
+		}
+		values, err := pjutil.ParametersFromComment(body, presubmit)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", presubmit.Name, err))
+			continue
+		}
+		valid = append(valid, presubmit)
+		parameters[presubmit.Name] = values
+	}
+	return valid, parameters, invalid
 }
 
 func HonorOkToTest(trigger plugins.Trigger) bool {
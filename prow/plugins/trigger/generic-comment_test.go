@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/sirupsen/logrus"
+	coreapi "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	clienttesting "k8s.io/client-go/testing"
 
@@ -32,6 +33,7 @@ import (
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/github/fakegithub"
+	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/labels"
 	"k8s.io/test-infra/prow/pjutil"
 	"k8s.io/test-infra/prow/plugins"
@@ -1469,3 +1471,149 @@ func TestRetestFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleGenericCommentParameters(t *testing.T) {
+	presubmits := map[string][]config.Presubmit{
+		"org/repo": {
+			{
+				JobBase: config.JobBase{
+					Name: "e2e",
+					Spec: &coreapi.PodSpec{Containers: []coreapi.Container{{
+						Image: "e2e",
+						Env:   []coreapi.EnvVar{{Name: "FOCUS", Value: "config"}},
+					}}},
+				},
+				Reporter:     config.Reporter{Context: "pull-e2e"},
+				Trigger:      `(?m)^/test (?:.*? )?e2e(?: .*?)?$`,
+				RerunCommand: "/test e2e",
+				Parameters: []config.PresubmitParameter{
+					{Name: "FOCUS", Default: "Conformance"},
+					{Name: "NODES", Default: "3", Pattern: "[0-9]+"},
+				},
+			},
+			{
+				JobBase:      config.JobBase{Name: "unit"},
+				Reporter:     config.Reporter{Context: "pull-unit"},
+				Trigger:      `(?m)^/test (?:.*? )?unit(?: .*?)?$`,
+				RerunCommand: "/test unit",
+			},
+		},
+	}
+
+	testCases := []struct {
+		name                string
+		body                string
+		expectedContexts    sets.String
+		expectedEnv         map[string]string
+		expectedAnnotation  string
+		expectedCommentPart string
+	}{
+		{
+			name:               "defaults are used without arguments",
+			body:               "/test e2e",
+			expectedContexts:   sets.NewString("pull-e2e"),
+			expectedEnv:        map[string]string{"FOCUS": "Conformance", "NODES": "3"},
+			expectedAnnotation: `{"FOCUS":"Conformance","NODES":"3"}`,
+		},
+		{
+			name:               "arguments override defaults and the job config",
+			body:               "/test e2e FOCUS=Networking\n/test unit NODES=5",
+			expectedContexts:   sets.NewString("pull-e2e", "pull-unit"),
+			expectedEnv:        map[string]string{"FOCUS": "Networking", "NODES": "3"},
+			expectedAnnotation: `{"FOCUS":"Networking","NODES":"3"}`,
+		},
+		{
+			name:                "job with invalid arguments is not triggered",
+			body:                "/test e2e unit NODES=many",
+			expectedContexts:    sets.NewString("pull-unit"),
+			expectedCommentPart: `e2e: parameter NODES of job e2e: value "many" does not match "[0-9]+"`,
+		},
+		{
+			name:                "undeclared parameters are rejected",
+			body:                "/test e2e REGION=us",
+			expectedContexts:    sets.NewString(),
+			expectedCommentPart: "e2e: job e2e has no parameter REGION",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := fakegithub.NewFakeClient()
+			g.IssueComments = map[int][]github.IssueComment{}
+			g.OrgMembers = map[string][]string{"org": {"trusted-member"}}
+			g.PullRequests = map[int]*github.PullRequest{
+				0: {
+					Head: github.PullRequestBranch{SHA: "cafe"},
+					Base: github.PullRequestBranch{
+						Ref:  "master",
+						Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+					},
+				},
+			}
+			fakeConfig := &config.Config{ProwConfig: config.ProwConfig{ProwJobNamespace: "prowjobs"}}
+			if err := fakeConfig.SetPresubmits(presubmits); err != nil {
+				t.Fatalf("failed to set presubmits: %v", err)
+			}
+			fakeProwJobClient := fake.NewSimpleClientset()
+			c := Client{
+				GitHubClient:  g,
+				ProwJobClient: fakeProwJobClient.ProwV1().ProwJobs(fakeConfig.ProwJobNamespace),
+				Config:        fakeConfig,
+				Logger:        logrus.WithField("plugin", PluginName),
+			}
+			event := github.GenericCommentEvent{
+				Action:     github.GenericCommentActionCreated,
+				Repo:       github.Repo{Owner: github.User{Login: "org"}, Name: "repo", FullName: "org/repo"},
+				Body:       tc.body,
+				User:       github.User{Login: "trusted-member"},
+				IssueState: "open",
+				IsPR:       true,
+			}
+			trigger := plugins.Trigger{}
+			trigger.SetDefaults()
+			if err := handleGenericComment(c, trigger, event); err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			startedContexts := sets.NewString()
+			for _, action := range fakeProwJobClient.Fake.Actions() {
+				create, ok := action.(clienttesting.CreateActionImpl)
+				if !ok {
+					continue
+				}
+				pj := create.Object.(*prowapi.ProwJob)
+				startedContexts.Insert(pj.Spec.Context)
+				if pj.Spec.Job != "e2e" {
+					continue
+				}
+				if annotation := pj.Annotations[kube.ParametersAnnotation]; annotation != tc.expectedAnnotation {
+					t.Errorf("expected parameters annotation %q, got %q", tc.expectedAnnotation, annotation)
+				}
+				env := map[string]string{}
+				for _, e := range pj.Spec.PodSpec.Containers[0].Env {
+					env[e.Name] = e.Value
+				}
+				if !reflect.DeepEqual(tc.expectedEnv, env) {
+					t.Errorf("expected env %v, got %v", tc.expectedEnv, env)
+				}
+			}
+			if !startedContexts.Equal(tc.expectedContexts) {
+				t.Errorf("expected contexts %v to be started, got %v", tc.expectedContexts.List(), startedContexts.List())
+			}
+			if env := presubmits["org/repo"][0].Spec.Containers[0].Env; len(env) != 1 || env[0].Value != "config" {
+				t.Errorf("expected the job config not to be modified, got env %v", env)
+			}
+
+			var comments []string
+			for _, comment := range g.IssueComments[0] {
+				comments = append(comments, comment.Body)
+			}
+			if tc.expectedCommentPart == "" && len(comments) > 0 {
+				t.Errorf("expected no comment, got %v", comments)
+			}
+			if tc.expectedCommentPart != "" && (len(comments) != 1 || !strings.Contains(comments[0], tc.expectedCommentPart)) {
+				t.Errorf("expected a comment containing %q, got %v", tc.expectedCommentPart, comments)
+			}
+		})
+	}
+}
@@ -118,11 +118,11 @@ func helpProvider(config *plugins.Configuration, enabledRepos []config.OrgRepo)
 		Examples:    []string{"/ok-to-test"},
 	})
 	pluginHelp.AddCommand(pluginhelp.Command{
-		Usage:       "/test [<job name>|all]",
-		Description: "Manually starts a/all automatically triggered test job(s). Lists all possible job(s) when no jobs/an invalid job are specified.",
+		Usage:       "/test [<job name> [<NAME>=<value>...]|all]",
+		Description: "Manually starts a/all automatically triggered test job(s). Lists all possible job(s) when no jobs/an invalid job are specified. Values can be passed for the parameters declared by a job.",
 		Featured:    true,
 		WhoCanUse:   "Anyone can trigger this command on a trusted PR.",
-		Examples:    []string{"/test all", "/test pull-bazel-test"},
+		Examples:    []string{"/test all", "/test pull-bazel-test", "/test pull-e2e FOCUS=Networking"},
 	})
 	pluginHelp.AddCommand(pluginhelp.Command{
 		Usage:       "/retest",
@@ -296,19 +296,22 @@ func validateContextOverlap(toRun, toSkip []config.Presubmit) error {
 
 // RunRequested executes the config.Presubmits that are requested
 func RunRequested(c Client, pr *github.PullRequest, baseSHA string, requestedJobs []config.Presubmit, eventGUID string) error {
-	return runRequested(c, pr, baseSHA, requestedJobs, eventGUID, nil)
+	return runRequested(c, pr, baseSHA, requestedJobs, eventGUID, nil, nil)
 }
 
 // RunRequestedWithLabels executes the config.Presubmits that are requested with the additional labels
 func RunRequestedWithLabels(c Client, pr *github.PullRequest, baseSHA string, requestedJobs []config.Presubmit, eventGUID string, labels map[string]string) error {
-	return runRequested(c, pr, baseSHA, requestedJobs, eventGUID, labels)
+	return runRequested(c, pr, baseSHA, requestedJobs, eventGUID, labels, nil)
 }
 
-func runRequested(c Client, pr *github.PullRequest, baseSHA string, requestedJobs []config.Presubmit, eventGUID string, labels map[string]string, millisecondOverride ...time.Duration) error {
+// runRequested executes the requested presubmits. parameters maps the names of
+// presubmits to the values of their parameters.
+func runRequested(c Client, pr *github.PullRequest, baseSHA string, requestedJobs []config.Presubmit, eventGUID string, labels map[string]string, parameters map[string]map[string]string, millisecondOverride ...time.Duration) error {
 	var errors []error
 	for _, job := range requestedJobs {
 		c.Logger.Infof("Starting %s build.", job.Name)
 		pj := pjutil.NewPresubmit(*pr, baseSHA, job, eventGUID, labels)
+		pjutil.SetParameters(&pj, parameters[job.Name])
 		c.Logger.WithFields(pjutil.ProwJobFields(&pj)).Info("Creating a new prowjob.")
 		if err := createWithRetry(context.TODO(), c.ProwJobClient, &pj, millisecondOverride...); err != nil {
 			c.Logger.WithError(err).Error("Failed to create prowjob.")
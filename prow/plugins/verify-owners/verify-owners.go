@@ -66,7 +66,7 @@ func init() {
 
 func helpProvider(c *plugins.Configuration, orgRepo []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
 	pluginHelp := &pluginhelp.PluginHelp{
-		Description: fmt.Sprintf("The verify-owners plugin validates %s and %s files (by default) and ensures that they always contain collaborators of the org, if they are modified in a PR. On validation failure it automatically adds the '%s' label to the PR, and a review comment on the incriminating file(s). Per-repo configuration for filenames is possible.", ownersconfig.DefaultOwnersFile, ownersconfig.DefaultOwnersAliasesFile, labels.InvalidOwners),
+		Description: fmt.Sprintf("The verify-owners plugin validates %s and %s files (by default) as well as the GitHub CODEOWNERS files of the repos that use them, and ensures that they always contain collaborators of the org, if they are modified in a PR. CODEOWNERS files may only list the approvers of the paths in the OWNERS files. On validation failure it automatically adds the '%s' label to the PR, and a review comment on the incriminating file(s). Per-repo configuration for filenames is possible.", ownersconfig.DefaultOwnersFile, ownersconfig.DefaultOwnersAliasesFile, labels.InvalidOwners),
 		Config:      map[string]string{},
 	}
 	defaultFilenames := c.OwnersFilenames("", "")
@@ -155,7 +155,7 @@ func handlePullRequest(pc plugins.Agent, pre github.PullRequestEvent) error {
 		number:       pre.Number,
 	}
 
-	return handle(pc.GitHubClient, pc.GitClient, pc.OwnersClient, pc.Logger, &pre.PullRequest, prInfo, pc.PluginConfig.Owners.LabelsDenyList, pc.PluginConfig.TriggerFor(pre.Repo.Owner.Login, pre.Repo.Name), skipTrustedUserCheck, cp, pc.PluginConfig.OwnersFilenames)
+	return handle(pc.GitHubClient, pc.GitClient, pc.OwnersClient, pc.Logger, &pre.PullRequest, prInfo, pc.PluginConfig.Owners.LabelsDenyList, pc.PluginConfig.TriggerFor(pre.Repo.Owner.Login, pre.Repo.Name), skipTrustedUserCheck, pc.PluginConfig.CodeOwnersEnabled(pre.Repo.Owner.Login, pre.Repo.Name), cp, pc.PluginConfig.OwnersFilenames)
 }
 
 func handleGenericCommentEvent(pc plugins.Agent, e github.GenericCommentEvent) error {
@@ -172,10 +172,10 @@ func handleGenericCommentEvent(pc plugins.Agent, e github.GenericCommentEvent) e
 		}
 	}
 
-	return handleGenericComment(pc.GitHubClient, pc.GitClient, pc.OwnersClient, pc.Logger, &e, pc.PluginConfig.Owners.LabelsDenyList, pc.PluginConfig.TriggerFor(e.Repo.Owner.Login, e.Repo.Name), skipTrustedUserCheck, cp, pc.PluginConfig.OwnersFilenames)
+	return handleGenericComment(pc.GitHubClient, pc.GitClient, pc.OwnersClient, pc.Logger, &e, pc.PluginConfig.Owners.LabelsDenyList, pc.PluginConfig.TriggerFor(e.Repo.Owner.Login, e.Repo.Name), skipTrustedUserCheck, pc.PluginConfig.CodeOwnersEnabled(e.Repo.Owner.Login, e.Repo.Name), cp, pc.PluginConfig.OwnersFilenames)
 }
 
-func handleGenericComment(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *logrus.Entry, ce *github.GenericCommentEvent, bannedLabels []string, triggerConfig plugins.Trigger, skipTrustedUserCheck bool, cp commentPruner, resolver ownersconfig.Resolver) error {
+func handleGenericComment(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *logrus.Entry, ce *github.GenericCommentEvent, bannedLabels []string, triggerConfig plugins.Trigger, skipTrustedUserCheck, codeOwnersEnabled bool, cp commentPruner, resolver ownersconfig.Resolver) error {
 	// Only consider open PRs and new comments.
 	if ce.IssueState != "open" || !ce.IsPR || ce.Action != github.GenericCommentActionCreated {
 		return nil
@@ -197,7 +197,7 @@ func handleGenericComment(ghc githubClient, gc git.ClientFactory, roc repoowners
 		return err
 	}
 
-	return handle(ghc, gc, roc, log, pr, prInfo, bannedLabels, triggerConfig, skipTrustedUserCheck, cp, resolver)
+	return handle(ghc, gc, roc, log, pr, prInfo, bannedLabels, triggerConfig, skipTrustedUserCheck, codeOwnersEnabled, cp, resolver)
 }
 
 type messageWithLine struct {
@@ -205,7 +205,7 @@ type messageWithLine struct {
 	message string
 }
 
-func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *logrus.Entry, pr *github.PullRequest, info info, bannedLabels []string, triggerConfig plugins.Trigger, skipTrustedUserCheck bool, cp commentPruner, resolver ownersconfig.Resolver) error {
+func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *logrus.Entry, pr *github.PullRequest, info info, bannedLabels []string, triggerConfig plugins.Trigger, skipTrustedUserCheck, codeOwnersEnabled bool, cp commentPruner, resolver ownersconfig.Resolver) error {
 	org := info.org
 	repo := info.repo
 	number := info.number
@@ -226,6 +226,14 @@ func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *l
 		}
 	}
 
+	// List modified CODEOWNERS files, if the repo uses them.
+	var modifiedCodeOwnersFiles []github.PullRequestChange
+	for _, change := range changes {
+		if codeOwnersEnabled && repoowners.IsCodeOwnersFile(change.Filename) && change.Status != github.PullRequestFileRemoved {
+			modifiedCodeOwnersFiles = append(modifiedCodeOwnersFiles, change)
+		}
+	}
+
 	// Check if the OWNERS_ALIASES file was modified.
 	var modifiedOwnerAliasesFile github.PullRequestChange
 	var ownerAliasesModified bool
@@ -243,7 +251,7 @@ func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *l
 	}
 	hasInvalidOwnersLabel := github.HasLabel(labels.InvalidOwners, issueLabels)
 
-	if len(modifiedOwnersFiles) == 0 && !ownerAliasesModified && !hasInvalidOwnersLabel {
+	if len(modifiedOwnersFiles) == 0 && len(modifiedCodeOwnersFiles) == 0 && !ownerAliasesModified && !hasInvalidOwnersLabel {
 		return nil
 	}
 
@@ -299,6 +307,32 @@ func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *l
 		}
 	}
 
+	// CODEOWNERS files are checked like OWNERS files, as the users they list
+	// become approvers in repos that use them. Additionally, they may only
+	// list users that the OWNERS files of the PR make approvers of the paths.
+	var ownersApprovers repoowners.RepoOwner
+	if len(modifiedCodeOwnersFiles) > 0 {
+		ownersApprovers, err = repoowners.LoadOwners(r.Directory(), repoAliases, filenames, log)
+		if err != nil {
+			return fmt.Errorf("error loading %s files: %w", filenames.Owners, err)
+		}
+	}
+	for _, c := range modifiedCodeOwnersFiles {
+		path := filepath.Join(r.Directory(), c.Filename)
+		msg, owners := parseCodeOwnersFile(ownersApprovers, path, c, log, filenames)
+		if msg != nil {
+			wrongOwnersFiles[c.Filename] = *msg
+			continue
+		}
+
+		if !skipTrustedUserCheck {
+			nonTrustedUsers, err = nonTrustedUsersInOwners(ghc, log, triggerConfig, org, repo, c.Patch, c.Filename, owners, nonTrustedUsers, trustedUsers, repoAliases)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	if len(wrongOwnersFiles) > 0 {
 		s := "s"
 		if len(wrongOwnersFiles) == 1 {
@@ -381,22 +415,8 @@ func parseOwnersFile(oc ownersClient, path string, c github.PullRequestChange, l
 			return nil, nil
 		}
 		if err != nil {
-			lineNumberRe, _ := regexp.Compile(`line (\d+)`)
-			lineNumberMatches := lineNumberRe.FindStringSubmatch(err.Error())
-			// try to find a line number for the error
-			if len(lineNumberMatches) > 1 {
-				// we're sure it will convert as it passed the regexp already
-				absoluteLineNumber, _ := strconv.Atoi(lineNumberMatches[1])
-				// we need to convert it to a line number relative to the patch
-				al, err := golint.AddedLines(c.Patch)
-				if err != nil {
-					log.WithError(err).Errorf("Failed to compute added lines in %s: %v", c.Filename, err)
-				} else if val, ok := al[absoluteLineNumber]; ok {
-					lineNumber = val
-				}
-			}
 			return &messageWithLine{
-				lineNumber,
+				patchLineNumber(err, c, log),
 				fmt.Sprintf("Cannot parse file: %v.", err),
 			}, nil
 		}
@@ -430,6 +450,62 @@ func parseOwnersFile(oc ownersClient, path string, c github.PullRequestChange, l
 	return nil, owners
 }
 
+// patchLineNumber returns the line of the patch of c that err refers to, or 1
+// if the error doesn't refer to a line that was added by the patch.
+func patchLineNumber(err error, c github.PullRequestChange, log *logrus.Entry) int {
+	lineNumberRe, _ := regexp.Compile(`line (\d+)`)
+	lineNumberMatches := lineNumberRe.FindStringSubmatch(err.Error())
+	// try to find a line number for the error
+	if len(lineNumberMatches) > 1 {
+		// we're sure it will convert as it passed the regexp already
+		absoluteLineNumber, _ := strconv.Atoi(lineNumberMatches[1])
+		return patchLine(absoluteLineNumber, c, log)
+	}
+	// by default we bind errors to line 1
+	return 1
+}
+
+// patchLine converts a line of the file changed by c to a line of its patch.
+// Lines that weren't added by the patch are bound to line 1.
+func patchLine(line int, c github.PullRequestChange, log *logrus.Entry) int {
+	al, err := golint.AddedLines(c.Patch)
+	if err != nil {
+		log.WithError(err).Errorf("Failed to compute added lines in %s: %v", c.Filename, err)
+	} else if val, ok := al[line]; ok {
+		return val
+	}
+	return 1
+}
+
+// parseCodeOwnersFile validates the CODEOWNERS file at path and returns the
+// users it lists. Each rule may only list users that ownersApprovers makes
+// approvers of the files it matches. Teams are neither checked nor returned
+// as they are checked by GitHub.
+func parseCodeOwnersFile(ownersApprovers repoowners.RepoOwner, path string, c github.PullRequestChange, log *logrus.Entry, filenames ownersconfig.Filenames) (*messageWithLine, []string) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return &messageWithLine{1, fmt.Sprintf("Cannot read file: %v.", err)}, nil
+	}
+	rules, err := repoowners.ParseCodeOwners(b)
+	if err != nil {
+		return &messageWithLine{
+			patchLineNumber(err, c, log),
+			fmt.Sprintf("Cannot parse file: %v.", err),
+		}, nil
+	}
+	owners := sets.NewString()
+	for _, rule := range rules {
+		if notApprovers := rule.Users.Difference(ownersApprovers.Approvers(rule.Dir()).Set()); notApprovers.Len() > 0 {
+			return &messageWithLine{
+				patchLine(rule.Line, c, log),
+				fmt.Sprintf("Not approvers of %q in %s files: %s.", rule.Pattern, filenames.Owners, strings.Join(notApprovers.List(), ", ")),
+			}, nil
+		}
+		owners.Insert(rule.Users.UnsortedList()...)
+	}
+	return nil, owners.List()
+}
+
 func markdownFriendlyComment(org, joinOrgURL string, nonTrustedUsers map[string]nonTrustedReasons, filenames ownersconfig.Filenames) string {
 	var commentLines []string
 	commentLines = append(commentLines, fmt.Sprintf(untrustedResponseFormat, filenames.Owners, joinOrgURL, org))
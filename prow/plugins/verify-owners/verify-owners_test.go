@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -45,6 +46,11 @@ import (
 
 var defaultBranch = localgit.DefaultBranch("")
 
+var codeOwnersFiles = map[string][]byte{
+	"invalidCodeOwners": []byte("*.go bob\n"),
+	"valid":             []byte("*.go @jdoe\n"),
+}
+
 var ownerFiles = map[string][]byte{
 	"emptyApprovers": []byte(`approvers:
 reviewers:
@@ -311,6 +317,8 @@ func addFilesToRepo(lg *localgit.LocalGit, paths []string, ownersFile string) er
 	for _, file := range paths {
 		if strings.Contains(file, "OWNERS_ALIASES") {
 			origFiles[file] = ownerAliasesFiles[ownersFile]
+		} else if repoowners.IsCodeOwnersFile(file) {
+			origFiles[file] = codeOwnersFiles[ownersFile]
 		} else if strings.Contains(file, "OWNERS") {
 			origFiles[file] = ownerFiles[ownersFile]
 		} else {
@@ -338,6 +346,7 @@ func testHandle(clients localgit.Clients, t *testing.T) {
 		filesChangedAfterPR []string
 		addedContent        string
 		shouldLabel         bool
+		codeOwnersEnabled   bool
 	}{
 		{
 			name:         "no OWNERS file",
@@ -434,6 +443,33 @@ func testHandle(clients localgit.Clients, t *testing.T) {
 			filesRemoved: []string{"OWNERS_ALIASES"},
 			shouldLabel:  false,
 		},
+		{
+			name:              "invalid CODEOWNERS file in a repo that uses it",
+			filesChanged:      []string{"CODEOWNERS", "b.go"},
+			ownersFile:        "invalidCodeOwners",
+			codeOwnersEnabled: true,
+			shouldLabel:       true,
+		},
+		{
+			name:              "CODEOWNERS file that only lists approvers",
+			filesChanged:      []string{"OWNERS", "CODEOWNERS", "b.go"},
+			ownersFile:        "valid",
+			codeOwnersEnabled: true,
+			shouldLabel:       false,
+		},
+		{
+			name:              "CODEOWNERS file that lists users who aren't approvers",
+			filesChanged:      []string{"CODEOWNERS", "b.go"},
+			ownersFile:        "valid",
+			codeOwnersEnabled: true,
+			shouldLabel:       true,
+		},
+		{
+			name:         "invalid CODEOWNERS file in a repo that doesn't use it",
+			filesChanged: []string{"CODEOWNERS", "b.go"},
+			ownersFile:   "invalidCodeOwners",
+			shouldLabel:  false,
+		},
 		{
 			name:                "new alias added after a PR references that alias",
 			filesChanged:        []string{"OWNERS"},
@@ -526,7 +562,7 @@ func testHandle(clients localgit.Clients, t *testing.T) {
 				number:       pr,
 			}
 
-			if err := handle(fghc, c, makeFakeRepoOwnersClient(), logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
+			if err := handle(fghc, c, makeFakeRepoOwnersClient(), logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, test.codeOwnersEnabled, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
 				t.Fatalf("Handle PR: %v", err)
 			}
 			if !test.shouldLabel && IssueLabelsContain(fghc.IssueLabelsAdded, labels.InvalidOwners) {
@@ -671,6 +707,101 @@ func testParseOwnersFile(clients localgit.Clients, t *testing.T) {
 	}
 }
 
+func TestParseCodeOwnersFile(t *testing.T) {
+	ownersFiles := map[string]string{
+		"OWNERS":          "approvers:\n- alice\n- jdoe\n",
+		"docs/OWNERS":     "approvers:\n- bob\nreviewers:\n- carol\n",
+		"docs/api/OWNERS": "approvers:\n- dave\n",
+	}
+	tests := []struct {
+		name           string
+		document       string
+		expectedOwners []string
+		errLine        int
+	}{
+		{
+			name:           "valid",
+			document:       "* @alice @org/team\n/docs/ @Bob docs@example.com\n",
+			expectedOwners: []string{"alice", "bob"},
+		},
+		{
+			name:           "approvers of parent directories",
+			document:       "/docs/api/*.md @alice @bob @dave\n",
+			expectedOwners: []string{"alice", "bob", "dave"},
+		},
+		{
+			name:     "approver of a subdirectory",
+			document: "* @alice\n/docs/ @dave\n",
+			errLine:  2,
+		},
+		{
+			name:     "reviewer",
+			document: "* @alice\n\n/docs/*.md @carol\n",
+			errLine:  3,
+		},
+		{
+			name:     "unknown user",
+			document: "*.go @alice @eve\n",
+			errLine:  1,
+		},
+		{
+			name:     "unsupported pattern",
+			document: "* @alice\n!vendor/ @bob\n",
+			errLine:  2,
+		},
+		{
+			name:     "invalid owner",
+			document: "* @alice\n\n*.go bob\n",
+			errLine:  3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "codeowners")
+			if err != nil {
+				t.Fatalf("Creating temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for file, content := range ownersFiles {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755); err != nil {
+					t.Fatalf("Creating directory for %s: %v", file, err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+					t.Fatalf("Writing %s: %v", file, err)
+				}
+			}
+			ownersApprovers, err := repoowners.LoadOwners(dir, nil, ownersconfig.FakeFilenames, logrus.NewEntry(logrus.New()))
+			if err != nil {
+				t.Fatalf("Loading OWNERS files: %v", err)
+			}
+			path := filepath.Join(dir, "CODEOWNERS")
+			if err := ioutil.WriteFile(path, []byte(test.document), 0644); err != nil {
+				t.Fatalf("Writing CODEOWNERS: %v", err)
+			}
+			change := github.PullRequestChange{
+				Filename: "CODEOWNERS",
+				Patch:    makePatch([]byte(test.document)),
+			}
+
+			message, owners := parseCodeOwnersFile(ownersApprovers, path, change, logrus.NewEntry(logrus.New()), ownersconfig.FakeFilenames)
+			if message != nil {
+				if test.errLine == 0 {
+					t.Errorf("expected no error, got one: %s", message.message)
+				}
+				if message.line != test.errLine {
+					t.Errorf("wrong line for message, expected %d, got %d", test.errLine, message.line)
+				}
+			} else if test.errLine != 0 {
+				t.Errorf("expected an error, got none")
+			}
+			if diff := cmp.Diff(test.expectedOwners, owners); diff != "" {
+				t.Errorf("owners differ from expected (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func makePatch(b []byte) string {
 	p := bytes.Replace(b, []byte{'\n'}, []byte{'\n', '+'}, -1)
 	nbLines := bytes.Count(p, []byte{'+'}) + 1
@@ -694,7 +825,7 @@ func TestHelpProvider(t *testing.T) {
 			config:       &plugins.Configuration{},
 			enabledRepos: enabledRepos,
 			expected: &pluginhelp.PluginHelp{
-				Description: "The verify-owners plugin validates OWNERS and OWNERS_ALIASES files (by default) and ensures that they always contain collaborators of the org, if they are modified in a PR. On validation failure it automatically adds the 'do-not-merge/invalid-owners-file' label to the PR, and a review comment on the incriminating file(s). Per-repo configuration for filenames is possible.",
+				Description: "The verify-owners plugin validates OWNERS and OWNERS_ALIASES files (by default) as well as the GitHub CODEOWNERS files of the repos that use them, and ensures that they always contain collaborators of the org, if they are modified in a PR. CODEOWNERS files may only list the approvers of the paths in the OWNERS files. On validation failure it automatically adds the 'do-not-merge/invalid-owners-file' label to the PR, and a review comment on the incriminating file(s). Per-repo configuration for filenames is possible.",
 				Config: map[string]string{
 					"default": "OWNERS and OWNERS_ALIASES files are validated.",
 				},
@@ -715,7 +846,7 @@ func TestHelpProvider(t *testing.T) {
 			},
 			enabledRepos: enabledRepos,
 			expected: &pluginhelp.PluginHelp{
-				Description: "The verify-owners plugin validates OWNERS and OWNERS_ALIASES files (by default) and ensures that they always contain collaborators of the org, if they are modified in a PR. On validation failure it automatically adds the 'do-not-merge/invalid-owners-file' label to the PR, and a review comment on the incriminating file(s). Per-repo configuration for filenames is possible.",
+				Description: "The verify-owners plugin validates OWNERS and OWNERS_ALIASES files (by default) as well as the GitHub CODEOWNERS files of the repos that use them, and ensures that they always contain collaborators of the org, if they are modified in a PR. CODEOWNERS files may only list the approvers of the paths in the OWNERS files. On validation failure it automatically adds the 'do-not-merge/invalid-owners-file' label to the PR, and a review comment on the incriminating file(s). Per-repo configuration for filenames is possible.",
 				Config: map[string]string{
 					"default": "OWNERS and OWNERS_ALIASES files are validated. The verify-owners plugin will complain if OWNERS files contain any of the following banned labels: label1, label2.",
 				},
@@ -1115,7 +1246,7 @@ func testNonCollaborators(clients localgit.Clients, t *testing.T) {
 				number:       pr,
 			}
 
-			if err := handle(fghc, c, froc, logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, test.skipTrustedUserCheck, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
+			if err := handle(fghc, c, froc, logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, test.skipTrustedUserCheck, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
 				t.Fatalf("Handle PR: %v", err)
 			}
 			if !test.shouldLabel && IssueLabelsContain(fghc.IssueLabelsAdded, labels.InvalidOwners) {
@@ -1290,7 +1421,7 @@ func testHandleGenericComment(clients localgit.Clients, t *testing.T) {
 				},
 			}
 
-			if err := handleGenericComment(fghc, c, makeFakeRepoOwnersClient(), logrus.WithField("plugin", PluginName), &test.commentEvent, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
+			if err := handleGenericComment(fghc, c, makeFakeRepoOwnersClient(), logrus.WithField("plugin", PluginName), &test.commentEvent, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
 				t.Fatalf("Handle PR: %v", err)
 			}
 			if !test.shouldLabel && IssueLabelsContain(fghc.IssueLabelsAdded, labels.InvalidOwners) {
@@ -1423,7 +1554,7 @@ func testOwnersRemoval(clients localgit.Clients, t *testing.T) {
 
 			froc := makeFakeRepoOwnersClient()
 
-			if err := handle(fghc, c, froc, logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
+			if err := handle(fghc, c, froc, logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
 				t.Fatalf("Handle PR: %v", err)
 			}
 			if test.shouldRemoveLabel && !IssueLabelsContain(fghc.IssueLabelsRemoved, labels.InvalidOwners) {
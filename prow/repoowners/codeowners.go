@@ -0,0 +1,308 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repoowners
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// CodeOwnersPaths are the locations of a CODEOWNERS file in a repo, in the
+// order in which GitHub looks for them.
+var CodeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+const (
+	// codeOwnersTeamsCacheSize and codeOwnersTeamsTTL bound the cache of the
+	// members of the teams owning CODEOWNERS rules, which are expanded every
+	// time the owners of a repo are loaded.
+	codeOwnersTeamsCacheSize = 1000
+	codeOwnersTeamsTTL       = 10 * time.Minute
+)
+
+// CodeOwnersRule is a line of a CODEOWNERS file.
+type CodeOwnersRule struct {
+	// Pattern is the pattern of the rule as written in the file.
+	Pattern string
+	// Line is the line of the rule in the file.
+	Line int
+	// Users holds the normalized logins of the users owning matching files.
+	Users sets.String
+	// Teams holds the normalized 'org/team-slug' handles of the teams owning
+	// matching files.
+	Teams sets.String
+
+	re *regexp.Regexp
+}
+
+// Matches returns whether the rule applies to the file at path, which is
+// relative to the root of the repo.
+func (r CodeOwnersRule) Matches(path string) bool {
+	return r.re.MatchString(path)
+}
+
+// Dir returns the deepest path that contains all the files the rule matches,
+// relative to the root of the repo. Patterns that match at any depth are
+// contained in the root, which is "".
+func (r CodeOwnersRule) Dir() string {
+	p := strings.TrimSuffix(strings.ReplaceAll(r.Pattern, `\#`, "#"), "/")
+	if !strings.Contains(p, "/") {
+		return baseDirConvention
+	}
+	p = strings.TrimPrefix(p, "/")
+	if i := strings.IndexAny(p, "*?"); i >= 0 {
+		p = p[:i]
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			return p[:i]
+		}
+		return baseDirConvention
+	}
+	return p
+}
+
+// ParseCodeOwners parses the content of a CODEOWNERS file. Invalid lines are
+// reported as errors, but don't prevent the valid lines from being returned.
+// Email addresses can't be mapped to GitHub users, so they are ignored.
+func ParseCodeOwners(b []byte) ([]CodeOwnersRule, error) {
+	var rules []CodeOwnersRule
+	var errs []error
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := stripCodeOwnersComment(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		re, err := codeOwnersPatternToRegexp(fields[0])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNumber, err))
+			continue
+		}
+		rule := CodeOwnersRule{Pattern: fields[0], Line: lineNumber, Users: sets.NewString(), Teams: sets.NewString(), re: re}
+		for _, owner := range fields[1:] {
+			switch {
+			case strings.HasPrefix(owner, "@") && strings.Count(owner, "/") == 1:
+				rule.Teams.Insert(github.NormLogin(owner))
+			case strings.HasPrefix(owner, "@") && !strings.Contains(owner, "/"):
+				rule.Users.Insert(github.NormLogin(owner))
+			case strings.Contains(owner, "@"):
+				// An email address, which only GitHub can resolve.
+			default:
+				errs = append(errs, fmt.Errorf("line %d: invalid owner %q", lineNumber, owner))
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return rules, utilerrors.NewAggregate(errs)
+}
+
+// stripCodeOwnersComment removes a trailing comment. A '#' that is escaped
+// with a backslash is part of the pattern instead.
+func stripCodeOwnersComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// codeOwnersPatternToRegexp converts a CODEOWNERS pattern to a regexp matching
+// the paths of the files it applies to. CODEOWNERS patterns follow the
+// gitignore rules, except that negation, character ranges and escaped leading
+// '#' are not supported, and that 'dir/*' only matches files directly in dir.
+func codeOwnersPatternToRegexp(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "!") {
+		return nil, fmt.Errorf("negated pattern %q is not supported", pattern)
+	}
+	if strings.ContainsAny(pattern, "[]") {
+		return nil, fmt.Errorf("character ranges in pattern %q are not supported", pattern)
+	}
+	pattern = strings.ReplaceAll(pattern, `\#`, "#")
+
+	p := pattern
+	// A trailing slash only matches directories, i.e. everything below them.
+	directoryOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	// A pattern is anchored to the root if it contains a slash that isn't at
+	// its end. Otherwise it matches at any depth.
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("pattern %q matches nothing", pattern)
+	}
+
+	var re strings.Builder
+	if anchored && !strings.HasPrefix(p, "**/") {
+		re.WriteString("^")
+	} else {
+		re.WriteString("^(.*/)?")
+		p = strings.TrimPrefix(p, "**/")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "/**/"):
+			re.WriteString("/(.*/)?")
+			i += 3
+		case strings.HasPrefix(p[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case p[i] == '*':
+			re.WriteString("[^/]*")
+		case p[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	switch {
+	case directoryOnly:
+		re.WriteString("/.*$")
+	case strings.HasSuffix(p, "/*"):
+		// Unlike in gitignore, 'dir/*' doesn't match files in subdirectories.
+		re.WriteString("$")
+	default:
+		// The pattern may match a file or a directory and everything below it.
+		re.WriteString("(/.*)?$")
+	}
+	return regexp.Compile(re.String())
+}
+
+// loadCodeOwnersFrom reads the CODEOWNERS file of the repo checked out at
+// baseDir, if there is one.
+func loadCodeOwnersFrom(baseDir string, log *logrus.Entry) []CodeOwnersRule {
+	for _, codeOwnersPath := range CodeOwnersPaths {
+		path := filepath.Join(baseDir, codeOwnersPath)
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).Warnf("Failed to read CODEOWNERS file %q.", path)
+			return nil
+		}
+		rules, err := ParseCodeOwners(b)
+		if err != nil {
+			log.WithError(err).Warnf("Ignoring invalid lines of CODEOWNERS file %q.", path)
+		}
+		log.Infof("Loaded %d rules from %q.", len(rules), path)
+		return rules
+	}
+	return nil
+}
+
+// IsCodeOwnersFile returns whether path is a CODEOWNERS file GitHub would use.
+func IsCodeOwnersFile(path string) bool {
+	for _, codeOwnersPath := range CodeOwnersPaths {
+		if path == codeOwnersPath {
+			return true
+		}
+	}
+	return false
+}
+
+// codeOwnersForFile returns the owners of the last CODEOWNERS rule that
+// matches path, as GitHub does.
+func (o *RepoOwners) codeOwnersForFile(path string) sets.String {
+	for i := len(o.codeOwners) - 1; i >= 0; i-- {
+		if o.codeOwners[i].Matches(path) {
+			return o.codeOwners[i].Users
+		}
+	}
+	return nil
+}
+
+// hasCodeOwnersTeams returns whether any CODEOWNERS rule is owned by a team.
+func (o *RepoOwners) hasCodeOwnersTeams() bool {
+	for _, rule := range o.codeOwners {
+		if rule.Teams.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// expandCodeOwnersTeams returns a copy of the RepoOwners where the members of
+// the teams owning CODEOWNERS rules are added to their users. The members of
+// the teams are cached in teams. Teams that can't be resolved are skipped.
+func (o *RepoOwners) expandCodeOwnersTeams(ghc githubClient, teams *utilcache.LRUExpireCache, log *logrus.Entry) *RepoOwners {
+	members := map[string]sets.String{}
+	for _, rule := range o.codeOwners {
+		for _, team := range rule.Teams.List() {
+			if _, ok := members[team]; ok {
+				continue
+			}
+			members[team] = codeOwnersTeamMembers(ghc, teams, team, log)
+		}
+	}
+
+	result := *o
+	result.codeOwners = make([]CodeOwnersRule, 0, len(o.codeOwners))
+	for _, rule := range o.codeOwners {
+		users := rule.Users.Union(nil)
+		for _, team := range rule.Teams.UnsortedList() {
+			users = users.Union(members[team])
+		}
+		rule.Users = users
+		result.codeOwners = append(result.codeOwners, rule)
+	}
+	return &result
+}
+
+// codeOwnersTeamMembers returns the members of the 'org/team-slug' team, from
+// the cache if they were listed recently. Failures are not cached.
+func codeOwnersTeamMembers(ghc githubClient, teams *utilcache.LRUExpireCache, team string, log *logrus.Entry) sets.String {
+	if cached, ok := teams.Get(team); ok {
+		return cached.(sets.String)
+	}
+	orgSlug := strings.SplitN(team, "/", 2)
+	t, err := ghc.GetTeamBySlug(orgSlug[1], orgSlug[0])
+	if err != nil {
+		log.WithError(err).Warnf("Failed to get CODEOWNERS team %q.", team)
+		return sets.NewString()
+	}
+	teamMembers, err := ghc.ListTeamMembers(orgSlug[0], t.ID, github.RoleAll)
+	if err != nil {
+		log.WithError(err).Warnf("Failed to list members of CODEOWNERS team %q.", team)
+		return sets.NewString()
+	}
+	members := sets.NewString()
+	for _, member := range teamMembers {
+		members.Insert(github.NormLogin(member.Login))
+	}
+	teams.Add(team, members, codeOwnersTeamsTTL)
+	return members
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repoowners
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/git/localgit"
+)
+
+func TestCodeOwnersPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		matches  []string
+		excludes []string
+	}{
+		{
+			pattern: "*",
+			matches: []string{"README.md", "a/b/c.go"},
+		},
+		{
+			pattern:  "*.go",
+			matches:  []string{"main.go", "a/b/c.go"},
+			excludes: []string{"main.go.txt", "README.md"},
+		},
+		{
+			pattern:  "docs/",
+			matches:  []string{"docs/a.md", "a/docs/b/c.md"},
+			excludes: []string{"docs", "mydocs/a.md"},
+		},
+		{
+			pattern:  "/docs/",
+			matches:  []string{"docs/a.md", "docs/b/c.md"},
+			excludes: []string{"a/docs/b.md"},
+		},
+		{
+			pattern:  "apps/*",
+			matches:  []string{"apps/a.go"},
+			excludes: []string{"apps/a/b.go", "b/apps/a.go"},
+		},
+		{
+			pattern:  "apps/github",
+			matches:  []string{"apps/github", "apps/github/a.go"},
+			excludes: []string{"b/apps/github/a.go", "apps/githubber"},
+		},
+		{
+			pattern:  "**/logs",
+			matches:  []string{"logs/a.log", "a/b/logs", "a/logs/b/c.log"},
+			excludes: []string{"a/mylogs"},
+		},
+		{
+			pattern:  "src/**/test",
+			matches:  []string{"src/test/a.go", "src/a/b/test/c.go"},
+			excludes: []string{"a/src/test/b.go"},
+		},
+		{
+			pattern:  "file?.txt",
+			matches:  []string{"file1.txt", "a/fileA.txt"},
+			excludes: []string{"file10.txt", "file/.txt"},
+		},
+		{
+			pattern:  `\#notes`,
+			matches:  []string{"#notes"},
+			excludes: []string{"notes"},
+		},
+	}
+
+	for _, test := range tests {
+		re, err := codeOwnersPatternToRegexp(test.pattern)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.pattern, err)
+			continue
+		}
+		for _, path := range test.matches {
+			if !re.MatchString(path) {
+				t.Errorf("%s: expected %q to match (regexp %q)", test.pattern, path, re)
+			}
+		}
+		for _, path := range test.excludes {
+			if re.MatchString(path) {
+				t.Errorf("%s: expected %q not to match (regexp %q)", test.pattern, path, re)
+			}
+		}
+	}
+}
+
+func TestParseCodeOwners(t *testing.T) {
+	rules, err := ParseCodeOwners([]byte(`# Default owners
+*       @Alice @org/Core-Team
+
+/docs/  docs@example.com @bob # the docs team
+!vendor @carl
+*.go    carl
+*.md
+`))
+	if err == nil {
+		t.Error("expected errors for the unsupported pattern and the invalid owner")
+	}
+	expected := []CodeOwnersRule{
+		{Pattern: "*", Line: 2, Users: sets.NewString("alice"), Teams: sets.NewString("org/core-team")},
+		{Pattern: "/docs/", Line: 4, Users: sets.NewString("bob"), Teams: sets.NewString()},
+		{Pattern: "*.go", Line: 6, Users: sets.NewString(), Teams: sets.NewString()},
+		{Pattern: "*.md", Line: 7, Users: sets.NewString(), Teams: sets.NewString()},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("expected %d rules, got %d: %v", len(expected), len(rules), rules)
+	}
+	for i := range expected {
+		if rules[i].Pattern != expected[i].Pattern || rules[i].Line != expected[i].Line || !rules[i].Users.Equal(expected[i].Users) || !rules[i].Teams.Equal(expected[i].Teams) {
+			t.Errorf("rule %d: expected %s on line %d %v %v, got %s on line %d %v %v", i, expected[i].Pattern, expected[i].Line, expected[i].Users.List(), expected[i].Teams.List(), rules[i].Pattern, rules[i].Line, rules[i].Users.List(), rules[i].Teams.List())
+		}
+	}
+}
+
+func TestCodeOwnersRuleDir(t *testing.T) {
+	tests := []struct {
+		pattern string
+		dir     string
+	}{
+		{pattern: "*", dir: ""},
+		{pattern: "*.go", dir: ""},
+		{pattern: "docs/", dir: ""},
+		{pattern: "**/docs", dir: ""},
+		{pattern: "/docs/", dir: "docs"},
+		{pattern: "docs/**", dir: "docs"},
+		{pattern: "/docs/*.md", dir: "docs"},
+		{pattern: "/docs/api/", dir: "docs/api"},
+		{pattern: "/pkg/util/sets.go", dir: "pkg/util/sets.go"},
+		{pattern: "/pkg/util*/", dir: "pkg"},
+		{pattern: "/README.md", dir: "README.md"},
+	}
+	for _, test := range tests {
+		if dir := (CodeOwnersRule{Pattern: test.pattern}).Dir(); dir != test.dir {
+			t.Errorf("%s: expected the directory %q, got %q", test.pattern, test.dir, dir)
+		}
+	}
+}
+
+func mustParseCodeOwners(t *testing.T, content string) []CodeOwnersRule {
+	rules, err := ParseCodeOwners([]byte(content))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing CODEOWNERS: %v.", err)
+	}
+	return rules
+}
+
+func TestCodeOwnersApproversAndReviewers(t *testing.T) {
+	ro := &RepoOwners{
+		approvers: map[string]map[*regexp.Regexp]sets.String{
+			baseDir: regexpAll("alice"),
+			leafDir: regexpAll("carl"),
+		},
+		reviewers: map[string]map[*regexp.Regexp]sets.String{
+			baseDir: regexpAll("alice"),
+		},
+		labels: map[string]map[*regexp.Regexp]sets.String{
+			baseDir: regexpAll("sig/testing"),
+		},
+		codeOwners: mustParseCodeOwners(t, "* @bob\n*.md @dave\n/a/ @erin\n"),
+	}
+
+	tests := []struct {
+		path                                 string
+		expectedApprovers, expectedReviewers []string
+		expectedLeafApprovers                []string
+	}{
+		{
+			path:                  "main.go",
+			expectedApprovers:     []string{"alice", "bob"},
+			expectedReviewers:     []string{"alice", "bob"},
+			expectedLeafApprovers: []string{"alice", "bob"},
+		},
+		{
+			// Only the last matching rule applies.
+			path:                  "a/README.md",
+			expectedApprovers:     []string{"alice", "erin"},
+			expectedReviewers:     []string{"alice", "erin"},
+			expectedLeafApprovers: []string{"alice", "erin"},
+		},
+		{
+			path:                  "a/b/c/README.md",
+			expectedApprovers:     []string{"alice", "carl", "erin"},
+			expectedReviewers:     []string{"alice", "erin"},
+			expectedLeafApprovers: []string{"carl"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := ro.Approvers(test.path).Set(); !got.Equal(sets.NewString(test.expectedApprovers...)) {
+			t.Errorf("%s: expected approvers %v, got %v", test.path, test.expectedApprovers, got.List())
+		}
+		if got := ro.Reviewers(test.path).Set(); !got.Equal(sets.NewString(test.expectedReviewers...)) {
+			t.Errorf("%s: expected reviewers %v, got %v", test.path, test.expectedReviewers, got.List())
+		}
+		if got := ro.LeafApprovers(test.path); !got.Equal(sets.NewString(test.expectedLeafApprovers...)) {
+			t.Errorf("%s: expected leaf approvers %v, got %v", test.path, test.expectedLeafApprovers, got.List())
+		}
+		if got := ro.FindLabelsForFile(test.path); !got.Equal(sets.NewString("sig/testing")) {
+			t.Errorf("%s: expected CODEOWNERS not to affect labels, got %v", test.path, got.List())
+		}
+	}
+}
+
+func TestExpandCodeOwnersTeams(t *testing.T) {
+	ro := &RepoOwners{codeOwners: mustParseCodeOwners(t, "* @alice @org/core\n/docs/ @org/docs @org/missing\n")}
+	ghc := &fakeGitHubClient{TeamMembers: map[string][]string{
+		"org/core": {"Bob", "carl"},
+		"org/docs": {"dave"},
+	}}
+
+	teams := utilcache.NewLRUExpireCache(codeOwnersTeamsCacheSize)
+	expanded := ro.expandCodeOwnersTeams(ghc, teams, logrus.WithField("test", t.Name()))
+	if got := expanded.codeOwnersForFile("main.go"); !got.Equal(sets.NewString("alice", "bob", "carl")) {
+		t.Errorf("expected owners of main.go to be expanded, got %v", got.List())
+	}
+	if got := expanded.codeOwnersForFile("docs/index.md"); !got.Equal(sets.NewString("dave")) {
+		t.Errorf("expected owners of docs/index.md to skip the missing team, got %v", got.List())
+	}
+	if got := ro.codeOwnersForFile("main.go"); !got.Equal(sets.NewString("alice")) {
+		t.Errorf("expected the original RepoOwners not to be modified, got %v", got.List())
+	}
+
+	// The members of the teams are cached.
+	ro.expandCodeOwnersTeams(ghc, teams, logrus.WithField("test", t.Name()))
+	if ghc.teamListings != 2 {
+		t.Errorf("expected the members of the two teams to be listed once, got %d listings", ghc.teamListings)
+	}
+}
+
+func TestLoadRepoOwnersCodeOwners(t *testing.T) {
+	testLoadRepoOwnersCodeOwners(localgit.New, t)
+}
+
+func TestLoadRepoOwnersCodeOwnersV2(t *testing.T) {
+	testLoadRepoOwnersCodeOwners(localgit.NewV2, t)
+}
+
+func testLoadRepoOwnersCodeOwners(clients localgit.Clients, t *testing.T) {
+	files := map[string][]byte{
+		"OWNERS":             []byte("approvers:\n- cjwagner\n"),
+		".github/CODEOWNERS": []byte("*.go @alice @org/core @outsider\n"),
+	}
+	client, cleanup, err := getTestClient(files, false, false, false, false, nil, nil, nil, nil, clients)
+	if err != nil {
+		t.Fatalf("Error creating test client: %v.", err)
+	}
+	defer cleanup()
+
+	client.ghc.(*fakeGitHubClient).TeamMembers = map[string][]string{"org/core": {"maggie"}}
+	for _, enabled := range []bool{false, true} {
+		client.delegate.codeOwnersEnabled = func(org, repo string) bool { return enabled }
+		r, err := client.LoadRepoOwners("org", "repo", defaultBranch)
+		if err != nil {
+			t.Fatalf("Unexpected error loading RepoOwners: %v.", err)
+		}
+		expected := sets.NewString("cjwagner")
+		if enabled {
+			// Non-collaborators are filtered out like in OWNERS files.
+			expected.Insert("alice", "maggie")
+		}
+		if got := r.Approvers("main.go").Set(); !got.Equal(expected) {
+			t.Errorf("CODEOWNERS enabled: %t: expected approvers %v, got %v", enabled, expected.List(), got.List())
+		}
+	}
+}
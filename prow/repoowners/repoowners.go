@@ -29,6 +29,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/yaml"
 
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"k8s.io/test-infra/prow/git/v2"
@@ -80,6 +81,8 @@ type FullConfig struct {
 type githubClient interface {
 	ListCollaborators(org, repo string) ([]github.User, error)
 	GetRef(org, repo, ref string) (string, error)
+	GetTeamBySlug(slug string, org string) (*github.Team, error)
+	ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error)
 }
 
 func newCache() *cache {
@@ -137,6 +140,10 @@ func (entry cacheEntry) matchesMDYAML(mdYAML bool) bool {
 	return entry.owners.enableMDYAML == mdYAML
 }
 
+func (entry cacheEntry) matchesCodeOwners(codeOwners bool) bool {
+	return entry.owners.enableCodeOwners == codeOwners
+}
+
 func (entry cacheEntry) fullyLoaded() bool {
 	return entry.sha != "" && entry.aliases != nil && entry.owners != nil
 }
@@ -163,11 +170,14 @@ type delegate struct {
 	git git.ClientFactory
 
 	mdYAMLEnabled     func(org, repo string) bool
+	codeOwnersEnabled func(org, repo string) bool
 	skipCollaborators func(org, repo string) bool
 	ownersDirDenylist func() *prowConf.OwnersDirDenylist
 	filenames         ownersconfig.Resolver
 
 	cache *cache
+	// teams caches the members of the teams owning CODEOWNERS rules.
+	teams *utilcache.LRUExpireCache
 }
 
 // WithFields clones the client, keeping the underlying delegate the same but adding
@@ -194,6 +204,7 @@ func NewClient(
 	gc git.ClientFactory,
 	ghc github.Client,
 	mdYAMLEnabled func(org, repo string) bool,
+	codeOwnersEnabled func(org, repo string) bool,
 	skipCollaborators func(org, repo string) bool,
 	ownersDirDenylist func() *prowConf.OwnersDirDenylist,
 	filenames ownersconfig.Resolver,
@@ -204,8 +215,10 @@ func NewClient(
 		delegate: &delegate{
 			git:   gc,
 			cache: newCache(),
+			teams: utilcache.NewLRUExpireCache(codeOwnersTeamsCacheSize),
 
 			mdYAMLEnabled:     mdYAMLEnabled,
+			codeOwnersEnabled: codeOwnersEnabled,
 			skipCollaborators: skipCollaborators,
 			ownersDirDenylist: ownersDirDenylist,
 			filenames:         filenames,
@@ -245,11 +258,16 @@ type RepoOwners struct {
 	requiredReviewers map[string]map[*regexp.Regexp]sets.String
 	labels            map[string]map[*regexp.Regexp]sets.String
 	options           map[string]dirOptions
+	// codeOwners holds the rules of the CODEOWNERS file, if it is enabled.
+	// They apply to approvers and reviewers as if they were in the root
+	// OWNERS file, but only the last matching rule applies to a file.
+	codeOwners []CodeOwnersRule
 
-	baseDir      string
-	enableMDYAML bool
-	dirDenylist  []*regexp.Regexp
-	filenames    ownersconfig.Filenames
+	baseDir          string
+	enableMDYAML     bool
+	enableCodeOwners bool
+	dirDenylist      []*regexp.Regexp
+	filenames        ownersconfig.Filenames
 
 	log *logrus.Entry
 }
@@ -280,15 +298,23 @@ func (c *Client) LoadRepoOwners(org, repo, base string) (RepoOwner, error) {
 		return nil, err
 	}
 
+	// Expand the teams of the CODEOWNERS file even if it came from the cache
+	// because their members could have changed without the git SHA changing.
+	owners := entry.owners
+	if owners.hasCodeOwnersTeams() {
+		start = time.Now()
+		owners = owners.expandCodeOwnersTeams(c.ghc, c.teams, log)
+		log.WithField("duration", time.Since(start).String()).Debugf("Completed owners.expandCodeOwnersTeams(c.ghc, c.teams, log)")
+	}
+
 	start = time.Now()
 	if c.skipCollaborators(org, repo) {
 		log.WithField("duration", time.Since(start).String()).Debugf("Completed c.skipCollaborators(%s, %s)", org, repo)
 		log.Debugf("Skipping collaborator checks for %s/%s", org, repo)
-		return entry.owners, nil
+		return owners, nil
 	}
 	log.WithField("duration", time.Since(start).String()).Debugf("Completed c.skipCollaborators(%s, %s)", org, repo)
 
-	var owners *RepoOwners
 	// Filter collaborators. We must filter the RepoOwners struct even if it came from the cache
 	// because the list of collaborators could have changed without the git SHA changing.
 	start = time.Now()
@@ -296,10 +322,9 @@ func (c *Client) LoadRepoOwners(org, repo, base string) (RepoOwner, error) {
 	log.WithField("duration", time.Since(start).String()).Debugf("Completed ghc.ListCollaborators(%s, %s)", org, repo)
 	if err != nil {
 		log.WithError(err).Errorf("Failed to list collaborators while loading RepoOwners. Skipping collaborator filtering.")
-		owners = entry.owners
 	} else {
 		start = time.Now()
-		owners = entry.owners.filterCollaborators(collaborators)
+		owners = owners.filterCollaborators(collaborators)
 		log.WithField("duration", time.Since(start).String()).Debugf("Completed owners.filterCollaborators(collaborators)")
 	}
 	return owners, nil
@@ -307,6 +332,7 @@ func (c *Client) LoadRepoOwners(org, repo, base string) (RepoOwner, error) {
 
 func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string, log *logrus.Entry) (cacheEntry, error) {
 	mdYaml := c.mdYAMLEnabled(org, repo)
+	codeOwners := c.codeOwnersEnabled(org, repo)
 	lockStart := time.Now()
 	defer func() {
 		log.WithField("duration", time.Since(lockStart).String()).Debug("Locked section of loadRepoOwners completed")
@@ -314,7 +340,7 @@ func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string,
 	entry, ok, entryLock := c.cache.getEntry(fullName)
 	defer entryLock.Unlock()
 	filenames := c.filenames(org, repo)
-	if !ok || entry.sha != sha || entry.owners == nil || !entry.matchesMDYAML(mdYaml) {
+	if !ok || entry.sha != sha || entry.owners == nil || !entry.matchesMDYAML(mdYaml) || !entry.matchesCodeOwners(codeOwners) {
 		start := time.Now()
 		gitRepo, err := c.git.ClientFor(org, repo)
 		if err != nil {
@@ -323,7 +349,7 @@ func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string,
 		log.WithField("duration", time.Since(start).String()).Debugf("Completed git.ClientFor(%s, %s)", org, repo)
 		defer gitRepo.Clean()
 
-		reusable := entry.fullyLoaded() && entry.matchesMDYAML(mdYaml)
+		reusable := entry.fullyLoaded() && entry.matchesMDYAML(mdYaml) && entry.matchesCodeOwners(codeOwners)
 		// In most sha changed cases, the files associated with the owners are unchanged.
 		// The cached entry can continue to be used, so need do git diff
 		if reusable {
@@ -337,7 +363,8 @@ func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string,
 			for _, change := range changes {
 				if mdYaml && strings.HasSuffix(change, ".md") ||
 					strings.HasSuffix(change, filenames.OwnersAliases) ||
-					strings.HasSuffix(change, filenames.Owners) {
+					strings.HasSuffix(change, filenames.Owners) ||
+					codeOwners && IsCodeOwnersFile(change) {
 					reusable = false
 					log.WithField("duration", time.Since(start).String()).Debugf("Completed owners change verification loop")
 					break
@@ -379,6 +406,10 @@ func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string,
 			if err != nil {
 				return cacheEntry{}, fmt.Errorf("failed to load RepoOwners for %s: %w", fullName, err)
 			}
+			if codeOwners {
+				entry.owners.enableCodeOwners = true
+				entry.owners.codeOwners = loadCodeOwnersFrom(gitRepo.Directory(), log)
+			}
 			log.WithField("duration", time.Since(start).String()).Debugf("Completed loadOwnersFrom(%s, %t, entry.aliases, dirIgnorelist, log)", gitRepo.Directory(), mdYaml)
 			entry.sha = sha
 			c.cache.setEntry(fullName, entry)
@@ -463,6 +494,14 @@ func loadOwnersFrom(baseDir string, mdYaml bool, aliases RepoAliases, dirIgnorel
 	return o, filepath.Walk(o.baseDir, o.walkFunc)
 }
 
+// LoadOwners parses the OWNERS files of the repo checked out at baseDir. Unlike
+// the owners loaded by the Client, they are neither filtered by collaborators
+// nor refined by CODEOWNERS, so that both formats can be checked against each
+// other.
+func LoadOwners(baseDir string, aliases RepoAliases, filenames ownersconfig.Filenames, log *logrus.Entry) (*RepoOwners, error) {
+	return loadOwnersFrom(baseDir, false, aliases, nil, filenames, log)
+}
+
 // by default, github's api doesn't root the project directory at "/" and instead uses the empty string for the base dir
 // of the project. And the built-in dir function returns "." for empty strings, so for consistency, we use this
 // canonicalize to get the directories of files in a consistent format with NO "/" at the root (a/b/c/ -> a/b/c)
@@ -720,6 +759,11 @@ func (o *RepoOwners) filterCollaborators(toKeep []github.User) *RepoOwners {
 	result := *o
 	result.approvers = filter(o.approvers)
 	result.reviewers = filter(o.reviewers)
+	result.codeOwners = make([]CodeOwnersRule, 0, len(o.codeOwners))
+	for _, rule := range o.codeOwners {
+		rule.Users = rule.Users.Intersection(collabs)
+		result.codeOwners = append(result.codeOwners, rule)
+	}
 	return &result
 }
 
@@ -761,7 +805,7 @@ func (o *RepoOwners) FindReviewersOwnersForFile(path string) string {
 // FindLabelsForFile returns a set of labels which should be applied to PRs
 // modifying files under the given path.
 func (o *RepoOwners) FindLabelsForFile(path string) sets.String {
-	return o.entriesForFile(path, o.labels, false).Set()
+	return o.entriesForFile(path, o.labels, false, false).Set()
 }
 
 // IsNoParentOwners checks if an OWNERS file path refers to an OWNERS file with NoParentOwners enabled.
@@ -778,7 +822,7 @@ func (o *RepoOwners) IsAutoApproveUnownedSubfolders(ownersFilePath string) bool
 // and not directory as the final directory will be discounted if enableMDYAML is true
 // leafOnly indicates whether only the OWNERS deepest in the tree (closest to the file)
 // should be returned or if all OWNERS in filepath should be returned
-func (o *RepoOwners) entriesForFile(path string, people map[string]map[*regexp.Regexp]sets.String, leafOnly bool) layeredsets.String {
+func (o *RepoOwners) entriesForFile(path string, people map[string]map[*regexp.Regexp]sets.String, leafOnly, codeOwners bool) layeredsets.String {
 	d := path
 	if !o.enableMDYAML || !strings.HasSuffix(path, ".md") {
 		d = canonicalize(d)
@@ -797,6 +841,9 @@ func (o *RepoOwners) entriesForFile(path string, people map[string]map[*regexp.R
 				out.Insert(layerID, s.List()...)
 			}
 		}
+		if codeOwners && d == baseDirConvention {
+			out.Insert(layerID, o.codeOwnersForFile(path).List()...)
+		}
 		if leafOnly && out.Len() > 0 {
 			break
 		}
@@ -817,7 +864,7 @@ func (o *RepoOwners) entriesForFile(path string, people map[string]map[*regexp.R
 // requested file. If pkg/OWNERS has user1 and pkg/util/OWNERS has user2 this
 // will only return user2 for the path pkg/util/sets/file.go
 func (o *RepoOwners) LeafApprovers(path string) sets.String {
-	return o.entriesForFile(path, o.approvers, true).Set()
+	return o.entriesForFile(path, o.approvers, true, true).Set()
 }
 
 // Approvers returns ALL of the users who are approvers for the
@@ -825,14 +872,14 @@ func (o *RepoOwners) LeafApprovers(path string) sets.String {
 // If pkg/OWNERS has user1 and pkg/util/OWNERS has user2 this
 // will return both user1 and user2 for the path pkg/util/sets/file.go
 func (o *RepoOwners) Approvers(path string) layeredsets.String {
-	return o.entriesForFile(path, o.approvers, false)
+	return o.entriesForFile(path, o.approvers, false, true)
 }
 
 // LeafReviewers returns a set of users who are the closest reviewers to the
 // requested file. If pkg/OWNERS has user1 and pkg/util/OWNERS has user2 this
 // will only return user2 for the path pkg/util/sets/file.go
 func (o *RepoOwners) LeafReviewers(path string) sets.String {
-	return o.entriesForFile(path, o.reviewers, true).Set()
+	return o.entriesForFile(path, o.reviewers, true, true).Set()
 }
 
 // Reviewers returns ALL of the users who are reviewers for the
@@ -840,7 +887,7 @@ func (o *RepoOwners) LeafReviewers(path string) sets.String {
 // If pkg/OWNERS has user1 and pkg/util/OWNERS has user2 this
 // will return both user1 and user2 for the path pkg/util/sets/file.go
 func (o *RepoOwners) Reviewers(path string) layeredsets.String {
-	return o.entriesForFile(path, o.reviewers, false)
+	return o.entriesForFile(path, o.reviewers, false, true)
 }
 
 // RequiredReviewers returns ALL of the users who are required_reviewers for the
@@ -848,9 +895,9 @@ func (o *RepoOwners) Reviewers(path string) layeredsets.String {
 // If pkg/OWNERS has user1 and pkg/util/OWNERS has user2 this
 // will return both user1 and user2 for the path pkg/util/sets/file.go
 func (o *RepoOwners) RequiredReviewers(path string) sets.String {
-	return o.entriesForFile(path, o.requiredReviewers, false).Set()
+	return o.entriesForFile(path, o.requiredReviewers, false, false).Set()
 }
 
 func (o *RepoOwners) TopLevelApprovers() sets.String {
-	return o.entriesForFile(".", o.approvers, true).Set()
+	return o.entriesForFile(".", o.approvers, true, true).Set()
 }
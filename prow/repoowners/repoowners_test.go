@@ -28,6 +28,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
 	"k8s.io/apimachinery/pkg/util/diff"
 	"k8s.io/apimachinery/pkg/util/sets"
 	prowConf "k8s.io/test-infra/prow/config"
@@ -129,6 +130,10 @@ type cacheOptions struct {
 type fakeGitHubClient struct {
 	Collaborators []string
 	ref           string
+	// TeamMembers maps 'org/team-slug' handles to the logins of their members.
+	TeamMembers map[string][]string
+	// teamListings counts the calls to ListTeamMembers.
+	teamListings int
 }
 
 func (f *fakeGitHubClient) ListCollaborators(org, repo string) ([]github.User, error) {
@@ -143,6 +148,27 @@ func (f *fakeGitHubClient) GetRef(org, repo, ref string) (string, error) {
 	return f.ref, nil
 }
 
+func (f *fakeGitHubClient) GetTeamBySlug(slug string, org string) (*github.Team, error) {
+	i := 0
+	for _, team := range sets.StringKeySet(f.TeamMembers).List() {
+		i++
+		if team == org+"/"+slug {
+			return &github.Team{ID: i, Slug: slug}, nil
+		}
+	}
+	return nil, fmt.Errorf("team %s/%s not found", org, slug)
+}
+
+func (f *fakeGitHubClient) ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error) {
+	f.teamListings++
+	team := sets.StringKeySet(f.TeamMembers).List()[id-1]
+	var members []github.TeamMember
+	for _, login := range f.TeamMembers[team] {
+		members = append(members, github.TeamMember{Login: login})
+	}
+	return members, nil
+}
+
 func getTestClient(
 	files map[string][]byte,
 	enableMdYaml,
@@ -269,10 +295,14 @@ labels:
 			delegate: &delegate{
 				git:   git,
 				cache: cache,
+				teams: utilcache.NewLRUExpireCache(codeOwnersTeamsCacheSize),
 
 				mdYAMLEnabled: func(org, repo string) bool {
 					return enableMdYaml
 				},
+				codeOwnersEnabled: func(org, repo string) bool {
+					return false
+				},
 				skipCollaborators: func(org, repo string) bool {
 					return skipCollab
 				},
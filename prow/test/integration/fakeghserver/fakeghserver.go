@@ -14,29 +14,36 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// fakeghserver serves github API for integration tests.
+// fakeghserver serves a stateful fake of the GitHub API for integration
+// tests. It covers the REST endpoints Prow components use and the GraphQL
+// search tide relies on. Changes are delivered as webhooks to the hooks that
+// tests create through the hooks API, so that hook, tide and crier can be
+// exercised end to end.
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
-	prowgh "k8s.io/test-infra/prow/github"
 
-	"k8s.io/test-infra/prow/github/fakegithub"
 	"k8s.io/test-infra/prow/interrupts"
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/pjutil"
 )
 
 type options struct {
-	port int
+	port     int
+	botLogin string
+	seedFile string
 }
 
 func (o *options) validate() error {
@@ -46,6 +53,8 @@ func (o *options) validate() error {
 func flagOptions() *options {
 	o := &options{}
 	flag.IntVar(&o.port, "port", 8888, "Port to listen on.")
+	flag.StringVar(&o.botLogin, "bot-login", "k8s-ci-robot", "Login of the user that requests without a known token are made by.")
+	flag.StringVar(&o.seedFile, "seed", "", "Path to a YAML file with the initial orgs, repos and tokens.")
 	return o
 }
 
@@ -58,31 +67,17 @@ func main() {
 		logrus.WithError(err).Fatal("Invalid arguments.")
 	}
 	defer interrupts.WaitForGracefulShutdown()
-	ghClient := fakegithub.NewFakeClient()
 
-	r := mux.NewRouter()
-	// So far, supports APIs used by crier:
-	//type GitHubClient interface {
-	// 	BotName() (string, error) # /user
-	// 	CreateStatus(org, repo, ref string, s github.Status) error # fmt.Sprintf("/repos/%s/%s/statuses/%s", org, repo, SHA)
-	// 	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) # fmt.Sprintf("/repos/%s/%s/issues/%d/comments", org, repo, number)
-	// 	CreateComment(org, repo string, number int, comment string) error # fmt.Sprintf("/repos/%s/%s/issues/%d/comments", org, repo, number),
-	// 	DeleteComment(org, repo string, ID int) error # fmt.Sprintf("/repos/%s/%s/issues/comments/%d", org, repo, number),
-	//  EditComment(org, repo string, ID int, comment string) error # fmt.Sprintf("/repos/%s/%s/issues/comments/%d", org, repo, number),
-	//  GetRepoLabels(org, repo string) ([]Label, error) # fmt.Sprintf("/repos/%s/%s/labels", org, repo),
-	//  GetIssueLabels(org, repo string, number int) ([]Label, error) # fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number)
-	//  AddLabels(org, repo string, number int, labels ...string) error # fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number),
-	//  AddLabel(org, repo string, number int, label string) # fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number)
-	//  AddRepoLabel(org, repo, label, description, color string) error # fmt.Sprintf("/repos/%s/%s/labels", org, repo),
-	r.Path("/").Handler(response(defaultHandler()))
-	r.Path("/user").Handler(response(userHandler(ghClient)))
-	r.Path("/repos/{org}/{repo}/statuses/{sha}").Handler(response(statusHandler(ghClient)))
-	r.Path("/repos/{org}/{repo}/commits/{sha}/status").Queries("per_page", "{page}").Handler(response(statusHandler(ghClient)))
-	r.Path("/repos/{org}/{repo}/issues").Handler(response(issueHandler(ghClient)))
-	r.Path("/repos/{org}/{repo}/issues/{issue_id}/comments").Handler(response(issueCommentHandler(ghClient)))
-	r.Path("/repos/{org}/{repo}/issues/comments/${comment_id}").Handler(response(issueCommentHandler(ghClient)))
-	r.Path("/repos/{org}/{repo}/labels").Handler(response(labelHandler(ghClient)))
-	r.Path("/repos/{org}/{repo}/issues/{issue_id}/labels").Handler(response(labelHandler(ghClient)))
+	sender := newWebhookSender()
+	interrupts.Run(sender.run)
+	s := newState(o.botLogin, sender.enqueue)
+	if o.seedFile != "" {
+		sd, err := loadSeed(o.seedFile)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to load the seed.")
+		}
+		s.load(sd)
+	}
 
 	health := pjutil.NewHealth()
 	health.ServeReady()
@@ -90,16 +85,94 @@ func main() {
 	logrus.Info("Start server")
 
 	// setup done, actually start the server
-	server := &http.Server{Addr: ":8888", Handler: r}
+	server := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: newRouter(s)}
 	interrupts.ListenAndServe(server, 5*time.Second)
 }
 
-func unmarshal(r *http.Request, data interface{}) error {
-	d := json.NewDecoder(r.Body)
-	d.DisallowUnknownFields()
+const repoPath = "/repos/{org}/{repo}"
 
-	if err := d.Decode(&data); err != nil {
-		return fmt.Errorf("{\"error\": \"Failed unmarshal request: %v\"}", err.Error())
+func newRouter(s *state) *mux.Router {
+	r := mux.NewRouter()
+	handle := func(path string, f func(*state) func(*http.Request) (interface{}, int, error), methods ...string) {
+		h := f(s)
+		if strings.HasPrefix(path, repoPath) {
+			h = s.existingRepo(h)
+		}
+		r.Path(path).Methods(methods...).Handler(response(s.locked(h)))
+	}
+	r.Path("/").Handler(response(notSupported))
+	handle("/graphql", graphqlHandler, http.MethodPost)
+	handle("/user", userHandler, http.MethodGet)
+	handle("/users/{user}", userHandler, http.MethodGet)
+	handle("/users/{org}/repos", listReposHandler, http.MethodGet)
+	handle("/orgs/{org}/repos", listReposHandler, http.MethodGet)
+	handle("/orgs/{org}/members", listOrgMembersHandler, http.MethodGet)
+	handle("/orgs/{org}/members/{user}", orgMemberHandler, http.MethodGet)
+	handle("/orgs/{org}/memberships/{user}", orgMemberHandler, http.MethodGet)
+	handle("/orgs/{org}/hooks", hooksHandler, http.MethodGet, http.MethodPost)
+	handle("/orgs/{org}/hooks/{hook_id:[0-9]+}", hookHandler, http.MethodGet, http.MethodPatch, http.MethodDelete)
+
+	handle(repoPath, getRepoHandler, http.MethodGet)
+	handle(repoPath+"/branches", listBranchesHandler, http.MethodGet)
+	handle(repoPath+"/git/refs", createRefHandler, http.MethodPost)
+	handle(repoPath+"/git/refs/{ref:.+}", getRefHandler, http.MethodGet)
+	handle(repoPath+"/git/refs/{ref:.+}", updateRefHandler, http.MethodPatch, http.MethodDelete)
+	handle(repoPath+"/collaborators", listCollaboratorsHandler, http.MethodGet)
+	handle(repoPath+"/collaborators/{user}", collaboratorHandler, http.MethodGet, http.MethodPut, http.MethodDelete)
+	handle(repoPath+"/collaborators/{user}/permission", permissionHandler, http.MethodGet)
+	handle(repoPath+"/labels", repoLabelsHandler, http.MethodGet, http.MethodPost)
+	handle(repoPath+"/labels/{label:.+}", repoLabelHandler, http.MethodGet, http.MethodPatch, http.MethodDelete)
+	handle(repoPath+"/statuses/{sha}", statusesHandler, http.MethodGet, http.MethodPost)
+	handle(repoPath+"/commits/{ref:.+}/status", combinedStatusHandler, http.MethodGet)
+	handle(repoPath+"/commits/{ref:.+}/check-runs", listCheckRunsHandler, http.MethodGet)
+	handle(repoPath+"/check-runs", checkRunHandler, http.MethodPost)
+	handle(repoPath+"/check-runs/{id:[0-9]+}", checkRunHandler, http.MethodPatch)
+	handle(repoPath+"/rulesets", rulesetsHandler, http.MethodGet, http.MethodPost)
+	handle(repoPath+"/rulesets/{ruleset_id:[0-9]+}", rulesetHandler, http.MethodGet, http.MethodPut, http.MethodDelete)
+	handle(repoPath+"/hooks", hooksHandler, http.MethodGet, http.MethodPost)
+	handle(repoPath+"/hooks/{hook_id:[0-9]+}", hookHandler, http.MethodGet, http.MethodPatch, http.MethodDelete)
+
+	handle(repoPath+"/issues", listIssuesHandler, http.MethodGet)
+	handle(repoPath+"/issues", createIssueHandler, http.MethodPost)
+	handle(repoPath+"/issues/comments/{comment_id:[0-9]+}", issueCommentHandler, http.MethodGet, http.MethodPatch, http.MethodDelete)
+	handle(repoPath+"/issues/comments/{comment_id:[0-9]+}/reactions", reactionHandler, http.MethodPost)
+	handle(repoPath+"/issues/{number:[0-9]+}", getIssueHandler, http.MethodGet)
+	handle(repoPath+"/issues/{number:[0-9]+}", editIssueHandler, http.MethodPatch)
+	handle(repoPath+"/issues/{number:[0-9]+}/comments", listIssueCommentsHandler, http.MethodGet)
+	handle(repoPath+"/issues/{number:[0-9]+}/comments", createIssueCommentHandler, http.MethodPost)
+	handle(repoPath+"/issues/{number:[0-9]+}/reactions", reactionHandler, http.MethodPost)
+	handle(repoPath+"/issues/{number:[0-9]+}/labels", issueLabelsHandler, http.MethodGet, http.MethodPost, http.MethodPut)
+	handle(repoPath+"/issues/{number:[0-9]+}/labels/{label:.+}", removeIssueLabelHandler, http.MethodDelete)
+	handle(repoPath+"/issues/{number:[0-9]+}/assignees", assigneesHandler, http.MethodPost, http.MethodDelete)
+
+	handle(repoPath+"/pulls", listPullRequestsHandler, http.MethodGet)
+	handle(repoPath+"/pulls", createPullRequestHandler, http.MethodPost)
+	handle(repoPath+"/pulls/{number:[0-9]+}", getPullRequestHandler, http.MethodGet)
+	handle(repoPath+"/pulls/{number:[0-9]+}", editPullRequestHandler, http.MethodPatch)
+	handle(repoPath+"/pulls/{number:[0-9]+}/files", pullRequestFilesHandler, http.MethodGet)
+	handle(repoPath+"/pulls/{number:[0-9]+}/commits", pullRequestCommitsHandler, http.MethodGet)
+	handle(repoPath+"/pulls/{number:[0-9]+}/comments", reviewCommentsHandler, http.MethodGet)
+	handle(repoPath+"/pulls/{number:[0-9]+}/reviews", reviewsHandler, http.MethodGet, http.MethodPost)
+	handle(repoPath+"/pulls/{number:[0-9]+}/merge", mergeHandler, http.MethodGet, http.MethodPut)
+
+	r.NotFoundHandler = response(notSupported)
+	r.MethodNotAllowedHandler = response(notSupported)
+	return r
+}
+
+// unmarshal decodes the request body into data. The body is kept so that it
+// can be decoded again into a different type.
+func unmarshal(r *http.Request, data interface{}) error {
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return fmt.Errorf("failed to unmarshal request: %w", err)
 	}
 	return nil
 }
@@ -123,164 +196,27 @@ func response(f func(*http.Request) (interface{}, int, error)) http.Handler {
 	})
 }
 
-func defaultHandler() func(*http.Request) (interface{}, int, error) {
-	return func(r *http.Request) (interface{}, int, error) {
-		logrus.Infof("Not supported: %s, %s", r.URL.Path, r.Method)
-		return "", http.StatusNotFound,
-			fmt.Errorf("{\"error\": \"API not supported\"}, %s, %s", r.URL.Path, r.Method)
-	}
+func marshal(obj interface{}, statusCode int) (interface{}, int, error) {
+	content, err := json.Marshal(obj)
+	return string(content), statusCode, err
 }
 
-func userHandler(ghc *fakegithub.FakeClient) func(*http.Request) (interface{}, int, error) {
-	return func(r *http.Request) (interface{}, int, error) {
-		logrus.Infof("Serving: %s, %s", r.URL.Path, r.Method)
-		userData, err := ghc.BotUser()
-		if err != nil {
-			return "", http.StatusInternalServerError, err
-		}
-		var content []byte
-		content, err = json.Marshal(&userData)
-		return string(content), http.StatusOK, err
-	}
-}
-
-func statusHandler(ghc *fakegithub.FakeClient) func(*http.Request) (interface{}, int, error) {
-	return func(r *http.Request) (interface{}, int, error) {
-		logrus.Infof("Serving: %s, %s", r.URL.Path, r.Method)
-		vars := mux.Vars(r)
-		org, repo, SHA := vars["org"], vars["repo"], vars["sha"]
-		if r.Method == http.MethodPost { // Create
-			data := prowgh.Status{}
-			if err := unmarshal(r, &data); err != nil {
-				return "", http.StatusInternalServerError, err
-			}
-			return "", http.StatusCreated, ghc.CreateStatus(org, repo, SHA, data)
-		}
-		if r.Method == http.MethodGet {
-			res, err := ghc.GetCombinedStatus(org, repo, SHA)
-			if err != nil {
-				return "", http.StatusInternalServerError, err
-			}
-			content, err := json.Marshal(res)
-			if err != nil {
-				return "", http.StatusInternalServerError, err
-			}
-			return string(content), http.StatusOK, nil
-		}
-		return "", http.StatusInternalServerError, fmt.Errorf("{\"error\": \"API not supported\"}, %s, %s", r.URL.Path, r.Method)
-	}
+// errorResponse responds with an error the way GitHub does.
+func errorResponse(statusCode int, format string, args ...interface{}) (interface{}, int, error) {
+	return marshal(struct {
+		Message string `json:"message"`
+	}{Message: fmt.Sprintf(format, args...)}, statusCode)
 }
 
-func issueHandler(ghc *fakegithub.FakeClient) func(*http.Request) (interface{}, int, error) {
-	return func(r *http.Request) (interface{}, int, error) {
-		logrus.Infof("Serving: %s, %s", r.URL.Path, r.Method)
-		vars := mux.Vars(r)
-		org, repo := vars["org"], vars["repo"]
-		data := prowgh.Issue{}
-		if err := unmarshal(r, &data); err != nil {
-			return "", http.StatusInternalServerError, err
-		}
-		id, err := ghc.CreateIssue(org, repo, data.Title, data.Body, data.Milestone.Number, nil, nil)
-		return fmt.Sprintf(`{"number": %d}`, id), http.StatusCreated, err
-	}
+func notFound() (interface{}, int, error) {
+	return errorResponse(http.StatusNotFound, "Not Found")
 }
 
-func issueCommentHandler(ghc *fakegithub.FakeClient) func(*http.Request) (interface{}, int, error) {
-	return func(r *http.Request) (interface{}, int, error) {
-		logrus.Infof("Serving: %s, %s", r.URL.Path, r.Method)
-		vars := mux.Vars(r)
-		org, repo := vars["org"], vars["repo"]
-		if issueID, exist := vars["issue_id"]; exist {
-			id, err := strconv.Atoi(issueID)
-			if err != nil {
-				return "", http.StatusUnprocessableEntity, err
-			}
-			if r.Method == http.MethodGet { // List
-				var issues []prowgh.IssueComment
-				issues, err = ghc.ListIssueComments(org, repo, id)
-				if err != nil {
-					return "", http.StatusInternalServerError, err
-				}
-				var content []byte
-				content, err = json.Marshal(issues)
-				return string(content), http.StatusOK, err
-			}
-			if r.Method == http.MethodPost { // Create
-				data := prowgh.IssueComment{}
-				if err = unmarshal(r, &data); err != nil {
-					return "", http.StatusUnprocessableEntity, err
-				}
-				return "", http.StatusCreated, ghc.CreateComment(org, repo, id, data.Body)
-			}
-		}
-		if commentID, exist := vars["comment_id"]; exist {
-			var id int
-			id, err := strconv.Atoi(commentID)
-			if err != nil {
-				return "", http.StatusUnprocessableEntity, err
-			}
-			if r.Method == http.MethodDelete { // Delete
-				return "", http.StatusOK, ghc.DeleteComment(org, repo, id)
-			}
-			if r.Method == http.MethodPatch { // Edit
-				content := &prowgh.IssueComment{}
-				if err := unmarshal(r, content); err != nil {
-					return "", http.StatusUnprocessableEntity, err
-				}
-				return "", http.StatusOK, ghc.EditComment(org, repo, id, content.Body)
-			}
-		}
-		return "", http.StatusInternalServerError, fmt.Errorf("{\"error\": \"API not supported\"}, %s, %s", r.URL.Path, r.Method)
-	}
+func notSupported(r *http.Request) (interface{}, int, error) {
+	logrus.Infof("Not supported: %s, %s", r.URL.Path, r.Method)
+	return errorResponse(http.StatusNotFound, "API not supported: %s %s", r.Method, r.URL.Path)
 }
 
-//  GetRepoLabels(org, repo string) ([]Label, error) # fmt.Sprintf("/repos/%s/%s/labels", org, repo),
-//  GetIssueLabels(org, repo string, number int) ([]Label, error) # fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number)
-//  AddLabel(org, repo string, number int, label string) # fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number)
-//  AddRepoLabel(org, repo, label, description, color string) error # fmt.Sprintf("/repos/%s/%s/labels", org, repo),
-func labelHandler(ghc *fakegithub.FakeClient) func(*http.Request) (interface{}, int, error) {
-	return func(r *http.Request) (interface{}, int, error) {
-		logrus.Infof("Serving: %s, %s", r.URL.Path, r.Method)
-		vars := mux.Vars(r)
-		org, repo := vars["org"], vars["repo"]
-		if issueID, exist := vars["issue_id"]; exist { // Issue label
-			id, err := strconv.Atoi(issueID)
-			if err != nil {
-				return "", http.StatusUnprocessableEntity, err
-			}
-			if r.Method == http.MethodGet { // List
-				var labels []prowgh.Label
-				labels, err = ghc.GetIssueLabels(org, repo, id)
-				if err != nil {
-					return "", http.StatusInternalServerError, err
-				}
-				var content []byte
-				content, err = json.Marshal(labels)
-				return string(content), http.StatusOK, err
-			}
-			if r.Method == http.MethodPost { // Create
-				var labels []string
-				if err = unmarshal(r, &labels); err != nil {
-					return "", http.StatusUnprocessableEntity, err
-				}
-				return "", http.StatusCreated, ghc.AddLabels(org, repo, id, labels...)
-			}
-		} else if r.Method == http.MethodGet { // List repo labels
-			var labels []prowgh.Label
-			labels, err := ghc.GetRepoLabels(org, repo)
-			if err != nil {
-				return "", http.StatusInternalServerError, err
-			}
-			var content []byte
-			content, err = json.Marshal(labels)
-			return string(content), http.StatusOK, err
-		} else if r.Method == http.MethodPost { // Create repo label
-			data := prowgh.Label{}
-			if err := unmarshal(r, &data); err != nil {
-				return "", http.StatusUnprocessableEntity, err
-			}
-			return "", http.StatusCreated, ghc.AddRepoLabel(org, repo, data.Name, data.Description, data.Color)
-		}
-		return "", http.StatusInternalServerError, fmt.Errorf("{\"error\": \"API not supported\"}, %s, %s", r.URL.Path, r.Method)
-	}
+func intVar(r *http.Request, name string) (int, error) {
+	return strconv.Atoi(mux.Vars(r)[name])
 }
@@ -0,0 +1,564 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+type recordedEvent struct {
+	Type   string
+	Action string
+}
+
+// testServer is a seeded server with clients that act as the bot and as alice.
+type testServer struct {
+	url   string
+	bot   github.Client
+	alice github.Client
+	// events returns the webhooks sent since the last call.
+	events func() []recordedEvent
+}
+
+// push moves or creates a branch as alice, since the client can't.
+func (ts *testServer) push(t *testing.T, branch, sha string) {
+	t.Helper()
+	method, path := http.MethodPatch, "/repos/org/repo/git/refs/heads/"+branch
+	body := fmt.Sprintf(`{"sha":%q}`, sha)
+	// GetRef reports missing refs as empty rather than failing.
+	if current, _ := ts.bot.GetRef("org", "repo", "heads/"+branch); current == "" {
+		method, path = http.MethodPost, "/repos/org/repo/git/refs"
+		body = fmt.Sprintf(`{"ref":"refs/heads/%s","sha":%q}`, branch, sha)
+	}
+	req, err := http.NewRequest(method, ts.url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer alice-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to push: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		t.Fatalf("failed to push: status %d", resp.StatusCode)
+	}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	var lock sync.Mutex
+	var events []recordedEvent
+	s := newState("k8s-ci-robot", func(hook webhook) {
+		var body struct {
+			Action string `json:"action"`
+		}
+		if err := json.Unmarshal(hook.payload, &body); err != nil {
+			t.Errorf("webhook payload is not JSON: %v", err)
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, recordedEvent{Type: hook.eventType, Action: body.Action})
+	})
+	s.load(&seed{
+		Tokens:     map[string]string{"alice-token": "alice"},
+		OrgMembers: map[string][]string{"org": {"bob"}},
+		Repos: []seedRepo{{
+			Org:           "org",
+			Name:          "repo",
+			Branches:      map[string]string{"feature": "1111111"},
+			Collaborators: map[string]github.RepoPermissionLevel{"alice": github.Write},
+		}},
+	})
+	server := httptest.NewServer(newRouter(s))
+	t.Cleanup(server.Close)
+
+	newClient := func(token string) github.Client {
+		client := github.NewClient(func() []byte { return []byte(token) }, func(b []byte) []byte { return b }, server.URL+"/graphql", server.URL)
+		// Missing users and refs are expected, so don't wait for them.
+		client.SetMax404Retries(0)
+		return client
+	}
+	bot := newClient("")
+	if _, err := bot.CreateRepoHook("org", "repo", github.HookRequest{Events: github.AllHookEvents, Config: &github.HookConfig{URL: "http://hook/hook"}}); err != nil {
+		t.Fatalf("failed to create hook: %v", err)
+	}
+	return &testServer{
+		url:   server.URL,
+		bot:   bot,
+		alice: newClient("alice-token"),
+		events: func() []recordedEvent {
+			lock.Lock()
+			defer lock.Unlock()
+			recorded := events
+			events = nil
+			return recorded
+		},
+	}
+}
+
+func TestIssues(t *testing.T) {
+	ts := newTestServer(t)
+	bot, alice, events := ts.bot, ts.alice, ts.events
+
+	number, err := alice.CreateIssue("org", "repo", "Broken", "It's broken.", 0, []string{"kind/bug"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create issue: %v", err)
+	}
+	if err := bot.CreateComment("org", "repo", number, "/assign"); err != nil {
+		t.Fatalf("failed to comment: %v", err)
+	}
+	if err := bot.AssignIssue("org", "repo", number, []string{"alice", "bob", "mallory"}); !errors.As(err, &github.MissingUsers{}) {
+		t.Errorf("expected mallory to be reported as missing, got %v", err)
+	}
+	if err := bot.AddLabel("org", "repo", number, "triage/accepted"); err != nil {
+		t.Fatalf("failed to add label: %v", err)
+	}
+	if err := bot.RemoveLabel("org", "repo", number, "kind/bug"); err != nil {
+		t.Fatalf("failed to remove label: %v", err)
+	}
+	if err := bot.RemoveLabel("org", "repo", number, "kind/bug"); err != nil {
+		t.Errorf("removing a missing label should succeed, got %v", err)
+	}
+	comments, err := bot.ListIssueComments("org", "repo", number)
+	if err != nil {
+		t.Fatalf("failed to list comments: %v", err)
+	}
+	if len(comments) != 1 || comments[0].User.Login != "k8s-ci-robot" {
+		t.Fatalf("expected a single comment by the bot, got %+v", comments)
+	}
+	if err := bot.EditComment("org", "repo", comments[0].ID, "/assign @alice"); err != nil {
+		t.Errorf("failed to edit comment: %v", err)
+	}
+	if err := bot.DeleteComment("org", "repo", comments[0].ID); err != nil {
+		t.Errorf("failed to delete comment: %v", err)
+	}
+	if err := bot.CloseIssue("org", "repo", number); err != nil {
+		t.Errorf("failed to close issue: %v", err)
+	}
+
+	issue, err := bot.GetIssue("org", "repo", number)
+	if err != nil {
+		t.Fatalf("failed to get issue: %v", err)
+	}
+	var assignees, labels []string
+	for _, a := range issue.Assignees {
+		assignees = append(assignees, a.Login)
+	}
+	for _, l := range issue.Labels {
+		labels = append(labels, l.Name)
+	}
+	if diff := cmp.Diff([]string{"alice", "bob"}, assignees); diff != "" {
+		t.Errorf("unexpected assignees (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"triage/accepted"}, labels); diff != "" {
+		t.Errorf("unexpected labels (-want +got):\n%s", diff)
+	}
+	if issue.User.Login != "alice" || issue.State != "closed" {
+		t.Errorf("expected a closed issue by alice, got %s by %s", issue.State, issue.User.Login)
+	}
+	if _, err := bot.GetIssue("org", "repo", number+1); err == nil {
+		t.Error("expected an error getting a missing issue")
+	}
+
+	expected := []recordedEvent{
+		{Type: "issues", Action: "opened"},
+		{Type: "issue_comment", Action: "created"},
+		{Type: "issues", Action: "assigned"},
+		{Type: "issues", Action: "assigned"},
+		{Type: "issues", Action: "labeled"},
+		{Type: "issues", Action: "unlabeled"},
+		{Type: "issue_comment", Action: "edited"},
+		{Type: "issue_comment", Action: "deleted"},
+		{Type: "issues", Action: "closed"},
+	}
+	if diff := cmp.Diff(expected, events()); diff != "" {
+		t.Errorf("unexpected webhooks (-want +got):\n%s", diff)
+	}
+}
+
+func TestPullRequests(t *testing.T) {
+	ts := newTestServer(t)
+	bot, alice, events := ts.bot, ts.alice, ts.events
+
+	number, err := alice.CreatePullRequest("org", "repo", "Add feature", "", "feature", "master", true)
+	if err != nil {
+		t.Fatalf("failed to create pull request: %v", err)
+	}
+	if _, err := alice.CreatePullRequest("org", "repo", "Add feature", "", "missing", "master", true); err == nil {
+		t.Error("expected an error creating a pull request from a missing branch")
+	}
+	if err := bot.CreateReview("org", "repo", number, github.DraftReview{Action: github.Approve}); err != nil {
+		t.Fatalf("failed to review: %v", err)
+	}
+	if err := bot.AddLabels("org", "repo", number, "lgtm", "approved"); err != nil {
+		t.Fatalf("failed to add labels: %v", err)
+	}
+	if err := bot.CreateStatus("org", "repo", "1111111", github.Status{State: github.StatusPending, Context: "unit"}); err != nil {
+		t.Fatalf("failed to create status: %v", err)
+	}
+	if err := bot.CreateStatus("org", "repo", "1111111", github.Status{State: github.StatusSuccess, Context: "unit"}); err != nil {
+		t.Fatalf("failed to create status: %v", err)
+	}
+	combined, err := bot.GetCombinedStatus("org", "repo", "feature")
+	if err != nil {
+		t.Fatalf("failed to get combined status: %v", err)
+	}
+	if combined.State != github.StatusSuccess || len(combined.Statuses) != 1 {
+		t.Errorf("expected a single successful status, got %+v", combined)
+	}
+
+	// Pushing to the branch synchronizes the pull request.
+	ts.push(t, "feature", "2222222")
+	pr, err := bot.GetPullRequest("org", "repo", number)
+	if err != nil {
+		t.Fatalf("failed to get pull request: %v", err)
+	}
+	if pr.Head.SHA != "2222222" || pr.Commits != 2 {
+		t.Errorf("expected the head to move to the pushed commit, got %s after %d commits", pr.Head.SHA, pr.Commits)
+	}
+	if err := bot.Merge("org", "repo", number, github.MergeDetails{SHA: "1111111"}); !errors.As(err, new(github.ModifiedHeadError)) {
+		t.Errorf("expected a ModifiedHeadError merging an outdated head, got %v", err)
+	}
+	if err := bot.Merge("org", "repo", number, github.MergeDetails{SHA: "2222222", MergeMethod: "squash"}); err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if err := bot.Merge("org", "repo", number, github.MergeDetails{}); !errors.As(err, new(github.UnmergablePRError)) {
+		t.Errorf("expected an UnmergablePRError merging twice, got %v", err)
+	}
+	pr, err = bot.GetPullRequest("org", "repo", number)
+	if err != nil {
+		t.Fatalf("failed to get pull request: %v", err)
+	}
+	if !pr.Merged || pr.State != "closed" || pr.MergeSHA == nil {
+		t.Fatalf("expected a merged pull request, got %+v", pr)
+	}
+	if sha, err := bot.GetRef("org", "repo", "heads/master"); err != nil || sha != *pr.MergeSHA {
+		t.Errorf("expected master to point to the merge commit %s, got %s (%v)", *pr.MergeSHA, sha, err)
+	}
+
+	expected := []recordedEvent{
+		{Type: "pull_request", Action: "opened"},
+		{Type: "pull_request_review", Action: "submitted"},
+		{Type: "pull_request", Action: "labeled"},
+		{Type: "pull_request", Action: "labeled"},
+		{Type: "status"},
+		{Type: "status"},
+		{Type: "push"},
+		{Type: "pull_request", Action: "synchronize"},
+		{Type: "pull_request", Action: "closed"},
+		{Type: "push"},
+	}
+	if diff := cmp.Diff(expected, events()); diff != "" {
+		t.Errorf("unexpected webhooks (-want +got):\n%s", diff)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	bot := newTestServer(t).bot
+
+	for _, tc := range []struct {
+		user         string
+		member       bool
+		collaborator bool
+		permission   string
+	}{
+		{user: "alice", collaborator: true, permission: "write"},
+		{user: "bob", member: true, collaborator: true, permission: "read"},
+		{user: "mallory", permission: "none"},
+	} {
+		if member, err := bot.IsMember("org", tc.user); err != nil || member != tc.member {
+			t.Errorf("%s: expected membership %t, got %t (%v)", tc.user, tc.member, member, err)
+		}
+		if collaborator, err := bot.IsCollaborator("org", "repo", tc.user); err != nil || collaborator != tc.collaborator {
+			t.Errorf("%s: expected collaborator %t, got %t (%v)", tc.user, tc.collaborator, collaborator, err)
+		}
+		if permission, err := bot.GetUserPermission("org", "repo", tc.user); err != nil || permission != tc.permission {
+			t.Errorf("%s: expected permission %s, got %s (%v)", tc.user, tc.permission, permission, err)
+		}
+	}
+	if err := bot.AddCollaborator("org", "repo", "mallory", github.RepoTriage); err != nil {
+		t.Fatalf("failed to add collaborator: %v", err)
+	}
+	if permission, err := bot.GetUserPermission("org", "repo", "mallory"); err != nil || permission != "triage" {
+		t.Errorf("expected mallory to be able to triage, got %s (%v)", permission, err)
+	}
+}
+
+// tideSearch mirrors the query tide sends.
+type tideSearch struct {
+	RateLimit struct {
+		Cost      githubql.Int
+		Remaining githubql.Int
+	}
+	Search struct {
+		PageInfo struct {
+			HasNextPage githubql.Boolean
+			EndCursor   githubql.String
+		}
+		Nodes []struct {
+			PullRequest struct {
+				Number githubql.Int
+				Author struct {
+					Login githubql.String
+				}
+				BaseRef struct {
+					Name   githubql.String
+					Prefix githubql.String
+				}
+				HeadRefOID     githubql.String `graphql:"headRefOid"`
+				Mergeable      githubql.MergeableState
+				ReviewDecision githubql.PullRequestReviewDecision `graphql:"reviewDecision"`
+				Commits        struct {
+					Nodes []struct {
+						Commit struct {
+							OID    githubql.String `graphql:"oid"`
+							Status struct {
+								Contexts []struct {
+									Context githubql.String
+									State   githubql.StatusState
+								}
+							}
+							StatusCheckRollup struct {
+								Contexts struct {
+									Nodes []struct {
+										CheckRun struct {
+											Name       githubql.String
+											Conclusion githubql.String
+										} `graphql:"... on CheckRun"`
+									}
+								} `graphql:"contexts(last: 100)"`
+							}
+						}
+					}
+				} `graphql:"commits(last: 4)"`
+				Labels struct {
+					Nodes []struct {
+						Name githubql.String
+					}
+				} `graphql:"labels(first: 100)"`
+				Milestone *struct {
+					Title githubql.String
+				}
+				UpdatedAt githubql.DateTime
+			} `graphql:"... on PullRequest"`
+		}
+	} `graphql:"search(type: ISSUE, first: 1, after: $searchCursor, query: $query)"`
+}
+
+func TestGraphQLSearch(t *testing.T) {
+	ts := newTestServer(t)
+	bot, alice := ts.bot, ts.alice
+
+	ts.push(t, "other", "3333333")
+	for _, branch := range []string{"feature", "other"} {
+		number, err := alice.CreatePullRequest("org", "repo", "Change "+branch, "", branch, "master", true)
+		if err != nil {
+			t.Fatalf("failed to create pull request: %v", err)
+		}
+		if err := bot.AddLabel("org", "repo", number, "lgtm"); err != nil {
+			t.Fatalf("failed to add label: %v", err)
+		}
+	}
+	if _, err := alice.CreateIssue("org", "repo", "Not a pull request", "", 0, []string{"lgtm"}, nil); err != nil {
+		t.Fatalf("failed to create issue: %v", err)
+	}
+	if err := bot.CreateStatus("org", "repo", "1111111", github.Status{State: github.StatusSuccess, Context: "unit"}); err != nil {
+		t.Fatalf("failed to create status: %v", err)
+	}
+	if err := bot.CreateReview("org", "repo", 1, github.DraftReview{Action: github.Approve}); err != nil {
+		t.Fatalf("failed to review: %v", err)
+	}
+
+	var cursor *githubql.String
+	vars := map[string]interface{}{
+		"query":        githubql.String(`is:pr state:open archived:false label:"lgtm" org:"org"`),
+		"searchCursor": cursor,
+	}
+	var numbers []int
+	for page := 0; ; page++ {
+		var q tideSearch
+		if err := bot.QueryWithGitHubAppsSupport(context.Background(), &q, vars, "org"); err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		for _, node := range q.Search.Nodes {
+			pr := node.PullRequest
+			numbers = append(numbers, int(pr.Number))
+			if pr.Author.Login != "alice" || pr.BaseRef.Name != "master" || pr.Mergeable != githubql.MergeableStateMergeable {
+				t.Errorf("unexpected pull request %+v", pr)
+			}
+			if len(pr.Labels.Nodes) != 1 || pr.Labels.Nodes[0].Name != "lgtm" || pr.Milestone != nil || time.Since(pr.UpdatedAt.Time) > time.Minute {
+				t.Errorf("unexpected labels, milestone or update time in %+v", pr)
+			}
+			if len(pr.Commits.Nodes) != 1 || pr.Commits.Nodes[0].Commit.OID != pr.HeadRefOID {
+				t.Errorf("expected the head commit, got %+v", pr.Commits.Nodes)
+			}
+		}
+		if page == 0 {
+			pr := q.Search.Nodes[0].PullRequest
+			if pr.ReviewDecision != githubql.PullRequestReviewDecisionApproved {
+				t.Errorf("expected the first pull request to be approved, got %q", pr.ReviewDecision)
+			}
+			if contexts := pr.Commits.Nodes[0].Commit.Status.Contexts; len(contexts) != 1 || contexts[0].State != githubql.StatusStateSuccess {
+				t.Errorf("expected a successful status context, got %+v", contexts)
+			}
+		}
+		if !q.Search.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &q.Search.PageInfo.EndCursor
+		vars["searchCursor"] = cursor
+	}
+	if diff := cmp.Diff([]int{1, 2}, numbers); diff != "" {
+		t.Errorf("unexpected search results (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	s := newState("k8s-ci-robot", nil)
+	server := httptest.NewServer(newRouter(s))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/repos/org/repo/contents/OWNERS")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected %d, got %d: %s", http.StatusNotFound, resp.StatusCode, body)
+	}
+}
+
+func TestUnknownRepo(t *testing.T) {
+	ts := newTestServer(t)
+
+	if _, err := ts.bot.GetRepo("org", "missing"); err == nil {
+		t.Error("expected getting a missing repo to fail")
+	}
+	if _, err := ts.bot.CreateIssue("org", "missing", "Broken", "", 0, nil, nil); err == nil {
+		t.Error("expected creating an issue in a missing repo to fail")
+	}
+	if _, err := ts.bot.GetRepo("org", "missing"); err == nil {
+		t.Error("expected the missing repo not to be created on use")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	const secret = "abcde12345"
+	type delivery struct {
+		eventType string
+		validated bool
+	}
+	deliveries := make(chan delivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := ioutil.ReadAll(r.Body)
+		validated := github.ValidatePayload(payload, r.Header.Get("X-Hub-Signature"), func() []byte { return []byte(secret) })
+		deliveries <- delivery{eventType: r.Header.Get("X-GitHub-Event"), validated: validated}
+	}))
+	defer receiver.Close()
+
+	sender := newWebhookSender()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sender.run(ctx)
+	s := newState("k8s-ci-robot", sender.enqueue)
+	s.load(&seed{Repos: []seedRepo{{Org: "org", Name: "repo"}, {Org: "org", Name: "other"}, {Org: "unhooked", Name: "repo"}}})
+	server := httptest.NewServer(newRouter(s))
+	defer server.Close()
+	client := github.NewClient(func() []byte { return nil }, func(b []byte) []byte { return b }, server.URL+"/graphql", server.URL)
+	client.SetMax404Retries(0)
+
+	config := &github.HookConfig{URL: receiver.URL, Secret: &[]string{secret}[0]}
+	repoHook, err := client.CreateRepoHook("org", "repo", github.HookRequest{Events: []string{"issues"}, Config: config})
+	if err != nil {
+		t.Fatalf("failed to create repo hook: %v", err)
+	}
+	if _, err := client.CreateOrgHook("org", github.HookRequest{Events: []string{"issue_comment"}, Config: config}); err != nil {
+		t.Fatalf("failed to create org hook: %v", err)
+	}
+	if _, err := client.CreateRepoHook("org", "missing", github.HookRequest{Config: config}); err == nil {
+		t.Error("expected creating a hook for a missing repo to fail")
+	}
+	hooks, err := client.ListRepoHooks("org", "repo")
+	if err != nil {
+		t.Fatalf("failed to list hooks: %v", err)
+	}
+	if len(hooks) != 1 || hooks[0].ID != repoHook || *hooks[0].Config.Secret == secret {
+		t.Errorf("expected the hook with a masked secret, got %+v", hooks)
+	}
+
+	// Nothing is delivered for the repo of another org, which has no hook.
+	if _, err := client.CreateIssue("unhooked", "repo", "Broken", "", 0, nil, nil); err != nil {
+		t.Fatalf("failed to create issue: %v", err)
+	}
+	// The repo hook gets the issue, the org hook gets the comment.
+	number, err := client.CreateIssue("org", "repo", "Broken", "", 0, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create issue: %v", err)
+	}
+	if err := client.CreateComment("org", "repo", number, "/retest"); err != nil {
+		t.Fatalf("failed to comment: %v", err)
+	}
+	// Deactivated hooks don't get anything.
+	if err := client.EditRepoHook("org", "repo", repoHook, github.HookRequest{Active: &[]bool{false}[0]}); err != nil {
+		t.Fatalf("failed to edit hook: %v", err)
+	}
+	if _, err := client.CreateIssue("org", "repo", "Still broken", "", 0, nil, nil); err != nil {
+		t.Fatalf("failed to create issue: %v", err)
+	}
+	// The org hook doesn't get issues of the other repo of the org either.
+	if _, err := client.CreateIssue("org", "other", "Broken", "", 0, nil, nil); err != nil {
+		t.Fatalf("failed to create issue: %v", err)
+	}
+	if err := client.CreateComment("org", "other", 1, "/retest"); err != nil {
+		t.Fatalf("failed to comment: %v", err)
+	}
+
+	var got []delivery
+	for len(got) < 3 {
+		select {
+		case d := <-deliveries:
+			got = append(got, d)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for webhooks, got %+v", got)
+		}
+	}
+	select {
+	case d := <-deliveries:
+		t.Errorf("unexpected webhook %+v", d)
+	case <-time.After(100 * time.Millisecond):
+	}
+	expected := []delivery{{eventType: "issues", validated: true}, {eventType: "issue_comment", validated: true}, {eventType: "issue_comment", validated: true}}
+	if diff := cmp.Diff(expected, got, cmp.AllowUnexported(delivery{})); diff != "" {
+		t.Errorf("unexpected webhooks (-want +got):\n%s", diff)
+	}
+}
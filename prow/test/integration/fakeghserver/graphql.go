@@ -0,0 +1,448 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The GraphQL endpoint understands the subset of the query language emitted
+// by github.com/shurcooL/githubv4: a single query operation with variables,
+// fields with arguments, nested selections and inline fragments. Responses
+// are projected from the model so that they contain exactly the requested
+// fields, as the client refuses to decode anything else.
+
+// gqlObject is a resolved GraphQL object keyed by field name. The special
+// __typename key is used to match inline fragments.
+type gqlObject map[string]interface{}
+
+// gqlField is a field whose value depends on its arguments.
+type gqlField func(args map[string]interface{}) (interface{}, error)
+
+// selection is a single field or inline fragment in a selection set.
+type selection struct {
+	name     string
+	alias    string
+	args     map[string]interface{}
+	fragment string
+	children []selection
+}
+
+type gqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type gqlError struct {
+	Message string `json:"message"`
+}
+
+func graphqlHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		var req gqlRequest
+		if err := unmarshal(r, &req); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		sels, err := parseQuery(req.Query, req.Variables)
+		if err == nil {
+			var data interface{}
+			if data, err = resolve(s.queryRoot(s.actor(r)), sels); err == nil {
+				return marshal(map[string]interface{}{"data": data}, http.StatusOK)
+			}
+		}
+		// GraphQL reports errors in the body of a successful response.
+		return marshal(map[string]interface{}{"errors": []gqlError{{Message: err.Error()}}}, http.StatusOK)
+	}
+}
+
+// resolve projects value onto the selection set.
+func resolve(value interface{}, sels []selection) (interface{}, error) {
+	switch v := value.(type) {
+	case gqlObject:
+		out := map[string]interface{}{}
+		if err := resolveInto(out, v, sels); err != nil {
+			return nil, err
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			res, err := resolve(item, sels)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, res)
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+func resolveInto(out map[string]interface{}, obj gqlObject, sels []selection) error {
+	for _, sel := range sels {
+		if sel.fragment != "" {
+			if obj["__typename"] == sel.fragment {
+				if err := resolveInto(out, obj, sel.children); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		key := sel.name
+		if sel.alias != "" {
+			key = sel.alias
+		}
+		value, ok := obj[sel.name]
+		if !ok {
+			return fmt.Errorf("field %q doesn't exist on type %q", sel.name, obj["__typename"])
+		}
+		if field, ok := value.(gqlField); ok {
+			var err error
+			if value, err = field(sel.args); err != nil {
+				return err
+			}
+		}
+		value = paginate(value, sel.args)
+		res, err := resolve(value, sel.children)
+		if err != nil {
+			return err
+		}
+		out[key] = res
+	}
+	return nil
+}
+
+// paginate applies the first and last arguments to a connection.
+func paginate(value interface{}, args map[string]interface{}) interface{} {
+	conn, ok := value.(gqlObject)
+	if !ok {
+		return value
+	}
+	nodes, ok := conn["nodes"].([]interface{})
+	if !ok {
+		return value
+	}
+	if first, ok := intArg(args, "first"); ok && first < len(nodes) {
+		nodes = nodes[:first]
+	}
+	if last, ok := intArg(args, "last"); ok && last < len(nodes) {
+		nodes = nodes[len(nodes)-last:]
+	}
+	paged := gqlObject{}
+	for k, v := range conn {
+		paged[k] = v
+	}
+	paged["nodes"] = nodes
+	return paged
+}
+
+func intArg(args map[string]interface{}, name string) (int, bool) {
+	switch v := args[name].(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func stringArg(args map[string]interface{}, name string) string {
+	if v, ok := args[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// connection wraps nodes the way GitHub's GraphQL API exposes lists.
+func connection(nodes []interface{}) gqlObject {
+	if nodes == nil {
+		nodes = []interface{}{}
+	}
+	return gqlObject{
+		"nodes":      nodes,
+		"totalCount": len(nodes),
+		"pageInfo": gqlObject{
+			"hasNextPage":     false,
+			"hasPreviousPage": false,
+			"startCursor":     nil,
+			"endCursor":       nil,
+		},
+	}
+}
+
+// parseQuery parses a query document into the selection set of its
+// operation, substituting variables.
+func parseQuery(query string, variables map[string]interface{}) ([]selection, error) {
+	p := &gqlParser{input: query, variables: variables}
+	p.next()
+	if p.tok == "mutation" || p.tok == "subscription" {
+		return nil, fmt.Errorf("%s operations are not supported", p.tok)
+	}
+	if p.tok == "query" {
+		p.next()
+		if p.isName() {
+			p.next()
+		}
+		if p.tok == "(" {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q after the operation", p.tok)
+	}
+	return sels, nil
+}
+
+type gqlParser struct {
+	input     string
+	pos       int
+	tok       string
+	str       bool
+	variables map[string]interface{}
+}
+
+// next advances to the next token. String literals are unquoted and flagged
+// so that they aren't mistaken for names or punctuation.
+func (p *gqlParser) next() {
+	p.str = false
+	for p.pos < len(p.input) && (unicode.IsSpace(rune(p.input[p.pos])) || p.input[p.pos] == ',') {
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		p.tok = ""
+		return
+	}
+	start := p.pos
+	switch c := p.input[p.pos]; {
+	case strings.HasPrefix(p.input[p.pos:], "..."):
+		p.pos += 3
+	case c == '"':
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.input) && p.input[p.pos] != '"' {
+			if p.input[p.pos] == '\\' && p.pos+1 < len(p.input) {
+				p.pos++
+			}
+			b.WriteByte(p.input[p.pos])
+			p.pos++
+		}
+		p.pos++
+		p.tok, p.str = b.String(), true
+		return
+	case c == '_' || c == '-' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+		for p.pos < len(p.input) {
+			c := rune(p.input[p.pos])
+			if c != '_' && c != '-' && c != '.' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				break
+			}
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.input[start:p.pos]
+}
+
+func (p *gqlParser) isName() bool {
+	if p.str || p.tok == "" {
+		return false
+	}
+	c := rune(p.tok[0])
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func (p *gqlParser) expect(tok string) error {
+	if p.tok != tok || p.str {
+		return fmt.Errorf("expected %q, got %q", tok, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+// skipVariableDefinitions skips `($a: String!, $b: [Int])`; the values come
+// from the variables of the request.
+func (p *gqlParser) skipVariableDefinitions() error {
+	depth := 0
+	for {
+		switch {
+		case p.tok == "":
+			return fmt.Errorf("unterminated variable definitions")
+		case p.tok == "(":
+			depth++
+		case p.tok == ")":
+			depth--
+		}
+		p.next()
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func (p *gqlParser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []selection
+	for p.tok != "}" {
+		if p.tok == "" {
+			return nil, fmt.Errorf("unterminated selection set")
+		}
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	p.next()
+	return sels, nil
+}
+
+func (p *gqlParser) selection() (selection, error) {
+	var sel selection
+	if p.tok == "..." {
+		p.next()
+		if err := p.expect("on"); err != nil {
+			return sel, err
+		}
+		if !p.isName() {
+			return sel, fmt.Errorf("expected a type condition, got %q", p.tok)
+		}
+		sel.fragment = p.tok
+		p.next()
+		var err error
+		sel.children, err = p.selectionSet()
+		return sel, err
+	}
+	if !p.isName() {
+		return sel, fmt.Errorf("expected a field, got %q", p.tok)
+	}
+	sel.name = p.tok
+	p.next()
+	if p.tok == ":" {
+		p.next()
+		if !p.isName() {
+			return sel, fmt.Errorf("expected a field after alias %q, got %q", sel.name, p.tok)
+		}
+		sel.alias, sel.name = sel.name, p.tok
+		p.next()
+	}
+	if p.tok == "(" {
+		p.next()
+		sel.args = map[string]interface{}{}
+		for p.tok != ")" {
+			if !p.isName() {
+				return sel, fmt.Errorf("expected an argument name, got %q", p.tok)
+			}
+			name := p.tok
+			p.next()
+			if err := p.expect(":"); err != nil {
+				return sel, err
+			}
+			value, err := p.value()
+			if err != nil {
+				return sel, err
+			}
+			sel.args[name] = value
+		}
+		p.next()
+	}
+	if p.tok == "{" {
+		var err error
+		sel.children, err = p.selectionSet()
+		return sel, err
+	}
+	return sel, nil
+}
+
+func (p *gqlParser) value() (interface{}, error) {
+	tok, str := p.tok, p.str
+	p.next()
+	switch {
+	case str:
+		return tok, nil
+	case tok == "$":
+		if !p.isName() {
+			return nil, fmt.Errorf("expected a variable name, got %q", p.tok)
+		}
+		name := p.tok
+		p.next()
+		return p.variables[name], nil
+	case tok == "[":
+		var list []interface{}
+		for p.tok != "]" {
+			if p.tok == "" {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		p.next()
+		return list, nil
+	case tok == "{":
+		obj := map[string]interface{}{}
+		for p.tok != "}" {
+			if !p.isName() {
+				return nil, fmt.Errorf("expected a field name, got %q", p.tok)
+			}
+			name := p.tok
+			p.next()
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = value
+		}
+		p.next()
+		return obj, nil
+	case tok == "true" || tok == "false":
+		return tok == "true", nil
+	case tok == "null":
+		return nil, nil
+	}
+	if n, err := strconv.Atoi(tok); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return f, nil
+	}
+	if tok == "" || strings.ContainsAny(tok[:1], "(){}[]:!=@") {
+		return nil, fmt.Errorf("unexpected %q in argument", tok)
+	}
+	// Enum values are represented by their names.
+	return tok, nil
+}
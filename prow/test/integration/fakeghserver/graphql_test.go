@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestResolve(t *testing.T) {
+	root := gqlObject{
+		"viewer": gqlObject{"__typename": "User", "login": "alice", "url": "https://github.com/alice"},
+		"node": gqlField(func(args map[string]interface{}) (interface{}, error) {
+			id, _ := intArg(args, "id")
+			return gqlObject{
+				"__typename": "PullRequest",
+				"number":     id,
+				"labels": connection([]interface{}{
+					gqlObject{"name": "a"}, gqlObject{"name": "b"}, gqlObject{"name": "c"},
+				}),
+			}, nil
+		}),
+	}
+	testCases := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		expected  interface{}
+		expectErr bool
+	}{
+		{
+			name:     "plain selection",
+			query:    `{viewer{login}}`,
+			expected: map[string]interface{}{"viewer": map[string]interface{}{"login": "alice"}},
+		},
+		{
+			name:     "named query with alias",
+			query:    `query Me { me: viewer { login } }`,
+			expected: map[string]interface{}{"me": map[string]interface{}{"login": "alice"}},
+		},
+		{
+			name:      "variables, fragments and pagination",
+			query:     `query($id:Int!$n:Int){node(id: $id){...on PullRequest{number,labels(last: $n){nodes{name}}},...on Issue{title}}}`,
+			variables: map[string]interface{}{"id": float64(7), "n": float64(2)},
+			expected: map[string]interface{}{"node": map[string]interface{}{
+				"number": 7,
+				"labels": map[string]interface{}{"nodes": []interface{}{
+					map[string]interface{}{"name": "b"},
+					map[string]interface{}{"name": "c"},
+				}},
+			}},
+		},
+		{
+			name:      "unknown field",
+			query:     `{viewer{email}}`,
+			expectErr: true,
+		},
+		{
+			name:      "mutation",
+			query:     `mutation($input:AddCommentInput!){addComment(input:$input){clientMutationId}}`,
+			expectErr: true,
+		},
+		{
+			name:      "unterminated",
+			query:     `{viewer{login}`,
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sels, err := parseQuery(tc.query, tc.variables)
+			var actual interface{}
+			if err == nil {
+				actual, err = resolve(root, sels)
+			}
+			if err != nil {
+				if !tc.expectErr {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tc.expectErr {
+				t.Fatalf("expected an error, got %v", actual)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSearchMatches(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := newState("k8s-ci-robot", nil)
+	s.now = func() time.Time { return now }
+	s.load(&seed{Repos: []seedRepo{
+		{Org: "org", Name: "repo", Branches: map[string]string{"feature": "abc"}},
+		{Org: "org", Name: "archived", Archived: true},
+		{Org: "other", Name: "repo"},
+	}})
+	pr := func(repo *repoState, author string, labels ...string) *issue {
+		i := s.newIssue(repo, "Fix the thing", "", s.user(author))
+		i.PullRequest = &struct{}{}
+		i.pr = &github.PullRequest{Base: github.PullRequestBranch{Ref: "master"}, Head: github.PullRequestBranch{Ref: "feature"}}
+		for _, l := range labels {
+			i.Labels = append(i.Labels, repo.label(l))
+		}
+		return i
+	}
+	repo, archived, other := s.repos["org/repo"], s.repos["org/archived"], s.repos["other/repo"]
+	lgtm := pr(repo, "alice", "lgtm", "approved")
+	held := pr(repo, "bob", "lgtm", "approved", "do-not-merge/hold")
+	unlabeled := pr(repo, "alice")
+	broken := s.newIssue(repo, "Thing is broken", "", s.user("carol"))
+	inArchive := pr(archived, "alice", "lgtm", "approved")
+	elsewhere := pr(other, "alice", "lgtm", "approved")
+	approved := pr(other, "bob")
+	approved.reviews = []github.Review{{User: s.user("carol"), State: github.ReviewStateApproved}}
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected []*issue
+	}{
+		{
+			name:     "tide query",
+			query:    `is:pr state:open archived:false label:"lgtm" label:"approved" -label:"do-not-merge/hold" org:"org" updated:2021-05-01T00:00:00Z..*`,
+			expected: []*issue{lgtm},
+		},
+		{
+			name:     "orgs and repos are alternatives",
+			query:    `is:pr label:lgtm org:"org" repo:"other/repo" -repo:"org/archived"`,
+			expected: []*issue{lgtm, held, elsewhere},
+		},
+		{
+			name:     "label alternatives",
+			query:    `label:do-not-merge/hold,approved -author:alice`,
+			expected: []*issue{held},
+		},
+		{
+			name:     "issues",
+			query:    `is:issue broken`,
+			expected: []*issue{broken},
+		},
+		{
+			name:     "review decision",
+			query:    `review:approved`,
+			expected: []*issue{approved},
+		},
+		{
+			name:     "not updated in range",
+			query:    `is:pr updated:*..2021-05-01T00:00:00Z`,
+			expected: nil,
+		},
+		{
+			name:     "base and author",
+			query:    `base:master author:alice`,
+			expected: []*issue{inArchive, lgtm, unlabeled, elsewhere},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := parseSearch(tc.query)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			var actual []*issue
+			for _, r := range s.sortedRepos() {
+				for _, number := range r.sortedIssues() {
+					if i := r.issues[number]; q.matches(s, r, i) {
+						actual = append(actual, i)
+					}
+				}
+			}
+			if diff := cmp.Diff(issueKeys(tc.expected), issueKeys(actual)); diff != "" {
+				t.Errorf("unexpected matches (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := parseSearch("language:go"); err == nil {
+		t.Error("expected an error for an unsupported qualifier")
+	}
+}
+
+func issueKeys(issues []*issue) []string {
+	var keys []string
+	for _, i := range issues {
+		keys = append(keys, i.HTMLURL)
+	}
+	return keys
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// hooks returns the webhooks of the repo or org addressed by the request, or
+// nil if the org doesn't exist.
+func (s *state) hooks(r *http.Request) map[int]*github.Hook {
+	if repo := s.repo(r); repo != nil {
+		return repo.hooks
+	}
+	org := mux.Vars(r)["org"]
+	if hooks, ok := s.orgHooks[org]; ok {
+		return hooks
+	}
+	exists := s.orgMembers[org] != nil
+	for _, repo := range s.repos {
+		exists = exists || repo.Owner.Login == org
+	}
+	if !exists {
+		return nil
+	}
+	s.orgHooks[org] = map[int]*github.Hook{}
+	return s.orgHooks[org]
+}
+
+func hooksHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		hooks := s.hooks(r)
+		if hooks == nil {
+			return notFound()
+		}
+		if r.Method == http.MethodGet {
+			list := []github.Hook{}
+			for _, hook := range sortedHooks(hooks) {
+				list = append(list, maskSecret(*hook))
+			}
+			return marshal(list, http.StatusOK)
+		}
+		var data github.HookRequest
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		if data.Name != "" && data.Name != "web" {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: name must be web")
+		}
+		if data.Config == nil || data.Config.URL == "" {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: config.url is required")
+		}
+		hook := &github.Hook{ID: s.nextID(), Name: "web", Events: []string{"push"}, Active: true, Config: *data.Config}
+		if data.Events != nil {
+			hook.Events = data.Events
+		}
+		if data.Active != nil {
+			hook.Active = *data.Active
+		}
+		hooks[hook.ID] = hook
+		return marshal(maskSecret(*hook), http.StatusCreated)
+	}
+}
+
+func hookHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		hooks := s.hooks(r)
+		id, err := intVar(r, "hook_id")
+		if hooks == nil || err != nil || hooks[id] == nil {
+			return notFound()
+		}
+		hook := hooks[id]
+		switch r.Method {
+		case http.MethodPatch:
+			var data github.HookRequest
+			if err := unmarshal(r, &data); err != nil {
+				return errorResponse(http.StatusBadRequest, "%v", err)
+			}
+			if data.Config != nil {
+				hook.Config = *data.Config
+			}
+			if data.Active != nil {
+				hook.Active = *data.Active
+			}
+			if data.Events != nil {
+				hook.Events = data.Events
+			}
+			events := sets.NewString(hook.Events...).Insert(data.AddEvents...).Delete(data.RemoveEvents...)
+			hook.Events = events.List()
+		case http.MethodDelete:
+			delete(hooks, id)
+			return "", http.StatusNoContent, nil
+		}
+		return marshal(maskSecret(*hook), http.StatusOK)
+	}
+}
+
+// maskSecret hides the secret of the hook like GitHub does in responses.
+func maskSecret(hook github.Hook) github.Hook {
+	if hook.Config.Secret != nil {
+		masked := "********"
+		hook.Config.Secret = &masked
+	}
+	return hook
+}
+
+func sortedHooks(hooks map[int]*github.Hook) []*github.Hook {
+	var ids []int
+	for id := range hooks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var sorted []*github.Hook
+	for _, id := range ids {
+		sorted = append(sorted, hooks[id])
+	}
+	return sorted
+}
+
+// subscribes tells whether the hook receives events of the type.
+func subscribes(hook *github.Hook, eventType string) bool {
+	return sets.NewString(hook.Events...).HasAny("*", eventType)
+}
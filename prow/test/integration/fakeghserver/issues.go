@@ -0,0 +1,459 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func listIssuesHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		state := r.URL.Query().Get("state")
+		if state == "" {
+			state = github.PullRequestStateOpen
+		}
+		issues := []github.Issue{}
+		for _, number := range repo.sortedIssues() {
+			if i := repo.issues[number]; state == "all" || i.State == state {
+				issues = append(issues, i.Issue)
+			}
+		}
+		return marshal(issues, http.StatusOK)
+	}
+}
+
+func createIssueHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		var data struct {
+			Title     string   `json:"title"`
+			Body      string   `json:"body"`
+			Milestone int      `json:"milestone"`
+			Labels    []string `json:"labels"`
+			Assignees []string `json:"assignees"`
+		}
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		if data.Title == "" {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: title is missing")
+		}
+		sender := s.actor(r)
+		i := s.newIssue(repo, data.Title, data.Body, sender)
+		i.Milestone.Number = data.Milestone
+		for _, label := range data.Labels {
+			i.Labels = append(i.Labels, repo.label(label))
+		}
+		for _, login := range data.Assignees {
+			if s.permission(repo, login) != github.None {
+				i.Assignees = append(i.Assignees, s.user(login))
+			}
+		}
+		s.issueEvent(repo, i, string(github.IssueActionOpened), nil, sender)
+		return marshal(i.Issue, http.StatusCreated)
+	}
+}
+
+// newIssue files a new issue; pull requests are issues too and share the
+// numbering.
+func (s *state) newIssue(repo *repoState, title, body string, author github.User) *issue {
+	repo.lastNumber++
+	now := s.now()
+	i := &issue{Issue: github.Issue{
+		ID:        s.nextID(),
+		User:      author,
+		Number:    repo.lastNumber,
+		Title:     title,
+		Body:      body,
+		State:     github.PullRequestStateOpen,
+		HTMLURL:   fmt.Sprintf("%s/issues/%d", repo.HTMLURL, repo.lastNumber),
+		Labels:    []github.Label{},
+		Assignees: []github.User{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}}
+	i.NodeID = fmt.Sprintf("I_%d", i.ID)
+	repo.issues[i.Number] = i
+	return i
+}
+
+func getIssueHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		_, i, err := s.issue(r)
+		if err != nil || i == nil {
+			return notFound()
+		}
+		return marshal(i.Issue, http.StatusOK)
+	}
+}
+
+func editIssueHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i, err := s.issue(r)
+		if err != nil || i == nil {
+			return notFound()
+		}
+		var data struct {
+			Title *string `json:"title"`
+			Body  *string `json:"body"`
+			State *string `json:"state"`
+		}
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		s.editIssue(repo, i, data.Title, data.Body, data.State, s.actor(r))
+		return marshal(i.Issue, http.StatusOK)
+	}
+}
+
+// editIssue applies an edit from either the issues or the pulls API.
+func (s *state) editIssue(repo *repoState, i *issue, title, body, state *string, sender github.User) {
+	if (title != nil && *title != i.Title) || (body != nil && *body != i.Body) {
+		if title != nil {
+			i.Title = *title
+		}
+		if body != nil {
+			i.Body = *body
+		}
+		s.touch(i)
+		s.issueEvent(repo, i, string(github.IssueActionEdited), nil, sender)
+	}
+	if state == nil || *state == i.State {
+		return
+	}
+	if i.pr != nil && i.pr.Merged {
+		return
+	}
+	i.State = *state
+	s.touch(i)
+	action := github.IssueActionClosed
+	if i.State == github.PullRequestStateOpen {
+		action = github.IssueActionReopened
+	}
+	s.issueEvent(repo, i, string(action), nil, sender)
+}
+
+func listIssueCommentsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		_, i, err := s.issue(r)
+		if err != nil || i == nil {
+			return notFound()
+		}
+		comments := append([]github.IssueComment{}, i.comments...)
+		return marshal(comments, http.StatusOK)
+	}
+}
+
+func createIssueCommentHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i, err := s.issue(r)
+		if err != nil || i == nil {
+			return notFound()
+		}
+		var data github.IssueComment
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		now := s.now()
+		comment := github.IssueComment{
+			ID:        s.nextID(),
+			Body:      data.Body,
+			User:      s.actor(r),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		comment.HTMLURL = fmt.Sprintf("%s#issuecomment-%d", i.HTMLURL, comment.ID)
+		i.comments = append(i.comments, comment)
+		s.touch(i)
+		s.commentEvent(repo, i, comment, github.IssueCommentActionCreated)
+		return marshal(comment, http.StatusCreated)
+	}
+}
+
+func (s *state) commentEvent(repo *repoState, i *issue, comment github.IssueComment, action github.IssueCommentEventAction) {
+	s.event(repo, "issue_comment", github.IssueCommentEvent{
+		Action:  action,
+		Issue:   i.Issue,
+		Comment: comment,
+		Repo:    repo.Repo,
+	})
+}
+
+// comment finds the comment addressed by the request.
+func (s *state) comment(r *http.Request) (*repoState, *issue, int) {
+	repo := s.repo(r)
+	id, err := intVar(r, "comment_id")
+	if err != nil {
+		return repo, nil, -1
+	}
+	for _, number := range repo.sortedIssues() {
+		i := repo.issues[number]
+		for idx := range i.comments {
+			if i.comments[idx].ID == id {
+				return repo, i, idx
+			}
+		}
+	}
+	return repo, nil, -1
+}
+
+func issueCommentHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i, idx := s.comment(r)
+		if i == nil {
+			return notFound()
+		}
+		switch r.Method {
+		case http.MethodGet:
+			return marshal(i.comments[idx], http.StatusOK)
+		case http.MethodPatch:
+			var data github.IssueComment
+			if err := unmarshal(r, &data); err != nil {
+				return errorResponse(http.StatusBadRequest, "%v", err)
+			}
+			i.comments[idx].Body = data.Body
+			i.comments[idx].UpdatedAt = s.now()
+			s.commentEvent(repo, i, i.comments[idx], github.IssueCommentActionEdited)
+			return marshal(i.comments[idx], http.StatusOK)
+		case http.MethodDelete:
+			comment := i.comments[idx]
+			i.comments = append(i.comments[:idx], i.comments[idx+1:]...)
+			s.commentEvent(repo, i, comment, github.IssueCommentActionDeleted)
+			return "", http.StatusNoContent, nil
+		}
+		return notSupported(r)
+	}
+}
+
+// reactionHandler accepts reactions without recording them.
+func reactionHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		var data github.Reaction
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		return marshal(struct {
+			ID      int         `json:"id"`
+			User    github.User `json:"user"`
+			Content string      `json:"content"`
+		}{ID: s.nextID(), User: s.actor(r), Content: data.Content}, http.StatusCreated)
+	}
+}
+
+func repoLabelsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		if r.Method == http.MethodPost {
+			var data github.Label
+			if err := unmarshal(r, &data); err != nil {
+				return errorResponse(http.StatusBadRequest, "%v", err)
+			}
+			if _, exists := repo.labels[strings.ToLower(data.Name)]; exists {
+				return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: label %q already_exists", data.Name)
+			}
+			data.URL = fmt.Sprintf("https://api.github.com/repos/%s/labels/%s", repo.FullName, data.Name)
+			repo.labels[strings.ToLower(data.Name)] = data
+			return marshal(data, http.StatusCreated)
+		}
+		labels := []github.Label{}
+		for _, l := range repo.labels {
+			labels = append(labels, l)
+		}
+		sortLabels(labels)
+		return marshal(labels, http.StatusOK)
+	}
+}
+
+func repoLabelHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		name := strings.ToLower(mux.Vars(r)["label"])
+		label, exists := repo.labels[name]
+		if !exists {
+			return notFound()
+		}
+		switch r.Method {
+		case http.MethodGet:
+			return marshal(label, http.StatusOK)
+		case http.MethodPatch:
+			var data struct {
+				NewName     *string `json:"new_name"`
+				Name        *string `json:"name"`
+				Description *string `json:"description"`
+				Color       *string `json:"color"`
+			}
+			if err := unmarshal(r, &data); err != nil {
+				return errorResponse(http.StatusBadRequest, "%v", err)
+			}
+			if data.NewName == nil {
+				data.NewName = data.Name
+			}
+			if data.NewName != nil {
+				label.Name = *data.NewName
+			}
+			if data.Description != nil {
+				label.Description = *data.Description
+			}
+			if data.Color != nil {
+				label.Color = *data.Color
+			}
+			delete(repo.labels, name)
+			repo.labels[strings.ToLower(label.Name)] = label
+			// Renames and recolors apply to every issue with the label.
+			for _, i := range repo.issues {
+				for idx := range i.Labels {
+					if strings.ToLower(i.Labels[idx].Name) == name {
+						i.Labels[idx] = label
+					}
+				}
+			}
+			return marshal(label, http.StatusOK)
+		case http.MethodDelete:
+			delete(repo.labels, name)
+			for _, i := range repo.issues {
+				i.Labels = withoutLabel(i.Labels, name)
+			}
+			return "", http.StatusNoContent, nil
+		}
+		return notSupported(r)
+	}
+}
+
+func issueLabelsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i, err := s.issue(r)
+		if err != nil || i == nil {
+			return notFound()
+		}
+		if r.Method == http.MethodGet {
+			return marshal(i.Labels, http.StatusOK)
+		}
+		// The labels are sent either as a list or wrapped in an object.
+		var names []string
+		var wrapped struct {
+			Labels []string `json:"labels"`
+		}
+		if err := unmarshal(r, &names); err != nil {
+			if err := unmarshal(r, &wrapped); err != nil {
+				return errorResponse(http.StatusBadRequest, "%v", err)
+			}
+			names = wrapped.Labels
+		}
+		sender := s.actor(r)
+		if r.Method == http.MethodPut {
+			for _, l := range append([]github.Label{}, i.Labels...) {
+				i.Labels = withoutLabel(i.Labels, strings.ToLower(l.Name))
+				s.issueEvent(repo, i, string(github.IssueActionUnlabeled), &l, sender)
+			}
+		}
+		for _, name := range names {
+			if i.HasLabel(name) {
+				continue
+			}
+			label := repo.label(name)
+			i.Labels = append(i.Labels, label)
+			s.touch(i)
+			s.issueEvent(repo, i, string(github.IssueActionLabeled), &label, sender)
+		}
+		return marshal(i.Labels, http.StatusOK)
+	}
+}
+
+func removeIssueLabelHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i, err := s.issue(r)
+		if err != nil || i == nil {
+			return notFound()
+		}
+		name := mux.Vars(r)["label"]
+		if !i.HasLabel(name) {
+			return errorResponse(http.StatusNotFound, "Label does not exist")
+		}
+		label := repo.label(name)
+		i.Labels = withoutLabel(i.Labels, strings.ToLower(name))
+		s.touch(i)
+		s.issueEvent(repo, i, string(github.IssueActionUnlabeled), &label, s.actor(r))
+		return marshal(i.Labels, http.StatusOK)
+	}
+}
+
+func withoutLabel(labels []github.Label, lowerName string) []github.Label {
+	kept := []github.Label{}
+	for _, l := range labels {
+		if strings.ToLower(l.Name) != lowerName {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+func assigneesHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i, err := s.issue(r)
+		if err != nil || i == nil {
+			return notFound()
+		}
+		var data struct {
+			Assignees []string `json:"assignees"`
+		}
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		sender := s.actor(r)
+		for _, login := range data.Assignees {
+			switch assigned := i.IsAssignee(login); {
+			case r.Method == http.MethodPost && !assigned:
+				// Like GitHub, silently skip users that can't be assigned.
+				if s.permission(repo, login) == github.None {
+					continue
+				}
+				i.Assignees = append(i.Assignees, s.user(login))
+				s.touch(i)
+				s.issueEvent(repo, i, string(github.IssueActionAssigned), nil, sender)
+			case r.Method == http.MethodDelete && assigned:
+				var kept []github.User
+				for _, a := range i.Assignees {
+					if github.NormLogin(a.Login) != github.NormLogin(login) {
+						kept = append(kept, a)
+					}
+				}
+				i.Assignees = append([]github.User{}, kept...)
+				s.touch(i)
+				s.issueEvent(repo, i, string(github.IssueActionUnassigned), nil, sender)
+			}
+		}
+		code := http.StatusOK
+		if r.Method == http.MethodPost {
+			code = http.StatusCreated
+		}
+		return marshal(i.Issue, code)
+	}
+}
+
+func sortLabels(labels []github.Label) {
+	sort.Slice(labels, func(i, j int) bool {
+		return strings.ToLower(labels[i].Name) < strings.ToLower(labels[j].Name)
+	})
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func listPullRequestsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		state := r.URL.Query().Get("state")
+		if state == "" {
+			state = github.PullRequestStateOpen
+		}
+		prs := []github.PullRequest{}
+		for _, number := range repo.sortedIssues() {
+			if i := repo.issues[number]; i.pr != nil && (state == "all" || i.State == state) {
+				prs = append(prs, repo.pullRequest(i))
+			}
+		}
+		return marshal(prs, http.StatusOK)
+	}
+}
+
+func createPullRequestHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		var data struct {
+			Title string `json:"title"`
+			Body  string `json:"body"`
+			Head  string `json:"head"`
+			Base  string `json:"base"`
+			Draft bool   `json:"draft"`
+			// Files is not part of the GitHub API: as there is no git
+			// repository behind the server, clients may list the changes
+			// the pull request makes.
+			Files []github.PullRequestChange `json:"files"`
+		}
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		// Heads of forks are given as user:branch.
+		head := data.Head[strings.Index(data.Head, ":")+1:]
+		headSHA, ok := repo.refs["heads/"+head]
+		if !ok {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: head %q does not exist", data.Head)
+		}
+		baseSHA, ok := repo.refs["heads/"+data.Base]
+		if !ok {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: base %q does not exist", data.Base)
+		}
+		if data.Title == "" {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: title is missing")
+		}
+		sender := s.actor(r)
+		i := s.newIssue(repo, data.Title, data.Body, sender)
+		i.HTMLURL = fmt.Sprintf("%s/pull/%d", repo.HTMLURL, i.Number)
+		i.PullRequest = &struct{}{}
+		i.pr = &github.PullRequest{
+			ID:      s.nextID(),
+			HTMLURL: i.HTMLURL,
+			Base:    github.PullRequestBranch{Ref: data.Base, SHA: baseSHA},
+			Head:    github.PullRequestBranch{Ref: head, SHA: headSHA},
+			Draft:   data.Draft,
+		}
+		i.pr.NodeID = fmt.Sprintf("PR_%d", i.pr.ID)
+		i.commits = []github.RepositoryCommit{s.commit(headSHA, sender)}
+		i.changes = data.Files
+		s.issueEvent(repo, i, string(github.PullRequestActionOpened), nil, sender)
+		return marshal(repo.pullRequest(i), http.StatusCreated)
+	}
+}
+
+// pullRequest returns the pull request addressed by the request.
+func (s *state) pullRequest(r *http.Request) (*repoState, *issue) {
+	repo, i, err := s.issue(r)
+	if err != nil || i == nil || i.pr == nil {
+		return repo, nil
+	}
+	return repo, i
+}
+
+func getPullRequestHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i := s.pullRequest(r)
+		if i == nil {
+			return notFound()
+		}
+		return marshal(repo.pullRequest(i), http.StatusOK)
+	}
+}
+
+func editPullRequestHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i := s.pullRequest(r)
+		if i == nil {
+			return notFound()
+		}
+		var data struct {
+			Title *string `json:"title"`
+			Body  *string `json:"body"`
+			State *string `json:"state"`
+			Base  *string `json:"base"`
+		}
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		sender := s.actor(r)
+		if data.Base != nil && *data.Base != i.pr.Base.Ref {
+			sha, ok := repo.refs["heads/"+*data.Base]
+			if !ok {
+				return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: base %q does not exist", *data.Base)
+			}
+			i.pr.Base = github.PullRequestBranch{Ref: *data.Base, SHA: sha}
+			s.touch(i)
+			s.issueEvent(repo, i, string(github.PullRequestActionEdited), nil, sender)
+		}
+		s.editIssue(repo, i, data.Title, data.Body, data.State, sender)
+		return marshal(repo.pullRequest(i), http.StatusOK)
+	}
+}
+
+func pullRequestFilesHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		_, i := s.pullRequest(r)
+		if i == nil {
+			return notFound()
+		}
+		return marshal(append([]github.PullRequestChange{}, i.changes...), http.StatusOK)
+	}
+}
+
+func pullRequestCommitsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		_, i := s.pullRequest(r)
+		if i == nil {
+			return notFound()
+		}
+		return marshal(append([]github.RepositoryCommit{}, i.commits...), http.StatusOK)
+	}
+}
+
+// reviewCommentsHandler serves review comments, which the server does not
+// model.
+func reviewCommentsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		if _, i := s.pullRequest(r); i == nil {
+			return notFound()
+		}
+		return marshal([]github.ReviewComment{}, http.StatusOK)
+	}
+}
+
+var reviewStates = map[github.ReviewAction]github.ReviewState{
+	github.Approve:        github.ReviewStateApproved,
+	github.RequestChanges: github.ReviewStateChangesRequested,
+	github.Comment:        github.ReviewStateCommented,
+	"":                    github.ReviewStatePending,
+}
+
+func reviewsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i := s.pullRequest(r)
+		if i == nil {
+			return notFound()
+		}
+		if r.Method == http.MethodGet {
+			return marshal(append([]github.Review{}, i.reviews...), http.StatusOK)
+		}
+		var data github.DraftReview
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		state, ok := reviewStates[data.Action]
+		if !ok {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: unknown event %q", data.Action)
+		}
+		sender := s.actor(r)
+		if state != github.ReviewStatePending && github.NormLogin(sender.Login) == github.NormLogin(i.User.Login) && state != github.ReviewStateCommented {
+			return errorResponse(http.StatusUnprocessableEntity, "Can not approve or request changes on your own pull request")
+		}
+		review := github.Review{
+			ID:          s.nextID(),
+			User:        sender,
+			Body:        data.Body,
+			State:       state,
+			SubmittedAt: s.now(),
+		}
+		review.NodeID = fmt.Sprintf("PRR_%d", review.ID)
+		review.HTMLURL = fmt.Sprintf("%s#pullrequestreview-%d", i.HTMLURL, review.ID)
+		i.reviews = append(i.reviews, review)
+		if state != github.ReviewStatePending {
+			s.touch(i)
+			// Webhooks spell review states in lower case.
+			event := review
+			event.State = github.ReviewState(strings.ToLower(string(review.State)))
+			s.event(repo, "pull_request_review", github.ReviewEvent{
+				Action:      github.ReviewActionSubmitted,
+				PullRequest: repo.pullRequest(i),
+				Repo:        repo.Repo,
+				Review:      event,
+			})
+		}
+		return marshal(review, http.StatusOK)
+	}
+}
+
+func mergeHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo, i := s.pullRequest(r)
+		if i == nil {
+			return notFound()
+		}
+		if r.Method == http.MethodGet {
+			if i.pr.Merged {
+				return "", http.StatusNoContent, nil
+			}
+			return notFound()
+		}
+		var data github.MergeDetails
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		allowed := map[string]bool{
+			"":       repo.AllowMergeCommit,
+			"merge":  repo.AllowMergeCommit,
+			"squash": repo.AllowSquashMerge,
+			"rebase": repo.AllowRebaseMerge,
+		}
+		switch {
+		case i.State != github.PullRequestStateOpen || i.pr.Merged:
+			return errorResponse(http.StatusMethodNotAllowed, "Pull Request is not mergeable")
+		case i.pr.Draft:
+			return errorResponse(http.StatusMethodNotAllowed, "Pull Request is still a draft")
+		case !allowed[data.MergeMethod]:
+			return errorResponse(http.StatusMethodNotAllowed, "Merge commits are not allowed on this repository.")
+		case data.SHA != "" && data.SHA != i.pr.Head.SHA:
+			return errorResponse(http.StatusConflict, "Head branch was modified. Review and try the merge again.")
+		}
+		sender := s.actor(r)
+		sha := s.sha()
+		i.pr.Merged = true
+		i.pr.MergeSHA = &sha
+		i.State = github.PullRequestStateClosed
+		s.touch(i)
+		s.issueEvent(repo, i, string(github.PullRequestActionClosed), nil, sender)
+		s.updateRef(repo, "heads/"+i.pr.Base.Ref, sha, sender)
+		return marshal(map[string]interface{}{
+			"sha":     sha,
+			"merged":  true,
+			"message": "Pull Request successfully merged",
+		}, http.StatusOK)
+	}
+}
@@ -0,0 +1,444 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func userHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		user := s.actor(r)
+		if login, ok := mux.Vars(r)["user"]; ok {
+			user = s.user(login)
+		}
+		return marshal(user, http.StatusOK)
+	}
+}
+
+func getRepoHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		return marshal(s.repo(r).FullRepo, http.StatusOK)
+	}
+}
+
+func listReposHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		owner := mux.Vars(r)["org"]
+		repos := []github.Repo{}
+		for _, repo := range s.sortedRepos() {
+			if repo.Owner.Login == owner {
+				repos = append(repos, repo.Repo)
+			}
+		}
+		return marshal(repos, http.StatusOK)
+	}
+}
+
+func listBranchesHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		branches := []github.Branch{}
+		// Branch protection isn't modeled, so no branch is protected.
+		if r.URL.Query().Get("protected") == "true" {
+			return marshal(branches, http.StatusOK)
+		}
+		for ref := range repo.refs {
+			if strings.HasPrefix(ref, "heads/") {
+				branches = append(branches, github.Branch{Name: strings.TrimPrefix(ref, "heads/")})
+			}
+		}
+		sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+		return marshal(branches, http.StatusOK)
+	}
+}
+
+type gitRef struct {
+	Ref    string `json:"ref"`
+	Object struct {
+		SHA  string `json:"sha"`
+		Type string `json:"type"`
+	} `json:"object"`
+}
+
+func newGitRef(ref, sha string) gitRef {
+	r := gitRef{Ref: "refs/" + ref}
+	r.Object.SHA = sha
+	r.Object.Type = "commit"
+	return r
+}
+
+func getRefHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		ref := mux.Vars(r)["ref"]
+		if sha, ok := repo.refs[ref]; ok {
+			return marshal(newGitRef(ref, sha), http.StatusOK)
+		}
+		// Like GitHub, list the refs that start with the requested one.
+		matches := []gitRef{}
+		for candidate, sha := range repo.refs {
+			if strings.HasPrefix(candidate, ref) {
+				matches = append(matches, newGitRef(candidate, sha))
+			}
+		}
+		if len(matches) == 0 {
+			return notFound()
+		}
+		sort.Slice(matches, func(i, j int) bool { return matches[i].Ref < matches[j].Ref })
+		return marshal(matches, http.StatusOK)
+	}
+}
+
+func createRefHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		var data struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		if !strings.HasPrefix(data.Ref, "refs/") || data.SHA == "" {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: ref and sha are required")
+		}
+		ref := strings.TrimPrefix(data.Ref, "refs/")
+		if _, exists := repo.refs[ref]; exists {
+			return errorResponse(http.StatusUnprocessableEntity, "Reference already exists")
+		}
+		s.updateRef(repo, ref, data.SHA, s.actor(r))
+		return marshal(newGitRef(ref, data.SHA), http.StatusCreated)
+	}
+}
+
+// updateRefHandler moves or deletes a ref. Pushing to the branch of a pull
+// request synchronizes the pull request.
+func updateRefHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		ref := mux.Vars(r)["ref"]
+		if _, exists := repo.refs[ref]; !exists {
+			return errorResponse(http.StatusUnprocessableEntity, "Reference does not exist")
+		}
+		if r.Method == http.MethodDelete {
+			s.updateRef(repo, ref, "", s.actor(r))
+			return "", http.StatusNoContent, nil
+		}
+		var data struct {
+			SHA   string `json:"sha"`
+			Force bool   `json:"force"`
+		}
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		if data.SHA == "" {
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: sha is required")
+		}
+		s.updateRef(repo, ref, data.SHA, s.actor(r))
+		return marshal(newGitRef(ref, data.SHA), http.StatusOK)
+	}
+}
+
+func listOrgMembersHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		members := []github.TeamMember{}
+		for _, login := range s.orgMembers[mux.Vars(r)["org"]].List() {
+			members = append(members, github.TeamMember{Login: login})
+		}
+		return marshal(members, http.StatusOK)
+	}
+}
+
+func orgMemberHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		vars := mux.Vars(r)
+		if !s.isMember(vars["org"], vars["user"]) {
+			return notFound()
+		}
+		if strings.Contains(r.URL.Path, "/memberships/") {
+			return marshal(github.OrgMembership{
+				Membership: github.Membership{Role: github.RoleMember, State: github.StateActive},
+			}, http.StatusOK)
+		}
+		return "", http.StatusNoContent, nil
+	}
+}
+
+func listCollaboratorsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		var logins []string
+		for login := range repo.collaborators {
+			logins = append(logins, login)
+		}
+		sort.Strings(logins)
+		users := []github.User{}
+		for _, login := range logins {
+			user := s.user(login)
+			user.Permissions = permissionsFromLevel(repo.collaborators[login])
+			users = append(users, user)
+		}
+		return marshal(users, http.StatusOK)
+	}
+}
+
+var teamPermissionLevels = map[github.TeamPermission]github.RepoPermissionLevel{
+	github.RepoPull:     github.Read,
+	github.RepoTriage:   github.Triage,
+	github.RepoPush:     github.Write,
+	github.RepoMaintain: github.Maintain,
+	github.RepoAdmin:    github.Admin,
+}
+
+func permissionsFromLevel(level github.RepoPermissionLevel) github.RepoPermissions {
+	for permission, l := range teamPermissionLevels {
+		if l == level {
+			return github.PermissionsFromTeamPermission(permission)
+		}
+	}
+	return github.RepoPermissions{}
+}
+
+func collaboratorHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		login := mux.Vars(r)["user"]
+		switch r.Method {
+		case http.MethodGet:
+			if s.permission(repo, login) == github.None {
+				return notFound()
+			}
+			return "", http.StatusNoContent, nil
+		case http.MethodPut:
+			data := struct {
+				Permission github.TeamPermission `json:"permission"`
+			}{Permission: github.RepoPush}
+			if err := unmarshal(r, &data); err != nil {
+				return errorResponse(http.StatusBadRequest, "%v", err)
+			}
+			level, ok := teamPermissionLevels[data.Permission]
+			if !ok {
+				return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: unknown permission %q", data.Permission)
+			}
+			repo.collaborators[github.NormLogin(login)] = level
+			return "", http.StatusNoContent, nil
+		case http.MethodDelete:
+			delete(repo.collaborators, github.NormLogin(login))
+			return "", http.StatusNoContent, nil
+		}
+		return notSupported(r)
+	}
+}
+
+func permissionHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		login := mux.Vars(r)["user"]
+		return marshal(struct {
+			Permission github.RepoPermissionLevel `json:"permission"`
+			User       github.User                `json:"user"`
+		}{Permission: s.permission(repo, login), User: s.user(login)}, http.StatusOK)
+	}
+}
+
+func statusesHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		sha := repo.resolveRef(mux.Vars(r)["sha"])
+		if r.Method == http.MethodGet {
+			// Statuses are listed newest first.
+			statuses := []github.Status{}
+			for idx := len(repo.statuses[sha]) - 1; idx >= 0; idx-- {
+				statuses = append(statuses, repo.statuses[sha][idx])
+			}
+			return marshal(statuses, http.StatusOK)
+		}
+		var status github.Status
+		if err := unmarshal(r, &status); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		switch status.State {
+		case github.StatusPending, github.StatusSuccess, github.StatusError, github.StatusFailure:
+		default:
+			return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: invalid state %q", status.State)
+		}
+		if status.Context == "" {
+			status.Context = "default"
+		}
+		repo.statuses[sha] = append(repo.statuses[sha], status)
+		s.touchPullRequests(repo, sha)
+		s.event(repo, "status", github.StatusEvent{
+			SHA:         sha,
+			State:       status.State,
+			Description: status.Description,
+			TargetURL:   status.TargetURL,
+			ID:          s.nextID(),
+			Name:        repo.FullName,
+			Context:     status.Context,
+			Sender:      s.actor(r),
+			Repo:        repo.Repo,
+		})
+		return marshal(status, http.StatusCreated)
+	}
+}
+
+// touchPullRequests marks the pull requests whose head is sha as updated, so
+// that searches for recently updated pull requests find them.
+func (s *state) touchPullRequests(repo *repoState, sha string) {
+	for _, i := range repo.issues {
+		if i.pr != nil && i.pr.Head.SHA == sha {
+			s.touch(i)
+		}
+	}
+}
+
+func combinedStatusHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		return marshal(repo.combinedStatus(repo.resolveRef(mux.Vars(r)["ref"])), http.StatusOK)
+	}
+}
+
+func listCheckRunsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		runs := append([]github.CheckRun{}, repo.checkRuns[repo.resolveRef(mux.Vars(r)["ref"])]...)
+		return marshal(github.CheckRunList{Total: len(runs), CheckRuns: runs}, http.StatusOK)
+	}
+}
+
+func checkRunHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		var data github.CheckRun
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		now := s.now().Format(time.RFC3339)
+		if r.Method == http.MethodPost {
+			if data.Name == "" || data.HeadSHA == "" {
+				return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: name and head_sha are required")
+			}
+			data.ID = int64(s.nextID())
+			data.NodeID = fmt.Sprintf("CR_%d", data.ID)
+			data.StartedAt = now
+			if data.Status == "" {
+				data.Status = "queued"
+			}
+			if data.Conclusion != "" {
+				data.Status, data.CompletedAt = "completed", now
+			}
+			repo.checkRuns[data.HeadSHA] = append(repo.checkRuns[data.HeadSHA], data)
+			s.touchPullRequests(repo, data.HeadSHA)
+			return marshal(data, http.StatusCreated)
+		}
+		id, err := intVar(r, "id")
+		if err != nil {
+			return notFound()
+		}
+		for sha, runs := range repo.checkRuns {
+			for idx := range runs {
+				run := &runs[idx]
+				if run.ID != int64(id) {
+					continue
+				}
+				if data.Status != "" {
+					run.Status = data.Status
+				}
+				if data.Conclusion != "" {
+					run.Conclusion, run.Status, run.CompletedAt = data.Conclusion, "completed", now
+				}
+				if data.Output.Title != "" || data.Output.Summary != "" {
+					run.Output = data.Output
+				}
+				if data.DetailsURL != "" {
+					run.DetailsURL = data.DetailsURL
+				}
+				s.touchPullRequests(repo, sha)
+				return marshal(run, http.StatusOK)
+			}
+		}
+		return notFound()
+	}
+}
+
+func rulesetsHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		if r.Method == http.MethodGet {
+			// Listing only returns a summary of every ruleset.
+			rulesets := []github.Ruleset{}
+			for _, rs := range repo.rulesets {
+				rulesets = append(rulesets, github.Ruleset{ID: rs.ID, Name: rs.Name, Target: rs.Target, Enforcement: rs.Enforcement})
+			}
+			return marshal(rulesets, http.StatusOK)
+		}
+		var data github.Ruleset
+		if err := unmarshal(r, &data); err != nil {
+			return errorResponse(http.StatusBadRequest, "%v", err)
+		}
+		for _, rs := range repo.rulesets {
+			if rs.Name == data.Name {
+				return errorResponse(http.StatusUnprocessableEntity, "Validation Failed: Name must be unique")
+			}
+		}
+		data.ID = s.nextID()
+		repo.rulesets = append(repo.rulesets, data)
+		return marshal(data, http.StatusCreated)
+	}
+}
+
+func rulesetHandler(s *state) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		repo := s.repo(r)
+		id, err := intVar(r, "ruleset_id")
+		if err != nil {
+			return notFound()
+		}
+		for idx, rs := range repo.rulesets {
+			if rs.ID != id {
+				continue
+			}
+			switch r.Method {
+			case http.MethodGet:
+				return marshal(rs, http.StatusOK)
+			case http.MethodPut:
+				var data github.Ruleset
+				if err := unmarshal(r, &data); err != nil {
+					return errorResponse(http.StatusBadRequest, "%v", err)
+				}
+				data.ID = id
+				repo.rulesets[idx] = data
+				return marshal(data, http.StatusOK)
+			case http.MethodDelete:
+				repo.rulesets = append(repo.rulesets[:idx], repo.rulesets[idx+1:]...)
+				return "", http.StatusNoContent, nil
+			}
+			return notSupported(r)
+		}
+		return notFound()
+	}
+}
@@ -0,0 +1,476 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// queryRoot is the GraphQL Query type.
+func (s *state) queryRoot(viewer github.User) gqlObject {
+	return gqlObject{
+		"__typename": "Query",
+		"rateLimit": gqlObject{
+			"__typename": "RateLimit",
+			"cost":       1,
+			"limit":      5000,
+			"remaining":  5000,
+			"nodeCount":  0,
+			"resetAt":    s.now().Add(time.Hour).Format(time.RFC3339),
+		},
+		"viewer": s.userObject(viewer.Login),
+		"search": gqlField(func(args map[string]interface{}) (interface{}, error) {
+			return s.search(args)
+		}),
+		"repository": gqlField(func(args map[string]interface{}) (interface{}, error) {
+			repo, ok := s.repos[stringArg(args, "owner")+"/"+stringArg(args, "name")]
+			if !ok {
+				return nil, fmt.Errorf("Could not resolve to a Repository with the name '%s/%s'.", stringArg(args, "owner"), stringArg(args, "name"))
+			}
+			return s.repoObject(repo), nil
+		}),
+	}
+}
+
+// search implements the search field for issues and pull requests.
+func (s *state) search(args map[string]interface{}) (interface{}, error) {
+	if searchType := stringArg(args, "type"); searchType != "ISSUE" {
+		return nil, fmt.Errorf("search type %q is not supported", searchType)
+	}
+	q, err := parseSearch(stringArg(args, "query"))
+	if err != nil {
+		return nil, err
+	}
+	var nodes []interface{}
+	for _, repo := range s.sortedRepos() {
+		for _, number := range repo.sortedIssues() {
+			if i := repo.issues[number]; q.matches(s, repo, i) {
+				nodes = append(nodes, s.issueObject(repo, i))
+			}
+		}
+	}
+	total := len(nodes)
+	// The cursor is the offset of the first result of the next page.
+	offset := 0
+	if after := stringArg(args, "after"); after != "" {
+		if offset, err = strconv.Atoi(after); err != nil {
+			return nil, fmt.Errorf("invalid cursor %q", after)
+		}
+	}
+	if offset > len(nodes) {
+		offset = len(nodes)
+	}
+	nodes = nodes[offset:]
+	first, ok := intArg(args, "first")
+	if !ok || first > 100 {
+		first = 100
+	}
+	hasNextPage := len(nodes) > first
+	if hasNextPage {
+		nodes = nodes[:first]
+	}
+	conn := connection(nodes)
+	conn["__typename"] = "SearchResultItemConnection"
+	conn["issueCount"] = total
+	conn["pageInfo"] = gqlObject{
+		"hasNextPage":     hasNextPage,
+		"hasPreviousPage": offset > 0,
+		"startCursor":     strconv.Itoa(offset),
+		"endCursor":       strconv.Itoa(offset + len(nodes)),
+	}
+	return conn, nil
+}
+
+// searchQuery is a parsed search string. Qualifiers are combined the way
+// GitHub does: different qualifiers must all match, while repeated org, repo
+// and user qualifiers match if any of them does.
+type searchQuery struct {
+	kind       string
+	state      string
+	archived   *bool
+	draft      *bool
+	scopes     []string
+	notScopes  []string
+	labels     [][]string
+	notLabels  []string
+	authors    []string
+	notAuthors []string
+	bases      []string
+	notBases   []string
+	heads      []string
+	milestone  *string
+	review     string
+	since      time.Time
+	until      time.Time
+	terms      []string
+}
+
+func parseSearch(query string) (*searchQuery, error) {
+	q := &searchQuery{}
+	for _, tok := range splitSearch(query) {
+		negated := strings.HasPrefix(tok, "-")
+		key, value, qualified := splitQualifier(strings.TrimPrefix(tok, "-"))
+		if !qualified {
+			q.terms = append(q.terms, strings.ToLower(tok))
+			continue
+		}
+		var err error
+		switch key {
+		case "is", "type", "state":
+			switch value {
+			case "pr", "issue":
+				q.kind = value
+			case "open", "closed", "merged", "unmerged":
+				q.state = value
+			case "draft":
+				draft := !negated
+				q.draft = &draft
+			default:
+				err = fmt.Errorf("unsupported value %q", value)
+			}
+		case "archived", "draft":
+			var b bool
+			if b, err = strconv.ParseBool(value); err == nil {
+				if key == "archived" {
+					q.archived = &b
+				} else {
+					q.draft = &b
+				}
+			}
+		case "org", "user", "repo":
+			if negated {
+				q.notScopes = append(q.notScopes, strings.ToLower(value))
+			} else {
+				q.scopes = append(q.scopes, strings.ToLower(value))
+			}
+		case "label":
+			if negated {
+				q.notLabels = append(q.notLabels, strings.Split(strings.ToLower(value), ",")...)
+			} else {
+				q.labels = append(q.labels, strings.Split(strings.ToLower(value), ","))
+			}
+		case "author":
+			if negated {
+				q.notAuthors = append(q.notAuthors, github.NormLogin(value))
+			} else {
+				q.authors = append(q.authors, github.NormLogin(value))
+			}
+		case "base":
+			if negated {
+				q.notBases = append(q.notBases, value)
+			} else {
+				q.bases = append(q.bases, value)
+			}
+		case "head":
+			q.heads = append(q.heads, value)
+		case "milestone":
+			q.milestone = &value
+		case "review":
+			q.review = value
+		case "updated":
+			q.since, q.until, err = parseDateRange(value)
+		default:
+			err = fmt.Errorf("unsupported qualifier")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid search token %q: %w", tok, err)
+		}
+	}
+	return q, nil
+}
+
+// splitSearch splits a query on white space, keeping quoted values together
+// and dropping their quotes.
+func splitSearch(query string) []string {
+	var toks []string
+	var cur strings.Builder
+	quoted := false
+	for _, c := range query {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ' ' && !quoted:
+			if cur.Len() > 0 {
+				toks = append(toks, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if cur.Len() > 0 {
+		toks = append(toks, cur.String())
+	}
+	return toks
+}
+
+func splitQualifier(tok string) (string, string, bool) {
+	idx := strings.Index(tok, ":")
+	if idx <= 0 {
+		return "", "", false
+	}
+	return strings.ToLower(tok[:idx]), tok[idx+1:], true
+}
+
+// parseDateRange parses start..end, where either side may be *.
+func parseDateRange(value string) (time.Time, time.Time, error) {
+	parts := strings.Split(value, "..")
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("expected start..end")
+	}
+	var times [2]time.Time
+	for idx, part := range parts {
+		if part == "*" {
+			continue
+		}
+		t, err := time.Parse(github.SearchTimeFormat, part)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		times[idx] = t
+	}
+	return times[0], times[1], nil
+}
+
+func (q *searchQuery) matches(s *state, repo *repoState, i *issue) bool {
+	switch {
+	case q.kind == "pr" && i.pr == nil,
+		q.kind == "issue" && i.pr != nil,
+		q.state == "open" && i.State != github.PullRequestStateOpen,
+		q.state == "closed" && i.State != github.PullRequestStateClosed,
+		q.state == "merged" && (i.pr == nil || !i.pr.Merged),
+		q.state == "unmerged" && (i.pr == nil || i.pr.Merged),
+		q.archived != nil && *q.archived != repo.Archived,
+		q.draft != nil && (i.pr == nil || *q.draft != i.pr.Draft),
+		q.milestone != nil && *q.milestone != i.Milestone.Title,
+		q.review == "approved" && (i.pr == nil || i.reviewDecision() != string(github.ReviewStateApproved)),
+		q.review == "changes_requested" && (i.pr == nil || i.reviewDecision() != string(github.ReviewStateChangesRequested)),
+		q.review == "none" && (i.pr == nil || len(i.reviews) > 0),
+		!q.since.IsZero() && i.UpdatedAt.Before(q.since),
+		!q.until.IsZero() && i.UpdatedAt.After(q.until):
+		return false
+	}
+	inScope := func(scope string) bool {
+		return scope == strings.ToLower(repo.FullName) || scope == strings.ToLower(repo.Owner.Login)
+	}
+	if len(q.scopes) > 0 && !anyOf(q.scopes, inScope) {
+		return false
+	}
+	if anyOf(q.notScopes, inScope) {
+		return false
+	}
+	for _, alternatives := range q.labels {
+		if !anyOf(alternatives, i.HasLabel) {
+			return false
+		}
+	}
+	if anyOf(q.notLabels, i.HasLabel) {
+		return false
+	}
+	isAuthor := func(login string) bool { return github.NormLogin(i.User.Login) == login }
+	if len(q.authors) > 0 && !anyOf(q.authors, isAuthor) {
+		return false
+	}
+	if anyOf(q.notAuthors, isAuthor) {
+		return false
+	}
+	if len(q.bases)+len(q.notBases)+len(q.heads) > 0 {
+		if i.pr == nil {
+			return false
+		}
+		isBase := func(b string) bool { return b == i.pr.Base.Ref }
+		isHead := func(h string) bool { return h == i.pr.Head.Ref }
+		if (len(q.bases) > 0 && !anyOf(q.bases, isBase)) || anyOf(q.notBases, isBase) || (len(q.heads) > 0 && !anyOf(q.heads, isHead)) {
+			return false
+		}
+	}
+	text := strings.ToLower(i.Title + "\n" + i.Body)
+	for _, term := range q.terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+func anyOf(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *state) userObject(login string) gqlObject {
+	user := s.user(login)
+	typename := "User"
+	if user.Type == github.UserTypeBot {
+		typename = "Bot"
+	}
+	return gqlObject{
+		"__typename": typename,
+		"id":         fmt.Sprintf("U_%d", user.ID),
+		"login":      user.Login,
+		"url":        user.HTMLURL,
+	}
+}
+
+func (s *state) repoObject(repo *repoState) gqlObject {
+	return gqlObject{
+		"__typename":    "Repository",
+		"id":            repo.NodeID,
+		"name":          repo.Name,
+		"nameWithOwner": repo.FullName,
+		"url":           repo.HTMLURL,
+		"isArchived":    repo.Archived,
+		"isPrivate":     repo.Private,
+		"owner": gqlObject{
+			"__typename": "Organization",
+			"login":      repo.Owner.Login,
+		},
+		"defaultBranchRef": gqlObject{
+			"__typename": "Ref",
+			"name":       repo.DefaultBranch,
+			"prefix":     "refs/heads/",
+		},
+		"pullRequest": gqlField(func(args map[string]interface{}) (interface{}, error) {
+			number, _ := intArg(args, "number")
+			if i, ok := repo.issues[number]; ok && i.pr != nil {
+				return s.issueObject(repo, i), nil
+			}
+			return nil, fmt.Errorf("Could not resolve to a PullRequest with the number of %d.", number)
+		}),
+		"issue": gqlField(func(args map[string]interface{}) (interface{}, error) {
+			number, _ := intArg(args, "number")
+			if i, ok := repo.issues[number]; ok && i.pr == nil {
+				return s.issueObject(repo, i), nil
+			}
+			return nil, fmt.Errorf("Could not resolve to an Issue with the number of %d.", number)
+		}),
+	}
+}
+
+// issueObject renders an issue or pull request for GraphQL.
+func (s *state) issueObject(repo *repoState, i *issue) gqlObject {
+	var labels, assignees []interface{}
+	for _, l := range i.Labels {
+		labels = append(labels, gqlObject{"__typename": "Label", "name": l.Name, "color": l.Color, "description": l.Description})
+	}
+	for _, a := range i.Assignees {
+		assignees = append(assignees, s.userObject(a.Login))
+	}
+	var milestone interface{}
+	if i.Milestone.Number != 0 || i.Milestone.Title != "" {
+		milestone = gqlObject{"__typename": "Milestone", "title": i.Milestone.Title, "number": i.Milestone.Number}
+	}
+	obj := gqlObject{
+		"__typename": "Issue",
+		"id":         i.NodeID,
+		"number":     i.Number,
+		"title":      i.Title,
+		"body":       i.Body,
+		"url":        i.HTMLURL,
+		"state":      strings.ToUpper(i.State),
+		"closed":     i.State == github.PullRequestStateClosed,
+		"createdAt":  i.CreatedAt.Format(time.RFC3339),
+		"updatedAt":  i.UpdatedAt.Format(time.RFC3339),
+		"author":     s.userObject(i.User.Login),
+		"repository": s.repoObject(repo),
+		"labels":     connection(labels),
+		"assignees":  connection(assignees),
+		"milestone":  milestone,
+	}
+	if i.pr == nil {
+		return obj
+	}
+	pr := repo.pullRequest(i)
+	obj["__typename"] = "PullRequest"
+	obj["id"] = pr.NodeID
+	if pr.Merged {
+		obj["state"] = "MERGED"
+	}
+	obj["merged"] = pr.Merged
+	obj["isDraft"] = pr.Draft
+	obj["baseRefName"] = pr.Base.Ref
+	obj["baseRefOid"] = pr.Base.SHA
+	obj["baseRef"] = gqlObject{"__typename": "Ref", "name": pr.Base.Ref, "prefix": "refs/heads/"}
+	obj["headRefName"] = pr.Head.Ref
+	obj["headRefOid"] = pr.Head.SHA
+	obj["mergeable"] = "UNKNOWN"
+	if pr.Mergable != nil && *pr.Mergable {
+		obj["mergeable"] = "MERGEABLE"
+	}
+	obj["reviewDecision"] = nil
+	if decision := i.reviewDecision(); decision != "" {
+		obj["reviewDecision"] = decision
+	}
+	var commits []interface{}
+	for _, c := range i.commits {
+		commits = append(commits, gqlObject{"__typename": "PullRequestCommit", "commit": s.commitObject(repo, c.SHA)})
+	}
+	obj["commits"] = connection(commits)
+	return obj
+}
+
+// commitObject renders a commit with its statuses and check runs.
+func (s *state) commitObject(repo *repoState, sha string) gqlObject {
+	combined := repo.combinedStatus(sha)
+	var contexts, rollup []interface{}
+	for _, status := range combined.Statuses {
+		context := gqlObject{
+			"__typename":  "StatusContext",
+			"context":     status.Context,
+			"description": status.Description,
+			"state":       strings.ToUpper(status.State),
+			"targetUrl":   status.TargetURL,
+		}
+		contexts = append(contexts, context)
+		rollup = append(rollup, context)
+	}
+	for _, run := range repo.checkRuns[sha] {
+		rollup = append(rollup, gqlObject{
+			"__typename": "CheckRun",
+			"name":       run.Name,
+			"status":     strings.ToUpper(run.Status),
+			"conclusion": strings.ToUpper(run.Conclusion),
+			"detailsUrl": run.DetailsURL,
+		})
+	}
+	if contexts == nil {
+		contexts = []interface{}{}
+	}
+	return gqlObject{
+		"__typename": "Commit",
+		"oid":        sha,
+		"status": gqlObject{
+			"__typename": "Status",
+			"state":      strings.ToUpper(combined.State),
+			"contexts":   contexts,
+		},
+		"statusCheckRollup": gqlObject{
+			"__typename": "StatusCheckRollup",
+			"state":      strings.ToUpper(combined.State),
+			"contexts":   connection(rollup),
+		},
+	}
+}
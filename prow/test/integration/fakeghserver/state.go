@@ -0,0 +1,526 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// seed is the initial state of the server.
+type seed struct {
+	// Tokens maps OAuth tokens to the users they authenticate. Requests
+	// with an unknown or empty token are made by the bot.
+	Tokens map[string]string `json:"tokens,omitempty"`
+	// OrgMembers maps orgs to their members.
+	OrgMembers map[string][]string `json:"org_members,omitempty"`
+	// Repos that exist up front. Requests for other repos fail with 404 Not
+	// Found, like they do on GitHub.
+	Repos []seedRepo `json:"repos,omitempty"`
+}
+
+type seedRepo struct {
+	Org  string `json:"org"`
+	Name string `json:"name"`
+	// DefaultBranch defaults to master.
+	DefaultBranch string `json:"default_branch,omitempty"`
+	// Branches maps branch names to their HEAD SHA. The default branch gets
+	// a generated SHA unless it is listed.
+	Branches map[string]string `json:"branches,omitempty"`
+	// Collaborators maps logins to their permission level.
+	Collaborators map[string]github.RepoPermissionLevel `json:"collaborators,omitempty"`
+	Labels        []github.Label                        `json:"labels,omitempty"`
+	Archived      bool                                  `json:"archived,omitempty"`
+}
+
+func loadSeed(path string) (*seed, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sd seed
+	if err := yaml.UnmarshalStrict(raw, &sd); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &sd, nil
+}
+
+// state models the GitHub data the server exposes. Handlers hold the lock
+// for the duration of a request, and every change is passed to deliver as the
+// webhook GitHub would send to each matching hook of the repo and its org.
+type state struct {
+	lock sync.Mutex
+
+	bot        string
+	tokens     map[string]string
+	orgMembers map[string]sets.String
+	repos      map[string]*repoState
+	// orgHooks are the webhooks of orgs, by org and hook ID.
+	orgHooks map[string]map[int]*github.Hook
+	userIDs  map[string]int
+	// lastID is shared by everything that has an ID, like GitHub does.
+	lastID int
+
+	now     func() time.Time
+	deliver func(webhook)
+}
+
+type repoState struct {
+	github.FullRepo
+
+	// refs maps refs like heads/master to a SHA.
+	refs map[string]string
+	// labels are keyed by their lower case name.
+	labels        map[string]github.Label
+	collaborators map[string]github.RepoPermissionLevel
+	issues        map[int]*issue
+	lastNumber    int
+	// statuses and checkRuns are keyed by SHA, oldest first.
+	statuses  map[string][]github.Status
+	checkRuns map[string][]github.CheckRun
+	rulesets  []github.Ruleset
+	// hooks are the webhooks of the repo by ID.
+	hooks map[int]*github.Hook
+}
+
+// issue is an issue or, when pr is set, a pull request. Fields that both
+// share, like labels and assignees, live in Issue.
+type issue struct {
+	github.Issue
+
+	pr       *github.PullRequest
+	comments []github.IssueComment
+	reviews  []github.Review
+	changes  []github.PullRequestChange
+	commits  []github.RepositoryCommit
+}
+
+func newState(bot string, deliver func(webhook)) *state {
+	return &state{
+		bot:        bot,
+		tokens:     map[string]string{},
+		orgMembers: map[string]sets.String{},
+		repos:      map[string]*repoState{},
+		orgHooks:   map[string]map[int]*github.Hook{},
+		userIDs:    map[string]int{},
+		now:        time.Now,
+		deliver:    deliver,
+	}
+}
+
+func (s *state) load(sd *seed) {
+	for token, login := range sd.Tokens {
+		s.tokens[token] = login
+	}
+	for org, members := range sd.OrgMembers {
+		s.orgMembers[org] = sets.NewString(members...)
+	}
+	for _, sr := range sd.Repos {
+		r := s.newRepo(sr.Org, sr.Name, sr.DefaultBranch)
+		r.Archived = sr.Archived
+		for branch, sha := range sr.Branches {
+			r.refs["heads/"+branch] = sha
+		}
+		for login, permission := range sr.Collaborators {
+			r.collaborators[github.NormLogin(login)] = permission
+		}
+		for _, label := range sr.Labels {
+			r.labels[strings.ToLower(label.Name)] = label
+		}
+	}
+}
+
+// locked serializes requests on the state.
+func (s *state) locked(f func(*http.Request) (interface{}, int, error)) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return f(r)
+	}
+}
+
+func (s *state) nextID() int {
+	s.lastID++
+	return s.lastID
+}
+
+// sha returns a unique, made up commit SHA.
+func (s *state) sha() string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("fakeghserver-%d", s.nextID()))))
+}
+
+func (s *state) user(login string) github.User {
+	id, ok := s.userIDs[github.NormLogin(login)]
+	if !ok {
+		id = s.nextID()
+		s.userIDs[github.NormLogin(login)] = id
+	}
+	userType := github.UserTypeUser
+	if login == s.bot {
+		userType = github.UserTypeBot
+	}
+	return github.User{
+		Login:   login,
+		ID:      id,
+		HTMLURL: "https://github.com/" + login,
+		Type:    userType,
+	}
+}
+
+// actor returns the user the request is authenticated as.
+func (s *state) actor(r *http.Request) github.User {
+	auth := r.Header.Get("Authorization")
+	for _, prefix := range []string{"Bearer ", "bearer ", "token "} {
+		if login, ok := s.tokens[strings.TrimPrefix(auth, prefix)]; ok && strings.HasPrefix(auth, prefix) {
+			return s.user(login)
+		}
+	}
+	return s.user(s.bot)
+}
+
+func (s *state) newRepo(org, name, defaultBranch string) *repoState {
+	if defaultBranch == "" {
+		defaultBranch = "master"
+	}
+	fullName := org + "/" + name
+	r := &repoState{
+		FullRepo: github.FullRepo{
+			Repo: github.Repo{
+				Owner:         github.User{Login: org, Type: "Organization"},
+				Name:          name,
+				FullName:      fullName,
+				HTMLURL:       "https://github.com/" + fullName,
+				DefaultBranch: defaultBranch,
+				HasIssues:     true,
+				NodeID:        fmt.Sprintf("R_%d", s.nextID()),
+				Permissions:   github.RepoPermissions{Pull: true, Push: true, Admin: true},
+			},
+			AllowMergeCommit: true,
+			AllowSquashMerge: true,
+			AllowRebaseMerge: true,
+		},
+		refs:          map[string]string{"heads/" + defaultBranch: s.sha()},
+		labels:        map[string]github.Label{},
+		collaborators: map[string]github.RepoPermissionLevel{},
+		issues:        map[int]*issue{},
+		statuses:      map[string][]github.Status{},
+		checkRuns:     map[string][]github.CheckRun{},
+		hooks:         map[int]*github.Hook{},
+	}
+	s.repos[fullName] = r
+	return r
+}
+
+// repo returns the repo addressed by the request, or nil if it doesn't
+// exist. Handlers of repo paths are only called for existing repos.
+func (s *state) repo(r *http.Request) *repoState {
+	vars := mux.Vars(r)
+	return s.repos[vars["org"]+"/"+vars["repo"]]
+}
+
+// existingRepo responds with 404 Not Found to requests for repos that don't
+// exist instead of calling f.
+func (s *state) existingRepo(f func(*http.Request) (interface{}, int, error)) func(*http.Request) (interface{}, int, error) {
+	return func(r *http.Request) (interface{}, int, error) {
+		if s.repo(r) == nil {
+			return notFound()
+		}
+		return f(r)
+	}
+}
+
+// issue returns the issue or pull request addressed by the request.
+func (s *state) issue(r *http.Request) (*repoState, *issue, error) {
+	repo := s.repo(r)
+	number, err := intVar(r, "number")
+	if err != nil {
+		return repo, nil, err
+	}
+	i, ok := repo.issues[number]
+	if !ok {
+		return repo, nil, nil
+	}
+	return repo, i, nil
+}
+
+func (s *state) isMember(org, login string) bool {
+	return s.orgMembers[org].Has(github.NormLogin(login))
+}
+
+// permission returns the permission level of login on the repo. Org members
+// can read the repos of their org.
+func (s *state) permission(r *repoState, login string) github.RepoPermissionLevel {
+	if login == s.bot {
+		return github.Admin
+	}
+	if p, ok := r.collaborators[github.NormLogin(login)]; ok {
+		return p
+	}
+	if s.isMember(r.Owner.Login, login) {
+		return github.Read
+	}
+	return github.None
+}
+
+// resolveRef maps branch names to the SHA they point to and returns
+// anything else unchanged.
+func (r *repoState) resolveRef(ref string) string {
+	for _, prefix := range []string{"heads/", "tags/", ""} {
+		if sha, ok := r.refs[prefix+strings.TrimPrefix(ref, "refs/")]; ok {
+			return sha
+		}
+	}
+	return ref
+}
+
+func (r *repoState) label(name string) github.Label {
+	if l, ok := r.labels[strings.ToLower(name)]; ok {
+		return l
+	}
+	// GitHub creates labels that are added to issues but don't exist yet.
+	l := github.Label{Name: name, Color: "ededed", URL: fmt.Sprintf("https://api.github.com/repos/%s/labels/%s", r.FullName, name)}
+	r.labels[strings.ToLower(name)] = l
+	return l
+}
+
+func (r *repoState) combinedStatus(sha string) github.CombinedStatus {
+	latest := map[string]github.Status{}
+	for _, status := range r.statuses[sha] {
+		latest[status.Context] = status
+	}
+	combined := github.CombinedStatus{SHA: sha, State: github.StatusSuccess, Statuses: []github.Status{}}
+	for _, status := range latest {
+		combined.Statuses = append(combined.Statuses, status)
+		switch {
+		case status.State == github.StatusError || status.State == github.StatusFailure:
+			combined.State = github.StatusFailure
+		case status.State == github.StatusPending && combined.State == github.StatusSuccess:
+			combined.State = github.StatusPending
+		}
+	}
+	if len(combined.Statuses) == 0 {
+		combined.State = github.StatusPending
+	}
+	sort.Slice(combined.Statuses, func(a, b int) bool {
+		return combined.Statuses[a].Context < combined.Statuses[b].Context
+	})
+	return combined
+}
+
+// pullRequest renders the REST view of a pull request.
+func (r *repoState) pullRequest(i *issue) github.PullRequest {
+	pr := *i.pr
+	pr.Number = i.Number
+	pr.User = i.User
+	pr.Title = i.Title
+	pr.Body = i.Body
+	pr.State = i.State
+	pr.Labels = append([]github.Label{}, i.Labels...)
+	pr.Assignees = append([]github.User{}, i.Assignees...)
+	pr.CreatedAt = i.CreatedAt
+	pr.UpdatedAt = i.UpdatedAt
+	if i.Milestone.Number != 0 {
+		milestone := i.Milestone
+		pr.Milestone = &milestone
+	}
+	pr.Base.Repo = r.Repo
+	pr.Head.Repo = r.Repo
+	pr.Commits = len(i.commits)
+	if !pr.Merged && pr.State == github.PullRequestStateOpen {
+		mergeable := true
+		pr.Mergable = &mergeable
+	}
+	return pr
+}
+
+// reviewDecision summarizes the latest review of every reviewer like the
+// reviewDecision GraphQL field does.
+func (i *issue) reviewDecision() string {
+	latest := map[string]github.ReviewState{}
+	for _, review := range i.reviews {
+		if review.State == github.ReviewStateApproved || review.State == github.ReviewStateChangesRequested || review.State == github.ReviewStateDismissed {
+			latest[github.NormLogin(review.User.Login)] = review.State
+		}
+	}
+	decision := ""
+	for _, state := range latest {
+		switch state {
+		case github.ReviewStateChangesRequested:
+			return string(github.ReviewStateChangesRequested)
+		case github.ReviewStateApproved:
+			decision = string(github.ReviewStateApproved)
+		}
+	}
+	return decision
+}
+
+// touch marks the issue as updated.
+func (s *state) touch(i *issue) {
+	i.UpdatedAt = s.now()
+}
+
+// event delivers payload to the active hooks of the repo and its org that
+// subscribe to eventType. The payload is snapshotted so that later changes to
+// the state don't leak into webhooks that have not been delivered yet.
+func (s *state) event(r *repoState, eventType string, payload interface{}) {
+	var hooks []*github.Hook
+	for _, hook := range append(sortedHooks(s.orgHooks[r.Owner.Login]), sortedHooks(r.hooks)...) {
+		if hook.Active && subscribes(hook, eventType) {
+			hooks = append(hooks, hook)
+		}
+	}
+	if len(hooks) == 0 || s.deliver == nil {
+		return
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		logrus.WithError(err).Errorf("Failed to marshal %s event.", eventType)
+		return
+	}
+	for _, hook := range hooks {
+		w := webhook{url: hook.Config.URL, eventType: eventType, payload: raw}
+		if hook.Config.Secret != nil {
+			w.secret = *hook.Config.Secret
+		}
+		s.deliver(w)
+	}
+}
+
+// issueEvent reports a change to an issue, or to a pull request if the
+// issue is one.
+func (s *state) issueEvent(r *repoState, i *issue, action string, label *github.Label, sender github.User) {
+	if i.pr != nil {
+		event := github.PullRequestEvent{
+			Action:      github.PullRequestEventAction(action),
+			Number:      i.Number,
+			PullRequest: r.pullRequest(i),
+			Repo:        r.Repo,
+			Sender:      sender,
+		}
+		if label != nil {
+			event.Label = *label
+		}
+		s.event(r, "pull_request", event)
+		return
+	}
+	event := github.IssueEvent{
+		Action: github.IssueEventAction(action),
+		Issue:  i.Issue,
+		Repo:   r.Repo,
+		Sender: sender,
+	}
+	if label != nil {
+		event.Label = *label
+	}
+	s.event(r, "issues", event)
+}
+
+// updateRef points ref at sha and synchronizes the pull requests whose head
+// is that branch.
+func (s *state) updateRef(r *repoState, ref, sha string, sender github.User) {
+	before, existed := r.refs[ref]
+	if sha == "" {
+		delete(r.refs, ref)
+	} else {
+		r.refs[ref] = sha
+	}
+	push := github.PushEvent{
+		Ref:     "refs/" + ref,
+		Before:  before,
+		After:   sha,
+		Created: !existed,
+		Deleted: sha == "",
+		Compare: fmt.Sprintf("%s/compare/%s...%s", r.HTMLURL, before, sha),
+		Pusher:  sender,
+		Sender:  sender,
+		Repo:    r.Repo,
+	}
+	if sha != "" {
+		push.Commits = []github.Commit{{ID: sha, Message: "Update " + ref}}
+	}
+	if before == "" {
+		push.Before = strings.Repeat("0", 40)
+	}
+	if sha == "" {
+		push.After = strings.Repeat("0", 40)
+	}
+	s.event(r, "push", push)
+
+	if !strings.HasPrefix(ref, "heads/") || sha == "" {
+		return
+	}
+	branch := strings.TrimPrefix(ref, "heads/")
+	for _, number := range r.sortedIssues() {
+		i := r.issues[number]
+		if i.pr == nil || i.State != github.PullRequestStateOpen || i.pr.Head.Ref != branch {
+			continue
+		}
+		i.pr.Head.SHA = sha
+		i.commits = append(i.commits, s.commit(sha, sender))
+		s.touch(i)
+		s.issueEvent(r, i, string(github.PullRequestActionSynchronize), nil, sender)
+	}
+}
+
+func (s *state) commit(sha string, author github.User) github.RepositoryCommit {
+	return github.RepositoryCommit{
+		SHA: sha,
+		Commit: github.GitCommit{
+			SHA:     sha,
+			Message: "Commit " + sha[:7],
+			Author:  github.CommitAuthor{Name: author.Login, Date: s.now()},
+		},
+		Author:    author,
+		Committer: author,
+	}
+}
+
+func (r *repoState) sortedIssues() []int {
+	var numbers []int
+	for number := range r.issues {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+func (s *state) sortedRepos() []*repoState {
+	var names []string
+	for name := range s.repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var repos []*repoState
+	for _, name := range names {
+		repos = append(repos, s.repos[name])
+	}
+	return repos
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// webhook is a pending delivery to a hook.
+type webhook struct {
+	url string
+	// secret signs the payload, unless it is empty.
+	secret    string
+	eventType string
+	payload   []byte
+}
+
+// webhookSender delivers webhooks one at a time, in the order the changes
+// happened, like GitHub does for a single repository.
+type webhookSender struct {
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+	queue    chan webhook
+}
+
+func newWebhookSender() *webhookSender {
+	return &webhookSender{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		attempts: 5,
+		backoff:  time.Second,
+		queue:    make(chan webhook, 1000),
+	}
+}
+
+// enqueue schedules a delivery. It blocks when too many are pending, which
+// slows down clients rather than dropping events.
+func (w *webhookSender) enqueue(hook webhook) {
+	w.queue <- hook
+}
+
+// run delivers webhooks until ctx is done.
+func (w *webhookSender) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case hook := <-w.queue:
+			w.deliver(ctx, hook)
+		}
+	}
+}
+
+// deliver sends a webhook, retrying with backoff while the hook is
+// unavailable.
+func (w *webhookSender) deliver(ctx context.Context, hook webhook) {
+	guid := uuid.New().String()
+	log := logrus.WithFields(logrus.Fields{"url": hook.url, "event-type": hook.eventType, "event-GUID": guid})
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		err := w.send(ctx, guid, hook)
+		if err == nil {
+			log.Debug("Delivered webhook.")
+			return
+		}
+		if attempt == w.attempts {
+			log.WithError(err).Error("Giving up delivering webhook.")
+			return
+		}
+		log.WithError(err).Warnf("Failed to deliver webhook, retrying in %s.", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *webhookSender) send(ctx context.Context, guid string, hook webhook) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.url, bytes.NewReader(hook.payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", hook.eventType)
+	req.Header.Set("X-GitHub-Delivery", guid)
+	if hook.secret != "" {
+		req.Header.Set("X-Hub-Signature", github.PayloadSignature(hook.payload, []byte(hook.secret)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("response has status %d and body %s", resp.StatusCode, string(bytes.TrimSpace(body)))
+	}
+	return nil
+}
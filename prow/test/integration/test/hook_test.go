@@ -69,9 +69,8 @@ func TestHook(t *testing.T) {
 
 	d = []byte(strings.Replace(strings.Replace(string(d), "{ISSUE_ID_PLACEHOLDER}", strconv.Itoa(issueID), -1), "{COMMENT_ID_PLACEHOLDER}", strconv.Itoa(comments[0].ID), -1))
 
-	// Intentionally separate webhook from fakeghserver, to avoid the hassle of
-	// supporting webhooks for all faked gh events, as hook is the only place
-	// where webhook events are relevant
+	// Intentionally send the webhook from the test rather than through a hook
+	// of fakeghserver, so that hook only handles this event.
 	t.Log("Send webhook")
 	if err := phony.SendHook(url, "issue_comment", d, []byte(hmac)); err != nil {
 		t.Fatalf("Error sending hook: %v", err)